@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/maintenance"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
+)
+
+// AdminJob describes a maintenance or ingest job started through the admin API
+type AdminJob struct {
+	Name       string `json:"name"`
+	Running    bool   `json:"running"`
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+var (
+	// Only one admin job runs at a time; ingest and VACUUM both need the write lock
+	jobMu   sync.Mutex
+	lastJob *AdminJob
+
+	// jobListeners are called with each job once it finishes
+	jobListeners []func(AdminJob)
+)
+
+// onJobFinished registers fn to be called, on the job's goroutine, with
+// every admin job that finishes. Listeners are registered at startup,
+// before any job runs.
+func onJobFinished(fn func(AdminJob)) {
+	jobListeners = append(jobListeners, fn)
+}
+
+// startJob runs fn in the background unless another job is already running
+func startJob(ctx context.Context, name string, fn func(context.Context) error) (AdminJob, bool) {
+	jobMu.Lock()
+	defer jobMu.Unlock()
+
+	if lastJob != nil && lastJob.Running {
+		return *lastJob, false
+	}
+
+	job := &AdminJob{
+		Name:      name,
+		Running:   true,
+		StartedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	lastJob = job
+
+	go func() {
+		log.Printf("Admin job %s started", name)
+		err := tracing.Run(ctx, "job "+name, fn)
+
+		jobMu.Lock()
+		job.Running = false
+		job.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+		if err != nil {
+			job.Error = err.Error()
+			log.Printf("Admin job %s failed: %v", name, err)
+		} else {
+			log.Printf("Admin job %s complete", name)
+		}
+		finished := *job
+		jobMu.Unlock()
+
+		for _, fn := range jobListeners {
+			fn(finished)
+		}
+	}()
+
+	return *job, true
+}
+
+// currentJob returns a copy of the most recent job, if any
+func currentJob() *AdminJob {
+	jobMu.Lock()
+	defer jobMu.Unlock()
+	if lastJob == nil {
+		return nil
+	}
+	job := *lastJob
+	return &job
+}
+
+// importerPath locates the US importer binary. IMPORT_US_BIN overrides the
+// default of looking next to the running API binary (/app in the container).
+func importerPath() string {
+	if p := os.Getenv("IMPORT_US_BIN"); p != "" {
+		return p
+	}
+	return paths.Sibling("hamqrzdb-import-us")
+}
+
+// runImporter executes the US importer against dbPath, streaming its output to the log
+func runImporter(ctx context.Context, dbPath string, args ...string) error {
+	if err := refuseBundle(ctx); err != nil {
+		return err
+	}
+	args = append(args, "--db", dbPath)
+	cmd := exec.CommandContext(ctx, importerPath(), args...)
+	// The importer's spans join the job's trace
+	if tp := tracing.Traceparent(ctx); tp != "" {
+		cmd.Env = append(os.Environ(), "TRACEPARENT="+tp)
+	}
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start importer: %w", err)
+	}
+
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		log.Printf("[import-us] %s", scanner.Text())
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("importer exited: %w", err)
+	}
+	return nil
+}
+
+// maintainDatabase opens a short-lived writable connection and runs database
+// maintenance. The serving connection is read-only and can't do this itself.
+func maintainDatabase(ctx context.Context, dbPath string, opts maintenance.Options) error {
+	rw, err := sql.Open(tracing.Driver(), dbPath+"?_busy_timeout=30000")
+	if err != nil {
+		return fmt.Errorf("failed to open database for writing: %w", err)
+	}
+	defer rw.Close()
+
+	report, err := maintenance.Run(ctx, rw, opts)
+	if err != nil {
+		return err
+	}
+	log.Printf("Maintenance reclaimed %.1f MB", float64(report.ReclaimedBytes())/1024/1024)
+	return nil
+}
+
+// startMaintenanceSchedule runs maintenance every interval as an admin job,
+// so it never overlaps an ingest or vacuum started through the admin API.
+func startMaintenanceSchedule(ctx context.Context, dbPath string, interval time.Duration) {
+	startJobSchedule(ctx, "maintain", interval, func(ctx context.Context) error {
+		return maintainDatabase(ctx, dbPath, maintenance.Options{})
+	})
+}
+
+// startJobSchedule runs fn as the admin job name every interval. A run is
+// skipped if another job is still going.
+func startJobSchedule(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if _, started := startJob(ctx, name, fn); !started {
+				log.Printf("Skipping scheduled %s: another job is running", name)
+			}
+		}
+	}()
+}
+
+// openWritableDB opens a short-lived writable connection for admin writes,
+// bringing the schema up to date first
+func openWritableDB(ctx context.Context, dbPath string) (*sql.DB, error) {
+	rw, err := sql.Open(tracing.Driver(), dbPath+"?_busy_timeout=30000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database for writing: %w", err)
+	}
+	if err := schema.Ensure(ctx, rw); err != nil {
+		rw.Close()
+		return nil, err
+	}
+	return rw, nil
+}
+
+// handleAdminJob returns a handler that starts fn as a background admin job
+func handleAdminJob(ctx context.Context, name string, fn func(context.Context) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+
+		job, started := startJob(ctx, name, fn)
+		if !started {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": "another job is already running",
+				"job":   job,
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{"job": job})
+	}
+}
+
+// handleAdminStatus handles GET /admin/status with database and job state
+func handleAdminStatus(dbPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := map[string]interface{}{
+			"db_path":   dbPath,
+			"connected": false,
+			"job":       currentJob(),
+		}
+		if cluster.Role != roleStandalone {
+			status["role"] = cluster.Role
+			status["leader"] = isLeader()
+		}
+
+		if fi, err := os.Stat(dbPath); err == nil {
+			status["db_size_bytes"] = fi.Size()
+			status["db_modified"] = fi.ModTime().UTC().Format(time.RFC3339)
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+		defer cancel()
+
+		if d := getDB(); d != nil && d.PingContext(ctx) == nil {
+			status["connected"] = true
+			if info := servingBundle(ctx); info != nil {
+				status["bundle"] = info
+			}
+
+			var count int
+			var lastUpdated sql.NullString
+			err := d.QueryRowContext(ctx, "SELECT COUNT(*), MAX(last_updated) FROM callsigns").Scan(&count, &lastUpdated)
+			if err != nil {
+				log.Printf("Admin status query failed: %v", err)
+			} else {
+				status["record_count"] = count
+				status["last_updated"] = lastUpdated.String
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(status)
+	}
+}
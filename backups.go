@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/backup"
+)
+
+// backupConfig is where database backups are uploaded (BACKUP_S3_URL);
+// backups are off when it isn't enabled
+var backupConfig backup.Config
+
+// uploadBackup uploads a snapshot of the served database, if backups are
+// configured. It runs after every successful import, and in a cluster is
+// how the coordinator publishes snapshots.
+func uploadBackup(ctx context.Context) error {
+	if !backupConfig.Enabled() {
+		return nil
+	}
+	// In a cluster the bucket holds the snapshot workers serve, which only
+	// the importing coordinator may replace
+	if !isLeader() {
+		return errNotLeader
+	}
+	d := getDB()
+	if d == nil {
+		return errors.New("database not connected")
+	}
+	if _, err := backup.Upload(ctx, backupConfig, d); err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	return nil
+}
+
+// restoreMissingDatabase restores the latest backup to dbPath when the file
+// doesn't exist yet, so a replaced container starts with its data
+func restoreMissingDatabase(ctx context.Context, dbPath string) {
+	if !backupConfig.Enabled() {
+		return
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		return
+	}
+	switch err := backup.Restore(ctx, backupConfig, dbPath); {
+	case errors.Is(err, backup.ErrNoBackup):
+		log.Printf("No backup to restore in s3://%s", backupConfig.Bucket)
+	case err != nil:
+		log.Printf("Failed to restore backup: %v", err)
+	}
+}
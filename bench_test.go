@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// benchRecords is how many callsigns the lookup benchmarks' database holds
+const benchRecords = 50000
+
+// benchCallsign returns the i'th synthetic callsign (K0AAA, K1AAA, ...)
+func benchCallsign(i int) string {
+	return fmt.Sprintf("K%d%c%c%c", i%10, 'A'+i/10%26, 'A'+i/260%26, 'A'+i/6760%26)
+}
+
+// openBenchDB creates a database of benchRecords FCC records and serves it
+// for the rest of the benchmark
+func openBenchDB(b *testing.B) *sql.DB {
+	b.Helper()
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	path := filepath.Join(b.TempDir(), "bench.sqlite")
+	d, err := sql.Open("sqlite3", path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		setDB(nil)
+		d.Close()
+	})
+	ctx := context.Background()
+	if err := schema.Ensure(ctx, d); err != nil {
+		b.Fatal(err)
+	}
+
+	tx, err := d.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	stmt, err := tx.Prepare(`
+		INSERT INTO callsigns (callsign, license_status, radio_service_code, grant_date, expired_date,
+			operator_class, first_name, last_name, street_address, city, state, zip_code,
+			latitude, longitude, grid_square, country, data_source, licensed_since)
+		VALUES (?, 'A', 'HA', '01/05/2020', '01/05/2030', 'E', 'JOHN', 'PUBLIC', '1 MAIN ST', 'AUSTIN', 'TX', '78701',
+			30.27, -97.74, 'EM10dg', 'United States', 'FCC', '2020-01-05')
+	`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < benchRecords; i++ {
+		if _, err := stmt.Exec(benchCallsign(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	stmt.Close()
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+
+	setDB(d)
+	return d
+}
+
+func BenchmarkQueryRecords(b *testing.B) {
+	d := openBenchDB(b)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		records, err := queryRecords(ctx, d, benchCallsign(i%benchRecords), "")
+		if err != nil || len(records) != 1 {
+			b.Fatalf("lookup %s: %d records, %v", benchCallsign(i%benchRecords), len(records), err)
+		}
+	}
+}
+
+func BenchmarkLookupHandler(b *testing.B) {
+	openBenchDB(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchLookup(b, "/v1/"+benchCallsign(i%benchRecords)+"/json/bench")
+	}
+}
+
+func BenchmarkLookupHandlerParallel(b *testing.B) {
+	openBenchDB(b)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			benchLookup(b, "/v1/"+benchCallsign(i%benchRecords)+"/json/bench")
+		}
+	})
+}
+
+func BenchmarkV2Callsign(b *testing.B) {
+	openBenchDB(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchLookup(b, "/v2/callsign/"+benchCallsign(i%benchRecords))
+	}
+}
+
+// benchLookup serves one lookup request, failing unless it is found
+func benchLookup(b *testing.B, path string) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if path[:4] == "/v2/" {
+		handleV2Callsign(w, r)
+	} else {
+		handleCallsignLookup(w, r)
+	}
+	if w.Code != http.StatusOK {
+		b.Fatalf("%s: status %d: %s", path, w.Code, w.Body)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
+)
+
+// bootstrapAttempts is how many times a failed bootstrap download is tried
+const bootstrapAttempts = 3
+
+// BootstrapConfig is a prebuilt database to download when none exists
+// (BOOTSTRAP_DB_URL, BOOTSTRAP_DB_SHA256)
+type BootstrapConfig struct {
+	URL string
+	// SHA256 is the expected hex checksum of the downloaded file; when
+	// empty it is read from URL + ".sha256"
+	SHA256 string
+}
+
+// loadBootstrapConfig reads bootstrap settings from the environment; URL is
+// empty when bootstrapping is off
+func loadBootstrapConfig(getenv func(string) string) (BootstrapConfig, error) {
+	cfg := BootstrapConfig{
+		URL:    getenv("BOOTSTRAP_DB_URL"),
+		SHA256: strings.ToLower(strings.TrimSpace(getenv("BOOTSTRAP_DB_SHA256"))),
+	}
+	if cfg.SHA256 != "" {
+		if b, err := hex.DecodeString(cfg.SHA256); err != nil || len(b) != sha256.Size {
+			return cfg, fmt.Errorf("invalid BOOTSTRAP_DB_SHA256 %q", cfg.SHA256)
+		}
+	}
+	return cfg, nil
+}
+
+// bootstrapMissingDatabase downloads the bootstrap database to dbPath when
+// the file doesn't exist yet, retrying a few times before giving up and
+// leaving the connector to wait for one
+func bootstrapMissingDatabase(ctx context.Context, dbPath string, cfg BootstrapConfig) {
+	if cfg.URL == "" {
+		return
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		err := tracing.Run(ctx, "bootstrap database", func(ctx context.Context) error {
+			return downloadDatabase(ctx, dbPath, cfg)
+		})
+		if err == nil {
+			return
+		}
+		log.Printf("Bootstrap from %s failed (attempt %d of %d): %v", cfg.URL, attempt, bootstrapAttempts, err)
+		if attempt == bootstrapAttempts {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(attempt) * 10 * time.Second):
+		}
+	}
+}
+
+// downloadDatabase downloads cfg.URL to dbPath, checking its checksum and
+// integrity first. URLs ending in .gz are decompressed.
+func downloadDatabase(ctx context.Context, dbPath string, cfg BootstrapConfig) error {
+	want := cfg.SHA256
+	if want == "" {
+		var err error
+		if want, err = fetchChecksum(ctx, cfg.URL+".sha256"); err != nil {
+			return fmt.Errorf("no checksum (set BOOTSTRAP_DB_SHA256): %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download returned %s", resp.Status)
+	}
+
+	// The checksum covers the file as published, before decompression
+	h := sha256.New()
+	var body io.Reader = io.TeeReader(resp.Body, h)
+	if strings.HasSuffix(strings.ToLower(req.URL.Path), ".gz") {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return fmt.Errorf("failed to read download: %w", err)
+		}
+		body = zr
+	}
+
+	// Download beside the database so the rename is atomic
+	tmp := dbPath + ".download"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	n, err := io.Copy(f, body)
+	if err == nil {
+		// Hash anything after the gzip stream too
+		_, err = io.Copy(io.Discard, io.TeeReader(resp.Body, h))
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download database: %w", err)
+	}
+
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("checksum mismatch: got %s, want %s", got, want)
+	}
+	if err := verifySnapshot(ctx, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return err
+	}
+	log.Printf("Bootstrapped %.1f MB database from %s", float64(n)/1024/1024, cfg.URL)
+	return nil
+}
+
+// fetchChecksum reads a sha256sum-style file: a hex digest, optionally
+// followed by a file name
+func fetchChecksum(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	line, err := bufio.NewReader(io.LimitReader(resp.Body, 1024)).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", errors.New("empty checksum file")
+	}
+	sum := strings.ToLower(fields[0])
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid checksum in %s", url)
+	}
+	return sum, nil
+}
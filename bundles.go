@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/bundle"
+)
+
+// servingBundle returns the description of the database being served if it
+// is an offline bundle written by hamqrzdb bundle, or nil
+func servingBundle(ctx context.Context) *bundle.Info {
+	d := getDB()
+	if d == nil || !hasColumn(ctx, d, "bundle", "filter") {
+		return nil
+	}
+	info, err := bundle.Read(ctx, d)
+	if err != nil {
+		log.Printf("Failed to read bundle description: %v", err)
+		return nil
+	}
+	return info
+}
+
+// refuseBundle returns an error if the database is an offline bundle.
+// Bundles hold a few states' licensees, so an update would fill them with
+// the whole country; they are rebuilt from an updated database instead.
+func refuseBundle(ctx context.Context) error {
+	if info := servingBundle(ctx); info != nil {
+		return fmt.Errorf("the database is an offline bundle (%s); build a new bundle from an updated database instead", info.Filter)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/redis"
+)
+
+// defaultCacheTTL is how long a cached lookup is served when CACHE_TTL is
+// unset
+const defaultCacheTTL = 5 * time.Minute
+
+// sharedCacheBackoff is how long requests skip Redis after a call to it
+// fails. Each call may wait out the client's timeout, so during an outage
+// only the first request after each backoff pays for it.
+const sharedCacheBackoff = 10 * time.Second
+
+var (
+	// sharedCache is the Redis server replicas share lookups and rate
+	// limits through (REDIS_URL); nil when each replica keeps its own
+	sharedCache *redis.Client
+	// sharedPrefix starts every key the API writes (REDIS_PREFIX)
+	sharedPrefix string
+	// lookupCacheTTL is how long lookups stay cached (CACHE_TTL); 0 shares
+	// only the rate limits
+	lookupCacheTTL time.Duration
+
+	// cacheErrorLogged is when a Redis error was last logged, so an outage
+	// isn't logged once per request
+	cacheErrorMu     sync.Mutex
+	cacheErrorLogged time.Time
+	// sharedCacheDownUntil is when requests may try Redis again after a
+	// failure, in Unix nanoseconds
+	sharedCacheDownUntil atomic.Int64
+)
+
+// loadSharedCache reads REDIS_URL, REDIS_PREFIX, and CACHE_TTL. Redis is
+// optional: without it every replica caches and rate-limits on its own.
+func loadSharedCache(getenv func(string) string) error {
+	url := getenv("REDIS_URL")
+	if url == "" {
+		return nil
+	}
+	client, err := redis.New(url)
+	if err != nil {
+		return fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	ttl := defaultCacheTTL
+	if v := getenv("CACHE_TTL"); v != "" {
+		if ttl, err = time.ParseDuration(v); err != nil || ttl < 0 {
+			return fmt.Errorf("invalid CACHE_TTL %q", v)
+		}
+	}
+	prefix := getenv("REDIS_PREFIX")
+	if prefix == "" {
+		prefix = "hamqrzdb:"
+	}
+	sharedCache, sharedPrefix, lookupCacheTTL = client, prefix, ttl
+	return nil
+}
+
+// sharedCacheUp reports whether requests should use Redis: it is
+// configured and hasn't failed within sharedCacheBackoff
+func sharedCacheUp() bool {
+	return sharedCache != nil && time.Now().UnixNano() >= sharedCacheDownUntil.Load()
+}
+
+// sharedCacheFailed skips Redis for sharedCacheBackoff and logs the error
+// at most once a minute. Callers fall back to the database or the local
+// rate limiter, so an outage slows the API down but doesn't take it down.
+func sharedCacheFailed(op string, err error) {
+	sharedCacheDownUntil.Store(time.Now().Add(sharedCacheBackoff).UnixNano())
+
+	cacheErrorMu.Lock()
+	defer cacheErrorMu.Unlock()
+	if time.Since(cacheErrorLogged) < time.Minute {
+		return
+	}
+	cacheErrorLogged = time.Now()
+	log.Printf("Redis %s failed, continuing without it: %v", op, err)
+}
+
+// lookupCacheKey returns the key lookups of a callsign are cached under, or
+// "" when lookups aren't cached. The key covers the served database (its
+// last import and record count) and the redaction settings, so replicas
+// serving the same data and settings share entries and a new import or
+// redaction change starts afresh instead of waiting for entries to expire.
+func lookupCacheKey(ctx context.Context, callsign, source string) string {
+	if sharedCache == nil || lookupCacheTTL == 0 {
+		return ""
+	}
+	date, count, ok := databaseFreshness(ctx)
+	if !ok {
+		return ""
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%d|%+v", date, count, cfg().redaction)
+	return fmt.Sprintf("%slookup:%x:%s:%s", sharedPrefix, h.Sum64(), source, strings.ToUpper(callsign))
+}
+
+// cachedQueryRecords is queryRecords answered from the shared cache when
+// it has the callsign, caching what the database returns otherwise
+func cachedQueryRecords(ctx context.Context, d *sql.DB, callsign, source string) ([]SourceRecord, error) {
+	key := lookupCacheKey(ctx, callsign, source)
+	if records, ok := cachedRecords(ctx, key); ok {
+		return records, nil
+	}
+	records, err := queryRecords(ctx, d, callsign, source)
+	if err != nil {
+		return nil, err
+	}
+	cacheRecords(ctx, key, records)
+	return records, nil
+}
+
+// cachedRecords returns the records cached under key, which may be none
+// for a callsign that wasn't found
+func cachedRecords(ctx context.Context, key string) ([]SourceRecord, bool) {
+	if key == "" || !sharedCacheUp() {
+		return nil, false
+	}
+	value, ok, err := sharedCache.Get(ctx, key)
+	if err != nil {
+		sharedCacheFailed("lookup", err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	// gob rather than JSON, since some fields are kept out of the JSON
+	var records []SourceRecord
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&records); err != nil {
+		log.Printf("Discarding unreadable cache entry %s: %v", key, err)
+		return nil, false
+	}
+	return records, true
+}
+
+// cacheRecords caches a lookup's records under key
+func cacheRecords(ctx context.Context, key string, records []SourceRecord) {
+	if key == "" || !sharedCacheUp() {
+		return
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(records); err != nil {
+		log.Printf("Failed to encode cache entry %s: %v", key, err)
+		return
+	}
+	if err := sharedCache.Set(ctx, key, buf.Bytes(), lookupCacheTTL); err != nil {
+		sharedCacheFailed("store", err)
+	}
+}
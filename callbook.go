@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/batch"
+)
+
+// The QRZ.com and HamQTH XML callbook protocols, which loggers such as N1MM
+// Logger+, DXLab, and Log4OM support, so they can look callsigns up on the
+// LAN. Neither checks credentials: every login succeeds and any session key
+// is accepted, since the API itself has no accounts.
+
+// callbookSession is the session key handed to every login
+var callbookSession = func() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}()
+
+// callbookLookups counts bridge lookups, reported as the QRZ session's count
+var callbookLookups atomic.Int64
+
+// callbookQuery parses a callbook request's query. Both protocols separate
+// parameters with & or ;, which url.ParseQuery rejects. Keys are lower case.
+func callbookQuery(r *http.Request) map[string]string {
+	q := map[string]string{}
+	for _, pair := range strings.FieldsFunc(r.URL.RawQuery, func(c rune) bool { return c == '&' || c == ';' }) {
+		k, v, _ := strings.Cut(pair, "=")
+		k, _ = url.QueryUnescape(k)
+		v, _ = url.QueryUnescape(v)
+		q[strings.ToLower(k)] = v
+	}
+	if r.Method == http.MethodPost && r.ParseForm() == nil {
+		for k, v := range r.PostForm {
+			q[strings.ToLower(k)] = v[0]
+		}
+	}
+	return q
+}
+
+// callbookRecord returns a callsign's record with its override applied, as
+// a /v1 lookup would
+func callbookRecord(ctx context.Context, call string) (SourceRecord, bool) {
+	rec, ok := lookupCallsign(ctx, call, "")
+	if !ok {
+		return rec, false
+	}
+	lookupOverride(ctx, rec.Call).apply(&rec.CallsignData)
+	return rec, true
+}
+
+// writeXML writes an XML response
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(v)
+}
+
+// qrzDatabase is a QRZ.com XML (version 1.34) response
+type qrzDatabase struct {
+	XMLName  xml.Name     `xml:"QRZDatabase"`
+	Version  string       `xml:"version,attr"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	Callsign *qrzCallsign `xml:"Callsign,omitempty"`
+	Session  qrzSession   `xml:"Session"`
+}
+
+type qrzCallsign struct {
+	Call     string `xml:"call"`
+	FName    string `xml:"fname,omitempty"`
+	Name     string `xml:"name,omitempty"`
+	Nickname string `xml:"nickname,omitempty"`
+	Addr1    string `xml:"addr1,omitempty"`
+	Addr2    string `xml:"addr2,omitempty"`
+	State    string `xml:"state,omitempty"`
+	Zip      string `xml:"zip,omitempty"`
+	Country  string `xml:"country,omitempty"`
+	Land     string `xml:"land,omitempty"`
+	Lat      string `xml:"lat,omitempty"`
+	Lon      string `xml:"lon,omitempty"`
+	Grid     string `xml:"grid,omitempty"`
+	EfDate   string `xml:"efdate,omitempty"`
+	ExpDate  string `xml:"expdate,omitempty"`
+	Class    string `xml:"class,omitempty"`
+	QSLMgr   string `xml:"qslmgr,omitempty"`
+	Email    string `xml:"email,omitempty"`
+	Src      string `xml:"src"`
+}
+
+type qrzSession struct {
+	Key    string `xml:"Key,omitempty"`
+	Count  int64  `xml:"Count"`
+	SubExp string `xml:"SubExp"`
+	GMTime string `xml:"GMTime"`
+	Error  string `xml:"Error,omitempty"`
+}
+
+// handleQRZXML handles /xml/current/ (and /xml/{version}/): a login with
+// username and password returns a session key, and a request with s= and
+// callsign= returns the callsign's record
+func handleQRZXML(w http.ResponseWriter, r *http.Request) {
+	q := callbookQuery(r)
+	resp := qrzDatabase{
+		Version: "1.34",
+		Xmlns:   "http://xmldata.qrz.com",
+		Session: qrzSession{
+			Key:    callbookSession,
+			Count:  callbookLookups.Load(),
+			SubExp: "non-subscriber",
+			GMTime: time.Now().UTC().Format(time.ANSIC),
+		},
+	}
+
+	call := baseCall(q["callsign"])
+	switch {
+	case q["s"] == "" && q["username"] == "":
+		resp.Session.Key = ""
+		resp.Session.Error = "Username / password required"
+	case call == "":
+		// A login, or a session check without a callsign
+	default:
+		ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+		defer cancel()
+		resp.Session.Count = callbookLookups.Add(1)
+		rec, ok := callbookRecord(ctx, call)
+		if !ok {
+			markNotFound(w)
+			resp.Session.Error = "Not found: " + call
+			break
+		}
+		fname := rec.FName
+		if rec.MI != "" {
+			fname += " " + rec.MI
+		}
+		name := rec.Name
+		if rec.Suffix != "" {
+			name += " " + rec.Suffix
+		}
+		fcc := rec.DataSource == batch.FCC || rec.DataSource == ""
+		resp.Callsign = &qrzCallsign{
+			Call:     rec.Call,
+			FName:    fname,
+			Name:     name,
+			Nickname: rec.PreferredName,
+			Addr1:    rec.Addr1,
+			Addr2:    rec.Addr2,
+			State:    rec.State,
+			Zip:      rec.Zip,
+			Country:  rec.Country,
+			Land:     rec.Country,
+			Lat:      rec.Lat,
+			Lon:      rec.Lon,
+			Grid:     rec.Grid,
+			EfDate:   rec.EffectiveDate,
+			ExpDate:  isoDate(rec.Expires, fcc),
+			Class:    rec.Class,
+			QSLMgr:   rec.QSLManager,
+			Src:      "hamqrzdb",
+		}
+		if club := lookupClub(ctx, rec.Call); club != nil {
+			resp.Callsign.Email = club.Email
+		}
+	}
+	writeXML(w, resp)
+}
+
+// hamQTH is a HamQTH XML (version 2.8) response
+type hamQTH struct {
+	XMLName xml.Name       `xml:"HamQTH"`
+	Version string         `xml:"version,attr"`
+	Xmlns   string         `xml:"xmlns,attr"`
+	Session *hamQTHSession `xml:"session,omitempty"`
+	Search  *hamQTHSearch  `xml:"search,omitempty"`
+}
+
+type hamQTHSession struct {
+	SessionID string `xml:"session_id,omitempty"`
+	Error     string `xml:"error,omitempty"`
+}
+
+type hamQTHSearch struct {
+	Callsign   string `xml:"callsign"`
+	Nick       string `xml:"nick,omitempty"`
+	QTH        string `xml:"qth,omitempty"`
+	Country    string `xml:"country,omitempty"`
+	Grid       string `xml:"grid,omitempty"`
+	AdrName    string `xml:"adr_name,omitempty"`
+	AdrStreet1 string `xml:"adr_street1,omitempty"`
+	AdrCity    string `xml:"adr_city,omitempty"`
+	AdrZip     string `xml:"adr_zip,omitempty"`
+	AdrCountry string `xml:"adr_country,omitempty"`
+	USState    string `xml:"us_state,omitempty"`
+	Latitude   string `xml:"latitude,omitempty"`
+	Longitude  string `xml:"longitude,omitempty"`
+	Email      string `xml:"email,omitempty"`
+	QSLVia     string `xml:"qsl_via,omitempty"`
+}
+
+// handleHamQTHXML handles /xml.php: a login with u= and p= returns a session
+// id, and a request with id= and callsign= returns the callsign's record
+func handleHamQTHXML(w http.ResponseWriter, r *http.Request) {
+	q := callbookQuery(r)
+	resp := hamQTH{Version: "2.8", Xmlns: "https://www.hamqth.com"}
+
+	call := baseCall(q["callsign"])
+	switch {
+	case q["id"] == "" && q["u"] == "":
+		resp.Session = &hamQTHSession{Error: "Wrong user name or password"}
+	case q["id"] == "" || call == "":
+		resp.Session = &hamQTHSession{SessionID: callbookSession}
+	default:
+		ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+		defer cancel()
+		callbookLookups.Add(1)
+		rec, ok := callbookRecord(ctx, call)
+		if !ok {
+			markNotFound(w)
+			resp.Session = &hamQTHSession{Error: "Callsign not found"}
+			break
+		}
+		nick := rec.PreferredName
+		if nick == "" {
+			nick = rec.FName
+		}
+		resp.Search = &hamQTHSearch{
+			Callsign:   strings.ToLower(rec.Call),
+			Nick:       nick,
+			QTH:        rec.Addr2,
+			Country:    rec.Country,
+			Grid:       rec.Grid,
+			AdrName:    strings.Join(strings.Fields(strings.Join([]string{rec.FName, rec.MI, rec.Name, rec.Suffix}, " ")), " "),
+			AdrStreet1: rec.Addr1,
+			AdrCity:    rec.Addr2,
+			AdrZip:     rec.Zip,
+			AdrCountry: rec.Country,
+			Latitude:   rec.Lat,
+			Longitude:  rec.Lon,
+			QSLVia:     rec.QSLManager,
+		}
+		if rec.Country == "United States" {
+			resp.Search.USState = rec.State
+		}
+		if club := lookupClub(ctx, rec.Call); club != nil {
+			resp.Search.Email = club.Email
+		}
+	}
+	writeXML(w, resp)
+}
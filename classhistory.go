@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+// ClassChange is one step of an operator's class timeline
+type ClassChange struct {
+	Class string `json:"class"`
+	// Since is when the class took effect (YYYY-MM-DD): the licensed_since
+	// date for the first class, and the date the update carrying the change
+	// was imported for later ones
+	Since string `json:"since,omitempty"`
+}
+
+// lookupClassHistory returns the operator class timeline of a record from
+// callsign_history, oldest first (?verbose=1). A record without recorded
+// changes has a single entry for its current class; records without a class
+// have none.
+func lookupClassHistory(ctx context.Context, rec SourceRecord) []ClassChange {
+	if rec.Class == "" {
+		return nil
+	}
+	timeline := []ClassChange{{Class: rec.Class, Since: rec.LicensedSince}}
+
+	d := getDB()
+	if d == nil || !hasColumn(ctx, d, "callsign_history", "field") {
+		return timeline
+	}
+	// Changes recorded under a previous license of a reissued callsign
+	// aren't this record's
+	license := ""
+	if hasColumn(ctx, d, "callsign_history", "unique_system_identifier") {
+		license = `AND (h.unique_system_identifier IS NULL OR h.unique_system_identifier IS
+			(SELECT unique_system_identifier FROM callsigns c WHERE c.callsign = h.callsign AND c.data_source = h.data_source))`
+	}
+	rows, err := d.QueryContext(ctx, `
+		SELECT old_value, COALESCE(new_value, ''), date(changed_at)
+		FROM callsign_history h
+		WHERE callsign = ? AND data_source = ? AND field = 'operator_class' `+license+`
+		ORDER BY changed_at, id
+	`, rec.Call, rec.DataSource)
+	if err != nil {
+		log.Printf("Database error looking up class history for %s: %v", rec.Call, err)
+		return timeline
+	}
+	defer rows.Close()
+
+	var changes []ClassChange
+	for rows.Next() {
+		var from, to, changed string
+		if err := rows.Scan(&from, &to, &changed); err != nil {
+			log.Printf("Database error looking up class history for %s: %v", rec.Call, err)
+			return timeline
+		}
+		if len(changes) == 0 {
+			// licensed_since postdates the history after a vanity call change
+			first := ClassChange{Class: from, Since: rec.LicensedSince}
+			if first.Since > changed {
+				first.Since = ""
+			}
+			changes = append(changes, first)
+		}
+		// A change back and forth within one import leaves no visible step
+		if to == changes[len(changes)-1].Class {
+			continue
+		}
+		changes = append(changes, ClassChange{Class: to, Since: changed})
+	}
+	if err := rows.Err(); err != nil || len(changes) == 0 {
+		return timeline
+	}
+	return changes
+}
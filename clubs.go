@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ClubInfo is the operator-maintained directory entry of a club station,
+// filling in what the FCC's bare-bones club records leave out
+type ClubInfo struct {
+	// Name is the club's own name, when it differs from the licence's
+	Name     string `json:"name,omitempty"`
+	Website  string `json:"website,omitempty"`
+	Meeting  string `json:"meeting,omitempty"`
+	Repeater string `json:"repeater,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Notes    string `json:"notes,omitempty"`
+}
+
+// isEmpty reports whether the entry has no values
+func (c ClubInfo) isEmpty() bool {
+	return c == ClubInfo{}
+}
+
+// clubUpload is one row of a POST /admin/clubs upload
+type clubUpload struct {
+	Callsign string `json:"callsign"`
+	ClubInfo
+}
+
+// clubColumns maps CSV header names (lower case) to clubUpload fields
+var clubColumns = map[string]string{
+	"callsign": "callsign", "call": "callsign", "club call": "callsign",
+	"name": "name", "club": "name", "club name": "name",
+	"website": "website", "url": "website", "web": "website",
+	"meeting": "meeting", "meetings": "meeting", "meeting time": "meeting", "meeting info": "meeting",
+	"repeater": "repeater", "repeaters": "repeater",
+	"email": "email", "e-mail": "email", "contact": "email",
+	"notes": "notes", "note": "notes",
+}
+
+// handleAdminClubs handles POST /admin/clubs: a CSV or JSON upload of club
+// directory entries, upserted in one transaction like overrides. A row with
+// only a callsign removes the club's entry, and ?replace=1 replaces all
+// stored entries with the upload. Nothing is stored if any row is invalid.
+func handleAdminClubs(dbPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeAdminJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+
+		clubs, err := readUpload(http.MaxBytesReader(w, r.Body, maxOverridesBody), r.Header.Get("Content-Type"),
+			"clubs", clubColumns, func(field func(string) string) clubUpload {
+				return clubUpload{
+					Callsign: field("callsign"),
+					ClubInfo: ClubInfo{
+						Name:     field("name"),
+						Website:  field("website"),
+						Meeting:  field("meeting"),
+						Repeater: field("repeater"),
+						Email:    field("email"),
+						Notes:    field("notes"),
+					},
+				}
+			})
+		if err != nil {
+			writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if errs := validateClubs(clubs); len(errs) > 0 {
+			writeAdminJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error":  "invalid clubs",
+				"errors": errs,
+			})
+			return
+		}
+		replace, _ := strconv.ParseBool(r.URL.Query().Get("replace"))
+
+		stored, removed, err := storeClubs(r.Context(), dbPath, clubs, replace)
+		if err != nil {
+			log.Printf("Failed to store clubs: %v", err)
+			writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to store clubs"})
+			return
+		}
+		log.Printf("Stored %d clubs, removed %d", stored, removed)
+		writeAdminJSON(w, http.StatusOK, map[string]int{"stored": stored, "removed": removed})
+	}
+}
+
+// validateClubs normalizes club entries in place and returns a message for
+// each invalid one
+func validateClubs(clubs []clubUpload) []string {
+	var errs []string
+	if len(clubs) == 0 {
+		return []string{"no clubs in upload"}
+	}
+	for i := range clubs {
+		c := &clubs[i]
+		c.Callsign = baseCall(c.Callsign)
+		c.Name = strings.TrimSpace(c.Name)
+		c.Website = strings.TrimSpace(c.Website)
+		c.Meeting = strings.TrimSpace(c.Meeting)
+		c.Repeater = strings.TrimSpace(c.Repeater)
+		c.Email = strings.TrimSpace(c.Email)
+		c.Notes = strings.TrimSpace(c.Notes)
+
+		if c.Callsign == "" {
+			errs = append(errs, fmt.Sprintf("row %d: callsign is required", i+1))
+			continue
+		}
+		if c.Website != "" {
+			if u, err := url.Parse(c.Website); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fmt.Sprintf("row %d (%s): website must be an http:// or https:// URL", i+1, c.Callsign))
+			}
+		}
+		if c.Email != "" && !strings.Contains(c.Email, "@") {
+			errs = append(errs, fmt.Sprintf("row %d (%s): email must be an email address", i+1, c.Callsign))
+		}
+	}
+	return errs
+}
+
+// storeClubs writes club entries through a short-lived writable connection,
+// returning how many were stored and removed
+func storeClubs(ctx context.Context, dbPath string, clubs []clubUpload, replace bool) (stored, removed int, err error) {
+	rw, err := openWritableDB(ctx, dbPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rw.Close()
+
+	tx, err := rw.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		res, err := tx.ExecContext(ctx, "DELETE FROM clubs")
+		if err != nil {
+			return 0, 0, err
+		}
+		n, _ := res.RowsAffected()
+		removed = int(n)
+	}
+
+	for _, c := range clubs {
+		if c.isEmpty() {
+			res, err := tx.ExecContext(ctx, "DELETE FROM clubs WHERE callsign = ?", c.Callsign)
+			if err != nil {
+				return 0, 0, err
+			}
+			n, _ := res.RowsAffected()
+			removed += int(n)
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO clubs (callsign, name, website, meeting, repeater, email, notes, last_updated)
+			VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(callsign) DO UPDATE SET
+				name = excluded.name,
+				website = excluded.website,
+				meeting = excluded.meeting,
+				repeater = excluded.repeater,
+				email = excluded.email,
+				notes = excluded.notes,
+				last_updated = CURRENT_TIMESTAMP
+		`, c.Callsign, c.Name, c.Website, c.Meeting, c.Repeater, c.Email, c.Notes)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to store club %s: %w", c.Callsign, err)
+		}
+		stored++
+	}
+
+	return stored, removed, tx.Commit()
+}
+
+// lookupClub returns a callsign's club directory entry, or nil if it has none
+func lookupClub(ctx context.Context, callsign string) *ClubInfo {
+	d := getDB()
+	if d == nil {
+		return nil
+	}
+
+	var c ClubInfo
+	err := d.QueryRowContext(ctx, `
+		SELECT COALESCE(name, ''), COALESCE(website, ''), COALESCE(meeting, ''), COALESCE(repeater, ''),
+			COALESCE(email, ''), COALESCE(notes, '')
+		FROM clubs
+		WHERE callsign = ?
+	`, callsign).Scan(&c.Name, &c.Website, &c.Meeting, &c.Repeater, &c.Email, &c.Notes)
+	if err != nil {
+		// Databases that never received club entries have no clubs table
+		if err != sql.ErrNoRows && !strings.Contains(err.Error(), "no such table") {
+			log.Printf("Database error looking up club for %s: %v", callsign, err)
+		}
+		return nil
+	}
+	return &c
+}
+
+// Club is the response of /v1/clubs/{callsign}: the club station's licence
+// merged with its directory entry
+type Club struct {
+	Callsign string `json:"callsign"`
+	// Name is the directory entry's name, or else the licensee name
+	Name    string `json:"name,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Expires string `json:"expires,omitempty"`
+	City    string `json:"city,omitempty"`
+	State   string `json:"state,omitempty"`
+	Grid    string `json:"grid,omitempty"`
+	// Licensed reports whether the database has a licence for the callsign;
+	// a directory entry alone is still returned
+	Licensed bool   `json:"licensed"`
+	Website  string `json:"website,omitempty"`
+	Meeting  string `json:"meeting,omitempty"`
+	Repeater string `json:"repeater,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Notes    string `json:"notes,omitempty"`
+}
+
+// handleClub handles /v1/clubs/{callsign}: a club station's licence with its
+// website, meeting, and repeater details from the club directory
+func handleClub(w http.ResponseWriter, r *http.Request) {
+	prefix, escaped, _ := strings.Cut(r.URL.EscapedPath(), "/clubs/")
+	raw, _ := url.PathUnescape(escaped)
+	call := baseCall(raw)
+	if call == "" {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidCallsign,
+			"a callsign is required, e.g. "+prefix+"/clubs/W1AW", raw)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	if getDB() == nil {
+		writeError(w, r, http.StatusServiceUnavailable, codeDBUnavailable, "database not connected")
+		return
+	}
+
+	club := Club{Callsign: call}
+	rec, licensed := lookupCallsign(ctx, call, "")
+	if licensed {
+		club.Licensed = true
+		club.Name = strings.Join(strings.Fields(rec.FName+" "+rec.Name), " ")
+		club.Status = rec.Status
+		club.Expires = rec.Expires
+		club.City = rec.Addr2
+		club.State = rec.State
+		club.Grid = rec.Grid
+	}
+	info := lookupClub(ctx, call)
+	if info == nil && !licensed {
+		writeErrorDetail(w, r, http.StatusNotFound, codeNotFound, "no licence or club directory entry for "+call, call)
+		return
+	}
+	if info != nil {
+		if info.Name != "" {
+			club.Name = info.Name
+		}
+		club.Website = info.Website
+		club.Meeting = info.Meeting
+		club.Repeater = info.Repeater
+		club.Email = info.Email
+		club.Notes = info.Notes
+	}
+	writeJSON(w, r, http.StatusOK, club)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/backup"
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
+)
+
+// Cluster roles (ROLE). A standalone instance imports into and serves its
+// own database; in a cluster one coordinator imports and publishes
+// snapshots to the backup bucket, and workers only download and serve them.
+const (
+	roleStandalone  = ""
+	roleCoordinator = "coordinator"
+	roleWorker      = "worker"
+)
+
+const (
+	// leaderTTL is how long the leader lock outlives a coordinator that
+	// stops renewing it
+	leaderTTL = 30 * time.Second
+	// leaderRenew is how often the lock is renewed, or taken when free
+	leaderRenew = 10 * time.Second
+)
+
+// errNotLeader is returned by jobs that write the database or publish
+// snapshots on an instance that isn't the one that imports
+var errNotLeader = errors.New("this instance doesn't import: only the coordinator holding the leader lock does")
+
+// ClusterConfig configures horizontal scaling (ROLE, UPDATE_INTERVAL,
+// SNAPSHOT_POLL_INTERVAL)
+type ClusterConfig struct {
+	Role string
+	// UpdateInterval runs the daily update on a schedule; 0 leaves updates
+	// to the admin API and SIGUSR1
+	UpdateInterval time.Duration
+	// PollInterval is how often instances that don't import check the
+	// bucket for a new snapshot
+	PollInterval time.Duration
+}
+
+var (
+	// cluster is the instance's cluster configuration
+	cluster ClusterConfig
+	// leading is set while a coordinator holds the leader lock
+	leading atomic.Bool
+)
+
+// loadClusterConfig reads the cluster settings from the environment.
+// Coordinators and workers exchange snapshots through BACKUP_S3_URL, so it
+// must be loaded first.
+func loadClusterConfig(getenv func(string) string) (ClusterConfig, error) {
+	c := ClusterConfig{
+		Role:         strings.ToLower(strings.TrimSpace(getenv("ROLE"))),
+		PollInterval: time.Minute,
+	}
+	switch c.Role {
+	case roleStandalone, "standalone":
+		c.Role = roleStandalone
+	case roleCoordinator, roleWorker:
+		if !backupConfig.Enabled() {
+			return c, fmt.Errorf("ROLE=%s requires BACKUP_S3_URL, where snapshots are published", c.Role)
+		}
+	default:
+		return c, fmt.Errorf("invalid ROLE %q (expected standalone, coordinator, or worker)", c.Role)
+	}
+	for _, d := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"UPDATE_INTERVAL", &c.UpdateInterval},
+		{"SNAPSHOT_POLL_INTERVAL", &c.PollInterval},
+	} {
+		if v := getenv(d.name); v != "" {
+			interval, err := time.ParseDuration(v)
+			if err != nil || interval <= 0 {
+				return c, fmt.Errorf("invalid %s %q", d.name, v)
+			}
+			*d.dst = interval
+		}
+	}
+	if c.Role == roleWorker && c.UpdateInterval > 0 {
+		return c, errors.New("UPDATE_INTERVAL can't be used with ROLE=worker; the coordinator runs updates")
+	}
+	return c, nil
+}
+
+// isLeader reports whether this instance imports: always when standalone,
+// while holding the leader lock as a coordinator, and never as a worker
+func isLeader() bool {
+	switch cluster.Role {
+	case roleStandalone:
+		return true
+	case roleCoordinator:
+		return leading.Load()
+	}
+	return false
+}
+
+// leaderOnly wraps a job that writes the database so it fails on instances
+// that don't import, whose next snapshot would undo it
+func leaderOnly(fn func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if !isLeader() {
+			return errNotLeader
+		}
+		return fn(ctx)
+	}
+}
+
+// startLeaderElection keeps trying to take the coordinators' leader lock
+// in Redis and renews it while held. Without REDIS_URL there is no lock,
+// and this coordinator assumes it's the only one.
+func startLeaderElection(ctx context.Context) {
+	if sharedCache == nil {
+		log.Println("No REDIS_URL for a leader lock; run only one coordinator")
+		leading.Store(true)
+		return
+	}
+
+	host, _ := os.Hostname()
+	nonce := make([]byte, 4)
+	_, _ = rand.Read(nonce)
+	id := fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(nonce))
+	key := sharedPrefix + "leader"
+	ttl := strconv.FormatInt(leaderTTL.Milliseconds(), 10)
+
+	go func() {
+		ticker := time.NewTicker(leaderRenew)
+		defer ticker.Stop()
+		var renewed time.Time
+		for {
+			if leading.Load() {
+				reply, err := sharedCache.Eval(ctx, renewLeaderScript, []string{key}, id, ttl)
+				switch n, _ := reply.(int64); {
+				case err == nil && n == 1:
+					renewed = time.Now()
+				case err == nil:
+					leading.Store(false)
+					log.Println("Lost the leader lock; another coordinator imports now")
+				case time.Since(renewed) > leaderTTL:
+					// The lock has expired by now, so another may hold it
+					leading.Store(false)
+					log.Printf("Stepping down as leader, the lock can't be renewed: %v", err)
+				}
+			} else {
+				reply, err := sharedCache.Do(ctx, "SET", key, id, "NX", "PX", ttl)
+				if err != nil {
+					sharedCacheFailed("leader lock", err)
+				} else if reply == "OK" {
+					renewed = time.Now()
+					leading.Store(true)
+					log.Printf("Took the leader lock as %s; this coordinator imports and publishes snapshots", id)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				if leading.Load() {
+					// Let another coordinator take over without waiting out the TTL
+					releaseCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+					_, _ = sharedCache.Eval(releaseCtx, releaseLeaderScript, []string{key}, id)
+					cancel()
+					leading.Store(false)
+				}
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// renewLeaderScript and releaseLeaderScript change the lock only if this
+// coordinator still holds it
+const (
+	renewLeaderScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`
+	releaseLeaderScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+)
+
+// pullSnapshot replaces the database at dbPath with the latest published
+// snapshot if it changed since the last pull, reporting whether it did.
+// The snapshot's ETag is kept in <dbPath>.etag, as followers do.
+func pullSnapshot(ctx context.Context, dbPath string) (bool, error) {
+	etagPath := dbPath + ".etag"
+	etag := ""
+	if _, err := os.Stat(dbPath); err == nil {
+		if b, err := os.ReadFile(etagPath); err == nil {
+			etag = strings.TrimSpace(string(b))
+		}
+	}
+
+	newTag, err := backup.Fetch(ctx, backupConfig, dbPath, etag)
+	if errors.Is(err, backup.ErrNotModified) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if newTag != "" {
+		_ = os.WriteFile(etagPath, []byte(newTag+"\n"), 0o644)
+	}
+	return true, nil
+}
+
+// startSnapshotPuller pulls new snapshots every interval while this
+// instance isn't the one that imports them
+func startSnapshotPuller(ctx context.Context, dbPath string, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if isLeader() {
+				continue
+			}
+			err := tracing.Run(ctx, "pull snapshot", func(ctx context.Context) error {
+				changed, err := pullSnapshot(ctx, dbPath)
+				if err != nil || !changed {
+					return err
+				}
+				return reopenDB(ctx, dbPath)
+			})
+			if err != nil && !errors.Is(err, backup.ErrNoBackup) {
+				log.Printf("Snapshot pull failed: %v", err)
+			}
+		}
+	}()
+}
+
+// startUpdateSchedule runs update every interval on the instance that
+// imports; the others skip it quietly
+func startUpdateSchedule(ctx context.Context, interval time.Duration, update func(context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if !isLeader() {
+				continue
+			}
+			if _, started := startJob(ctx, "update-daily", update); !started {
+				log.Println("Skipping scheduled update-daily: another job is running")
+			}
+		}
+	}()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/aprs"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/redact"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// runExportAPRS implements `hamqrzdb export-aprs`
+func runExportAPRS(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export-aprs", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	fromFlag := fs.String("from", "", "Callsign (with SSID) sending the objects; required")
+	callsFlag := fs.String("callsigns", "", "Comma-separated callsigns to export")
+	fileFlag := fs.String("file", "", "File of callsigns to export, separated by commas or whitespace")
+	stateFlag := fs.String("state", "", "Export the licensees in this state or region")
+	gridFlag := fs.String("grid", "", "Export the licensees in grid squares with this prefix, e.g. EM10")
+	limitFlag := fs.Int("limit", 1000, "Maximum objects")
+	symbolFlag := fs.String("symbol", aprs.DefaultSymbol, "Symbol table and code, e.g. /- (house) or /r (antenna)")
+	killFlag := fs.Bool("kill", false, "Export kill reports, removing previously sent objects")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb export-aprs -from CALL [-callsigns LIST] [-file FILE] [-state ST] [-grid PREFIX] [flags]")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	from := strings.ToUpper(strings.TrimSpace(*fromFlag))
+	if from == "" {
+		fs.Usage()
+		return fmt.Errorf("-from is required")
+	}
+	if len(*symbolFlag) != 2 {
+		return fmt.Errorf("-symbol must be a table identifier and a symbol code, e.g. /-")
+	}
+
+	calls := strings.FieldsFunc(strings.ToUpper(*callsFlag), isCallSeparator)
+	if *fileFlag != "" {
+		data, err := os.ReadFile(*fileFlag)
+		if err != nil {
+			return err
+		}
+		calls = append(calls, strings.FieldsFunc(strings.ToUpper(string(data)), isCallSeparator)...)
+	}
+	state := strings.ToUpper(strings.TrimSpace(*stateFlag))
+	grid := strings.ToUpper(strings.TrimSpace(*gridFlag))
+	// Without a selection this would be every licensee
+	if len(calls) == 0 && state == "" && grid == "" {
+		fs.Usage()
+		return fmt.Errorf("select callsigns with -callsigns, -file, -state, or -grid")
+	}
+
+	if _, err := os.Stat(*dbFlag); err != nil {
+		return fmt.Errorf("database not found: %w", err)
+	}
+	db, err := sql.Open("sqlite3", *dbFlag+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	objects, err := aprsObjects(ctx, db, redact.LoadConfig(os.Getenv), calls, state, grid, *limitFlag)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, o := range objects {
+		o.Symbol = *symbolFlag
+		o.Killed = *killFlag
+		fmt.Println(o.Packet(from, now))
+	}
+	fmt.Fprintf(os.Stderr, "%d objects\n", len(objects))
+	return nil
+}
+
+// isCallSeparator splits callsign lists on commas and whitespace
+func isCallSeparator(r rune) bool {
+	return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
+
+// aprsObjects returns an object for each active licensee with coordinates
+// among calls (when given), in state and grid squares with the grid prefix
+// (when given). Callsigns licensed by several sources are placed by the
+// first one. Licensees whose addresses are in redaction's scope have no
+// coordinates and are left out, and names in its scope are left out of the
+// comment, as in API lookups.
+func aprsObjects(ctx context.Context, db *sql.DB, redaction redact.Config, calls []string, state, grid string, limit int) ([]aprs.Object, error) {
+	hasCountry, err := schema.HasColumn(ctx, db, "callsigns", "country")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the schema: %w", err)
+	}
+	country := schema.CountryExpr(hasCountry)
+	address, name := redaction.Addresses.Column, redaction.Names.Column
+	latCol, lonCol := address("latitude", country), address("longitude", country)
+
+	where := []string{"license_status = 'A'", latCol + " IS NOT NULL", lonCol + " IS NOT NULL",
+		"NOT (latitude = 0 AND longitude = 0)"}
+	var args []interface{}
+	if len(calls) > 0 {
+		where = append(where, "callsign IN (?"+strings.Repeat(", ?", len(calls)-1)+")")
+		for _, call := range calls {
+			args = append(args, call)
+		}
+	}
+	if state != "" {
+		where = append(where, "UPPER(state) = ?")
+		args = append(args, state)
+	}
+	if grid != "" {
+		where = append(where, "UPPER(grid_square) LIKE ? || '%'")
+		args = append(args, grid)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT callsign, COALESCE(`+name("first_name", country)+`, ''), COALESCE(`+name("last_name", country)+`, ''),
+			COALESCE(entity_name, ''), COALESCE(city, ''), COALESCE(state, ''), `+latCol+`, `+lonCol+`
+		FROM callsigns
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY callsign, data_source
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("callsign query failed: %w", err)
+	}
+	defer rows.Close()
+
+	objects := []aprs.Object{}
+	var last string
+	for rows.Next() && len(objects) < limit {
+		var call, first, name, entity, city, st string
+		var lat, lon float64
+		if err := rows.Scan(&call, &first, &name, &entity, &city, &st, &lat, &lon); err != nil {
+			return nil, err
+		}
+		if call == last {
+			continue
+		}
+		last = call
+
+		label := fullName(first, name)
+		if label == "" {
+			label = entity
+		}
+		switch place := strings.TrimSpace(city + " " + st); {
+		case label == "":
+			label = place
+		case place != "":
+			label += ", " + place
+		}
+		objects = append(objects, aprs.Object{Name: call, Lat: lat, Lon: lon, Comment: label})
+	}
+	return objects, rows.Err()
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/httpclient"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/redact"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// auditFields are the fields compared, with the HamDB names plus fullname,
+// in report order. A reference that doesn't return a field isn't compared
+// on it.
+var auditFields = []string{
+	"class", "status", "expires", "fullname", "fname", "mi", "name", "suffix",
+	"addr1", "addr2", "state", "zip", "grid", "lat", "lon",
+}
+
+// auditReference is an API to check records against
+type auditReference struct {
+	// URL is the lookup URL, with {call} replaced by the callsign
+	URL string
+	// parse returns a response's fields by auditFields name, or found
+	// false if the reference has no record
+	parse func(body []byte) (fields map[string]string, found bool, err error)
+}
+
+var auditReferences = map[string]auditReference{
+	"hamdb":   {URL: "https://api.hamdb.org/v1/{call}/json/hamqrzdb-audit", parse: parseHamDBAudit},
+	"callook": {URL: "https://callook.info/{call}/json", parse: parseCallookAudit},
+}
+
+// auditFieldStats counts one field's comparisons
+type auditFieldStats struct {
+	Compared   int            `json:"compared"`
+	Mismatched int            `json:"mismatched"`
+	Examples   []auditExample `json:"examples,omitempty"`
+}
+
+// auditExample is one mismatch
+type auditExample struct {
+	Call      string `json:"call"`
+	Local     string `json:"local"`
+	Reference string `json:"reference"`
+}
+
+// auditResult summarizes an audit
+type auditResult struct {
+	Against  string `json:"against"`
+	Sampled  int    `json:"sampled"`
+	Found    int    `json:"found"`
+	NotFound int    `json:"not_found"`
+	Errors   int    `json:"errors"`
+	// Missing lists sampled callsigns the reference has no record for
+	Missing []string                    `json:"missing,omitempty"`
+	Fields  map[string]*auditFieldStats `json:"fields"`
+}
+
+// runAudit implements `hamqrzdb audit`: look up a random sample of active
+// FCC licences in a reference API and count the fields that disagree, to
+// catch parser mistakes after a ULS format change
+func runAudit(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	sampleFlag := fs.Int("sample", 1000, "Number of active FCC licences to check")
+	againstFlag := fs.String("against", "hamdb", "Reference API (hamdb or callook)")
+	urlFlag := fs.String("url", "", "Reference lookup URL with {call} for the callsign (defaults to the public API)")
+	rateFlag := fs.Float64("rate", 2, "Reference requests per second")
+	examplesFlag := fs.Int("examples", 3, "Mismatches to show per field")
+	maxMismatchFlag := fs.Float64("max-mismatch", 0, "Fail if any field's mismatch rate exceeds this fraction (0 to never fail)")
+	proxyFlag := fs.String("proxy", "", "Proxy for requests (http://, socks5://); defaults to HTTP_PROXY/HTTPS_PROXY")
+	jsonFlag := fs.Bool("json", false, "Print the result as JSON")
+	fs.Parse(args)
+
+	ref, ok := auditReferences[strings.ToLower(*againstFlag)]
+	if !ok {
+		return fmt.Errorf("unknown -against %q (expected hamdb or callook)", *againstFlag)
+	}
+	if *urlFlag != "" {
+		if !strings.Contains(*urlFlag, "{call}") {
+			return errors.New("-url must contain {call}")
+		}
+		ref.URL = *urlFlag
+	}
+	if *sampleFlag <= 0 || *rateFlag <= 0 {
+		return errors.New("-sample and -rate must be positive")
+	}
+
+	if _, err := os.Stat(*dbFlag); err != nil {
+		return fmt.Errorf("database not found: %w", err)
+	}
+	db, err := sql.Open("sqlite3", *dbFlag+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	records, err := auditSample(ctx, db, redact.LoadConfig(os.Getenv), *sampleFlag)
+	if err != nil {
+		return err
+	}
+	client, err := httpclient.New(*proxyFlag)
+	if err != nil {
+		return err
+	}
+	client.Timeout = 15 * time.Second
+
+	res := auditResult{Against: strings.ToLower(*againstFlag), Sampled: len(records), Fields: map[string]*auditFieldStats{}}
+	log.Printf("Checking %d callsigns against %s", len(records), res.Against)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / *rateFlag))
+	defer ticker.Stop()
+	failures := 0
+	for i, local := range records {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+		call := local["call"]
+		remote, found, err := auditFetch(ctx, client, ref, call)
+		if err != nil {
+			res.Errors++
+			failures++
+			log.Printf("%s: %v", call, err)
+			// A reference that keeps failing is down or refusing us
+			if failures >= 10 {
+				return fmt.Errorf("stopped after %d failed requests in a row", failures)
+			}
+			continue
+		}
+		failures = 0
+		if !found {
+			res.NotFound++
+			res.Missing = append(res.Missing, call)
+			continue
+		}
+		res.Found++
+		for _, field := range auditFields {
+			// Fields redaction withholds aren't in the sample
+			mine, ok := local[field]
+			if !ok {
+				continue
+			}
+			theirs, ok := remote[field]
+			if !ok {
+				continue
+			}
+			stats := res.Fields[field]
+			if stats == nil {
+				stats = &auditFieldStats{}
+				res.Fields[field] = stats
+			}
+			stats.Compared++
+			if !auditEqual(field, mine, theirs) {
+				stats.Mismatched++
+				if len(stats.Examples) < *examplesFlag {
+					stats.Examples = append(stats.Examples, auditExample{Call: call, Local: mine, Reference: theirs})
+				}
+			}
+		}
+		if (i+1)%100 == 0 {
+			log.Printf("Checked %d of %d", i+1, len(records))
+		}
+	}
+
+	if *jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	} else {
+		printAudit(res)
+	}
+
+	if *maxMismatchFlag > 0 {
+		for _, field := range auditFields {
+			s := res.Fields[field]
+			if s != nil && s.Compared > 0 && float64(s.Mismatched)/float64(s.Compared) > *maxMismatchFlag {
+				return fmt.Errorf("%s differs in %d of %d records", field, s.Mismatched, s.Compared)
+			}
+		}
+	}
+	return nil
+}
+
+// auditSample returns up to n random active FCC licences as HamDB-named
+// fields. Expiry dates are ISO, and the full name is the entity name for
+// clubs. Names and addresses in redaction's scope are left out, so they
+// aren't compared or shown.
+func auditSample(ctx context.Context, db *sql.DB, redaction redact.Config, n int) ([]map[string]string, error) {
+	hasCountry, err := schema.HasColumn(ctx, db, "callsigns", "country")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the schema: %w", err)
+	}
+	country := schema.CountryExpr(hasCountry)
+	address, name := redaction.Addresses.Column, redaction.Names.Column
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT callsign, COALESCE(operator_class, ''), COALESCE(license_status, ''),
+			COALESCE(expired_date_iso, expired_date, ''), COALESCE(`+name("first_name", country)+`, ''),
+			COALESCE(`+name("mi", country)+`, ''), COALESCE(`+name("last_name", country)+`, ''),
+			COALESCE(`+name("suffix", country)+`, ''), COALESCE(entity_name, ''),
+			COALESCE(`+address("street_address", country)+`, ''), COALESCE(city, ''), COALESCE(state, ''),
+			COALESCE(zip_code, ''), COALESCE(grid_square, ''),
+			`+address("latitude", country)+`, `+address("longitude", country)+`, COALESCE(`+country+`, '')
+		FROM callsigns
+		WHERE data_source = 'FCC' AND license_status = 'A'
+		ORDER BY random()
+		LIMIT ?
+	`, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample callsigns: %w", err)
+	}
+	defer rows.Close()
+
+	var records []map[string]string
+	for rows.Next() {
+		var call, class, status, expires, first, mi, last, suffix, entity, street, city, state, zip, grid, ctry string
+		var lat, lon sql.NullFloat64
+		if err := rows.Scan(&call, &class, &status, &expires, &first, &mi, &last, &suffix, &entity,
+			&street, &city, &state, &zip, &grid, &lat, &lon, &ctry); err != nil {
+			return nil, err
+		}
+		rec := map[string]string{
+			"call": call, "class": class, "status": status, "expires": expires,
+			"fname": first, "mi": mi, "name": last, "suffix": suffix,
+			"addr1": street, "addr2": city, "state": state, "zip": zip, "grid": grid,
+			"lat": "", "lon": "",
+		}
+		rec["fullname"] = joinNonEmpty(" ", first, mi, last, suffix)
+		if rec["fullname"] == "" {
+			rec["fullname"] = entity
+		}
+		if lat.Valid && lon.Valid {
+			rec["lat"] = strconv.FormatFloat(lat.Float64, 'f', -1, 64)
+			rec["lon"] = strconv.FormatFloat(lon.Float64, 'f', -1, 64)
+		}
+		if redaction.Names.Covers(ctry) {
+			delete(rec, "fname")
+			delete(rec, "mi")
+			delete(rec, "name")
+			delete(rec, "suffix")
+			if entity == "" {
+				delete(rec, "fullname")
+			}
+		}
+		if redaction.Addresses.Covers(ctry) {
+			delete(rec, "addr1")
+			delete(rec, "lat")
+			delete(rec, "lon")
+		}
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("database has no active FCC licences to sample")
+	}
+	return records, nil
+}
+
+// auditFetch looks up a callsign in the reference
+func auditFetch(ctx context.Context, client *http.Client, ref auditReference, call string) (map[string]string, bool, error) {
+	u := strings.ReplaceAll(ref.URL, "{call}", url.PathEscape(call))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("reference returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, false, err
+	}
+	return ref.parse(body)
+}
+
+// parseHamDBAudit reads a HamDB JSON lookup, which is also what this API
+// serves, so one instance can be audited against another
+func parseHamDBAudit(body []byte) (map[string]string, bool, error) {
+	var doc struct {
+		HamDB struct {
+			Callsign map[string]string `json:"callsign"`
+		} `json:"hamdb"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, false, fmt.Errorf("invalid HamDB response: %w", err)
+	}
+	c := doc.HamDB.Callsign
+	if c == nil || c["call"] == "" || c["call"] == "NOT_FOUND" {
+		return nil, false, nil
+	}
+	fields := map[string]string{}
+	for _, f := range []string{"class", "status", "expires", "fname", "mi", "name", "suffix", "addr1", "addr2", "state", "zip", "grid", "lat", "lon"} {
+		fields[f] = c[f]
+	}
+	return fields, true, nil
+}
+
+// callookClasses maps Callook's operator classes to FCC codes
+var callookClasses = map[string]string{
+	"NOVICE":          "N",
+	"TECHNICIAN":      "T",
+	"TECHNICIAN PLUS": "P",
+	"GENERAL":         "G",
+	"ADVANCED":        "A",
+	"EXTRA":           "E",
+}
+
+// callookCityLine splits Callook's "NEWINGTON, CT 06111" address line
+var callookCityLine = regexp.MustCompile(`^(.*?),?\s+([A-Z]{2})\s+(\d{5}(?:-?\d{4})?)$`)
+
+// parseCallookAudit reads a Callook JSON lookup. Callook has a full name
+// rather than its parts, and no status beyond whether the call is valid.
+func parseCallookAudit(body []byte) (map[string]string, bool, error) {
+	var doc struct {
+		Status  string `json:"status"`
+		Current struct {
+			OperClass string `json:"operClass"`
+		} `json:"current"`
+		Name    string `json:"name"`
+		Address struct {
+			Line1 string `json:"line1"`
+			Line2 string `json:"line2"`
+		} `json:"address"`
+		Location struct {
+			Latitude   string `json:"latitude"`
+			Longitude  string `json:"longitude"`
+			Gridsquare string `json:"gridsquare"`
+		} `json:"location"`
+		OtherInfo struct {
+			ExpiryDate string `json:"expiryDate"`
+		} `json:"otherInfo"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, false, fmt.Errorf("invalid Callook response: %w", err)
+	}
+	if doc.Status != "VALID" {
+		return nil, false, nil
+	}
+	class := strings.ToUpper(doc.Current.OperClass)
+	if code, ok := callookClasses[class]; ok {
+		class = code
+	}
+	fields := map[string]string{
+		"class":    class,
+		"expires":  doc.OtherInfo.ExpiryDate,
+		"fullname": doc.Name,
+		"addr1":    doc.Address.Line1,
+		"grid":     doc.Location.Gridsquare,
+		"lat":      doc.Location.Latitude,
+		"lon":      doc.Location.Longitude,
+	}
+	if m := callookCityLine.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(doc.Address.Line2))); m != nil {
+		fields["addr2"], fields["state"], fields["zip"] = m[1], m[2], m[3]
+	}
+	return fields, true, nil
+}
+
+// auditEqual compares a field the way the sources can legitimately differ
+// on it: case and spacing, date formats, ZIP+4 suffixes, grid precision,
+// and coordinates within about a kilometre
+func auditEqual(field, local, remote string) bool {
+	switch field {
+	case "expires":
+		return auditDate(local) == auditDate(remote)
+	case "zip":
+		return auditZIP(local) == auditZIP(remote)
+	case "grid":
+		a, b := strings.ToUpper(strings.TrimSpace(local)), strings.ToUpper(strings.TrimSpace(remote))
+		n := min(len(a), len(b))
+		return a[:n] == b[:n] && (n > 0 || a == b)
+	case "lat", "lon":
+		a, errA := strconv.ParseFloat(strings.TrimSpace(local), 64)
+		b, errB := strconv.ParseFloat(strings.TrimSpace(remote), 64)
+		if errA != nil || errB != nil {
+			return strings.TrimSpace(local) == strings.TrimSpace(remote)
+		}
+		return math.Abs(a-b) <= 0.01
+	}
+	return strings.Join(strings.Fields(strings.ToUpper(local)), " ") ==
+		strings.Join(strings.Fields(strings.ToUpper(remote)), " ")
+}
+
+// auditDate returns a date as YYYY-MM-DD if it's in a known format
+func auditDate(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02", "01/02/2006", "1/2/2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+	return s
+}
+
+// auditZIP returns the 5-digit ZIP of a ZIP or ZIP+4
+func auditZIP(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 5 {
+		s = s[:5]
+	}
+	return s
+}
+
+// printAudit logs a readable audit report
+func printAudit(res auditResult) {
+	log.Printf("%d of %d sampled callsigns found in %s, %d not found, %d errors",
+		res.Found, res.Sampled, res.Against, res.NotFound, res.Errors)
+	if len(res.Missing) > 0 {
+		shown := res.Missing[:min(len(res.Missing), 10)]
+		log.Printf("Not found: %s", strings.Join(shown, ", "))
+	}
+	log.Printf("  %-8s %9s %10s %7s", "field", "compared", "mismatched", "rate")
+	var examples []string
+	for _, field := range auditFields {
+		s := res.Fields[field]
+		if s == nil || s.Compared == 0 {
+			continue
+		}
+		log.Printf("  %-8s %9d %10d %6.1f%%", field, s.Compared, s.Mismatched, 100*float64(s.Mismatched)/float64(s.Compared))
+		for _, e := range s.Examples {
+			examples = append(examples, fmt.Sprintf("  %-8s %-10s local %q, %s %q", field, e.Call, e.Local, res.Against, e.Reference))
+		}
+	}
+	if len(examples) > 0 {
+		log.Printf("Examples:")
+		for _, e := range examples {
+			log.Print(e)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/backup"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+)
+
+// loadBackupConfig reads the backup location, which is required here
+func loadBackupConfig() (backup.Config, error) {
+	cfg, err := backup.LoadConfig(os.Getenv)
+	if err != nil {
+		return cfg, err
+	}
+	if !cfg.Enabled() {
+		return cfg, errors.New("BACKUP_S3_URL is not set")
+	}
+	return cfg, nil
+}
+
+// runBackup implements `hamqrzdb backup`
+func runBackup(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	fs.Parse(args)
+
+	cfg, err := loadBackupConfig()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(*dbFlag); err != nil {
+		return fmt.Errorf("database not found: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", *dbFlag+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	_, err = backup.Upload(ctx, cfg, db)
+	return err
+}
+
+// runRestore implements `hamqrzdb restore`
+func runRestore(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	forceFlag := fs.Bool("force", false, "Replace an existing database")
+	fs.Parse(args)
+
+	cfg, err := loadBackupConfig()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(*dbFlag); err == nil && !*forceFlag {
+		return fmt.Errorf("%s already exists; use -force to replace it", *dbFlag)
+	}
+	return backup.Restore(ctx, cfg, *dbFlag)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// benchResult summarizes a load test
+type benchResult struct {
+	Target   string  `json:"target"`
+	Duration float64 `json:"duration_seconds"`
+	Requests int     `json:"requests"`
+	// Dropped counts requests that weren't sent because every worker was
+	// busy, meaning the target (or this client) couldn't keep up
+	Dropped int         `json:"dropped"`
+	Errors  int         `json:"errors"`
+	RPS     float64     `json:"rps"`
+	Status  map[int]int `json:"status"`
+	// Latencies are in milliseconds
+	P50 float64 `json:"p50_ms"`
+	P90 float64 `json:"p90_ms"`
+	P99 float64 `json:"p99_ms"`
+	Max float64 `json:"max_ms"`
+}
+
+// runBench implements `hamqrzdb bench`: an open-loop load test of a running
+// API. Requests start at a fixed rate whether or not earlier ones have
+// finished, so a slow server shows up as latency rather than a lower rate.
+func runBench(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	targetFlag := fs.String("target", "http://localhost:8080", "Base URL of the API")
+	rpsFlag := fs.Int("rps", 100, "Requests per second")
+	durationFlag := fs.Duration("duration", 30*time.Second, "How long to run")
+	workersFlag := fs.Int("workers", 0, "Maximum requests in flight (default rps/10, at least 16)")
+	pathFlag := fs.String("path", "/v1/{call}/json/bench", "Request path; {call} is replaced by a callsign")
+	callsFlag := fs.String("callsigns", "W1AW,KJ5DJC,K1ABC", "Comma-separated callsigns to look up, in turn")
+	dbFlag := fs.String("db", "", "Look up a random sample of callsigns from this database instead of -callsigns")
+	sampleFlag := fs.Int("sample", 10000, "Callsigns to sample with -db")
+	maxP99Flag := fs.Duration("max-p99", 0, "Fail if the 99th percentile latency exceeds this")
+	maxErrorsFlag := fs.Float64("max-errors", 0.01, "Fail if more than this fraction of requests fail or are dropped")
+	jsonFlag := fs.Bool("json", false, "Print the result as JSON")
+	fs.Parse(args)
+
+	if *rpsFlag <= 0 {
+		return errors.New("-rps must be positive")
+	}
+	target, err := url.Parse(strings.TrimSuffix(*targetFlag, "/"))
+	if err != nil || target.Host == "" {
+		return fmt.Errorf("invalid -target %q", *targetFlag)
+	}
+	calls := strings.Split(*callsFlag, ",")
+	if *dbFlag != "" {
+		if calls, err = sampleCallsigns(ctx, *dbFlag, *sampleFlag); err != nil {
+			return err
+		}
+	}
+	workers := *workersFlag
+	if workers <= 0 {
+		workers = max(*rpsFlag/10, 16)
+	}
+
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: workers},
+	}
+
+	type sample struct {
+		status  int
+		latency time.Duration
+	}
+	var (
+		mu      sync.Mutex
+		samples []sample
+		wg      sync.WaitGroup
+	)
+	jobs := make(chan string, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range jobs {
+				start := time.Now()
+				status := 0
+				req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+				if resp, err := client.Do(req); err == nil {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+					status = resp.StatusCode
+				}
+				s := sample{status: status, latency: time.Since(start)}
+				mu.Lock()
+				samples = append(samples, s)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	log.Printf("Sending %d requests/s to %s for %s (%d workers, %d callsigns)",
+		*rpsFlag, target, *durationFlag, workers, len(calls))
+	ticker := time.NewTicker(max(time.Second/time.Duration(*rpsFlag), time.Millisecond))
+	deadline := time.After(*durationFlag)
+	started := time.Now()
+	sent, dropped := 0, 0
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-deadline:
+			break loop
+		case <-ticker.C:
+			// Tickers drop ticks under load; catch up to the schedule instead
+			due := int(time.Since(started) * time.Duration(*rpsFlag) / time.Second)
+			for n := sent + dropped; n < due; n++ {
+				call := strings.TrimSpace(calls[n%len(calls)])
+				u := target.String() + strings.ReplaceAll(*pathFlag, "{call}", url.PathEscape(call))
+				select {
+				case jobs <- u:
+					sent++
+				default:
+					dropped++
+				}
+			}
+		}
+	}
+	ticker.Stop()
+	close(jobs)
+	wg.Wait()
+	elapsed := time.Since(started)
+
+	res := benchResult{
+		Target:   target.String(),
+		Duration: elapsed.Seconds(),
+		Requests: len(samples),
+		Dropped:  dropped,
+		RPS:      float64(len(samples)) / elapsed.Seconds(),
+		Status:   map[int]int{},
+	}
+	latencies := make([]time.Duration, len(samples))
+	for i, s := range samples {
+		res.Status[s.status]++
+		// A lookup miss is a valid answer; transport errors and 5xx aren't
+		if s.status == 0 || s.status >= 500 {
+			res.Errors++
+		}
+		latencies[i] = s.latency
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	res.P50 = percentile(latencies, 0.50)
+	res.P90 = percentile(latencies, 0.90)
+	res.P99 = percentile(latencies, 0.99)
+	res.Max = percentile(latencies, 1)
+
+	if *jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("%d requests in %.1fs (%.0f/s), %d errors, %d dropped", res.Requests, res.Duration, res.RPS, res.Errors, res.Dropped)
+		codes := make([]int, 0, len(res.Status))
+		for code := range res.Status {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			label := fmt.Sprint(code)
+			if code == 0 {
+				label = "failed"
+			}
+			log.Printf("  %-6s %d", label, res.Status[code])
+		}
+		log.Printf("Latency p50 %.1fms, p90 %.1fms, p99 %.1fms, max %.1fms", res.P50, res.P90, res.P99, res.Max)
+	}
+
+	if total := res.Requests + res.Dropped; total > 0 && float64(res.Errors+res.Dropped)/float64(total) > *maxErrorsFlag {
+		return fmt.Errorf("%d of %d requests failed or were dropped", res.Errors+res.Dropped, total)
+	}
+	if *maxP99Flag > 0 && res.P99 > float64(*maxP99Flag)/float64(time.Millisecond) {
+		return fmt.Errorf("p99 latency %.1fms exceeds %s", res.P99, *maxP99Flag)
+	}
+	return nil
+}
+
+// percentile returns the p quantile of sorted latencies in milliseconds
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(sorted))+0.5) - 1
+	i = min(max(i, 0), len(sorted)-1)
+	return float64(sorted[i]) / float64(time.Millisecond)
+}
+
+// sampleCallsigns returns up to n random callsigns from a database, so a
+// load test spreads across the index instead of hitting cached pages
+func sampleCallsigns(ctx context.Context, dbPath string, n int) ([]string, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("database not found: %w", err)
+	}
+	db, err := sql.Open("sqlite3", dbPath+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, "SELECT callsign FROM callsigns ORDER BY random() LIMIT ?", n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample callsigns: %w", err)
+	}
+	defer rows.Close()
+	var calls []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		calls = append(calls, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(calls) == 0 {
+		return nil, errors.New("database has no callsigns to sample")
+	}
+	return calls, nil
+}
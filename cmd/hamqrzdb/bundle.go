@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/bundle"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+)
+
+// runBundle implements `hamqrzdb bundle`
+func runBundle(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("bundle", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	outFlag := fs.String("out", "", "Bundle file to write; required")
+	stateFlag := fs.String("state", "", "Comma-separated states or regions to include, e.g. TX,OK")
+	gridFlag := fs.String("grid", "", "Comma-separated grid square prefixes to include, e.g. EM10,EM11")
+	zipFlag := fs.String("zip", "", "Comma-separated ZIP code prefixes to include, e.g. 786,787")
+	forceFlag := fs.Bool("force", false, "Overwrite an existing bundle file")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb bundle -out FILE [-state LIST] [-grid LIST] [-zip LIST] [flags]")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Licensees must match every filter given: one of the states, one of the grid")
+		fmt.Fprintln(os.Stderr, "prefixes, and one of the ZIP code prefixes.")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	f := bundle.Filter{
+		States: splitList(*stateFlag),
+		Grids:  splitList(*gridFlag),
+		Zips:   splitList(*zipFlag),
+	}
+	if *outFlag == "" || f.IsEmpty() {
+		fs.Usage()
+		return fmt.Errorf("-out and at least one of -state, -grid, or -zip are required")
+	}
+	if _, err := os.Stat(*outFlag); err == nil && !*forceFlag {
+		return fmt.Errorf("%s already exists; use -force to overwrite it", *outFlag)
+	}
+	if _, err := os.Stat(*dbFlag); err != nil {
+		return fmt.Errorf("database not found: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", *dbFlag+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	start := time.Now()
+	info, err := bundle.Build(ctx, db, *dbFlag, *outFlag, f)
+	if err != nil {
+		return err
+	}
+	size := int64(0)
+	if st, err := os.Stat(*outFlag); err == nil {
+		size = st.Size()
+	}
+	log.Printf("Bundled %d callsigns (%s) into %s, %.1f MB, in %s", info.Callsigns, info.Filter, *outFlag,
+		float64(size)/(1<<20), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// splitList splits a comma-separated flag, dropping empty items
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.ToUpper(strings.TrimSpace(v)); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
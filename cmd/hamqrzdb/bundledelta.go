@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/bundle"
+)
+
+// runBundleDiff implements `hamqrzdb bundle-diff`
+func runBundleDiff(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("bundle-diff", flag.ExitOnError)
+	fromFlag := fs.String("from", "", "The bundle users have; required")
+	toFlag := fs.String("to", "", "The new bundle, built with the same filter; required")
+	outFlag := fs.String("out", "", "Delta file to write; required")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb bundle-diff -from OLD.sqlite -to NEW.sqlite -out DELTA")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *fromFlag == "" || *toFlag == "" || *outFlag == "" {
+		fs.Usage()
+		return fmt.Errorf("-from, -to, and -out are required")
+	}
+	for _, path := range []string{*fromFlag, *toFlag} {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("bundle not found: %w", err)
+		}
+	}
+
+	tmp := *outFlag + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	stats, err := bundle.Diff(ctx, *fromFlag, *toFlag, f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, *outFlag); err != nil {
+		return err
+	}
+
+	size := int64(0)
+	if st, err := os.Stat(*outFlag); err == nil {
+		size = st.Size()
+	}
+	log.Printf("Wrote %s: %d rows changed, %d removed, %.1f KB (bundle built %s to %s)", *outFlag,
+		stats.Written, stats.Deleted, float64(size)/1024, stats.From.BuiltAt, stats.To.BuiltAt)
+	return nil
+}
+
+// runBundleApply implements `hamqrzdb bundle-apply`
+func runBundleApply(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("bundle-apply", flag.ExitOnError)
+	dbFlag := fs.String("db", "", "Bundle to update; required")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb bundle-apply -db BUNDLE.sqlite DELTA [DELTA ...]")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Deltas are applied in order, each in one transaction.")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *dbFlag == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("-db and a delta file are required")
+	}
+	if _, err := os.Stat(*dbFlag); err != nil {
+		return fmt.Errorf("bundle not found: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", *dbFlag+"?_busy_timeout=30000")
+	if err != nil {
+		return fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer db.Close()
+
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		stats, err := bundle.Apply(ctx, db, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		log.Printf("Applied %s: %d rows written, %d removed; bundle now built %s with %d callsigns",
+			path, stats.Written, stats.Deleted, stats.To.BuiltAt, stats.To.Callsigns)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/httpclient"
+)
+
+// openInput opens a CSV export from a local file, or downloads it from url
+// when path is empty. The caller closes the result.
+func openInput(ctx context.Context, path, url, proxy string) (io.ReadCloser, error) {
+	if path != "" {
+		return os.Open(path)
+	}
+
+	log.Printf("Downloading %s...", url)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client, err := httpclient.New(proxy)
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = 2 * time.Minute
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("bad status: %s (status code: %d)", resp.Status, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// headerColumns maps each field to its column index in a CSV header, using
+// the first of the field's aliases present (matched case-insensitively)
+func headerColumns(header []string, aliases map[string][]string) map[string]int {
+	index := map[string]int{}
+	for i, h := range header {
+		index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	columns := map[string]int{}
+	for field, names := range aliases {
+		for _, name := range names {
+			if i, ok := index[name]; ok {
+				columns[field] = i
+				break
+			}
+		}
+	}
+	return columns
+}
+
+// csvField returns the trimmed value of a mapped field in row, or "" if the
+// field isn't mapped or the row is short
+func csvField(columns map[string]int, row []string, name string) string {
+	i, ok := columns[name]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CSVMapping describes how an ad-hoc licence CSV maps onto the callsigns table
+type CSVMapping struct {
+	Country          string            `yaml:"country"`
+	RadioServiceCode string            `yaml:"radio_service_code"`
+	DataSource       string            `yaml:"data_source"`
+	Delimiter        string            `yaml:"delimiter"`
+	Encoding         string            `yaml:"encoding"`
+	Header           *bool             `yaml:"header"`
+	SkipRows         int               `yaml:"skip_rows"`
+	DateFormat       string            `yaml:"date_format"`
+	Columns          map[string]Column `yaml:"columns"`
+	StatusMap        map[string]string `yaml:"status_map"`
+	Defaults         map[string]string `yaml:"defaults"`
+}
+
+// Column names one or more source columns for a field. Several columns are
+// joined with a space, e.g. [Street, House Number] for street_address.
+// Columns are header names, or 1-based numbers when the file has no header.
+type Column []string
+
+func (c *Column) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*c = Column{node.Value}
+		return nil
+	case yaml.SequenceNode:
+		var cols []string
+		if err := node.Decode(&cols); err != nil {
+			return err
+		}
+		*c = cols
+		return nil
+	default:
+		return fmt.Errorf("line %d: column must be a name or a list of names", node.Line)
+	}
+}
+
+// mappableFields are the callsigns columns a mapping may fill. "name" is a
+// pseudo-field holding a full name, split into first/last when those aren't mapped.
+var mappableFields = map[string]bool{
+	"callsign": true, "license_status": true, "grant_date": true, "expired_date": true,
+	"cancellation_date": true, "operator_class": true, "first_name": true, "mi": true,
+	"last_name": true, "suffix": true, "entity_name": true, "street_address": true,
+	"city": true, "state": true, "zip_code": true, "latitude": true, "longitude": true,
+	"grid_square": true, "name": true,
+}
+
+// dateFields are normalized to YYYY-MM-DD using date_format
+var dateFields = map[string]bool{
+	"grant_date": true, "expired_date": true, "cancellation_date": true,
+}
+
+// LoadCSVMapping reads and validates a YAML mapping file
+func LoadCSVMapping(path string) (*CSVMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping: %w", err)
+	}
+
+	var m CSVMapping
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse mapping %s: %w", path, err)
+	}
+
+	if m.Country == "" {
+		return nil, fmt.Errorf("mapping: country is required")
+	}
+	if len(m.Columns["callsign"]) == 0 {
+		return nil, fmt.Errorf("mapping: columns.callsign is required")
+	}
+	for field := range m.Columns {
+		if !mappableFields[field] {
+			return nil, fmt.Errorf("mapping: unknown field %q in columns", field)
+		}
+	}
+	for field := range m.Defaults {
+		if !mappableFields[field] || field == "callsign" {
+			return nil, fmt.Errorf("mapping: unknown field %q in defaults", field)
+		}
+	}
+	if r := []rune(m.Delimiter); len(r) > 1 || m.Delimiter == "\n" || m.Delimiter == "\"" {
+		return nil, fmt.Errorf("mapping: delimiter must be a single character")
+	}
+	if !m.hasHeader() {
+		for field, col := range m.Columns {
+			for _, name := range col {
+				if n, err := strconv.Atoi(name); err != nil || n < 1 {
+					return nil, fmt.Errorf("mapping: columns.%s must be column numbers when header is false", field)
+				}
+			}
+		}
+	}
+
+	if m.DataSource == "" {
+		m.DataSource = strings.ToUpper(m.RadioServiceCode)
+	}
+	if m.DataSource == "" {
+		m.DataSource = strings.ToUpper(m.Country)
+	}
+
+	return &m, nil
+}
+
+func (m *CSVMapping) hasHeader() bool {
+	return m.Header == nil || *m.Header
+}
+
+// delimiter returns the field separator, defaulting to a comma
+func (m *CSVMapping) delimiter() rune {
+	if m.Delimiter == "" {
+		return ','
+	}
+	if m.Delimiter == `\t` {
+		return '\t'
+	}
+	return []rune(m.Delimiter)[0]
+}
+
+// strftimeLayouts translates the strftime directives mapping files use into
+// Go time layouts, so users don't need to know Go's reference date.
+var strftimeLayouts = strings.NewReplacer(
+	"%Y", "2006", "%y", "06", "%m", "01", "%d", "02", "%e", "_2",
+	"%b", "Jan", "%B", "January", "%H", "15", "%M", "04", "%S", "05", "%%", "%",
+)
+
+// normalizeDate parses value with date_format and returns YYYY-MM-DD. Values
+// that don't parse are kept as-is rather than dropped.
+func (m *CSVMapping) normalizeDate(value string) string {
+	if value == "" || m.DateFormat == "" {
+		return value
+	}
+	t, err := time.Parse(strftimeLayouts.Replace(m.DateFormat), value)
+	if err != nil {
+		return value
+	}
+	return t.Format("2006-01-02")
+}
+
+// mapStatus translates a source status with status_map. Lookups ignore case.
+func (m *CSVMapping) mapStatus(value string) string {
+	if len(m.StatusMap) == 0 {
+		return value
+	}
+	for from, to := range m.StatusMap {
+		if strings.EqualFold(from, value) {
+			return to
+		}
+	}
+	if to, ok := m.StatusMap["*"]; ok {
+		return to
+	}
+	return value
+}
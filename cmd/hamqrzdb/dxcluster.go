@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/callsign"
+	"github.com/chriskacerguis/hamqrzdb/internal/dxcluster"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/prefix"
+	"github.com/chriskacerguis/hamqrzdb/internal/redact"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// runDXCluster implements `hamqrzdb dxcluster`
+func runDXCluster(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("dxcluster", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	clusterFlag := fs.String("cluster", "", "DX cluster telnet address, host:port; required")
+	loginFlag := fs.String("login", "", "Callsign to log in to the cluster with; required")
+	listenFlag := fs.String("listen", ":7300", "Address to serve the enriched feed on")
+	formatFlag := fs.String("format", "telnet", "Feed format: telnet (cluster lines with details appended) or json")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb dxcluster -cluster HOST:PORT -login CALL [flags]")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *clusterFlag == "" || *loginFlag == "" {
+		fs.Usage()
+		return fmt.Errorf("-cluster and -login are required")
+	}
+	if _, _, err := net.SplitHostPort(*clusterFlag); err != nil {
+		return fmt.Errorf("invalid -cluster %q: %w", *clusterFlag, err)
+	}
+	if *formatFlag != "telnet" && *formatFlag != "json" {
+		return fmt.Errorf("unknown format %q (expected telnet or json)", *formatFlag)
+	}
+
+	if _, err := os.Stat(*dbFlag); err != nil {
+		return fmt.Errorf("database not found: %w", err)
+	}
+	db, err := sql.Open("sqlite3", *dbFlag+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+	hasCountry, err := schema.HasColumn(ctx, db, "callsigns", "country")
+	if err != nil {
+		return fmt.Errorf("failed to read the schema: %w", err)
+	}
+
+	ln, err := net.Listen("tcp", *listenFlag)
+	if err != nil {
+		return err
+	}
+	relay := &dxcluster.Relay{
+		Cluster: *clusterFlag,
+		Login:   strings.ToUpper(*loginFlag),
+		Enrich:  (&stationCache{db: db, redaction: redact.LoadConfig(os.Getenv), country: schema.CountryExpr(hasCountry)}).lookup,
+		JSON:    *formatFlag == "json",
+	}
+	go relay.Run(ctx)
+	log.Printf("Serving %s from %s on %s", *formatFlag, *clusterFlag, ln.Addr())
+	return relay.Serve(ctx, ln)
+}
+
+// maxCachedStations bounds the station cache; busy contests spot far more
+// distinct callsigns than this, and it starts over when full
+const maxCachedStations = 20000
+
+// stationCache looks up spotted callsigns, remembering the results since the
+// same stations are spotted over and over
+type stationCache struct {
+	db *sql.DB
+	// redaction withholds names as API lookups do; country is the SQL
+	// expression of a record's country it is applied by
+	redaction redact.Config
+	country   string
+
+	mu       sync.Mutex
+	stations map[string]dxcluster.Station
+}
+
+// lookup returns the licence details of call's base call, and the country of
+// the prefix it operates under
+func (c *stationCache) lookup(call string) dxcluster.Station {
+	c.mu.Lock()
+	s, ok := c.stations[call]
+	c.mu.Unlock()
+	if ok {
+		return s
+	}
+
+	if info, ok := prefix.Lookup(callsign.Prefix(call)); ok {
+		s.Country = info.Country
+	}
+	if base := callsign.Base(call); base != "" {
+		var first, last, entity string
+		name := c.redaction.Names.Column
+		err := c.db.QueryRow(`
+			SELECT COALESCE(`+name("first_name", c.country)+`, ''), COALESCE(`+name("last_name", c.country)+`, ''),
+				COALESCE(entity_name, ''),
+				COALESCE(state, ''), COALESCE(grid_square, '')
+			FROM callsigns
+			WHERE callsign = ?
+			ORDER BY license_status = 'A' DESC, data_source
+			LIMIT 1
+		`, base).Scan(&first, &last, &entity, &s.State, &s.Grid)
+		switch {
+		case err == nil:
+			s.Name = fullName(first, last)
+			if s.Name == "" {
+				s.Name = entity
+			}
+			// Portable operation elsewhere makes the licence address wrong
+			if p := callsign.Prefix(call); p != callsign.Prefix(base) {
+				s.State, s.Grid = "", ""
+			}
+		case err != sql.ErrNoRows:
+			log.Printf("Failed to look up %s: %v", base, err)
+		}
+	}
+
+	c.mu.Lock()
+	if c.stations == nil || len(c.stations) >= maxCachedStations {
+		c.stations = map[string]dxcluster.Station{}
+	}
+	c.stations[call] = s
+	c.mu.Unlock()
+	return s
+}
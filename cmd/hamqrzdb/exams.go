@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/geo"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// examSourceURLEnvs name the environment variables holding the schedule URL
+// of each VEC whose posted sessions are recognized by -source
+var examSourceURLEnvs = map[string]string{
+	"arrl": "ARRL_EXAMS_URL",
+	"w5yi": "W5YI_EXAMS_URL",
+}
+
+// examAliases maps each exam_sessions field to the header names (or JSON
+// keys) used by VEC session schedules (matched case-insensitively)
+var examAliases = map[string][]string{
+	"date":      {"exam date", "session date", "date"},
+	"time":      {"exam time", "start time", "session time", "time"},
+	"location":  {"location", "location name", "venue", "site", "facility"},
+	"team":      {"team", "sponsor", "ve team", "team name", "sponsoring organization"},
+	"address":   {"address", "street", "street address", "address1"},
+	"city":      {"city"},
+	"state":     {"state", "st"},
+	"zip":       {"zip", "zip code", "zipcode", "postal code"},
+	"contact":   {"contact", "contact name", "team liaison", "liaison"},
+	"phone":     {"phone", "contact phone", "telephone"},
+	"email":     {"email", "contact email", "e-mail"},
+	"walk_ins":  {"walk-ins", "walk ins", "walk-ins allowed", "walkins"},
+	"latitude":  {"lat", "latitude"},
+	"longitude": {"long", "lon", "lng", "longitude"},
+	"grid":      {"grid", "grid square", "gridsquare", "locator"},
+}
+
+// runImportExams implements `hamqrzdb import-exams`
+func runImportExams(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import-exams", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	sourceFlag := fs.String("source", "", "VEC of the schedule (arrl, w5yi, or any other name)")
+	urlFlag := fs.String("url", "", "URL of the schedule (defaults to ARRL_EXAMS_URL or W5YI_EXAMS_URL)")
+	proxyFlag := fs.String("proxy", "", "Proxy for downloads (http://, socks5://); defaults to HTTP_PROXY/HTTPS_PROXY")
+	replaceFlag := fs.Bool("replace", true, "Replace the source's sessions with the imported schedule")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb import-exams -source NAME [flags] [sessions.csv|sessions.json]")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	source := strings.ToLower(strings.TrimSpace(*sourceFlag))
+	if source == "" {
+		fs.Usage()
+		return fmt.Errorf("-source is required")
+	}
+	url := *urlFlag
+	if url == "" && examSourceURLEnvs[source] != "" {
+		url = os.Getenv(examSourceURLEnvs[source])
+	}
+	if fs.NArg() == 0 && url == "" {
+		fs.Usage()
+		return fmt.Errorf("a schedule file or -url is required")
+	}
+
+	r, err := openInput(ctx, fs.Arg(0), url, *proxyFlag)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	db, err := sql.Open("sqlite3", *dbFlag+"?_busy_timeout=30000&_journal_mode=WAL")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := schema.Ensure(ctx, db); err != nil {
+		return err
+	}
+
+	header, rows, err := repeaterRows(r)
+	if err != nil {
+		return err
+	}
+	count, err := importExams(ctx, db, strings.ToUpper(source), header, rows, *replaceFlag)
+	if err != nil {
+		return err
+	}
+	log.Printf("Import complete: %d %s exam sessions", count, strings.ToUpper(source))
+	return nil
+}
+
+// importExams loads a VEC's session schedule into the exam_sessions table in
+// one transaction. Sessions are located by their latitude and longitude, or
+// failing that their grid square, or failing that the average position of
+// the licensees in their ZIP code.
+func importExams(ctx context.Context, db *sql.DB, source string, header []string, rows [][]string, replace bool) (int, error) {
+	columns := headerColumns(header, examAliases)
+	if _, ok := columns["date"]; !ok {
+		return 0, fmt.Errorf("no date column in header (tried %s)", strings.Join(examAliases["date"], ", "))
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM exam_sessions WHERE source = ?", source); err != nil {
+			return 0, err
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO exam_sessions (source, session_date, start_time, location, team, address, city, state,
+			zip_code, contact, phone, email, walk_ins, latitude, longitude, last_updated)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(source, session_date, start_time, location) DO UPDATE SET
+			team = excluded.team,
+			address = excluded.address,
+			city = excluded.city,
+			state = excluded.state,
+			zip_code = excluded.zip_code,
+			contact = excluded.contact,
+			phone = excluded.phone,
+			email = excluded.email,
+			walk_ins = excluded.walk_ins,
+			latitude = excluded.latitude,
+			longitude = excluded.longitude,
+			last_updated = CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	zipCentroids := map[string][2]interface{}{}
+	count, skipped, unlocated := 0, 0, 0
+	for _, row := range rows {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		field := func(name string) string {
+			return csvField(columns, row, name)
+		}
+
+		date := referenceDate(field("date"))
+		if date == "" {
+			skipped++
+			continue
+		}
+		zip := field("zip")
+		if len(zip) > 5 {
+			zip = zip[:5]
+		}
+
+		lat, lon := coordinate(field("latitude")), coordinate(field("longitude"))
+		if lat == nil || lon == nil {
+			lat, lon = nil, nil
+			if gLat, gLon, err := geo.GridCenter(field("grid")); err == nil {
+				lat, lon = gLat, gLon
+			} else if zip != "" {
+				c, ok := zipCentroids[zip]
+				if !ok {
+					c, err = zipCentroid(ctx, tx, zip)
+					if err != nil {
+						return 0, err
+					}
+					zipCentroids[zip] = c
+				}
+				lat, lon = c[0], c[1]
+			}
+		}
+		if lat == nil {
+			unlocated++
+		}
+
+		if _, err := stmt.ExecContext(ctx, source, date, field("time"), field("location"),
+			field("team"), field("address"), field("city"), strings.ToUpper(field("state")), zip,
+			field("contact"), field("phone"), field("email"), field("walk_ins"), lat, lon); err != nil {
+			return 0, fmt.Errorf("failed to insert the %s session at %q: %w", date, field("location"), err)
+		}
+		count++
+	}
+
+	// Like batch pruning, never let an empty or broken schedule wipe the table
+	if replace && count == 0 {
+		return 0, fmt.Errorf("no valid sessions found; refusing to replace existing data")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d rows without a valid date", skipped)
+	}
+	if unlocated > 0 {
+		log.Printf("%d sessions have no coordinates, grid, or known ZIP code and won't match ?near= searches", unlocated)
+	}
+	return count, nil
+}
+
+// zipCentroid returns the average position of the licensees with
+// coordinates in a ZIP code, or nils when there are none
+func zipCentroid(ctx context.Context, tx *sql.Tx, zip string) ([2]interface{}, error) {
+	var lat, lon sql.NullFloat64
+	err := tx.QueryRowContext(ctx, `
+		SELECT AVG(latitude), AVG(longitude)
+		FROM callsigns
+		WHERE zip_code LIKE ? || '%' AND latitude IS NOT NULL AND latitude != 0
+	`, zip).Scan(&lat, &lon)
+	if err != nil {
+		return [2]interface{}{}, fmt.Errorf("failed to locate ZIP code %s: %w", zip, err)
+	}
+	if !lat.Valid || !lon.Valid {
+		return [2]interface{}{}, nil
+	}
+	return [2]interface{}{lat.Float64, lon.Float64}, nil
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/geo"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/redact"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// runGenSite implements `hamqrzdb gen-site`
+func runGenSite(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("gen-site", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	outFlag := fs.String("out", "", "Directory to write the site to; required")
+	callsFlag := fs.String("callsigns", "", "Comma-separated callsigns to generate pages for")
+	fileFlag := fs.String("file", "", "File of callsigns, separated by commas or whitespace")
+	stateFlag := fs.String("state", "", "Generate pages for the active licensees in this state or region")
+	gridFlag := fs.String("grid", "", "Generate pages for the active licensees in grid squares with this prefix")
+	titleFlag := fs.String("title", "Callsign Profiles", "Site title shown on every page")
+	streetFlag := fs.Bool("street", false, "Include street addresses (pages show the city and state without it)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb gen-site -out DIR [-callsigns LIST] [-file FILE] [-state ST] [-grid PREFIX] [flags]")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Writes a static HTML profile page per callsign, with index pages, for any web")
+		fmt.Fprintln(os.Stderr, "server or object store. Without a selection every active licensee gets a page.")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *outFlag == "" {
+		fs.Usage()
+		return fmt.Errorf("-out is required")
+	}
+	calls := strings.FieldsFunc(strings.ToUpper(*callsFlag), isCallSeparator)
+	if *fileFlag != "" {
+		data, err := os.ReadFile(*fileFlag)
+		if err != nil {
+			return err
+		}
+		calls = append(calls, strings.FieldsFunc(strings.ToUpper(string(data)), isCallSeparator)...)
+	}
+
+	if _, err := os.Stat(*dbFlag); err != nil {
+		return fmt.Errorf("database not found: %w", err)
+	}
+	db, err := sql.Open("sqlite3", *dbFlag+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	g := &siteGenerator{
+		db:        db,
+		out:       *outFlag,
+		title:     *titleFlag,
+		street:    *streetFlag,
+		redaction: redact.LoadConfig(os.Getenv),
+		generated: time.Now().UTC().Format("2006-01-02"),
+		prefixes:  map[string][]siteEntry{},
+	}
+	if err := g.profiles(ctx, calls, strings.ToUpper(strings.TrimSpace(*stateFlag)), strings.ToUpper(strings.TrimSpace(*gridFlag))); err != nil {
+		return err
+	}
+	if err := g.indexes(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d profile pages to %s\n", g.pages, g.out)
+	return nil
+}
+
+// siteGenerator writes a profile site. Pages go in a directory per
+// callsign's first two characters, so no directory holds every callsign.
+type siteGenerator struct {
+	db     *sql.DB
+	out    string
+	title  string
+	street bool
+	// redaction withholds names and street addresses as API lookups do
+	redaction redact.Config
+	generated string
+
+	history *sql.Stmt
+	// prefixes lists the pages written under each directory
+	prefixes map[string][]siteEntry
+	pages    int
+}
+
+// siteEntry is a profile's line on its index page
+type siteEntry struct {
+	Call, File, Name, Location string
+}
+
+// siteProfile is the data of a profile page
+type siteProfile struct {
+	Site, Generated string
+	Call, Name      string
+	Class, Status   string
+	Expires         string
+	LicensedSince   string
+	Street          string
+	Location        string
+	Country         string
+	Grid            string
+	// MapEmbed and MapLink show the grid square on OpenStreetMap
+	MapEmbed, MapLink string
+	History           []siteChange
+}
+
+// siteChange is one recorded class or status change
+type siteChange struct {
+	Date, What, From, To string
+}
+
+// profiles writes a page for each selected licence: the callsigns listed
+// (any status), or the active licensees in state and grid, or every active
+// licensee. Callsigns licensed by several sources get the active one, then
+// the first by data source.
+func (g *siteGenerator) profiles(ctx context.Context, calls []string, state, grid string) error {
+	var hasHistory int
+	g.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'callsign_history'`).Scan(&hasHistory)
+	if hasHistory > 0 {
+		var err error
+		g.history, err = g.db.PrepareContext(ctx, `
+			SELECT field, COALESCE(old_value, ''), COALESCE(new_value, ''), date(changed_at)
+			FROM callsign_history
+			WHERE callsign = ? AND data_source = ? AND field IN ('operator_class', 'license_status')
+			ORDER BY changed_at, id
+		`)
+		if err != nil {
+			return fmt.Errorf("history query failed: %w", err)
+		}
+		defer g.history.Close()
+	}
+
+	var where []string
+	var args []interface{}
+	if len(calls) > 0 {
+		where = append(where, "callsign IN (?"+strings.Repeat(", ?", len(calls)-1)+")")
+		for _, call := range calls {
+			args = append(args, call)
+		}
+	} else {
+		where = append(where, "license_status = 'A'")
+	}
+	if state != "" {
+		where = append(where, "UPPER(state) = ?")
+		args = append(args, state)
+	}
+	if grid != "" {
+		where = append(where, "UPPER(grid_square) LIKE ? || '%'")
+		args = append(args, grid)
+	}
+
+	hasCountry, err := schema.HasColumn(ctx, g.db, "callsigns", "country")
+	if err != nil {
+		return err
+	}
+	country := schema.CountryExpr(hasCountry)
+	address, name := g.redaction.Addresses.Column, g.redaction.Names.Column
+
+	rows, err := g.db.QueryContext(ctx, `
+		SELECT callsign, data_source, COALESCE(`+name("first_name", country)+`, ''), COALESCE(`+name("mi", country)+`, ''),
+			COALESCE(`+name("last_name", country)+`, ''), COALESCE(`+name("suffix", country)+`, ''),
+			COALESCE(entity_name, ''), COALESCE(operator_class, ''),
+			COALESCE(license_status, ''), COALESCE(expired_date_iso, expired_date, ''),
+			COALESCE(licensed_since, ''), COALESCE(`+address("street_address", country)+`, ''), COALESCE(city, ''),
+			COALESCE(state, ''), COALESCE(zip_code, ''), `+country+`, COALESCE(grid_square, '')
+		FROM callsigns
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY callsign, license_status = 'A' DESC, data_source
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("callsign query failed: %w", err)
+	}
+	defer rows.Close()
+
+	found := map[string]bool{}
+	var last string
+	for rows.Next() {
+		var p siteProfile
+		var source, first, mi, lastName, suffix, entity, street, city, st, zip string
+		if err := rows.Scan(&p.Call, &source, &first, &mi, &lastName, &suffix, &entity, &p.Class,
+			&p.Status, &p.Expires, &p.LicensedSince, &street, &city, &st, &zip, &p.Country, &p.Grid); err != nil {
+			return err
+		}
+		if p.Call == last {
+			continue
+		}
+		last = p.Call
+		found[p.Call] = true
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		p.Site, p.Generated = g.title, g.generated
+		p.Name = joinNonEmpty(" ", first, mi, lastName, suffix)
+		if p.Name == "" {
+			p.Name = entity
+		}
+		if name, ok := winlinkClasses[p.Class]; ok && (source == "FCC" || source == "") {
+			p.Class = name
+		}
+		if name, ok := winlinkStatuses[p.Status]; ok {
+			p.Status = name
+		}
+		if g.street {
+			p.Street = street
+		}
+		p.Location = joinNonEmpty(" ", joinNonEmpty(", ", city, st), zip)
+		p.MapEmbed, p.MapLink = gridMap(p.Grid)
+		if g.history != nil {
+			if p.History, err = g.changes(ctx, p.Call, source); err != nil {
+				return err
+			}
+		}
+
+		if err := g.writeProfile(p); err != nil {
+			return err
+		}
+		prefix := sitePrefix(p.Call)
+		g.prefixes[prefix] = append(g.prefixes[prefix], siteEntry{Call: p.Call, File: siteFileName(p.Call), Name: p.Name, Location: joinNonEmpty(", ", city, st)})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, call := range calls {
+		if !found[call] {
+			fmt.Fprintf(os.Stderr, "Not found: %s\n", call)
+		}
+	}
+	return nil
+}
+
+// changes returns a licence's recorded class and status changes, oldest
+// first
+func (g *siteGenerator) changes(ctx context.Context, call, source string) ([]siteChange, error) {
+	rows, err := g.history.QueryContext(ctx, call, source)
+	if err != nil {
+		return nil, fmt.Errorf("history query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []siteChange
+	for rows.Next() {
+		var field string
+		var c siteChange
+		if err := rows.Scan(&field, &c.From, &c.To, &c.Date); err != nil {
+			return nil, err
+		}
+		names := winlinkStatuses
+		c.What = "Status"
+		if field == "operator_class" {
+			names = winlinkClasses
+			c.What = "Class"
+		}
+		for _, v := range []*string{&c.From, &c.To} {
+			if name, ok := names[*v]; ok {
+				*v = name
+			}
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// sitePrefix is the directory a callsign's page goes in
+func sitePrefix(call string) string {
+	if len(call) < 2 {
+		return call
+	}
+	return call[:2]
+}
+
+// siteFileName makes a callsign safe as a file name
+func siteFileName(call string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, call)
+}
+
+// gridMap returns an OpenStreetMap embed and link centred on a grid square,
+// or nothing for a missing or invalid one. Only the grid square is shown, so
+// the map doesn't place a station closer than its locator does.
+func gridMap(grid string) (embed, link string) {
+	if len(grid) > 6 {
+		grid = grid[:6]
+	}
+	lat, lon, err := geo.GridCenter(grid)
+	if err != nil {
+		return "", ""
+	}
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 4, 64) }
+	embed = "https://www.openstreetmap.org/export/embed.html?bbox=" +
+		f(lon-0.15) + "," + f(lat-0.1) + "," + f(lon+0.15) + "," + f(lat+0.1) +
+		"&layer=mapnik&marker=" + f(lat) + "," + f(lon)
+	link = "https://www.openstreetmap.org/?mlat=" + f(lat) + "&mlon=" + f(lon) + "#map=11/" + f(lat) + "/" + f(lon)
+	return embed, link
+}
+
+// writeProfile writes a callsign's page
+func (g *siteGenerator) writeProfile(p siteProfile) error {
+	dir := filepath.Join(g.out, siteFileName(sitePrefix(p.Call)))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := writeSitePage(filepath.Join(dir, siteFileName(p.Call)+".html"), "profile", p); err != nil {
+		return err
+	}
+	g.pages++
+	return nil
+}
+
+// indexes writes the site's front page, listing the directories, and each
+// directory's list of callsigns
+func (g *siteGenerator) indexes() error {
+	type prefixLink struct {
+		Prefix string
+		Dir    string
+		Count  int
+	}
+	var links []prefixLink
+	for prefix, entries := range g.prefixes {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Call < entries[j].Call })
+		dir := siteFileName(prefix)
+		links = append(links, prefixLink{Prefix: prefix, Dir: dir, Count: len(entries)})
+		err := writeSitePage(filepath.Join(g.out, dir, "index.html"), "prefix", map[string]interface{}{
+			"Site": g.title, "Generated": g.generated, "Prefix": prefix, "Entries": entries,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Prefix < links[j].Prefix })
+	if err := os.MkdirAll(g.out, 0o755); err != nil {
+		return err
+	}
+	return writeSitePage(filepath.Join(g.out, "index.html"), "index", map[string]interface{}{
+		"Site": g.title, "Generated": g.generated, "Prefixes": links, "Total": g.pages,
+	})
+}
+
+// writeSitePage renders one of siteTemplates' pages to path
+func writeSitePage(path, name string, data interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := siteTemplates.ExecuteTemplate(f, name, data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// siteTemplates are the site's pages, with the stylesheet inline so each
+// page stands alone
+var siteTemplates = template.Must(template.New("site").Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<title>{{.}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 0; background: #f5f5f7; color: #1f2937; }
+header, main, footer { max-width: 48rem; margin: 0 auto; padding: 1rem; }
+header a { color: #4f46e5; text-decoration: none; font-weight: 600; }
+h1 { font-size: 2.5rem; margin: 0.5rem 0 0; letter-spacing: 0.05em; }
+.name { font-size: 1.25rem; color: #4b5563; margin: 0 0 1rem; }
+.card { background: #fff; border-radius: 0.5rem; box-shadow: 0 1px 3px rgba(0,0,0,.1); padding: 1rem; margin-bottom: 1rem; }
+dl { display: grid; grid-template-columns: max-content 1fr; gap: 0.4rem 1.5rem; margin: 0; }
+dt { color: #6b7280; }
+dd { margin: 0; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 0.3rem 0.5rem; border-bottom: 1px solid #e5e7eb; }
+iframe { width: 100%; height: 300px; border: 0; border-radius: 0.5rem; }
+ul.prefixes { list-style: none; padding: 0; display: flex; flex-wrap: wrap; gap: 0.5rem; }
+ul.prefixes a { display: block; background: #fff; padding: 0.4rem 0.7rem; border-radius: 0.3rem; color: #4f46e5; text-decoration: none; }
+footer { color: #6b7280; font-size: 0.85rem; }
+</style>
+</head>
+<body>
+{{end}}
+
+{{define "foot"}}<footer>Generated {{.}} by hamqrzdb.</footer>
+</body>
+</html>
+{{end}}
+
+{{define "profile"}}{{template "head" (print .Call " - " .Site)}}
+<header><a href="../index.html">{{.Site}}</a></header>
+<main>
+<h1>{{.Call}}</h1>
+<p class="name">{{.Name}}</p>
+<div class="card"><dl>
+{{with .Class}}<dt>Class</dt><dd>{{.}}</dd>{{end}}
+{{with .Status}}<dt>Status</dt><dd>{{.}}</dd>{{end}}
+{{with .Expires}}<dt>Expires</dt><dd>{{.}}</dd>{{end}}
+{{with .LicensedSince}}<dt>Licensed since</dt><dd>{{.}}</dd>{{end}}
+{{with .Street}}<dt>Address</dt><dd>{{.}}</dd>{{end}}
+{{with .Location}}<dt>Location</dt><dd>{{.}}</dd>{{end}}
+{{with .Country}}<dt>Country</dt><dd>{{.}}</dd>{{end}}
+{{with .Grid}}<dt>Grid square</dt><dd>{{.}}</dd>{{end}}
+</dl></div>
+{{if .MapEmbed}}<div class="card">
+<iframe src="{{.MapEmbed}}" title="Map of grid square {{.Grid}}" loading="lazy"></iframe>
+<p><a href="{{.MapLink}}">View larger map</a></p>
+</div>{{end}}
+{{if .History}}<div class="card">
+<h2>History</h2>
+<table>
+<tr><th>Date</th><th>Change</th><th>From</th><th>To</th></tr>
+{{range .History}}<tr><td>{{.Date}}</td><td>{{.What}}</td><td>{{.From}}</td><td>{{.To}}</td></tr>
+{{end}}</table>
+</div>{{end}}
+</main>
+{{template "foot" .Generated}}{{end}}
+
+{{define "prefix"}}{{template "head" (print .Prefix " - " .Site)}}
+<header><a href="../index.html">{{.Site}}</a></header>
+<main>
+<h1>{{.Prefix}}</h1>
+<div class="card"><table>
+{{range .Entries}}<tr><td><a href="{{.File}}.html">{{.Call}}</a></td><td>{{.Name}}</td><td>{{.Location}}</td></tr>
+{{end}}</table></div>
+</main>
+{{template "foot" .Generated}}{{end}}
+
+{{define "index"}}{{template "head" .Site}}
+<main>
+<h1>{{.Site}}</h1>
+<p class="name">{{.Total}} callsigns</p>
+<ul class="prefixes">
+{{range .Prefixes}}<li><a href="{{.Dir}}/index.html">{{.Prefix}}</a> {{.Count}}</li>
+{{end}}</ul>
+</main>
+{{template "foot" .Generated}}{{end}}
+`))
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// oneByOne matches US 1x1 special event callsigns, e.g. K5A or W1X
+var oneByOne = regexp.MustCompile(`^[KNW][0-9][A-Z]$`)
+
+// eventAliases maps each special_events field to the header names used by
+// 1x1 coordinator exports (matched case-insensitively)
+var eventAliases = map[string][]string{
+	"callsign":    {"call sign", "callsign", "call", "1x1 call sign", "1x1 callsign", "special event call sign"},
+	"start":       {"start date", "start", "event start", "begin date", "from"},
+	"end":         {"end date", "end", "event end", "to"},
+	"event":       {"event name", "event", "event title", "name of event", "description"},
+	"trustee":     {"trustee", "trustee call sign", "trustee callsign", "requestor", "requestor call sign", "requested by", "applicant call sign"},
+	"coordinator": {"coordinator", "coordinator name", "coordinated by", "vec"},
+	"city":        {"city", "location", "event city"},
+	"state":       {"state", "event state"},
+}
+
+// eventDateLayouts are the date formats accepted in 1x1 exports
+var eventDateLayouts = []string{
+	"2006-01-02", "01/02/2006", "1/2/2006", "01/02/06", "1/2/06",
+	"Jan 2, 2006", "January 2, 2006", "2-Jan-2006", "02-Jan-2006",
+}
+
+// runImport1x1 implements `hamqrzdb import-1x1`
+func runImport1x1(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import-1x1", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	urlFlag := fs.String("url", os.Getenv("ONEXONE_URL"), "URL of a 1x1 special event CSV export (env ONEXONE_URL)")
+	proxyFlag := fs.String("proxy", "", "Proxy for downloads (http://, socks5://); defaults to HTTP_PROXY/HTTPS_PROXY")
+	replaceFlag := fs.Bool("replace", true, "Replace all special events with the imported data")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb import-1x1 [flags] [events.csv]")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 && *urlFlag == "" {
+		fs.Usage()
+		return fmt.Errorf("a CSV file or -url is required")
+	}
+	r, err := openInput(ctx, fs.Arg(0), *urlFlag, *proxyFlag)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	db, err := sql.Open("sqlite3", *dbFlag+"?_busy_timeout=30000&_journal_mode=WAL")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := schema.Ensure(ctx, db); err != nil {
+		return err
+	}
+
+	count, err := importEvents(ctx, db, r, *replaceFlag)
+	if err != nil {
+		return err
+	}
+	log.Printf("Import complete: %d special events", count)
+	return nil
+}
+
+// importEvents loads a 1x1 CSV into special_events in one transaction
+func importEvents(ctx context.Context, db *sql.DB, r io.Reader, replace bool) (int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read header: %w", err)
+	}
+	columns := headerColumns(header, eventAliases)
+	for _, required := range []string{"callsign", "start"} {
+		if _, ok := columns[required]; !ok {
+			return 0, fmt.Errorf("no %s column in header (tried %s)", required, strings.Join(eventAliases[required], ", "))
+		}
+	}
+
+	field := func(row []string, name string) string {
+		return csvField(columns, row, name)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM special_events"); err != nil {
+			return 0, err
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO special_events (callsign, start_date, end_date, event_name, trustee, coordinator, city, state, last_updated)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(callsign, start_date) DO UPDATE SET
+			end_date = excluded.end_date,
+			event_name = CASE WHEN excluded.event_name != '' THEN excluded.event_name ELSE special_events.event_name END,
+			trustee = CASE WHEN excluded.trustee != '' THEN excluded.trustee ELSE special_events.trustee END,
+			coordinator = CASE WHEN excluded.coordinator != '' THEN excluded.coordinator ELSE special_events.coordinator END,
+			city = CASE WHEN excluded.city != '' THEN excluded.city ELSE special_events.city END,
+			state = CASE WHEN excluded.state != '' THEN excluded.state ELSE special_events.state END,
+			last_updated = CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	count, skipped := 0, 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Warning: CSV parse error (row skipped): %v", err)
+			skipped++
+			continue
+		}
+
+		call := strings.ToUpper(field(row, "callsign"))
+		start := eventDate(field(row, "start"))
+		if !oneByOne.MatchString(call) || start == "" {
+			skipped++
+			continue
+		}
+		end := eventDate(field(row, "end"))
+		if end == "" {
+			end = start
+		}
+
+		if _, err := stmt.ExecContext(ctx, call, start, end, field(row, "event"),
+			strings.ToUpper(field(row, "trustee")), field(row, "coordinator"),
+			field(row, "city"), strings.ToUpper(field(row, "state"))); err != nil {
+			return 0, fmt.Errorf("failed to insert %s: %w", call, err)
+		}
+		count++
+	}
+
+	// Like batch pruning, never let an empty or broken export wipe the table
+	if replace && count == 0 {
+		return 0, fmt.Errorf("no valid special events found; refusing to replace existing data")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d rows without a valid 1x1 callsign or start date", skipped)
+	}
+	return count, nil
+}
+
+// eventDate parses a 1x1 export date and returns YYYY-MM-DD, or "" if it
+// isn't a recognized date
+func eventDate(value string) string {
+	for _, layout := range eventDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/batch"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+	"github.com/chriskacerguis/hamqrzdb/internal/shard"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// runImportCSV implements `hamqrzdb import-csv`
+func runImportCSV(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import-csv", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	mapFlag := fs.String("map", "", "YAML file mapping CSV columns to schema fields (required)")
+	replaceFlag := fs.Bool("replace", false, "Delete records of this data source missing from the imported files")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb import-csv -map config.yaml [flags] file.csv [file.csv ...]")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *mapFlag == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("a mapping file and at least one CSV file are required")
+	}
+
+	mapping, err := LoadCSVMapping(*mapFlag)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite3", *dbFlag+"?_busy_timeout=30000&_journal_mode=WAL")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := schema.Ensure(ctx, db); err != nil {
+		return err
+	}
+
+	b, err := batch.Start(ctx, db, mapping.DataSource, strings.Join(fs.Args(), ", "))
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, path := range fs.Args() {
+		count, err := importCSVFile(ctx, db, mapping, b, path)
+		if err != nil {
+			b.Finish(ctx, db, err)
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		log.Printf("Loaded %d %s records from %s", count, mapping.Country, path)
+		total += count
+	}
+	if err := b.Finish(ctx, db, nil); err != nil {
+		return err
+	}
+
+	if *replaceFlag {
+		if _, err := b.Prune(ctx, db); err != nil {
+			return err
+		}
+	}
+
+	// The API reads callsigns from the shards of a sharded database
+	if err := shard.Refresh(ctx, db, *dbFlag); err != nil {
+		return fmt.Errorf("failed to rebuild shards: %w", err)
+	}
+
+	log.Printf("Import complete: %d records", total)
+	return nil
+}
+
+// importCSVFile loads one CSV file in a single transaction
+func importCSVFile(ctx context.Context, db *sql.DB, m *CSVMapping, b *batch.Batch, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if m.Encoding != "" {
+		enc, err := htmlindex.Get(m.Encoding)
+		if err != nil {
+			return 0, fmt.Errorf("unsupported encoding %q", m.Encoding)
+		}
+		r = enc.NewDecoder().Reader(file)
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma = m.delimiter()
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	for i := 0; i < m.SkipRows; i++ {
+		if _, err := reader.Read(); err != nil {
+			return 0, fmt.Errorf("failed to skip row %d: %w", i+1, err)
+		}
+	}
+
+	// Resolve every mapped column to its index in the row
+	index := map[string]int{}
+	if m.hasHeader() {
+		header, err := reader.Read()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read header: %w", err)
+		}
+		for i, h := range header {
+			index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+		}
+	}
+
+	columns := map[string][]int{}
+	for field, col := range m.Columns {
+		for _, name := range col {
+			i, ok := index[strings.ToLower(strings.TrimSpace(name))]
+			if !m.hasHeader() {
+				n, _ := strconv.Atoi(name)
+				i, ok = n-1, true
+			}
+			if !ok {
+				return 0, fmt.Errorf("column %q for %s not found in header", name, field)
+			}
+			columns[field] = append(columns[field], i)
+		}
+	}
+
+	fields := m.outputFields()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, upsertSQL(fields))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	count := 0
+	skipped := 0
+	values := make([]interface{}, 0, len(fields)+5)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Warning: CSV parse error (row skipped): %v", err)
+			skipped++
+			continue
+		}
+
+		get := func(field string) string {
+			var parts []string
+			for _, i := range columns[field] {
+				if i < len(row) {
+					if v := strings.TrimSpace(row[i]); v != "" {
+						parts = append(parts, v)
+					}
+				}
+			}
+			return strings.Join(parts, " ")
+		}
+
+		callsign := strings.ToUpper(get("callsign"))
+		if callsign == "" {
+			continue
+		}
+
+		record := map[string]string{}
+		for field := range m.Columns {
+			record[field] = get(field)
+		}
+		if name := record["name"]; name != "" {
+			first, last := splitFullName(name)
+			if _, ok := m.Columns["first_name"]; !ok {
+				record["first_name"] = first
+			}
+			if _, ok := m.Columns["last_name"]; !ok {
+				record["last_name"] = last
+			}
+			if _, ok := m.Columns["entity_name"]; !ok {
+				record["entity_name"] = name
+			}
+		}
+		if v, ok := record["license_status"]; ok && v != "" {
+			record["license_status"] = m.mapStatus(v)
+		}
+		for field, def := range m.Defaults {
+			if record[field] == "" {
+				record[field] = def
+			}
+		}
+
+		values = append(values[:0], callsign)
+		for _, field := range fields {
+			v := record[field]
+			if dateFields[field] {
+				v = m.normalizeDate(v)
+			}
+			if (field == "latitude" || field == "longitude") && v == "" {
+				values = append(values, nil)
+				continue
+			}
+			values = append(values, v)
+		}
+		values = append(values, m.RadioServiceCode, m.Country, b.Source, b.ID)
+
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			log.Printf("Error inserting record for %s: %v", callsign, err)
+			continue
+		}
+
+		count++
+		if count%10000 == 0 {
+			log.Printf("  Loaded %d records...", count)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return count, err
+	}
+
+	if skipped > 0 {
+		log.Printf("Skipped %d records due to parse errors", skipped)
+	}
+	return count, nil
+}
+
+// outputFields lists the callsigns columns written for each row, other than
+// callsign and the fixed source columns, in a stable order.
+func (m *CSVMapping) outputFields() []string {
+	set := map[string]bool{}
+	for field := range m.Columns {
+		set[field] = true
+	}
+	for field := range m.Defaults {
+		set[field] = true
+	}
+	if set["name"] {
+		delete(set, "name")
+		set["first_name"] = true
+		set["last_name"] = true
+		set["entity_name"] = true
+	}
+	delete(set, "callsign")
+
+	fields := make([]string, 0, len(set))
+	for field := range set {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// upsertSQL builds the insert for fields. Like the bundled importers, empty
+// values never overwrite data already loaded for a callsign.
+func upsertSQL(fields []string) string {
+	var b strings.Builder
+	b.WriteString("INSERT INTO callsigns (callsign")
+	for _, f := range fields {
+		b.WriteString(", " + f)
+	}
+	b.WriteString(", radio_service_code, country, data_source, import_batch, last_updated) VALUES (?")
+	b.WriteString(strings.Repeat(", ?", len(fields)+4))
+	b.WriteString(", CURRENT_TIMESTAMP) ON CONFLICT(callsign, data_source) DO UPDATE SET country = excluded.country")
+	b.WriteString(", import_batch = excluded.import_batch")
+	for _, f := range append(fields, "radio_service_code") {
+		fmt.Fprintf(&b, ", %[1]s = CASE WHEN excluded.%[1]s != '' THEN excluded.%[1]s ELSE callsigns.%[1]s END", f)
+	}
+	b.WriteString(", last_updated = CURRENT_TIMESTAMP")
+	return b.String()
+}
+
+// splitFullName splits "Firstname Middle Surname" into first and last names
+func splitFullName(name string) (first, last string) {
+	fields := strings.Fields(name)
+	switch len(fields) {
+	case 0:
+		return "", ""
+	case 1:
+		return "", fields[0]
+	default:
+		return strings.Join(fields[:len(fields)-1], " "), fields[len(fields)-1]
+	}
+}
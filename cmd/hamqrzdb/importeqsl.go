@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/eqsl"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// runImportEQSL implements `hamqrzdb import-eqsl`
+func runImportEQSL(ctx context.Context, args []string) error {
+	defaultURL := os.Getenv("EQSL_AG_URL")
+	if defaultURL == "" {
+		defaultURL = eqsl.DefaultURL
+	}
+
+	fs := flag.NewFlagSet("import-eqsl", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	urlFlag := fs.String("url", defaultURL, "URL of the eQSL AG member list (env EQSL_AG_URL)")
+	proxyFlag := fs.String("proxy", "", "Proxy for downloads (http://, socks5://); defaults to HTTP_PROXY/HTTPS_PROXY")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb import-eqsl [flags] [AGMemberList.txt]")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	r, err := openInput(ctx, fs.Arg(0), *urlFlag, *proxyFlag)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	db, err := sql.Open("sqlite3", *dbFlag+"?_busy_timeout=30000&_journal_mode=WAL")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := schema.Ensure(ctx, db); err != nil {
+		return err
+	}
+
+	_, err = eqsl.Import(ctx, db, r)
+	return err
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/backup"
+	"github.com/chriskacerguis/hamqrzdb/internal/maintenance"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
+)
+
+// runInit implements `hamqrzdb init`: everything a new instance needs, in
+// one step, for use as a Docker init container
+func runInit(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	defaultDB := os.Getenv("DB_PATH")
+	if defaultDB == "" {
+		defaultDB = paths.DefaultDB("hamqrzdb.sqlite")
+	}
+	dbFlag := fs.String("db", defaultDB, "SQLite database path (env DB_PATH)")
+	forceFlag := fs.Bool("force", false, "Import even if the database already has callsigns")
+	backupFlag := fs.Bool("backup", true, "Upload a backup afterwards when BACKUP_S3_URL is set")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb init [flags] [-- importer flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	start := time.Now()
+	if dir := filepath.Dir(*dbFlag); dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	db, err := sql.Open("sqlite3", *dbFlag+"?_busy_timeout=30000")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	// Tables and indexes, so the import and the API find them in place
+	if err := schema.Ensure(ctx, db); err != nil {
+		return err
+	}
+
+	// Safe to run on every container start: a populated database is kept
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM callsigns").Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 && !*forceFlag {
+		log.Printf("%s already has %d callsigns; nothing to do (use -force to re-import)", *dbFlag, count)
+		return nil
+	}
+
+	// Download and load the full FCC database, including locations from LA.dat
+	importArgs := append([]string{"--full", "--db", *dbFlag}, fs.Args()...)
+	if err := runStep(ctx, "import", func(ctx context.Context) error {
+		return runImportUS(ctx, importArgs)
+	}); err != nil {
+		return err
+	}
+
+	// A full VACUUM also switches the new file to incremental auto_vacuum
+	if err := runStep(ctx, "optimize", func(ctx context.Context) error {
+		_, err := maintenance.Run(ctx, db, maintenance.Options{FullVacuum: true})
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := runStep(ctx, "verify", func(ctx context.Context) error {
+		report, err := maintenance.Verify(ctx, db, maintenance.VerifyOptions{Quick: true})
+		if err != nil {
+			return err
+		}
+		if !report.OK() {
+			return errors.New(strings.Join(report.Problems, "; "))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if *backupFlag {
+		cfg, err := backup.LoadConfig(os.Getenv)
+		if err != nil {
+			return err
+		}
+		if cfg.Enabled() {
+			if err := runStep(ctx, "backup", func(ctx context.Context) error {
+				_, err := backup.Upload(ctx, cfg, db)
+				return err
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Printf("Initialized %s in %s", *dbFlag, time.Since(start).Round(time.Second))
+	return nil
+}
+
+// runStep runs one init step in its own span, logging its duration
+func runStep(ctx context.Context, name string, fn func(context.Context) error) error {
+	log.Printf("==> %s", name)
+	start := time.Now()
+	if err := tracing.Run(ctx, "init "+name, fn); err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	log.Printf("==> %s done in %s", name, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// runImportUS runs the US importer, found next to this binary unless
+// IMPORT_US_BIN is set, with its output passed through
+func runImportUS(ctx context.Context, args []string) error {
+	bin := os.Getenv("IMPORT_US_BIN")
+	if bin == "" {
+		bin = paths.Sibling("hamqrzdb-import-us")
+	}
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	// The importer's spans join this run's trace
+	cmd.Env = os.Environ()
+	if tp := tracing.Traceparent(ctx); tp != "" {
+		cmd.Env = append(cmd.Env, "TRACEPARENT="+tp)
+	}
+	return cmd.Run()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	_ "github.com/chriskacerguis/hamqrzdb/internal/sqlite"
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
+)
+
+// command is a hamqrzdb subcommand
+type command struct {
+	name string
+	desc string
+	run  func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"init", "Create and fully populate a new database in one step", runInit},
+	{"serve", "Run the API server, or install it as a Windows service", runServe},
+	{"maintain", "Optimize, analyze, vacuum, and checkpoint the database", runMaintain},
+	{"verify", "Check integrity, schema version, and row counts", runVerify},
+	{"import-csv", "Import an arbitrary licence CSV using a YAML column mapping", runImportCSV},
+	{"import-1x1", "Import 1x1 special event callsigns from a coordinator CSV", runImport1x1},
+	{"import-repeaters", "Import a repeater directory export (e.g. RepeaterBook)", runImportRepeaters},
+	{"import-eqsl", "Import the eQSL Authenticity Guaranteed member list", runImportEQSL},
+	{"import-memberships", "Import a club roster (SKCC, FISTS, POTA, ...) of member numbers", runImportMemberships},
+	{"import-references", "Import POTA, SOTA, or IOTA activations for lookup badges", runImportReferences},
+	{"import-exams", "Import a VEC's posted exam session schedule (ARRL, W5YI, ...)", runImportExams},
+	{"export-aprs", "Export licensees' locations as APRS object reports", runExportAPRS},
+	{"dxcluster", "Relay a DX cluster feed with spotted stations' licence details", runDXCluster},
+	{"winlink", "Answer callsign lookups sent by email, e.g. from Winlink over HF", runWinlink},
+	{"gen-site", "Write a static HTML profile page per callsign for a lightweight site", runGenSite},
+	{"backup", "Upload a snapshot of the database to BACKUP_S3_URL", runBackup},
+	{"restore", "Download the latest backup from BACKUP_S3_URL", runRestore},
+	{"bundle", "Write a trimmed database of a few states for offline use", runBundle},
+	{"bundle-diff", "Write the changes between two bundles as a small delta file", runBundleDiff},
+	{"bundle-apply", "Update a bundle with delta files from bundle-diff", runBundleApply},
+	{"shard", "Split the callsign tables across files by callsign first character", runShard},
+	{"report", "List upgrades, cancelled licenses, or the next sequential callsigns", runReport},
+	{"bench", "Load test a running API and report lookup latency", runBench},
+	{"audit", "Compare a sample of records with HamDB or Callook, field by field", runAudit},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: hamqrzdb <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.desc)
+	}
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Run 'hamqrzdb <command> -h' for command flags.")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	name := os.Args[1]
+	if name == "-h" || name == "--help" || name == "help" {
+		usage()
+		return
+	}
+
+	// Cancelled on SIGINT/SIGTERM so long-running commands stop cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, c := range commands {
+		if c.name == name {
+			ctx, endTrace, err := tracing.StartProcess(ctx, "hamqrzdb", "hamqrzdb "+c.name, tracing.String("command", c.name))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid tracing configuration: %v\n", err)
+				os.Exit(1)
+			}
+			err = c.run(ctx, os.Args[2:])
+			endTrace(err)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: unknown command %q\n\n", name)
+	usage()
+	os.Exit(1)
+}
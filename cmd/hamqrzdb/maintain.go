@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/maintenance"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+)
+
+// runMaintain implements `hamqrzdb maintain`
+func runMaintain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("maintain", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	fullFlag := fs.Bool("full-vacuum", false, "Rebuild the whole file with VACUUM (also enables incremental auto_vacuum)")
+	fs.Parse(args)
+
+	if _, err := os.Stat(*dbFlag); err != nil {
+		return fmt.Errorf("database not found: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", *dbFlag+"?_busy_timeout=30000")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	log.Printf("Maintaining %s...", *dbFlag)
+	start := time.Now()
+
+	report, err := maintenance.Run(ctx, db, maintenance.Options{FullVacuum: *fullFlag})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Maintenance complete in %s", time.Since(start).Round(time.Millisecond))
+	log.Printf("Free pages: %d -> %d (reclaimed %.1f MB)",
+		report.FreePagesStart, report.FreePagesEnd, float64(report.ReclaimedBytes())/1024/1024)
+	return nil
+}
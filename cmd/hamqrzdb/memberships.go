@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/callsign"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// membershipList describes the roster export of a club or award program.
+// Rosters of organizations not listed here are read with the generic
+// aliases, or with -callsign-column/-number-column.
+type membershipList struct {
+	// Organization is the name stored with (and returned for) each member
+	Organization string
+	// URLEnv names the environment variable holding the roster's URL
+	URLEnv string
+	// Aliases are tried before the generic membershipAliases
+	Aliases map[string][]string
+}
+
+// membershipLists are the known roster formats, keyed by -org (lower case)
+var membershipLists = map[string]membershipList{
+	"skcc": {
+		Organization: "SKCC",
+		URLEnv:       "SKCC_ROSTER_URL",
+		Aliases: map[string][]string{
+			"number": {"mbr #", "mbr#", "skcc #", "skcc#", "skcc nr"},
+			"since":  {"join date", "date"},
+		},
+	},
+	"fists": {
+		Organization: "FISTS",
+		URLEnv:       "FISTS_ROSTER_URL",
+		Aliases: map[string][]string{
+			"number": {"fists #", "fists#", "fists nr", "fists number"},
+		},
+	},
+	"pota": {
+		Organization: "POTA",
+		URLEnv:       "POTA_USERS_URL",
+		Aliases: map[string][]string{
+			"number": {"user id", "userid", "pota id"},
+		},
+	},
+}
+
+// membershipAliases maps each memberships field to the header names used by
+// club rosters (matched case-insensitively)
+var membershipAliases = map[string][]string{
+	"callsign": {"callsign", "call sign", "call"},
+	"number":   {"number", "member number", "member #", "member#", "member no", "nr", "id"},
+	"name":     {"name", "member name", "full name"},
+	"since":    {"joined", "join date", "member since", "since", "date"},
+}
+
+// runImportMemberships implements `hamqrzdb import-memberships`
+func runImportMemberships(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import-memberships", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	orgFlag := fs.String("org", "", "Organization the roster belongs to ("+knownMembershipLists()+", or any club name)")
+	urlFlag := fs.String("url", "", "URL of the roster CSV (defaults to the organization's environment variable)")
+	proxyFlag := fs.String("proxy", "", "Proxy for downloads (http://, socks5://); defaults to HTTP_PROXY/HTTPS_PROXY")
+	callFlag := fs.String("callsign-column", "", "Header of the callsign column, if not recognized")
+	numberFlag := fs.String("number-column", "", "Header of the member number column, if not recognized")
+	replaceFlag := fs.Bool("replace", true, "Replace the organization's members with the imported roster")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb import-memberships -org NAME [flags] [roster.csv]")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if strings.TrimSpace(*orgFlag) == "" {
+		fs.Usage()
+		return fmt.Errorf("-org is required")
+	}
+	list, ok := membershipLists[strings.ToLower(*orgFlag)]
+	if !ok {
+		list = membershipList{Organization: strings.TrimSpace(*orgFlag)}
+	}
+
+	url := *urlFlag
+	if url == "" && list.URLEnv != "" {
+		url = os.Getenv(list.URLEnv)
+	}
+	if fs.NArg() == 0 && url == "" {
+		fs.Usage()
+		return fmt.Errorf("a CSV file or -url is required")
+	}
+
+	// Explicit column names take precedence over every alias
+	aliases := map[string][]string{}
+	for field, names := range membershipAliases {
+		aliases[field] = append(append([]string{}, list.Aliases[field]...), names...)
+	}
+	if *callFlag != "" {
+		aliases["callsign"] = []string{strings.ToLower(*callFlag)}
+	}
+	if *numberFlag != "" {
+		aliases["number"] = []string{strings.ToLower(*numberFlag)}
+	}
+
+	r, err := openInput(ctx, fs.Arg(0), url, *proxyFlag)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	db, err := sql.Open("sqlite3", *dbFlag+"?_busy_timeout=30000&_journal_mode=WAL")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := schema.Ensure(ctx, db); err != nil {
+		return err
+	}
+
+	count, err := importMemberships(ctx, db, r, list.Organization, aliases, *replaceFlag)
+	if err != nil {
+		return err
+	}
+	log.Printf("Import complete: %d %s members", count, list.Organization)
+	return nil
+}
+
+// knownMembershipLists returns the -org values with a built-in roster format
+func knownMembershipLists() string {
+	names := make([]string, 0, len(membershipLists))
+	for name := range membershipLists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// importMemberships loads a roster CSV into the memberships table in one
+// transaction
+func importMemberships(ctx context.Context, db *sql.DB, r io.Reader, org string, aliases map[string][]string, replace bool) (int, error) {
+	// Skip a byte order mark so it isn't read as part of a quoted header
+	br := bufio.NewReader(r)
+	if bom, _ := br.Peek(3); string(bom) == "\ufeff" {
+		br.Discard(3)
+	}
+
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read header: %w", err)
+	}
+	columns := headerColumns(header, aliases)
+	for _, required := range []string{"callsign", "number"} {
+		if _, ok := columns[required]; !ok {
+			return 0, fmt.Errorf("no %s column in header (tried %s)", required, strings.Join(aliases[required], ", "))
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM memberships WHERE organization = ?", org); err != nil {
+			return 0, err
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO memberships (organization, callsign, number, name, since, last_updated)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(organization, callsign) DO UPDATE SET
+			number = excluded.number,
+			name = excluded.name,
+			since = excluded.since,
+			last_updated = CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	count, skipped := 0, 0
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		call := callsign.Base(csvField(columns, row, "callsign"))
+		number := csvField(columns, row, "number")
+		if call == "" || number == "" {
+			skipped++
+			continue
+		}
+
+		if _, err := stmt.ExecContext(ctx, org, call, number,
+			csvField(columns, row, "name"), csvField(columns, row, "since")); err != nil {
+			return 0, fmt.Errorf("failed to insert %s: %w", call, err)
+		}
+		count++
+	}
+
+	// Like batch pruning, never let an empty or broken roster wipe the table
+	if replace && count == 0 {
+		return 0, fmt.Errorf("no valid members found; refusing to replace existing data")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d rows without a callsign or member number", skipped)
+	}
+	return count, nil
+}
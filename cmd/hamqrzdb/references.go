@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/callsign"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// programReference is a callsign's activity at one reference of an awards
+// program, e.g. a POTA park activated, a SOTA summit, or an IOTA island
+type programReference struct {
+	Callsign  string
+	Reference string
+	Name      string
+	// Activations counts toward the callsign's total for the reference; a
+	// dataset with one row per activation leaves it at 1
+	Activations int
+	// LastActivity is the most recent activation (YYYY-MM-DD), if known
+	LastActivity string
+}
+
+// referenceImporter reads one program's dataset. Programs are added by
+// implementing it and listing the importer in referenceImporters; the table,
+// replace semantics, and lookup badges are shared.
+type referenceImporter interface {
+	// Program is the name stored with each reference, e.g. POTA
+	Program() string
+	// URLEnv names the environment variable holding the dataset's URL
+	URLEnv() string
+	// Read calls emit for every reference in r, and returns the number of
+	// rows it skipped as invalid
+	Read(r io.Reader, emit func(programReference) error) (skipped int, err error)
+}
+
+// referenceImporters are the known programs, keyed by -program (lower case)
+var referenceImporters = map[string]referenceImporter{
+	"pota": csvReferences{
+		program: "POTA",
+		urlEnv:  "POTA_ACTIVATIONS_URL",
+		pattern: regexp.MustCompile(`^[A-Z0-9]{1,4}-[0-9]{4,5}$`),
+		aliases: map[string][]string{
+			"reference": {"reference", "park", "park reference", "ref"},
+			"name":      {"park name", "name"},
+		},
+	},
+	"sota": csvReferences{
+		program: "SOTA",
+		urlEnv:  "SOTA_ACTIVATIONS_URL",
+		pattern: regexp.MustCompile(`^[A-Z0-9]{1,4}/[A-Z0-9]{2}-[0-9]{3}$`),
+		aliases: map[string][]string{
+			"reference": {"summitcode", "summit code", "summit", "reference", "ref"},
+			"name":      {"summitname", "summit name", "name"},
+		},
+	},
+	"iota": csvReferences{
+		program: "IOTA",
+		urlEnv:  "IOTA_OPERATIONS_URL",
+		pattern: regexp.MustCompile(`^(AF|AN|AS|EU|NA|OC|SA)-[0-9]{3}$`),
+		aliases: map[string][]string{
+			"reference": {"iota", "iota ref", "iota reference", "reference", "ref"},
+			"name":      {"island", "island name", "group name", "name"},
+		},
+	},
+}
+
+// referenceAliases maps the fields every program's CSV shares to the header
+// names used by activation exports (matched case-insensitively)
+var referenceAliases = map[string][]string{
+	"callsign":    {"activator", "callsign", "call sign", "call", "operator"},
+	"activations": {"activations", "activation count", "count"},
+	"date":        {"last activation", "last activity", "activation date", "activationdate", "date", "qso_date"},
+}
+
+// referenceDateLayouts are the date formats accepted in activation exports,
+// besides those of 1x1 exports
+var referenceDateLayouts = []string{"20060102", "2006-01-02T15:04:05Z07:00", "2006-01-02 15:04:05"}
+
+// csvReferences reads a program's activations from a CSV with a callsign
+// and reference column, either one row per activation or one per callsign
+// and reference with an activations count
+type csvReferences struct {
+	program string
+	urlEnv  string
+	// pattern matches the program's reference format, after upper-casing
+	pattern *regexp.Regexp
+	// aliases map the program's own fields, reference and name, to header
+	// names
+	aliases map[string][]string
+}
+
+func (c csvReferences) Program() string { return c.program }
+func (c csvReferences) URLEnv() string  { return c.urlEnv }
+
+func (c csvReferences) Read(r io.Reader, emit func(programReference) error) (int, error) {
+	// Skip a byte order mark so it isn't read as part of a quoted header
+	br := bufio.NewReader(r)
+	if bom, _ := br.Peek(3); string(bom) == "\ufeff" {
+		br.Discard(3)
+	}
+
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read header: %w", err)
+	}
+	aliases := map[string][]string{}
+	for field, names := range referenceAliases {
+		aliases[field] = names
+	}
+	for field, names := range c.aliases {
+		aliases[field] = names
+	}
+	columns := headerColumns(header, aliases)
+	for _, required := range []string{"callsign", "reference"} {
+		if _, ok := columns[required]; !ok {
+			return 0, fmt.Errorf("no %s column in header (tried %s)", required, strings.Join(aliases[required], ", "))
+		}
+	}
+
+	skipped := 0
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return skipped, nil
+		}
+		if err != nil {
+			return skipped, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		ref := programReference{
+			Callsign:     callsign.Base(csvField(columns, row, "callsign")),
+			Reference:    strings.ToUpper(csvField(columns, row, "reference")),
+			Name:         csvField(columns, row, "name"),
+			Activations:  1,
+			LastActivity: referenceDate(csvField(columns, row, "date")),
+		}
+		if v := csvField(columns, row, "activations"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				skipped++
+				continue
+			}
+			ref.Activations = n
+		}
+		if ref.Callsign == "" || !c.pattern.MatchString(ref.Reference) {
+			skipped++
+			continue
+		}
+		if err := emit(ref); err != nil {
+			return skipped, err
+		}
+	}
+}
+
+// referenceDate parses an activation date and returns YYYY-MM-DD, or "" if
+// it isn't a recognized date
+func referenceDate(value string) string {
+	for _, layout := range referenceDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+	return eventDate(value)
+}
+
+// runImportReferences implements `hamqrzdb import-references`
+func runImportReferences(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import-references", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	programFlag := fs.String("program", "", "Awards program of the dataset ("+knownReferencePrograms()+")")
+	urlFlag := fs.String("url", "", "URL of the dataset (defaults to the program's environment variable)")
+	proxyFlag := fs.String("proxy", "", "Proxy for downloads (http://, socks5://); defaults to HTTP_PROXY/HTTPS_PROXY")
+	replaceFlag := fs.Bool("replace", true, "Replace the program's references with the imported dataset")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb import-references -program NAME [flags] [activations.csv]")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	importer, ok := referenceImporters[strings.ToLower(*programFlag)]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("-program must be one of %s", knownReferencePrograms())
+	}
+
+	url := *urlFlag
+	if url == "" {
+		url = os.Getenv(importer.URLEnv())
+	}
+	if fs.NArg() == 0 && url == "" {
+		fs.Usage()
+		return fmt.Errorf("a dataset file, -url, or %s is required", importer.URLEnv())
+	}
+
+	r, err := openInput(ctx, fs.Arg(0), url, *proxyFlag)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	db, err := sql.Open("sqlite3", *dbFlag+"?_busy_timeout=30000&_journal_mode=WAL")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := schema.Ensure(ctx, db); err != nil {
+		return err
+	}
+
+	count, err := importReferences(ctx, db, r, importer, *replaceFlag)
+	if err != nil {
+		return err
+	}
+	log.Printf("Import complete: %d %s rows", count, importer.Program())
+	return nil
+}
+
+// knownReferencePrograms returns the -program values
+func knownReferencePrograms() string {
+	names := make([]string, 0, len(referenceImporters))
+	for name := range referenceImporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// importReferences loads a program's dataset into the program_references
+// table in one transaction. Rows for the same callsign and reference add up
+// their activations and keep the latest activity.
+func importReferences(ctx context.Context, db *sql.DB, r io.Reader, importer referenceImporter, replace bool) (int, error) {
+	program := importer.Program()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM program_references WHERE program = ?", program); err != nil {
+			return 0, err
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO program_references (program, callsign, reference, name, activations, last_activity, last_updated)
+		VALUES (?, ?, ?, NULLIF(?, ''), ?, NULLIF(?, ''), CURRENT_TIMESTAMP)
+		ON CONFLICT(program, callsign, reference) DO UPDATE SET
+			name = COALESCE(excluded.name, name),
+			activations = activations + excluded.activations,
+			last_activity = NULLIF(MAX(COALESCE(last_activity, ''), COALESCE(excluded.last_activity, '')), ''),
+			last_updated = CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	count := 0
+	skipped, err := importer.Read(r, func(ref programReference) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, program, ref.Callsign, ref.Reference, ref.Name,
+			ref.Activations, ref.LastActivity); err != nil {
+			return fmt.Errorf("failed to insert %s at %s: %w", ref.Callsign, ref.Reference, err)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Like batch pruning, never let an empty or broken dataset wipe the table
+	if replace && count == 0 {
+		return 0, fmt.Errorf("no valid references found; refusing to replace existing data")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d rows without a callsign or a valid %s reference", skipped, program)
+	}
+	return count, nil
+}
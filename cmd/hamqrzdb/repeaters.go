@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/callsign"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// repeaterAliases maps each repeaters field to the header names (or JSON keys)
+// used by repeater directory exports such as RepeaterBook (matched
+// case-insensitively)
+var repeaterAliases = map[string][]string{
+	"callsign":  {"callsign", "call sign", "call", "repeater call"},
+	"trustee":   {"trustee", "trustee call", "trustee callsign", "sponsor call"},
+	"frequency": {"frequency", "output freq", "output frequency", "output", "freq"},
+	"input":     {"input freq", "input frequency", "input"},
+	"offset":    {"offset"},
+	"tone":      {"pl", "uplink tone", "ctcss", "tone", "access tone", "pl/dcs"},
+	"mode":      {"mode", "modes", "emission"},
+	"access":    {"use", "access"},
+	"status":    {"operational status", "op status", "status"},
+	"city":      {"nearest city", "location", "city"},
+	"county":    {"county"},
+	"state":     {"state", "st/pr", "state/province", "province"},
+	"country":   {"country"},
+	"latitude":  {"lat", "latitude"},
+	"longitude": {"long", "lon", "lng", "longitude"},
+}
+
+// runImportRepeaters implements `hamqrzdb import-repeaters`
+func runImportRepeaters(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import-repeaters", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	urlFlag := fs.String("url", os.Getenv("REPEATERS_URL"), "URL of a repeater directory CSV or JSON export (env REPEATERS_URL)")
+	proxyFlag := fs.String("proxy", "", "Proxy for downloads (http://, socks5://); defaults to HTTP_PROXY/HTTPS_PROXY")
+	replaceFlag := fs.Bool("replace", true, "Replace all repeaters with the imported data")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb import-repeaters [flags] [repeaters.csv|repeaters.json]")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 && *urlFlag == "" {
+		fs.Usage()
+		return fmt.Errorf("a CSV or JSON file or -url is required")
+	}
+	r, err := openInput(ctx, fs.Arg(0), *urlFlag, *proxyFlag)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	db, err := sql.Open("sqlite3", *dbFlag+"?_busy_timeout=30000&_journal_mode=WAL")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := schema.Ensure(ctx, db); err != nil {
+		return err
+	}
+
+	count, err := importRepeaters(ctx, db, r, *replaceFlag)
+	if err != nil {
+		return err
+	}
+	log.Printf("Import complete: %d repeaters", count)
+	return nil
+}
+
+// repeaterRows returns the header and rows of a CSV export, or of a JSON
+// export ({"results": [...]} as returned by the RepeaterBook API, or a bare
+// array of objects) flattened to the same shape
+func repeaterRows(r io.Reader) ([]string, [][]string, error) {
+	br := bufio.NewReader(r)
+	start, _ := br.Peek(64)
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(start, []byte("\ufeff")), " \t\r\n")
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		reader := csv.NewReader(br)
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		reader.TrimLeadingSpace = true
+		header, err := reader.Read()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read header: %w", err)
+		}
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		return header, rows, nil
+	}
+
+	var objects []map[string]interface{}
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+	if trimmed[0] == '{' {
+		var wrapper struct {
+			Results []map[string]interface{} `json:"results"`
+		}
+		if err := dec.Decode(&wrapper); err != nil {
+			return nil, nil, fmt.Errorf("failed to read JSON: %w", err)
+		}
+		objects = wrapper.Results
+	} else if err := dec.Decode(&objects); err != nil {
+		return nil, nil, fmt.Errorf("failed to read JSON: %w", err)
+	}
+
+	keys := map[string]bool{}
+	for _, o := range objects {
+		for k := range o {
+			keys[k] = true
+		}
+	}
+	header := make([]string, 0, len(keys))
+	for k := range keys {
+		header = append(header, k)
+	}
+	sort.Strings(header)
+
+	rows := make([][]string, 0, len(objects))
+	for _, o := range objects {
+		row := make([]string, len(header))
+		for i, k := range header {
+			if v, ok := o[k]; ok && v != nil {
+				row[i] = fmt.Sprint(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return header, rows, nil
+}
+
+// importRepeaters loads a repeater export into the repeaters table in one
+// transaction
+func importRepeaters(ctx context.Context, db *sql.DB, r io.Reader, replace bool) (int, error) {
+	header, rows, err := repeaterRows(r)
+	if err != nil {
+		return 0, err
+	}
+	columns := headerColumns(header, repeaterAliases)
+	for _, required := range []string{"callsign", "frequency"} {
+		if _, ok := columns[required]; !ok {
+			return 0, fmt.Errorf("no %s column in header (tried %s)", required, strings.Join(repeaterAliases[required], ", "))
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM repeaters"); err != nil {
+			return 0, err
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO repeaters (callsign, trustee, frequency, input_frequency, tone, mode, access, status,
+			city, county, state, country, latitude, longitude, last_updated)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(callsign, frequency) DO UPDATE SET
+			trustee = excluded.trustee,
+			input_frequency = excluded.input_frequency,
+			tone = excluded.tone,
+			mode = excluded.mode,
+			access = excluded.access,
+			status = excluded.status,
+			city = excluded.city,
+			county = excluded.county,
+			state = excluded.state,
+			country = excluded.country,
+			latitude = excluded.latitude,
+			longitude = excluded.longitude,
+			last_updated = CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	count, skipped := 0, 0
+	for _, row := range rows {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		field := func(name string) string {
+			return csvField(columns, row, name)
+		}
+
+		// Repeater IDs often carry a /R suffix; the base call is the license
+		call := callsign.Base(field("callsign"))
+		freq, err := strconv.ParseFloat(field("frequency"), 64)
+		if call == "" || err != nil || freq <= 0 {
+			skipped++
+			continue
+		}
+
+		// Without a trustee column, the repeater's own call is the trustee's
+		trustee := callsign.Base(field("trustee"))
+		if trustee == "" {
+			trustee = call
+		}
+
+		var input interface{}
+		if v, err := strconv.ParseFloat(field("input"), 64); err == nil && v > 0 {
+			input = v
+		} else if off, err := strconv.ParseFloat(field("offset"), 64); err == nil {
+			input = math.Round((freq+off)*1e4) / 1e4
+		}
+
+		if _, err := stmt.ExecContext(ctx, call, trustee, freq, input,
+			field("tone"), field("mode"), field("access"), field("status"),
+			field("city"), field("county"), field("state"), field("country"),
+			coordinate(field("latitude")), coordinate(field("longitude"))); err != nil {
+			return 0, fmt.Errorf("failed to insert %s %.4f: %w", call, freq, err)
+		}
+		count++
+	}
+
+	// Like batch pruning, never let an empty or broken export wipe the table
+	if replace && count == 0 {
+		return 0, fmt.Errorf("no valid repeaters found; refusing to replace existing data")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d rows without a valid callsign or frequency", skipped)
+	}
+	return count, nil
+}
+
+// coordinate parses a decimal degree value, returning nil when it's missing
+// or invalid so the column stays NULL
+func coordinate(s string) interface{} {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v == 0 {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/redact"
+	"github.com/chriskacerguis/hamqrzdb/internal/report"
+)
+
+// runReport implements `hamqrzdb report upgrades|cancelled|sequential`
+func runReport(ctx context.Context, args []string) error {
+	if len(args) < 1 || (args[0] != "upgrades" && args[0] != "cancelled" && args[0] != "sequential") {
+		return fmt.Errorf("usage: hamqrzdb report <upgrades|cancelled|sequential> [flags]")
+	}
+	kind := args[0]
+
+	days := report.UpgradeDays
+	switch kind {
+	case "cancelled":
+		days = report.CancellationDays
+	case "sequential":
+		days = report.SequentialDays
+	}
+
+	fs := flag.NewFlagSet("report "+kind, flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	sinceFlag := fs.String("since", "", fmt.Sprintf("Start date, YYYY-MM-DD (default %d days ago)", days))
+	untilFlag := fs.String("until", "", "End date, YYYY-MM-DD (default today)")
+	stateFlag := fs.String("state", "", "Only include this state or region")
+	gridFlag := fs.String("grid", "", "Only include grid squares with this prefix, e.g. EM10")
+	limitFlag := fs.Int("limit", report.MaxLimit, "Maximum rows")
+	formatFlag := fs.String("format", "table", "Output format: table, csv, or json")
+	countFlag := fs.Int("count", 5, "Upcoming callsigns to list per region and group (sequential)")
+	fs.Parse(args[1:])
+
+	f := report.Filter{
+		Since: *sinceFlag,
+		Until: *untilFlag,
+		State: *stateFlag,
+		Grid:  *gridFlag,
+		Limit: *limitFlag,
+	}
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	f = f.WithDefaults(days)
+
+	if _, err := os.Stat(*dbFlag); err != nil {
+		return fmt.Errorf("database not found: %w", err)
+	}
+	db, err := sql.Open("sqlite3", *dbFlag+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	// Names are withheld as in the API (REDACT_NAMES)
+	redaction := redact.LoadConfig(os.Getenv)
+	var header []string
+	var rows [][]string
+	var data interface{}
+	switch kind {
+	case "upgrades":
+		upgrades, err := report.Upgrades(ctx, db, redaction, f)
+		if err != nil {
+			return err
+		}
+		data = upgrades
+		header = []string{"CALL", "NAME", "CITY", "STATE", "GRID", "FROM", "TO", "CHANGED"}
+		for _, u := range upgrades {
+			rows = append(rows, []string{u.Call, fullName(u.FName, u.Name), u.City, u.State, u.Grid, u.FromClass, u.ToClass, u.ChangedAt})
+		}
+	case "sequential":
+		forecasts, err := report.SequentialForecast(ctx, db, f, *countFlag)
+		if err != nil {
+			return err
+		}
+		data = forecasts
+		header = []string{"REGION", "GROUP", "LAST ISSUED", "ISSUED", "PER DAY", "NEXT"}
+		for _, fc := range forecasts {
+			rows = append(rows, []string{strconv.Itoa(fc.Region), fc.Group, fc.LastIssued, strconv.Itoa(fc.Issued),
+				strconv.FormatFloat(fc.PerDay, 'f', 2, 64), strings.Join(fc.Next, " ")})
+		}
+	case "cancelled":
+		cancellations, err := report.Cancellations(ctx, db, redaction, f)
+		if err != nil {
+			return err
+		}
+		data = cancellations
+		header = []string{"CALL", "NAME", "CITY", "STATE", "GRID", "STATUS", "DATE", "SOURCE"}
+		for _, c := range cancellations {
+			rows = append(rows, []string{c.Call, fullName(c.FName, c.Name), c.City, c.State, c.Grid, c.Status, c.Date, c.DataSource})
+		}
+	}
+
+	switch *formatFlag {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(map[string]interface{}{"since": f.Since, "until": f.Until, kind: data})
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write(header)
+		w.WriteAll(rows)
+		return w.Error()
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "%s\n", strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintf(w, "%s\n", strings.Join(row, "\t"))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%d %s from %s to %s\n", len(rows), kind, f.Since, f.Until)
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q (expected table, csv, or json)", *formatFlag)
+	}
+}
+
+// fullName joins a first and last name
+func fullName(first, last string) string {
+	if first == "" {
+		return last
+	}
+	if last == "" {
+		return first
+	}
+	return first + " " + last
+}
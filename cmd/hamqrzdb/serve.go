@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+)
+
+// runServe implements `hamqrzdb serve`: it runs the API server, found next
+// to this binary unless API_BIN is set, or manages its Windows service
+func runServe(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	dbFlag := fs.String("db", "", "SQLite database path (default env DB_PATH, or the API's default)")
+	formatFlag := fs.String("format-template", "", "Template file, or directory of <app>.<ext> templates, for /v1/{call}/custom/{app} (default env FORMAT_TEMPLATE)")
+	installFlag := fs.Bool("install-service", false, "Register the API as a Windows service that starts with the system, then exit")
+	uninstallFlag := fs.Bool("uninstall-service", false, "Remove the Windows service, then exit")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb serve [flags]")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Other settings are read from the environment, as by hamqrzdb-api.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var apiArgs []string
+	switch {
+	case *installFlag:
+		apiArgs = append(apiArgs, "--install-service")
+	case *uninstallFlag:
+		apiArgs = append(apiArgs, "--uninstall-service")
+	}
+
+	bin := os.Getenv("API_BIN")
+	if bin == "" {
+		bin = paths.Sibling("hamqrzdb-api")
+	}
+	cmd := exec.CommandContext(ctx, bin, apiArgs...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = os.Environ()
+	if *dbFlag != "" {
+		// The service records an absolute path, whatever directory it runs in
+		dbPath, err := filepath.Abs(*dbFlag)
+		if err != nil {
+			return err
+		}
+		cmd.Env = append(cmd.Env, "DB_PATH="+dbPath)
+	}
+	if *formatFlag != "" {
+		formatPath, err := filepath.Abs(*formatFlag)
+		if err != nil {
+			return err
+		}
+		cmd.Env = append(cmd.Env, "FORMAT_TEMPLATE="+formatPath)
+	}
+	// Let the server drain requests on Ctrl+C rather than killing it
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = 15 * time.Second
+	return cmd.Run()
+}
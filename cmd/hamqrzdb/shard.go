@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/shard"
+)
+
+// runShard implements `hamqrzdb shard`
+func runShard(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("shard", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	shardsFlag := fs.Int("shards", 0, fmt.Sprintf("Number of shard files (2-%d); 1 removes sharding; default rebuilds the current layout", shard.MaxShards))
+	fs.Parse(args)
+
+	if _, err := os.Stat(*dbFlag); err != nil {
+		return fmt.Errorf("database not found: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", *dbFlag+"?_busy_timeout=30000")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	n := *shardsFlag
+	if n == 0 {
+		layout, err := shard.Layout(ctx, db)
+		if err != nil {
+			return err
+		}
+		if len(layout) == 0 {
+			return fmt.Errorf("%s isn't sharded; set -shards", *dbFlag)
+		}
+		n = len(layout)
+	}
+	if n < 1 || n > shard.MaxShards {
+		return fmt.Errorf("-shards must be between 1 and %d", shard.MaxShards)
+	}
+
+	start := time.Now()
+	shards, err := shard.Build(ctx, db, *dbFlag, n)
+	if err != nil {
+		return err
+	}
+	if len(shards) == 0 {
+		log.Printf("Removed sharding from %s", *dbFlag)
+		return nil
+	}
+	log.Printf("Sharded %s into %d files in %s", *dbFlag, len(shards), time.Since(start).Round(time.Millisecond))
+	return nil
+}
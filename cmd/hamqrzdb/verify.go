@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/maintenance"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// runVerify implements `hamqrzdb verify`
+func runVerify(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	quickFlag := fs.Bool("quick", false, "Use PRAGMA quick_check instead of a full integrity_check")
+	spotFlag := fs.String("spot", "W1AW", "Comma-separated callsigns that must be present (empty to skip)")
+	jsonFlag := fs.Bool("json", false, "Print the report as JSON")
+	fs.Parse(args)
+
+	if _, err := os.Stat(*dbFlag); err != nil {
+		return fmt.Errorf("database not found: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", *dbFlag+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	var spot []string
+	if *spotFlag != "" {
+		spot = strings.Split(*spotFlag, ",")
+	}
+
+	report, err := maintenance.Verify(ctx, db, maintenance.VerifyOptions{Quick: *quickFlag, SpotCheck: spot})
+	if err != nil {
+		return err
+	}
+
+	if *jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("Database: %s", *dbFlag)
+		log.Printf("Integrity: %s", strings.Join(report.Integrity, "; "))
+		log.Printf("Schema version: %d (expected %d)", report.SchemaVersion, schema.Version)
+
+		countries := make([]string, 0, len(report.Counts))
+		for c := range report.Counts {
+			countries = append(countries, c)
+		}
+		sort.Strings(countries)
+		for _, c := range countries {
+			log.Printf("  %-16s %d callsigns", c, report.Counts[c])
+		}
+
+		for _, w := range report.Warnings {
+			log.Printf("Warning: %s", w)
+		}
+		for _, p := range report.Problems {
+			log.Printf("Problem: %s", p)
+		}
+	}
+
+	if !report.OK() {
+		return fmt.Errorf("verification failed with %d problem(s)", len(report.Problems))
+	}
+	if !*jsonFlag {
+		log.Println("Verification passed")
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/redact"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+	"github.com/chriskacerguis/hamqrzdb/internal/winlink"
+)
+
+// runWinlink implements `hamqrzdb winlink`
+func runWinlink(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("winlink", flag.ExitOnError)
+	dbFlag := fs.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
+	intervalFlag := fs.Duration("interval", 5*time.Minute, "How often to check the mailbox")
+	onceFlag := fs.Bool("once", false, "Answer the waiting messages and exit, e.g. from cron")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb winlink [flags]")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Answers callsign lookups sent to a mailbox. The mailbox is read with POP3_HOST,")
+		fmt.Fprintln(os.Stderr, "POP3_PORT, POP3_USERNAME, and POP3_PASSWORD, and replies are sent from")
+		fmt.Fprintln(os.Stderr, "WINLINK_FROM with SMTP_HOST, SMTP_PORT, SMTP_USERNAME, and SMTP_PASSWORD.")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *intervalFlag < time.Minute {
+		return fmt.Errorf("-interval must be at least 1m")
+	}
+	cfg, err := winlink.LoadConfig(os.Getenv)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(*dbFlag); err != nil {
+		return fmt.Errorf("database not found: %w", err)
+	}
+	db, err := sql.Open("sqlite3", *dbFlag+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	// Replies go to anyone who can send mail, so they withhold what the
+	// API does
+	redaction := redact.LoadConfig(os.Getenv)
+	responder := &winlink.Responder{
+		Config: cfg,
+		Lookup: func(ctx context.Context, call string) (*winlink.Record, error) {
+			return winlinkRecord(ctx, db, redaction, call)
+		},
+	}
+	poll := func() error {
+		stats, err := responder.Poll(ctx)
+		if stats.Replied+stats.Ignored+stats.Failed > 0 {
+			log.Printf("Answered %d lookup messages, ignored %d, %d failed", stats.Replied, stats.Ignored, stats.Failed)
+		}
+		return err
+	}
+	if *onceFlag {
+		return poll()
+	}
+
+	log.Printf("Checking %s@%s for lookups every %s", cfg.POP3Username, cfg.POP3Host, *intervalFlag)
+	ticker := time.NewTicker(*intervalFlag)
+	defer ticker.Stop()
+	for {
+		// A mail server outage shouldn't stop the responder
+		if err := poll(); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to check the mailbox: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// winlinkClasses names the FCC's operator class codes
+var winlinkClasses = map[string]string{
+	"N": "Novice",
+	"T": "Technician",
+	"P": "Technician Plus",
+	"G": "General",
+	"A": "Advanced",
+	"E": "Amateur Extra",
+}
+
+// winlinkStatuses names the licence status codes
+var winlinkStatuses = map[string]string{
+	"A": "Active",
+	"C": "Cancelled",
+	"E": "Expired",
+	"L": "Pending legal status",
+	"P": "Parent cancelled",
+	"T": "Terminated",
+	"X": "Termination pending",
+	"R": "Revoked",
+}
+
+// winlinkRecord returns the licence of call, preferring an active one, or
+// nil if the database has none. Names and addresses in redaction's scope
+// are left out, as in API lookups.
+func winlinkRecord(ctx context.Context, db *sql.DB, redaction redact.Config, call string) (*winlink.Record, error) {
+	hasCountry, err := schema.HasColumn(ctx, db, "callsigns", "country")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the schema: %w", err)
+	}
+	country := schema.CountryExpr(hasCountry)
+	address, name := redaction.Addresses.Column, redaction.Names.Column
+
+	var first, mi, last, suffix, entity, class, status, expires, street, city, state, zip, source string
+	var lat, lon sql.NullFloat64
+	rec := winlink.Record{Call: call}
+	err = db.QueryRowContext(ctx, `
+		SELECT COALESCE(`+name("first_name", country)+`, ''), COALESCE(`+name("mi", country)+`, ''),
+			COALESCE(`+name("last_name", country)+`, ''), COALESCE(`+name("suffix", country)+`, ''),
+			COALESCE(entity_name, ''), COALESCE(operator_class, ''), COALESCE(license_status, ''),
+			COALESCE(expired_date_iso, expired_date, ''), COALESCE(`+address("street_address", country)+`, ''),
+			COALESCE(city, ''), COALESCE(state, ''), COALESCE(zip_code, ''), COALESCE(grid_square, ''),
+			`+address("latitude", country)+`, `+address("longitude", country)+`,
+			data_source
+		FROM callsigns
+		WHERE callsign = ?
+		ORDER BY license_status = 'A' DESC, data_source
+		LIMIT 1
+	`, call).Scan(&first, &mi, &last, &suffix, &entity, &class, &status, &expires, &street, &city,
+		&state, &zip, &rec.Grid, &lat, &lon, &source)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", call, err)
+	}
+
+	rec.Name = strings.Join(strings.Fields(strings.Join([]string{first, mi, last, suffix}, " ")), " ")
+	if rec.Name == "" {
+		rec.Name = entity
+	}
+	rec.Class = class
+	if name, ok := winlinkClasses[class]; ok && (source == "FCC" || source == "") {
+		rec.Class = name
+	}
+	rec.Status = status
+	if name, ok := winlinkStatuses[status]; ok {
+		rec.Status = name
+	}
+	rec.Expires = expires
+	rec.Address = joinNonEmpty(", ", street, joinNonEmpty(" ", joinNonEmpty(", ", city, state), zip))
+	if lat.Valid && lon.Valid && !(lat.Float64 == 0 && lon.Float64 == 0) {
+		rec.Location = strconv.FormatFloat(lat.Float64, 'f', 4, 64) + ", " + strconv.FormatFloat(lon.Float64, 'f', 4, 64)
+	}
+	return &rec, nil
+}
+
+// joinNonEmpty joins the non-empty parts with sep
+func joinNonEmpty(sep string, parts ...string) string {
+	var out []string
+	for _, p := range parts {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, sep)
+}
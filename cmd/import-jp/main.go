@@ -0,0 +1,452 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/batch"
+	"github.com/chriskacerguis/hamqrzdb/internal/httpclient"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+	"github.com/chriskacerguis/hamqrzdb/internal/shard"
+	_ "github.com/chriskacerguis/hamqrzdb/internal/sqlite"
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+// The MIC (Ministry of Internal Affairs and Communications) radio station
+// search at https://www.tele.soumu.go.jp/ can export amateur stations as CSV.
+// Exports are Shift-JIS encoded and split by call area, so several files are
+// usually imported in one run.
+
+var (
+	dbFlag       = flag.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "Path to SQLite database")
+	urlFlag      = flag.String("url", os.Getenv("JP_DATA_URL"), "Comma-separated URLs of MIC CSV exports to download (env JP_DATA_URL)")
+	encodingFlag = flag.String("encoding", "shift_jis", "Input encoding: shift_jis or utf-8")
+	replaceFlag  = flag.Bool("replace", false, "Delete MIC records missing from this run (only when every call area is imported together)")
+	proxyFlag    = flag.String("proxy", "", "Proxy for downloads (http://, socks5://); defaults to HTTP_PROXY/HTTPS_PROXY")
+)
+
+// columnAliases maps schema fields to the header names MIC exports use
+var columnAliases = map[string][]string{
+	"callsign": {"識別信号", "呼出符号", "呼出名称", "callsign", "call sign"},
+	"name":     {"免許人名称", "免許人氏名又は名称", "免許人名", "名称", "name"},
+	"location": {"常置場所", "無線設備の設置場所", "設置場所", "location"},
+	"granted":  {"免許の年月日", "免許年月日", "grant date"},
+	"expires":  {"免許の有効期間", "有効期限", "expiry date"},
+}
+
+// eras maps Japanese imperial eras to the Gregorian year before their first year
+var eras = map[string]int{
+	"令和": 2018,
+	"平成": 1988,
+	"昭和": 1925,
+}
+
+var jpDate = regexp.MustCompile(`(令和|平成|昭和)?\s*(元|\d+)\s*[年/.-]\s*(\d+)\s*[月/.-]\s*(\d+)`)
+
+type Database struct {
+	db    *sql.DB
+	batch *batch.Batch // import batch records are tagged with
+}
+
+// NewDatabase creates a new database connection
+func NewDatabase(ctx context.Context, dbPath string) (*Database, error) {
+	log.Printf("Connecting to database: %s", dbPath)
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Optimize SQLite for bulk inserts
+	pragmas := []string{
+		"PRAGMA journal_mode=WAL",
+		"PRAGMA synchronous=NORMAL",
+		"PRAGMA cache_size=10000",
+		"PRAGMA temp_store=MEMORY",
+	}
+
+	for _, pragma := range pragmas {
+		if _, err := db.ExecContext(ctx, pragma); err != nil {
+			return nil, fmt.Errorf("failed to set pragma: %w", err)
+		}
+	}
+
+	if err := schema.Ensure(ctx, db); err != nil {
+		return nil, err
+	}
+
+	return &Database{db: db}, nil
+}
+
+func (d *Database) Close() error {
+	return d.db.Close()
+}
+
+// DownloadFile downloads a file from URL to filepath
+func DownloadFile(ctx context.Context, url, filepath string) error {
+	log.Printf("Downloading %s...", url)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	client, err := httpclient.New(*proxyFlag)
+	if err != nil {
+		return err
+	}
+	client.Timeout = 2 * time.Minute
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad status: %s (status code: %d)", resp.Status, resp.StatusCode)
+	}
+
+	out, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return err
+	}
+
+	log.Printf("Downloaded to %s", filepath)
+	return nil
+}
+
+// decodeReader wraps r so the CSV reader always sees UTF-8
+func decodeReader(r io.Reader, encoding string) (io.Reader, error) {
+	switch strings.ToLower(strings.ReplaceAll(encoding, "-", "_")) {
+	case "shift_jis", "sjis", "cp932":
+		return transform.NewReader(r, japanese.ShiftJIS.NewDecoder()), nil
+	case "utf_8", "utf8":
+		return r, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q (use shift_jis or utf-8)", encoding)
+	}
+}
+
+// mapColumns resolves each schema field to its column index in header
+func mapColumns(header []string) map[string]int {
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		h = strings.TrimPrefix(h, "\ufeff")
+		index[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+
+	columns := make(map[string]int)
+	for field, aliases := range columnAliases {
+		for _, alias := range aliases {
+			if i, ok := index[alias]; ok {
+				columns[field] = i
+				break
+			}
+		}
+	}
+	return columns
+}
+
+// normalizeDate converts MIC dates ("2029-03-31", "2029年3月31日まで",
+// "令和11年3月31日") to YYYY-MM-DD. Licence terms are given as a range, so the
+// last date in s is used. Unrecognized values are returned as-is.
+func normalizeDate(s string) string {
+	matches := jpDate.FindAllStringSubmatch(s, -1)
+	if matches == nil {
+		return strings.TrimSpace(s)
+	}
+	m := matches[len(matches)-1]
+
+	year := 1
+	if m[2] != "元" {
+		year, _ = strconv.Atoi(m[2])
+	}
+	if m[1] != "" {
+		year += eras[m[1]]
+	}
+	month, _ := strconv.Atoi(m[3])
+	day, _ := strconv.Atoi(m[4])
+
+	return fmt.Sprintf("%04d-%02d-%02d", year, month, day)
+}
+
+// splitName splits a licensee name into first and last names. Japanese names
+// are written family name first, separated by a full- or half-width space.
+func splitName(name string) (first, last string) {
+	fields := strings.Fields(name)
+	switch len(fields) {
+	case 0:
+		return "", ""
+	case 1:
+		return "", fields[0]
+	default:
+		return strings.Join(fields[1:], " "), fields[0]
+	}
+}
+
+// ProcessMICCSV processes a MIC amateur station CSV export
+func (d *Database) ProcessMICCSV(ctx context.Context, csvPath string) (int, error) {
+	log.Printf("Processing MIC amateur radio data from %s...", csvPath)
+
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	r, err := decodeReader(file, *encodingFlag)
+	if err != nil {
+		return 0, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read header: %w", err)
+	}
+	log.Printf("CSV Header: %v", header)
+
+	columns := mapColumns(header)
+	if _, ok := columns["callsign"]; !ok {
+		return 0, fmt.Errorf("no callsign column found in header (wrong -encoding?)")
+	}
+
+	field := func(row []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO callsigns (
+			callsign, license_status, grant_date, expired_date,
+			first_name, last_name, entity_name, city, state,
+			radio_service_code, country, data_source, import_batch, last_updated
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'Japan', ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(callsign, data_source) DO UPDATE SET
+			country = excluded.country,
+			import_batch = excluded.import_batch,
+			license_status = CASE WHEN excluded.license_status != '' THEN excluded.license_status ELSE callsigns.license_status END,
+			grant_date = CASE WHEN excluded.grant_date != '' THEN excluded.grant_date ELSE callsigns.grant_date END,
+			expired_date = CASE WHEN excluded.expired_date != '' THEN excluded.expired_date ELSE callsigns.expired_date END,
+			first_name = CASE WHEN excluded.first_name != '' THEN excluded.first_name ELSE callsigns.first_name END,
+			last_name = CASE WHEN excluded.last_name != '' THEN excluded.last_name ELSE callsigns.last_name END,
+			entity_name = CASE WHEN excluded.entity_name != '' THEN excluded.entity_name ELSE callsigns.entity_name END,
+			city = CASE WHEN excluded.city != '' THEN excluded.city ELSE callsigns.city END,
+			state = CASE WHEN excluded.state != '' THEN excluded.state ELSE callsigns.state END,
+			radio_service_code = CASE WHEN excluded.radio_service_code != '' THEN excluded.radio_service_code ELSE callsigns.radio_service_code END,
+			last_updated = CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	today := time.Now().Format("2006-01-02")
+	count := 0
+	skipped := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Warning: CSV parse error (row skipped): %v", err)
+			skipped++
+			continue
+		}
+
+		callsign := strings.ToUpper(field(row, "callsign"))
+		if callsign == "" {
+			continue
+		}
+
+		// Prefer the prefecture from the station location; fall back to the
+		// call area region when the location is withheld or unrecognized.
+		region := ""
+		prefecture, city := splitLocation(field(row, "location"))
+		if prefecture != nil {
+			region = prefecture.Name
+		} else if area, ok := callArea(callsign); ok {
+			region = callAreas[area]
+		}
+
+		name := field(row, "name")
+		firstName, lastName := splitName(name)
+
+		// MIC lists stations whose licence term has lapsed until they are removed
+		expires := normalizeDate(field(row, "expires"))
+		licenseStatus := "A"
+		if len(expires) == len(today) && expires < today {
+			licenseStatus = "E"
+		}
+
+		_, err = stmt.ExecContext(ctx,
+			callsign,
+			licenseStatus,
+			normalizeDate(field(row, "granted")),
+			expires,
+			firstName,
+			lastName,
+			name,
+			city,
+			region,
+			"JP", // Mark as JP license
+			d.batch.Source,
+			d.batch.ID,
+		)
+		if err != nil {
+			log.Printf("Error inserting JP record for %s: %v", callsign, err)
+			continue
+		}
+
+		count++
+		if count%1000 == 0 {
+			log.Printf("  Loaded %d JP records...", count)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return count, err
+	}
+
+	if skipped > 0 {
+		log.Printf("Skipped %d records due to parse errors", skipped)
+	}
+
+	return count, nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [file.csv ...]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	log.SetFlags(log.LstdFlags)
+
+	files := flag.Args()
+	if len(files) == 0 && *urlFlag == "" {
+		fmt.Fprintln(os.Stderr, "Error: You must specify CSV files or -url")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Export amateur stations from https://www.tele.soumu.go.jp/ as CSV, then run:")
+		fmt.Fprintln(os.Stderr, "  hamqrzdb-import-jp ja1.csv ja2.csv ...")
+		fmt.Fprintln(os.Stderr, "")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Cancelled on SIGINT/SIGTERM so an in-progress import rolls back cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ctx, endTrace, err := tracing.StartProcess(ctx, "hamqrzdb-import-jp", "import-jp")
+	if err != nil {
+		log.Fatalf("Invalid tracing configuration: %v", err)
+	}
+	defer endTrace(nil)
+	// fatalf exits like log.Fatalf, exporting the failed run's trace first
+	fatalf := func(format string, args ...interface{}) {
+		endTrace(fmt.Errorf(format, args...))
+		log.Fatalf(format, args...)
+	}
+
+	// Connect to database
+	db, err := NewDatabase(ctx, *dbFlag)
+	if err != nil {
+		fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	if *urlFlag != "" {
+		tempDir, err := os.MkdirTemp("", "jp-amateur-*")
+		if err != nil {
+			fatalf("Failed to create temp directory: %v", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		for i, url := range strings.Split(*urlFlag, ",") {
+			dest := filepath.Join(tempDir, fmt.Sprintf("mic-%d.csv", i))
+			if err := DownloadFile(ctx, strings.TrimSpace(url), dest); err != nil {
+				fatalf("Failed to download: %v", err)
+			}
+			files = append(files, dest)
+		}
+	}
+
+	// One batch covers every file so -replace sees all call areas
+	db.batch, err = batch.Start(ctx, db.db, batch.MIC, fmt.Sprintf("%d files", len(files)))
+	if err != nil {
+		fatalf("Failed to start import: %v", err)
+	}
+
+	total := 0
+	for _, file := range files {
+		count, err := db.ProcessMICCSV(ctx, file)
+		if err != nil {
+			db.batch.Finish(ctx, db.db, err)
+			fatalf("Failed to process JP data: %v", err)
+		}
+		log.Printf("Loaded %d JP amateur radio records from %s", count, file)
+		total += count
+	}
+	if err := db.batch.Finish(ctx, db.db, nil); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	if *replaceFlag {
+		if _, err := db.batch.Prune(ctx, db.db); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	// The API reads callsigns from the shards of a sharded database
+	if err := shard.Refresh(ctx, db.db, *dbFlag); err != nil {
+		fatalf("Failed to rebuild shards: %v", err)
+	}
+
+	log.Println("\nJP import complete!")
+	log.Printf("Loaded %d records", total)
+	log.Printf("Database: %s", *dbFlag)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Prefecture is a Japanese prefecture and the call area its stations are issued in
+type Prefecture struct {
+	Kanji    string
+	Name     string
+	CallArea byte
+}
+
+// prefectures lists all 47 prefectures. Call areas span several prefectures,
+// so the digit in a callsign only narrows a station down to a region.
+var prefectures = []Prefecture{
+	{"北海道", "Hokkaido", '8'},
+	{"青森県", "Aomori", '7'},
+	{"岩手県", "Iwate", '7'},
+	{"宮城県", "Miyagi", '7'},
+	{"秋田県", "Akita", '7'},
+	{"山形県", "Yamagata", '7'},
+	{"福島県", "Fukushima", '7'},
+	{"茨城県", "Ibaraki", '1'},
+	{"栃木県", "Tochigi", '1'},
+	{"群馬県", "Gunma", '1'},
+	{"埼玉県", "Saitama", '1'},
+	{"千葉県", "Chiba", '1'},
+	{"東京都", "Tokyo", '1'},
+	{"神奈川県", "Kanagawa", '1'},
+	{"山梨県", "Yamanashi", '1'},
+	{"新潟県", "Niigata", '0'},
+	{"長野県", "Nagano", '0'},
+	{"富山県", "Toyama", '9'},
+	{"石川県", "Ishikawa", '9'},
+	{"福井県", "Fukui", '9'},
+	{"岐阜県", "Gifu", '2'},
+	{"静岡県", "Shizuoka", '2'},
+	{"愛知県", "Aichi", '2'},
+	{"三重県", "Mie", '2'},
+	{"滋賀県", "Shiga", '3'},
+	{"京都府", "Kyoto", '3'},
+	{"大阪府", "Osaka", '3'},
+	{"兵庫県", "Hyogo", '3'},
+	{"奈良県", "Nara", '3'},
+	{"和歌山県", "Wakayama", '3'},
+	{"鳥取県", "Tottori", '4'},
+	{"島根県", "Shimane", '4'},
+	{"岡山県", "Okayama", '4'},
+	{"広島県", "Hiroshima", '4'},
+	{"山口県", "Yamaguchi", '4'},
+	{"徳島県", "Tokushima", '5'},
+	{"香川県", "Kagawa", '5'},
+	{"愛媛県", "Ehime", '5'},
+	{"高知県", "Kochi", '5'},
+	{"福岡県", "Fukuoka", '6'},
+	{"佐賀県", "Saga", '6'},
+	{"長崎県", "Nagasaki", '6'},
+	{"熊本県", "Kumamoto", '6'},
+	{"大分県", "Oita", '6'},
+	{"宮崎県", "Miyazaki", '6'},
+	{"鹿児島県", "Kagoshima", '6'},
+	{"沖縄県", "Okinawa", '6'},
+}
+
+// callAreas names the region covered by each call area digit
+var callAreas = map[byte]string{
+	'1': "Kanto",
+	'2': "Tokai",
+	'3': "Kinki",
+	'4': "Chugoku",
+	'5': "Shikoku",
+	'6': "Kyushu/Okinawa",
+	'7': "Tohoku",
+	'8': "Hokkaido",
+	'9': "Hokuriku",
+	'0': "Shinetsu",
+}
+
+// callArea returns the call area digit of a Japanese callsign. Prefixes are
+// either two letters (JA1ABC) or a digit and a letter (7K1ABC), so the area is
+// the first digit after the leading character.
+func callArea(callsign string) (byte, bool) {
+	for i := 1; i < len(callsign); i++ {
+		if c := callsign[i]; c >= '0' && c <= '9' {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// splitLocation splits a station location such as "東京都千代田区" into the
+// prefecture and the remainder (city/ward). Locations sometimes omit the
+// prefecture and start with a city named after it ("大阪市北区"); those match
+// on the short name and are returned whole as the city.
+func splitLocation(location string) (*Prefecture, string) {
+	location = strings.TrimSpace(location)
+	for i := range prefectures {
+		p := &prefectures[i]
+		if strings.HasPrefix(location, p.Kanji) {
+			return p, strings.TrimSpace(strings.TrimPrefix(location, p.Kanji))
+		}
+	}
+	for i := range prefectures {
+		p := &prefectures[i]
+		_, size := utf8.DecodeLastRuneInString(p.Kanji)
+		short := p.Kanji[:len(p.Kanji)-size]
+		if p.Kanji == "北海道" || !strings.HasPrefix(location, short) {
+			continue
+		}
+		return p, location
+	}
+	return nil, location
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/batch"
+	"github.com/chriskacerguis/hamqrzdb/internal/httpclient"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+	"github.com/chriskacerguis/hamqrzdb/internal/shard"
+	_ "github.com/chriskacerguis/hamqrzdb/internal/sqlite"
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
+)
+
+// The RSM (Radio Spectrum Management) licence register can be exported as CSV
+// from https://rrf.rsm.govt.nz/ by searching for amateur licences. RSM doesn't
+// publish a stable direct link, so the export is supplied with -file or -url.
+
+var (
+	dbFlag      = flag.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "Path to SQLite database")
+	fileFlag    = flag.String("file", "", "RSM licence register CSV export")
+	urlFlag     = flag.String("url", os.Getenv("NZ_DATA_URL"), "URL of an RSM CSV export to download (env NZ_DATA_URL)")
+	replaceFlag = flag.Bool("replace", true, "Delete RSM records missing from this import (the file is a full snapshot)")
+	proxyFlag   = flag.String("proxy", "", "Proxy for downloads (http://, socks5://); defaults to HTTP_PROXY/HTTPS_PROXY")
+)
+
+// columnAliases maps schema fields to the header names RSM has used for them.
+// Exports from different RSM search screens name the columns differently.
+var columnAliases = map[string][]string{
+	"callsign":   {"callsign", "call sign", "call_sign"},
+	"name":       {"licensee", "licensee name", "client name", "name"},
+	"first_name": {"first name", "given name", "given names"},
+	"last_name":  {"surname", "last name", "family name"},
+	"address":    {"address", "street address", "physical address", "address line 1"},
+	"city":       {"town", "city", "town/city", "locality"},
+	"region":     {"region", "province"},
+	"postcode":   {"postcode", "post code"},
+	"class":      {"licence type", "qualification", "certificate", "licence category"},
+	"status":     {"status", "licence status"},
+	"granted":    {"commencement date", "issue date", "grant date"},
+	"expires":    {"expiry date", "expiry", "expires"},
+}
+
+type Database struct {
+	db    *sql.DB
+	batch *batch.Batch // import batch records are tagged with
+}
+
+// NewDatabase creates a new database connection
+func NewDatabase(ctx context.Context, dbPath string) (*Database, error) {
+	log.Printf("Connecting to database: %s", dbPath)
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Optimize SQLite for bulk inserts
+	pragmas := []string{
+		"PRAGMA journal_mode=WAL",
+		"PRAGMA synchronous=NORMAL",
+		"PRAGMA cache_size=10000",
+		"PRAGMA temp_store=MEMORY",
+	}
+
+	for _, pragma := range pragmas {
+		if _, err := db.ExecContext(ctx, pragma); err != nil {
+			return nil, fmt.Errorf("failed to set pragma: %w", err)
+		}
+	}
+
+	if err := schema.Ensure(ctx, db); err != nil {
+		return nil, err
+	}
+
+	return &Database{db: db}, nil
+}
+
+func (d *Database) Close() error {
+	return d.db.Close()
+}
+
+// DownloadFile downloads a file from URL to filepath
+func DownloadFile(ctx context.Context, url, filepath string) error {
+	log.Printf("Downloading %s...", url)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	client, err := httpclient.New(*proxyFlag)
+	if err != nil {
+		return err
+	}
+	client.Timeout = 2 * time.Minute
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad status: %s (status code: %d)", resp.Status, resp.StatusCode)
+	}
+
+	out, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return err
+	}
+
+	log.Printf("Downloaded to %s", filepath)
+	return nil
+}
+
+// mapColumns resolves each schema field to its column index in header
+func mapColumns(header []string) map[string]int {
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		// Strip a UTF-8 BOM and normalize case/whitespace
+		h = strings.TrimPrefix(h, "\ufeff")
+		index[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+
+	columns := make(map[string]int)
+	for field, aliases := range columnAliases {
+		for _, alias := range aliases {
+			if i, ok := index[alias]; ok {
+				columns[field] = i
+				break
+			}
+		}
+	}
+	return columns
+}
+
+// splitName splits "Firstname Middle Surname" into first and last names
+func splitName(name string) (first, last string) {
+	fields := strings.Fields(name)
+	switch len(fields) {
+	case 0:
+		return "", ""
+	case 1:
+		return "", fields[0]
+	default:
+		return strings.Join(fields[:len(fields)-1], " "), fields[len(fields)-1]
+	}
+}
+
+// mapStatus maps an RSM licence status to the FCC-style status codes
+func mapStatus(status string) string {
+	s := strings.ToLower(status)
+	switch {
+	case strings.Contains(s, "cancel"):
+		return "C"
+	case strings.Contains(s, "expired"), strings.Contains(s, "lapsed"):
+		return "E"
+	case strings.Contains(s, "revoked"):
+		return "R"
+	default:
+		return "A"
+	}
+}
+
+// ProcessRSMCSV processes an RSM amateur licence register CSV export
+func (d *Database) ProcessRSMCSV(ctx context.Context, csvPath string) error {
+	log.Println("Processing RSM amateur radio data...")
+
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	log.Printf("CSV Header: %v", header)
+
+	columns := mapColumns(header)
+	if _, ok := columns["callsign"]; !ok {
+		return fmt.Errorf("no callsign column found in header")
+	}
+
+	field := func(row []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO callsigns (
+			callsign, license_status, grant_date, expired_date, operator_class,
+			first_name, last_name, entity_name, street_address, city, state, zip_code,
+			radio_service_code, country, data_source, import_batch, last_updated
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'New Zealand', ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(callsign, data_source) DO UPDATE SET
+			country = excluded.country,
+			import_batch = excluded.import_batch,
+			license_status = CASE WHEN excluded.license_status != '' THEN excluded.license_status ELSE callsigns.license_status END,
+			grant_date = CASE WHEN excluded.grant_date != '' THEN excluded.grant_date ELSE callsigns.grant_date END,
+			expired_date = CASE WHEN excluded.expired_date != '' THEN excluded.expired_date ELSE callsigns.expired_date END,
+			operator_class = CASE WHEN excluded.operator_class != '' THEN excluded.operator_class ELSE callsigns.operator_class END,
+			first_name = CASE WHEN excluded.first_name != '' THEN excluded.first_name ELSE callsigns.first_name END,
+			last_name = CASE WHEN excluded.last_name != '' THEN excluded.last_name ELSE callsigns.last_name END,
+			entity_name = CASE WHEN excluded.entity_name != '' THEN excluded.entity_name ELSE callsigns.entity_name END,
+			street_address = CASE WHEN excluded.street_address != '' THEN excluded.street_address ELSE callsigns.street_address END,
+			city = CASE WHEN excluded.city != '' THEN excluded.city ELSE callsigns.city END,
+			state = CASE WHEN excluded.state != '' THEN excluded.state ELSE callsigns.state END,
+			zip_code = CASE WHEN excluded.zip_code != '' THEN excluded.zip_code ELSE callsigns.zip_code END,
+			radio_service_code = CASE WHEN excluded.radio_service_code != '' THEN excluded.radio_service_code ELSE callsigns.radio_service_code END,
+			last_updated = CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	count := 0
+	skipped := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Warning: CSV parse error (row skipped): %v", err)
+			skipped++
+			continue
+		}
+
+		callsign := strings.ToUpper(field(row, "callsign"))
+		if callsign == "" {
+			continue
+		}
+
+		name := field(row, "name")
+		firstName := field(row, "first_name")
+		lastName := field(row, "last_name")
+		if firstName == "" && lastName == "" {
+			firstName, lastName = splitName(name)
+		}
+		if name == "" {
+			name = strings.TrimSpace(firstName + " " + lastName)
+		}
+
+		_, err = stmt.ExecContext(ctx,
+			callsign,
+			mapStatus(field(row, "status")),
+			field(row, "granted"),
+			field(row, "expires"),
+			field(row, "class"),
+			firstName,
+			lastName,
+			name,
+			field(row, "address"),
+			field(row, "city"),
+			field(row, "region"),
+			field(row, "postcode"),
+			"NZ", // Mark as NZ license
+			d.batch.Source,
+			d.batch.ID,
+		)
+		if err != nil {
+			log.Printf("Error inserting NZ record for %s: %v", callsign, err)
+			continue
+		}
+
+		count++
+		if count%1000 == 0 {
+			log.Printf("  Loaded %d NZ records...", count)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Loaded %d NZ amateur radio records", count)
+	if skipped > 0 {
+		log.Printf("Skipped %d records due to parse errors", skipped)
+	}
+
+	return nil
+}
+
+func main() {
+	flag.Parse()
+
+	log.SetFlags(log.LstdFlags)
+
+	if *fileFlag == "" && *urlFlag == "" {
+		fmt.Fprintln(os.Stderr, "Error: You must specify -file or -url")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Export amateur licences from https://rrf.rsm.govt.nz/ as CSV, then run:")
+		fmt.Fprintln(os.Stderr, "  hamqrzdb-import-nz -file rsm-amateur.csv")
+		fmt.Fprintln(os.Stderr, "")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Cancelled on SIGINT/SIGTERM so an in-progress import rolls back cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ctx, endTrace, err := tracing.StartProcess(ctx, "hamqrzdb-import-nz", "import-nz")
+	if err != nil {
+		log.Fatalf("Invalid tracing configuration: %v", err)
+	}
+	defer endTrace(nil)
+	// fatalf exits like log.Fatalf, exporting the failed run's trace first
+	fatalf := func(format string, args ...interface{}) {
+		endTrace(fmt.Errorf(format, args...))
+		log.Fatalf(format, args...)
+	}
+
+	// Connect to database
+	db, err := NewDatabase(ctx, *dbFlag)
+	if err != nil {
+		fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	csvFile := *fileFlag
+	if csvFile != "" {
+		if _, err := os.Stat(csvFile); os.IsNotExist(err) {
+			fatalf("File not found: %s", csvFile)
+		}
+	} else {
+		tempDir, err := os.MkdirTemp("", "nz-amateur-*")
+		if err != nil {
+			fatalf("Failed to create temp directory: %v", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		csvFile = filepath.Join(tempDir, "rsm-amateur.csv")
+		if err := DownloadFile(ctx, *urlFlag, csvFile); err != nil {
+			fatalf("Failed to download: %v", err)
+		}
+	}
+
+	// Record the run so a re-import replaces only RSM records
+	db.batch, err = batch.Start(ctx, db.db, batch.RSM, filepath.Base(csvFile))
+	if err != nil {
+		fatalf("Failed to start import: %v", err)
+	}
+
+	if err := db.ProcessRSMCSV(ctx, csvFile); err != nil {
+		db.batch.Finish(ctx, db.db, err)
+		fatalf("Failed to process NZ data: %v", err)
+	}
+	if err := db.batch.Finish(ctx, db.db, nil); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	// The RSM file is a complete snapshot: drop records it no longer has
+	if *replaceFlag {
+		if _, err := db.batch.Prune(ctx, db.db); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	// The API reads callsigns from the shards of a sharded database
+	if err := shard.Refresh(ctx, db.db, *dbFlag); err != nil {
+		fatalf("Failed to rebuild shards: %v", err)
+	}
+
+	log.Println("\nNZ import complete!")
+	log.Printf("Database: %s", *dbFlag)
+}
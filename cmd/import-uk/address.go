@@ -0,0 +1,262 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// PostcodeArea is the post town and region for the letters at the start of a postcode
+type PostcodeArea struct {
+	Town   string
+	Region string
+}
+
+// postcodeAreas maps the 121 UK postcode areas (plus the Crown Dependencies)
+// to their post town and ONS region or nation. It fills city/state when the
+// Ofcom address is too short to split.
+var postcodeAreas = map[string]PostcodeArea{
+	"AB": {"Aberdeen", "Scotland"},
+	"AL": {"St Albans", "East of England"},
+	"B":  {"Birmingham", "West Midlands"},
+	"BA": {"Bath", "South West"},
+	"BB": {"Blackburn", "North West"},
+	"BD": {"Bradford", "Yorkshire and the Humber"},
+	"BH": {"Bournemouth", "South West"},
+	"BL": {"Bolton", "North West"},
+	"BN": {"Brighton", "South East"},
+	"BR": {"Bromley", "London"},
+	"BS": {"Bristol", "South West"},
+	"BT": {"Belfast", "Northern Ireland"},
+	"CA": {"Carlisle", "North West"},
+	"CB": {"Cambridge", "East of England"},
+	"CF": {"Cardiff", "Wales"},
+	"CH": {"Chester", "North West"},
+	"CM": {"Chelmsford", "East of England"},
+	"CO": {"Colchester", "East of England"},
+	"CR": {"Croydon", "London"},
+	"CT": {"Canterbury", "South East"},
+	"CV": {"Coventry", "West Midlands"},
+	"CW": {"Crewe", "North West"},
+	"DA": {"Dartford", "South East"},
+	"DD": {"Dundee", "Scotland"},
+	"DE": {"Derby", "East Midlands"},
+	"DG": {"Dumfries", "Scotland"},
+	"DH": {"Durham", "North East"},
+	"DL": {"Darlington", "North East"},
+	"DN": {"Doncaster", "Yorkshire and the Humber"},
+	"DT": {"Dorchester", "South West"},
+	"DY": {"Dudley", "West Midlands"},
+	"E":  {"London", "London"},
+	"EC": {"London", "London"},
+	"EH": {"Edinburgh", "Scotland"},
+	"EN": {"Enfield", "London"},
+	"EX": {"Exeter", "South West"},
+	"FK": {"Falkirk", "Scotland"},
+	"FY": {"Blackpool", "North West"},
+	"G":  {"Glasgow", "Scotland"},
+	"GL": {"Gloucester", "South West"},
+	"GU": {"Guildford", "South East"},
+	"GY": {"Guernsey", "Guernsey"},
+	"HA": {"Harrow", "London"},
+	"HD": {"Huddersfield", "Yorkshire and the Humber"},
+	"HG": {"Harrogate", "Yorkshire and the Humber"},
+	"HP": {"Hemel Hempstead", "East of England"},
+	"HR": {"Hereford", "West Midlands"},
+	"HS": {"Outer Hebrides", "Scotland"},
+	"HU": {"Hull", "Yorkshire and the Humber"},
+	"HX": {"Halifax", "Yorkshire and the Humber"},
+	"IG": {"Ilford", "London"},
+	"IM": {"Isle of Man", "Isle of Man"},
+	"IP": {"Ipswich", "East of England"},
+	"IV": {"Inverness", "Scotland"},
+	"JE": {"Jersey", "Jersey"},
+	"KA": {"Kilmarnock", "Scotland"},
+	"KT": {"Kingston upon Thames", "London"},
+	"KW": {"Kirkwall", "Scotland"},
+	"KY": {"Kirkcaldy", "Scotland"},
+	"L":  {"Liverpool", "North West"},
+	"LA": {"Lancaster", "North West"},
+	"LD": {"Llandrindod Wells", "Wales"},
+	"LE": {"Leicester", "East Midlands"},
+	"LL": {"Llandudno", "Wales"},
+	"LN": {"Lincoln", "East Midlands"},
+	"LS": {"Leeds", "Yorkshire and the Humber"},
+	"LU": {"Luton", "East of England"},
+	"M":  {"Manchester", "North West"},
+	"ME": {"Rochester", "South East"},
+	"MK": {"Milton Keynes", "South East"},
+	"ML": {"Motherwell", "Scotland"},
+	"N":  {"London", "London"},
+	"NE": {"Newcastle upon Tyne", "North East"},
+	"NG": {"Nottingham", "East Midlands"},
+	"NN": {"Northampton", "East Midlands"},
+	"NP": {"Newport", "Wales"},
+	"NR": {"Norwich", "East of England"},
+	"NW": {"London", "London"},
+	"OL": {"Oldham", "North West"},
+	"OX": {"Oxford", "South East"},
+	"PA": {"Paisley", "Scotland"},
+	"PE": {"Peterborough", "East of England"},
+	"PH": {"Perth", "Scotland"},
+	"PL": {"Plymouth", "South West"},
+	"PO": {"Portsmouth", "South East"},
+	"PR": {"Preston", "North West"},
+	"RG": {"Reading", "South East"},
+	"RH": {"Redhill", "South East"},
+	"RM": {"Romford", "London"},
+	"S":  {"Sheffield", "Yorkshire and the Humber"},
+	"SA": {"Swansea", "Wales"},
+	"SE": {"London", "London"},
+	"SG": {"Stevenage", "East of England"},
+	"SK": {"Stockport", "North West"},
+	"SL": {"Slough", "South East"},
+	"SM": {"Sutton", "London"},
+	"SN": {"Swindon", "South West"},
+	"SO": {"Southampton", "South East"},
+	"SP": {"Salisbury", "South West"},
+	"SR": {"Sunderland", "North East"},
+	"SS": {"Southend-on-Sea", "East of England"},
+	"ST": {"Stoke-on-Trent", "West Midlands"},
+	"SW": {"London", "London"},
+	"SY": {"Shrewsbury", "West Midlands"},
+	"TA": {"Taunton", "South West"},
+	"TD": {"Galashiels", "Scotland"},
+	"TF": {"Telford", "West Midlands"},
+	"TN": {"Tonbridge", "South East"},
+	"TQ": {"Torquay", "South West"},
+	"TR": {"Truro", "South West"},
+	"TS": {"Cleveland", "North East"},
+	"TW": {"Twickenham", "London"},
+	"UB": {"Southall", "London"},
+	"W":  {"London", "London"},
+	"WA": {"Warrington", "North West"},
+	"WC": {"London", "London"},
+	"WD": {"Watford", "East of England"},
+	"WF": {"Wakefield", "Yorkshire and the Humber"},
+	"WN": {"Wigan", "North West"},
+	"WR": {"Worcester", "West Midlands"},
+	"WS": {"Walsall", "West Midlands"},
+	"WV": {"Wolverhampton", "West Midlands"},
+	"YO": {"York", "Yorkshire and the Humber"},
+	"ZE": {"Lerwick", "Scotland"},
+}
+
+// counties are ceremonial, historic, and former counties that appear as the
+// last line of UK addresses. Keys are lower case without a "County " prefix.
+var counties = map[string]bool{}
+
+func init() {
+	for _, c := range []string{
+		// England
+		"Avon", "Bedfordshire", "Berkshire", "Bristol", "Buckinghamshire", "Cambridgeshire",
+		"Cheshire", "Cleveland", "Cornwall", "Cumbria", "Cumberland", "Derbyshire", "Devon",
+		"Dorset", "Durham", "East Riding of Yorkshire", "East Sussex", "East Yorkshire",
+		"Essex", "Gloucestershire", "Greater London", "Greater Manchester", "Hampshire",
+		"Herefordshire", "Hertfordshire", "Humberside", "Huntingdonshire", "Isle of Wight",
+		"Kent", "Lancashire", "Leicestershire", "Lincolnshire", "Merseyside", "Middlesex",
+		"Norfolk", "North Humberside", "North Yorkshire", "Northamptonshire", "Northumberland",
+		"Nottinghamshire", "Oxfordshire", "Rutland", "Shropshire", "Somerset",
+		"South Humberside", "South Yorkshire", "Staffordshire", "Suffolk", "Surrey",
+		"Sussex", "Tyne and Wear", "Warwickshire", "West Midlands", "West Sussex",
+		"West Yorkshire", "Westmorland", "Wiltshire", "Worcestershire", "Yorkshire",
+		// Wales
+		"Anglesey", "Isle of Anglesey", "Blaenau Gwent", "Bridgend", "Caerphilly",
+		"Cardiganshire", "Carmarthenshire", "Ceredigion", "Clwyd", "Conwy", "Denbighshire",
+		"Dyfed", "Flintshire", "Glamorgan", "Gwent", "Gwynedd", "Merionethshire",
+		"Mid Glamorgan", "Monmouthshire", "Montgomeryshire", "Neath Port Talbot",
+		"Pembrokeshire", "Powys", "Radnorshire", "Rhondda Cynon Taf", "South Glamorgan",
+		"Torfaen", "Vale of Glamorgan", "West Glamorgan", "Wrexham",
+		// Scotland
+		"Aberdeenshire", "Angus", "Argyll", "Argyll and Bute", "Ayrshire", "Banffshire",
+		"Berwickshire", "Borders", "Caithness", "Clackmannanshire", "Dumfries and Galloway",
+		"Dumfriesshire", "Dunbartonshire", "East Ayrshire", "East Dunbartonshire",
+		"East Lothian", "East Renfrewshire", "Fife", "Highland", "Inverness-shire",
+		"Isle of Arran", "Isle of Lewis", "Isle of Skye", "Kincardineshire", "Kinross-shire",
+		"Kirkcudbrightshire", "Lanarkshire", "Lothian", "Midlothian", "Moray", "Morayshire",
+		"Nairnshire", "North Ayrshire", "North Lanarkshire", "Orkney", "Peeblesshire",
+		"Perth and Kinross", "Perthshire", "Renfrewshire", "Ross-shire", "Roxburghshire",
+		"Scottish Borders", "Selkirkshire", "Shetland", "South Ayrshire", "South Lanarkshire",
+		"Stirlingshire", "Sutherland", "West Dunbartonshire", "West Lothian", "Wigtownshire",
+		// Northern Ireland
+		"Antrim", "Armagh", "Down", "Fermanagh", "Londonderry", "Tyrone",
+	} {
+		counties[strings.ToLower(c)] = true
+	}
+}
+
+var ukPostcode = regexp.MustCompile(`(?i)^[A-Z]{1,2}[0-9][0-9A-Z]?\s*[0-9][A-Z]{2}$`)
+
+// postcodeArea returns the area for a postcode from its leading letters
+func postcodeArea(postcode string) (PostcodeArea, bool) {
+	postcode = strings.ToUpper(strings.TrimSpace(postcode))
+	end := strings.IndexFunc(postcode, func(r rune) bool { return !unicode.IsLetter(r) })
+	if end < 0 {
+		end = len(postcode)
+	}
+	area, ok := postcodeAreas[postcode[:end]]
+	return area, ok
+}
+
+// isCounty reports whether line names a county, with or without a "County"/"Co." prefix
+func isCounty(line string) bool {
+	l := strings.ToLower(strings.TrimSpace(line))
+	for _, prefix := range []string{"county ", "co. ", "co "} {
+		l = strings.TrimPrefix(l, prefix)
+	}
+	return counties[l]
+}
+
+// ParseUKAddress splits an Ofcom "Full address" into street, town, and
+// county. Lines are comma-separated with the post town last unless followed
+// by a county; a trailing postcode is dropped since it has its own column.
+// Missing town/county fall back to the postcode area's post town and region.
+func ParseUKAddress(full, postcode string) (street, city, county string) {
+	var lines []string
+	for _, l := range strings.Split(full, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+
+	if n := len(lines); n > 0 && ukPostcode.MatchString(lines[n-1]) {
+		lines = lines[:n-1]
+	}
+	if n := len(lines); n > 1 && isCounty(lines[n-1]) {
+		county = lines[n-1]
+		lines = lines[:n-1]
+	}
+	if n := len(lines); n > 1 {
+		city = titleCase(lines[n-1])
+		lines = lines[:n-1]
+	}
+	street = strings.Join(lines, ", ")
+
+	if area, ok := postcodeArea(postcode); ok {
+		if city == "" {
+			city = area.Town
+		}
+		if county == "" {
+			county = area.Region
+		}
+	}
+	return street, city, county
+}
+
+// titleCase converts an all-caps post town ("READING") to title case. Mixed
+// case input is left alone so names like "McAllister" survive.
+func titleCase(s string) string {
+	if strings.ToUpper(s) != s {
+		return s
+	}
+	words := strings.Fields(strings.ToLower(s))
+	for i, w := range words {
+		if i > 0 && (w == "upon" || w == "on" || w == "and" || w == "the" || w == "le") {
+			continue
+		}
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// errNotFound is returned by DownloadFile when the server answers 404, so
+// date-pattern downloads can move on to the previous day.
+var errNotFound = errors.New("not found")
+
+// ofcomCSVLink matches links to the callsign CSV on the Ofcom data page. The
+// six digits are the publication date as DDMMYY.
+var ofcomCSVLink = regexp.MustCompile(`href="([^"]*callsign-(\d{6})\.csv[^"]*)"`)
+
+// DiscoverOfcomURL scrapes the Ofcom licence data page for the newest
+// callsign CSV link. The file name embeds its publication date and changes
+// every month, so it can't be hard-coded.
+func DiscoverOfcomURL(ctx context.Context, pageURL string) (string, error) {
+	log.Printf("Discovering current CSV from %s...", pageURL)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return "", err
+	}
+	setBrowserHeaders(req)
+	// Ask for an uncompressed page; setting Accept-Encoding disables Go's transparent gzip
+	req.Header.Del("Accept-Encoding")
+
+	client, err := newClient()
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("bad status: %s (status code: %d)", resp.Status, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return "", err
+	}
+
+	type link struct {
+		href string
+		date time.Time
+	}
+	var links []link
+	for _, m := range ofcomCSVLink.FindAllStringSubmatch(string(body), -1) {
+		date, err := time.Parse("020106", m[2])
+		if err != nil {
+			continue
+		}
+		links = append(links, link{href: strings.ReplaceAll(m[1], "&amp;", "&"), date: date})
+	}
+	if len(links) == 0 {
+		return "", fmt.Errorf("no callsign CSV link found on %s", pageURL)
+	}
+
+	sort.Slice(links, func(i, j int) bool { return links[i].date.After(links[j].date) })
+
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(links[0].href)
+	if err != nil {
+		return "", fmt.Errorf("invalid CSV link %q: %w", links[0].href, err)
+	}
+
+	found := base.ResolveReference(ref).String()
+	log.Printf("Found CSV published %s: %s", links[0].date.Format("2006-01-02"), found)
+	return found, nil
+}
+
+// DownloadPattern downloads from a URL pattern where %s is the publication
+// date as DDMMYY, trying each day from today back through lookback days.
+func DownloadPattern(ctx context.Context, pattern string, lookback int, filepath string) (string, error) {
+	day := time.Now()
+	for i := 0; i <= lookback; i++ {
+		u := fmt.Sprintf(pattern, day.AddDate(0, 0, -i).Format("020106"))
+		err := DownloadFile(ctx, u, filepath)
+		if err == nil {
+			return u, nil
+		}
+		if !errors.Is(err, errNotFound) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no file matching %s in the last %d days", pattern, lookback)
+}
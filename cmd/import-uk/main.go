@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/csv"
 	"flag"
@@ -9,31 +10,48 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/chriskacerguis/hamqrzdb/internal/batch"
+	"github.com/chriskacerguis/hamqrzdb/internal/httpclient"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+	"github.com/chriskacerguis/hamqrzdb/internal/shard"
+	_ "github.com/chriskacerguis/hamqrzdb/internal/sqlite"
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
 )
 
 const (
-	// Ofcom Amateur Radio License data
-	// URL: https://www.ofcom.org.uk/manage-your-licence/radiocommunication-licences/amateur-radio/amateur-radio-licence-data
+	// Ofcom Amateur Radio License data page, scraped for the current CSV link
+	OfcomDataPage = "https://www.ofcom.org.uk/manage-your-licence/radiocommunication-licences/amateur-radio/amateur-radio-licence-data"
+
+	// OfcomDataURL is the last known CSV, used only when discovery fails
 	OfcomDataURL = "https://www.ofcom.org.uk/siteassets/resources/documents/manage-your-licence/amateur/callsign-030625.csv?v=398262"
 )
 
 var (
-	dbFlag       = flag.String("db", "hamqrzdb.sqlite", "Path to SQLite database")
-	downloadFlag = flag.Bool("download", true, "Download fresh data from Ofcom")
-	fileFlag     = flag.String("file", "", "Use local CSV file instead of downloading")
+	dbFlag        = flag.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "Path to SQLite database")
+	downloadFlag  = flag.Bool("download", true, "Download fresh data from Ofcom")
+	fileFlag      = flag.String("file", "", "Use local CSV file instead of downloading")
+	urlFlag       = flag.String("url", os.Getenv("UK_DATA_URL"), "CSV URL, or a pattern where %s is the date as DDMMYY (env UK_DATA_URL; default: discover from the Ofcom page)")
+	pageFlag      = flag.String("page", OfcomDataPage, "Ofcom page to discover the current CSV link from")
+	lookbackFlag  = flag.Int("lookback", 62, "Days to search back when -url is a date pattern")
+	codePointFlag = flag.String("codepoint", os.Getenv("UK_CODEPOINT"), "Code-Point Open zip, directory, CSV, or URL used to geocode postcodes (env UK_CODEPOINT)")
+	replaceFlag   = flag.Bool("replace", true, "Delete Ofcom records missing from this import (the file is a full snapshot)")
+	proxyFlag     = flag.String("proxy", "", "Proxy for downloads (http://, socks5://); defaults to HTTP_PROXY/HTTPS_PROXY")
 )
 
 type Database struct {
-	db *sql.DB
+	db    *sql.DB
+	batch *batch.Batch // import batch records are tagged with
 }
 
 // NewDatabase creates a new database connection
-func NewDatabase(dbPath string) (*Database, error) {
+func NewDatabase(ctx context.Context, dbPath string) (*Database, error) {
 	log.Printf("Connecting to database: %s", dbPath)
 
 	db, err := sql.Open("sqlite3", dbPath)
@@ -50,11 +68,15 @@ func NewDatabase(dbPath string) (*Database, error) {
 	}
 
 	for _, pragma := range pragmas {
-		if _, err := db.Exec(pragma); err != nil {
+		if _, err := db.ExecContext(ctx, pragma); err != nil {
 			return nil, fmt.Errorf("failed to set pragma: %w", err)
 		}
 	}
 
+	if err := schema.Ensure(ctx, db); err != nil {
+		return nil, err
+	}
+
 	return &Database{db: db}, nil
 }
 
@@ -62,17 +84,8 @@ func (d *Database) Close() error {
 	return d.db.Close()
 }
 
-// DownloadFile downloads a file from URL to filepath
-func DownloadFile(url, filepath string) error {
-	log.Printf("Downloading %s...", url)
-
-	// Create request with browser-like headers to bypass Cloudflare protection
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return err
-	}
-
-	// Add browser-like headers with referer
+// setBrowserHeaders adds browser-like headers to get past Cloudflare protection
+func setBrowserHeaders(req *http.Request) {
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
 	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
 	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
@@ -84,17 +97,39 @@ func DownloadFile(url, filepath string) error {
 	req.Header.Set("Sec-Fetch-Dest", "document")
 	req.Header.Set("Sec-Fetch-Mode", "navigate")
 	req.Header.Set("Sec-Fetch-Site", "same-origin")
+}
 
-	// Use client with cookie jar and redirect following
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// Follow up to 10 redirects
-			if len(via) >= 10 {
-				return fmt.Errorf("stopped after 10 redirects")
-			}
-			return nil
-		},
+// newClient returns a client with proxy support and redirect following
+func newClient() (*http.Client, error) {
+	client, err := httpclient.New(*proxyFlag)
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = 30 * time.Second
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		// Follow up to 10 redirects
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return client, nil
+}
+
+// DownloadFile downloads a file from URL to filepath
+func DownloadFile(ctx context.Context, url, filepath string) error {
+	log.Printf("Downloading %s...", url)
+
+	// Create request with browser-like headers to bypass Cloudflare protection
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	setBrowserHeaders(req)
+
+	client, err := newClient()
+	if err != nil {
+		return err
 	}
 
 	resp, err := client.Do(req)
@@ -103,6 +138,9 @@ func DownloadFile(url, filepath string) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", errNotFound, url)
+	}
 	if resp.StatusCode != http.StatusOK {
 		// Provide helpful error message for Cloudflare 403
 		if resp.StatusCode == http.StatusForbidden {
@@ -134,7 +172,7 @@ func DownloadFile(url, filepath string) error {
 
 // ProcessOfcomCSV processes the Ofcom amateur radio CSV file
 // Format: Licence Number,Call sign,First name,Surname,Full address,Postcode,Licence status,Licence valid from,Licence valid to
-func (d *Database) ProcessOfcomCSV(csvPath string) error {
+func (d *Database) ProcessOfcomCSV(ctx context.Context, csvPath string) error {
 	log.Println("Processing Ofcom amateur radio data...")
 
 	file, err := os.Open(csvPath)
@@ -154,25 +192,29 @@ func (d *Database) ProcessOfcomCSV(csvPath string) error {
 	}
 	log.Printf("CSV Header: %v", header)
 
-	tx, err := d.db.Begin()
+	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(`
+	stmt, err := tx.PrepareContext(ctx, `
 		INSERT INTO callsigns (
 			callsign, license_status, grant_date, expired_date,
-			first_name, last_name, street_address, zip_code,
-			radio_service_code, last_updated
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
-		ON CONFLICT(callsign) DO UPDATE SET
+			first_name, last_name, street_address, city, state, zip_code,
+			radio_service_code, country, data_source, import_batch, last_updated
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'United Kingdom', ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(callsign, data_source) DO UPDATE SET
+			country = excluded.country,
+			import_batch = excluded.import_batch,
 			license_status = CASE WHEN excluded.license_status != '' THEN excluded.license_status ELSE callsigns.license_status END,
 			grant_date = CASE WHEN excluded.grant_date != '' THEN excluded.grant_date ELSE callsigns.grant_date END,
 			expired_date = CASE WHEN excluded.expired_date != '' THEN excluded.expired_date ELSE callsigns.expired_date END,
 			first_name = CASE WHEN excluded.first_name != '' THEN excluded.first_name ELSE callsigns.first_name END,
 			last_name = CASE WHEN excluded.last_name != '' THEN excluded.last_name ELSE callsigns.last_name END,
 			street_address = CASE WHEN excluded.street_address != '' THEN excluded.street_address ELSE callsigns.street_address END,
+			city = CASE WHEN excluded.city != '' THEN excluded.city ELSE callsigns.city END,
+			state = CASE WHEN excluded.state != '' THEN excluded.state ELSE callsigns.state END,
 			zip_code = CASE WHEN excluded.zip_code != '' THEN excluded.zip_code ELSE callsigns.zip_code END,
 			radio_service_code = CASE WHEN excluded.radio_service_code != '' THEN excluded.radio_service_code ELSE callsigns.radio_service_code END,
 			last_updated = CURRENT_TIMESTAMP
@@ -186,6 +228,10 @@ func (d *Database) ProcessOfcomCSV(csvPath string) error {
 	skipped := 0
 
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		row, err := reader.Read()
 		if err == io.EOF {
 			break
@@ -223,16 +269,22 @@ func (d *Database) ProcessOfcomCSV(csvPath string) error {
 			licenseStatus = "E"
 		}
 
-		_, err = stmt.Exec(
+		street, city, county := ParseUKAddress(fullAddress, postcode)
+
+		_, err = stmt.ExecContext(ctx,
 			callsign,
 			licenseStatus,
 			validFrom,
 			validTo,
 			firstName,
 			surname,
-			fullAddress,
+			street,
+			city,
+			county,
 			postcode,
 			"UK", // Mark as UK license
+			d.batch.Source,
+			d.batch.ID,
 		)
 		if err != nil {
 			log.Printf("Error inserting UK record for %s: %v", callsign, err)
@@ -262,10 +314,25 @@ func main() {
 
 	log.SetFlags(log.LstdFlags)
 
+	// Cancelled on SIGINT/SIGTERM so an in-progress import rolls back cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ctx, endTrace, err := tracing.StartProcess(ctx, "hamqrzdb-import-uk", "import-uk")
+	if err != nil {
+		log.Fatalf("Invalid tracing configuration: %v", err)
+	}
+	defer endTrace(nil)
+	// fatalf exits like log.Fatalf, exporting the failed run's trace first
+	fatalf := func(format string, args ...interface{}) {
+		endTrace(fmt.Errorf(format, args...))
+		log.Fatalf(format, args...)
+	}
+
 	// Connect to database
-	db, err := NewDatabase(*dbFlag)
+	db, err := NewDatabase(ctx, *dbFlag)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatalf("Failed to connect to database: %v", err)
 	}
 	defer db.Close()
 
@@ -275,27 +342,85 @@ func main() {
 		// Use provided file
 		csvFile = *fileFlag
 		if _, err := os.Stat(csvFile); os.IsNotExist(err) {
-			log.Fatalf("File not found: %s", csvFile)
+			fatalf("File not found: %s", csvFile)
 		}
 	} else if *downloadFlag {
 		// Download from Ofcom
 		tempDir, err := os.MkdirTemp("", "uk-amateur-*")
 		if err != nil {
-			log.Fatalf("Failed to create temp directory: %v", err)
+			fatalf("Failed to create temp directory: %v", err)
 		}
 		defer os.RemoveAll(tempDir)
 
 		csvFile = filepath.Join(tempDir, "amateur-current.csv")
-		if err := DownloadFile(OfcomDataURL, csvFile); err != nil {
-			log.Fatalf("Failed to download: %v", err)
+		switch {
+		case strings.Contains(*urlFlag, "%s"):
+			if _, err := DownloadPattern(ctx, *urlFlag, *lookbackFlag, csvFile); err != nil {
+				fatalf("Failed to download: %v", err)
+			}
+		case *urlFlag != "":
+			if err := DownloadFile(ctx, *urlFlag, csvFile); err != nil {
+				fatalf("Failed to download: %v", err)
+			}
+		default:
+			url, err := DiscoverOfcomURL(ctx, *pageFlag)
+			if err != nil {
+				log.Printf("Warning: CSV discovery failed, using last known URL: %v", err)
+				url = OfcomDataURL
+			}
+			if err := DownloadFile(ctx, url, csvFile); err != nil {
+				fatalf("Failed to download: %v", err)
+			}
 		}
 	} else {
-		log.Fatal("Either --download or --file must be specified")
+		fatalf("Either --download or --file must be specified")
 	}
 
 	// Process the CSV
-	if err := db.ProcessOfcomCSV(csvFile); err != nil {
-		log.Fatalf("Failed to process UK data: %v", err)
+	// Record the run so a re-import replaces only Ofcom records
+	db.batch, err = batch.Start(ctx, db.db, batch.Ofcom, filepath.Base(csvFile))
+	if err != nil {
+		fatalf("Failed to start import: %v", err)
+	}
+
+	if err := db.ProcessOfcomCSV(ctx, csvFile); err != nil {
+		db.batch.Finish(ctx, db.db, err)
+		fatalf("Failed to process UK data: %v", err)
+	}
+	if err := db.batch.Finish(ctx, db.db, nil); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	// The Ofcom file is a complete snapshot: drop records it no longer has
+	if *replaceFlag {
+		if _, err := db.batch.Prune(ctx, db.db); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	// Add locations from postcode centroids
+	if codePoint := *codePointFlag; codePoint != "" {
+		if strings.HasPrefix(codePoint, "http://") || strings.HasPrefix(codePoint, "https://") {
+			tempDir, err := os.MkdirTemp("", "uk-codepoint-*")
+			if err != nil {
+				fatalf("Failed to create temp directory: %v", err)
+			}
+			defer os.RemoveAll(tempDir)
+
+			dest := filepath.Join(tempDir, "codepo_gb.zip")
+			if err := DownloadFile(ctx, codePoint, dest); err != nil {
+				fatalf("Failed to download Code-Point Open: %v", err)
+			}
+			codePoint = dest
+		}
+		if err := db.GeocodePostcodes(ctx, codePoint); err != nil {
+			fatalf("Failed to geocode UK postcodes: %v", err)
+		}
+	}
+
+	// The API reads callsigns from the shards of a sharded database
+	if err := shard.Refresh(ctx, db.db, *dbFlag); err != nil {
+		fatalf("Failed to rebuild shards: %v", err)
 	}
 
 	log.Println("\nUK import complete!")
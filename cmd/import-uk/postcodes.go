@@ -0,0 +1,239 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/geo"
+)
+
+// Code-Point Open (https://www.ordnancesurvey.co.uk/products/code-point-open)
+// gives a centroid for every postcode in Great Britain as OS National Grid
+// eastings/northings. It has no header row; the first four columns are
+// Postcode, Positional_quality_indicator, Eastings, Northings. Northern
+// Ireland (BT) postcodes aren't included.
+
+var ukOutwardCode = regexp.MustCompile(`^[A-Z]{1,2}[0-9][0-9A-Z]?$`)
+
+// normalizePostcode upper-cases a postcode and removes all spaces
+func normalizePostcode(postcode string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(postcode), ""))
+}
+
+// GeocodePostcodes sets latitude, longitude, and grid_square for UK records
+// from Code-Point Open postcode centroids. path is the Code-Point Open zip, a
+// directory of its CSV files, or a single CSV. Records with only an outward
+// code (e.g. "RG1") get the average of that district's postcodes.
+func (d *Database) GeocodePostcodes(ctx context.Context, path string) error {
+	log.Printf("Geocoding UK postcodes from %s...", path)
+
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT callsign, zip_code FROM callsigns
+		WHERE data_source = 'OFCOM' AND zip_code IS NOT NULL AND zip_code != ''
+	`)
+	if err != nil {
+		return err
+	}
+
+	full := map[string][]string{}
+	outward := map[string][]string{}
+	for rows.Next() {
+		var callsign, zip string
+		if err := rows.Scan(&callsign, &zip); err != nil {
+			rows.Close()
+			return err
+		}
+		switch pc := normalizePostcode(zip); {
+		case ukPostcode.MatchString(pc):
+			full[pc] = append(full[pc], callsign)
+		case ukOutwardCode.MatchString(pc):
+			outward[pc] = append(outward[pc], callsign)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(full) == 0 && len(outward) == 0 {
+		log.Println("No UK postcodes to geocode")
+		return nil
+	}
+
+	type centroid struct {
+		e, n  float64
+		count int
+	}
+	found := map[string]*centroid{}
+
+	err = forEachCodePoint(ctx, path, func(postcode string, e, n float64) {
+		pc := normalizePostcode(postcode)
+		if _, ok := full[pc]; ok {
+			found[pc] = &centroid{e: e, n: n, count: 1}
+		}
+		if len(pc) > 3 {
+			out := pc[:len(pc)-3]
+			if _, ok := outward[out]; ok {
+				c := found[out]
+				if c == nil {
+					c = &centroid{}
+					found[out] = c
+				}
+				c.e += e
+				c.n += n
+				c.count++
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		UPDATE callsigns
+		SET latitude = ?,
+		    longitude = ?,
+		    grid_square = ?
+		WHERE callsign = ? AND data_source = 'OFCOM'
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	updated := 0
+	for pc, c := range found {
+		callsigns := full[pc]
+		if callsigns == nil {
+			callsigns = outward[pc]
+		}
+
+		lat, lon := geo.OSGBToWGS84(c.e/float64(c.count), c.n/float64(c.count))
+		grid := geo.GridSquare(lat, lon)
+
+		for _, callsign := range callsigns {
+			if _, err := stmt.ExecContext(ctx, lat, lon, grid, callsign); err != nil {
+				return fmt.Errorf("failed to update location for %s: %w", callsign, err)
+			}
+			updated++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Geocoded %d UK records (%d postcodes not found in Code-Point Open)",
+		updated, len(full)+len(outward)-len(found))
+	return nil
+}
+
+// forEachCodePoint calls fn for every postcode with coordinates in path
+func forEachCodePoint(ctx context.Context, path string, fn func(postcode string, e, n float64)) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		files, err := filepath.Glob(filepath.Join(path, "*.csv"))
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no CSV files in %s", path)
+		}
+		for _, name := range files {
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			err = readCodePointCSV(ctx, f, fn)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		return nil
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		r, err := zip.OpenReader(path)
+		if err != nil {
+			return fmt.Errorf("failed to open zip: %w", err)
+		}
+		defer r.Close()
+
+		for _, f := range r.File {
+			// Postcode data lives under Data/CSV; Doc/ holds header and code lists
+			if !strings.EqualFold(filepath.Ext(f.Name), ".csv") || !strings.Contains(strings.ToLower(f.Name), "data/") {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = readCodePointCSV(ctx, rc, fn)
+			rc.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+		}
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return readCodePointCSV(ctx, f, fn)
+}
+
+// readCodePointCSV reads one Code-Point Open CSV file
+func readCodePointCSV(ctx context.Context, r io.Reader, fn func(postcode string, e, n float64)) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(row) < 4 {
+			continue
+		}
+
+		e, err1 := strconv.ParseFloat(strings.TrimSpace(row[2]), 64)
+		n, err2 := strconv.ParseFloat(strings.TrimSpace(row[3]), 64)
+		// Quality 90 rows (and any header row) have no usable coordinates
+		if err1 != nil || err2 != nil || (e == 0 && n == 0) {
+			continue
+		}
+
+		fn(row[0], e, n)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/batch"
+)
+
+// benchLicenses is how many licenses the ingest benchmarks load per run
+const benchLicenses = 20000
+
+// writeBenchFiles writes synthetic HD.dat and EN.dat files of benchLicenses
+// licenses to dir
+func writeBenchFiles(b *testing.B, dir string) (hd, en string) {
+	b.Helper()
+	hd, en = filepath.Join(dir, "HD.dat"), filepath.Join(dir, "EN.dat")
+	write := func(path string, line func(usi int, call string) string) {
+		f, err := os.Create(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		w := bufio.NewWriter(f)
+		for i := 0; i < benchLicenses; i++ {
+			call := fmt.Sprintf("K%d%c%c%c", i%10, 'A'+i/10%26, 'A'+i/260%26, 'A'+i/6760%26)
+			fmt.Fprintln(w, line(i+1, call))
+		}
+		if err := w.Flush(); err != nil {
+			b.Fatal(err)
+		}
+		f.Close()
+	}
+	write(hd, func(usi int, call string) string {
+		return fmt.Sprintf("HD|%d|||%s|A|HA|01/05/2020|01/05/2030||||||||||||||||||||||||||||||||||01/06/2020|01/06/2020", usi, call)
+	})
+	write(en, func(usi int, call string) string {
+		return fmt.Sprintf("EN|%d|||%s|L||John Q Public|John|Q|Public||||||1 Main St|Austin|TX|78701||||0001234567", usi, call)
+	})
+	return hd, en
+}
+
+// benchIngest runs load against a fresh database per iteration, reporting
+// licenses per second
+func benchIngest(b *testing.B, load func(ctx context.Context, p *Processor, hd, en string) error) {
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+	dir := b.TempDir()
+	hd, en := writeBenchFiles(b, dir)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		path := filepath.Join(dir, fmt.Sprintf("bench%d.sqlite", i))
+		p, err := NewProcessor(ctx, path, defaultTuning)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if p.batch, err = batch.Start(ctx, p.db.db, batch.FCC, "bench"); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+
+		if err := load(ctx, p, hd, en); err != nil {
+			b.Fatal(err)
+		}
+
+		b.StopTimer()
+		p.Close()
+		os.Remove(path)
+		b.StartTimer()
+	}
+	b.ReportMetric(float64(benchLicenses*b.N)/b.Elapsed().Seconds(), "licenses/s")
+}
+
+func BenchmarkLoadHDFile(b *testing.B) {
+	benchIngest(b, func(ctx context.Context, p *Processor, hd, en string) error {
+		return p.LoadHDFile(ctx, hd, "")
+	})
+}
+
+func BenchmarkLoadHDAndEN(b *testing.B) {
+	benchIngest(b, func(ctx context.Context, p *Processor, hd, en string) error {
+		if err := p.LoadHDFile(ctx, hd, ""); err != nil {
+			return err
+		}
+		if err := p.UpdateENData(ctx, en, ""); err != nil {
+			return err
+		}
+		return p.batch.Finish(ctx, p.db.db, nil)
+	})
+}
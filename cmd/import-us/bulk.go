@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// bulkTables are the tables whose secondary indexes are dropped during a
+// bulk load. Their primary keys stay, since every upsert and update looks
+// records up by key; comments keeps its callsign index for the same reason.
+var bulkTables = []string{"callsigns", "callsign_history"}
+
+// loadTables are the tables a load writes. The copy's are kept at the swap;
+// every other table is copied over from the original, which other processes
+// such as the API's admin endpoints may have written during the load.
+var loadTables = map[string]bool{
+	"callsigns":          true,
+	"callsign_history":   true,
+	"callsign_trigrams":  true,
+	"comments":           true,
+	"special_conditions": true,
+	"import_batches":     true,
+	"licenses":           true,
+}
+
+// bulkLoad is a full load into a copy of the database, which replaces the
+// original when the load succeeds. Writing without a journal or secondary
+// indexes and building the indexes once at the end is several times faster
+// than maintaining them through a million upserts, and readers keep the
+// original until the copy is renamed over it.
+type bulkLoad struct {
+	p       *Processor
+	dbPath  string
+	tmpPath string
+	orig    *Database
+	// indexes are the CREATE INDEX statements of the dropped indexes
+	indexes []string
+	// retired are the original's tables adopt added triggers to
+	retired []string
+}
+
+// beginBulkLoad copies the database to a file beside it and switches p to
+// the copy, with journaling off and the secondary indexes of bulkTables
+// dropped. finish swaps the copy in; abort discards it.
+func (p *Processor) beginBulkLoad(ctx context.Context, dbPath string) (*bulkLoad, error) {
+	tmpPath := dbPath + ".load"
+	// Left behind by an interrupted load
+	os.Remove(tmpPath)
+
+	start := time.Now()
+	log.Printf("Copying %s for a bulk load...", dbPath)
+	if _, err := p.db.db.ExecContext(ctx, "VACUUM main INTO ?", tmpPath); err != nil {
+		return nil, fmt.Errorf("failed to copy database: %w", err)
+	}
+
+	// The copy is discarded on failure, so it needs no journal; the
+	// options apply to every pooled connection
+	tmp, err := sql.Open("sqlite3", tmpPath+"?_journal_mode=OFF&_sync=OFF")
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to open database copy: %w", err)
+	}
+	tmp.SetMaxOpenConns(p.tuning.conns)
+	b := &bulkLoad{p: p, dbPath: dbPath, tmpPath: tmpPath, orig: p.db}
+	p.db = &Database{db: tmp}
+
+	for _, pragma := range []string{"PRAGMA cache_size=" + p.tuning.bulkCacheSize, "PRAGMA temp_store=" + p.tuning.tempStore} {
+		if _, err := tmp.ExecContext(ctx, pragma); err != nil {
+			b.abort()
+			return nil, fmt.Errorf("failed to set pragma: %w", err)
+		}
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(bulkTables)), ", ")
+	args := make([]interface{}, len(bulkTables))
+	for i, t := range bulkTables {
+		args[i] = t
+	}
+	rows, err := tmp.QueryContext(ctx, `
+		SELECT name, sql FROM sqlite_master
+		WHERE type = 'index' AND sql IS NOT NULL AND tbl_name IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		b.abort()
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	var names []string
+	for rows.Next() {
+		var name, stmt string
+		if err := rows.Scan(&name, &stmt); err != nil {
+			rows.Close()
+			b.abort()
+			return nil, err
+		}
+		names = append(names, name)
+		b.indexes = append(b.indexes, stmt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		b.abort()
+		return nil, err
+	}
+	for _, name := range names {
+		if _, err := tmp.ExecContext(ctx, `DROP INDEX "`+name+`"`); err != nil {
+			b.abort()
+			return nil, fmt.Errorf("failed to drop index %s: %w", name, err)
+		}
+	}
+
+	log.Printf("Bulk loading into %s with %d indexes dropped (copied in %s)",
+		tmpPath, len(names), time.Since(start).Round(time.Second))
+	return b, nil
+}
+
+// finish rebuilds the dropped indexes, brings over the tables the load
+// doesn't write, and renames the copy over the original database,
+// reopening p on it
+func (b *bulkLoad) finish(ctx context.Context) error {
+	tmp := b.p.db.db
+	start := time.Now()
+	log.Printf("Rebuilding %d indexes...", len(b.indexes))
+	for _, stmt := range b.indexes {
+		if _, err := tmp.ExecContext(ctx, stmt); err != nil {
+			b.abort()
+			return fmt.Errorf("failed to rebuild index: %w", err)
+		}
+	}
+	log.Printf("Rebuilt indexes in %s", time.Since(start).Round(time.Second))
+
+	if err := b.adopt(ctx, tmp); err != nil {
+		b.abort()
+		return err
+	}
+
+	// Readers expect the original's WAL mode, which is stored in the file
+	if _, err := tmp.ExecContext(ctx, "PRAGMA journal_mode=WAL"); err != nil {
+		b.release(ctx)
+		b.abort()
+		return fmt.Errorf("failed to set journal mode: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		b.release(ctx)
+		b.abort()
+		return err
+	}
+
+	// The original's WAL is empty and stays with the path; removing it
+	// would pull it from under readers still on the original
+	if err := os.Rename(b.tmpPath, b.dbPath); err != nil {
+		b.release(ctx)
+		b.abort()
+		return fmt.Errorf("failed to replace database: %w", err)
+	}
+	// SQLite leaves the WAL alone when closing a database that was moved
+	b.orig.Close()
+	log.Printf("Replaced %s with the bulk loaded copy", b.dbPath)
+
+	d, err := NewDatabase(ctx, b.dbPath, b.p.tuning)
+	if err != nil {
+		return err
+	}
+	b.p.db = d
+	return nil
+}
+
+// adopt copies the tables the load doesn't write from the original into the
+// copy and retires the original: with its write lock held, so nothing
+// slips in between, it adds triggers that fail every later write, and
+// then empties its WAL. A writer still holding the original after the
+// swap gets an error instead of writing into a file nobody reads, or into
+// a WAL the copy would pick up.
+func (b *bulkLoad) adopt(ctx context.Context, tmp *sql.DB) error {
+	conn, err := tmp.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA busy_timeout=30000"); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS orig", b.dbPath); err != nil {
+		return fmt.Errorf("failed to attach %s: %w", b.dbPath, err)
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE orig")
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", b.dbPath, err)
+	}
+
+	tables, err := attachedTables(ctx, conn)
+	if err != nil {
+		conn.ExecContext(ctx, "ROLLBACK")
+		return err
+	}
+	copied := 0
+	for _, t := range tables {
+		if !loadTables[t] {
+			if err := copyTable(ctx, conn, t); err != nil {
+				conn.ExecContext(ctx, "ROLLBACK")
+				return fmt.Errorf("failed to copy %s: %w", t, err)
+			}
+			copied++
+		}
+		for _, op := range []string{"INSERT", "UPDATE", "DELETE"} {
+			if _, err := conn.ExecContext(ctx, fmt.Sprintf(`
+				CREATE TRIGGER orig."%s" BEFORE %s ON "%s"
+				BEGIN SELECT RAISE(ABORT, 'database replaced by a bulk load'); END
+			`, retiredTrigger(t, op), op, t)); err != nil {
+				conn.ExecContext(ctx, "ROLLBACK")
+				return fmt.Errorf("failed to retire %s: %w", t, err)
+			}
+		}
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		conn.ExecContext(ctx, "ROLLBACK")
+		return fmt.Errorf("failed to copy tables: %w", err)
+	}
+	log.Printf("Copied %d tables the load doesn't write from %s", copied, b.dbPath)
+
+	// A WAL left with frames would be applied to the copy once it has the
+	// original's name
+	var busy, frames, done int
+	if err := conn.QueryRowContext(ctx, "PRAGMA orig.wal_checkpoint(TRUNCATE)").Scan(&busy, &frames, &done); err != nil || busy != 0 {
+		b.retired = tables
+		b.release(ctx)
+		if err == nil {
+			err = errors.New("database is busy")
+		}
+		return fmt.Errorf("failed to checkpoint %s: %w", b.dbPath, err)
+	}
+	b.retired = tables
+	return nil
+}
+
+// release drops the triggers adopt added to the original, for when the
+// copy doesn't replace it after all
+func (b *bulkLoad) release(ctx context.Context) {
+	for _, t := range b.retired {
+		for _, op := range []string{"INSERT", "UPDATE", "DELETE"} {
+			if _, err := b.orig.db.ExecContext(ctx, `DROP TRIGGER IF EXISTS "`+retiredTrigger(t, op)+`"`); err != nil {
+				log.Printf("Warning: failed to drop trigger on %s: %v", t, err)
+			}
+		}
+	}
+	b.retired = nil
+}
+
+// retiredTrigger names the trigger adopt adds to table t for op
+func retiredTrigger(t, op string) string {
+	return "trg_bulk_replaced_" + t + "_" + strings.ToLower(op)
+}
+
+// attachedTables lists the tables of the attached original
+func attachedTables(ctx context.Context, conn *sql.Conn) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT name FROM orig.sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// copyTable replaces the copy's rows of table t with the original's, in the
+// columns both have
+func copyTable(ctx context.Context, conn *sql.Conn, t string) error {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT o.name FROM pragma_table_info(?1, 'orig') o
+		JOIN pragma_table_info(?1, 'main') m ON m.name = o.name
+		ORDER BY o.cid
+	`, t)
+	if err != nil {
+		return err
+	}
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		columns = append(columns, `"`+name+`"`)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	list := strings.Join(columns, ", ")
+	if _, err := conn.ExecContext(ctx, `DELETE FROM main."`+t+`"`); err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, `INSERT INTO main."`+t+`" (`+list+`) SELECT `+list+` FROM orig."`+t+`"`)
+	return err
+}
+
+// abort discards the copy and switches p back to the original database
+func (b *bulkLoad) abort() {
+	if b.p.db != b.orig {
+		b.p.db.Close()
+		b.p.db = b.orig
+	}
+	os.Remove(b.tmpPath)
+}
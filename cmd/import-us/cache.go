@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// DownloadCache keeps downloaded archives on disk keyed by URL, along with the
+// validators needed for conditional GETs, so unchanged files aren't re-fetched.
+type DownloadCache struct {
+	Dir string
+}
+
+// cacheMeta holds the HTTP validators recorded for a cached download
+type cacheMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// NewDownloadCache creates the cache directory if needed
+func NewDownloadCache(dir string) (*DownloadCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &DownloadCache{Dir: dir}, nil
+}
+
+// paths returns the data and metadata file paths for url
+func (c *DownloadCache) paths(url string) (data, meta string) {
+	sum := sha256.Sum256([]byte(url))
+	key := hex.EncodeToString(sum[:16])
+	return filepath.Join(c.Dir, key+".data"), filepath.Join(c.Dir, key+".json")
+}
+
+// Lookup returns the validators for a cached copy of url, or nil if there is none
+func (c *DownloadCache) Lookup(url string) *cacheMeta {
+	dataPath, metaPath := c.paths(url)
+	if _, err := os.Stat(dataPath); err != nil {
+		return nil
+	}
+
+	b, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil
+	}
+
+	var meta cacheMeta
+	if err := json.Unmarshal(b, &meta); err != nil || meta.URL != url {
+		return nil
+	}
+	if meta.ETag == "" && meta.LastModified == "" {
+		return nil
+	}
+	return &meta
+}
+
+// Store records src as the cached copy of url with its validators
+func (c *DownloadCache) Store(url, src string, meta cacheMeta) error {
+	dataPath, metaPath := c.paths(url)
+
+	tmp := dataPath + ".tmp"
+	if err := copyFile(src, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dataPath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	meta.URL = url
+	b, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath, b, 0o644)
+}
+
+// CopyTo copies the cached copy of url to destination
+func (c *DownloadCache) CopyTo(url, destination string) error {
+	dataPath, _ := c.paths(url)
+	return copyFile(dataPath, destination)
+}
+
+// copyFile copies src to dst, hard-linking when both are on the same filesystem
+func copyFile(src, dst string) error {
+	os.Remove(dst)
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ProcessCOFile loads CO.dat (license comments) into the comments table. As
+// with special conditions, a license's comments are replaced as a set.
+func (p *Processor) ProcessCOFile(ctx context.Context, coFile, filterCallsign string) error {
+	file, err := os.Open(coFile)
+	if err != nil {
+		return fmt.Errorf("failed to open CO file: %w", err)
+	}
+	defer file.Close()
+
+	log.Printf("Processing comments from: %s", coFile)
+
+	reader := newULSReader(file, filepath.Base(coFile), p.quarantine)
+
+	tx, err := p.beginLoad(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	deleteStmt, err := tx.prepare(ctx, `DELETE FROM comments WHERE callsign = ?`)
+	if err != nil {
+		return err
+	}
+	defer deleteStmt.Close()
+
+	insertStmt, err := tx.prepare(ctx, `
+		INSERT INTO comments (
+			callsign, unique_system_identifier, comment_date, description, status_code, status_date
+		) SELECT ?1, ?2, ?3, ?4, ?5, ?6
+		WHERE `+ownedByLicenseSQL("?1", "?2")+`
+	`)
+	if err != nil {
+		return err
+	}
+	defer insertStmt.Close()
+
+	seen := make(map[string]bool)
+	count := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// CO|usi|file_num|callsign|comment_date|description|status_code|status_date
+		// Unlike most record types, CO has no EBF number, so the callsign is field 3.
+		if !reader.expect(row, "CO", 6) {
+			continue
+		}
+
+		callsign := strings.TrimSpace(row[3])
+		description := strings.TrimSpace(row[5])
+		if callsign == "" {
+			reader.reject("no callsign")
+			continue
+		}
+		if description == "" {
+			reader.reject("no comment text")
+			continue
+		}
+
+		if filterCallsign != "" && !strings.EqualFold(callsign, filterCallsign) {
+			continue
+		}
+
+		if !seen[callsign] {
+			if _, err := deleteStmt.ExecContext(ctx, callsign); err != nil {
+				reader.reject("write failed: " + err.Error())
+				continue
+			}
+			seen[callsign] = true
+		}
+
+		statusCode := ""
+		statusDate := ""
+		if len(row) > 6 {
+			statusCode = strings.TrimSpace(row[6])
+		}
+		if len(row) > 7 {
+			statusDate = strings.TrimSpace(row[7])
+		}
+
+		result, err := insertStmt.ExecContext(ctx,
+			callsign,
+			strings.TrimSpace(row[1]),
+			strings.TrimSpace(row[4]),
+			description,
+			statusCode,
+			statusDate,
+		)
+		if err != nil {
+			reader.reject("write failed: " + err.Error())
+			continue
+		}
+		if err := tx.next(ctx); err != nil {
+			return err
+		}
+		// Comments of another license holding the callsign aren't kept
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+
+		count++
+		if count%10000 == 0 {
+			log.Printf("  Loaded %d CO records...", count)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Loaded %d comment records for %d callsigns", count, len(seen))
+	reader.logSummary()
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProcessSFFile loads SF.dat (license free-form special conditions) into the
+// special_conditions table. Each license's conditions are replaced as a set the
+// first time it is seen, since ULS publishes the complete set on every change.
+func (p *Processor) ProcessSFFile(ctx context.Context, sfFile, filterCallsign string) error {
+	file, err := os.Open(sfFile)
+	if err != nil {
+		return fmt.Errorf("failed to open SF file: %w", err)
+	}
+	defer file.Close()
+
+	log.Printf("Processing special conditions from: %s", sfFile)
+
+	reader := newULSReader(file, filepath.Base(sfFile), p.quarantine)
+
+	tx, err := p.beginLoad(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	deleteStmt, err := tx.prepare(ctx, `DELETE FROM special_conditions WHERE callsign = ?`)
+	if err != nil {
+		return err
+	}
+	defer deleteStmt.Close()
+
+	insertStmt, err := tx.prepare(ctx, `
+		INSERT OR REPLACE INTO special_conditions (
+			callsign, unique_system_identifier, condition_type, condition_id,
+			sequence_number, condition_text, status_code, status_date
+		) SELECT ?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8
+		WHERE `+ownedByLicenseSQL("?1", "?2")+`
+	`)
+	if err != nil {
+		return err
+	}
+	defer insertStmt.Close()
+
+	seen := make(map[string]bool)
+	count := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// SF|usi|file_num|ebf|callsign|type|condition_id|sequence|text|status_code|status_date
+		if !reader.expect(row, "SF", 9) {
+			continue
+		}
+
+		callsign := strings.TrimSpace(row[4])
+		if callsign == "" {
+			reader.reject("no callsign")
+			continue
+		}
+
+		if filterCallsign != "" && !strings.EqualFold(callsign, filterCallsign) {
+			continue
+		}
+
+		if !seen[callsign] {
+			if _, err := deleteStmt.ExecContext(ctx, callsign); err != nil {
+				reader.reject("write failed: " + err.Error())
+				continue
+			}
+			seen[callsign] = true
+		}
+
+		sequence, _ := strconv.Atoi(strings.TrimSpace(row[7]))
+		statusCode := ""
+		statusDate := ""
+		if len(row) > 9 {
+			statusCode = strings.TrimSpace(row[9])
+		}
+		if len(row) > 10 {
+			statusDate = strings.TrimSpace(row[10])
+		}
+
+		result, err := insertStmt.ExecContext(ctx,
+			callsign,
+			strings.TrimSpace(row[1]),
+			strings.TrimSpace(row[5]),
+			strings.TrimSpace(row[6]),
+			sequence,
+			strings.TrimSpace(row[8]),
+			statusCode,
+			statusDate,
+		)
+		if err != nil {
+			reader.reject("write failed: " + err.Error())
+			continue
+		}
+		if err := tx.next(ctx); err != nil {
+			return err
+		}
+		// Conditions of another license holding the callsign aren't kept
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+
+		count++
+		if count%10000 == 0 {
+			log.Printf("  Loaded %d SF records...", count)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Loaded %d special condition records for %d callsigns", count, len(seen))
+	reader.logSummary()
+	return nil
+}
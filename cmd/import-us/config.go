@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Config holds download settings resolved from flags, the environment, and an
+// optional KEY=VALUE config file, in that order of precedence.
+type Config struct {
+	// FullURLs are tried in order until one downloads successfully
+	FullURLs []string
+	// DailyURLFmts are fmt templates taking the MMDDYYYY date, tried in order
+	DailyURLFmts []string
+	// CacheDir enables the conditional-GET download cache when set
+	CacheDir string
+}
+
+// LoadConfig resolves download settings for a ULS service (see -service) from
+// the raw -full-url, -daily-url, and -cache-dir flag values; configPath may be
+// empty. Other services read their own variables (GMRS_FULL_URL,
+// COML_DAILY_URL, ...) so amateur mirrors aren't used for their dumps.
+func LoadConfig(configPath, service, flagFull, flagDaily, flagCache string) (*Config, error) {
+	file := map[string]string{}
+	if configPath != "" {
+		var err error
+		file, err = readConfigFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	prefix, fullURL, dailyURLFmt := "ULS", FullDatabaseURL, DailyUpdateURLFmt
+	switch service {
+	case ServiceAmateur:
+	case ServiceGMRS:
+		prefix, fullURL, dailyURLFmt = "GMRS", GMRSFullDatabaseURL, GMRSDailyUpdateURLFmt
+	case ServiceCommercial:
+		prefix, fullURL, dailyURLFmt = "COML", CommercialFullDatabaseURL, CommercialDailyUpdateURLFmt
+	default:
+		return nil, fmt.Errorf("unknown service %q (expected %s, %s, or %s)", service, ServiceAmateur, ServiceGMRS, ServiceCommercial)
+	}
+
+	cfg := &Config{
+		FullURLs:     splitList(resolveSetting(flagFull, prefix+"_FULL_URL", file, fullURL)),
+		DailyURLFmts: splitList(resolveSetting(flagDaily, prefix+"_DAILY_URL", file, dailyURLFmt)),
+		CacheDir:     resolveSetting(flagCache, "ULS_CACHE_DIR", file, ""),
+	}
+
+	for _, u := range cfg.DailyURLFmts {
+		if strings.Count(u, "%s") != 1 {
+			return nil, fmt.Errorf("daily URL %q must contain exactly one %%s for the date", u)
+		}
+	}
+
+	return cfg, nil
+}
+
+// resolveSetting returns the flag value, else the environment variable, else
+// the config file entry, else the default.
+func resolveSetting(flagVal, key string, file map[string]string, def string) string {
+	if flagVal != "" {
+		return flagVal
+	}
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	if v := file[key]; v != "" {
+		return v
+	}
+	return def
+}
+
+// readConfigFile parses a KEY=VALUE file (the same format as env.example).
+// Blank lines and lines starting with # are ignored.
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNum)
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		values[strings.TrimSpace(key)] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return values, nil
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EN.dat can hold several rows per license, one per entity: the licensee
+// (type L) and, e.g. for club licenses, a contact person (CL) or other
+// parties to an application. Applying them in file order let whichever row
+// came last overwrite the licensee's name and address, so a club could end
+// up with its trustee's name. Each license instead records the type of the
+// EN row its name came from, and a row only applies if it ranks at least as
+// high.
+
+// entityRank ranks an EN entity type code: the licensee, then other
+// parties, then contacts
+func entityRank(entityType string) int {
+	switch {
+	case entityType == "L":
+		return 2
+	case strings.HasPrefix(entityType, "C"):
+		return 0
+	default:
+		return 1
+	}
+}
+
+// entityRankSQL is entityRank of the entity_type column, or -1 if no EN
+// row has been applied to the license yet
+const entityRankSQL = `(CASE WHEN entity_type IS NULL THEN -1 WHEN entity_type = 'L' THEN 2 WHEN entity_type LIKE 'C%' THEN 0 ELSE 1 END)`
+
+// enColumns are the license columns an EN row fills, from the EN fields
+// at the same index of enFields
+var (
+	enColumns = []string{"entity_name", "first_name", "mi", "last_name", "suffix", "street_address", "city", "state", "zip_code", "frn"}
+	enFields  = []int{7, 8, 9, 10, 11, 15, 16, 17, 18, 22}
+)
+
+// enUpdateSQL returns the statement applying an EN row to its license, with
+// the arguments enArgs returns.
+//
+// A row ranking below the one already applied is ignored. A row ranking
+// the same only fills the fields it has, keeping the HD.dat names when it
+// has none, while one ranking higher replaces a lower row's fields outright
+// so none of a contact's details are left behind.
+func enUpdateSQL() string {
+	n := len(enColumns)
+	var b strings.Builder
+	b.WriteString("UPDATE licenses SET\n")
+	for i, col := range enColumns {
+		fmt.Fprintf(&b, "\t%[1]s = CASE WHEN ?%[2]d != '' OR (?%[3]d > %[4]s AND entity_type IS NOT NULL) THEN ?%[2]d ELSE %[1]s END,\n",
+			col, i+1, n+1, entityRankSQL)
+	}
+	fmt.Fprintf(&b, "\tentity_type = ?%d,\n", n+2)
+	b.WriteString("\tlast_updated = CURRENT_TIMESTAMP\n")
+	fmt.Fprintf(&b, "WHERE unique_system_identifier = ?%d AND ?%d >= %s", n+3, n+1, entityRankSQL)
+	return b.String()
+}
+
+// enArgs returns the enUpdateSQL arguments for an EN row
+func enArgs(row []string) []interface{} {
+	args := make([]interface{}, 0, len(enFields)+3)
+	for _, i := range enFields {
+		args = append(args, field(row, i))
+	}
+	entityType := field(row, 5)
+	return append(args, entityRank(entityType), entityType, field(row, 1))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeZip writes an archive of entries with the given sizes to dir
+func writeZip(t *testing.T, dir string, sizes ...int) string {
+	t.Helper()
+	path := filepath.Join(dir, "test.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for i, size := range sizes {
+		e, err := w.Create(string(rune('A'+i)) + ".dat")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Write(bytes.Repeat([]byte("x"), size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractZipLimits(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	fileSize, totalSize := MaxZipFileSize, MaxZipTotalSize
+	MaxZipFileSize, MaxZipTotalSize = 1000, 1500
+	t.Cleanup(func() { MaxZipFileSize, MaxZipTotalSize = fileSize, totalSize })
+
+	tests := []struct {
+		name  string
+		sizes []int
+		err   string
+	}{
+		{"within limits", []int{1000, 500}, ""},
+		{"entry too big", []int{1001}, "is 1001 bytes"},
+		// Each entry is under the per-file limit, but together they aren't
+		{"total too big", []int{600, 600, 600}, "zip contents exceed 1500 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dest := filepath.Join(dir, "out")
+			err := (&Processor{}).ExtractZip(writeZip(t, dir, tt.sizes...), dest)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("ExtractZip: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("ExtractZip = %v, want %q", err, tt.err)
+			}
+
+			// Extraction stops a byte past the limit rather than at the end
+			// of the entry that broke it
+			var written int64
+			entries, _ := os.ReadDir(dest)
+			for _, e := range entries {
+				info, err := e.Info()
+				if err != nil {
+					t.Fatal(err)
+				}
+				written += info.Size()
+			}
+			if written > MaxZipTotalSize+1 {
+				t.Errorf("wrote %d bytes, want at most %d", written, MaxZipTotalSize+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ulsLayout is the shape of a ULS record type the importer parses
+type ulsLayout struct {
+	// MinFields and MaxFields bound the fields per record; MaxFields 0
+	// leaves it unbounded
+	MinFields, MaxFields int
+}
+
+// ulsLayouts are the record types the importer reads, by file, with the
+// field counts of the FCC's public access data definitions. A change in
+// the count means fields were added, removed, or moved, and the indexes
+// the loaders read from would silently pick up the wrong columns.
+var ulsLayouts = map[string]ulsLayout{
+	"HD": {MinFields: 59, MaxFields: 59},
+	// EN grew from 27 fields to 30 (the 3.7 GHz and linked license fields)
+	"EN": {MinFields: 27, MaxFields: 30},
+	"AM": {MinFields: 18, MaxFields: 18},
+	"SF": {MinFields: 11, MaxFields: 11},
+	"CO": {MinFields: 8, MaxFields: 8},
+}
+
+const (
+	// ulsFormatSample is how many records of each file are checked
+	ulsFormatSample = 10000
+	// ulsFormatTolerance is the fraction of sampled records that may be of
+	// another type or have an unexpected field count, since a few
+	// malformed records turn up in most files and go to the quarantine
+	ulsFormatTolerance = 0.01
+)
+
+// ulsRatio bounds a file's record count relative to HD.dat's in a full
+// download, where every license has one of each
+type ulsRatio struct {
+	file     string
+	min, max float64
+}
+
+var ulsFullRatios = []ulsRatio{
+	{"EN.dat", 0.5, 2},
+	{"AM.dat", 0.5, 1.5},
+}
+
+// checkULSFormat checks the layout of the extracted .dat files the
+// importer reads before anything is loaded: that each file's records are
+// of its own type with the expected number of fields, and in a full
+// download that the files have records and EN and AM records roughly
+// match the HD records in number. It returns an error describing every
+// file that doesn't, since parsing them would put values in the wrong
+// columns.
+func checkULSFormat(dir string, full bool) error {
+	var problems []string
+	for _, recordType := range sortedULSTypes() {
+		name := recordType + ".dat"
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		problem, err := checkULSFile(path, recordType, ulsLayouts[recordType])
+		if err != nil {
+			return err
+		}
+		if problem != "" {
+			problems = append(problems, name+": "+problem)
+		}
+	}
+
+	if full && len(problems) == 0 {
+		hd, err := countULSLines(filepath.Join(dir, "HD.dat"))
+		if err != nil {
+			return err
+		}
+		if hd == 0 {
+			problems = append(problems, "HD.dat: no records in a full download")
+		}
+		for _, r := range ulsFullRatios {
+			n, err := countULSLines(filepath.Join(dir, r.file))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if hd > 0 && (float64(n) < r.min*float64(hd) || float64(n) > r.max*float64(hd)) {
+				problems = append(problems, fmt.Sprintf("%s: %d records for %d HD records, expected %.1f to %.1f per HD record",
+					r.file, n, hd, r.min, r.max))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("ULS files don't match the expected format; the FCC may have changed it, so nothing was loaded:\n  %s",
+			strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// checkULSFile samples the start of a .dat file and describes how it
+// differs from layout, or returns "" if it matches
+func checkULSFile(path, recordType string, layout ulsLayout) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// Malformed lines are the loader's to quarantine; only their count
+	// matters here
+	reader := newULSReader(file, filepath.Base(path), nil)
+	var records, foreign, badCount int
+	types := map[string]int{}
+	counts := map[int]int{}
+	for records < ulsFormatSample {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		records++
+		if row[0] != recordType {
+			foreign++
+			types[row[0]]++
+			continue
+		}
+		counts[len(row)]++
+		if len(row) < layout.MinFields || (layout.MaxFields > 0 && len(row) > layout.MaxFields) {
+			badCount++
+		}
+	}
+	if records == 0 {
+		return "", nil
+	}
+
+	tolerated := int(ulsFormatTolerance * float64(records))
+	if foreign > tolerated {
+		return fmt.Sprintf("%d of %d sampled records are other record types (mostly %s)",
+			foreign, records, mostCommon(types)), nil
+	}
+	if badCount > tolerated {
+		return fmt.Sprintf("%d of %d sampled records have an unexpected number of fields (mostly %s, expected %s)",
+			badCount, records, mostCommon(counts), layout.fieldRange()), nil
+	}
+	return "", nil
+}
+
+// fieldRange describes the layout's field count
+func (l ulsLayout) fieldRange() string {
+	switch {
+	case l.MaxFields == 0:
+		return fmt.Sprintf("at least %d", l.MinFields)
+	case l.MinFields == l.MaxFields:
+		return fmt.Sprint(l.MinFields)
+	default:
+		return fmt.Sprintf("%d to %d", l.MinFields, l.MaxFields)
+	}
+}
+
+// mostCommon returns the most frequent key of counts
+func mostCommon[K comparable](counts map[K]int) string {
+	var best K
+	n := -1
+	for k, c := range counts {
+		if c > n || (c == n && fmt.Sprint(k) < fmt.Sprint(best)) {
+			best, n = k, c
+		}
+	}
+	return fmt.Sprint(best)
+}
+
+// countULSLines counts the lines of a file starting with a record type,
+// which is its record count without parsing it
+func countULSLines(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReaderSize(file, 64<<10)
+	count := 0
+	for {
+		line, err := r.ReadSlice('\n')
+		if isULSRecordStart(line) {
+			count++
+		}
+		// The rest of a line longer than the buffer
+		for err == bufio.ErrBufferFull {
+			_, err = r.ReadSlice('\n')
+		}
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// sortedULSTypes returns the record types with a layout, in a fixed order
+func sortedULSTypes() []string {
+	types := make([]string, 0, len(ulsLayouts))
+	for t := range ulsLayouts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
+)
+
+// A callsign can appear on more than one ULS license. The FCC reissues
+// callsigns after a license expires or a vanity change releases them, and
+// the full dump keeps the old license's rows beside the new one's. Keyed on
+// the callsign alone, both licenses' rows were merged into one record, so a
+// reissued callsign could carry its previous holder's name, class, address,
+// and history.
+//
+// The loaders instead write every ULS row to the licenses table, keyed on
+// the license's unique system identifier (USI), which every row carries:
+// HD rows create or update a license, and EN, AM, and LA rows fill in their
+// own license's fields. Nothing is merged across licenses. Once the files
+// are loaded, publishLicenses rebuilds the record of every callsign the
+// batch touched from its current license (see currentLicenseSQL), which is
+// what the API and the other tables see.
+
+// licenseColumns are the licenses columns published to the record of the
+// license's callsign, where the table has them
+var licenseColumns = []string{
+	"unique_system_identifier", "license_status", "radio_service_code",
+	"grant_date", "expired_date", "cancellation_date", "effective_date", "last_action_date",
+	"operator_class", "group_code", "region_code",
+	"first_name", "mi", "last_name", "suffix", "entity_name", "entity_type",
+	"street_address", "city", "state", "zip_code",
+	"latitude", "longitude", "grid_square", "frn",
+}
+
+// licenseUpsertSQL returns the statement loading an HD row into licenses:
+// the arguments are the USI, service, callsign, import batch, and then the
+// columns. A license's fields are only overwritten by values the row has.
+func licenseUpsertSQL(columns ...string) string {
+	sets := make([]string, len(columns))
+	for i, c := range columns {
+		sets[i] = fmt.Sprintf("%[1]s = CASE WHEN excluded.%[1]s != '' THEN excluded.%[1]s ELSE licenses.%[1]s END", c)
+	}
+	return fmt.Sprintf(`
+		INSERT INTO licenses (unique_system_identifier, service, callsign, import_batch, %s)
+		VALUES (?, ?, ?, ?%s)
+		ON CONFLICT(unique_system_identifier) DO UPDATE SET
+			callsign = excluded.callsign,
+			import_batch = excluded.import_batch,
+			%s,
+			last_updated = CURRENT_TIMESTAMP
+	`, strings.Join(columns, ", "), strings.Repeat(", ?", len(columns)), strings.Join(sets, ",\n\t\t\t"))
+}
+
+// currentLicenseSQL selects the USI of the current license of the callsign
+// expression call among service's licenses: an active license beats an
+// inactive one, and otherwise the later grant, then the later license, wins
+func currentLicenseSQL(service, call string) string {
+	return fmt.Sprintf(`(SELECT unique_system_identifier FROM licenses
+		WHERE service = %s AND callsign = %s
+		ORDER BY COALESCE(license_status, '') = 'A' DESC, COALESCE(%s, '') DESC,
+			CAST(unique_system_identifier AS INTEGER) DESC
+		LIMIT 1)`, service, call, schema.ISODate("grant_date", true))
+}
+
+// publishLicenses rebuilds the records of table for the callsigns of source
+// whose licenses batchID loaded, from each callsign's current license, and
+// returns how many it wrote. The record of a callsign that moved to another
+// license is rebuilt too, or removed when no license holds the callsign
+// any more. A record switching licenses starts over, so it doesn't keep the
+// previous holder's licensed_since or history.
+func publishLicenses(ctx context.Context, db *sql.DB, source, table string, batchID int64) (int64, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	has := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		has[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// callsigns holds every source's records; the service tables only theirs
+	key, match, extraCols, extraVals := "callsign", "", "", ""
+	if table == "callsigns" {
+		key, match = "callsign, data_source", "AND data_source = ?1"
+		extraCols, extraVals = ", data_source, country", ", ?1, 'United States'"
+	}
+
+	var columns, sets []string
+	for _, c := range licenseColumns {
+		if !has[c] {
+			continue
+		}
+		columns = append(columns, c)
+		if c == "unique_system_identifier" {
+			continue
+		}
+		// A record loaded before licenses were stored keeps what its
+		// license doesn't have yet
+		sets = append(sets, fmt.Sprintf(
+			"%[1]s = CASE WHEN %[2]s.unique_system_identifier IS NULL AND COALESCE(excluded.%[1]s, '') = '' THEN %[2]s.%[1]s ELSE excluded.%[1]s END",
+			c, table))
+	}
+	list := strings.Join(columns, ", ")
+	values := "l." + strings.Join(columns, ", l.")
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmts := []struct {
+		what string
+		sql  string
+		args []interface{}
+	}{
+		{"list touched callsigns", `
+			CREATE TEMP TABLE touched_callsigns AS
+			SELECT callsign FROM licenses WHERE service = ?1 AND import_batch = ?2
+			UNION
+			SELECT t.callsign FROM ` + table + ` t
+			JOIN licenses l ON l.unique_system_identifier = t.unique_system_identifier
+			WHERE l.service = ?1 AND l.import_batch = ?2 ` + strings.ReplaceAll(match, "data_source", "t.data_source"),
+			[]interface{}{source, batchID}},
+		{"remove records without a license", `
+			DELETE FROM ` + table + `
+			WHERE callsign IN (SELECT callsign FROM temp.touched_callsigns) ` + match + `
+			  AND unique_system_identifier IS NOT NULL
+			  AND NOT EXISTS (SELECT 1 FROM licenses l WHERE l.service = ?1 AND l.callsign = ` + table + `.callsign)`,
+			[]interface{}{source}},
+		{"publish licenses", `
+			INSERT INTO ` + table + ` (callsign, ` + list + `, import_batch` + extraCols + `)
+			SELECT t.callsign, ` + values + `, ?2` + extraVals + `
+			FROM temp.touched_callsigns t
+			JOIN licenses l ON l.unique_system_identifier = ` + currentLicenseSQL("?1", "t.callsign") + `
+			WHERE 1
+			ON CONFLICT(` + key + `) DO UPDATE SET
+				unique_system_identifier = excluded.unique_system_identifier,
+				` + strings.Join(sets, ",\n\t\t\t\t") + `,
+				licensed_since = CASE WHEN ` + table + `.unique_system_identifier != excluded.unique_system_identifier
+					THEN NULL ELSE ` + table + `.licensed_since END,
+				import_batch = excluded.import_batch,
+				last_updated = CURRENT_TIMESTAMP`,
+			[]interface{}{source, batchID}},
+		{"drop touched callsigns", "DROP TABLE temp.touched_callsigns", nil},
+	}
+	var published int64
+	for _, s := range stmts {
+		res, err := tx.ExecContext(ctx, s.sql, s.args...)
+		if err != nil {
+			return 0, fmt.Errorf("failed to %s: %w", s.what, err)
+		}
+		if s.what == "publish licenses" {
+			published, _ = res.RowsAffected()
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	log.Printf("Published %d %s records from their current licenses", published, source)
+	return published, nil
+}
+
+// pruneLicenses deletes the licenses of source a full load didn't have,
+// before they are published. Like batch.Prune, it refuses to run if the
+// batch loaded nothing.
+func pruneLicenses(ctx context.Context, db *sql.DB, source string, batchID int64) error {
+	var loaded int64
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM licenses WHERE service = ? AND import_batch = ?", source, batchID).Scan(&loaded); err != nil {
+		return err
+	}
+	if loaded == 0 {
+		return fmt.Errorf("batch %d loaded no licenses; refusing to prune %s licenses", batchID, source)
+	}
+	res, err := db.ExecContext(ctx, `
+		DELETE FROM licenses
+		WHERE service = ? AND (import_batch IS NULL OR import_batch != ?)
+	`, source, batchID)
+	if err != nil {
+		return fmt.Errorf("failed to prune %s licenses: %w", source, err)
+	}
+	n, _ := res.RowsAffected()
+	log.Printf("Pruned %d %s licenses not present in batch %d", n, source, batchID)
+	return nil
+}
+
+// publish brings table up to date with the licenses of source batchID
+// loaded. A full load first drops the licenses it didn't have.
+func (p *Processor) publish(ctx context.Context, source, table string, batchID int64, full bool) error {
+	return tracing.Run(ctx, "publish licenses", func(ctx context.Context) error {
+		if full {
+			if err := pruneLicenses(ctx, p.db.db, source, batchID); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+		_, err := publishLicenses(ctx, p.db.db, source, table, batchID)
+		return err
+	})
+}
+
+// ownedByLicenseSQL is true unless the FCC record of the callsign bound to
+// callParam belongs to a license other than the USI bound to usiParam, for
+// the tables like comments that hold rows per callsign
+func ownedByLicenseSQL(callParam, usiParam string) string {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM callsigns
+		WHERE callsign = %s AND data_source = 'FCC' AND unique_system_identifier != %s)`, callParam, usiParam)
+}
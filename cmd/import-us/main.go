@@ -2,26 +2,51 @@ package main
 
 import (
 	"archive/zip"
+	"context"
 	"database/sql"
-	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/chriskacerguis/hamqrzdb/internal/batch"
+	"github.com/chriskacerguis/hamqrzdb/internal/geo"
+	"github.com/chriskacerguis/hamqrzdb/internal/httpclient"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+	"github.com/chriskacerguis/hamqrzdb/internal/shard"
+	_ "github.com/chriskacerguis/hamqrzdb/internal/sqlite"
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
 )
 
 const (
 	FullDatabaseURL   = "https://data.fcc.gov/download/pub/uls/complete/l_amat.zip"
 	DailyUpdateURLFmt = "https://data.fcc.gov/download/pub/uls/daily/l_am_%s.zip"
 	BatchSize         = 1000
+
+	GMRSFullDatabaseURL   = "https://data.fcc.gov/download/pub/uls/complete/l_gmrs.zip"
+	GMRSDailyUpdateURLFmt = "https://data.fcc.gov/download/pub/uls/daily/l_gm_%s.zip"
+
+	CommercialFullDatabaseURL   = "https://data.fcc.gov/download/pub/uls/complete/l_coml.zip"
+	CommercialDailyUpdateURLFmt = "https://data.fcc.gov/download/pub/uls/daily/l_cm_%s.zip"
+)
+
+// Limits applied when extracting ZIP archives. The full l_amat.zip expands
+// to roughly 1.5GB, so these leave plenty of headroom.
+var (
+	MaxZipFiles           = 100
+	MaxZipFileSize  int64 = 4 << 30
+	MaxZipTotalSize int64 = 8 << 30
 )
 
 // CallsignRecord represents a complete callsign record
@@ -55,89 +80,54 @@ type Database struct {
 }
 
 // NewDatabase creates a new database connection
-func NewDatabase(dbPath string) (*Database, error) {
+func NewDatabase(ctx context.Context, dbPath string, t tuning) (*Database, error) {
 	log.Printf("Connecting to database: %s", dbPath)
 
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	db.SetMaxOpenConns(t.conns)
 
 	// Optimize SQLite for bulk inserts
 	pragmas := []string{
+		"PRAGMA auto_vacuum=INCREMENTAL", // only applies to new databases
 		"PRAGMA journal_mode=WAL",
 		"PRAGMA synchronous=NORMAL",
-		"PRAGMA cache_size=10000",
-		"PRAGMA temp_store=MEMORY",
+		"PRAGMA cache_size=" + t.cacheSize,
+		"PRAGMA temp_store=" + t.tempStore,
 	}
 
 	for _, pragma := range pragmas {
-		if _, err := db.Exec(pragma); err != nil {
+		if _, err := db.ExecContext(ctx, pragma); err != nil {
 			return nil, fmt.Errorf("failed to set pragma: %w", err)
 		}
 	}
 
 	d := &Database{db: db}
-	if err := d.createTables(); err != nil {
+	if err := d.createTables(ctx); err != nil {
 		return nil, err
 	}
 
 	return d, nil
 }
 
-// createTables creates the database schema
-func (d *Database) createTables() error {
-	log.Println("Creating/verifying database schema...")
-
-	schema := `
-	CREATE TABLE IF NOT EXISTS callsigns (
-		callsign TEXT PRIMARY KEY,
-		license_status TEXT,
-		radio_service_code TEXT,
-		grant_date TEXT,
-		expired_date TEXT,
-		cancellation_date TEXT,
-		operator_class TEXT,
-		group_code TEXT,
-		region_code TEXT,
-		first_name TEXT,
-		mi TEXT,
-		last_name TEXT,
-		suffix TEXT,
-		entity_name TEXT,
-		street_address TEXT,
-		city TEXT,
-		state TEXT,
-		zip_code TEXT,
-		latitude REAL,
-		longitude REAL,
-		grid_square TEXT,
-		last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_callsign ON callsigns(callsign);
-	CREATE INDEX IF NOT EXISTS idx_status ON callsigns(license_status);
-	`
-
-	if _, err := d.db.Exec(schema); err != nil {
-		return fmt.Errorf("failed to create schema: %w", err)
-	}
-
-	log.Println("Database schema ready")
-	return nil
+// createTables creates or migrates the database schema
+func (d *Database) createTables(ctx context.Context) error {
+	return schema.Ensure(ctx, d.db)
 }
 
 // UpsertCallsign inserts or updates a callsign record
-func (d *Database) UpsertCallsign(record CallsignRecord) error {
+func (d *Database) UpsertCallsign(ctx context.Context, record CallsignRecord) error {
 	query := `
 		INSERT INTO callsigns (
 			callsign, license_status, radio_service_code, grant_date,
 			expired_date, cancellation_date, operator_class, group_code,
 			region_code, first_name, mi, last_name, suffix, entity_name,
 			street_address, city, state, zip_code, latitude, longitude,
-			grid_square, last_updated
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
-		ON CONFLICT(callsign) DO UPDATE SET
+			grid_square, data_source, last_updated
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'FCC', CURRENT_TIMESTAMP)
+		ON CONFLICT(callsign, data_source) DO UPDATE SET
 			license_status = CASE WHEN excluded.license_status != '' THEN excluded.license_status ELSE callsigns.license_status END,
 			radio_service_code = CASE WHEN excluded.radio_service_code != '' THEN excluded.radio_service_code ELSE callsigns.radio_service_code END,
 			grant_date = CASE WHEN excluded.grant_date != '' THEN excluded.grant_date ELSE callsigns.grant_date END,
@@ -161,7 +151,7 @@ func (d *Database) UpsertCallsign(record CallsignRecord) error {
 			last_updated = CURRENT_TIMESTAMP
 	`
 
-	_, err := d.db.Exec(query,
+	_, err := d.db.ExecContext(ctx, query,
 		record.Callsign, record.LicenseStatus, record.RadioServiceCode, record.GrantDate,
 		record.ExpiredDate, record.CancellationDate, record.OperatorClass, record.GroupCode,
 		record.RegionCode, record.FirstName, record.MI, record.LastName, record.Suffix,
@@ -173,21 +163,21 @@ func (d *Database) UpsertCallsign(record CallsignRecord) error {
 }
 
 // GetCallsign retrieves a callsign record
-func (d *Database) GetCallsign(callsign string) (*CallsignRecord, error) {
+func (d *Database) GetCallsign(ctx context.Context, callsign string) (*CallsignRecord, error) {
 	query := `
 		SELECT callsign, license_status, radio_service_code, grant_date,
 			expired_date, cancellation_date, operator_class, group_code,
 			region_code, first_name, mi, last_name, suffix, entity_name,
 			street_address, city, state, zip_code, latitude, longitude, grid_square
 		FROM callsigns
-		WHERE UPPER(callsign) = UPPER(?)
+		WHERE UPPER(callsign) = UPPER(?) AND data_source = 'FCC'
 	`
 
 	var record CallsignRecord
 	var lat, lon sql.NullFloat64
 	var mi, suffix, firstName, lastName, entityName, streetAddress, city, state, zipCode, gridSquare sql.NullString
 
-	err := d.db.QueryRow(query, callsign).Scan(
+	err := d.db.QueryRowContext(ctx, query, callsign).Scan(
 		&record.Callsign, &record.LicenseStatus, &record.RadioServiceCode, &record.GrantDate,
 		&record.ExpiredDate, &record.CancellationDate, &record.OperatorClass, &record.GroupCode,
 		&record.RegionCode, &firstName, &mi, &lastName, &suffix,
@@ -242,15 +232,15 @@ func (d *Database) GetCallsign(callsign string) (*CallsignRecord, error) {
 }
 
 // GetCallsignCount returns the total number of callsigns
-func (d *Database) GetCallsignCount() (int, error) {
+func (d *Database) GetCallsignCount(ctx context.Context) (int, error) {
 	var count int
-	err := d.db.QueryRow("SELECT COUNT(*) FROM callsigns").Scan(&count)
+	err := d.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM callsigns").Scan(&count)
 	return count, err
 }
 
 // GetAllCallsigns returns all callsigns (for JSON generation)
-func (d *Database) GetAllCallsigns() ([]string, error) {
-	rows, err := d.db.Query("SELECT callsign FROM callsigns ORDER BY callsign")
+func (d *Database) GetAllCallsigns(ctx context.Context) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT callsign FROM callsigns ORDER BY callsign")
 	if err != nil {
 		return nil, err
 	}
@@ -275,31 +265,70 @@ func (d *Database) Close() error {
 
 // Processor handles FCC data processing
 type Processor struct {
-	db *Database
+	db     *Database
+	client *http.Client
+	cache  *DownloadCache // nil disables the download cache
+	batch  *batch.Batch   // import batch HD records are tagged with
+	// quarantine receives the records the import rejects; nil discards them
+	quarantine *quarantine
+	tuning     tuning
 }
 
 // NewProcessor creates a new processor
-func NewProcessor(dbPath string) (*Processor, error) {
-	db, err := NewDatabase(dbPath)
+func NewProcessor(ctx context.Context, dbPath string, t tuning) (*Processor, error) {
+	db, err := NewDatabase(ctx, dbPath, t)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Processor{
-		db: db,
+		db:     db,
+		client: http.DefaultClient,
+		tuning: t,
 	}, nil
 }
 
 // DownloadFile downloads a file from URL
-func (p *Processor) DownloadFile(url, destination string) error {
+func (p *Processor) DownloadFile(ctx context.Context, url, destination string) (err error) {
 	log.Printf("Downloading %s...", url)
+	ctx, span := tracing.Start(ctx, "download", tracing.String("url.full", url))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Ask the server to skip the body if our cached copy is still current
+	var cached *cacheMeta
+	if p.cache != nil {
+		if cached = p.cache.Lookup(url); cached != nil {
+			if cached.ETag != "" {
+				req.Header.Set("If-None-Match", cached.ETag)
+			}
+			if cached.LastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.LastModified)
+			}
+		}
+	}
+
+	resp, err := p.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to download: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		log.Printf("Not modified since last download, using cached copy")
+		if err := p.cache.CopyTo(url, destination); err != nil {
+			return fmt.Errorf("failed to copy cached file: %w", err)
+		}
+		return nil
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("bad status: %s", resp.Status)
 	}
@@ -315,10 +344,44 @@ func (p *Processor) DownloadFile(url, destination string) error {
 	}
 
 	log.Printf("Downloaded to %s", destination)
+
+	if p.cache != nil {
+		meta := cacheMeta{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		}
+		if err := p.cache.Store(url, destination, meta); err != nil {
+			log.Printf("Warning: Failed to cache download: %v", err)
+		}
+	}
+
 	return nil
 }
 
-// ExtractZip extracts a ZIP file
+// DownloadFirst tries each URL in order and stops at the first successful
+// download, so archive mirrors can back up the FCC server.
+func (p *Processor) DownloadFirst(ctx context.Context, urls []string, destination string) error {
+	var errs []error
+	for _, url := range urls {
+		err := p.DownloadFile(ctx, url, destination)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("Download from %s failed: %v", url, err)
+		errs = append(errs, fmt.Errorf("%s: %w", url, err))
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("no download URLs configured")
+	}
+	return errors.Join(errs...)
+}
+
+// ExtractZip extracts a ZIP file. Entries are confined to destDir and the
+// archive is subject to the MaxZip* limits, so an untrusted -file can't write
+// outside the temp directory or fill the disk.
 func (p *Processor) ExtractZip(zipPath, destDir string) error {
 	log.Printf("Extracting %s...", zipPath)
 
@@ -328,7 +391,15 @@ func (p *Processor) ExtractZip(zipPath, destDir string) error {
 	}
 	defer r.Close()
 
+	if len(r.File) > MaxZipFiles {
+		return fmt.Errorf("zip contains %d entries (limit %d)", len(r.File), MaxZipFiles)
+	}
+
+	var total int64
 	for _, f := range r.File {
+		if !filepath.IsLocal(f.Name) {
+			return fmt.Errorf("zip entry %q escapes the destination directory", f.Name)
+		}
 		fpath := filepath.Join(destDir, f.Name)
 
 		if f.FileInfo().IsDir() {
@@ -336,11 +407,21 @@ func (p *Processor) ExtractZip(zipPath, destDir string) error {
 			continue
 		}
 
+		if !f.Mode().IsRegular() {
+			log.Printf("Warning: Skipping non-regular zip entry %s", f.Name)
+			continue
+		}
+
+		// The header size can lie, so it's checked here and enforced while copying
+		if f.UncompressedSize64 > uint64(MaxZipFileSize) {
+			return fmt.Errorf("zip entry %s is %d bytes (limit %d)", f.Name, f.UncompressedSize64, MaxZipFileSize)
+		}
+
 		if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
 			return err
 		}
 
-		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
 		if err != nil {
 			return err
 		}
@@ -351,21 +432,31 @@ func (p *Processor) ExtractZip(zipPath, destDir string) error {
 			return err
 		}
 
-		_, err = io.Copy(outFile, rc)
+		// Copying one byte past what's left of either limit catches an entry
+		// that breaks it without writing the rest of the entry to disk
+		limit := min(MaxZipFileSize, MaxZipTotalSize-total)
+		n, err := io.Copy(outFile, io.LimitReader(rc, limit+1))
 		outFile.Close()
 		rc.Close()
 
 		if err != nil {
 			return err
 		}
+		if n > MaxZipFileSize {
+			return fmt.Errorf("zip entry %s exceeds %d bytes", f.Name, MaxZipFileSize)
+		}
+		total += n
+		if total > MaxZipTotalSize {
+			return fmt.Errorf("zip contents exceed %d bytes", MaxZipTotalSize)
+		}
 	}
 
 	log.Printf("Extracted to %s", destDir)
 	return nil
 }
 
-// LoadHDFile loads HD.dat into database
-func (p *Processor) LoadHDFile(filePath, filterCallsign string) error {
+// LoadHDFile loads HD.dat into the licenses table
+func (p *Processor) LoadHDFile(ctx context.Context, filePath, filterCallsign string) error {
 	log.Println("Loading HD.dat into database...")
 
 	file, err := os.Open(filePath)
@@ -374,51 +465,47 @@ func (p *Processor) LoadHDFile(filePath, filterCallsign string) error {
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	reader.Comma = '|'
-	reader.FieldsPerRecord = -1
-	reader.LazyQuotes = true
+	reader := newULSReader(file, filepath.Base(filePath), p.quarantine)
 
-	tx, err := p.db.db.Begin()
+	tx, err := p.beginLoad(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(`
-		INSERT INTO callsigns (callsign, license_status, radio_service_code, grant_date, expired_date, cancellation_date, first_name, last_name)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-		ON CONFLICT(callsign) DO UPDATE SET
-			license_status = CASE WHEN excluded.license_status != '' THEN excluded.license_status ELSE callsigns.license_status END,
-			radio_service_code = CASE WHEN excluded.radio_service_code != '' THEN excluded.radio_service_code ELSE callsigns.radio_service_code END,
-			grant_date = CASE WHEN excluded.grant_date != '' THEN excluded.grant_date ELSE callsigns.grant_date END,
-			expired_date = CASE WHEN excluded.expired_date != '' THEN excluded.expired_date ELSE callsigns.expired_date END,
-			cancellation_date = CASE WHEN excluded.cancellation_date != '' THEN excluded.cancellation_date ELSE callsigns.cancellation_date END,
-			first_name = CASE WHEN excluded.first_name != '' THEN excluded.first_name ELSE callsigns.first_name END,
-			last_name = CASE WHEN excluded.last_name != '' THEN excluded.last_name ELSE callsigns.last_name END,
-			last_updated = CURRENT_TIMESTAMP
-	`)
+	stmt, err := tx.prepare(ctx, licenseUpsertSQL("license_status", "radio_service_code", "grant_date", "expired_date",
+		"cancellation_date", "effective_date", "last_action_date", "first_name", "last_name"))
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
+	var batchID interface{}
+	if p.batch != nil {
+		batchID = p.batch.ID
+	}
+
 	count := 0
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		row, err := reader.Read()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			continue
+			return err
 		}
 
-		if len(row) < 5 || row[0] != "HD" {
+		if !reader.expect(row, "HD", 5) {
 			continue
 		}
 
 		callsign := strings.TrimSpace(row[4])
 		if callsign == "" {
+			reader.reject("no callsign")
 			continue
 		}
 
@@ -426,11 +513,19 @@ func (p *Processor) LoadHDFile(filePath, filterCallsign string) error {
 			continue
 		}
 
+		usi := strings.TrimSpace(row[1])
+		if usi == "" {
+			reader.reject("no unique system identifier")
+			continue
+		}
+
 		licenseStatus := ""
 		radioServiceCode := ""
 		grantDate := ""
 		expiredDate := ""
 		cancellationDate := ""
+		effectiveDate := ""
+		lastActionDate := ""
 		firstName := ""
 		lastName := ""
 		if len(row) > 5 {
@@ -455,10 +550,21 @@ func (p *Processor) LoadHDFile(filePath, filterCallsign string) error {
 		if len(row) > 32 {
 			lastName = strings.TrimSpace(row[32])
 		}
-		if _, err := stmt.Exec(callsign, licenseStatus, radioServiceCode, grantDate, expiredDate, cancellationDate, firstName, lastName); err != nil {
-			log.Printf("Error inserting HD record: %v", err)
+		// Effective and last action dates are fields 43 and 44
+		if len(row) > 42 {
+			effectiveDate = strings.TrimSpace(row[42])
+		}
+		if len(row) > 43 {
+			lastActionDate = strings.TrimSpace(row[43])
+		}
+		if _, err := stmt.ExecContext(ctx, usi, batch.FCC, callsign, batchID, licenseStatus, radioServiceCode, grantDate, expiredDate, cancellationDate,
+			effectiveDate, lastActionDate, firstName, lastName); err != nil {
+			reader.reject("write failed: " + err.Error())
 			continue
 		}
+		if err := tx.next(ctx); err != nil {
+			return err
+		}
 
 		count++
 		if count%10000 == 0 {
@@ -471,11 +577,12 @@ func (p *Processor) LoadHDFile(filePath, filterCallsign string) error {
 	}
 
 	log.Printf("Loaded %d HD records", count)
+	reader.logSummary()
 	return nil
 }
 
 // UpdateENData updates database with EN.dat
-func (p *Processor) UpdateENData(filePath, filterCallsign string) error {
+func (p *Processor) UpdateENData(ctx context.Context, filePath, filterCallsign string) error {
 	log.Println("Updating database with EN.dat...")
 
 	file, err := os.Open(filePath)
@@ -484,54 +591,35 @@ func (p *Processor) UpdateENData(filePath, filterCallsign string) error {
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	reader.Comma = '|'
-	reader.FieldsPerRecord = -1
-	reader.LazyQuotes = true
+	reader := newULSReader(file, filepath.Base(filePath), p.quarantine)
 
-	tx, err := p.db.db.Begin()
+	tx, err := p.beginLoad(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(`
-		UPDATE callsigns SET
-			entity_name = CASE WHEN ? != '' THEN ? ELSE entity_name END,
-			first_name = CASE WHEN ? != '' THEN ? ELSE first_name END,
-			mi = CASE WHEN ? != '' THEN ? ELSE mi END,
-			last_name = CASE WHEN ? != '' THEN ? ELSE last_name END,
-			suffix = CASE WHEN ? != '' THEN ? ELSE suffix END,
-			street_address = CASE WHEN ? != '' THEN ? ELSE street_address END,
-			city = CASE WHEN ? != '' THEN ? ELSE city END,
-			state = CASE WHEN ? != '' THEN ? ELSE state END,
-			zip_code = CASE WHEN ? != '' THEN ? ELSE zip_code END,
-			last_updated = CURRENT_TIMESTAMP
-		WHERE callsign = ?
-	`)
+	stmt, err := tx.prepare(ctx, enUpdateSQL())
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
 	count := 0
-	skipped := 0
-	totalRead := 0
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		row, err := reader.Read()
-		totalRead++
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			if filterCallsign != "" {
-				log.Printf("CSV parse error (row skipped): %v", err)
-			}
-			skipped++
-			continue
+			return err
 		}
 
-		if len(row) < 5 || row[0] != "EN" {
+		if !reader.expect(row, "EN", 5) {
 			if filterCallsign != "" && len(row) >= 5 {
 				cs := strings.TrimSpace(row[4])
 				if strings.EqualFold(cs, filterCallsign) {
@@ -543,6 +631,7 @@ func (p *Processor) UpdateENData(filePath, filterCallsign string) error {
 
 		callsign := strings.TrimSpace(row[4])
 		if callsign == "" {
+			reader.reject("no callsign")
 			continue
 		}
 
@@ -558,69 +647,23 @@ func (p *Processor) UpdateENData(filePath, filterCallsign string) error {
 			log.Printf("  After trim: [%s]", callsign)
 		}
 
-		entityName := ""
-		firstName := ""
-		mi := ""
-		lastName := ""
-		suffix := ""
-		streetAddress := ""
-		city := ""
-		state := ""
-		zipCode := ""
-
-		if len(row) > 7 {
-			entityName = strings.TrimSpace(row[7])
-		}
-		if len(row) > 8 {
-			firstName = strings.TrimSpace(row[8])
-		}
-		if len(row) > 9 {
-			mi = strings.TrimSpace(row[9])
-		}
-		if len(row) > 10 {
-			lastName = strings.TrimSpace(row[10])
-		}
-		if len(row) > 11 {
-			suffix = strings.TrimSpace(row[11])
-		}
-		if len(row) > 15 {
-			streetAddress = strings.TrimSpace(row[15])
-		}
-		if len(row) > 16 {
-			city = strings.TrimSpace(row[16])
-		}
-		if len(row) > 17 {
-			state = strings.TrimSpace(row[17])
-		}
-		if len(row) > 18 {
-			zipCode = strings.TrimSpace(row[18])
-		}
-
-		result, err := stmt.Exec(
-			entityName, entityName,
-			firstName, firstName,
-			mi, mi,
-			lastName, lastName,
-			suffix, suffix,
-			streetAddress, streetAddress,
-			city, city,
-			state, state,
-			zipCode, zipCode,
-			callsign,
-		)
+		result, err := stmt.ExecContext(ctx, enArgs(row)...)
 		if err != nil {
-			log.Printf("Error updating EN record for %s: %v", callsign, err)
+			reader.reject("write failed: " + err.Error())
 			continue
 		}
+		if err := tx.next(ctx); err != nil {
+			return err
+		}
 
 		rowsAffected, _ := result.RowsAffected()
 		if rowsAffected == 0 {
 			if filterCallsign != "" {
-				log.Printf("Warning: EN update for %s matched 0 rows (callsign not found in database)", callsign)
+				log.Printf("Warning: EN update for %s matched 0 rows (license %s not found in database, or entity type %q ranks below the row already applied)", callsign, field(row, 1), field(row, 5))
 			}
 		} else {
 			if filterCallsign != "" {
-				log.Printf("Successfully updated EN record for %s (fname=%s, lname=%s, city=%s)", callsign, firstName, lastName, city)
+				log.Printf("Successfully updated EN record for %s (fname=%s, lname=%s, city=%s)", callsign, field(row, 8), field(row, 10), field(row, 16))
 			}
 			count++
 		}
@@ -634,12 +677,13 @@ func (p *Processor) UpdateENData(filePath, filterCallsign string) error {
 		return err
 	}
 
-	log.Printf("Updated %d EN records (read %d total records, skipped %d)", count, totalRead-1, skipped)
+	log.Printf("Updated %d EN records (read %d total records, skipped %d)", count, reader.records, reader.skipped)
+	reader.logSummary()
 	return nil
 }
 
 // UpdateAMData updates database with AM.dat
-func (p *Processor) UpdateAMData(filePath, filterCallsign string) error {
+func (p *Processor) UpdateAMData(ctx context.Context, filePath, filterCallsign string) error {
 	log.Println("Updating database with AM.dat...")
 
 	file, err := os.Open(filePath)
@@ -648,24 +692,21 @@ func (p *Processor) UpdateAMData(filePath, filterCallsign string) error {
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	reader.Comma = '|'
-	reader.FieldsPerRecord = -1
-	reader.LazyQuotes = true
+	reader := newULSReader(file, filepath.Base(filePath), p.quarantine)
 
-	tx, err := p.db.db.Begin()
+	tx, err := p.beginLoad(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(`
-		UPDATE callsigns SET
+	stmt, err := tx.prepare(ctx, `
+		UPDATE licenses SET
 			operator_class = CASE WHEN ? != '' THEN ? ELSE operator_class END,
 			group_code = CASE WHEN ? != '' THEN ? ELSE group_code END,
 			region_code = CASE WHEN ? != '' THEN ? ELSE region_code END,
 			last_updated = CURRENT_TIMESTAMP
-		WHERE callsign = ?
+		WHERE unique_system_identifier = ?
 	`)
 	if err != nil {
 		return err
@@ -674,20 +715,25 @@ func (p *Processor) UpdateAMData(filePath, filterCallsign string) error {
 
 	count := 0
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		row, err := reader.Read()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			continue
+			return err
 		}
 
-		if len(row) < 5 || row[0] != "AM" {
+		if !reader.expect(row, "AM", 5) {
 			continue
 		}
 
 		callsign := strings.TrimSpace(row[4])
 		if callsign == "" {
+			reader.reject("no callsign")
 			continue
 		}
 
@@ -709,15 +755,18 @@ func (p *Processor) UpdateAMData(filePath, filterCallsign string) error {
 			regionCode = strings.TrimSpace(row[7])
 		}
 
-		if _, err := stmt.Exec(
+		if _, err := stmt.ExecContext(ctx,
 			operatorClass, operatorClass,
 			groupCode, groupCode,
 			regionCode, regionCode,
-			callsign,
+			strings.TrimSpace(row[1]),
 		); err != nil {
-			log.Printf("Error updating AM record: %v", err)
+			reader.reject("write failed: " + err.Error())
 			continue
 		}
+		if err := tx.next(ctx); err != nil {
+			return err
+		}
 
 		count++
 		if count%10000 == 0 {
@@ -730,6 +779,7 @@ func (p *Processor) UpdateAMData(filePath, filterCallsign string) error {
 	}
 
 	log.Printf("Updated %d AM records", count)
+	reader.logSummary()
 	return nil
 }
 
@@ -748,26 +798,32 @@ func FormatExpirationDate(dateStr string) string {
 }
 
 // LoadDataFiles loads all data files into database
-func (p *Processor) LoadDataFiles(hdFile, enFile, amFile, filterCallsign string) error {
-	if err := p.LoadHDFile(hdFile, filterCallsign); err != nil {
+func (p *Processor) LoadDataFiles(ctx context.Context, hdFile, enFile, amFile, filterCallsign string) error {
+	if err := tracing.Run(ctx, "load HD.dat", func(ctx context.Context) error {
+		return p.LoadHDFile(ctx, hdFile, filterCallsign)
+	}); err != nil {
 		return fmt.Errorf("failed to load HD file: %w", err)
 	}
 
-	if err := p.UpdateENData(enFile, filterCallsign); err != nil {
+	if err := tracing.Run(ctx, "load EN.dat", func(ctx context.Context) error {
+		return p.UpdateENData(ctx, enFile, filterCallsign)
+	}); err != nil {
 		return fmt.Errorf("failed to load EN file: %w", err)
 	}
 
-	if err := p.UpdateAMData(amFile, filterCallsign); err != nil {
+	if err := tracing.Run(ctx, "load AM.dat", func(ctx context.Context) error {
+		return p.UpdateAMData(ctx, amFile, filterCallsign)
+	}); err != nil {
 		return fmt.Errorf("failed to load AM file: %w", err)
 	}
 
-	total, err := p.db.GetCallsignCount()
-	if err != nil {
+	var total int
+	if err := p.db.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM licenses WHERE service = ?", batch.FCC).Scan(&total); err != nil {
 		return err
 	}
 
 	log.Printf("\nDatabase loaded successfully!")
-	log.Printf("Total callsigns: %d", total)
+	log.Printf("Total licenses: %d", total)
 	return nil
 }
 
@@ -776,45 +832,6 @@ func (p *Processor) Close() error {
 	return p.db.Close()
 }
 
-// CalculateGridSquare calculates the Maidenhead grid square from latitude and longitude.
-// Returns a 6-character grid square (e.g., "EM10ci").
-func CalculateGridSquare(lat, lon float64) string {
-	// Adjust longitude and latitude to be in the range [0, 360) and [0, 180)
-	adjustedLon := lon + 180.0
-	adjustedLat := lat + 90.0
-
-	// Calculate field (first pair - letters A-R)
-	fieldLon := int(adjustedLon / 20.0)
-	fieldLat := int(adjustedLat / 10.0)
-	if fieldLon < 0 || fieldLon >= 18 || fieldLat < 0 || fieldLat >= 18 {
-		return ""
-	}
-
-	// Calculate square (second pair - digits 0-9)
-	squareLon := int((adjustedLon - float64(fieldLon)*20.0) / 2.0)
-	squareLat := int((adjustedLat - float64(fieldLat)*10.0) / 1.0)
-	if squareLon < 0 || squareLon >= 10 || squareLat < 0 || squareLat >= 10 {
-		return ""
-	}
-
-	// Calculate subsquare (third pair - letters a-x)
-	subsquareLon := int((adjustedLon - float64(fieldLon)*20.0 - float64(squareLon)*2.0) / (2.0 / 24.0))
-	subsquareLat := int((adjustedLat - float64(fieldLat)*10.0 - float64(squareLat)*1.0) / (1.0 / 24.0))
-	if subsquareLon < 0 || subsquareLon >= 24 || subsquareLat < 0 || subsquareLat >= 24 {
-		return ""
-	}
-
-	// Build the grid square string
-	return fmt.Sprintf("%c%c%d%d%c%c",
-		'A'+byte(fieldLon),
-		'A'+byte(fieldLat),
-		squareLon,
-		squareLat,
-		'a'+byte(subsquareLon),
-		'a'+byte(subsquareLat),
-	)
-}
-
 // parseCoordinate parses FCC coordinate format (degrees, minutes, seconds, direction)
 // into a decimal coordinate.
 func parseCoordinate(degrees, minutes, seconds, direction string) (float64, error) {
@@ -845,7 +862,7 @@ func parseCoordinate(degrees, minutes, seconds, direction string) (float64, erro
 
 // ProcessLAFile processes the FCC LA.dat file and updates location data in the database.
 // LA.dat contains latitude/longitude coordinates for callsigns.
-func (p *Processor) ProcessLAFile(laFile, filterCallsign string) error {
+func (p *Processor) ProcessLAFile(ctx context.Context, laFile, filterCallsign string) error {
 	file, err := os.Open(laFile)
 	if err != nil {
 		return fmt.Errorf("failed to open LA file: %w", err)
@@ -854,26 +871,22 @@ func (p *Processor) ProcessLAFile(laFile, filterCallsign string) error {
 
 	log.Printf("Processing location data from: %s", laFile)
 
-	reader := csv.NewReader(file)
-	reader.Comma = '|'
-	reader.FieldsPerRecord = -1 // Variable number of fields
-	reader.LazyQuotes = true    // Allow malformed quotes
-	reader.TrimLeadingSpace = true
+	reader := newULSReader(file, filepath.Base(laFile), p.quarantine)
 
-	updateStmt, err := p.db.db.Prepare(`
-		UPDATE callsigns
+	updateStmt, err := p.db.db.PrepareContext(ctx, `
+		UPDATE licenses
 		SET latitude = ?,
 		    longitude = ?,
 		    grid_square = ?,
 		    last_updated = CURRENT_TIMESTAMP
-		WHERE callsign = ?
+		WHERE unique_system_identifier = ?
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare update statement: %w", err)
 	}
 	defer updateStmt.Close()
 
-	tx, err := p.db.db.Begin()
+	tx, err := p.db.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -883,16 +896,21 @@ func (p *Processor) ProcessLAFile(laFile, filterCallsign string) error {
 	batchSize := 1000
 
 	for {
+		if err := ctx.Err(); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
 		record, err := reader.Read()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			log.Printf("Warning: Error reading LA record: %v", err)
-			continue
+			_ = tx.Rollback()
+			return err
 		}
 
-		if len(record) < 21 {
+		if !reader.expect(record, "LA", 21) {
 			continue
 		}
 
@@ -904,26 +922,26 @@ func (p *Processor) ProcessLAFile(laFile, filterCallsign string) error {
 		}
 
 		// Parse latitude: fields 13-16 (degrees, minutes, seconds, direction)
-		lat, err := parseCoordinate(record[13], record[14], record[15], record[16])
+		lat, err := parseCoordinate(field(record, 13), field(record, 14), field(record, 15), field(record, 16))
 		if err != nil {
-			log.Printf("Warning: Failed to parse latitude for %s: %v", callsign, err)
+			reader.reject("invalid latitude")
 			continue
 		}
 
 		// Parse longitude: fields 17-20 (degrees, minutes, seconds, direction)
-		lon, err := parseCoordinate(record[17], record[18], record[19], record[20])
+		lon, err := parseCoordinate(field(record, 17), field(record, 18), field(record, 19), field(record, 20))
 		if err != nil {
-			log.Printf("Warning: Failed to parse longitude for %s: %v", callsign, err)
+			reader.reject("invalid longitude")
 			continue
 		}
 
 		// Calculate grid square
-		gridSquare := CalculateGridSquare(lat, lon)
+		gridSquare := geo.GridSquare(lat, lon)
 
 		// Update database
-		result, err := tx.Stmt(updateStmt).Exec(lat, lon, gridSquare, callsign)
+		result, err := tx.StmtContext(ctx, updateStmt).ExecContext(ctx, lat, lon, gridSquare, field(record, 1))
 		if err != nil {
-			log.Printf("Warning: Failed to update %s: %v", callsign, err)
+			reader.reject("write failed: " + err.Error())
 			continue
 		}
 
@@ -940,10 +958,10 @@ func (p *Processor) ProcessLAFile(laFile, filterCallsign string) error {
 				return fmt.Errorf("failed to commit batch: %w", err)
 			}
 
-			log.Printf("Processed %d records, updated %d callsigns...", count, updated)
+			log.Printf("Processed %d records, updated %d licenses...", count, updated)
 
 			// Start new transaction
-			tx, err = p.db.db.Begin()
+			tx, err = p.db.db.BeginTx(ctx, nil)
 			if err != nil {
 				return fmt.Errorf("failed to begin transaction: %w", err)
 			}
@@ -955,7 +973,8 @@ func (p *Processor) ProcessLAFile(laFile, filterCallsign string) error {
 		return fmt.Errorf("failed to commit final batch: %w", err)
 	}
 
-	log.Printf("Location processing complete: %d records processed, %d callsigns updated", count, updated)
+	log.Printf("Location processing complete: %d records processed, %d licenses updated", count, updated)
+	reader.logSummary()
 	return nil
 }
 
@@ -963,8 +982,19 @@ func main() {
 	fullFlag := flag.Bool("full", false, "Download and process full database")
 	dailyFlag := flag.Bool("daily", false, "Download and process daily updates")
 	fileFlag := flag.String("file", "", "Process a specific ZIP file")
-	dbFlag := flag.String("db", "hamqrzdb.sqlite", "SQLite database path")
+	dbFlag := flag.String("db", paths.DefaultDB("hamqrzdb.sqlite"), "SQLite database path")
 	callsignFlag := flag.String("callsign", "", "Process only a specific callsign (requires -full, -daily, or -file)")
+	serviceFlag := flag.String("service", ServiceAmateur, "ULS service to import: amat (amateur), gmrs, or coml (commercial operators)")
+	configFlag := flag.String("config", "", "KEY=VALUE config file (ULS_FULL_URL, ULS_DAILY_URL, GMRS_*, COML_*, ULS_CACHE_DIR)")
+	fullURLFlag := flag.String("full-url", "", "Full database URL(s), comma-separated mirrors tried in order (env ULS_FULL_URL, or GMRS_FULL_URL/COML_FULL_URL for -service)")
+	cacheFlag := flag.String("cache-dir", "", "Cache downloads here and skip unchanged files via conditional GET (env ULS_CACHE_DIR)")
+	proxyFlag := flag.String("proxy", "", "Proxy for downloads (http://, socks5://); defaults to HTTP_PROXY/HTTPS_PROXY")
+	// Windows can't rename over a database the API has open
+	bulkFlag := flag.Bool("bulk", runtime.GOOS != "windows", "With -full, load into a copy of the database without secondary indexes and swap it in (needs free space for the copy; default off on Windows)")
+	quarantineFlag := flag.String("quarantine", "", "File to write rejected records to, with the reason (default the database path plus .rejected.tsv; \"none\" to only count them)")
+	lowMemoryFlag := flag.Bool("low-memory", os.Getenv("LOW_MEMORY") != "", "Tune for machines with about 1GB of RAM such as a Raspberry Pi: small caches, temporary files beside the database, and smaller commits (env LOW_MEMORY)")
+	skipFormatFlag := flag.Bool("skip-format-check", false, "Load the files even if their record layout doesn't match the one the importer expects")
+	dailyURLFlag := flag.String("daily-url", "", "Daily update URL template(s) with %s for MMDDYYYY, comma-separated (env ULS_DAILY_URL, or GMRS_DAILY_URL/COML_DAILY_URL for -service)")
 
 	flag.Parse()
 
@@ -976,21 +1006,78 @@ func main() {
 		fmt.Fprintln(os.Stderr, "  hamqrzdb-process -full -callsign KJ5DJC      # Process only KJ5DJC")
 		fmt.Fprintln(os.Stderr, "  hamqrzdb-process -daily                      # Download and process daily updates")
 		fmt.Fprintln(os.Stderr, "  hamqrzdb-process -file l_amat.zip            # Process specific ZIP file")
+		fmt.Fprintln(os.Stderr, "  hamqrzdb-process -full -service gmrs         # Download and process GMRS licenses")
+		fmt.Fprintln(os.Stderr, "  hamqrzdb-process -full -service coml         # Download and process commercial operator licenses")
 		fmt.Fprintln(os.Stderr, "")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	processor, err := NewProcessor(*dbFlag)
+	cfg, err := LoadConfig(*configFlag, *serviceFlag, *fullURLFlag, *dailyURLFlag, *cacheFlag)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	client, err := httpclient.New(*proxyFlag)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Cancelled on SIGINT/SIGTERM so an in-progress ingest rolls back cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Trace the run, joining the admin job's trace when the API started it
+	ctx, endTrace, err := tracing.StartProcess(ctx, "hamqrzdb-import-us", "import-us", tracing.String("uls.service", *serviceFlag))
+	if err != nil {
+		log.Fatalf("Invalid tracing configuration: %v", err)
+	}
+	defer endTrace(nil)
+	// fatalf exits like log.Fatalf, exporting the failed run's trace first
+	fatalf := func(format string, args ...interface{}) {
+		endTrace(fmt.Errorf(format, args...))
+		log.Fatalf(format, args...)
+	}
+
+	// Downloads and extracted files go beside the database in low-memory
+	// mode, since the system temp directory may be in RAM
+	tune, tempParent := defaultTuning, ""
+	if *lowMemoryFlag {
+		tune, tempParent = lowMemoryTuning, filepath.Dir(*dbFlag)
+		useLowMemory(tempParent)
+	}
+
+	processor, err := NewProcessor(ctx, *dbFlag, tune)
 	if err != nil {
-		log.Fatalf("Failed to create processor: %v", err)
+		fatalf("Failed to create processor: %v", err)
 	}
 	defer processor.Close()
+	processor.client = client
+
+	quarantinePath := *quarantineFlag
+	switch quarantinePath {
+	case "":
+		quarantinePath = *dbFlag + ".rejected.tsv"
+	case "none":
+		quarantinePath = ""
+	}
+	if processor.quarantine, err = newQuarantine(quarantinePath); err != nil {
+		fatalf("Failed to set up quarantine: %v", err)
+	}
+	defer processor.quarantine.Close()
+
+	if cfg.CacheDir != "" {
+		cache, err := NewDownloadCache(cfg.CacheDir)
+		if err != nil {
+			fatalf("Failed to set up download cache: %v", err)
+		}
+		processor.cache = cache
+	}
 
 	// Create temporary directory for downloads
-	tempDir, err := os.MkdirTemp("", "uls-*")
+	tempDir, err := os.MkdirTemp(tempParent, "uls-*")
 	if err != nil {
-		log.Fatalf("Failed to create temp directory: %v", err)
+		fatalf("Failed to create temp directory: %v", err)
 	}
 	defer os.RemoveAll(tempDir)
 
@@ -998,30 +1085,51 @@ func main() {
 
 	if *fullFlag {
 		// Download full database
-		zipFile = filepath.Join(tempDir, "l_amat.zip")
-		if err := processor.DownloadFile(FullDatabaseURL, zipFile); err != nil {
-			log.Fatalf("Failed to download: %v", err)
+		zipFile = filepath.Join(tempDir, fmt.Sprintf("l_%s.zip", *serviceFlag))
+		if err := processor.DownloadFirst(ctx, cfg.FullURLs, zipFile); err != nil {
+			fatalf("Failed to download: %v", err)
 		}
 	} else if *dailyFlag {
 		// Download daily updates
 		today := time.Now().Format("01022006")
-		url := fmt.Sprintf(DailyUpdateURLFmt, today)
-		zipFile = filepath.Join(tempDir, fmt.Sprintf("l_am_%s.zip", today))
+		urls := make([]string, 0, len(cfg.DailyURLFmts))
+		for _, f := range cfg.DailyURLFmts {
+			urls = append(urls, fmt.Sprintf(f, today))
+		}
+		zipFile = filepath.Join(tempDir, fmt.Sprintf("l_%s_%s.zip", *serviceFlag, today))
 
-		if err := processor.DownloadFile(url, zipFile); err != nil {
-			log.Fatalf("Daily file not available. Try --full instead: %v", err)
+		if err := processor.DownloadFirst(ctx, urls, zipFile); err != nil {
+			fatalf("Daily file not available. Try --full instead: %v", err)
 		}
 	} else if *fileFlag != "" {
 		zipFile = *fileFlag
 		if _, err := os.Stat(zipFile); os.IsNotExist(err) {
-			log.Fatalf("File not found: %s", zipFile)
+			fatalf("File not found: %s", zipFile)
 		}
 	}
 
 	// Extract ZIP file
 	extractDir := filepath.Join(tempDir, "extracted")
-	if err := processor.ExtractZip(zipFile, extractDir); err != nil {
-		log.Fatalf("Failed to extract: %v", err)
+	if err := tracing.Run(ctx, "extract", func(context.Context) error {
+		return processor.ExtractZip(zipFile, extractDir)
+	}); err != nil {
+		fatalf("Failed to extract: %v", err)
+	}
+
+	// Refuse files in a layout the loaders would misread
+	if !*skipFormatFlag {
+		if err := checkULSFormat(extractDir, *fullFlag); err != nil {
+			fatalf("%v\nRerun with -skip-format-check to load them anyway", err)
+		}
+	}
+
+	if svc, ok := ulsServices[*serviceFlag]; ok {
+		if err := processor.ImportService(ctx, svc, extractDir, filepath.Base(zipFile), *callsignFlag, *fullFlag); err != nil {
+			fatalf("Failed to load %s data: %v", svc.source, err)
+		}
+		processor.quarantine.logSummary()
+		log.Printf("Database: %s", *dbFlag)
+		return
 	}
 
 	// Check for required files
@@ -1031,13 +1139,35 @@ func main() {
 
 	for _, f := range []string{hdFile, enFile, amFile} {
 		if _, err := os.Stat(f); os.IsNotExist(err) {
-			log.Fatalf("Required file not found: %s", f)
+			fatalf("Required file not found: %s", f)
 		}
 	}
 
+	// A full load of every callsign goes into a copy that replaces the database
+	var bulk *bulkLoad
+	if *fullFlag && *bulkFlag && *callsignFlag == "" {
+		if bulk, err = processor.beginBulkLoad(ctx, *dbFlag); err != nil {
+			fatalf("Failed to start bulk load: %v", err)
+		}
+	}
+
+	// Record the run so a full load can replace only FCC records
+	processor.batch, err = batch.Start(ctx, processor.db.db, batch.FCC, filepath.Base(zipFile))
+	if err != nil {
+		if bulk != nil {
+			bulk.abort()
+		}
+		fatalf("Failed to start import: %v", err)
+	}
+
 	// Load into database
-	if err := processor.LoadDataFiles(hdFile, enFile, amFile, *callsignFlag); err != nil {
-		log.Fatalf("Failed to load data: %v", err)
+	if err := processor.LoadDataFiles(ctx, hdFile, enFile, amFile, *callsignFlag); err != nil {
+		if bulk != nil {
+			bulk.abort()
+		} else {
+			processor.batch.Finish(ctx, processor.db.db, err)
+		}
+		fatalf("Failed to load data: %v", err)
 	}
 
 	log.Println("ULS data processing complete!")
@@ -1046,7 +1176,9 @@ func main() {
 	laFile := filepath.Join(extractDir, "LA.dat")
 	if _, err := os.Stat(laFile); err == nil {
 		log.Println("LA.dat found, processing location data...")
-		if err := processor.ProcessLAFile(laFile, *callsignFlag); err != nil {
+		if err := tracing.Run(ctx, "load LA.dat", func(ctx context.Context) error {
+			return processor.ProcessLAFile(ctx, laFile, *callsignFlag)
+		}); err != nil {
 			log.Printf("Warning: Failed to process location data: %v", err)
 		} else {
 			log.Println("Location data processing complete!")
@@ -1055,11 +1187,69 @@ func main() {
 		log.Println("LA.dat not found in archive, skipping location data")
 	}
 
+	// Records show each callsign's current license; SF and CO rows are only
+	// kept for it
+	if err := processor.publish(ctx, batch.FCC, "callsigns", processor.batch.ID, *fullFlag && *callsignFlag == ""); err != nil {
+		if bulk != nil {
+			bulk.abort()
+		} else {
+			processor.batch.Finish(ctx, processor.db.db, err)
+		}
+		fatalf("Failed to publish licenses: %v", err)
+	}
+
+	// Process special conditions if SF.dat exists
+	sfFile := filepath.Join(extractDir, "SF.dat")
+	if _, err := os.Stat(sfFile); err == nil {
+		if err := tracing.Run(ctx, "load SF.dat", func(ctx context.Context) error {
+			return processor.ProcessSFFile(ctx, sfFile, *callsignFlag)
+		}); err != nil {
+			log.Printf("Warning: Failed to process special conditions: %v", err)
+		}
+	} else {
+		log.Println("SF.dat not found in archive, skipping special conditions")
+	}
+
+	// Process comments if CO.dat exists
+	coFile := filepath.Join(extractDir, "CO.dat")
+	if _, err := os.Stat(coFile); err == nil {
+		if err := tracing.Run(ctx, "load CO.dat", func(ctx context.Context) error {
+			return processor.ProcessCOFile(ctx, coFile, *callsignFlag)
+		}); err != nil {
+			log.Printf("Warning: Failed to process comments: %v", err)
+		}
+	} else {
+		log.Println("CO.dat not found in archive, skipping comments")
+	}
+
+	if err := processor.batch.Finish(ctx, processor.db.db, nil); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	// A full download is a complete snapshot: drop FCC records it no longer has
+	if *fullFlag && *callsignFlag == "" {
+		if _, err := processor.batch.Prune(ctx, processor.db.db); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	if bulk != nil {
+		if err := bulk.finish(ctx); err != nil {
+			fatalf("Bulk load failed: %v", err)
+		}
+	}
+
+	// The API reads callsigns from the shards of a sharded database
+	if err := shard.Refresh(ctx, processor.db.db, *dbFlag); err != nil {
+		fatalf("Failed to rebuild shards: %v", err)
+	}
+
 	// Final summary
 	log.Println("\nProcessing complete!")
+	processor.quarantine.logSummary()
 	log.Printf("Database: %s", *dbFlag)
 
-	total, err := processor.db.GetCallsignCount()
+	total, err := processor.db.GetCallsignCount(ctx)
 	if err == nil {
 		log.Printf("Total callsigns in database: %d", total)
 	}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// quarantine collects the ULS records an import rejects, writing each to a
+// tab-separated file with the reason and counting them per file and reason
+// for the end-of-run summary. A nil *quarantine discards rejections.
+type quarantine struct {
+	path string // "" counts without writing a file
+
+	mu     sync.Mutex
+	f      *os.File
+	counts map[string]map[string]int // file -> reason -> records
+	files  []string                  // files in the order of their first rejection
+}
+
+// newQuarantine returns a quarantine writing to path, removing the file a
+// previous run left. The file is only created once a record is rejected.
+func newQuarantine(path string) (*quarantine, error) {
+	if path != "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove old quarantine file: %w", err)
+		}
+	}
+	return &quarantine{path: path, counts: map[string]map[string]int{}}, nil
+}
+
+// reject records that line of file was skipped for reason
+func (q *quarantine) reject(file string, line int, reason, record string) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.counts[file] == nil {
+		q.counts[file] = map[string]int{}
+		q.files = append(q.files, file)
+	}
+	q.counts[file][reason]++
+
+	if q.path == "" {
+		return
+	}
+	if q.f == nil {
+		f, err := os.Create(q.path)
+		if err != nil {
+			log.Printf("Warning: failed to create quarantine file, rejected records won't be saved: %v", err)
+			q.path = ""
+			return
+		}
+		q.f = f
+		fmt.Fprintln(q.f, "file\tline\treason\trecord")
+	}
+	record = strings.ReplaceAll(record, "\t", " ")
+	if _, err := fmt.Fprintf(q.f, "%s\t%d\t%s\t%s\n", file, line, reason, record); err != nil {
+		log.Printf("Warning: failed to write quarantine file: %v", err)
+	}
+}
+
+// logSummary logs the rejected record counts of each file
+func (q *quarantine) logSummary() {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.files) == 0 {
+		log.Println("No records rejected")
+		return
+	}
+	log.Println("Rejected records:")
+	for _, file := range q.files {
+		reasons := make([]string, 0, len(q.counts[file]))
+		total := 0
+		for reason, n := range q.counts[file] {
+			reasons = append(reasons, reason)
+			total += n
+		}
+		sort.Slice(reasons, func(i, j int) bool {
+			ni, nj := q.counts[file][reasons[i]], q.counts[file][reasons[j]]
+			if ni != nj {
+				return ni > nj
+			}
+			return reasons[i] < reasons[j]
+		})
+		log.Printf("  %s: %d", file, total)
+		for _, reason := range reasons {
+			log.Printf("    %s: %d", reason, q.counts[file][reason])
+		}
+	}
+	if q.f != nil {
+		log.Printf("Rejected records written to %s", q.path)
+	}
+}
+
+// Close closes the quarantine file
+func (q *quarantine) Close() error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.f == nil {
+		return nil
+	}
+	err := q.f.Close()
+	q.f = nil
+	return err
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/batch"
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
+)
+
+// ULS services accepted by -service
+const (
+	ServiceAmateur    = "amat"
+	ServiceGMRS       = "gmrs"
+	ServiceCommercial = "coml"
+)
+
+// ulsService is a non-amateur ULS service. Its licenses are kept in their own
+// table so they never mix with amateur records, but the API answers lookups
+// from them too.
+type ulsService struct {
+	// source is the data source recorded on the service's import batches
+	source string
+	table  string
+	// codes are the radio service codes accepted from HD.dat; empty accepts all
+	codes []string
+}
+
+// ulsServices are the services imported with ImportService, by -service name
+var ulsServices = map[string]ulsService{
+	ServiceGMRS:       {source: batch.GMRS, table: "gmrs_licenses", codes: []string{"ZA"}},
+	ServiceCommercial: {source: batch.Commercial, table: "commercial_licenses"},
+}
+
+// accepts reports whether a radio service code belongs to the service
+func (s ulsService) accepts(code string) bool {
+	if code == "" || len(s.codes) == 0 {
+		return true
+	}
+	for _, c := range s.codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ImportService loads an extracted ULS dump of a non-amateur service into
+// licenses and publishes it to the service's table. Only HD.dat and EN.dat
+// are used.
+func (p *Processor) ImportService(ctx context.Context, svc ulsService, extractDir, detail, filterCallsign string, full bool) error {
+	hdFile := filepath.Join(extractDir, "HD.dat")
+	enFile := filepath.Join(extractDir, "EN.dat")
+	for _, f := range []string{hdFile, enFile} {
+		if _, err := os.Stat(f); os.IsNotExist(err) {
+			return fmt.Errorf("required file not found: %s", f)
+		}
+	}
+
+	b, err := batch.Start(ctx, p.db.db, svc.source, detail)
+	if err != nil {
+		return err
+	}
+
+	err = tracing.Run(ctx, "load HD.dat", func(ctx context.Context) error {
+		return p.loadServiceHD(ctx, svc, hdFile, filterCallsign, b.ID)
+	})
+	if err == nil {
+		err = tracing.Run(ctx, "load EN.dat", func(ctx context.Context) error {
+			return p.updateServiceEN(ctx, svc, enFile, filterCallsign)
+		})
+	}
+	if err == nil {
+		err = p.publish(ctx, svc.source, svc.table, b.ID, full && filterCallsign == "")
+	}
+	if finishErr := b.Finish(ctx, p.db.db, err); finishErr != nil {
+		log.Printf("Warning: %v", finishErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	// A full download is a complete snapshot: drop licenses it no longer has
+	if full && filterCallsign == "" {
+		if _, err := b.Prune(ctx, p.db.db); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	var total int
+	if err := p.db.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+svc.table).Scan(&total); err == nil {
+		log.Printf("Total %s licenses in database: %d", svc.source, total)
+	}
+	return nil
+}
+
+// loadServiceHD upserts license headers from HD.dat
+func (p *Processor) loadServiceHD(ctx context.Context, svc ulsService, filePath, filterCallsign string, batchID int64) error {
+	log.Printf("Loading %s HD.dat into database...", svc.source)
+
+	tx, err := p.beginLoad(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.prepare(ctx, licenseUpsertSQL("license_status", "radio_service_code", "grant_date", "expired_date",
+		"cancellation_date", "effective_date", "last_action_date"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	count, err := readULSRecords(ctx, p.quarantine, tx, filePath, "HD", filterCallsign, func(callsign string, row []string) (bool, error) {
+		if !svc.accepts(field(row, 6)) {
+			return false, nil
+		}
+		if field(row, 1) == "" {
+			return false, errors.New("no unique system identifier")
+		}
+		_, err := stmt.ExecContext(ctx, field(row, 1), svc.source, callsign, batchID, field(row, 5), field(row, 6),
+			field(row, 7), field(row, 8), field(row, 9), field(row, 42), field(row, 43))
+		return err == nil, err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Loaded %d %s HD records", count, svc.source)
+	return nil
+}
+
+// updateServiceEN fills in licensee names, addresses, and FRNs from EN.dat
+func (p *Processor) updateServiceEN(ctx context.Context, svc ulsService, filePath, filterCallsign string) error {
+	log.Printf("Updating %s licenses with EN.dat...", svc.source)
+
+	tx, err := p.beginLoad(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.prepare(ctx, enUpdateSQL())
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	// EN|usi|file_num|ebf|callsign|entity_type|licensee_id|entity_name|first|mi|last|suffix|...|street(15)|city|state|zip|...|frn(22)
+	count, err := readULSRecords(ctx, p.quarantine, tx, filePath, "EN", filterCallsign, func(callsign string, row []string) (bool, error) {
+		res, err := stmt.ExecContext(ctx, enArgs(row)...)
+		if err != nil {
+			return false, err
+		}
+		n, _ := res.RowsAffected()
+		return n > 0, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Updated %d %s EN records", count, svc.source)
+	return nil
+}
+
+// readULSRecords calls fn for each recordType row of a pipe-delimited ULS
+// file, optionally only for one callsign, and returns how many rows fn
+// reported as written. Rows fn fails on are rejected to q and skipped; the
+// rest count towards tx's batch.
+func readULSRecords(ctx context.Context, q *quarantine, tx *loadTx, filePath, recordType, filterCallsign string, fn func(callsign string, row []string) (bool, error)) (int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := newULSReader(file, filepath.Base(filePath), q)
+
+	count := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if !reader.expect(row, recordType, 5) {
+			continue
+		}
+
+		callsign := strings.TrimSpace(row[4])
+		if callsign == "" {
+			reader.reject("no callsign")
+			continue
+		}
+
+		if filterCallsign != "" && !strings.EqualFold(callsign, filterCallsign) {
+			continue
+		}
+
+		written, err := fn(callsign, row)
+		if err != nil {
+			reader.reject("write failed: " + err.Error())
+			continue
+		}
+		if err := tx.next(ctx); err != nil {
+			return 0, err
+		}
+		if written {
+			count++
+			if count%10000 == 0 {
+				log.Printf("  Loaded %d %s records...", count, recordType)
+			}
+		}
+	}
+	reader.logSummary()
+	return count, nil
+}
+
+// field returns the trimmed value at index i of a ULS row, or "" if the row
+// is shorter
+func field(row []string, i int) string {
+	if i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// tuning is the SQLite and batching configuration of an import
+type tuning struct {
+	// cacheSize and bulkCacheSize are the PRAGMA cache_size of the database
+	// and of a bulk load copy
+	cacheSize     string
+	bulkCacheSize string
+	// tempStore is the PRAGMA temp_store for sorts and index builds
+	tempStore string
+	// batch is how many rows a file's load commits at a time; 0 loads each
+	// file in one transaction
+	batch int
+	// conns caps the open connections, each of which has its own page
+	// cache; 0 leaves the pool unlimited
+	conns int
+}
+
+// defaultTuning favors speed, which a full load needs a few hundred MB for
+var defaultTuning = tuning{
+	cacheSize:     "10000",
+	bulkCacheSize: "-262144",
+	tempStore:     "MEMORY",
+}
+
+// lowMemoryTuning keeps a full load within a 1GB Raspberry Pi: small page
+// caches on a single connection, sorts spilled to temporary files, and
+// commits every few thousand rows
+var lowMemoryTuning = tuning{
+	cacheSize:     "-8192",
+	bulkCacheSize: "-16384",
+	tempStore:     "FILE",
+	batch:         5000,
+	conns:         1,
+}
+
+// lowMemoryGoLimit is the Go heap soft limit of a low-memory import, unless
+// GOMEMLIMIT sets one
+const lowMemoryGoLimit = 256 << 20
+
+// useLowMemory applies the process-wide side of -low-memory. SQLite writes
+// its temporary files to dir, which should be on disk: /tmp is often a RAM
+// backed tmpfs on a Pi.
+func useLowMemory(dir string) {
+	runtime.GOMAXPROCS(1)
+	if os.Getenv("GOMEMLIMIT") == "" {
+		debug.SetMemoryLimit(lowMemoryGoLimit)
+	}
+	// SQLite on Windows ignores SQLITE_TMPDIR and uses TMP, which is always
+	// set, usually to the user's AppData\Local\Temp
+	switch {
+	case runtime.GOOS == "windows":
+		os.Setenv("TMP", dir)
+	case os.Getenv("SQLITE_TMPDIR") == "":
+		os.Setenv("SQLITE_TMPDIR", dir)
+	}
+	log.Printf("Low-memory mode: temporary files in %s, commits every %d rows", dir, lowMemoryTuning.batch)
+}
+
+// loadTx is the transaction a file is loaded in. With a batch size it
+// commits every batch rows and begins another, so the page cache and the
+// WAL never hold more than a batch of changes; an interrupted load then
+// keeps the batches it committed.
+type loadTx struct {
+	db    *sql.DB
+	tx    *sql.Tx
+	stmts []*loadStmt
+	batch int
+	rows  int
+}
+
+// loadStmt is a statement of a loadTx, prepared again in each batch
+type loadStmt struct {
+	query string
+	*sql.Stmt
+}
+
+// beginLoad begins the transaction of a file's load
+func (p *Processor) beginLoad(ctx context.Context) (*loadTx, error) {
+	tx, err := p.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return &loadTx{db: p.db.db, tx: tx, batch: p.tuning.batch}, nil
+}
+
+// prepare prepares a statement in the load's transactions
+func (l *loadTx) prepare(ctx context.Context, query string) (*loadStmt, error) {
+	stmt, err := l.tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	s := &loadStmt{query: query, Stmt: stmt}
+	l.stmts = append(l.stmts, s)
+	return s, nil
+}
+
+// next counts a row and commits the batch once it is full
+func (l *loadTx) next(ctx context.Context) error {
+	l.rows++
+	if l.batch == 0 || l.rows%l.batch != 0 {
+		return nil
+	}
+	if err := l.tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit batch: %w", err)
+	}
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	l.tx = tx
+	for _, s := range l.stmts {
+		if s.Stmt, err = tx.PrepareContext(ctx, s.query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit commits the last batch
+func (l *loadTx) Commit() error {
+	return l.tx.Commit()
+}
+
+// Rollback rolls back the current batch, if it hasn't been committed
+func (l *loadTx) Rollback() error {
+	return l.tx.Rollback()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// ulsMaxRecord bounds how much of one record ulsReader buffers, so a
+// corrupt file can't make it read the rest of the file into memory.
+// Real records are a few hundred bytes; longer ones are skipped.
+const ulsMaxRecord = 1 << 20
+
+// ulsReader reads records from a pipe-delimited ULS .dat file.
+//
+// ULS files aren't CSV. Fields are never quoted, so a quote is an ordinary
+// character (names like `ROBERT "BOB" SMITH` are common), and free-text
+// fields occasionally contain a raw line break. encoding/csv, even with
+// LazyQuotes, reads a leading quote as the start of a quoted field that
+// runs on until a quote before a delimiter, swallowing the records in
+// between, and splits a line break into two malformed rows; either way
+// records were silently lost. ulsReader treats quotes literally and joins
+// a line that doesn't start with a record type ("HD|", "EN|", ...) onto
+// the record before it, with a space in place of the line break.
+//
+// Lines it can't make a record of go to the quarantine, as do records the
+// caller rejects with reject.
+//
+// Each record is converted to a string once and its fields are substrings
+// of it, so reading allocates one string per record. The slice returned
+// by Read is reused by the next call.
+type ulsReader struct {
+	r    *bufio.Reader
+	name string
+	q    *quarantine
+
+	// line is the last physical line read, without its line ending, and
+	// lineNo its 1-based number in the file
+	line    []byte
+	lineNo  int
+	tooLong bool
+	// pending is set when line is the first line of the next record, read
+	// while looking for continuation lines
+	pending bool
+
+	// record is the record being read and raw the last one returned,
+	// starting on line start
+	record []byte
+	raw    string
+	start  int
+	fields []string
+
+	records int
+	joined  int
+	skipped int
+}
+
+// newULSReader returns a reader of the ULS file r, named name in
+// diagnostics, that sends rejected lines to q
+func newULSReader(r io.Reader, name string, q *quarantine) *ulsReader {
+	return &ulsReader{r: bufio.NewReaderSize(r, 64<<10), name: name, q: q}
+}
+
+// Read returns the fields of the next record, or io.EOF after the last one
+func (u *ulsReader) Read() ([]string, error) {
+	for {
+		if !u.pending {
+			if err := u.readLine(); err != nil {
+				return nil, err
+			}
+		}
+		u.pending = false
+		if len(u.line) == 0 && !u.tooLong {
+			continue
+		}
+		if !isULSRecordStart(u.line) {
+			u.skip(u.lineNo, "line doesn't start with a record type", string(u.line))
+			continue
+		}
+
+		start := u.lineNo
+		tooLong := u.tooLong
+		u.record = append(u.record[:0], u.line...)
+		joined := false
+		for {
+			err := u.readLine()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if isULSRecordStart(u.line) {
+				u.pending = true
+				break
+			}
+			if len(u.line) == 0 && !u.tooLong {
+				continue
+			}
+			joined = true
+			if tooLong = tooLong || u.tooLong || len(u.record)+1+len(u.line) > ulsMaxRecord; tooLong {
+				continue
+			}
+			// The fields are stored and served as single lines
+			u.record = append(u.record, ' ')
+			u.record = append(u.record, u.line...)
+		}
+
+		if tooLong {
+			u.skip(start, fmt.Sprintf("record longer than %d bytes", ulsMaxRecord), string(u.record[:min(len(u.record), 200)]))
+			continue
+		}
+		if joined {
+			u.joined++
+		}
+		u.records++
+		u.start = start
+		return u.split(), nil
+	}
+}
+
+// readLine reads the next physical line into u.line
+func (u *ulsReader) readLine() error {
+	u.line = u.line[:0]
+	u.tooLong = false
+	for {
+		frag, err := u.r.ReadSlice('\n')
+		if len(u.line)+len(frag) <= ulsMaxRecord {
+			u.line = append(u.line, frag...)
+		} else {
+			u.tooLong = true
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		// The last line may have no line ending
+		if err == io.EOF && (len(u.line) > 0 || u.tooLong) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		break
+	}
+	u.lineNo++
+	u.line = bytes.TrimRight(u.line, "\r\n")
+	return nil
+}
+
+// split splits u.record into u.fields
+func (u *ulsReader) split() []string {
+	rec := string(u.record)
+	u.raw = rec
+	u.fields = u.fields[:0]
+	for {
+		i := strings.IndexByte(rec, '|')
+		if i < 0 {
+			break
+		}
+		u.fields = append(u.fields, rec[:i])
+		rec = rec[i+1:]
+	}
+	u.fields = append(u.fields, rec)
+	return u.fields
+}
+
+// reject quarantines the record last returned by Read
+func (u *ulsReader) reject(reason string) {
+	u.skip(u.start, reason, u.raw)
+}
+
+// expect reports whether row is a recordType record of at least fields
+// fields, rejecting it if not
+func (u *ulsReader) expect(row []string, recordType string, fields int) bool {
+	switch {
+	case row[0] != recordType:
+		u.reject("wrong record type")
+	case len(row) < fields:
+		u.reject("too few fields")
+	default:
+		return true
+	}
+	return false
+}
+
+// skip quarantines a line or record starting on line
+func (u *ulsReader) skip(line int, reason, record string) {
+	u.skipped++
+	u.q.reject(u.name, line, reason, record)
+}
+
+// logSummary logs how many records needed rejoining, if any; the
+// quarantine summarizes the rejected ones
+func (u *ulsReader) logSummary() {
+	if u.joined > 0 {
+		log.Printf("%s: rejoined %d records split by line breaks in a field", u.name, u.joined)
+	}
+}
+
+// isULSRecordStart reports whether line begins with a two-letter record
+// type and a delimiter, as every ULS record does
+func isULSRecordStart(line []byte) bool {
+	return len(line) >= 3 &&
+		line[0] >= 'A' && line[0] <= 'Z' &&
+		line[1] >= 'A' && line[1] <= 'Z' &&
+		line[2] == '|'
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Comment is an administrative comment attached to a license (CO.dat)
+type Comment struct {
+	Date       string `json:"date"`
+	Text       string `json:"text"`
+	Status     string `json:"status,omitempty"`
+	StatusDate string `json:"status_date,omitempty"`
+}
+
+// handleComments handles /v1/{callsign}/comments requests
+func handleComments(w http.ResponseWriter, r *http.Request, callsign string) {
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	comments := []Comment{}
+	status := "OK"
+
+	if d := getDB(); d != nil {
+		rows, err := d.QueryContext(ctx, `
+			SELECT COALESCE(comment_date, ''), COALESCE(description, ''),
+				COALESCE(status_code, ''), COALESCE(status_date, '')
+			FROM comments
+			WHERE callsign = ? `+currentLicenseOnly(ctx, d)+`
+			ORDER BY id
+		`, callsign)
+		if err != nil {
+			// Databases imported before CO.dat support have no comments table
+			if !strings.Contains(err.Error(), "no such table") {
+				log.Printf("Database error looking up comments for %s: %v", callsign, err)
+			}
+		} else {
+			defer rows.Close()
+			for rows.Next() {
+				var c Comment
+				if err := rows.Scan(&c.Date, &c.Text, &c.Status, &c.StatusDate); err != nil {
+					log.Printf("Error scanning comment for %s: %v", callsign, err)
+					break
+				}
+				comments = append(comments, c)
+			}
+		}
+	}
+
+	if len(comments) == 0 {
+		status = "NOT_FOUND"
+		markNotFound(w)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"callsign": callsign,
+		"comments": comments,
+		"messages": map[string]string{"status": status},
+	})
+}
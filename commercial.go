@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// CommercialLicense is an FCC commercial operator license held by the same
+// licensee (FRN) as an amateur callsign
+type CommercialLicense struct {
+	LicenseNumber string `json:"license_number"`
+	Type          string `json:"type"`
+	Description   string `json:"description,omitempty"`
+	Status        string `json:"status"`
+	Expires       string `json:"expires,omitempty"`
+}
+
+// commercialLicenseTypes describes the common commercial operator license
+// radio service codes
+var commercialLicenseTypes = map[string]string{
+	"PG": "General Radiotelephone Operator License",
+	"MP": "Marine Radio Operator Permit",
+	"RR": "Restricted Radiotelephone Operator Permit",
+	"RL": "Restricted Radiotelephone Operator Permit-Limited Use",
+	"DO": "GMDSS Radio Operator's License",
+	"DM": "GMDSS Radio Maintainer's License",
+	"DB": "GMDSS Radio Operator/Maintainer License",
+	"RG": "Restricted GMDSS Radio Operator's License",
+}
+
+// lookupCommercialLicenses returns the commercial operator licenses sharing
+// the FRN of a callsign's FCC amateur record
+func lookupCommercialLicenses(ctx context.Context, callsign string) []CommercialLicense {
+	d := getDB()
+	if d == nil || !hasColumn(ctx, d, "callsigns", "frn") || !hasColumn(ctx, d, "commercial_licenses", "frn") {
+		return nil
+	}
+
+	rows, err := d.QueryContext(ctx, `
+		SELECT cl.callsign, COALESCE(cl.radio_service_code, ''), COALESCE(cl.license_status, ''),
+			COALESCE(cl.expired_date, '')
+		FROM callsigns c
+		JOIN commercial_licenses cl ON cl.frn = c.frn
+		WHERE c.callsign = ? AND c.data_source = 'FCC' AND COALESCE(c.frn, '') != ''
+		ORDER BY cl.license_status = 'A' DESC, cl.callsign
+	`, callsign)
+	if err != nil {
+		if !strings.Contains(err.Error(), "no such table") {
+			log.Printf("Database error looking up commercial licenses for %s: %v", callsign, err)
+		}
+		return nil
+	}
+	defer rows.Close()
+
+	var licenses []CommercialLicense
+	for rows.Next() {
+		var l CommercialLicense
+		if err := rows.Scan(&l.LicenseNumber, &l.Type, &l.Status, &l.Expires); err != nil {
+			log.Printf("Error scanning commercial license for %s: %v", callsign, err)
+			return licenses
+		}
+		l.Description = commercialLicenseTypes[l.Type]
+		licenses = append(licenses, l)
+	}
+
+	return licenses
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+)
+
+// SpecialCondition is a free-form special condition attached to a license (SF.dat)
+type SpecialCondition struct {
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	Status string `json:"status,omitempty"`
+	Date   string `json:"date,omitempty"`
+}
+
+// lookupSpecialConditions returns the special conditions for a callsign. Text
+// split across sequence numbers is joined back into a single condition.
+func lookupSpecialConditions(ctx context.Context, callsign string) []SpecialCondition {
+	d := getDB()
+	if d == nil {
+		return nil
+	}
+
+	rows, err := d.QueryContext(ctx, `
+		SELECT condition_id, COALESCE(condition_type, ''), COALESCE(condition_text, ''),
+			COALESCE(status_code, ''), COALESCE(status_date, '')
+		FROM special_conditions
+		WHERE callsign = ? `+currentLicenseOnly(ctx, d)+`
+		ORDER BY condition_id, sequence_number
+	`, callsign)
+	if err != nil {
+		// Databases imported before SF.dat support have no special_conditions table
+		if !strings.Contains(err.Error(), "no such table") {
+			log.Printf("Database error looking up special conditions for %s: %v", callsign, err)
+		}
+		return nil
+	}
+	defer rows.Close()
+
+	var conditions []SpecialCondition
+	lastID := ""
+	for rows.Next() {
+		var id string
+		var c SpecialCondition
+		if err := rows.Scan(&id, &c.Type, &c.Text, &c.Status, &c.Date); err != nil {
+			log.Printf("Error scanning special condition for %s: %v", callsign, err)
+			return conditions
+		}
+		if id == lastID && len(conditions) > 0 {
+			conditions[len(conditions)-1].Text += " " + c.Text
+			continue
+		}
+		conditions = append(conditions, c)
+		lastID = id
+	}
+
+	return conditions
+}
+
+// currentLicenseOnly returns a condition keeping the rows of a license's
+// detail table (special_conditions, comments) that belong to the license of
+// the callsign's FCC record, so a reissued callsign doesn't show its
+// previous holder's. Rows loaded before licenses were tracked are kept.
+func currentLicenseOnly(ctx context.Context, d *sql.DB) string {
+	if !hasColumn(ctx, d, "callsigns", "unique_system_identifier") {
+		return ""
+	}
+	return `AND (unique_system_identifier IS NULL OR unique_system_identifier IS
+		(SELECT c.unique_system_identifier FROM callsigns c WHERE c.callsign = ?1 AND c.data_source = 'FCC'))`
+}
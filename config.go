@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/redact"
+	"github.com/chriskacerguis/hamqrzdb/internal/transform"
+)
+
+// settings are the API settings that can change without a restart. Handlers
+// read them through cfg, and a SIGHUP swaps in a new set.
+type settings struct {
+	// queryTimeout bounds how long a single request may spend in the
+	// database (QUERY_TIMEOUT)
+	queryTimeout time.Duration
+	// adminToken is the bearer token required by admin endpoints (ADMIN_TOKEN)
+	adminToken string
+	// replicationToken is the bearer token followers use to download
+	// snapshots (REPLICATION_TOKEN), so they don't need the admin token
+	replicationToken string
+	// publicURL is the API's external base URL for links such as QR codes
+	// (PUBLIC_URL); the request's host when empty
+	publicURL string
+	// strictStatus makes lookups use real HTTP status codes by default
+	// (STRICT_STATUS). Requests can override it with ?strict=1 or ?strict=0.
+	strictStatus bool
+	// freshnessMessages adds db_date and record_count to the messages of
+	// lookup responses by default (FRESHNESS_MESSAGES). HamDB has only a
+	// status there, so it is off unless enabled; requests can override it
+	// with ?freshness=1 or ?freshness=0.
+	freshnessMessages bool
+	// limiter throttles API requests per client IP when RATE_LIMIT is set
+	limiter *rateLimiter
+	// cors is the CORS configuration; the default allows any origin
+	cors CORSConfig
+	// proxies are the reverse proxies whose client IP headers are believed;
+	// none by default
+	proxies ProxyConfig
+	// redaction is the redaction configuration; nothing is redacted by default
+	redaction redact.Config
+	// transform is the RESPONSE_TRANSFORM rules applied to callsign lookups
+	transform *transform.Rules
+	// formats is the FORMAT_TEMPLATE templates for custom lookup formats
+	formats customFormats
+	// qslTemplates is the QSL_TEMPLATES label layouts, used before the
+	// built-in ones
+	qslTemplates map[string]*qslTemplate
+}
+
+var (
+	// active holds the current settings
+	active atomic.Pointer[settings]
+	// defaultSettings are used until the environment has been read
+	defaultSettings = &settings{queryTimeout: 5 * time.Second, cors: defaultCORS}
+
+	// configFile is CONFIG_FILE, an optional file of settings that override
+	// the environment
+	configFile string
+)
+
+// cfg returns the current settings
+func cfg() *settings {
+	if s := active.Load(); s != nil {
+		return s
+	}
+	return defaultSettings
+}
+
+// loadSettings reads the reloadable settings from the environment
+func loadSettings(getenv func(string) string) (*settings, error) {
+	s := *defaultSettings
+	if v := getenv("QUERY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid QUERY_TIMEOUT %q: %w", v, err)
+		}
+		s.queryTimeout = d
+	}
+
+	s.adminToken = getenv("ADMIN_TOKEN")
+	s.replicationToken = getenv("REPLICATION_TOKEN")
+	s.publicURL = strings.TrimSuffix(getenv("PUBLIC_URL"), "/")
+
+	for _, b := range []struct {
+		name string
+		dst  *bool
+	}{
+		{"STRICT_STATUS", &s.strictStatus},
+		{"FRESHNESS_MESSAGES", &s.freshnessMessages},
+	} {
+		if v := getenv(b.name); v != "" {
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", b.name, v, err)
+			}
+			*b.dst = enabled
+		}
+	}
+
+	var err error
+	if s.limiter, err = loadRateLimiter(getenv); err != nil {
+		return nil, err
+	}
+	s.cors = loadCORSConfig(getenv)
+	if s.proxies, err = loadProxyConfig(getenv); err != nil {
+		return nil, err
+	}
+	s.redaction = redact.LoadConfig(getenv)
+	if path := getenv("RESPONSE_TRANSFORM"); path != "" {
+		if s.transform, err = transform.Load(path); err != nil {
+			return nil, fmt.Errorf("invalid RESPONSE_TRANSFORM: %w", err)
+		}
+	}
+	if path := getenv("FORMAT_TEMPLATE"); path != "" {
+		if s.formats, err = loadCustomFormats(path); err != nil {
+			return nil, fmt.Errorf("invalid FORMAT_TEMPLATE: %w", err)
+		}
+	}
+	if path := getenv("QSL_TEMPLATES"); path != "" {
+		if s.qslTemplates, err = loadQSLTemplates(path); err != nil {
+			return nil, fmt.Errorf("invalid QSL_TEMPLATES: %w", err)
+		}
+	}
+	return &s, nil
+}
+
+// readConfigFile sets the variables in path, if any, in the environment.
+// Lines are KEY=VALUE as in env.example or a systemd EnvironmentFile; blank
+// lines and # comments are skipped, and values may be quoted.
+func readConfigFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read CONFIG_FILE: %w", err)
+	}
+	defer f.Close()
+
+	vars := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read CONFIG_FILE: %w", err)
+	}
+
+	// Applied only once the whole file has parsed
+	for key, value := range vars {
+		os.Setenv(key, value)
+	}
+	return nil
+}
+
+// reloadConfig reads CONFIG_FILE again and swaps in the settings it and the
+// environment now give. Invalid settings are logged and the old ones kept.
+// Other settings, such as LISTEN or DB_PATH, need a restart.
+func reloadConfig() {
+	if err := readConfigFile(configFile); err != nil {
+		log.Printf("Config not reloaded: %v", err)
+		return
+	}
+	s, err := loadSettings(os.Getenv)
+	if err != nil {
+		log.Printf("Config not reloaded: %v", err)
+		return
+	}
+	// Keep the clients' rate limit buckets when the limit is unchanged
+	if old := cfg().limiter; old != nil && s.limiter != nil && old.rate == s.limiter.rate && old.burst == s.limiter.burst {
+		s.limiter = old
+	}
+	active.Store(s)
+	log.Println("Reloaded config")
+}
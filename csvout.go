@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// csvFlushRows is how many CSV rows are buffered before flushing to the client
+const csvFlushRows = 100
+
+// wantsCSV reports whether a list request asked for CSV, with ?format=csv or
+// an Accept header naming text/csv. An explicit ?format= wins over Accept.
+func wantsCSV(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return strings.EqualFold(f, "csv")
+	}
+	return strings.Contains(strings.ToLower(r.Header.Get("Accept")), "text/csv")
+}
+
+// csvColumn is a scalar struct field written as a CSV column
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+// csvColumns returns the scalar fields of struct type t in declaration order,
+// named by their JSON keys. Embedded structs are flattened; slices, maps, and
+// nested structs have no single CSV value and are left out.
+func csvColumns(t reflect.Type) []csvColumn {
+	var columns []csvColumn
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for _, c := range csvColumns(f.Type) {
+				columns = append(columns, csvColumn{c.name, append([]int{i}, c.index...)})
+			}
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		switch ft.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Struct, reflect.Array, reflect.Interface:
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		columns = append(columns, csvColumn{name, append([]int{}, i)})
+	}
+	return columns
+}
+
+// csvValue formats a scalar field for CSV; nil pointers are empty
+func csvValue(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	}
+	return ""
+}
+
+// csvStream writes list items as CSV rows as they are produced, flushing
+// to the client every csvFlushRows rows. The header row is the items' JSON
+// keys, so the columns match the JSON response.
+type csvStream[T any] struct {
+	rc      *http.ResponseController
+	cw      *csv.Writer
+	columns []csvColumn
+	record  []string
+	rows    int
+}
+
+// newCSVStream starts a CSV attachment named name.csv with its header row
+func newCSVStream[T any](w http.ResponseWriter, name string) *csvStream[T] {
+	columns := csvColumns(reflect.TypeOf((*T)(nil)).Elem())
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	s := &csvStream[T]{
+		rc:      http.NewResponseController(w),
+		cw:      csv.NewWriter(w),
+		columns: columns,
+		record:  make([]string, len(columns)),
+	}
+	for i, c := range columns {
+		s.record[i] = c.name
+	}
+	s.cw.Write(s.record)
+	return s
+}
+
+// write writes item as a row. An error means the client went away.
+func (s *csvStream[T]) write(item T) error {
+	v := reflect.ValueOf(item)
+	for i, c := range s.columns {
+		s.record[i] = csvValue(v.FieldByIndex(c.index))
+	}
+	if err := s.cw.Write(s.record); err != nil {
+		return err
+	}
+	if s.rows++; s.rows%csvFlushRows == 0 {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush sends the buffered rows to the client
+func (s *csvStream[T]) flush() error {
+	s.cw.Flush()
+	if err := s.cw.Error(); err != nil {
+		return err
+	}
+	if err := s.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// writeCSV writes list items as a CSV attachment named name.csv
+func writeCSV[T any](w http.ResponseWriter, name string, items []T) {
+	s := newCSVStream[T](w, name)
+	for _, item := range items {
+		if err := s.write(item); err != nil {
+			return
+		}
+	}
+	s.flush()
+}
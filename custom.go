@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/callsign"
+)
+
+// customFormat is an operator's Go template for /v1/{callsign}/custom/{app}
+type customFormat struct {
+	tmpl interface {
+		Execute(io.Writer, interface{}) error
+	}
+	contentType string
+}
+
+// customFormats are the FORMAT_TEMPLATE formats by app name; "" is the
+// default for apps without their own
+type customFormats map[string]customFormat
+
+// customRecord is what a format template is executed with: the record's
+// fields (.Call, .FName, ..., .DataSource) and the request's app, selected
+// fields, and time
+type customRecord struct {
+	SourceRecord
+	// App is the {app} of the request
+	App string
+	// Fields holds the non-empty values by HamDB name, as ?fields= selects
+	// them, for templates that range over whatever is there
+	Fields map[string]string
+	// Now is when the request was made, for "printed on" lines
+	Now time.Time
+}
+
+// customFuncs are the functions templates can call besides the built-ins
+var customFuncs = map[string]interface{}{
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"phonetic": callsign.Phonetic,
+	"morse":    callsign.Morse,
+}
+
+// loadCustomFormats reads FORMAT_TEMPLATE: a template file used for every
+// app, or a directory of them named <app>.<ext>, with default.<ext> for
+// other apps. The extension sets the Content-Type, and .html templates
+// escape values as HTML.
+func loadCustomFormats(path string) (customFormats, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		f, err := parseCustomFormat(path)
+		if err != nil {
+			return nil, err
+		}
+		return customFormats{"": f}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	formats := customFormats{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		app := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+		if app == "default" {
+			app = ""
+		}
+		if _, dup := formats[app]; dup {
+			return nil, fmt.Errorf("%s: more than one template for %q", path, strings.TrimSuffix(name, filepath.Ext(name)))
+		}
+		if formats[app], err = parseCustomFormat(filepath.Join(path, name)); err != nil {
+			return nil, err
+		}
+	}
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("%s has no templates", path)
+	}
+	return formats, nil
+}
+
+// parseCustomFormat parses one template file and executes it on an empty
+// record, so a misspelled field fails at startup rather than on a request
+func parseCustomFormat(path string) (customFormat, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return customFormat{}, err
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	f := customFormat{contentType: mime.TypeByExtension(ext)}
+	if f.contentType == "" || ext == ".tmpl" {
+		f.contentType = "text/plain; charset=utf-8"
+	}
+
+	name := filepath.Base(path)
+	if ext == ".html" || ext == ".htm" {
+		f.tmpl, err = htmltemplate.New(name).Funcs(customFuncs).Parse(string(data))
+	} else {
+		f.tmpl, err = template.New(name).Funcs(customFuncs).Parse(string(data))
+	}
+	if err != nil {
+		return customFormat{}, err
+	}
+	if err := f.tmpl.Execute(io.Discard, customRecord{Fields: map[string]string{}}); err != nil {
+		return customFormat{}, err
+	}
+	return f, nil
+}
+
+// handleCallsignCustom handles /v1/{callsign}/custom/{app}: the callsign's
+// record rendered by the operator's template for app (FORMAT_TEMPLATE), such
+// as an HTML card, BBS text, or a label printer's format
+func handleCallsignCustom(w http.ResponseWriter, r *http.Request, call, app string) {
+	formats := cfg().formats
+	if formats == nil {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "no custom formats are configured")
+		return
+	}
+	f, ok := formats[strings.ToLower(app)]
+	if !ok {
+		if f, ok = formats[""]; !ok {
+			writeError(w, r, http.StatusNotFound, codeNotFound, fmt.Sprintf("no custom format for app %q", app))
+			return
+		}
+	}
+	out, err := parseOutputOptions(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	rec, ok := lookupCallsign(ctx, call, strings.ToUpper(r.URL.Query().Get("source")))
+	if !ok {
+		markNotFound(w)
+		writeText(w, http.StatusNotFound, call+": not found\n")
+		return
+	}
+	lookupOverride(ctx, rec.Call).apply(&rec.CallsignData)
+
+	fields := map[string]string{}
+	for name, v := range rec.values() {
+		if v != "" && out.wants(name) {
+			fields[name] = v
+		}
+	}
+	// Rendered in full first, so a failing template doesn't send half a page
+	var buf bytes.Buffer
+	if err := f.tmpl.Execute(&buf, customRecord{SourceRecord: rec, App: app, Fields: fields, Now: time.Now()}); err != nil {
+		log.Printf("Custom format for %q failed: %v", app, err)
+		writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "the custom format failed")
+		return
+	}
+	w.Header().Set("Content-Type", f.contentType)
+	w.Write(buf.Bytes())
+}
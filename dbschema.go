@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// columnCache remembers column lookups per connection. The API is read-only
+// and can't migrate the schema, so queries adapt to what the database has.
+var columnCache sync.Map
+
+// hasColumn reports whether the attached database has table.column
+func hasColumn(ctx context.Context, d *sql.DB, table, column string) bool {
+	key := fmt.Sprintf("%p/%s.%s", d, table, column)
+	if v, ok := columnCache.Load(key); ok {
+		return v.(bool)
+	}
+
+	has, err := schema.HasColumn(ctx, d, table, column)
+	if err != nil {
+		return false
+	}
+	columnCache.Store(key, has)
+	return has
+}
+
+// countryExpr returns the SQL expression for a record's country
+func countryExpr(ctx context.Context, d *sql.DB) string {
+	return schema.CountryExpr(hasColumn(ctx, d, "callsigns", "country"))
+}
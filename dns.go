@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/dnstxt"
+)
+
+// DNSConfig is the optional DNS TXT responder: DNS_LISTEN is the UDP and TCP
+// address, DNS_ZONE the domain callsigns are looked up under, and DNS_TTL
+// how long resolvers may cache answers (default 1h)
+type DNSConfig struct {
+	Listen string
+	Zone   string
+	TTL    time.Duration
+}
+
+// loadDNSConfig reads the DNS responder settings; Listen is empty when it
+// is off
+func loadDNSConfig(getenv func(string) string) (DNSConfig, error) {
+	cfg := DNSConfig{
+		Listen: getenv("DNS_LISTEN"),
+		Zone:   strings.ToLower(strings.Trim(getenv("DNS_ZONE"), ".")),
+		TTL:    time.Hour,
+	}
+	if cfg.Listen == "" {
+		return cfg, nil
+	}
+	if cfg.Zone == "" {
+		return cfg, errors.New("DNS_LISTEN requires DNS_ZONE, e.g. call.example.com")
+	}
+	if v := getenv("DNS_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("invalid DNS_TTL %q", v)
+		}
+		cfg.TTL = d
+	}
+	return cfg, nil
+}
+
+// startDNS answers TXT queries for <callsign>.<zone> with the record a
+// lookup returns, as "key=value" strings. Both listeners are opened before
+// returning so a bad address fails at startup.
+func startDNS(ctx context.Context, cfg DNSConfig) error {
+	pc, err := net.ListenPacket("udp", cfg.Listen)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		pc.Close()
+		return err
+	}
+
+	srv := &dnstxt.Server{Zone: cfg.Zone, TTL: cfg.TTL, Lookup: dnsRecord, Allow: dnsAllowed}
+	go func() {
+		if err := srv.ServeUDP(ctx, pc); err != nil {
+			log.Printf("DNS responder stopped: %v", err)
+		}
+	}()
+	go func() {
+		if err := srv.ServeTCP(ctx, l); err != nil {
+			log.Printf("DNS responder stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// dnsAllowed reports whether a query from ip is within the rate limit
+// shared with HTTP and telnet lookups
+func dnsAllowed(ip string) bool {
+	limiter := cfg().limiter
+	if limiter == nil {
+		return true
+	}
+	ok, _ := limiter.allow(ip, time.Now())
+	return ok
+}
+
+// dnsRecord returns a callsign's fields as TXT strings
+func dnsRecord(ctx context.Context, label string) ([]string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, cfg().queryTimeout)
+	defer cancel()
+	rec, ok := callbookRecord(ctx, baseCall(label))
+	if !ok {
+		return nil, false
+	}
+	return textFields(rec.CallsignData, outputOptions{}, "="), true
+}
@@ -4,8 +4,16 @@ set -e
 # Database path from environment or default
 DB_PATH="${DB_PATH:-/data/hamqrzdb.sqlite}"
 
+# Restore the latest backup into a fresh volume, if backups are configured
+if [ ! -f "$DB_PATH" ] && [ -n "$BACKUP_S3_URL" ]; then
+    echo "☁️  Database file not found, restoring latest backup from $BACKUP_S3_URL..."
+    /app/hamqrzdb restore --db "$DB_PATH" || echo "⚠️  Restore failed, continuing without a backup"
+fi
+
 # Check if database exists
-if [ ! -f "$DB_PATH" ]; then
+if [ ! -f "$DB_PATH" ] && [ -n "$BOOTSTRAP_DB_URL" ]; then
+    echo "📥 Database file not found, the API will download $BOOTSTRAP_DB_URL"
+elif [ ! -f "$DB_PATH" ]; then
     echo "� Database file not found at $DB_PATH"
     echo "� Creating empty database with schema..."
     
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/eqsl"
+	"github.com/chriskacerguis/hamqrzdb/internal/httpclient"
+)
+
+// lookupEQSL reports whether a callsign is on the eQSL AG member list. It
+// returns nil when no list has been loaded, so lookups don't claim a
+// callsign isn't a member when the answer is unknown.
+func lookupEQSL(ctx context.Context, callsign string) *bool {
+	d := getDB()
+	if d == nil || !hasColumn(ctx, d, "eqsl_ag", "callsign") {
+		return nil
+	}
+
+	var loaded, member bool
+	err := d.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM eqsl_ag), EXISTS (SELECT 1 FROM eqsl_ag WHERE callsign = ?)
+	`, callsign).Scan(&loaded, &member)
+	if err != nil {
+		log.Printf("Database error looking up eQSL AG status for %s: %v", callsign, err)
+		return nil
+	}
+	if !loaded {
+		return nil
+	}
+	return &member
+}
+
+// refreshEQSL downloads the eQSL AG member list (EQSL_AG_URL, or eQSL.cc's)
+// into the database through a short-lived writable connection
+func refreshEQSL(ctx context.Context, dbPath string) error {
+	if err := refuseBundle(ctx); err != nil {
+		return err
+	}
+	url := os.Getenv("EQSL_AG_URL")
+	if url == "" {
+		url = eqsl.DefaultURL
+	}
+
+	client, err := httpclient.New("")
+	if err != nil {
+		return err
+	}
+	body, err := eqsl.Download(ctx, client, url)
+	if err != nil {
+		return fmt.Errorf("failed to download eQSL AG list: %w", err)
+	}
+	defer body.Close()
+
+	rw, err := openWritableDB(ctx, dbPath)
+	if err != nil {
+		return err
+	}
+	defer rw.Close()
+
+	_, err = eqsl.Import(ctx, rw, body)
+	return err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Error codes returned in APIErrorDetail.Code. /v1 keeps the names it has
+// always used for a few of them (see v1ErrorCodes).
+const (
+	codeInvalidParameter    = "INVALID_PARAMETER"
+	codeInvalidCallsign     = "INVALID_CALLSIGN"
+	codeInvalidURL          = "INVALID_URL"
+	codeNotFound            = "NOT_FOUND"
+	codeRedacted            = "REDACTED"
+	codeRateLimited         = "RATE_LIMITED"
+	codeDBUnavailable       = "DB_UNAVAILABLE"
+	codeUnsupportedDatabase = "UNSUPPORTED_DATABASE"
+	codeQueryFailed         = "QUERY_FAILED"
+)
+
+// v1ErrorCodes maps codes to the names /v1 returned before the taxonomy
+var v1ErrorCodes = map[string]string{
+	codeInvalidCallsign: codeInvalidParameter,
+	codeDBUnavailable:   "UNAVAILABLE",
+}
+
+// APIError is the body of a strict-mode error response
+type APIError struct {
+	Error APIErrorDetail `json:"error"`
+}
+
+// APIErrorDetail describes what went wrong
+type APIErrorDetail struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Detail adds specifics for programs, such as the offending parameter;
+	// /v2 only
+	Detail string `json:"detail,omitempty"`
+	// RequestID is the request's X-Request-ID, to quote when reporting it
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// isV2 reports whether the request is for the /v2 API, which always uses
+// real status codes and the full error taxonomy
+func isV2(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/v2/")
+}
+
+// isStrict reports whether the request wants real HTTP status codes instead
+// of HamDB-compatible 200 responses. The flat shape has no HamDB clients to
+// stay compatible with, so it is strict unless ?strict=0.
+func isStrict(r *http.Request) bool {
+	if isV2(r) {
+		return true
+	}
+	if v := r.URL.Query().Get("strict"); v != "" {
+		strict, err := strconv.ParseBool(v)
+		return err == nil && strict
+	}
+	return cfg().strictStatus || requestFormat(r) == formatFlat
+}
+
+// writeError writes a structured error with the given HTTP status
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeErrorDetail(w, r, status, code, message, "")
+}
+
+// writeErrorDetail writes a structured error with a detail for /v2 clients
+func writeErrorDetail(w http.ResponseWriter, r *http.Request, status int, code, message, detail string) {
+	if !isV2(r) {
+		if legacy, ok := v1ErrorCodes[code]; ok {
+			code = legacy
+		}
+		detail = ""
+	}
+	writeJSON(w, r, status, APIError{
+		Error: APIErrorDetail{
+			Status: status, Code: code, Message: message, Detail: detail,
+			RequestID: requestIDFrom(r.Context()),
+		},
+	})
+}
+
+// handleV2NotFound answers /v2 paths that aren't an endpoint
+func handleV2NotFound(w http.ResponseWriter, r *http.Request) {
+	writeErrorDetail(w, r, http.StatusNotFound, codeNotFound, "no such endpoint", r.URL.Path)
+}
+
+// writeInvalidURL rejects a malformed lookup path: 400 in strict mode,
+// otherwise the HamDB-compatible NOT_FOUND body
+func writeInvalidURL(w http.ResponseWriter, r *http.Request) {
+	if isStrict(r) {
+		writeError(w, r, http.StatusBadRequest, codeInvalidURL,
+			"expected /v1/{callsign}/json/{app}")
+		return
+	}
+	writeNotFound(w, r, "INVALID_URL")
+}
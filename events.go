@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// SpecialEvent describes a 1x1 special event callsign assignment
+type SpecialEvent struct {
+	Name        string `json:"name"`
+	StartDate   string `json:"start_date"`
+	EndDate     string `json:"end_date"`
+	Trustee     string `json:"trustee,omitempty"`
+	Coordinator string `json:"coordinator,omitempty"`
+	City        string `json:"city,omitempty"`
+	State       string `json:"state,omitempty"`
+	Active      bool   `json:"active"`
+}
+
+// lookupSpecialEvent returns the 1x1 event assignment for a callsign: the
+// active event if there is one, else the next upcoming event, else the most
+// recent past one. 1x1 calls are reissued for many events over the years.
+func lookupSpecialEvent(ctx context.Context, callsign string) *SpecialEvent {
+	d := getDB()
+	if d == nil || !hasColumn(ctx, d, "special_events", "callsign") {
+		return nil
+	}
+
+	today := time.Now().Format("2006-01-02")
+	var e SpecialEvent
+	var end, name, trustee, coordinator, city, state sql.NullString
+	err := d.QueryRowContext(ctx, `
+		SELECT start_date, end_date, event_name, trustee, coordinator, city, state
+		FROM special_events
+		WHERE callsign = ?1
+		ORDER BY
+			CASE WHEN start_date <= ?2 AND COALESCE(end_date, start_date) >= ?2 THEN 0
+			     WHEN start_date > ?2 THEN 1
+			     ELSE 2 END,
+			CASE WHEN start_date > ?2 THEN start_date END,
+			start_date DESC
+		LIMIT 1
+	`, callsign, today).Scan(&e.StartDate, &end, &name, &trustee, &coordinator, &city, &state)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Database error looking up special event %s: %v", callsign, err)
+		}
+		return nil
+	}
+
+	e.EndDate = end.String
+	if e.EndDate == "" {
+		e.EndDate = e.StartDate
+	}
+	e.Name = name.String
+	e.Trustee = trustee.String
+	e.Coordinator = coordinator.String
+	e.City = city.String
+	e.State = state.String
+	e.Active = e.StartDate <= today && e.EndDate >= today
+	return &e
+}
+
+// eventCallsignData presents a special event as a HamDB callsign record so
+// existing clients show something useful for a 1x1 call
+func eventCallsignData(call string, e *SpecialEvent) CallsignData {
+	// Upcoming events have no status yet
+	status := ""
+	switch today := time.Now().Format("2006-01-02"); {
+	case e.Active:
+		status = "A"
+	case e.EndDate < today:
+		status = "E"
+	}
+	expires := e.EndDate
+	if t, err := time.Parse("2006-01-02", e.EndDate); err == nil {
+		expires = t.Format("01/02/2006")
+	}
+	return CallsignData{
+		Call:    call,
+		Status:  status,
+		Expires: expires,
+		Name:    e.Name,
+		Addr2:   e.City,
+		State:   e.State,
+		Country: "United States",
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/geo"
+)
+
+// ExamSession is a scheduled license exam session returned by /v1/exams
+type ExamSession struct {
+	Date     string  `json:"date"`
+	Time     string  `json:"time,omitempty"`
+	Source   string  `json:"source"`
+	Team     string  `json:"team,omitempty"`
+	Location string  `json:"location,omitempty"`
+	Address  string  `json:"address,omitempty"`
+	City     string  `json:"city,omitempty"`
+	State    string  `json:"state,omitempty"`
+	Zip      string  `json:"zip,omitempty"`
+	Contact  string  `json:"contact,omitempty"`
+	Phone    string  `json:"phone,omitempty"`
+	Email    string  `json:"email,omitempty"`
+	WalkIns  string  `json:"walk_ins,omitempty"`
+	Distance float64 `json:"distance"`
+}
+
+// Limits for /v1/exams
+const (
+	maxExamDays = 365
+	// defaultExamRadius is wider than /v1/nearby's, since people travel
+	// further for an exam than to meet a neighbour
+	defaultExamRadius = 100
+)
+
+// handleExams handles /v1/exams requests: exam sessions in the next ?days=
+// (default 60) within ?radius= (default 100) of the centre of the ?near=
+// grid square, soonest first. ?units=mi switches the radius and distances
+// to miles.
+func handleExams(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	grid := strings.TrimSpace(q.Get("near"))
+	if !validGridPrefix(strings.ToUpper(grid)) {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter, "near must be a Maidenhead locator such as EM10ci", "near")
+		return
+	}
+	myLat, myLon, err := geo.GridCenter(grid)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+
+	units := strings.ToLower(q.Get("units"))
+	scale := 1.0
+	switch units {
+	case "", "km":
+		units = "km"
+	case "mi":
+		scale = kmPerMile
+	default:
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter, "units must be km or mi", "units")
+		return
+	}
+
+	radius, err := positiveParam(q.Get("radius"), defaultExamRadius)
+	if err != nil || float64(radius)*scale > maxNearbyRadius {
+		writeError(w, r, http.StatusBadRequest, codeInvalidParameter,
+			"radius must be a positive integer of at most "+strconv.Itoa(maxNearbyRadius)+" km")
+		return
+	}
+	days, err := positiveParam(q.Get("days"), 60)
+	if err != nil || days > maxExamDays {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter,
+			"days must be a positive integer of at most "+strconv.Itoa(maxExamDays), "days")
+		return
+	}
+	list, err := parseListParams[ExamSession](r, 100)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+	radiusKm := float64(radius) * scale
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	d := getDB()
+	if d == nil {
+		writeError(w, r, http.StatusServiceUnavailable, codeDBUnavailable, "database not connected")
+		return
+	}
+	if !hasColumn(ctx, d, "exam_sessions", "session_date") {
+		writeError(w, r, http.StatusServiceUnavailable, codeUnsupportedDatabase,
+			"database has no exam sessions; run hamqrzdb import-exams to load them")
+		return
+	}
+
+	today := time.Now().UTC()
+	minLat, maxLat, minLon, maxLon := geo.BoundingBox(myLat, myLon, radiusKm)
+	rows, err := d.QueryContext(ctx, `
+		SELECT session_date, start_time, source, COALESCE(team, ''), location, COALESCE(address, ''),
+			COALESCE(city, ''), COALESCE(state, ''), COALESCE(zip_code, ''), COALESCE(contact, ''),
+			COALESCE(phone, ''), COALESCE(email, ''), COALESCE(walk_ins, ''), latitude, longitude
+		FROM exam_sessions
+		WHERE session_date BETWEEN ? AND ?
+		  AND latitude BETWEEN ? AND ?
+		  AND longitude BETWEEN ? AND ?
+	`, today.Format("2006-01-02"), today.AddDate(0, 0, days).Format("2006-01-02"),
+		minLat, maxLat, minLon, maxLon)
+	if err != nil {
+		log.Printf("Exam session query failed: %v", err)
+		writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "exam session query failed")
+		return
+	}
+	defer rows.Close()
+
+	sessions := []ExamSession{}
+	for rows.Next() {
+		var s ExamSession
+		var lat, lon sql.NullFloat64
+		if err := rows.Scan(&s.Date, &s.Time, &s.Source, &s.Team, &s.Location, &s.Address, &s.City, &s.State,
+			&s.Zip, &s.Contact, &s.Phone, &s.Email, &s.WalkIns, &lat, &lon); err != nil {
+			log.Printf("Exam session scan failed: %v", err)
+			continue
+		}
+		km := geo.Distance(myLat, myLon, lat.Float64, lon.Float64)
+		if km > radiusKm {
+			continue
+		}
+		s.Distance = math.Round(km/scale*10) / 10
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Exam session query failed: %v", err)
+		writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "exam session query failed")
+		return
+	}
+
+	// Soonest first, nearest first on the same day; ?sort= reorders the page
+	// after this
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if sessions[i].Date != sessions[j].Date {
+			return sessions[i].Date < sessions[j].Date
+		}
+		return sessions[i].Distance < sessions[j].Distance
+	})
+
+	writeList(w, r, "exams", sessions, list, map[string]interface{}{
+		"near":   grid,
+		"radius": radius,
+		"units":  units,
+		"days":   days,
+	})
+}
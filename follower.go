@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/maintenance"
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
+)
+
+// followerClient fetches snapshots. A snapshot can take minutes to
+// download, so there is no overall timeout; instead the primary must answer
+// within followHeaderTimeout and keep sending within followIdleTimeout.
+var followerClient = &http.Client{Transport: followerTransport()}
+
+const (
+	followHeaderTimeout = 30 * time.Second
+	followIdleTimeout   = time.Minute
+)
+
+func followerTransport() http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ResponseHeaderTimeout = followHeaderTimeout
+	return t
+}
+
+// FollowConfig configures follower mode (FOLLOW_URL, FOLLOW_TOKEN,
+// FOLLOW_INTERVAL): the database is a copy of a primary's, refreshed from
+// its /admin/snapshot endpoint
+type FollowConfig struct {
+	Primary  string
+	Token    string
+	Interval time.Duration
+}
+
+// loadFollowConfig reads follower settings from the environment; Primary
+// is empty when follower mode is off
+func loadFollowConfig(getenv func(string) string) (FollowConfig, error) {
+	cfg := FollowConfig{
+		Primary:  strings.TrimSuffix(getenv("FOLLOW_URL"), "/"),
+		Token:    getenv("FOLLOW_TOKEN"),
+		Interval: 15 * time.Minute,
+	}
+	if v := getenv("FOLLOW_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid FOLLOW_INTERVAL %q", v)
+		}
+		cfg.Interval = d
+	}
+	return cfg, nil
+}
+
+// startFollower syncs the database at dbPath from the primary now and then
+// every interval
+func startFollower(ctx context.Context, dbPath string, cfg FollowConfig) {
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			err := tracing.Run(ctx, "follow primary", func(ctx context.Context) error {
+				return syncFromPrimary(ctx, dbPath, cfg)
+			})
+			if err != nil {
+				log.Printf("Follower sync failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// syncFromPrimary downloads the primary's snapshot if it changed since the
+// last sync, verifies it, and swaps it in for the served database
+func syncFromPrimary(ctx context.Context, dbPath string, cfg FollowConfig) error {
+	// The ETag of the copy we have is kept next to it, so a restart
+	// doesn't download an unchanged database again
+	etagPath := dbPath + ".etag"
+	etag := ""
+	if _, err := os.Stat(dbPath); err == nil {
+		if b, err := os.ReadFile(etagPath); err == nil {
+			etag = strings.TrimSpace(string(b))
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.Primary+"/admin/snapshot", nil)
+	if err != nil {
+		return err
+	}
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if tp := tracing.Traceparent(ctx); tp != "" {
+		req.Header.Set("traceparent", tp)
+	}
+
+	resp, err := followerClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil
+	case http.StatusOK:
+	default:
+		return fmt.Errorf("primary returned %s", resp.Status)
+	}
+
+	// Download beside the database so the rename is atomic
+	tmp := dbPath + ".download"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	n, err := io.Copy(f, &idleReader{r: resp.Body, timer: time.AfterFunc(followIdleTimeout, func() {
+		cancel(fmt.Errorf("primary sent nothing for %s", followIdleTimeout))
+	})})
+	if cause := context.Cause(ctx); err != nil && cause != nil {
+		err = cause
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download snapshot: %w", err)
+	}
+
+	if err := verifySnapshot(ctx, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return err
+	}
+	if newTag := resp.Header.Get("ETag"); newTag != "" {
+		_ = os.WriteFile(etagPath, []byte(newTag+"\n"), 0o644)
+	}
+	log.Printf("Synced %.1f MB from %s", float64(n)/1024/1024, cfg.Primary)
+	return reopenDB(ctx, dbPath)
+}
+
+// verifySnapshot runs a quick integrity check so a truncated or corrupt
+// download never replaces a working database
+func verifySnapshot(ctx context.Context, path string) error {
+	d, err := sql.Open("sqlite3", path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	report, err := maintenance.Verify(ctx, d, maintenance.VerifyOptions{Quick: true})
+	if err != nil {
+		return fmt.Errorf("failed to verify snapshot: %w", err)
+	}
+	if !report.OK() {
+		return errors.New("snapshot failed verification: " + strings.Join(report.Problems, "; "))
+	}
+	return nil
+}
+
+// idleReader restarts timer, which cancels the download, after every read
+// that makes progress
+type idleReader struct {
+	r     io.Reader
+	timer *time.Timer
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.timer.Reset(followIdleTimeout)
+	}
+	if err != nil {
+		r.timer.Stop()
+	}
+	return n, err
+}
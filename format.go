@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Output shapes selected with ?format=
+const (
+	formatHamDB = "hamdb"
+	formatFlat  = "flat"
+)
+
+// outputField maps a HamDB callsign field to its name in the flat shape
+type outputField struct {
+	legacy string
+	flat   string
+}
+
+// outputFields are the fields ?fields= can select, by HamDB name. The flat
+// shape uses camelCase names and also accepts them in ?fields=.
+var outputFields = []outputField{
+	{"call", "callsign"},
+	{"class", "class"},
+	{"expires", "expires"},
+	{"status", "status"},
+	{"grid", "grid"},
+	{"lat", "latitude"},
+	{"lon", "longitude"},
+	{"fname", "firstName"},
+	{"mi", "middleInitial"},
+	{"name", "lastName"},
+	{"suffix", "suffix"},
+	{"addr1", "address"},
+	{"addr2", "city"},
+	{"state", "state"},
+	{"zip", "zip"},
+	{"country", "country"},
+	{"licensed_since", "licensedSince"},
+	{"preferred_name", "preferredName"},
+	{"qsl_manager", "qslManager"},
+	{"special_conditions", "specialConditions"},
+	{"source", "source"},
+	{"special_event", "specialEvent"},
+	{"commercial_licenses", "commercialLicenses"},
+	{"eqsl", "eqsl"},
+	{"programs", "programs"},
+	{"club", "club"},
+}
+
+// outputOptions are the per-request response shape settings
+type outputOptions struct {
+	format string
+	// fields holds selected HamDB field names; nil selects everything
+	fields map[string]bool
+}
+
+// requestFormat returns the ?format= value, defaulting to the HamDB shape
+func requestFormat(r *http.Request) string {
+	if f := strings.ToLower(r.URL.Query().Get("format")); f != "" {
+		return f
+	}
+	return formatHamDB
+}
+
+// parseOutputOptions reads ?format= and ?fields= from the request
+func parseOutputOptions(r *http.Request) (outputOptions, error) {
+	o := outputOptions{format: requestFormat(r)}
+	switch o.format {
+	case formatHamDB, formatFlat:
+	default:
+		return o, fmt.Errorf("unknown format %q (expected hamdb or flat)", o.format)
+	}
+
+	v := r.URL.Query().Get("fields")
+	if v == "" {
+		return o, nil
+	}
+	o.fields = map[string]bool{}
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		f, ok := lookupOutputField(name)
+		if !ok {
+			return o, fmt.Errorf("unknown field %q", name)
+		}
+		o.fields[f.legacy] = true
+	}
+	return o, nil
+}
+
+// lookupOutputField finds a field by its HamDB or flat name
+func lookupOutputField(name string) (outputField, bool) {
+	for _, f := range outputFields {
+		if strings.EqualFold(name, f.legacy) || strings.EqualFold(name, f.flat) {
+			return f, true
+		}
+	}
+	return outputField{}, false
+}
+
+func (o outputOptions) wants(legacy string) bool {
+	return o.fields == nil || o.fields[legacy]
+}
+
+// values returns the callsign fields keyed by HamDB name
+func (c CallsignData) values() map[string]string {
+	return map[string]string{
+		"call": c.Call, "class": c.Class, "expires": c.Expires, "status": c.Status,
+		"grid": c.Grid, "lat": c.Lat, "lon": c.Lon, "fname": c.FName, "mi": c.MI,
+		"name": c.Name, "suffix": c.Suffix, "addr1": c.Addr1, "addr2": c.Addr2,
+		"state": c.State, "zip": c.Zip, "country": c.Country, "licensed_since": c.LicensedSince,
+		"preferred_name": c.PreferredName, "qsl_manager": c.QSLManager,
+	}
+}
+
+// render shapes a lookup result for the response. The default HamDB shape
+// without ?fields= is returned unchanged so it stays byte-compatible.
+func (o outputOptions) render(data HamDBData) interface{} {
+	if o.format == formatFlat {
+		return o.renderFlat(data)
+	}
+	if o.fields == nil {
+		return HamDBResponse{HamDB: data}
+	}
+
+	out := map[string]interface{}{
+		"version":  data.Version,
+		"callsign": o.filter(data.Callsign.values()),
+		"messages": data.Messages,
+	}
+	if len(data.Records) > 0 {
+		records := make([]map[string]string, 0, len(data.Records))
+		for _, rec := range data.Records {
+			values := o.filter(rec.values())
+			values["data_source"] = rec.DataSource
+			records = append(records, values)
+		}
+		out["records"] = records
+	}
+	if len(data.SpecialConditions) > 0 && o.fields["special_conditions"] {
+		out["special_conditions"] = data.SpecialConditions
+	}
+	if data.Source != nil && o.fields["source"] {
+		out["source"] = data.Source
+	}
+	if data.SpecialEvent != nil && o.fields["special_event"] {
+		out["special_event"] = data.SpecialEvent
+	}
+	if len(data.CommercialLicenses) > 0 && o.fields["commercial_licenses"] {
+		out["commercial_licenses"] = data.CommercialLicenses
+	}
+	if data.EQSL != nil && o.fields["eqsl"] {
+		out["eqsl"] = *data.EQSL
+	}
+	if len(data.Programs) > 0 && o.fields["programs"] {
+		out["programs"] = data.Programs
+	}
+	if data.Club != nil && o.fields["club"] {
+		out["club"] = data.Club
+	}
+	if data.Provenance != nil {
+		out["provenance"] = data.Provenance
+	}
+	if data.ClassHistory != nil {
+		out["class_history"] = data.ClassHistory
+	}
+	return map[string]interface{}{"hamdb": out}
+}
+
+// filter keeps the selected fields of a HamDB-named value map
+func (o outputOptions) filter(values map[string]string) map[string]string {
+	if o.fields == nil {
+		return values
+	}
+	out := map[string]string{}
+	for name, value := range values {
+		if o.fields[name] {
+			out[name] = value
+		}
+	}
+	return out
+}
+
+// renderFlat returns the record without the hamdb wrapper, with camelCase names
+func (o outputOptions) renderFlat(data HamDBData) map[string]interface{} {
+	out := o.flatRecord(data.Callsign.values())
+	if len(data.SpecialConditions) > 0 && o.wants("special_conditions") {
+		out["specialConditions"] = data.SpecialConditions
+	}
+	if data.Source != nil && o.wants("source") {
+		out["source"] = data.Source
+	}
+	if data.SpecialEvent != nil && o.wants("special_event") {
+		out["specialEvent"] = data.SpecialEvent
+	}
+	if len(data.CommercialLicenses) > 0 && o.wants("commercial_licenses") {
+		out["commercialLicenses"] = data.CommercialLicenses
+	}
+	if data.EQSL != nil && o.wants("eqsl") {
+		out["eqsl"] = *data.EQSL
+	}
+	if len(data.Programs) > 0 && o.wants("programs") {
+		out["programs"] = data.Programs
+	}
+	if data.Club != nil && o.wants("club") {
+		out["club"] = data.Club
+	}
+	if data.Provenance != nil {
+		out["provenance"] = data.Provenance
+	}
+	if data.ClassHistory != nil {
+		out["classHistory"] = data.ClassHistory
+	}
+	if len(data.Records) > 0 {
+		records := make([]map[string]interface{}, 0, len(data.Records))
+		for _, rec := range data.Records {
+			flat := o.flatRecord(rec.values())
+			flat["dataSource"] = rec.DataSource
+			records = append(records, flat)
+		}
+		out["records"] = records
+	}
+	return out
+}
+
+// flatRecord renames the selected callsign fields to their flat names
+func (o outputOptions) flatRecord(values map[string]string) map[string]interface{} {
+	out := map[string]interface{}{}
+	for _, f := range outputFields {
+		if value, ok := values[f.legacy]; ok && o.wants(f.legacy) {
+			out[f.flat] = value
+		}
+	}
+	return out
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// freshnessTTL is how long the database date and record count are reused;
+// counting every record on each lookup would be far slower than the lookup
+const freshnessTTL = time.Minute
+
+var (
+	freshnessMu sync.Mutex
+	freshness   struct {
+		db        *sql.DB
+		fetched   time.Time
+		date      string
+		count     int64
+		available bool
+	}
+)
+
+// wantsFreshness reports whether the request's response should include the
+// freshness messages
+func wantsFreshness(r *http.Request) bool {
+	if v := r.URL.Query().Get("freshness"); v != "" {
+		want, err := strconv.ParseBool(v)
+		return err == nil && want
+	}
+	return cfg().freshnessMessages
+}
+
+// lookupMessages returns the messages of a lookup response with the given
+// status, plus db_date (when the last import finished, YYYY-MM-DD) and
+// record_count if the request wants them
+func lookupMessages(ctx context.Context, r *http.Request, status string) map[string]string {
+	messages := map[string]string{"status": status}
+	if !wantsFreshness(r) {
+		return messages
+	}
+	if date, count, ok := databaseFreshness(ctx); ok {
+		messages["db_date"] = date
+		messages["record_count"] = strconv.FormatInt(count, 10)
+	}
+	return messages
+}
+
+// databaseFreshness returns the cached date and record count of the
+// served database, refreshing them when stale or the database changed
+func databaseFreshness(ctx context.Context) (date string, count int64, ok bool) {
+	d := getDB()
+	if d == nil {
+		return "", 0, false
+	}
+
+	freshnessMu.Lock()
+	defer freshnessMu.Unlock()
+	if freshness.db == d && time.Since(freshness.fetched) < freshnessTTL {
+		return freshness.date, freshness.count, freshness.available
+	}
+
+	// Import batches record when each import finished; older databases
+	// only have the per-record update time
+	var last sql.NullString
+	var err error
+	if hasColumn(ctx, d, "import_batches", "finished_at") {
+		err = d.QueryRowContext(ctx, `SELECT MAX(finished_at) FROM import_batches WHERE status = 'complete'`).Scan(&last)
+	}
+	if err == nil && !last.Valid {
+		err = d.QueryRowContext(ctx, `SELECT MAX(last_updated) FROM callsigns`).Scan(&last)
+	}
+	if err == nil {
+		err = d.QueryRowContext(ctx, `SELECT COUNT(*) FROM callsigns`).Scan(&count)
+	}
+	if err != nil {
+		log.Printf("Database error reading freshness: %v", err)
+		return "", 0, false
+	}
+
+	date = last.String
+	if len(date) > 10 {
+		date = date[:10]
+	}
+	freshness.db, freshness.fetched = d, time.Now()
+	freshness.date, freshness.count, freshness.available = date, count, true
+	return date, count, true
+}
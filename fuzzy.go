@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/fuzzy"
+)
+
+// FuzzyMatch is a near-miss candidate returned by /v1/fuzzy
+type FuzzyMatch struct {
+	Call       string  `json:"call"`
+	Distance   int     `json:"distance"`
+	Similarity float64 `json:"similarity"`
+	Status     string  `json:"status"`
+	Class      string  `json:"class"`
+	DataSource string  `json:"data_source"`
+}
+
+// Limits for /v1/fuzzy
+const (
+	maxFuzzyResults  = 100
+	maxFuzzyDistance = 2
+	// fuzzyCandidates caps the callsigns read from the trigram index before
+	// edit distances are computed
+	fuzzyCandidates = 2000
+)
+
+// handleFuzzy handles /v1/fuzzy/{callsign} and /v2/fuzzy/{callsign} requests: callsigns within
+// ?distance= edits (default and maximum 2) of a possibly busted call,
+// closest first. Candidates come from the trigram index, so a near miss
+// that shares no trigram with the query isn't found.
+func handleFuzzy(w http.ResponseWriter, r *http.Request) {
+	prefix, escaped, _ := strings.Cut(r.URL.EscapedPath(), "/fuzzy/")
+	raw, _ := url.PathUnescape(escaped)
+	call := baseCall(raw)
+	if call == "" || strings.Contains(call, "/") || len(call) > fuzzy.MaxCallsignLength {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidCallsign,
+			"a callsign is required, e.g. "+prefix+"/fuzzy/K1ABD", raw)
+		return
+	}
+
+	q := r.URL.Query()
+	maxDistance, err := positiveParam(q.Get("distance"), maxFuzzyDistance)
+	if err != nil || maxDistance > maxFuzzyDistance {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter, "distance must be 1 or 2", "distance")
+		return
+	}
+	limit, err := positiveParam(q.Get("limit"), 10)
+	if err != nil || limit > maxFuzzyResults {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter, "limit must be between 1 and "+strconv.Itoa(maxFuzzyResults), "limit")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	d := getDB()
+	if d == nil {
+		writeError(w, r, http.StatusServiceUnavailable, codeDBUnavailable, "database not connected")
+		return
+	}
+	if !hasColumn(ctx, d, "callsign_trigrams", "trigram") {
+		writeError(w, r, http.StatusServiceUnavailable, codeUnsupportedDatabase,
+			"database predates the trigram index; run an importer to migrate it")
+		return
+	}
+
+	trigrams := fuzzy.Trigrams(call)
+	args := make([]interface{}, 0, len(trigrams)+1)
+	for _, t := range trigrams {
+		args = append(args, t)
+	}
+	args = append(args, fuzzyCandidates)
+	rows, err := d.QueryContext(ctx, `
+		SELECT callsign, COUNT(*) AS shared
+		FROM callsign_trigrams
+		WHERE trigram IN (`+placeholders(len(trigrams))+`)
+		GROUP BY callsign
+		ORDER BY shared DESC, callsign
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		log.Printf("Fuzzy query failed: %v", err)
+		writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "fuzzy query failed")
+		return
+	}
+
+	matches := map[string]*FuzzyMatch{}
+	for rows.Next() {
+		var candidate string
+		var shared int
+		if err := rows.Scan(&candidate, &shared); err != nil {
+			log.Printf("Fuzzy scan failed: %v", err)
+			continue
+		}
+		candidate = strings.ToUpper(candidate)
+		if matches[candidate] != nil || abs(len(candidate)-len(call)) > maxDistance {
+			continue
+		}
+		dist := fuzzy.Distance(call, candidate)
+		if dist == 0 || dist > maxDistance {
+			continue
+		}
+		// Jaccard similarity of the two trigram sets
+		union := len(trigrams) + len(fuzzy.Trigrams(candidate)) - shared
+		matches[candidate] = &FuzzyMatch{
+			Call:       candidate,
+			Distance:   dist,
+			Similarity: float64(int(float64(shared)/float64(union)*1000+0.5)) / 1000,
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Printf("Fuzzy query failed: %v", err)
+		writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "fuzzy query failed")
+		return
+	}
+
+	// Describe each candidate by its preferred record, as a lookup would
+	if len(matches) > 0 {
+		calls := make([]interface{}, 0, len(matches))
+		for c := range matches {
+			calls = append(calls, c)
+		}
+		rows, err := d.QueryContext(ctx, `
+			SELECT UPPER(callsign), COALESCE(license_status, '') AS status, COALESCE(operator_class, ''),
+				`+sourceExpr(ctx, d)+` AS source
+			FROM callsigns
+			WHERE UPPER(callsign) IN (`+placeholders(len(calls))+`)
+			ORDER BY status = 'A' DESC, source = '', source
+		`, calls...)
+		if err != nil {
+			log.Printf("Fuzzy query failed: %v", err)
+			writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "fuzzy query failed")
+			return
+		}
+		described := map[string]bool{}
+		for rows.Next() {
+			var c, status, class, source string
+			if err := rows.Scan(&c, &status, &class, &source); err != nil {
+				log.Printf("Fuzzy scan failed: %v", err)
+				continue
+			}
+			if m := matches[c]; m != nil && !described[c] {
+				m.Status, m.Class, m.DataSource = status, class, source
+				described[c] = true
+			}
+		}
+		rows.Close()
+	}
+
+	results := make([]FuzzyMatch, 0, len(matches))
+	for _, m := range matches {
+		results = append(results, *m)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		if a.Similarity != b.Similarity {
+			return a.Similarity > b.Similarity
+		}
+		if (a.Status == "A") != (b.Status == "A") {
+			return a.Status == "A"
+		}
+		return a.Call < b.Call
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"callsign":   call,
+		"count":      len(results),
+		"candidates": results,
+	})
+}
+
+// placeholders returns n comma-separated SQL parameter placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
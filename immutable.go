@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultImmutableMmapSize is the mmap_size used for immutable databases
+// unless DB_MMAP_SIZE is set: large enough to map a full multi-country
+// database, which the kernel can then share between replicas on one node
+const defaultImmutableMmapSize = 1 << 30
+
+// immutable is set when the database is opened with immutable=1: it lives on
+// a read-only volume, so SQLite skips locking and the WAL and -shm files,
+// which it couldn't create there
+var immutable bool
+
+// loadImmutable decides whether to serve dbPath as immutable from
+// DB_IMMUTABLE: auto (the default) detects a read-only file or directory
+func loadImmutable(getenv func(string) string, dbPath string) (bool, error) {
+	switch v := strings.ToLower(getenv("DB_IMMUTABLE")); v {
+	case "", "auto":
+		return readOnlyVolume(dbPath), nil
+	default:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("invalid DB_IMMUTABLE %q (expected auto, true, or false)", v)
+		}
+		return b, nil
+	}
+}
+
+// loadMmapSize reads DB_MMAP_SIZE in bytes; the default is no memory
+// mapping, or defaultImmutableMmapSize for immutable databases
+func loadMmapSize(getenv func(string) string, immutable bool) (int64, error) {
+	v := getenv("DB_MMAP_SIZE")
+	if v == "" {
+		if immutable {
+			return defaultImmutableMmapSize, nil
+		}
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid DB_MMAP_SIZE %q", v)
+	}
+	return n, nil
+}
+
+// readOnlyVolume reports whether dbPath, or the directory SQLite would create
+// its WAL and -shm files in, can't be written
+func readOnlyVolume(dbPath string) bool {
+	if f, err := os.OpenFile(dbPath, os.O_WRONLY, 0); err == nil {
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return true
+	}
+	f, err := os.CreateTemp(filepath.Dir(dbPath), ".hamqrzdb-write-test-*")
+	if err != nil {
+		return !os.IsNotExist(err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return false
+}
+
+// servingDSN returns the data source name the API opens dbPath with
+func servingDSN(dbPath string) string {
+	if !immutable {
+		return dbPath + "?cache=shared&mode=ro"
+	}
+	abs, err := filepath.Abs(dbPath)
+	if err != nil {
+		abs = dbPath
+	}
+	return (&url.URL{Scheme: "file", Path: abs, RawQuery: "mode=ro&immutable=1"}).String()
+}
@@ -0,0 +1,103 @@
+// Package aprs formats licence locations as APRS object reports, the packets
+// APRS-IS and mapping tools use to place stations that aren't transmitting
+// their own positions.
+package aprs
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ToCall is the destination of exported packets, from the experimental APZ
+// range since hamqrzdb has no registered tocall
+const ToCall = "APZHQZ"
+
+// DefaultSymbol is the house symbol from the primary table
+const DefaultSymbol = "/-"
+
+// maxComment is the longest comment an object report carries
+const maxComment = 43
+
+// Object is a station placed on the map by another station
+type Object struct {
+	// Name is the object's name, at most 9 characters; a callsign here
+	Name string
+	Lat  float64
+	Lon  float64
+	// Symbol is the symbol table identifier followed by the symbol code
+	Symbol  string
+	Comment string
+	// Killed marks the object deleted, removing it from maps that show it
+	Killed bool
+}
+
+// Packet returns the object as a TNC2 monitor format packet sent by from,
+// timestamped t: from>APZHQZ,TCPIP*:;NAME     *DDHHMMzDDMM.mmN/DDDMM.mmW-comment
+func (o Object) Packet(from string, t time.Time) string {
+	symbol := o.Symbol
+	if len(symbol) != 2 {
+		symbol = DefaultSymbol
+	}
+	state := "*"
+	if o.Killed {
+		state = "_"
+	}
+	name := strings.ToUpper(o.Name)
+	if len(name) > 9 {
+		name = name[:9]
+	}
+	return fmt.Sprintf("%s>%s,TCPIP*:;%-9s%s%sz%s%c%s%c%s",
+		strings.ToUpper(from), ToCall, name, state, t.UTC().Format("021504"),
+		latitude(o.Lat), symbol[0], longitude(o.Lon), symbol[1], comment(o.Comment))
+}
+
+// latitude formats a latitude as DDMM.mmN
+func latitude(lat float64) string {
+	hemisphere := 'N'
+	if lat < 0 {
+		hemisphere = 'S'
+	}
+	deg, min := degreesMinutes(math.Min(math.Abs(lat), 90))
+	return fmt.Sprintf("%02d%05.2f%c", deg, min, hemisphere)
+}
+
+// longitude formats a longitude as DDDMM.mmW
+func longitude(lon float64) string {
+	hemisphere := 'E'
+	if lon < 0 {
+		hemisphere = 'W'
+	}
+	deg, min := degreesMinutes(math.Min(math.Abs(lon), 180))
+	return fmt.Sprintf("%03d%05.2f%c", deg, min, hemisphere)
+}
+
+// degreesMinutes splits decimal degrees into whole degrees and minutes
+// rounded to hundredths, carrying 60 minutes into the degrees
+func degreesMinutes(v float64) (int, float64) {
+	deg := math.Floor(v)
+	min := math.Round((v-deg)*60*100) / 100
+	if min >= 60 {
+		deg++
+		min = 0
+	}
+	return int(deg), min
+}
+
+// comment returns s as printable ASCII, without the characters APRS reserves
+// (| and ~), truncated to what an object report carries
+func comment(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < ' ' || r > '}' || r == '|' {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	out := strings.TrimSpace(b.String())
+	if len(out) > maxComment {
+		out = strings.TrimSpace(out[:maxComment])
+	}
+	return out
+}
@@ -0,0 +1,247 @@
+// Package backup uploads gzip-compressed snapshots of the database to an
+// S3-compatible object store and restores the latest one, so a destroyed
+// container can come back without a full re-import.
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/maintenance"
+)
+
+// latest is the object name of the most recent snapshot, under the prefix
+const latest = "latest.sqlite.gz"
+
+// errNotFound is returned when the requested object doesn't exist
+var errNotFound = errors.New("object not found")
+
+// ErrNoBackup is returned by Restore when the bucket has no snapshot yet
+var ErrNoBackup = errors.New("no backup found")
+
+// ErrNotModified is returned by Fetch when the latest snapshot is the one
+// the caller already has
+var ErrNotModified = errors.New("backup not modified")
+
+// Config is where snapshots are stored, read from the environment by
+// LoadConfig
+type Config struct {
+	Bucket string
+	// Prefix is prepended to object names, without a trailing slash
+	Prefix string
+	// Endpoint is the base URL of an S3-compatible service; empty for AWS
+	Endpoint     string
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// Enabled reports whether a backup location is configured
+func (c Config) Enabled() bool {
+	return c.Bucket != ""
+}
+
+// LoadConfig reads BACKUP_S3_URL (s3://bucket/prefix), BACKUP_S3_ENDPOINT,
+// and the standard AWS_REGION, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// and AWS_SESSION_TOKEN variables. Without BACKUP_S3_URL backups are off.
+func LoadConfig(getenv func(string) string) (Config, error) {
+	var cfg Config
+	v := getenv("BACKUP_S3_URL")
+	if v == "" {
+		return cfg, nil
+	}
+	u, err := url.Parse(v)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return cfg, fmt.Errorf("invalid BACKUP_S3_URL %q (expected s3://bucket/prefix)", v)
+	}
+	cfg.Bucket = u.Host
+	cfg.Prefix = strings.Trim(u.Path, "/")
+	cfg.Endpoint = getenv("BACKUP_S3_ENDPOINT")
+	cfg.Region = getenv("AWS_REGION")
+	if cfg.Region == "" {
+		cfg.Region = getenv("AWS_DEFAULT_REGION")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.AccessKey = getenv("AWS_ACCESS_KEY_ID")
+	cfg.SecretKey = getenv("AWS_SECRET_ACCESS_KEY")
+	cfg.SessionToken = getenv("AWS_SESSION_TOKEN")
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return cfg, errors.New("BACKUP_S3_URL requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return cfg, nil
+}
+
+// key returns the object name of name under the prefix
+func (c Config) key(name string) string {
+	if c.Prefix == "" {
+		return name
+	}
+	return c.Prefix + "/" + name
+}
+
+func (c Config) client() *s3Client {
+	return &s3Client{cfg: c, client: &http.Client{}}
+}
+
+// Upload writes a consistent snapshot of db (via VACUUM INTO) to the
+// bucket as the latest backup and as the backup of the day, so bucket
+// lifecycle rules can expire old days. It returns the compressed size.
+func Upload(ctx context.Context, cfg Config, db *sql.DB) (int64, error) {
+	dir, err := os.MkdirTemp("", "hamqrzdb-backup-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	snapshot := filepath.Join(dir, "snapshot.sqlite")
+	if _, err := db.ExecContext(ctx, "VACUUM main INTO ?", snapshot); err != nil {
+		return 0, fmt.Errorf("failed to snapshot database: %w", err)
+	}
+
+	compressed := snapshot + ".gz"
+	if err := gzipFile(snapshot, compressed); err != nil {
+		return 0, fmt.Errorf("failed to compress snapshot: %w", err)
+	}
+	os.Remove(snapshot)
+
+	c := cfg.client()
+	daily := time.Now().UTC().Format("2006-01-02") + ".sqlite.gz"
+	var size int64
+	for _, name := range []string{daily, latest} {
+		f, err := os.Open(compressed)
+		if err != nil {
+			return 0, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return 0, err
+		}
+		size = fi.Size()
+		err = c.put(ctx, cfg.key(name), f, size, "application/gzip")
+		f.Close()
+		if err != nil {
+			return 0, fmt.Errorf("failed to upload %s: %w", name, err)
+		}
+	}
+	log.Printf("Uploaded %.1f MB backup to s3://%s/%s", float64(size)/1024/1024, cfg.Bucket, cfg.key(latest))
+	return size, nil
+}
+
+// gzipFile compresses src into dst
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Restore downloads the latest backup to dbPath, replacing any file there
+// once the download has passed a quick integrity check. It returns
+// ErrNoBackup if the bucket has none.
+func Restore(ctx context.Context, cfg Config, dbPath string) error {
+	_, err := Fetch(ctx, cfg, dbPath, "")
+	return err
+}
+
+// Fetch is Restore for replicas that poll for new snapshots: given the
+// ETag of the snapshot they have, it returns ErrNotModified without
+// downloading anything if the latest is the same one. It returns the ETag
+// of the snapshot it restored.
+func Fetch(ctx context.Context, cfg Config, dbPath, etag string) (string, error) {
+	resp, err := cfg.client().get(ctx, cfg.key(latest), etag)
+	if errors.Is(err, errNotFound) {
+		return "", ErrNoBackup
+	}
+	if errors.Is(err, ErrNotModified) {
+		return etag, err
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to download backup: %w", err)
+	}
+	defer resp.Body.Close()
+
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	// Write beside the database so the rename is atomic
+	tmp := dbPath + ".restore"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp)
+	n, err := io.Copy(f, zr)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to download backup: %w", err)
+	}
+
+	if err := prepare(ctx, tmp); err != nil {
+		return "", err
+	}
+	// A WAL left by the old file would be applied to the restored one
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		os.Remove(dbPath + suffix)
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return "", err
+	}
+	log.Printf("Restored %.1f MB database from s3://%s/%s", float64(n)/1024/1024, cfg.Bucket, cfg.key(latest))
+	return resp.Header.Get("ETag"), nil
+}
+
+// prepare runs a quick integrity check on a downloaded database and drops
+// its shard layout: shard files aren't backed up, and the main database
+// holds every record, so it is served unsharded until resharded
+func prepare(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	report, err := maintenance.Verify(ctx, db, maintenance.VerifyOptions{Quick: true})
+	if err != nil {
+		return fmt.Errorf("failed to verify backup: %w", err)
+	}
+	if !report.OK() {
+		return errors.New("backup failed verification: " + strings.Join(report.Problems, "; "))
+	}
+	if _, err := db.ExecContext(ctx, "DELETE FROM shards"); err != nil && !strings.Contains(err.Error(), "no such table") {
+		return fmt.Errorf("failed to prepare backup: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package backup
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// unsignedPayload skips hashing request bodies, which S3 allows; uploads
+// are gzip files of hundreds of megabytes
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// s3Client makes Signature Version 4 signed requests to an S3-compatible
+// object store
+type s3Client struct {
+	cfg    Config
+	client *http.Client
+}
+
+// objectURL returns the URL of key: path-style against a custom endpoint
+// (MinIO, Backblaze B2, R2, ...), virtual-hosted style against AWS
+func (c *s3Client) objectURL(key string) *url.URL {
+	var u *url.URL
+	path := "/" + key
+	if c.cfg.Endpoint != "" {
+		u, _ = url.Parse(strings.TrimSuffix(c.cfg.Endpoint, "/"))
+		path = u.Path + "/" + c.cfg.Bucket + path
+	} else {
+		u = &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", c.cfg.Bucket, c.cfg.Region)}
+	}
+	// Signatures cover the path as S3 encodes it, which escapes more
+	// characters than net/url does
+	u.Path, u.RawPath = path, escapePath(path)
+	return u
+}
+
+// escapePath percent-encodes everything but unreserved characters and slashes
+func escapePath(p string) string {
+	return uriEncode(p, "-._~/")
+}
+
+// uriEncode percent-encodes everything but letters, digits, and the
+// characters in keep, as SigV4 canonical requests do: a space is %20,
+// never +
+func uriEncode(p, keep string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte(keep, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// put uploads size bytes from body to key
+func (c *s3Client) put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.objectURL(key).String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// get downloads key; the caller closes the body. A missing object is
+// reported as errNotFound, and with an etag, an unchanged one as
+// ErrNotModified.
+func (c *s3Client) get(ctx context.Context, key, etag string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	return c.do(req)
+}
+
+// do signs and sends req, turning error statuses into errors
+func (c *s3Client) do(req *http.Request) (*http.Response, error) {
+	c.sign(req, time.Now().UTC())
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, errNotFound
+	case http.StatusNotModified:
+		return nil, ErrNotModified
+	}
+	return nil, fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// signedHeaders are the headers besides Host and X-Amz-* that requests
+// sign when they have them
+var signedHeaders = map[string]bool{"content-md5": true, "content-type": true, "date": true, "range": true}
+
+// sign adds the AWS Signature Version 4 Authorization header to req. The
+// payload is unsigned unless req already has an X-Amz-Content-Sha256.
+func (c *s3Client) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	payload := req.Header.Get("X-Amz-Content-Sha256")
+	if payload == "" {
+		payload = unsignedPayload
+		req.Header.Set("X-Amz-Content-Sha256", payload)
+	}
+	if c.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") || signedHeaders[lower] {
+			// Values are trimmed, with runs of spaces collapsed to one
+			trimmed := make([]string, len(values))
+			for i, v := range values {
+				trimmed[i] = strings.Join(strings.Fields(v), " ")
+			}
+			headers[lower] = strings.Join(trimmed, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signed,
+		payload,
+	}, "\n")
+
+	scope := date + "/" + c.cfg.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretKey), date)
+	key = hmacSHA256(key, c.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.cfg.AccessKey, scope, signed, signature))
+}
+
+// canonicalQuery encodes a query string for signing: sorted by name and
+// then value, with both percent-encoded. url.Values.Encode would write
+// spaces as +, which S3 signs as %20.
+func canonicalQuery(q url.Values) string {
+	var params [][2]string
+	for name, values := range q {
+		for _, v := range values {
+			params = append(params, [2]string{uriEncode(name, "-._~"), uriEncode(v, "-._~")})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+	encoded := make([]string, len(params))
+	for i, p := range params {
+		encoded[i] = p[0] + "=" + p[1]
+	}
+	return strings.Join(encoded, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,279 @@
+// Package batch records import runs in the import_batches table. Every record
+// is tagged with its data source and the batch that last wrote it, so a full
+// re-import of one source can replace exactly that source's records.
+package batch
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/phonetic"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
+)
+
+// Data sources stored in callsigns.data_source
+const (
+	FCC   = "FCC"
+	Ofcom = "OFCOM"
+	RSM   = "RSM"
+	MIC   = "MIC"
+)
+
+// Non-amateur FCC services, whose licenses are kept in their own tables
+// rather than callsigns
+const (
+	GMRS       = "GMRS"
+	Commercial = "COML"
+)
+
+// serviceTables maps the non-amateur sources to their tables
+var serviceTables = map[string]string{
+	GMRS:       "gmrs_licenses",
+	Commercial: "commercial_licenses",
+}
+
+// Batch is a single import run of one data source
+type Batch struct {
+	ID     int64
+	Source string
+	// lastRowID is the table's highest rowid when the batch started; rows
+	// above it were added by the batch, since upserts keep a row's rowid
+	lastRowID int64
+}
+
+// table returns the table holding this batch's records
+func (b *Batch) table() string {
+	if t, ok := serviceTables[b.Source]; ok {
+		return t
+	}
+	return "callsigns"
+}
+
+// Start records the beginning of an import from source. detail describes the
+// input (file name, URL, or mode) for later inspection.
+func Start(ctx context.Context, db *sql.DB, source, detail string) (*Batch, error) {
+	b := &Batch{Source: source}
+	if err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(rowid), 0) FROM "+b.table()).Scan(&b.lastRowID); err != nil {
+		return nil, fmt.Errorf("failed to start import batch: %w", err)
+	}
+
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO import_batches (data_source, detail, started_at, status)
+		VALUES (?, ?, CURRENT_TIMESTAMP, 'running')
+	`, source, detail)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start import batch: %w", err)
+	}
+
+	b.ID, err = res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start import batch: %w", err)
+	}
+
+	log.Printf("Import batch %d started (%s)", b.ID, source)
+	tracing.FromContext(ctx).SetAttributes(
+		tracing.Int("import.batch", b.ID),
+		tracing.String("import.source", source),
+		tracing.String("import.detail", detail),
+	)
+	return b, nil
+}
+
+// Finish marks the batch complete or failed and records how many records it wrote
+func (b *Batch) Finish(ctx context.Context, db *sql.DB, importErr error) (err error) {
+	status := "complete"
+	if importErr != nil {
+		status = "failed"
+	}
+
+	// Use a fresh context so an interrupted import is still recorded as failed
+	if ctx.Err() != nil {
+		ctx = context.Background()
+	}
+	ctx, span := tracing.Start(ctx, "finish import batch",
+		tracing.Int("import.batch", b.ID),
+		tracing.String("import.source", b.Source),
+		tracing.String("import.status", status),
+	)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	// Dates are stored as published; their ISO twins sort and compare
+	fcc := b.Source == FCC || serviceTables[b.Source] != ""
+	sets := make([]string, len(schema.DateColumns))
+	for i, c := range schema.DateColumns {
+		sets[i] = c + "_iso = " + schema.ISODate(c, fcc)
+	}
+	if _, err := db.ExecContext(ctx, `
+		UPDATE `+b.table()+`
+		SET `+strings.Join(sets, ", ")+`
+		WHERE import_batch = ?
+	`, b.ID); err != nil {
+		return fmt.Errorf("failed to normalize dates: %w", err)
+	}
+
+	// licensed_since is the earliest grant date ever seen for a record, so it
+	// survives renewals that move grant_date forward
+	if _, err := db.ExecContext(ctx, `
+		UPDATE `+b.table()+`
+		SET licensed_since = grant_date_iso
+		WHERE import_batch = ?
+		  AND grant_date_iso IS NOT NULL
+		  AND (licensed_since IS NULL OR licensed_since > grant_date_iso)
+	`, b.ID); err != nil {
+		return fmt.Errorf("failed to update licensed_since: %w", err)
+	}
+
+	if b.table() == "callsigns" {
+		if err := FillPhoneticKeys(ctx, db); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.ExecContext(ctx, `
+		UPDATE import_batches
+		SET finished_at = CURRENT_TIMESTAMP,
+		    status = ?3,
+		    records = (SELECT COUNT(*) FROM `+b.table()+` WHERE import_batch = ?1),
+		    added = (SELECT COUNT(*) FROM `+b.table()+` WHERE import_batch = ?1 AND rowid > ?2)
+		WHERE id = ?1
+	`, b.ID, b.lastRowID, status)
+	if err != nil {
+		return fmt.Errorf("failed to finish import batch: %w", err)
+	}
+	return nil
+}
+
+// phoneticChunk is how many records FillPhoneticKeys updates per transaction
+const phoneticChunk = 10000
+
+// FillPhoneticKeys computes the Soundex and Metaphone keys of every callsigns
+// record without them: new records, records whose name changed (a trigger
+// clears their keys), and, once, every record of a migrated database. The
+// key is of the last name, or the entity name for clubs and other entities.
+func FillPhoneticKeys(ctx context.Context, db *sql.DB) error {
+	type key struct {
+		callsign, source, soundex, metaphone string
+	}
+
+	total := 0
+	for {
+		rows, err := db.QueryContext(ctx, `
+			SELECT callsign, data_source, COALESCE(NULLIF(last_name, ''), entity_name, '')
+			FROM callsigns
+			WHERE name_soundex IS NULL
+			LIMIT ?
+		`, phoneticChunk)
+		if err != nil {
+			return fmt.Errorf("failed to read names for phonetic keys: %w", err)
+		}
+		var keys []key
+		for rows.Next() {
+			var k key
+			var name string
+			if err := rows.Scan(&k.callsign, &k.source, &name); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to read names for phonetic keys: %w", err)
+			}
+			// Records without a name get empty keys so they aren't read again
+			k.soundex, k.metaphone = phonetic.Soundex(name), phonetic.Metaphone(name)
+			keys = append(keys, k)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read names for phonetic keys: %w", err)
+		}
+		if len(keys) == 0 {
+			break
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		stmt, err := tx.PrepareContext(ctx, `
+			UPDATE callsigns SET name_soundex = ?, name_metaphone = ?
+			WHERE callsign = ? AND data_source = ?
+		`)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		for _, k := range keys {
+			if _, err := stmt.ExecContext(ctx, k.soundex, k.metaphone, k.callsign, k.source); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to store phonetic keys: %w", err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to store phonetic keys: %w", err)
+		}
+		total += len(keys)
+	}
+
+	if total > 0 {
+		log.Printf("Computed phonetic name keys for %d records", total)
+	}
+	return nil
+}
+
+// Prune deletes records of this batch's source that the batch didn't write,
+// i.e. callsigns missing from a full re-import. Records from other sources
+// are never touched. It refuses to run if the batch wrote nothing, so an
+// empty or truncated download can't wipe a source.
+func (b *Batch) Prune(ctx context.Context, db *sql.DB) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var written int64
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+b.table()+" WHERE import_batch = ?", b.ID).Scan(&written); err != nil {
+		return 0, err
+	}
+	if written == 0 {
+		return 0, fmt.Errorf("batch %d wrote no records; refusing to prune %s", b.ID, b.Source)
+	}
+
+	// Service tables hold only their own source, so they have no data_source column
+	sourceMatch := "data_source = ?"
+	if b.table() != "callsigns" {
+		sourceMatch = "? != ''"
+	}
+	res, err := tx.ExecContext(ctx, `
+		DELETE FROM `+b.table()+`
+		WHERE `+sourceMatch+` AND (import_batch IS NULL OR import_batch != ?)
+	`, b.Source, b.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune %s records: %w", b.Source, err)
+	}
+	pruned, _ := res.RowsAffected()
+
+	// Detail tables hang off callsigns without foreign keys
+	if b.table() == "callsigns" {
+		for _, table := range []string{"special_conditions", "comments"} {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf(
+				"DELETE FROM %s WHERE callsign NOT IN (SELECT callsign FROM callsigns)", table)); err != nil {
+				return 0, fmt.Errorf("failed to prune %s: %w", table, err)
+			}
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE import_batches SET pruned = ? WHERE id = ?", pruned, b.ID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	log.Printf("Pruned %d %s records not present in batch %d", pruned, b.Source, b.ID)
+	return pruned, nil
+}
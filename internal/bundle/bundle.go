@@ -0,0 +1,254 @@
+// Package bundle builds trimmed copies of a database for offline use: the
+// licensees of a few states, grid squares, or ZIP codes with only the
+// columns a lookup returns, small enough to copy to ARES members' laptops
+// and serve from there.
+package bundle
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// ErrEmpty is returned when a filter matches no licensees
+var ErrEmpty = errors.New("no licensees match the bundle filter")
+
+// columns are the callsigns columns a bundle keeps: those lookups, nearby
+// searches, and the expiry reports read, and the provenance of each record
+var columns = []string{
+	"callsign", "license_status", "radio_service_code", "operator_class", "expired_date", "expired_date_iso",
+	"first_name", "mi", "last_name", "suffix", "entity_name",
+	"street_address", "city", "state", "zip_code", "country",
+	"latitude", "longitude", "grid_square", "data_source", "import_batch", "last_updated",
+}
+
+// ddl creates a bundle's tables
+const ddl = `
+CREATE TABLE callsigns (
+	callsign TEXT NOT NULL,
+	license_status TEXT,
+	radio_service_code TEXT,
+	operator_class TEXT,
+	expired_date TEXT,
+	expired_date_iso TEXT,
+	first_name TEXT,
+	mi TEXT,
+	last_name TEXT,
+	suffix TEXT,
+	entity_name TEXT,
+	street_address TEXT,
+	city TEXT,
+	state TEXT,
+	zip_code TEXT,
+	country TEXT,
+	latitude REAL,
+	longitude REAL,
+	grid_square TEXT,
+	data_source TEXT NOT NULL DEFAULT '',
+	import_batch INTEGER,
+	last_updated TIMESTAMP,
+	PRIMARY KEY (callsign, data_source)
+);
+
+CREATE INDEX idx_callsign ON callsigns(callsign);
+CREATE INDEX idx_location ON callsigns(latitude, longitude);
+CREATE INDEX idx_zip ON callsigns(zip_code COLLATE NOCASE);
+
+CREATE TABLE bundle (
+	filter TEXT NOT NULL,
+	callsigns INTEGER NOT NULL,
+	built_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// Filter selects a bundle's licensees. Each non-empty list must match: a
+// state, and a grid square prefix, and a ZIP code prefix.
+type Filter struct {
+	States []string
+	Grids  []string
+	Zips   []string
+}
+
+// IsEmpty reports whether the filter selects every licensee
+func (f Filter) IsEmpty() bool {
+	return len(f.States) == 0 && len(f.Grids) == 0 && len(f.Zips) == 0
+}
+
+// String describes the filter, e.g. "state=TX,OK grid=EM"
+func (f Filter) String() string {
+	var parts []string
+	for _, p := range []struct {
+		name   string
+		values []string
+	}{{"state", f.States}, {"grid", f.Grids}, {"zip", f.Zips}} {
+		if len(p.values) > 0 {
+			parts = append(parts, p.name+"="+strings.Join(p.values, ","))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// where returns the filter as a condition on callsigns rows, and its
+// arguments
+func (f Filter) where() (string, []interface{}) {
+	conds := []string{"1"}
+	var args []interface{}
+	for _, p := range []struct {
+		cond   string
+		values []string
+	}{
+		{"UPPER(state) = ?", f.States},
+		{"UPPER(grid_square) LIKE ? || '%'", f.Grids},
+		{"zip_code LIKE ? || '%'", f.Zips},
+	} {
+		if len(p.values) == 0 {
+			continue
+		}
+		var matches []string
+		for _, v := range p.values {
+			matches = append(matches, p.cond)
+			args = append(args, strings.ToUpper(v))
+		}
+		conds = append(conds, "("+strings.Join(matches, " OR ")+")")
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// Info describes a bundle
+type Info struct {
+	Filter    string `json:"filter"`
+	Callsigns int    `json:"callsigns"`
+	BuiltAt   string `json:"built_at"`
+}
+
+// Read returns the description of the bundle db, or nil if db isn't one
+func Read(ctx context.Context, db *sql.DB) (*Info, error) {
+	exists, err := schema.HasTable(ctx, db, "bundle")
+	if err != nil || !exists {
+		return nil, err
+	}
+	var info Info
+	err = db.QueryRowContext(ctx, "SELECT filter, callsigns, COALESCE(built_at, '') FROM bundle LIMIT 1").
+		Scan(&info.Filter, &info.Callsigns, &info.BuiltAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	return &info, nil
+}
+
+// Build writes a bundle of the licensees of src (the database at srcPath)
+// matching f to outPath. Repeaters in the bundle's states, and the
+// overrides and club directory entries of its callsigns, come along; the
+// import history is copied so the API reports the data's age. The bundle is
+// written to a temporary file and renamed into place when complete.
+func Build(ctx context.Context, src *sql.DB, srcPath, outPath string, f Filter) (Info, error) {
+	tmp := outPath + ".tmp"
+	os.Remove(tmp)
+	defer os.Remove(tmp)
+
+	out, err := sql.Open("sqlite3", tmp)
+	if err != nil {
+		return Info{}, err
+	}
+	defer out.Close()
+	// ATTACH is per connection
+	out.SetMaxOpenConns(1)
+
+	// Columns older databases lack are left empty
+	selects := make([]string, len(columns))
+	for i, c := range columns {
+		has, err := schema.HasColumn(ctx, src, "callsigns", c)
+		if err != nil {
+			return Info{}, err
+		}
+		switch {
+		case has:
+			selects[i] = c
+		case c == "data_source":
+			selects[i] = "''"
+		default:
+			selects[i] = "NULL"
+		}
+	}
+
+	if _, err := out.ExecContext(ctx, ddl); err != nil {
+		return Info{}, fmt.Errorf("failed to create bundle: %w", err)
+	}
+	if _, err := out.ExecContext(ctx, "ATTACH DATABASE ? AS src", srcPath); err != nil {
+		return Info{}, fmt.Errorf("failed to attach %s: %w", srcPath, err)
+	}
+
+	where, args := f.where()
+	res, err := out.ExecContext(ctx, `
+		INSERT INTO callsigns (`+strings.Join(columns, ", ")+`)
+		SELECT `+strings.Join(selects, ", ")+`
+		FROM src.callsigns
+		WHERE `+where, args...)
+	if err != nil {
+		return Info{}, fmt.Errorf("failed to copy callsigns: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return Info{}, ErrEmpty
+	}
+
+	// Optional tables, copied when the source has them
+	type tableCopy struct {
+		table, query string
+		args         []interface{}
+	}
+	copies := []tableCopy{
+		{"import_batches", "CREATE TABLE import_batches AS SELECT * FROM src.import_batches", nil},
+		{"overrides", "CREATE TABLE overrides AS SELECT * FROM src.overrides WHERE callsign IN (SELECT callsign FROM callsigns)", nil},
+		{"clubs", "CREATE TABLE clubs AS SELECT * FROM src.clubs WHERE callsign IN (SELECT callsign FROM callsigns)", nil},
+	}
+	if len(f.States) > 0 {
+		var states []interface{}
+		for _, s := range f.States {
+			states = append(states, strings.ToUpper(s))
+		}
+		copies = append(copies, tableCopy{"repeaters", "CREATE TABLE repeaters AS SELECT * FROM src.repeaters WHERE UPPER(state) IN (?" +
+			strings.Repeat(", ?", len(states)-1) + ")", states})
+	}
+	for _, c := range copies {
+		exists, err := schema.HasTable(ctx, src, c.table)
+		if err != nil {
+			return Info{}, err
+		}
+		if !exists {
+			continue
+		}
+		if _, err := out.ExecContext(ctx, c.query, c.args...); err != nil {
+			return Info{}, fmt.Errorf("failed to copy %s: %w", c.table, err)
+		}
+	}
+
+	if _, err := out.ExecContext(ctx, "INSERT INTO bundle (filter, callsigns) VALUES (?, (SELECT COUNT(DISTINCT callsign) FROM callsigns))", f.String()); err != nil {
+		return Info{}, err
+	}
+	if _, err := out.ExecContext(ctx, "DETACH DATABASE src"); err != nil {
+		return Info{}, err
+	}
+	if _, err := out.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", schema.Version)); err != nil {
+		return Info{}, err
+	}
+	if _, err := out.ExecContext(ctx, "VACUUM"); err != nil {
+		return Info{}, fmt.Errorf("failed to compact bundle: %w", err)
+	}
+	info, err := Read(ctx, out)
+	if err != nil {
+		return Info{}, err
+	}
+	if err := out.Close(); err != nil {
+		return Info{}, err
+	}
+	if err := os.Rename(tmp, outPath); err != nil {
+		return Info{}, err
+	}
+	return *info, nil
+}
@@ -0,0 +1,399 @@
+package bundle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// deltaFormat and deltaVersion identify a delta file
+const (
+	deltaFormat  = "hamqrzdb-bundle-delta"
+	deltaVersion = 1
+)
+
+// deltaKeys are the tables a delta carries, by the columns identifying a
+// row. The bundle table has no key: its one row is replaced.
+var deltaKeys = []struct {
+	table string
+	key   []string
+}{
+	{"callsigns", []string{"callsign", "data_source"}},
+	{"repeaters", []string{"callsign", "frequency"}},
+	{"overrides", []string{"callsign"}},
+	{"clubs", []string{"callsign"}},
+	{"import_batches", []string{"id"}},
+	{"bundle", nil},
+}
+
+// deltaHeader is the first record of a delta: the bundles it goes between
+type deltaHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	From    Info   `json:"from"`
+	To      Info   `json:"to"`
+}
+
+// deltaOp is a record of a delta. A record naming a table starts its
+// changes; the deletes and rows that follow apply to it.
+type deltaOp struct {
+	Table   string   `json:"table,omitempty"`
+	Columns []string `json:"columns,omitempty"`
+	Key     []string `json:"key,omitempty"`
+	// Delete is the key of a row to remove
+	Delete []interface{} `json:"delete,omitempty"`
+	// Row is a row to add, replacing any row with its key
+	Row []interface{} `json:"row,omitempty"`
+}
+
+// DeltaStats counts the changes in a delta
+type DeltaStats struct {
+	From    Info
+	To      Info
+	Deleted int
+	Written int
+}
+
+// Diff writes the changes that turn the bundle at fromPath into the one at
+// toPath to w, as gzip-compressed JSON records. Both must be bundles of the
+// same filter with the same tables.
+func Diff(ctx context.Context, fromPath, toPath string, w io.Writer) (DeltaStats, error) {
+	var stats DeltaStats
+
+	db, err := sql.Open("sqlite3", toPath+"?mode=ro")
+	if err != nil {
+		return stats, err
+	}
+	defer db.Close()
+	// ATTACH is per connection
+	db.SetMaxOpenConns(1)
+
+	to, err := Read(ctx, db)
+	if err != nil {
+		return stats, err
+	}
+	if to == nil {
+		return stats, fmt.Errorf("%s isn't a bundle", toPath)
+	}
+	if _, err := db.ExecContext(ctx, "ATTACH DATABASE ? AS old", fromPath); err != nil {
+		return stats, fmt.Errorf("failed to attach %s: %w", fromPath, err)
+	}
+	var from Info
+	err = db.QueryRowContext(ctx, "SELECT filter, callsigns, COALESCE(built_at, '') FROM old.bundle LIMIT 1").
+		Scan(&from.Filter, &from.Callsigns, &from.BuiltAt)
+	if err != nil {
+		return stats, fmt.Errorf("%s isn't a bundle: %w", fromPath, err)
+	}
+	if from.Filter != to.Filter {
+		return stats, fmt.Errorf("bundles have different filters (%s and %s)", from.Filter, to.Filter)
+	}
+	stats.From, stats.To = from, *to
+
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+	if err := enc.Encode(deltaHeader{Format: deltaFormat, Version: deltaVersion, From: from, To: *to}); err != nil {
+		return stats, err
+	}
+
+	for _, t := range deltaKeys {
+		oldColumns, err := tableColumns(ctx, db, "old", t.table)
+		if err != nil {
+			return stats, err
+		}
+		newColumns, err := tableColumns(ctx, db, "main", t.table)
+		if err != nil {
+			return stats, err
+		}
+		if len(oldColumns) == 0 && len(newColumns) == 0 {
+			continue
+		}
+		if strings.Join(oldColumns, ",") != strings.Join(newColumns, ",") {
+			return stats, fmt.Errorf("bundles have different %s tables; distribute the new bundle instead", t.table)
+		}
+		if err := enc.Encode(deltaOp{Table: t.table, Columns: newColumns, Key: t.key}); err != nil {
+			return stats, err
+		}
+
+		// Rows whose key is gone; changed rows are replaced by their new
+		// version below. A keyless table is replaced outright.
+		if len(t.key) > 0 {
+			key := rawColumns(t.key)
+			n, err := encodeRows(ctx, db, enc, `
+				SELECT `+key+` FROM old.`+t.table+`
+				EXCEPT
+				SELECT `+key+` FROM main.`+t.table, func(v []interface{}) deltaOp { return deltaOp{Delete: v} })
+			if err != nil {
+				return stats, fmt.Errorf("failed to diff %s: %w", t.table, err)
+			}
+			stats.Deleted += n
+		}
+
+		all := rawColumns(newColumns)
+		query := "SELECT " + all + " FROM main." + t.table
+		if len(t.key) > 0 {
+			query += " EXCEPT SELECT " + all + " FROM old." + t.table
+		}
+		n, err := encodeRows(ctx, db, enc, query, func(v []interface{}) deltaOp { return deltaOp{Row: v} })
+		if err != nil {
+			return stats, fmt.Errorf("failed to diff %s: %w", t.table, err)
+		}
+		stats.Written += n
+	}
+	return stats, gz.Close()
+}
+
+// rawColumns returns a select list of columns that reads their values as
+// stored: the driver converts columns declared TIMESTAMP to times, which
+// would change their text, but not expressions such as +column
+func rawColumns(columns []string) string {
+	return "+" + strings.Join(columns, ", +")
+}
+
+// tableColumns returns the columns of a table in the schema (main, or an
+// attached database), or nil if it has no such table
+func tableColumns(ctx context.Context, db queryer, schemaName, table string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM pragma_table_info(?, ?) ORDER BY cid", table, schemaName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect %s.%s: %w", schemaName, table, err)
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// queryer is a *sql.DB or *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// encodeRows writes a record made by op for each row of query
+func encodeRows(ctx context.Context, db *sql.DB, enc *json.Encoder, query string, op func([]interface{}) deltaOp) (int, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		if err := enc.Encode(op(encodeValues(values))); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// encodeValues prepares scanned values for JSON. Text comes back as bytes,
+// and a whole REAL such as 42.0 is written with a decimal point so it isn't
+// read back as an INTEGER.
+func encodeValues(values []interface{}) []interface{} {
+	for i, v := range values {
+		switch v := v.(type) {
+		case []byte:
+			values[i] = string(v)
+		case float64:
+			values[i] = deltaReal(v)
+		}
+	}
+	return values
+}
+
+// deltaReal is a REAL value, always encoded as a JSON number with a
+// fraction or exponent
+type deltaReal float64
+
+func (r deltaReal) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(float64(r))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.ContainsAny(b, ".eE") {
+		b = append(b, ".0"...)
+	}
+	return b, nil
+}
+
+// Apply applies a delta written by Diff to the bundle db in one
+// transaction. The bundle must be the one the delta was made from, and is
+// left unchanged if anything doesn't match.
+func Apply(ctx context.Context, db *sql.DB, r io.Reader) (DeltaStats, error) {
+	var stats DeltaStats
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return stats, fmt.Errorf("not a bundle delta: %w", err)
+	}
+	defer gz.Close()
+	dec := json.NewDecoder(gz)
+	dec.UseNumber()
+
+	var h deltaHeader
+	if err := dec.Decode(&h); err != nil || h.Format != deltaFormat {
+		return stats, errors.New("not a bundle delta")
+	}
+	if h.Version != deltaVersion {
+		return stats, fmt.Errorf("unsupported bundle delta version %d", h.Version)
+	}
+	stats.From, stats.To = h.From, h.To
+
+	current, err := Read(ctx, db)
+	if err != nil {
+		return stats, err
+	}
+	if current == nil {
+		return stats, errors.New("the database isn't a bundle")
+	}
+	if *current != h.From {
+		if *current == h.To {
+			return stats, errors.New("the delta is already applied")
+		}
+		return stats, fmt.Errorf("the delta updates the bundle built %s (%s), not this one built %s (%s)",
+			h.From.BuiltAt, h.From.Filter, current.BuiltAt, current.Filter)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return stats, err
+	}
+	defer tx.Rollback()
+
+	var table deltaOp
+	var insert, remove *sql.Stmt
+	defer func() {
+		if insert != nil {
+			insert.Close()
+			remove.Close()
+		}
+	}()
+	for {
+		var op deltaOp
+		if err := dec.Decode(&op); err == io.EOF {
+			break
+		} else if err != nil {
+			return stats, fmt.Errorf("corrupt bundle delta: %w", err)
+		}
+
+		switch {
+		case op.Table != "":
+			table = op
+			columns, err := tableColumns(ctx, tx, "main", table.Table)
+			if err != nil {
+				return stats, err
+			}
+			if strings.Join(columns, ",") != strings.Join(table.Columns, ",") {
+				return stats, fmt.Errorf("the bundle's %s table doesn't match the delta's", table.Table)
+			}
+			if insert != nil {
+				insert.Close()
+				remove.Close()
+			}
+			insert, err = tx.PrepareContext(ctx, "INSERT INTO "+table.Table+" ("+strings.Join(table.Columns, ", ")+
+				") VALUES (?"+strings.Repeat(", ?", len(table.Columns)-1)+")")
+			if err != nil {
+				return stats, err
+			}
+			where := "1"
+			if len(table.Key) > 0 {
+				where = strings.Join(table.Key, " IS ? AND ") + " IS ?"
+			}
+			remove, err = tx.PrepareContext(ctx, "DELETE FROM "+table.Table+" WHERE "+where)
+			if err != nil {
+				return stats, err
+			}
+			if len(table.Key) == 0 {
+				if _, err := remove.ExecContext(ctx); err != nil {
+					return stats, err
+				}
+			}
+		case table.Table == "":
+			return stats, errors.New("corrupt bundle delta: change before any table")
+		case op.Delete != nil:
+			if len(op.Delete) != len(table.Key) {
+				return stats, fmt.Errorf("corrupt bundle delta: bad %s key", table.Table)
+			}
+			res, err := remove.ExecContext(ctx, deltaValues(op.Delete)...)
+			if err != nil {
+				return stats, fmt.Errorf("failed to delete from %s: %w", table.Table, err)
+			}
+			n, _ := res.RowsAffected()
+			stats.Deleted += int(n)
+		case op.Row != nil:
+			if len(op.Row) != len(table.Columns) {
+				return stats, fmt.Errorf("corrupt bundle delta: bad %s row", table.Table)
+			}
+			values := deltaValues(op.Row)
+			if len(table.Key) > 0 {
+				var key []interface{}
+				for _, k := range table.Key {
+					for i, c := range table.Columns {
+						if c == k {
+							key = append(key, values[i])
+						}
+					}
+				}
+				if _, err := remove.ExecContext(ctx, key...); err != nil {
+					return stats, fmt.Errorf("failed to replace in %s: %w", table.Table, err)
+				}
+			}
+			if _, err := insert.ExecContext(ctx, values...); err != nil {
+				return stats, fmt.Errorf("failed to write to %s: %w", table.Table, err)
+			}
+			stats.Written++
+		}
+	}
+
+	// The result must be the bundle the delta was made from
+	var callsigns int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(DISTINCT callsign) FROM callsigns").Scan(&callsigns); err != nil {
+		return stats, err
+	}
+	if callsigns != h.To.Callsigns {
+		return stats, fmt.Errorf("applying the delta left %d callsigns, not %d; the bundle is unchanged", callsigns, h.To.Callsigns)
+	}
+	return stats, tx.Commit()
+}
+
+// deltaValues converts decoded JSON values to SQL arguments. A number with
+// a fraction or exponent was a REAL, anything else an INTEGER.
+func deltaValues(values []interface{}) []interface{} {
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		if n, ok := v.(json.Number); ok {
+			if strings.ContainsAny(n.String(), ".eE") {
+				if f, err := n.Float64(); err == nil {
+					v = f
+				}
+			} else if i, err := n.Int64(); err == nil {
+				v = i
+			}
+		}
+		out[i] = v
+	}
+	return out
+}
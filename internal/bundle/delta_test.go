@@ -0,0 +1,213 @@
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+	_ "github.com/chriskacerguis/hamqrzdb/internal/sqlite"
+)
+
+// exec runs statements against db, failing the test on an error
+func exec(t *testing.T, db *sql.DB, stmts ...string) {
+	t.Helper()
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+}
+
+// build writes a bundle of Texas from src, stamped with builtAt so the
+// bundles of one test run are told apart
+func build(t *testing.T, src *sql.DB, srcPath, outPath, builtAt string) {
+	t.Helper()
+	if _, err := Build(context.Background(), src, srcPath, outPath, Filter{States: []string{"TX"}}); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	exec(t, db, "UPDATE bundle SET built_at = '"+builtAt+"'")
+}
+
+// dump returns every row of every table of the database at path, with the
+// storage class and SQL literal of each value, in a stable order
+func dump(t *testing.T, path string) map[string][]string {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path+"?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	tables := map[string][]string{}
+	for _, k := range deltaKeys {
+		columns, err := tableColumns(ctx, db, "main", k.table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(columns) == 0 {
+			continue
+		}
+		values := make([]string, len(columns))
+		for i, c := range columns {
+			values[i] = "typeof(" + c + ") || ':' || quote(" + c + ")"
+		}
+		rows, err := db.Query("SELECT " + strings.Join(values, " || '|' || ") + " FROM " + k.table + " ORDER BY 1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for rows.Next() {
+			var row string
+			if err := rows.Scan(&row); err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, row)
+		}
+		rows.Close()
+		tables[k.table] = out
+	}
+	return tables
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "src.sqlite")
+	src, err := sql.Open("sqlite3", srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if err := schema.Ensure(ctx, src); err != nil {
+		t.Fatal(err)
+	}
+
+	exec(t, src,
+		`INSERT INTO import_batches (id, data_source, detail, started_at, finished_at, status, records)
+			VALUES (1, 'FCC', 'l_amat.zip', '2026-01-01 04:00:00', '2026-01-01 04:10:00', 'done', 4)`,
+		`INSERT INTO callsigns (callsign, license_status, operator_class, first_name, last_name, state, zip_code,
+			latitude, longitude, grid_square, data_source, import_batch, last_updated) VALUES
+			('W5AAA', 'A', 'E', 'ANN', 'ALPHA', 'TX', '78701', 30.25, -97.75, 'EM10dg', 'FCC', 1, '2026-01-01 04:01:00'),
+			('W5BBB', 'A', 'G', 'BOB', 'BRAVO', 'TX', '75001', 42.0, -97.0, 'EM12', 'FCC', 1, '2026-01-01 04:01:00'),
+			('W5CCC', 'A', 'T', 'CAL', NULL, 'TX', '77001', NULL, NULL, NULL, 'FCC', 1, '2026-01-01 04:01:00'),
+			('W5DDD', 'E', 'T', 'DEE', 'DELTA', 'TX', '79901', 31.75, -106.5, 'DM61', 'FCC', 1, '2026-01-01 04:01:00'),
+			('K1OUT', 'A', 'E', 'OUT', 'SIDER', 'MA', '01001', 42.0, -72.0, 'FN32', 'FCC', 1, '2026-01-01 04:01:00')`,
+		`INSERT INTO repeaters (callsign, trustee, frequency, input_frequency, tone, state, latitude, last_updated) VALUES
+			('W5AAA', 'W5AAA', 146.0, 146.6, '100.0', 'TX', 30.0, '2026-01-01 00:00:00'),
+			('W5AAA', 'W5AAA', 444.925, 449.925, NULL, 'TX', NULL, '2026-01-01 00:00:00'),
+			('W5BBB', 'W5BBB', 147.0, NULL, '88.5', 'TX', 32.5, '2026-01-01 00:00:00')`,
+		`INSERT INTO overrides (callsign, preferred_name, grid_square, last_updated) VALUES
+			('W5AAA', 'Annie', NULL, '2026-01-01 00:00:00'),
+			('W5CCC', 'Cal', 'EM20', '2026-01-01 00:00:00')`,
+		`INSERT INTO clubs (callsign, name, website, last_updated) VALUES
+			('W5DDD', 'Delta ARC', NULL, '2026-01-01 00:00:00')`,
+	)
+	oldPath := filepath.Join(dir, "old.sqlite")
+	build(t, src, srcPath, oldPath, "2026-01-01 05:00:00")
+
+	// A week of changes: a licensee leaves, one moves, one is renewed and
+	// loses a field, one arrives, and the other tables change likewise
+	exec(t, src,
+		`INSERT INTO import_batches (id, data_source, detail, started_at, finished_at, status, records)
+			VALUES (2, 'FCC', 'l_am_daily.zip', '2026-01-08 04:00:00', NULL, 'done', 3)`,
+		`DELETE FROM callsigns WHERE callsign = 'W5DDD'`,
+		`UPDATE callsigns SET latitude = 43.0, longitude = -98.0, zip_code = NULL, import_batch = 2 WHERE callsign = 'W5BBB'`,
+		`UPDATE callsigns SET first_name = NULL, last_name = 'CHARLIE', latitude = 29.0, import_batch = 2 WHERE callsign = 'W5CCC'`,
+		`INSERT INTO callsigns (callsign, license_status, operator_class, first_name, state, zip_code, latitude, longitude, data_source, import_batch)
+			VALUES ('W5EEE', 'A', 'T', 'EVE', 'TX', '78201', 29.5, -98.5, 'FCC', 2),
+			('W5EEE', 'A', NULL, NULL, 'TX', NULL, 7.0, 0.1, 'CSV', NULL)`,
+		`DELETE FROM repeaters WHERE frequency = 444.925`,
+		`UPDATE repeaters SET input_frequency = 147.6, tone = NULL WHERE frequency = 147.0`,
+		`INSERT INTO repeaters (callsign, trustee, frequency, state, latitude, last_updated)
+			VALUES ('W5EEE', 'W5EEE', 224.0, 'TX', 29.5, '2026-01-08 00:00:00')`,
+		`DELETE FROM overrides WHERE callsign = 'W5CCC'`,
+		`UPDATE overrides SET grid_square = 'EM10' WHERE callsign = 'W5AAA'`,
+		`INSERT INTO clubs (callsign, name, website, last_updated) VALUES ('W5EEE', 'Echo ARC', 'https://example.org', '2026-01-08 00:00:00')`,
+	)
+	newPath := filepath.Join(dir, "new.sqlite")
+	build(t, src, srcPath, newPath, "2026-01-08 05:00:00")
+
+	var delta bytes.Buffer
+	stats, err := Diff(ctx, oldPath, newPath, &delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Deleted == 0 || stats.Written == 0 {
+		t.Errorf("Diff stats = %+v, want deletes and writes", stats)
+	}
+
+	// Apply to a copy of the old bundle
+	gotPath := filepath.Join(dir, "got.sqlite")
+	b, err := os.ReadFile(oldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(gotPath, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := sql.Open("sqlite3", gotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+	if _, err := Apply(ctx, got, bytes.NewReader(delta.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	want := dump(t, newPath)
+	have := dump(t, gotPath)
+	for _, k := range deltaKeys {
+		if !reflect.DeepEqual(have[k.table], want[k.table]) {
+			t.Errorf("%s after Apply:\n  %s\nwant:\n  %s", k.table,
+				strings.Join(have[k.table], "\n  "), strings.Join(want[k.table], "\n  "))
+		}
+	}
+
+	// A second Apply is refused, and leaves the bundle alone
+	if _, err := Apply(ctx, got, bytes.NewReader(delta.Bytes())); err == nil || !strings.Contains(err.Error(), "already applied") {
+		t.Errorf("second Apply = %v, want already applied", err)
+	}
+}
+
+func TestDeltaValues(t *testing.T) {
+	// Values as Diff encodes them survive the trip through JSON with their
+	// storage class: a REAL that happens to be whole stays a float
+	row := []interface{}{int64(42), 42.0, 0.1, -97.75, 1e21, "42", nil, int64(-1)}
+	b, err := json.Marshal(deltaOp{Row: encodeValues(append([]interface{}(nil), row...))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var op deltaOp
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&op); err != nil {
+		t.Fatal(err)
+	}
+	got := deltaValues(op.Row)
+	if !reflect.DeepEqual(got, row) {
+		t.Errorf("deltaValues = %s, want %s", types(got), types(row))
+	}
+}
+
+// types describes values with their Go types
+func types(values []interface{}) string {
+	var out []string
+	for _, v := range values {
+		out = append(out, fmt.Sprintf("%T(%v)", v, v))
+	}
+	return strings.Join(out, " ")
+}
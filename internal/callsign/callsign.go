@@ -0,0 +1,135 @@
+// Package callsign validates amateur radio callsigns, splits portable
+// designators ("W1AW/7", "EA8/KJ5DJC/P") into the licensed base call, and
+// spells callsigns in phonetics and Morse code.
+package callsign
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalid is returned for input that isn't a plausible callsign
+var ErrInvalid = errors.New("invalid callsign")
+
+// base matches an ITU-style callsign: a 1-3 character prefix ending in a
+// letter or digit, a digit, then a suffix ending in a letter. It accepts
+// special event calls like GB2RS, VK100WIA, and 1x1 calls like K1A.
+var base = regexp.MustCompile(`^[A-Z0-9]{1,3}[0-9][A-Z0-9]{0,4}[A-Z]$`)
+
+// modifiers are portable/operating suffixes that never form a base call
+var modifiers = map[string]bool{
+	"P": true, "M": true, "MM": true, "AM": true, "QRP": true, "A": true,
+	"B": true, "R": true, "LH": true, "T": true, "J": true, "E": true,
+}
+
+// Callsign is a parsed callsign
+type Callsign struct {
+	// Base is the licensed callsign to look up, e.g. KJ5DJC
+	Base string
+	// Prefix is a portable country/area prefix, e.g. EA8 in EA8/KJ5DJC
+	Prefix string
+	// Suffix is a portable area or operating suffix, e.g. 7 or P
+	Suffix string
+}
+
+// Portable reports whether the callsign had a prefix or suffix designator
+func (c Callsign) Portable() bool {
+	return c.Prefix != "" || c.Suffix != ""
+}
+
+// String returns the callsign as written, e.g. EA8/KJ5DJC/P
+func (c Callsign) String() string {
+	parts := make([]string, 0, 3)
+	if c.Prefix != "" {
+		parts = append(parts, c.Prefix)
+	}
+	parts = append(parts, c.Base)
+	if c.Suffix != "" {
+		parts = append(parts, c.Suffix)
+	}
+	return strings.Join(parts, "/")
+}
+
+// Normalize upper-cases s and removes surrounding and interior whitespace
+func Normalize(s string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(s), ""))
+}
+
+// Valid reports whether s is a syntactically valid base callsign
+func Valid(s string) bool {
+	s = Normalize(s)
+	return base.MatchString(s) && strings.ContainsAny(s, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+}
+
+// Parse normalizes s and splits it into base call and portable designators.
+// With two parts the base is whichever is a valid callsign and not a modifier,
+// preferring the longer one, so W1AW/7 and EA8/KJ5DJC both resolve correctly.
+func Parse(s string) (Callsign, error) {
+	s = Normalize(s)
+	parts := strings.Split(s, "/")
+	for _, p := range parts {
+		if p == "" {
+			return Callsign{}, ErrInvalid
+		}
+	}
+
+	var c Callsign
+	switch len(parts) {
+	case 1:
+		c.Base = parts[0]
+	case 2:
+		first, second := parts[0], parts[1]
+		switch {
+		case isDesignator(second) && Valid(first):
+			c.Base, c.Suffix = first, second
+		case Valid(second) && (!Valid(first) || len(second) > len(first)):
+			c.Prefix, c.Base = first, second
+		default:
+			c.Base, c.Suffix = first, second
+		}
+	case 3:
+		c.Prefix, c.Base, c.Suffix = parts[0], parts[1], parts[2]
+	default:
+		return Callsign{}, ErrInvalid
+	}
+
+	if !Valid(c.Base) {
+		return Callsign{}, ErrInvalid
+	}
+	for _, d := range []string{c.Prefix, c.Suffix} {
+		if len(d) > 5 || strings.Trim(d, "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789") != "" {
+			return Callsign{}, ErrInvalid
+		}
+	}
+	return c, nil
+}
+
+// Base returns the licensed base call for s, or "" if s isn't a valid callsign
+func Base(s string) string {
+	c, err := Parse(s)
+	if err != nil {
+		return ""
+	}
+	return c.Base
+}
+
+// isDesignator reports whether s is a portable suffix: a known modifier or a
+// single call area digit
+func isDesignator(s string) bool {
+	return modifiers[s] || (len(s) == 1 && s[0] >= '0' && s[0] <= '9')
+}
+
+// Prefix returns the prefix s operates under: the portable prefix if it has
+// one (EA8 in EA8/KJ5DJC), or else its base call up to the last digit (KJ5,
+// VK100 in VK100WIA, 3DA0 in 3DA0RS). It is "" if s isn't a valid callsign.
+func Prefix(s string) string {
+	c, err := Parse(s)
+	if err != nil {
+		return ""
+	}
+	if c.Prefix != "" {
+		return c.Prefix
+	}
+	return c.Base[:strings.LastIndexAny(c.Base, "0123456789")+1]
+}
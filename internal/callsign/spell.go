@@ -0,0 +1,54 @@
+package callsign
+
+import "strings"
+
+// phoneticWords are the ITU phonetic alphabet's code words for letters, and
+// the spoken digits and stroke amateurs use with them
+var phoneticWords = map[rune]string{
+	'A': "Alfa", 'B': "Bravo", 'C': "Charlie", 'D': "Delta", 'E': "Echo",
+	'F': "Foxtrot", 'G': "Golf", 'H': "Hotel", 'I': "India", 'J': "Juliett",
+	'K': "Kilo", 'L': "Lima", 'M': "Mike", 'N': "November", 'O': "Oscar",
+	'P': "Papa", 'Q': "Quebec", 'R': "Romeo", 'S': "Sierra", 'T': "Tango",
+	'U': "Uniform", 'V': "Victor", 'W': "Whiskey", 'X': "X-ray", 'Y': "Yankee",
+	'Z': "Zulu",
+	'0': "Zero", '1': "One", '2': "Two", '3': "Three", '4': "Four",
+	'5': "Five", '6': "Six", '7': "Seven", '8': "Eight", '9': "Niner",
+	'/': "Stroke",
+}
+
+// morseCodes are the International Morse Code characters (ITU-R M.1677)
+var morseCodes = map[rune]string{
+	'A': ".-", 'B': "-...", 'C': "-.-.", 'D': "-..", 'E': ".", 'F': "..-.",
+	'G': "--.", 'H': "....", 'I': "..", 'J': ".---", 'K': "-.-", 'L': ".-..",
+	'M': "--", 'N': "-.", 'O': "---", 'P': ".--.", 'Q': "--.-", 'R': ".-.",
+	'S': "...", 'T': "-", 'U': "..-", 'V': "...-", 'W': ".--", 'X': "-..-",
+	'Y': "-.--", 'Z': "--..",
+	'0': "-----", '1': ".----", '2': "..---", '3': "...--", '4': "....-",
+	'5': ".....", '6': "-....", '7': "--...", '8': "---..", '9': "----.",
+	'/': "-..-.",
+}
+
+// spell normalizes s and joins the code of each character it has one for
+func spell(s string, codes map[rune]string) string {
+	parts := []string{}
+	for _, r := range Normalize(s) {
+		if code, ok := codes[r]; ok {
+			parts = append(parts, code)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Phonetic spells s in the ITU phonetic alphabet, e.g. "Kilo Juliett Five
+// Delta Juliett Charlie" for KJ5DJC. Characters other than letters, digits,
+// and / are left out.
+func Phonetic(s string) string {
+	return spell(s, phoneticWords)
+}
+
+// Morse renders s in Morse code as dits and dahs, one space between
+// characters, e.g. "-.- .--- ..... -.. .--- -.-." for KJ5DJC. Characters
+// other than letters, digits, and / are left out.
+func Morse(s string) string {
+	return spell(s, morseCodes)
+}
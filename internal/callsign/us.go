@@ -0,0 +1,156 @@
+package callsign
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrNotUS is returned by ParseUS for input that isn't an assignable US
+// amateur callsign; the wrapped message says why
+var ErrNotUS = errors.New("not a US amateur callsign")
+
+// usFormat splits a US amateur callsign into a one or two letter prefix, the
+// call district digit, and a one to three letter suffix
+var usFormat = regexp.MustCompile(`^([AKNW][A-Z]?)([0-9])([A-Z]{1,3})$`)
+
+// USCall is a structurally valid US amateur callsign under the FCC's
+// sequential call sign system
+type USCall struct {
+	Call string
+	// Format is the prefix and suffix lengths, e.g. 1x2 for W1AW
+	Format string
+	// Group is the operator class group the format is issued to: A (Amateur
+	// Extra), B (Advanced), C (General and Technician Plus), D (Technician
+	// and Novice), or GroupSpecialEvent
+	Group string
+	// Region is the FCC call sign region, 1-10 for the call districts of
+	// the contiguous states (10 is the 0 district), 11 for Alaska, 12 for
+	// the Caribbean, and 13 for the Pacific
+	Region     int
+	RegionName string
+}
+
+// GroupSpecialEvent is the group of 1x1 calls (K, N, or W, a digit, and
+// one letter), which aren't in the sequential system: volunteer
+// coordinators lend them to licensees of any class for special events
+const GroupSpecialEvent = "S"
+
+// usRegionNames names the FCC call sign regions
+var usRegionNames = map[int]string{
+	1:  "CT, MA, ME, NH, RI, VT",
+	2:  "NJ, NY",
+	3:  "DC, DE, MD, PA",
+	4:  "AL, FL, GA, KY, NC, SC, TN, VA",
+	5:  "AR, LA, MS, NM, OK, TX",
+	6:  "CA",
+	7:  "AZ, ID, MT, NV, OR, UT, WA, WY",
+	8:  "MI, OH, WV",
+	9:  "IL, IN, WI",
+	10: "CO, IA, KS, MN, MO, ND, NE, SD",
+	11: "Alaska",
+	12: "Caribbean",
+	13: "Pacific",
+}
+
+// usRegionPrefixes are the two letter prefixes reserved for regions 11-13,
+// whatever the digit
+var usRegionPrefixes = map[string]int{
+	"AL": 11, "KL": 11, "NL": 11, "WL": 11,
+	"KP": 12, "NP": 12, "WP": 12,
+	"AH": 13, "KH": 13, "NH": 13, "WH": 13,
+}
+
+// usUnassigned are the blocks the FCC excludes from the sequential system,
+// as inclusive ranges of callsigns of the same format
+var usUnassigned = [][2]string{
+	{"KA2AA", "KA9ZZ"}, {"KC4AAA", "KC4AAF"}, {"KC4USA", "KC4USZ"},
+	{"KG4AA", "KG4ZZ"}, {"KC6AA", "KC6ZZ"}, {"KL9KAA", "KL9KHZ"},
+	{"KX6AA", "KX6ZZ"},
+}
+
+// ParseUS checks that s is a US amateur callsign the FCC's sequential system
+// can issue, and returns its format, operator class group, and region.
+// Vanity calls follow the same formats, so it applies to them too, and 1x1
+// special event calls are accepted in GroupSpecialEvent.
+func ParseUS(s string) (USCall, error) {
+	call := Normalize(s)
+	m := usFormat.FindStringSubmatch(call)
+	if m == nil {
+		return USCall{}, fmt.Errorf("%w: expected a K, N, W, or AA-AL prefix, one digit, and a 1-3 letter suffix", ErrNotUS)
+	}
+	prefix, digit, suffix := m[1], m[2], m[3]
+	c := USCall{Call: call, Format: fmt.Sprintf("%dx%d", len(prefix), len(suffix))}
+
+	if prefix[0] == 'A' && (len(prefix) == 1 || prefix[1] > 'L') {
+		return USCall{}, fmt.Errorf("%w: A prefixes other than AA-AL belong to other countries", ErrNotUS)
+	}
+	if c.Region = usRegionPrefixes[prefix]; c.Region == 0 {
+		c.Region = int(digit[0] - '0')
+		if c.Region == 0 {
+			c.Region = 10
+		}
+	}
+	c.RegionName = usRegionNames[c.Region]
+
+	switch {
+	case suffix == "SOS" || (len(suffix) == 3 && suffix[0] == 'Q' && suffix[1] >= 'R' && suffix[1] <= 'U'):
+		return USCall{}, fmt.Errorf("%w: SOS and QRA-QUZ suffixes are not issued", ErrNotUS)
+	case suffix[0] == 'X':
+		return USCall{}, fmt.Errorf("%w: suffixes starting with X are not issued", ErrNotUS)
+	case len(prefix) == 2 && prefix[1] == 'F' && strings.HasPrefix(suffix, "EM") && len(suffix) == 3:
+		return USCall{}, fmt.Errorf("%w: %cF prefixes with EMA-EMZ suffixes are reserved", ErrNotUS, prefix[0])
+	}
+	for _, block := range usUnassigned {
+		if len(call) == len(block[0]) && call >= block[0] && call <= block[1] {
+			return USCall{}, fmt.Errorf("%w: %s-%s is not issued", ErrNotUS, block[0], block[1])
+		}
+	}
+
+	c.Group = usGroup(prefix, len(suffix), c.Region)
+	if c.Group == "" {
+		return USCall{}, fmt.Errorf("%w: the %s format is not issued with a %s prefix", ErrNotUS, c.Format, prefix)
+	}
+	return c, nil
+}
+
+// usGroup returns the operator class group a format is issued to in a
+// region, or "" if it isn't issued there
+func usGroup(prefix string, suffixLen, region int) string {
+	first := prefix[0]
+	switch {
+	case len(prefix) == 1:
+		// 1x2 and 1x3 only exist in the contiguous states
+		switch suffixLen {
+		case 1:
+			return GroupSpecialEvent
+		case 2:
+			return "A"
+		case 3:
+			return "C"
+		}
+	case suffixLen == 1:
+		return "A"
+	case suffixLen == 2:
+		// AA-AL 2x2 is Amateur Extra, the rest Advanced
+		if first == 'A' {
+			return "A"
+		}
+		return "B"
+	case suffixLen == 3:
+		if region > 10 {
+			switch first {
+			case 'K':
+				return "D"
+			case 'N', 'W':
+				return "C"
+			}
+			return ""
+		}
+		if first == 'K' || first == 'W' {
+			return "D"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,311 @@
+// Package dnstxt answers DNS TXT queries for callsigns under a zone, so
+// ultra-light clients can look a callsign up with nothing but a resolver:
+// `dig +short TXT w1aw.call.example.com` returns the record as RFC 1464
+// "key=value" strings. It implements just enough of RFC 1035 for that, over
+// UDP and TCP.
+package dnstxt
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record types and the IN class
+const (
+	typeSOA = 6
+	typeTXT = 16
+	typeANY = 255
+	classIN = 1
+)
+
+// Response codes
+const (
+	rcodeOK       = 0
+	rcodeFormErr  = 1
+	rcodeNXDomain = 3
+	rcodeNotImp   = 4
+	rcodeRefused  = 5
+)
+
+// maxUDP is the largest UDP response without EDNS; longer answers are
+// truncated so the client retries over TCP
+const maxUDP = 512
+
+// Server answers TXT queries for <callsign>.<Zone>
+type Server struct {
+	// Zone is the domain callsigns are looked up under, e.g. call.example.com
+	Zone string
+	// TTL is how long resolvers may cache answers
+	TTL time.Duration
+	// Lookup returns the TXT strings for a callsign (the lower-cased label
+	// of the query), or false if there is no such callsign
+	Lookup func(ctx context.Context, call string) ([]string, bool)
+	// Allow, if set, reports whether a query from the client at ip may be
+	// answered; queries it rejects are refused
+	Allow func(ip string) bool
+}
+
+// maxInFlight bounds the UDP queries answered at once
+const maxInFlight = 64
+
+// ServeUDP answers queries on pc until ctx is done
+func (s *Server) ServeUDP(ctx context.Context, pc net.PacketConn) error {
+	context.AfterFunc(ctx, func() { pc.Close() })
+	sem := make(chan struct{}, maxInFlight)
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		query := append([]byte(nil), buf[:n]...)
+		select {
+		case sem <- struct{}{}:
+		default:
+			// Overloaded; the client will retry
+			continue
+		}
+		go func() {
+			defer func() { <-sem }()
+			if resp := s.answer(ctx, hostOf(addr), query, maxUDP); resp != nil {
+				pc.WriteTo(resp, addr)
+			}
+		}()
+	}
+}
+
+// ServeTCP answers queries on l until ctx is done
+func (s *Server) ServeTCP(ctx context.Context, l net.Listener) error {
+	context.AfterFunc(ctx, func() { l.Close() })
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, conn)
+		}()
+	}
+}
+
+// tcpIdle is how long a TCP client may wait between queries
+const tcpIdle = 30 * time.Second
+
+// serveConn answers length-prefixed queries on one TCP connection
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	ip := hostOf(conn.RemoteAddr())
+	for {
+		conn.SetDeadline(time.Now().Add(tcpIdle))
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		resp := s.answer(ctx, ip, query, 65535)
+		if resp == nil {
+			return
+		}
+		out := binary.BigEndian.AppendUint16(nil, uint16(len(resp)))
+		if _, err := conn.Write(append(out, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// question is a parsed query's question
+type question struct {
+	name  string
+	qtype uint16
+	// raw is the question section as sent, echoed in the response
+	raw []byte
+}
+
+// errFormat is a query that can't be parsed
+var errFormat = errors.New("malformed query")
+
+// parseQuestion reads the single question of a query
+func parseQuestion(msg []byte) (question, error) {
+	var q question
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg[4:6]) != 1 {
+		return q, errFormat
+	}
+	var labels []string
+	i := 12
+	for {
+		if i >= len(msg) {
+			return q, errFormat
+		}
+		n := int(msg[i])
+		i++
+		if n == 0 {
+			break
+		}
+		// Questions are never compressed
+		if n > 63 || i+n > len(msg) {
+			return q, errFormat
+		}
+		labels = append(labels, strings.ToLower(string(msg[i:i+n])))
+		i += n
+	}
+	if i+4 > len(msg) {
+		return q, errFormat
+	}
+	q.name = strings.Join(labels, ".")
+	q.qtype = binary.BigEndian.Uint16(msg[i : i+2])
+	if binary.BigEndian.Uint16(msg[i+2:i+4]) != classIN {
+		return q, errFormat
+	}
+	q.raw = msg[12 : i+4]
+	return q, nil
+}
+
+// hostOf returns the IP address of a client's address
+func hostOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// answer returns the response to a query from the client at ip, at most
+// size bytes, or nil if the message isn't a query at all
+func (s *Server) answer(ctx context.Context, ip string, msg []byte, size int) []byte {
+	if len(msg) < 12 || msg[2]&0x80 != 0 {
+		return nil
+	}
+	id, opcode, rd := msg[0:2], (msg[2]>>3)&0x0f, msg[2]&0x01
+	reply := func(rcode byte, q *question, answers, authority [][]byte) []byte {
+		out := append([]byte(nil), id...)
+		// QR and AA, the query's opcode and RD
+		out = append(out, 0x84|opcode<<3|rd, rcode)
+		qd := 0
+		if q != nil {
+			qd = 1
+		}
+		out = binary.BigEndian.AppendUint16(out, uint16(qd))
+		out = binary.BigEndian.AppendUint16(out, uint16(len(answers)))
+		out = binary.BigEndian.AppendUint16(out, uint16(len(authority)))
+		out = binary.BigEndian.AppendUint16(out, 0)
+		if q != nil {
+			out = append(out, q.raw...)
+		}
+		for _, rr := range append(answers, authority...) {
+			out = append(out, rr...)
+		}
+		if len(out) > size && q != nil {
+			// Truncated: the header and question, with TC set
+			out = append(out[:12:12], q.raw...)
+			out[2] |= 0x02
+			binary.BigEndian.PutUint16(out[6:8], 0)
+			binary.BigEndian.PutUint16(out[8:10], 0)
+		}
+		return out
+	}
+
+	if opcode != 0 {
+		return reply(rcodeNotImp, nil, nil, nil)
+	}
+	q, err := parseQuestion(msg)
+	if err != nil {
+		return reply(rcodeFormErr, nil, nil, nil)
+	}
+	if s.Allow != nil && !s.Allow(ip) {
+		return reply(rcodeRefused, &q, nil, nil)
+	}
+
+	zone := strings.ToLower(strings.Trim(s.Zone, "."))
+	label, inZone := strings.CutSuffix(q.name, "."+zone)
+	switch {
+	case q.name == zone && (q.qtype == typeSOA || q.qtype == typeANY):
+		return reply(rcodeOK, &q, [][]byte{s.soa(zone)}, nil)
+	case q.name == zone:
+		return reply(rcodeOK, &q, nil, [][]byte{s.soa(zone)})
+	case !inZone:
+		return reply(rcodeRefused, &q, nil, nil)
+	case strings.Contains(label, "."):
+		return reply(rcodeNXDomain, &q, nil, [][]byte{s.soa(zone)})
+	}
+
+	txt, ok := s.Lookup(ctx, label)
+	if !ok {
+		return reply(rcodeNXDomain, &q, nil, [][]byte{s.soa(zone)})
+	}
+	if q.qtype != typeTXT && q.qtype != typeANY {
+		return reply(rcodeOK, &q, nil, [][]byte{s.soa(zone)})
+	}
+	var rdata []byte
+	for _, t := range txt {
+		if len(t) > 255 {
+			t = t[:255]
+		}
+		rdata = append(rdata, byte(len(t)))
+		rdata = append(rdata, t...)
+	}
+	if len(rdata) > 65000 {
+		log.Printf("DNS answer for %s is too long", label)
+		return reply(rcodeOK, &q, nil, nil)
+	}
+	// The answer's name points at the question's (offset 12)
+	return reply(rcodeOK, &q, [][]byte{s.rr([]byte{0xc0, 12}, typeTXT, rdata)}, nil)
+}
+
+// rr encodes a resource record
+func (s *Server) rr(name []byte, rtype uint16, rdata []byte) []byte {
+	out := append([]byte(nil), name...)
+	out = binary.BigEndian.AppendUint16(out, rtype)
+	out = binary.BigEndian.AppendUint16(out, classIN)
+	out = binary.BigEndian.AppendUint32(out, uint32(s.TTL/time.Second))
+	out = binary.BigEndian.AppendUint16(out, uint16(len(rdata)))
+	return append(out, rdata...)
+}
+
+// soa returns the zone's SOA record, sent with negative answers so
+// resolvers know how long to cache them
+func (s *Server) soa(zone string) []byte {
+	ttl := uint32(s.TTL / time.Second)
+	var rdata []byte
+	rdata = append(rdata, encodeName(zone)...)
+	rdata = append(rdata, encodeName("hostmaster."+zone)...)
+	// Serial, refresh, retry, expire, and the negative caching TTL
+	for _, v := range []uint32{1, ttl, ttl, 7 * 24 * 3600, ttl} {
+		rdata = binary.BigEndian.AppendUint32(rdata, v)
+	}
+	return s.rr(encodeName(zone), typeSOA, rdata)
+}
+
+// encodeName encodes a domain name as labels
+func encodeName(name string) []byte {
+	var out []byte
+	for _, label := range strings.Split(strings.Trim(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		out = append(out, byte(len(label)))
+		out = append(out, label...)
+	}
+	return append(out, 0)
+}
@@ -0,0 +1,251 @@
+package dnstxt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+// query builds a query message: header fields, then the raw question
+func query(id uint16, flags byte, qdcount uint16, question []byte) []byte {
+	msg := binary.BigEndian.AppendUint16(nil, id)
+	msg = append(msg, flags, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qdcount)
+	msg = append(msg, 0, 0, 0, 0, 0, 0)
+	return append(msg, question...)
+}
+
+// questionFor encodes a question for name, qtype, and class
+func questionFor(name string, qtype, class uint16) []byte {
+	q := encodeName(name)
+	q = binary.BigEndian.AppendUint16(q, qtype)
+	return binary.BigEndian.AppendUint16(q, class)
+}
+
+func TestParseQuestion(t *testing.T) {
+	long := strings.Repeat("a", 64)
+	tests := []struct {
+		name  string
+		msg   []byte
+		want  string
+		qtype uint16
+		err   bool
+	}{
+		{name: "txt", msg: query(1, 0, 1, questionFor("W1AW.call.example.com", typeTXT, classIN)), want: "w1aw.call.example.com", qtype: typeTXT},
+		{name: "root", msg: query(1, 0, 1, questionFor("", typeSOA, classIN)), want: "", qtype: typeSOA},
+		{name: "63 byte label", msg: query(1, 0, 1, questionFor(long[:63]+".example.com", typeTXT, classIN)), want: long[:63] + ".example.com", qtype: typeTXT},
+		{name: "empty", msg: nil, err: true},
+		{name: "truncated header", msg: query(1, 0, 1, nil)[:11], err: true},
+		{name: "header only", msg: query(1, 0, 1, nil), err: true},
+		{name: "no questions", msg: query(1, 0, 0, questionFor("w1aw.example.com", typeTXT, classIN)), err: true},
+		{name: "two questions", msg: query(1, 0, 2, append(questionFor("w1aw.example.com", typeTXT, classIN), questionFor("k1abc.example.com", typeTXT, classIN)...)), err: true},
+		{name: "64 byte label", msg: query(1, 0, 1, questionFor(long+".example.com", typeTXT, classIN)), err: true},
+		{name: "compression pointer", msg: query(1, 0, 1, []byte{4, 'w', '1', 'a', 'w', 0xc0, 12, 0, typeTXT, 0, classIN}), err: true},
+		{name: "label past end", msg: query(1, 0, 1, []byte{10, 'w', '1', 'a', 'w'}), err: true},
+		{name: "unterminated name", msg: query(1, 0, 1, []byte{4, 'w', '1', 'a', 'w'}), err: true},
+		{name: "truncated type", msg: query(1, 0, 1, []byte{4, 'w', '1', 'a', 'w', 0, 0, typeTXT, 0}), err: true},
+		{name: "chaos class", msg: query(1, 0, 1, questionFor("w1aw.example.com", typeTXT, 3)), err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseQuestion(tt.msg)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parseQuestion = %q, want an error", q.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.name != tt.want || q.qtype != tt.qtype {
+				t.Errorf("parseQuestion = %q type %d, want %q type %d", q.name, q.qtype, tt.want, tt.qtype)
+			}
+			if !bytes.Equal(q.raw, tt.msg[12:]) {
+				t.Errorf("raw = %x, want %x", q.raw, tt.msg[12:])
+			}
+		})
+	}
+}
+
+// header is a response's header fields
+type header struct {
+	id             uint16
+	flags, rcode   byte
+	qd, an, ns, ar uint16
+}
+
+func parseHeader(t *testing.T, resp []byte) header {
+	t.Helper()
+	if len(resp) < 12 {
+		t.Fatalf("response is %d bytes", len(resp))
+	}
+	return header{
+		id:    binary.BigEndian.Uint16(resp[0:2]),
+		flags: resp[2],
+		rcode: resp[3] & 0x0f,
+		qd:    binary.BigEndian.Uint16(resp[4:6]),
+		an:    binary.BigEndian.Uint16(resp[6:8]),
+		ns:    binary.BigEndian.Uint16(resp[8:10]),
+		ar:    binary.BigEndian.Uint16(resp[10:12]),
+	}
+}
+
+func TestAnswer(t *testing.T) {
+	s := &Server{
+		Zone: "call.example.com.",
+		TTL:  time.Hour,
+		Lookup: func(_ context.Context, call string) ([]string, bool) {
+			switch call {
+			case "w1aw":
+				return []string{"call=W1AW", "name=ARRL HQ"}, true
+			case "long":
+				// Too long for a UDP answer without EDNS
+				return []string{strings.Repeat("x", 255), strings.Repeat("y", 255)}, true
+			}
+			return nil, false
+		},
+	}
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		msg    []byte
+		size   int
+		rcode  byte
+		qd, an uint16
+		ns     uint16
+		tc     bool
+	}{
+		{name: "txt", msg: query(7, 0x01, 1, questionFor("W1AW.call.example.com", typeTXT, classIN)), size: maxUDP, rcode: rcodeOK, qd: 1, an: 1},
+		{name: "any", msg: query(7, 0x01, 1, questionFor("w1aw.call.example.com", typeANY, classIN)), size: maxUDP, rcode: rcodeOK, qd: 1, an: 1},
+		{name: "other type", msg: query(7, 0x01, 1, questionFor("w1aw.call.example.com", 1, classIN)), size: maxUDP, rcode: rcodeOK, qd: 1, ns: 1},
+		{name: "unknown callsign", msg: query(7, 0x01, 1, questionFor("k9zzz.call.example.com", typeTXT, classIN)), size: maxUDP, rcode: rcodeNXDomain, qd: 1, ns: 1},
+		{name: "subdomain", msg: query(7, 0x01, 1, questionFor("a.w1aw.call.example.com", typeTXT, classIN)), size: maxUDP, rcode: rcodeNXDomain, qd: 1, ns: 1},
+		{name: "zone soa", msg: query(7, 0x01, 1, questionFor("call.example.com", typeSOA, classIN)), size: maxUDP, rcode: rcodeOK, qd: 1, an: 1},
+		{name: "other zone", msg: query(7, 0x01, 1, questionFor("w1aw.example.org", typeTXT, classIN)), size: maxUDP, rcode: rcodeRefused, qd: 1},
+		{name: "not a query opcode", msg: query(7, 0x01|2<<3, 1, questionFor("w1aw.call.example.com", typeTXT, classIN)), size: maxUDP, rcode: rcodeNotImp},
+		{name: "two questions", msg: query(7, 0x01, 2, append(questionFor("w1aw.call.example.com", typeTXT, classIN), questionFor("w1aw.call.example.com", typeTXT, classIN)...)), size: maxUDP, rcode: rcodeFormErr},
+		{name: "no questions", msg: query(7, 0x01, 0, nil), size: maxUDP, rcode: rcodeFormErr},
+		{name: "compression pointer", msg: query(7, 0x01, 1, []byte{0xc0, 12, 0, typeTXT, 0, classIN}), size: maxUDP, rcode: rcodeFormErr},
+		{name: "64 byte label", msg: query(7, 0x01, 1, questionFor(strings.Repeat("a", 64)+".call.example.com", typeTXT, classIN)), size: maxUDP, rcode: rcodeFormErr},
+		{name: "truncated over udp", msg: query(7, 0x01, 1, questionFor("long.call.example.com", typeTXT, classIN)), size: maxUDP, rcode: rcodeOK, qd: 1, tc: true},
+		{name: "whole over tcp", msg: query(7, 0x01, 1, questionFor("long.call.example.com", typeTXT, classIN)), size: 65535, rcode: rcodeOK, qd: 1, an: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := s.answer(ctx, "192.0.2.1", tt.msg, tt.size)
+			if len(resp) > tt.size {
+				t.Errorf("response is %d bytes, over %d", len(resp), tt.size)
+			}
+			h := parseHeader(t, resp)
+			if h.id != 7 {
+				t.Errorf("id = %d, want 7", h.id)
+			}
+			if h.flags&0x80 == 0 {
+				t.Error("QR not set")
+			}
+			if h.flags&0x01 == 0 {
+				t.Error("RD not echoed")
+			}
+			if tc := h.flags&0x02 != 0; tc != tt.tc {
+				t.Errorf("TC = %v, want %v", tc, tt.tc)
+			}
+			if h.rcode != tt.rcode || h.qd != tt.qd || h.an != tt.an || h.ns != tt.ns || h.ar != 0 {
+				t.Errorf("rcode %d qd %d an %d ns %d ar %d, want rcode %d qd %d an %d ns %d ar 0",
+					h.rcode, h.qd, h.an, h.ns, h.ar, tt.rcode, tt.qd, tt.an, tt.ns)
+			}
+			if h.qd == 1 && !bytes.Equal(resp[12:12+len(tt.msg)-12], tt.msg[12:]) {
+				t.Error("question not echoed")
+			}
+			if tt.tc && len(resp) != len(tt.msg) {
+				t.Errorf("truncated response is %d bytes, want the %d byte header and question", len(resp), len(tt.msg))
+			}
+		})
+	}
+}
+
+func TestAnswerIgnores(t *testing.T) {
+	s := &Server{Zone: "call.example.com", Lookup: func(context.Context, string) ([]string, bool) { return nil, false }}
+	tests := []struct {
+		name string
+		msg  []byte
+	}{
+		{name: "empty", msg: nil},
+		{name: "truncated header", msg: query(7, 0, 1, nil)[:11]},
+		{name: "response", msg: query(7, 0x80, 1, questionFor("w1aw.call.example.com", typeTXT, classIN))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := s.answer(context.Background(), "192.0.2.1", tt.msg, maxUDP); resp != nil {
+				t.Errorf("answer = %x, want nil", resp)
+			}
+		})
+	}
+}
+
+func TestAnswerTXT(t *testing.T) {
+	s := &Server{
+		Zone: "call.example.com",
+		TTL:  time.Hour,
+		Lookup: func(context.Context, string) ([]string, bool) {
+			return []string{"call=W1AW", strings.Repeat("z", 300)}, true
+		},
+	}
+	msg := query(7, 0, 1, questionFor("w1aw.call.example.com", typeTXT, classIN))
+	resp := s.answer(context.Background(), "192.0.2.1", msg, 65535)
+
+	rr := resp[len(msg):]
+	// Name pointer, type, class, TTL, rdlength
+	if !bytes.Equal(rr[:2], []byte{0xc0, 12}) {
+		t.Fatalf("answer name = %x, want a pointer to the question", rr[:2])
+	}
+	if typ := binary.BigEndian.Uint16(rr[2:4]); typ != typeTXT {
+		t.Errorf("type = %d, want TXT", typ)
+	}
+	if ttl := binary.BigEndian.Uint32(rr[6:10]); ttl != 3600 {
+		t.Errorf("ttl = %d, want 3600", ttl)
+	}
+	rdata := rr[12:]
+	if n := int(binary.BigEndian.Uint16(rr[10:12])); n != len(rdata) {
+		t.Fatalf("rdlength = %d, rdata is %d bytes", n, len(rdata))
+	}
+	var strs []string
+	for len(rdata) > 0 {
+		n := int(rdata[0])
+		strs = append(strs, string(rdata[1:1+n]))
+		rdata = rdata[1+n:]
+	}
+	// Strings over 255 bytes are cut to fit one character-string
+	if len(strs) != 2 || strs[0] != "call=W1AW" || strs[1] != strings.Repeat("z", 255) {
+		t.Errorf("TXT strings = %q", strs)
+	}
+}
+
+func TestAnswerRefusesOverLimit(t *testing.T) {
+	lookups := 0
+	s := &Server{
+		Zone: "call.example.com",
+		Lookup: func(context.Context, string) ([]string, bool) {
+			lookups++
+			return []string{"call=W1AW"}, true
+		},
+		Allow: func(ip string) bool { return ip != "192.0.2.9" },
+	}
+	msg := query(7, 0, 1, questionFor("w1aw.call.example.com", typeTXT, classIN))
+	if resp := s.answer(context.Background(), "192.0.2.1", msg, maxUDP); resp[3] != rcodeOK {
+		t.Fatalf("allowed client: rcode %d, want %d", resp[3], rcodeOK)
+	}
+	resp := s.answer(context.Background(), "192.0.2.9", msg, maxUDP)
+	if resp[3] != rcodeRefused {
+		t.Errorf("limited client: rcode %d, want %d", resp[3], rcodeRefused)
+	}
+	if !bytes.Equal(resp[:2], msg[:2]) || !bytes.Equal(resp[12:], msg[12:]) {
+		t.Errorf("refusal %x doesn't echo the query's ID and question", resp)
+	}
+	if lookups != 1 {
+		t.Errorf("%d lookups, want only the allowed client's", lookups)
+	}
+}
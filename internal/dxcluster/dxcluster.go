@@ -0,0 +1,340 @@
+// Package dxcluster relays a DX cluster's telnet feed to local clients,
+// adding licence details from the database to each spot on the way, so
+// loggers on a Field Day network see who and where a spotted station is
+// without internet lookups.
+package dxcluster
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spot is one "DX de" line of a cluster feed
+type Spot struct {
+	Spotter string `json:"spotter"`
+	// Frequency is in kHz, as the cluster sent it
+	Frequency string `json:"frequency"`
+	DX        string `json:"dx"`
+	Comment   string `json:"comment,omitempty"`
+	// Time is the cluster's HHMMZ timestamp
+	Time string `json:"time"`
+	// SpotterGrid is the spotter's locator, which some clusters append
+	SpotterGrid string `json:"spotter_grid,omitempty"`
+	Station
+}
+
+// Station is what the database knows about a spotted callsign
+type Station struct {
+	Name    string `json:"name,omitempty"`
+	State   string `json:"state,omitempty"`
+	Grid    string `json:"grid,omitempty"`
+	Country string `json:"country,omitempty"`
+}
+
+// Label returns the station as "Name, ST, GRID", or its country when the
+// database has no record of it
+func (s Station) Label() string {
+	var parts []string
+	for _, p := range []string{s.Name, s.State, s.Grid} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 && s.Country != "" {
+		parts = append(parts, s.Country)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// spotPattern matches "DX de W3LPL:     14025.0  JA1ABC   CW 599   1234Z FM19"
+var spotPattern = regexp.MustCompile(`(?i)^DX de ([A-Z0-9/#-]+):?\s+(\d+(?:\.\d+)?)\s+(\S+)\s*(.*?)\s*(\d{4}Z)(?:\s+([A-R]{2}\d{2}(?:[A-X]{2})?))?\s*$`)
+
+// ParseSpot parses a cluster's spot line
+func ParseSpot(line string) (Spot, bool) {
+	m := spotPattern.FindStringSubmatch(strings.TrimRight(line, "\r\n\a "))
+	if m == nil {
+		return Spot{}, false
+	}
+	return Spot{
+		Spotter:     strings.ToUpper(m[1]),
+		Frequency:   m[2],
+		DX:          strings.ToUpper(m[3]),
+		Comment:     m[4],
+		Time:        strings.ToUpper(m[5]),
+		SpotterGrid: m[6],
+	}, true
+}
+
+// String formats the spot in the column layout clusters use
+func (s Spot) String() string {
+	line := fmt.Sprintf("DX de %-9s %8s  %-12s %-30.30s %s", s.Spotter+":", s.Frequency, s.DX, s.Comment, s.Time)
+	if s.SpotterGrid != "" {
+		line += " " + s.SpotterGrid
+	}
+	return line
+}
+
+// Relay connects to a cluster as Login and serves its feed, enriched by
+// Enrich, to local clients. Telnet clients get every line of the feed with
+// each spot's station label appended; JSON clients get one Spot object per
+// line and nothing else.
+type Relay struct {
+	// Cluster is the upstream cluster's host:port
+	Cluster string
+	Login   string
+	Enrich  func(call string) Station
+	JSON    bool
+
+	mu       sync.Mutex
+	clients  map[chan string]bool
+	upstream net.Conn
+}
+
+// clientBuffer is how many lines a slow client can fall behind before lines
+// are dropped for it, so one stalled logger doesn't hold up the feed
+const clientBuffer = 256
+
+// Run keeps a connection to the cluster until ctx is done, reconnecting
+// with backoff when it drops
+func (r *Relay) Run(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		started := time.Now()
+		err := r.relay(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		// A connection that lasted a while resets the backoff
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		log.Printf("DX cluster %s disconnected (%v); reconnecting in %s", r.Cluster, err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 2*time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+// relay reads the cluster's feed until the connection drops
+func (r *Relay) relay(ctx context.Context) error {
+	conn, err := (&net.Dialer{Timeout: 30 * time.Second}).DialContext(ctx, "tcp", r.Cluster)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	log.Printf("Connected to DX cluster %s as %s", r.Cluster, r.Login)
+
+	r.mu.Lock()
+	r.upstream = conn
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.upstream = nil
+		r.mu.Unlock()
+	}()
+
+	// Clusters prompt for a callsign without ending the line, so the
+	// login is sent on the prompt, or after a few seconds without one
+	var loginOnce sync.Once
+	login := func() {
+		loginOnce.Do(func() { fmt.Fprintf(conn, "%s\r\n", r.Login) })
+	}
+	timer := time.AfterFunc(5*time.Second, login)
+	defer timer.Stop()
+
+	br := bufio.NewReader(conn)
+	var pending strings.Builder
+	prompted := false
+	buf := make([]byte, 4096)
+	for {
+		n, err := br.Read(buf)
+		for _, b := range buf[:n] {
+			if b == '\n' {
+				r.broadcastLine(pending.String())
+				pending.Reset()
+				continue
+			}
+			pending.WriteByte(b)
+		}
+		if p := strings.ToLower(strings.TrimSpace(pending.String())); !prompted && strings.HasSuffix(p, ":") &&
+			(strings.Contains(p, "login") || strings.Contains(p, "call")) {
+			prompted = true
+			login()
+			pending.Reset()
+		}
+		if err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("connection closed")
+			}
+			return err
+		}
+	}
+}
+
+// broadcastLine enriches a line of the feed and sends it to every client
+func (r *Relay) broadcastLine(line string) {
+	line = strings.TrimRight(line, "\r\a ")
+	spot, ok := ParseSpot(line)
+	if ok && r.Enrich != nil {
+		spot.Station = r.Enrich(spot.DX)
+	}
+
+	var out string
+	switch {
+	case r.JSON && !ok:
+		return
+	case r.JSON:
+		b, err := json.Marshal(spot)
+		if err != nil {
+			return
+		}
+		out = string(b)
+	case ok && spot.Label() != "":
+		out = line + " [" + spot.Label() + "]"
+	default:
+		out = line
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for c := range r.clients {
+		select {
+		case c <- out:
+		default:
+		}
+	}
+}
+
+// Serve accepts local clients on ln until ctx is done
+func (r *Relay) Serve(ctx context.Context, ln net.Listener) error {
+	context.AfterFunc(ctx, func() { ln.Close() })
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go r.serveClient(ctx, conn)
+	}
+}
+
+// serveClient streams the feed to one client. Telnet clients are asked for
+// a callsign like at a real cluster, and may send spots with DX commands;
+// other commands are ignored.
+func (r *Relay) serveClient(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	br := bufio.NewReader(conn)
+	call := ""
+	if !r.JSON {
+		fmt.Fprint(conn, "login: ")
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return
+		}
+		call = strings.ToUpper(strings.TrimSpace(line))
+		if call == "" {
+			call = "LOCAL"
+		}
+		fmt.Fprintf(conn, "Hello %s, this is a hamqrzdb relay of %s\r\n", call, r.Cluster)
+	}
+
+	lines := make(chan string, clientBuffer)
+	r.mu.Lock()
+	if r.clients == nil {
+		r.clients = map[chan string]bool{}
+	}
+	r.clients[lines] = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.clients, lines)
+		r.mu.Unlock()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.TrimSpace(line)
+			switch lower := strings.ToLower(cmd); {
+			case lower == "bye" || lower == "quit" || lower == "exit":
+				return
+			case call != "" && strings.HasPrefix(lower, "dx "):
+				r.localSpot(call, cmd)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		case line := <-lines:
+			conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+			if _, err := io.WriteString(conn, line+"\r\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// localSpot handles a client's "DX 14025.0 K1ABC comment" (or "DX K1ABC
+// 14025.0 comment") command. It is passed to the cluster, which echoes the
+// spot back, or while the cluster is unreachable it is sent straight to the
+// local clients, so spotting keeps working on an offline network.
+func (r *Relay) localSpot(spotter, cmd string) {
+	fields := strings.Fields(cmd)
+	if len(fields) < 3 {
+		return
+	}
+	freq, dx := fields[1], fields[2]
+	if _, err := strconv.ParseFloat(freq, 64); err != nil {
+		freq, dx = dx, freq
+		if _, err := strconv.ParseFloat(freq, 64); err != nil {
+			return
+		}
+	}
+
+	r.mu.Lock()
+	upstream := r.upstream
+	r.mu.Unlock()
+	if upstream != nil {
+		if _, err := fmt.Fprintf(upstream, "%s\r\n", cmd); err == nil {
+			return
+		}
+	}
+
+	r.broadcastLine(Spot{
+		Spotter:   spotter,
+		Frequency: freq,
+		DX:        strings.ToUpper(dx),
+		Comment:   strings.Join(fields[3:], " "),
+		Time:      time.Now().UTC().Format("1504") + "Z",
+	}.String())
+}
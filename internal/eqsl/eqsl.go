@@ -0,0 +1,88 @@
+// Package eqsl loads the eQSL.cc Authenticity Guaranteed (AG) member list,
+// used to tell logging software which callsigns can confirm eQSLs for awards.
+package eqsl
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/callsign"
+)
+
+// DefaultURL is the AG member list published by eQSL.cc: a title line, then
+// one callsign per line
+const DefaultURL = "https://www.eqsl.cc/qslcard/DownloadedFiles/AGMemberList.txt"
+
+// Download fetches the AG member list from url. The caller closes the result.
+func Download(ctx context.Context, client *http.Client, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("bad status: %s (status code: %d)", resp.Status, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// Import replaces the eqsl_ag table with the callsigns in an AG member list.
+// Portable calls are stored under their base call. It refuses to replace the
+// table with an empty list, so a failed or truncated download keeps the
+// previous one.
+func Import(ctx context.Context, db *sql.DB, r io.Reader) (int, error) {
+	members := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Lines that aren't callsigns (the title, blank lines) are skipped
+		if base := callsign.Base(strings.TrimSpace(scanner.Text())); base != "" {
+			members[base] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read AG member list: %w", err)
+	}
+	if len(members) == 0 {
+		return 0, fmt.Errorf("no callsigns found in AG member list; refusing to replace existing data")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM eqsl_ag"); err != nil {
+		return 0, err
+	}
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO eqsl_ag (callsign) VALUES (?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for call := range members {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		if _, err := stmt.ExecContext(ctx, call); err != nil {
+			return 0, fmt.Errorf("failed to insert %s: %w", call, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	log.Printf("Loaded %d eQSL AG members", len(members))
+	return len(members), nil
+}
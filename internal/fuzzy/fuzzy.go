@@ -0,0 +1,56 @@
+// Package fuzzy finds near-miss callsigns: the trigrams indexed in the
+// callsign_trigrams table and the edit distance used to rank candidates.
+package fuzzy
+
+import "strings"
+
+// MaxCallsignLength is the longest callsign the trigram index covers; longer
+// callsigns only have their first MaxCallsignLength+1 trigrams indexed
+const MaxCallsignLength = 31
+
+// Trigrams returns the distinct trigrams of an upper-cased callsign padded
+// as "^^CALL$", so prefixes and suffixes carry their own trigrams. The
+// schema's triggers compute the same padding in SQL.
+func Trigrams(call string) []string {
+	padded := "^^" + strings.ToUpper(call) + "$"
+	seen := map[string]bool{}
+	var out []string
+	for i := 0; i+3 <= len(padded) && i <= MaxCallsignLength; i++ {
+		t := padded[i : i+3]
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Distance returns the optimal string alignment distance between a and b:
+// insertions, deletions, substitutions, and transpositions of adjacent
+// characters each count as one edit. Transposed characters are a common
+// busted call, so they cost one edit rather than two.
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	// d[i][j] is the distance between ra[:i] and rb[:j]
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
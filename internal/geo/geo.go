@@ -0,0 +1,251 @@
+// Package geo converts between the coordinate systems used by licence data
+// and the Maidenhead grid squares returned by the API.
+package geo
+
+import (
+	"fmt"
+	"math"
+)
+
+// GridSquare calculates the Maidenhead grid square from latitude and longitude.
+// Returns a 6-character grid square (e.g., "EM10ci").
+func GridSquare(lat, lon float64) string {
+	// Adjust longitude and latitude to be in the range [0, 360) and [0, 180)
+	adjustedLon := lon + 180.0
+	adjustedLat := lat + 90.0
+
+	// Calculate field (first pair - letters A-R)
+	fieldLon := int(adjustedLon / 20.0)
+	fieldLat := int(adjustedLat / 10.0)
+	if fieldLon < 0 || fieldLon >= 18 || fieldLat < 0 || fieldLat >= 18 {
+		return ""
+	}
+
+	// Calculate square (second pair - digits 0-9)
+	squareLon := int((adjustedLon - float64(fieldLon)*20.0) / 2.0)
+	squareLat := int((adjustedLat - float64(fieldLat)*10.0) / 1.0)
+	if squareLon < 0 || squareLon >= 10 || squareLat < 0 || squareLat >= 10 {
+		return ""
+	}
+
+	// Calculate subsquare (third pair - letters a-x)
+	subsquareLon := int((adjustedLon - float64(fieldLon)*20.0 - float64(squareLon)*2.0) / (2.0 / 24.0))
+	subsquareLat := int((adjustedLat - float64(fieldLat)*10.0 - float64(squareLat)*1.0) / (1.0 / 24.0))
+	if subsquareLon < 0 || subsquareLon >= 24 || subsquareLat < 0 || subsquareLat >= 24 {
+		return ""
+	}
+
+	// Build the grid square string
+	return fmt.Sprintf("%c%c%d%d%c%c",
+		'A'+byte(fieldLon),
+		'A'+byte(fieldLat),
+		squareLon,
+		squareLat,
+		'a'+byte(subsquareLon),
+		'a'+byte(subsquareLat),
+	)
+}
+
+// ellipsoid is a reference ellipsoid by semi-major and semi-minor axis
+type ellipsoid struct {
+	a, b float64
+}
+
+func (e ellipsoid) e2() float64 {
+	return 1 - (e.b*e.b)/(e.a*e.a)
+}
+
+var (
+	airy1830 = ellipsoid{6377563.396, 6356256.909}
+	wgs84    = ellipsoid{6378137.000, 6356752.3142}
+)
+
+// OSGBToWGS84 converts an Ordnance Survey National Grid easting/northing
+// (as used by Code-Point Open) to WGS84 latitude/longitude in degrees. It uses
+// the OS transverse Mercator formulas and a 7-parameter Helmert transform,
+// which is accurate to about 5 metres, far finer than a grid subsquare.
+func OSGBToWGS84(easting, northing float64) (lat, lon float64) {
+	// National Grid projection constants
+	const (
+		f0 = 0.9996012717
+		n0 = -100000.0
+		e0 = 400000.0
+	)
+	lat0 := 49 * math.Pi / 180
+	lon0 := -2 * math.Pi / 180
+
+	a, b := airy1830.a, airy1830.b
+	e2 := airy1830.e2()
+	n := (a - b) / (a + b)
+	n2, n3 := n*n, n*n*n
+
+	// Iterate for the latitude whose meridional arc matches the northing
+	phi := lat0
+	m := 0.0
+	for {
+		phi = (northing-n0-m)/(a*f0) + phi
+		ma := (1 + n + 1.25*n2 + 1.25*n3) * (phi - lat0)
+		mb := (3*n + 3*n2 + 21.0/8*n3) * math.Sin(phi-lat0) * math.Cos(phi+lat0)
+		mc := (15.0/8*n2 + 15.0/8*n3) * math.Sin(2*(phi-lat0)) * math.Cos(2*(phi+lat0))
+		md := 35.0 / 24 * n3 * math.Sin(3*(phi-lat0)) * math.Cos(3*(phi+lat0))
+		m = b * f0 * (ma - mb + mc - md)
+		if math.Abs(northing-n0-m) < 0.00001 {
+			break
+		}
+	}
+
+	sinPhi, cosPhi, tanPhi := math.Sin(phi), math.Cos(phi), math.Tan(phi)
+	secPhi := 1 / cosPhi
+	nu := a * f0 / math.Sqrt(1-e2*sinPhi*sinPhi)
+	rho := a * f0 * (1 - e2) / math.Pow(1-e2*sinPhi*sinPhi, 1.5)
+	eta2 := nu/rho - 1
+	t2, t4, t6 := tanPhi*tanPhi, math.Pow(tanPhi, 4), math.Pow(tanPhi, 6)
+
+	vii := tanPhi / (2 * rho * nu)
+	viii := tanPhi / (24 * rho * math.Pow(nu, 3)) * (5 + 3*t2 + eta2 - 9*t2*eta2)
+	ix := tanPhi / (720 * rho * math.Pow(nu, 5)) * (61 + 90*t2 + 45*t4)
+	x := secPhi / nu
+	xi := secPhi / (6 * math.Pow(nu, 3)) * (nu/rho + 2*t2)
+	xii := secPhi / (120 * math.Pow(nu, 5)) * (5 + 28*t2 + 24*t4)
+	xiia := secPhi / (5040 * math.Pow(nu, 7)) * (61 + 662*t2 + 1320*t4 + 720*t6)
+
+	de := easting - e0
+	osgbLat := phi - vii*math.Pow(de, 2) + viii*math.Pow(de, 4) - ix*math.Pow(de, 6)
+	osgbLon := lon0 + x*de - xi*math.Pow(de, 3) + xii*math.Pow(de, 5) - xiia*math.Pow(de, 7)
+
+	// Shift from the OSGB36 datum to WGS84 via cartesian coordinates
+	cx, cy, cz := toCartesian(osgbLat, osgbLon, airy1830)
+
+	const (
+		tx, ty, tz = 446.448, -125.157, 542.060
+		s          = -20.4894e-6
+	)
+	arcsec := math.Pi / 180 / 3600
+	rx, ry, rz := 0.1502*arcsec, 0.2470*arcsec, 0.8421*arcsec
+
+	wx := tx + (1+s)*cx - rz*cy + ry*cz
+	wy := ty + rz*cx + (1+s)*cy - rx*cz
+	wz := tz - ry*cx + rx*cy + (1+s)*cz
+
+	lat, lon = fromCartesian(wx, wy, wz, wgs84)
+	return lat * 180 / math.Pi, lon * 180 / math.Pi
+}
+
+// toCartesian converts latitude/longitude in radians at zero height to
+// earth-centred cartesian coordinates on ellipsoid e
+func toCartesian(lat, lon float64, e ellipsoid) (x, y, z float64) {
+	e2 := e.e2()
+	sinLat := math.Sin(lat)
+	nu := e.a / math.Sqrt(1-e2*sinLat*sinLat)
+	x = nu * math.Cos(lat) * math.Cos(lon)
+	y = nu * math.Cos(lat) * math.Sin(lon)
+	z = (1 - e2) * nu * sinLat
+	return x, y, z
+}
+
+// fromCartesian converts cartesian coordinates to latitude/longitude in
+// radians on ellipsoid e
+func fromCartesian(x, y, z float64, e ellipsoid) (lat, lon float64) {
+	e2 := e.e2()
+	p := math.Hypot(x, y)
+	lat = math.Atan2(z, p*(1-e2))
+	for i := 0; i < 10; i++ {
+		sinLat := math.Sin(lat)
+		nu := e.a / math.Sqrt(1-e2*sinLat*sinLat)
+		next := math.Atan2(z+e2*nu*sinLat, p)
+		if math.Abs(next-lat) < 1e-12 {
+			lat = next
+			break
+		}
+		lat = next
+	}
+	return lat, math.Atan2(y, x)
+}
+
+// earthRadiusKm is the mean earth radius used for great-circle distances
+const earthRadiusKm = 6371.0088
+
+// GridCenter returns the latitude and longitude of the centre of a 2, 4, 6,
+// or 8 character Maidenhead locator, e.g. "EM10ci"
+func GridCenter(grid string) (lat, lon float64, err error) {
+	if n := len(grid); n == 0 || n > 8 || n%2 != 0 {
+		return 0, 0, fmt.Errorf("invalid grid square %q", grid)
+	}
+
+	// Each pair narrows the cell: fields 20x10 degrees, squares 10x10,
+	// subsquares 24x24, extended squares 10x10
+	lon, lat = -180, -90
+	w, h := 360.0, 180.0
+	for i := 0; i < len(grid); i += 2 {
+		a, b := grid[i], grid[i+1]
+		var base byte
+		var divisions float64
+		switch i {
+		case 0:
+			base, divisions = 'A', 18
+			a, b = upper(a), upper(b)
+		case 2, 6:
+			base, divisions = '0', 10
+		case 4:
+			base, divisions = 'A', 24
+			a, b = upper(a), upper(b)
+		}
+		x, y := float64(a)-float64(base), float64(b)-float64(base)
+		if x < 0 || x >= divisions || y < 0 || y >= divisions {
+			return 0, 0, fmt.Errorf("invalid grid square %q", grid)
+		}
+		w, h = w/divisions, h/divisions
+		lon += x * w
+		lat += y * h
+	}
+	return lat + h/2, lon + w/2, nil
+}
+
+// upper converts an ASCII letter to upper case
+func upper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+// Distance returns the great-circle distance in kilometres between two points
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	p1, p2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dp := p2 - p1
+	dl := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dp/2)*math.Sin(dp/2) + math.Cos(p1)*math.Cos(p2)*math.Sin(dl/2)*math.Sin(dl/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Bearing returns the initial great-circle bearing in degrees (0-360) from
+// the first point to the second, i.e. the beam heading
+func Bearing(lat1, lon1, lat2, lon2 float64) float64 {
+	p1, p2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dl := (lon2 - lon1) * math.Pi / 180
+	y := math.Sin(dl) * math.Cos(p2)
+	x := math.Cos(p1)*math.Sin(p2) - math.Sin(p1)*math.Cos(p2)*math.Cos(dl)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// BoundingBox returns the latitude/longitude box enclosing every point within
+// radiusKm of a point, for prefiltering with an index before Distance.
+// Longitude spans the whole globe near the poles and across the antimeridian.
+func BoundingBox(lat, lon, radiusKm float64) (minLat, maxLat, minLon, maxLon float64) {
+	r := radiusKm / earthRadiusKm
+	dLat := r * 180 / math.Pi
+	minLat, maxLat = math.Max(lat-dLat, -90), math.Min(lat+dLat, 90)
+	if minLat == -90 || maxLat == 90 {
+		return minLat, maxLat, -180, 180
+	}
+	ratio := math.Sin(r) / math.Cos(lat*math.Pi/180)
+	if ratio >= 1 {
+		return minLat, maxLat, -180, 180
+	}
+	dLon := math.Asin(ratio) * 180 / math.Pi
+	minLon, maxLon = lon-dLon, lon+dLon
+	if minLon < -180 || maxLon > 180 {
+		return minLat, maxLat, -180, 180
+	}
+	return minLat, maxLat, minLon, maxLon
+}
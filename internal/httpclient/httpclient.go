@@ -0,0 +1,31 @@
+// Package httpclient builds the HTTP client used by the importers to download
+// source data, with optional explicit proxy support.
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// New returns a download client. With an empty proxy the standard
+// HTTP_PROXY, HTTPS_PROXY, and NO_PROXY variables are honored; otherwise all
+// requests go through proxy (http://, https://, socks5://, or socks5h://).
+func New(proxy string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q (use http, https, socks5, or socks5h)", u.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
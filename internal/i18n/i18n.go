@@ -0,0 +1,63 @@
+// Package i18n translates the readable strings the API and lookup page
+// show people: license status and operator class descriptions, and the
+// page's labels. Codes and field names stay as they are in every language.
+package i18n
+
+import (
+	"golang.org/x/text/language"
+)
+
+// Languages are the supported language tags, English (the fallback) first
+var Languages = []string{"en", "es", "de", "ja"}
+
+var matcher = language.NewMatcher([]language.Tag{
+	language.English, language.Spanish, language.German, language.Japanese,
+})
+
+// Match returns the supported language that best fits an explicit choice
+// (such as ?lang=) or else an Accept-Language header, and "en" when neither
+// names one
+func Match(lang, acceptLanguage string) string {
+	_, i := language.MatchStrings(matcher, lang, acceptLanguage)
+	return Languages[i]
+}
+
+// Text returns a message in a language, the English message if it hasn't
+// been translated, or "" for an unknown id
+func Text(lang, id string) string {
+	if s, ok := catalog[lang][id]; ok {
+		return s
+	}
+	return catalog["en"][id]
+}
+
+// Status describes a license status code (A, E, ...), or "" for an unknown
+// code
+func Status(lang, code string) string {
+	if code == "" {
+		return ""
+	}
+	return Text(lang, "status."+code)
+}
+
+// Class describes an FCC operator class code (T, G, E, ...), or "" for an
+// unknown code
+func Class(lang, code string) string {
+	if code == "" {
+		return ""
+	}
+	return Text(lang, "class."+code)
+}
+
+// Messages returns every message in a language, with English filling in
+// any that haven't been translated, for clients that translate themselves
+func Messages(lang string) map[string]string {
+	out := make(map[string]string, len(catalog["en"]))
+	for id, s := range catalog["en"] {
+		out[id] = s
+	}
+	for id, s := range catalog[lang] {
+		out[id] = s
+	}
+	return out
+}
@@ -0,0 +1,150 @@
+package i18n
+
+// catalog holds each language's messages by id. status.* are license
+// statuses, class.* FCC operator classes, and ui.* the lookup page's
+// labels. FCC class names are proper names, so only Japanese spells them
+// differently.
+var catalog = map[string]map[string]string{
+	"en": {
+		"status.A": "Active",
+		"status.C": "Cancelled",
+		"status.E": "Expired",
+		"status.L": "Pending legal status",
+		"status.P": "Parent license cancelled",
+		"status.T": "Terminated",
+		"status.X": "Termination pending",
+		"status.R": "Revoked",
+
+		"class.N": "Novice",
+		"class.T": "Technician",
+		"class.P": "Technician Plus",
+		"class.G": "General",
+		"class.A": "Advanced",
+		"class.E": "Amateur Extra",
+
+		"ui.title":          "Try the API",
+		"ui.subtitle":       "Start typing a callsign to search the database, then pick a match to see its record",
+		"ui.callsign":       "Callsign",
+		"ui.lookup":         "Lookup",
+		"ui.examples":       "Quick examples:",
+		"ui.status":         "Status",
+		"ui.class":          "Class",
+		"ui.expires":        "Expires",
+		"ui.grid":           "Grid Square",
+		"ui.location":       "Location",
+		"ui.licensed":       "Licensed",
+		"ui.inactive":       "inactive",
+		"ui.none":           "N/A",
+		"ui.map":            "View larger map",
+		"ui.map_credit":     "Map data © OpenStreetMap contributors",
+		"ui.vcf":            "Add to contacts",
+		"ui.qr":             "QR code",
+		"ui.qsl":            "QSL label",
+		"ui.response":       "API Response",
+		"ui.enter_callsign": "Please enter a callsign",
+		"ui.lookup_error":   "Error looking up callsign: ",
+	},
+	"es": {
+		"status.A": "Activa",
+		"status.C": "Cancelada",
+		"status.E": "Vencida",
+		"status.L": "Situación legal pendiente",
+		"status.P": "Licencia principal cancelada",
+		"status.T": "Terminada",
+		"status.X": "Terminación pendiente",
+		"status.R": "Revocada",
+
+		"ui.title":          "Pruebe la API",
+		"ui.subtitle":       "Escriba un indicativo para buscar en la base de datos y elija un resultado para ver su registro",
+		"ui.callsign":       "Indicativo",
+		"ui.lookup":         "Buscar",
+		"ui.examples":       "Ejemplos:",
+		"ui.status":         "Estado",
+		"ui.class":          "Clase",
+		"ui.expires":        "Vence",
+		"ui.grid":           "Cuadrícula",
+		"ui.location":       "Ubicación",
+		"ui.licensed":       "Con licencia",
+		"ui.inactive":       "inactiva",
+		"ui.none":           "N/D",
+		"ui.map":            "Ver mapa más grande",
+		"ui.map_credit":     "Datos del mapa © colaboradores de OpenStreetMap",
+		"ui.vcf":            "Añadir a contactos",
+		"ui.qr":             "Código QR",
+		"ui.qsl":            "Etiqueta QSL",
+		"ui.response":       "Respuesta de la API",
+		"ui.enter_callsign": "Introduzca un indicativo",
+		"ui.lookup_error":   "Error al buscar el indicativo: ",
+	},
+	"de": {
+		"status.A": "Aktiv",
+		"status.C": "Storniert",
+		"status.E": "Abgelaufen",
+		"status.L": "Rechtsstatus ausstehend",
+		"status.P": "Hauptlizenz storniert",
+		"status.T": "Beendet",
+		"status.X": "Beendigung ausstehend",
+		"status.R": "Widerrufen",
+
+		"ui.title":          "API ausprobieren",
+		"ui.subtitle":       "Geben Sie ein Rufzeichen ein, um die Datenbank zu durchsuchen, und wählen Sie einen Treffer aus",
+		"ui.callsign":       "Rufzeichen",
+		"ui.lookup":         "Suchen",
+		"ui.examples":       "Beispiele:",
+		"ui.status":         "Status",
+		"ui.class":          "Klasse",
+		"ui.expires":        "Gültig bis",
+		"ui.grid":           "Locator",
+		"ui.location":       "Ort",
+		"ui.licensed":       "Lizenziert",
+		"ui.inactive":       "inaktiv",
+		"ui.none":           "k. A.",
+		"ui.map":            "Größere Karte anzeigen",
+		"ui.map_credit":     "Kartendaten © OpenStreetMap-Mitwirkende",
+		"ui.vcf":            "Zu Kontakten hinzufügen",
+		"ui.qr":             "QR-Code",
+		"ui.qsl":            "QSL-Etikett",
+		"ui.response":       "API-Antwort",
+		"ui.enter_callsign": "Bitte geben Sie ein Rufzeichen ein",
+		"ui.lookup_error":   "Fehler bei der Rufzeichensuche: ",
+	},
+	"ja": {
+		"status.A": "有効",
+		"status.C": "取消",
+		"status.E": "期限切れ",
+		"status.L": "法的手続き中",
+		"status.P": "親免許取消",
+		"status.T": "終了",
+		"status.X": "終了手続き中",
+		"status.R": "取り消し処分",
+
+		"class.N": "ノービス級",
+		"class.T": "テクニシャン級",
+		"class.P": "テクニシャン・プラス級",
+		"class.G": "ジェネラル級",
+		"class.A": "アドバンスト級",
+		"class.E": "アマチュア・エクストラ級",
+
+		"ui.title":          "APIを試す",
+		"ui.subtitle":       "コールサインを入力してデータベースを検索し、候補を選ぶと記録が表示されます",
+		"ui.callsign":       "コールサイン",
+		"ui.lookup":         "検索",
+		"ui.examples":       "例:",
+		"ui.status":         "状態",
+		"ui.class":          "資格",
+		"ui.expires":        "有効期限",
+		"ui.grid":           "グリッドロケーター",
+		"ui.location":       "所在地",
+		"ui.licensed":       "免許あり",
+		"ui.inactive":       "無効",
+		"ui.none":           "なし",
+		"ui.map":            "大きな地図で見る",
+		"ui.map_credit":     "地図データ © OpenStreetMap の貢献者",
+		"ui.vcf":            "連絡先に追加",
+		"ui.qr":             "QRコード",
+		"ui.qsl":            "QSLラベル",
+		"ui.response":       "APIレスポンス",
+		"ui.enter_callsign": "コールサインを入力してください",
+		"ui.lookup_error":   "コールサインの検索に失敗しました: ",
+	},
+}
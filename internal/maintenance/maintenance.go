@@ -0,0 +1,106 @@
+// Package maintenance implements database upkeep shared by the hamqrzdb CLI
+// and the API server's scheduled maintenance.
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Options controls which maintenance steps are run
+type Options struct {
+	// FullVacuum rebuilds the whole file with VACUUM instead of the cheaper
+	// incremental vacuum. Required once to switch an existing database to
+	// auto_vacuum=INCREMENTAL.
+	FullVacuum bool
+}
+
+// Step records the outcome of a single maintenance step
+type Step struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// sqlStep is a named statement executed as part of maintenance
+type sqlStep struct {
+	name  string
+	query string
+}
+
+// Report summarizes a maintenance run
+type Report struct {
+	Steps          []Step `json:"steps"`
+	FreePagesStart int64  `json:"free_pages_start"`
+	FreePagesEnd   int64  `json:"free_pages_end"`
+	PageSize       int64  `json:"page_size"`
+}
+
+// ReclaimedBytes returns the space returned to the filesystem by the run
+func (r Report) ReclaimedBytes() int64 {
+	return (r.FreePagesStart - r.FreePagesEnd) * r.PageSize
+}
+
+// Run checkpoints the WAL, refreshes planner statistics, and reclaims free
+// pages. db must be a writable connection.
+func Run(ctx context.Context, db *sql.DB, opts Options) (Report, error) {
+	var report Report
+
+	if err := db.QueryRowContext(ctx, "PRAGMA page_size").Scan(&report.PageSize); err != nil {
+		return report, fmt.Errorf("failed to read page size: %w", err)
+	}
+	if err := db.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&report.FreePagesStart); err != nil {
+		return report, fmt.Errorf("failed to read freelist: %w", err)
+	}
+
+	var autoVacuum int
+	if err := db.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&autoVacuum); err != nil {
+		return report, fmt.Errorf("failed to read auto_vacuum mode: %w", err)
+	}
+
+	steps := []sqlStep{
+		{"wal_checkpoint", "PRAGMA wal_checkpoint(TRUNCATE)"},
+		{"analyze", "ANALYZE"},
+		{"optimize", "PRAGMA optimize"},
+	}
+
+	switch {
+	case opts.FullVacuum:
+		// auto_vacuum only takes effect on an existing database after a VACUUM
+		steps = append(steps,
+			sqlStep{"auto_vacuum", "PRAGMA auto_vacuum=INCREMENTAL"},
+			sqlStep{"vacuum", "VACUUM"},
+		)
+	case autoVacuum == 2:
+		steps = append(steps, sqlStep{"incremental_vacuum", "PRAGMA incremental_vacuum"})
+	default:
+		log.Printf("Database is not in incremental auto_vacuum mode; run with a full vacuum once to enable it")
+	}
+
+	for _, s := range steps {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		log.Printf("Running %s...", s.name)
+		start := time.Now()
+		_, err := db.ExecContext(ctx, s.query)
+		step := Step{Name: s.name, Duration: time.Since(start)}
+		if err != nil {
+			step.Error = err.Error()
+			report.Steps = append(report.Steps, step)
+			return report, fmt.Errorf("%s failed: %w", s.name, err)
+		}
+		report.Steps = append(report.Steps, step)
+		log.Printf("  %s done in %s", s.name, step.Duration.Round(time.Millisecond))
+	}
+
+	if err := db.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&report.FreePagesEnd); err != nil {
+		return report, fmt.Errorf("failed to read freelist: %w", err)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,130 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// VerifyOptions controls which checks Verify runs
+type VerifyOptions struct {
+	// Quick uses PRAGMA quick_check, which skips index content verification
+	// and is fast enough to run at API startup.
+	Quick bool
+	// SpotCheck lists callsigns that must be present in the database
+	SpotCheck []string
+}
+
+// VerifyReport is the outcome of Verify. Problems make the database unfit to
+// serve; warnings are reported but don't fail verification.
+type VerifyReport struct {
+	Integrity     []string       `json:"integrity"`
+	SchemaVersion int            `json:"schema_version"`
+	Counts        map[string]int `json:"counts"`
+	Missing       []string       `json:"missing,omitempty"`
+	Problems      []string       `json:"problems,omitempty"`
+	Warnings      []string       `json:"warnings,omitempty"`
+}
+
+// OK reports whether verification found no problems
+func (r VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify checks database integrity, schema version, spot-check callsigns, and
+// reports row counts per country. An error is returned only if the checks
+// could not be run at all; failed checks are recorded in the report.
+func Verify(ctx context.Context, db *sql.DB, opts VerifyOptions) (VerifyReport, error) {
+	report := VerifyReport{Counts: map[string]int{}}
+
+	pragma := "PRAGMA integrity_check"
+	if opts.Quick {
+		pragma = "PRAGMA quick_check"
+	}
+
+	rows, err := db.QueryContext(ctx, pragma)
+	if err != nil {
+		return report, fmt.Errorf("integrity check failed to run: %w", err)
+	}
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			rows.Close()
+			return report, err
+		}
+		report.Integrity = append(report.Integrity, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("integrity check failed to run: %w", err)
+	}
+	if len(report.Integrity) != 1 || report.Integrity[0] != "ok" {
+		report.Problems = append(report.Problems, fmt.Sprintf("integrity check reported %d problem(s)", len(report.Integrity)))
+	}
+
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&report.SchemaVersion); err != nil {
+		return report, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	switch {
+	case report.SchemaVersion == 0:
+		report.Warnings = append(report.Warnings, "schema version is not set (database predates versioning or was never imported)")
+	case report.SchemaVersion > schema.Version:
+		report.Problems = append(report.Problems, fmt.Sprintf("schema version %d is newer than supported version %d", report.SchemaVersion, schema.Version))
+	case report.SchemaVersion < schema.Version:
+		report.Warnings = append(report.Warnings, fmt.Sprintf("schema version %d is older than %d; re-run the importer to migrate", report.SchemaVersion, schema.Version))
+	}
+
+	// Older databases have no country column; derive it from the service code
+	countryExpr := "CASE radio_service_code WHEN 'UK' THEN 'United Kingdom' WHEN 'NZ' THEN 'New Zealand' WHEN 'JP' THEN 'Japan' ELSE 'United States' END"
+	if has, err := schema.HasColumn(ctx, db, "callsigns", "country"); err != nil {
+		return report, err
+	} else if has {
+		countryExpr = "COALESCE(NULLIF(country, ''), " + countryExpr + ")"
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT `+countryExpr+` AS country_name, COUNT(*)
+		FROM callsigns
+		GROUP BY country_name
+	`)
+	if err != nil {
+		return report, fmt.Errorf("failed to count rows: %w", err)
+	}
+	for rows.Next() {
+		var country string
+		var n int
+		if err := rows.Scan(&country, &n); err != nil {
+			rows.Close()
+			return report, err
+		}
+		report.Counts[country] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("failed to count rows: %w", err)
+	}
+
+	for _, call := range opts.SpotCheck {
+		call = strings.ToUpper(strings.TrimSpace(call))
+		if call == "" {
+			continue
+		}
+		var found int
+		err := db.QueryRowContext(ctx, "SELECT 1 FROM callsigns WHERE callsign = ? LIMIT 1", call).Scan(&found)
+		if err == sql.ErrNoRows {
+			report.Missing = append(report.Missing, call)
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("spot check for %s failed: %w", call, err)
+		}
+	}
+	if len(report.Missing) > 0 {
+		report.Problems = append(report.Problems, fmt.Sprintf("spot-check callsigns missing: %s", strings.Join(report.Missing, ", ")))
+	}
+
+	return report, nil
+}
@@ -0,0 +1,170 @@
+// Package notify sends operator notifications from the API server: email
+// summaries over SMTP, and import results to Discord and Slack webhooks.
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailConfig is the SMTP server and addresses summaries are sent with, read
+// from the environment by LoadEmailConfig
+type EmailConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Enabled reports whether an SMTP server and recipients are configured
+func (c EmailConfig) Enabled() bool {
+	return c.Host != "" && len(c.To) > 0
+}
+
+// LoadEmailConfig reads SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME,
+// SMTP_PASSWORD, NOTIFY_EMAIL_FROM, and NOTIFY_EMAIL_TO (comma-separated).
+// Without SMTP_HOST email is off.
+func LoadEmailConfig(getenv func(string) string) (EmailConfig, error) {
+	cfg := EmailConfig{
+		Host:     getenv("SMTP_HOST"),
+		Port:     587,
+		Username: getenv("SMTP_USERNAME"),
+		Password: getenv("SMTP_PASSWORD"),
+		From:     getenv("NOTIFY_EMAIL_FROM"),
+	}
+	if cfg.Host == "" {
+		return cfg, nil
+	}
+	if v := getenv("SMTP_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil || port <= 0 || port > 65535 {
+			return cfg, fmt.Errorf("invalid SMTP_PORT %q", v)
+		}
+		cfg.Port = port
+	}
+	for _, addr := range strings.Split(getenv("NOTIFY_EMAIL_TO"), ",") {
+		if addr = strings.TrimSpace(addr); addr == "" {
+			continue
+		}
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return cfg, fmt.Errorf("invalid NOTIFY_EMAIL_TO address %q", addr)
+		}
+		cfg.To = append(cfg.To, addr)
+	}
+	if len(cfg.To) == 0 {
+		return cfg, errors.New("SMTP_HOST requires NOTIFY_EMAIL_TO")
+	}
+	if cfg.From == "" {
+		cfg.From = cfg.Username
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return cfg, fmt.Errorf("invalid NOTIFY_EMAIL_FROM %q (it defaults to SMTP_USERNAME)", cfg.From)
+	}
+	return cfg, nil
+}
+
+// sendTimeout bounds one delivery, since net/smtp itself has no deadlines
+const sendTimeout = 30 * time.Second
+
+// SendEmail sends a plain text message to every recipient. Port 465 uses
+// implicit TLS; other ports upgrade with STARTTLS when the server offers
+// it, which it must before credentials are sent.
+func SendEmail(ctx context.Context, cfg EmailConfig, subject, body string) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+	var conn net.Conn
+	var err error
+	if cfg.Port == 465 {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		return fmt.Errorf("SMTP handshake with %s failed: %w", addr, err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok && cfg.Port != 465 {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS with %s failed: %w", addr, err)
+		}
+	}
+	if cfg.Username != "" {
+		// PlainAuth refuses to send credentials over an unencrypted
+		// connection to anything but localhost
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	// The envelope takes bare addresses; display names stay in the headers
+	if err := c.Mail(envelopeAddress(cfg.From)); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	for _, to := range cfg.To {
+		if err := c.Rcpt(envelopeAddress(to)); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s failed: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(message(cfg, subject, body, time.Now())); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return c.Quit()
+}
+
+// envelopeAddress returns the bare address of "Name <addr>"
+func envelopeAddress(s string) string {
+	if a, err := mail.ParseAddress(s); err == nil {
+		return a.Address
+	}
+	return s
+}
+
+// message formats a plain text message. The DATA writer converts line
+// endings to CRLF and escapes leading dots.
+func message(cfg EmailConfig, subject, body string, now time.Time) []byte {
+	var b strings.Builder
+	header := func(name, value string) {
+		b.WriteString(name + ": " + value + "\n")
+	}
+	header("From", cfg.From)
+	header("To", strings.Join(cfg.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	b.WriteString("\n")
+	b.WriteString(body)
+	return []byte(b.String())
+}
@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Webhook is a chat webhook, read from the environment by LoadWebhooks
+type Webhook struct {
+	URL string
+	// Kind is "discord" or "slack", which take different payloads
+	Kind string
+}
+
+// LoadWebhooks reads NOTIFY_WEBHOOK_URL, a comma-separated list of Discord
+// (discord.com/api/webhooks/...) and Slack (hooks.slack.com/...) incoming
+// webhook URLs. Other hosts, such as a Mattermost or Rocket.Chat server,
+// are sent Slack's payload, which they accept too.
+func LoadWebhooks(getenv func(string) string) ([]Webhook, error) {
+	var hooks []Webhook
+	for _, raw := range strings.Split(getenv("NOTIFY_WEBHOOK_URL"), ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("invalid NOTIFY_WEBHOOK_URL %q", raw)
+		}
+		kind := "slack"
+		if host := strings.ToLower(u.Hostname()); host == "discord.com" || host == "discordapp.com" || strings.HasSuffix(host, ".discord.com") {
+			kind = "discord"
+		}
+		hooks = append(hooks, Webhook{URL: raw, Kind: kind})
+	}
+	return hooks, nil
+}
+
+// webhookClient posts notifications; webhooks answer quickly or not at all
+var webhookClient = &http.Client{Timeout: 15 * time.Second}
+
+// maxDiscordContent is the longest message Discord accepts
+const maxDiscordContent = 2000
+
+// Post sends text as a message to the webhook
+func (h Webhook) Post(ctx context.Context, text string) error {
+	var payload interface{}
+	if h.Kind == "discord" {
+		if len(text) > maxDiscordContent {
+			text = text[:maxDiscordContent-3] + "..."
+		}
+		payload = map[string]string{"content": text}
+	} else {
+		payload = map[string]string{"text": text}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s webhook failed: %w", h.Kind, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s webhook returned %s: %s", h.Kind, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
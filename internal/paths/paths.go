@@ -0,0 +1,46 @@
+// Package paths holds the platform differences in where hamqrzdb keeps its
+// database and finds its sibling binaries.
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// DefaultDB returns the database path to use when none is configured. On
+// Windows it is hamqrzdb.sqlite in %APPDATA%\hamqrzdb, so the CLI, the
+// importers, and the API agree on one file wherever they are started from;
+// elsewhere, or without APPDATA, it is fallback. The directory is created
+// if missing, since SQLite won't create it.
+func DefaultDB(fallback string) string {
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("APPDATA"); dir != "" {
+			dir = filepath.Join(dir, "hamqrzdb")
+			_ = os.MkdirAll(dir, 0o755)
+			return filepath.Join(dir, "hamqrzdb.sqlite")
+		}
+	}
+	return fallback
+}
+
+// Exe returns the file name of the binary name on this platform
+func Exe(name string) string {
+	if runtime.GOOS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
+
+// Sibling returns the path of the binary name in the directory of the
+// running executable, or name itself, to be looked up on PATH, when it isn't
+// there
+func Sibling(name string) string {
+	if exe, err := os.Executable(); err == nil {
+		p := filepath.Join(filepath.Dir(exe), Exe(name))
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return name
+}
@@ -0,0 +1,202 @@
+// Package phonetic computes the sound-alike keys stored with each record's
+// name, so names caught by ear on the air can be searched.
+package phonetic
+
+import "strings"
+
+// letters returns s upper-cased with everything but A-Z removed
+func letters(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// soundexCodes maps letters to their Soundex digits; vowels, H, W, and Y
+// have none
+var soundexCodes = [26]byte{
+	'A' - 'A': 0, 'B' - 'A': '1', 'C' - 'A': '2', 'D' - 'A': '3', 'E' - 'A': 0,
+	'F' - 'A': '1', 'G' - 'A': '2', 'H' - 'A': 0, 'I' - 'A': 0, 'J' - 'A': '2',
+	'K' - 'A': '2', 'L' - 'A': '4', 'M' - 'A': '5', 'N' - 'A': '5', 'O' - 'A': 0,
+	'P' - 'A': '1', 'Q' - 'A': '2', 'R' - 'A': '6', 'S' - 'A': '2', 'T' - 'A': '3',
+	'U' - 'A': 0, 'V' - 'A': '1', 'W' - 'A': 0, 'X' - 'A': '2', 'Y' - 'A': 0,
+	'Z' - 'A': '2',
+}
+
+// Soundex returns the American Soundex code of a name (e.g. "Robert" and
+// "Rupert" are both R163), or "" if it has no letters
+func Soundex(name string) string {
+	s := letters(name)
+	if s == "" {
+		return ""
+	}
+
+	code := []byte{s[0]}
+	last := soundexCodes[s[0]-'A']
+	for i := 1; i < len(s) && len(code) < 4; i++ {
+		c := s[i]
+		digit := soundexCodes[c-'A']
+		switch {
+		case digit != 0 && digit != last:
+			code = append(code, digit)
+			last = digit
+		case c == 'H' || c == 'W':
+			// H and W don't separate letters with the same code
+		default:
+			last = digit
+		}
+	}
+	for len(code) < 4 {
+		code = append(code, '0')
+	}
+	return string(code)
+}
+
+// isVowel reports whether c is an upper-case vowel
+func isVowel(c byte) bool {
+	return c == 'A' || c == 'E' || c == 'I' || c == 'O' || c == 'U'
+}
+
+// Metaphone returns the original (Philips, 1990) Metaphone key of a name,
+// which handles English spellings better than Soundex ("Knight" and "Night"
+// are both NT), or "" if it has no letters. "0" stands for the "th" sound.
+func Metaphone(name string) string {
+	s := letters(name)
+	if s == "" {
+		return ""
+	}
+
+	// Initial letter exceptions
+	switch {
+	case strings.HasPrefix(s, "AE"), strings.HasPrefix(s, "GN"), strings.HasPrefix(s, "KN"),
+		strings.HasPrefix(s, "PN"), strings.HasPrefix(s, "WR"):
+		s = s[1:]
+	case s[0] == 'X':
+		s = "S" + s[1:]
+	case strings.HasPrefix(s, "WH"):
+		s = "W" + s[2:]
+	}
+
+	at := func(i int) byte {
+		if i < 0 || i >= len(s) {
+			return 0
+		}
+		return s[i]
+	}
+
+	var key strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		// Doubled letters sound once, except C
+		if c != 'C' && c == at(i-1) {
+			continue
+		}
+		next, prev := at(i+1), at(i-1)
+
+		switch c {
+		case 'A', 'E', 'I', 'O', 'U':
+			if i == 0 {
+				key.WriteByte(c)
+			}
+		case 'B':
+			// Silent in a final -MB
+			if !(prev == 'M' && i == len(s)-1) {
+				key.WriteByte('B')
+			}
+		case 'C':
+			switch {
+			case next == 'I' && at(i+2) == 'A':
+				key.WriteByte('X')
+			case next == 'H':
+				if prev == 'S' {
+					key.WriteByte('K')
+				} else {
+					key.WriteByte('X')
+				}
+				i++
+			case next == 'I' || next == 'E' || next == 'Y':
+				if prev != 'S' {
+					key.WriteByte('S')
+				}
+			default:
+				key.WriteByte('K')
+			}
+		case 'D':
+			if next == 'G' && (at(i+2) == 'E' || at(i+2) == 'Y' || at(i+2) == 'I') {
+				key.WriteByte('J')
+				i++
+			} else {
+				key.WriteByte('T')
+			}
+		case 'G':
+			switch {
+			case next == 'H' && i+2 < len(s) && !isVowel(at(i+2)):
+				// Silent in -GH- before a consonant (night)
+			case next == 'N' && (i+2 == len(s) || (at(i+2) == 'E' && at(i+3) == 'D' && i+4 == len(s))):
+				// Silent in a final -GN or -GNED
+			case prev == 'D' && (next == 'E' || next == 'I' || next == 'Y'):
+				// Already sounded as the J of -DGE-
+			case next == 'E' || next == 'I' || next == 'Y':
+				key.WriteByte('J')
+			default:
+				key.WriteByte('K')
+			}
+		case 'H':
+			// Silent after a vowel with no vowel following, and after C, G, P, S, T
+			if isVowel(next) && !strings.ContainsRune("CGPST", rune(prev)) {
+				key.WriteByte('H')
+			}
+		case 'K':
+			if prev != 'C' {
+				key.WriteByte('K')
+			}
+		case 'P':
+			if next == 'H' {
+				key.WriteByte('F')
+			} else {
+				key.WriteByte('P')
+			}
+		case 'Q':
+			key.WriteByte('K')
+		case 'S':
+			switch {
+			case next == 'H':
+				key.WriteByte('X')
+				i++
+			case next == 'I' && (at(i+2) == 'O' || at(i+2) == 'A'):
+				key.WriteByte('X')
+			default:
+				key.WriteByte('S')
+			}
+		case 'T':
+			switch {
+			case next == 'I' && (at(i+2) == 'O' || at(i+2) == 'A'):
+				key.WriteByte('X')
+			case next == 'H':
+				key.WriteByte('0')
+				i++
+			case next == 'C' && at(i+2) == 'H':
+				// Silent in -TCH-
+			default:
+				key.WriteByte('T')
+			}
+		case 'V':
+			key.WriteByte('F')
+		case 'W', 'Y':
+			if isVowel(next) {
+				key.WriteByte(c)
+			}
+		case 'X':
+			key.WriteString("KS")
+		case 'Z':
+			key.WriteByte('S')
+		default:
+			// F, J, L, M, N, R
+			key.WriteByte(c)
+		}
+	}
+	return key.String()
+}
@@ -0,0 +1,147 @@
+// Package prefix identifies the country, continent, and ITU allocation of a
+// callsign prefix from tables embedded in the binary, so calls without a
+// license record in the database still say where they are from.
+package prefix
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"strings"
+)
+
+// MaxLength is the longest prefix in the tables; longer input is matched on
+// its first MaxLength characters
+const MaxLength = 4
+
+//go:embed itu.txt
+var ituTable string
+
+//go:embed entities.txt
+var entityTable string
+
+// Info describes what a prefix belongs to
+type Info struct {
+	// Prefix is the longest table entry that matched, e.g. KH6
+	Prefix string
+	// Country is the DXCC-style entity, e.g. Hawaii, falling back to the
+	// country the ITU series is allocated to
+	Country string
+	// Continent is AF, AN, AS, EU, NA, OC, or SA; empty for international
+	// organizations
+	Continent string
+	// ITUSeries is the ITU series the prefix is in, e.g. AA-AL
+	ITUSeries string
+	// ITUAllocation is the country the ITU series is allocated to
+	ITUAllocation string
+}
+
+// entry is a line of a table
+type entry struct {
+	series    string
+	continent string
+	name      string
+}
+
+var (
+	itu      = mustParse("itu.txt", ituTable)
+	entities = mustParse("entities.txt", entityTable)
+)
+
+// mustParse expands the prefixes and ranges of a table into a map. It panics
+// on a malformed line or a prefix listed twice, since the tables are built in.
+func mustParse(name, table string) map[string]*entry {
+	m := make(map[string]*entry)
+	scanner := bufio.NewScanner(strings.NewReader(table))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			panic(fmt.Sprintf("prefix: %s:%d: expected prefixes, continent, and name", name, n))
+		}
+		continent := fields[1]
+		if continent == "-" {
+			continent = ""
+		}
+		for _, series := range strings.Split(fields[0], ",") {
+			e := &entry{series: series, continent: continent, name: fields[2]}
+			prefixes, err := expand(series)
+			if err != nil {
+				panic(fmt.Sprintf("prefix: %s:%d: %v", name, n, err))
+			}
+			for _, p := range prefixes {
+				if _, ok := m[p]; ok {
+					panic(fmt.Sprintf("prefix: %s:%d: %s is listed twice", name, n, p))
+				}
+				m[p] = e
+			}
+		}
+	}
+	return m
+}
+
+// expand returns the prefixes in a series: itself, or for a range like
+// UA9-UI9 every prefix whose characters each fall between the two ends
+func expand(series string) ([]string, error) {
+	lo, hi, ok := strings.Cut(series, "-")
+	if !ok {
+		hi = lo
+	}
+	if lo == "" || len(lo) != len(hi) || len(lo) > MaxLength {
+		return nil, fmt.Errorf("invalid series %q", series)
+	}
+	prefixes := []string{""}
+	for i := 0; i < len(lo); i++ {
+		if lo[i] > hi[i] {
+			return nil, fmt.Errorf("invalid series %q", series)
+		}
+		next := make([]string, 0, len(prefixes)*int(hi[i]-lo[i]+1))
+		for _, p := range prefixes {
+			for c := lo[i]; c <= hi[i]; c++ {
+				next = append(next, p+string(c))
+			}
+		}
+		prefixes = next
+	}
+	return prefixes, nil
+}
+
+// longest returns the entry for the longest prefix of s in m
+func longest(m map[string]*entry, s string) (string, *entry) {
+	for n := min(len(s), MaxLength); n > 0; n-- {
+		if e, ok := m[s[:n]]; ok {
+			return s[:n], e
+		}
+	}
+	return "", nil
+}
+
+// Lookup returns what the upper-case prefix or callsign s belongs to, and
+// whether any table matched it
+func Lookup(s string) (Info, bool) {
+	ituPrefix, alloc := longest(itu, s)
+	entityPrefix, entity := longest(entities, s)
+	if alloc == nil && entity == nil {
+		return Info{}, false
+	}
+
+	var info Info
+	if alloc != nil {
+		info = Info{
+			Prefix:        ituPrefix,
+			Country:       alloc.name,
+			Continent:     alloc.continent,
+			ITUSeries:     alloc.series,
+			ITUAllocation: alloc.name,
+		}
+	}
+	if entity != nil {
+		info.Prefix = entityPrefix
+		info.Country = entity.name
+		info.Continent = entity.continent
+	}
+	return info, true
+}
@@ -0,0 +1,89 @@
+// Package redact withholds names and addresses from lookups (REDACT_NAMES,
+// REDACT_ADDRESSES). Redacted values are replaced in the query itself, so
+// they never leave the database layer, in the API and the CLI alike.
+package redact
+
+import (
+	"strings"
+)
+
+// Scope selects the records a redaction applies to: none, every record, or
+// the records of the listed countries
+type Scope struct {
+	all       bool
+	countries []string
+}
+
+// Config holds the fields withheld from lookups
+type Config struct {
+	// Addresses covers the street address and the coordinates geocoded from it
+	Addresses Scope
+	// Names covers first name, middle initial, last name, and suffix
+	Names Scope
+}
+
+// LoadConfig reads redaction settings from the environment. Each variable
+// is "true" to redact every record or a comma-separated list of countries
+// (e.g. "United Kingdom,Japan") to redact only theirs.
+func LoadConfig(getenv func(string) string) Config {
+	return Config{
+		Addresses: ParseScope(getenv("REDACT_ADDRESSES")),
+		Names:     ParseScope(getenv("REDACT_NAMES")),
+	}
+}
+
+// ParseScope parses a REDACT_* value
+func ParseScope(v string) Scope {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "", "0", "false", "no", "none":
+		return Scope{}
+	case "1", "true", "yes", "all", "*":
+		return Scope{all: true}
+	}
+	var s Scope
+	for _, country := range strings.Split(v, ",") {
+		if country = strings.TrimSpace(country); country != "" {
+			s.countries = append(s.countries, strings.ToUpper(country))
+		}
+	}
+	return s
+}
+
+// Column returns the SQL expression selecting column, or NULL for the
+// records in scope. country is the SQL expression for a record's country.
+func (s Scope) Column(column, country string) string {
+	if s.all {
+		return "NULL"
+	}
+	if len(s.countries) == 0 {
+		return column
+	}
+	quoted := make([]string, len(s.countries))
+	for i, c := range s.countries {
+		quoted[i] = "'" + strings.ReplaceAll(c, "'", "''") + "'"
+	}
+	return "CASE WHEN UPPER(" + country + ") IN (" + strings.Join(quoted, ", ") + ") THEN NULL ELSE " + column + " END"
+}
+
+// All reports whether every record is redacted
+func (s Scope) All() bool {
+	return s.all
+}
+
+// Enabled reports whether any record is redacted
+func (s Scope) Enabled() bool {
+	return s.all || len(s.countries) > 0
+}
+
+// Covers reports whether a record from country is redacted
+func (s Scope) Covers(country string) bool {
+	if s.all {
+		return true
+	}
+	for _, c := range s.countries {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// reader returns a connection that reads the canned reply
+func reader(reply string) *conn {
+	return &conn{r: bufio.NewReader(strings.NewReader(reply))}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  any
+		err   error
+	}{
+		{name: "status", reply: "+OK\r\n", want: "OK"},
+		{name: "empty status", reply: "+\r\n", want: ""},
+		{name: "error", reply: "-ERR unknown command\r\n", err: Error("ERR unknown command")},
+		{name: "integer", reply: ":42\r\n", want: int64(42)},
+		{name: "negative integer", reply: ":-3\r\n", want: int64(-3)},
+		{name: "bulk string", reply: "$5\r\nhello\r\n", want: []byte("hello")},
+		{name: "bulk string with CRLF", reply: "$7\r\nab\r\ncde\r\n", want: []byte("ab\r\ncde")},
+		{name: "empty bulk string", reply: "$0\r\n\r\n", want: []byte{}},
+		{name: "null bulk string", reply: "$-1\r\n", want: []byte(nil)},
+		{name: "empty array", reply: "*0\r\n", want: []any{}},
+		{name: "null array", reply: "*-1\r\n", want: []any(nil)},
+		{name: "array", reply: "*3\r\n:1\r\n$3\r\nfoo\r\n+OK\r\n", want: []any{int64(1), []byte("foo"), "OK"}},
+		{name: "array with null bulk string", reply: "*2\r\n$-1\r\n$1\r\nx\r\n", want: []any{[]byte(nil), []byte("x")}},
+		{name: "nested arrays", reply: "*2\r\n*2\r\n:1\r\n:2\r\n*1\r\n*0\r\n", want: []any{[]any{int64(1), int64(2)}, []any{[]any{}}}},
+		// A script's error reply inside an array is a value, and the items
+		// after it are still read
+		{name: "error in array", reply: "*3\r\n:1\r\n-ERR boom\r\n:3\r\n", want: []any{int64(1), Error("ERR boom"), int64(3)}},
+		{name: "error in nested array", reply: "*1\r\n*2\r\n-WRONGTYPE\r\n$-1\r\n", want: []any{[]any{Error("WRONGTYPE"), []byte(nil)}}},
+
+		{name: "empty line", reply: "\r\n", err: errMalformed},
+		{name: "bare LF", reply: "+OK\n", err: errMalformed},
+		{name: "unknown type", reply: "%1\r\n", err: errMalformed},
+		{name: "bad integer", reply: ":x\r\n", err: errMalformed},
+		{name: "bad bulk length", reply: "$abc\r\n", err: errMalformed},
+		{name: "negative bulk length", reply: "$-2\r\n", err: errMalformed},
+		{name: "huge bulk length", reply: "$99999999999\r\n", err: errMalformed},
+		{name: "bulk string too short", reply: "$5\r\nhi\r\n", err: io.ErrUnexpectedEOF},
+		{name: "bulk string too long", reply: "$2\r\nhello\r\n", err: errMalformed},
+		{name: "bad array length", reply: "*x\r\n", err: errMalformed},
+		{name: "negative array length", reply: "*-2\r\n", err: errMalformed},
+		// A huge length must not be allocated up front
+		{name: "huge array length", reply: "*99999999999\r\n:1\r\n", err: io.EOF},
+		{name: "array too short", reply: "*3\r\n:1\r\n:2\r\n", err: io.EOF},
+		{name: "malformed item", reply: "*2\r\n:1\r\n$x\r\n", err: errMalformed},
+		{name: "truncated", reply: "+OK", err: io.EOF},
+		{name: "nothing", reply: "", err: io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reader(tt.reply).read()
+			switch {
+			case tt.err == errMalformed:
+				var replyErr Error
+				if err == nil || errors.As(err, &replyErr) || !strings.HasPrefix(err.Error(), "redis: ") {
+					t.Fatalf("read = %#v, %v; want a malformed reply error", got, err)
+				}
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("read = %#v, %v; want %v", got, err, tt.err)
+				}
+			case err != nil:
+				t.Fatalf("read: %v", err)
+			case !reflect.DeepEqual(got, tt.want):
+				t.Errorf("read = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// errMalformed marks the cases expecting a protocol error, as opposed to
+// an error reply or a read error
+var errMalformed = errors.New("malformed")
+
+func TestReadSequence(t *testing.T) {
+	// Replies are read one at a time off the same connection
+	cn := reader("+OK\r\n$-1\r\n*1\r\n-ERR x\r\n:7\r\n")
+	want := []any{"OK", []byte(nil), []any{Error("ERR x")}, int64(7)}
+	for i, w := range want {
+		got, err := cn.read()
+		if err != nil {
+			t.Fatalf("reply %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("reply %d = %#v, want %#v", i, got, w)
+		}
+	}
+}
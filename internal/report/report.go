@@ -0,0 +1,273 @@
+// Package report builds the club-facing license reports (upgrades,
+// cancellations) shared by the API and the hamqrzdb command.
+package report
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/redact"
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// ErrNoHistory is returned for databases created before callsign_history
+var ErrNoHistory = errors.New("database has no history; run an importer to migrate it")
+
+// Default report periods in days
+const (
+	UpgradeDays      = 7
+	CancellationDays = 30
+)
+
+// MaxLimit caps the number of rows a report returns
+const MaxLimit = 10000
+
+// Filter selects the period and area a report covers. Dates are YYYY-MM-DD
+// and inclusive; Grid is a Maidenhead locator prefix such as EM10.
+type Filter struct {
+	Since string
+	Until string
+	State string
+	Grid  string
+	Limit int
+}
+
+// WithDefaults fills unset fields: a period covering the last days days up
+// to today, and 100 rows
+func (f Filter) WithDefaults(days int) Filter {
+	now := time.Now().UTC()
+	if f.Since == "" {
+		f.Since = now.AddDate(0, 0, -days).Format("2006-01-02")
+	}
+	if f.Until == "" {
+		f.Until = now.Format("2006-01-02")
+	}
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	if f.Limit > MaxLimit {
+		f.Limit = MaxLimit
+	}
+	f.State = strings.ToUpper(strings.TrimSpace(f.State))
+	f.Grid = strings.ToUpper(strings.TrimSpace(f.Grid))
+	return f
+}
+
+// Validate checks the filter's dates
+func (f Filter) Validate() error {
+	for name, v := range map[string]string{"since": f.Since, "until": f.Until} {
+		if v == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			return fmt.Errorf("%s must be a date (YYYY-MM-DD)", name)
+		}
+	}
+	if f.Limit < 0 || f.Limit > MaxLimit {
+		return fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+	}
+	return nil
+}
+
+// Upgrade is an operator class change
+type Upgrade struct {
+	Call      string `json:"call"`
+	FName     string `json:"fname"`
+	Name      string `json:"name"`
+	City      string `json:"city"`
+	State     string `json:"state"`
+	Grid      string `json:"grid"`
+	FromClass string `json:"from_class"`
+	ToClass   string `json:"to_class"`
+	ChangedAt string `json:"changed_at"`
+}
+
+// Cancellation is a license that was cancelled, expired, terminated, or revoked
+type Cancellation struct {
+	Call       string `json:"call"`
+	FName      string `json:"fname"`
+	Name       string `json:"name"`
+	City       string `json:"city"`
+	State      string `json:"state"`
+	Grid       string `json:"grid"`
+	Status     string `json:"status"`
+	Date       string `json:"date"`
+	DataSource string `json:"data_source"`
+}
+
+// inactiveStatuses are the license statuses reported as cancelled: FCC
+// cancelled, expired, and terminated, plus revoked from other sources
+const inactiveStatuses = "('C', 'E', 'T', 'R')"
+
+// fccClassRank orders FCC operator classes from Novice to Amateur Extra
+func fccClassRank(column string) string {
+	return "CASE " + column + " WHEN 'N' THEN 1 WHEN 'T' THEN 2 WHEN 'P' THEN 3 WHEN 'G' THEN 4 WHEN 'A' THEN 5 WHEN 'E' THEN 6 END"
+}
+
+// isoDate returns the YYYY-MM-DD form of a callsigns date column: its
+// indexed _iso twin, or a conversion of the raw column in databases that
+// haven't been migrated
+func isoDate(ctx context.Context, db *sql.DB, column string) (string, error) {
+	ok, err := schema.HasColumn(ctx, db, "callsigns", column+"_iso")
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return column + "_iso", nil
+	}
+	return schema.SourceISODate(column), nil
+}
+
+// sameLicense returns a condition matching callsign_history rows h to the
+// license of the callsigns record c, so a reissued callsign's record doesn't
+// pick up its previous license's history. Rows recorded before licenses were
+// tracked match any license.
+func sameLicense(ctx context.Context, db *sql.DB) (string, error) {
+	ok, err := schema.HasColumn(ctx, db, "callsign_history", "unique_system_identifier")
+	if err != nil || !ok {
+		return "1", err
+	}
+	return "(h.unique_system_identifier IS NULL OR h.unique_system_identifier IS c.unique_system_identifier)", nil
+}
+
+// names returns the SQL expressions for the first and last name of the
+// callsigns record c, blank where names withholds them
+func names(ctx context.Context, db *sql.DB, names redact.Scope) (first, last string, err error) {
+	hasCountry, err := schema.HasColumn(ctx, db, "callsigns", "country")
+	if err != nil {
+		return "", "", err
+	}
+	country := schema.CountryExpr(hasCountry)
+	return "COALESCE(" + names.Column("c.first_name", country) + ", '')",
+		"COALESCE(" + names.Column("c.last_name", country) + ", '')", nil
+}
+
+// Upgrades lists operators whose FCC class went up during the period,
+// newest first. Class changes come from callsign_history, so only updates
+// applied since the history was added are reported. Names in redaction's
+// scope are left blank.
+func Upgrades(ctx context.Context, db *sql.DB, redaction redact.Config, f Filter) ([]Upgrade, error) {
+	f = f.WithDefaults(UpgradeDays)
+	if ok, err := schema.HasTable(ctx, db, "callsign_history"); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrNoHistory
+	}
+	license, err := sameLicense(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	first, last, err := names(ctx, db, redaction.Names)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT h.callsign, `+first+`, `+last+`,
+			COALESCE(c.city, ''), COALESCE(c.state, ''), COALESCE(c.grid_square, ''),
+			h.old_value, h.new_value, h.changed_at
+		FROM callsign_history h
+		JOIN callsigns c ON c.callsign = h.callsign AND c.data_source = h.data_source AND `+license+`
+		WHERE h.field = 'operator_class'
+		  AND date(h.changed_at) BETWEEN ? AND ?
+		  AND `+fccClassRank("h.new_value")+` > `+fccClassRank("h.old_value")+`
+		  AND (? = '' OR UPPER(c.state) = ?)
+		  AND (? = '' OR UPPER(c.grid_square) LIKE ? || '%')
+		ORDER BY h.changed_at DESC, h.callsign
+		LIMIT ?
+	`, f.Since, f.Until, f.State, f.State, f.Grid, f.Grid, f.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("upgrade query failed: %w", err)
+	}
+	defer rows.Close()
+
+	upgrades := []Upgrade{}
+	for rows.Next() {
+		var u Upgrade
+		var changed sql.NullString
+		if err := rows.Scan(&u.Call, &u.FName, &u.Name, &u.City, &u.State, &u.Grid,
+			&u.FromClass, &u.ToClass, &changed); err != nil {
+			return nil, err
+		}
+		u.ChangedAt = changed.String
+		upgrades = append(upgrades, u)
+	}
+	return upgrades, rows.Err()
+}
+
+// Cancellations lists licenses that became inactive during the period,
+// newest first. A license counts if its status changed to inactive in an
+// update during the period (from callsign_history), or if it is inactive and
+// its cancellation date (or expiry date, for expired licenses) falls in the
+// period. The earliest of those dates is reported. Licenses that have since
+// been reinstated are left out. Names in redaction's scope are left blank.
+func Cancellations(ctx context.Context, db *sql.DB, redaction redact.Config, f Filter) ([]Cancellation, error) {
+	f = f.WithDefaults(CancellationDays)
+	if ok, err := schema.HasTable(ctx, db, "callsign_history"); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrNoHistory
+	}
+
+	cancelled, err := isoDate(ctx, db, "cancellation_date")
+	if err != nil {
+		return nil, err
+	}
+	expired, err := isoDate(ctx, db, "expired_date")
+	if err != nil {
+		return nil, err
+	}
+	first, last, err := names(ctx, db, redaction.Names)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		WITH events (callsign, data_source, event_date) AS (
+			SELECT callsign, data_source, date(changed_at)
+			FROM callsign_history
+			WHERE field = 'license_status' AND new_value IN `+inactiveStatuses+`
+			  AND date(changed_at) BETWEEN ?1 AND ?2
+			UNION ALL
+			SELECT callsign, data_source, `+cancelled+`
+			FROM callsigns
+			WHERE license_status IN ('C', 'T', 'R')
+			  AND `+cancelled+` BETWEEN ?1 AND ?2
+			UNION ALL
+			SELECT callsign, data_source, `+expired+`
+			FROM callsigns
+			WHERE license_status = 'E'
+			  AND `+expired+` BETWEEN ?1 AND ?2
+		)
+		SELECT c.callsign, `+first+`, `+last+`,
+			COALESCE(c.city, ''), COALESCE(c.state, ''), COALESCE(c.grid_square, ''),
+			c.license_status, MIN(e.event_date) AS event_date, c.data_source
+		FROM events e
+		JOIN callsigns c ON c.callsign = e.callsign AND c.data_source = e.data_source
+		WHERE c.license_status IN `+inactiveStatuses+`
+		  AND (?3 = '' OR UPPER(c.state) = ?3)
+		  AND (?4 = '' OR UPPER(c.grid_square) LIKE ?4 || '%')
+		GROUP BY c.callsign, c.data_source
+		ORDER BY event_date DESC, c.callsign
+		LIMIT ?5
+	`, f.Since, f.Until, f.State, f.Grid, f.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("cancellation query failed: %w", err)
+	}
+	defer rows.Close()
+
+	cancellations := []Cancellation{}
+	for rows.Next() {
+		var c Cancellation
+		if err := rows.Scan(&c.Call, &c.FName, &c.Name, &c.City, &c.State, &c.Grid,
+			&c.Status, &c.Date, &c.DataSource); err != nil {
+			return nil, err
+		}
+		cancellations = append(cancellations, c)
+	}
+	return cancellations, rows.Err()
+}
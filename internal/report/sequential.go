@@ -0,0 +1,205 @@
+package report
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/callsign"
+)
+
+// SequentialDays is the default period of grants a forecast is based on
+const SequentialDays = 30
+
+// MaxForecast caps how many upcoming callsigns a forecast lists per region
+// and group
+const MaxForecast = 50
+
+// Forecast estimates the next callsigns the FCC's sequential system will
+// issue in a region and operator class group
+type Forecast struct {
+	Region     int    `json:"region"`
+	RegionName string `json:"region_name"`
+	Group      string `json:"group"`
+	// LastIssued is the furthest call along the sequence granted in the
+	// period
+	LastIssued string `json:"last_issued"`
+	// Issued counts the sequential grants in the period, and PerDay is
+	// their average rate
+	Issued int     `json:"issued"`
+	PerDay float64 `json:"per_day"`
+	// Next are the calls expected to follow LastIssued, skipping any already
+	// in the database and any the FCC doesn't issue
+	Next []string `json:"next"`
+}
+
+// sequenceFirstLetters are the first letters a group's formats cycle
+// through, in order, once a prefix's suffixes run out. Group A's sequence
+// is down to its AA-AK 2x2 calls.
+var sequenceFirstLetters = map[string]string{
+	"A": "A",
+	"B": "KNW",
+	"C": "KNW",
+	"D": "KW",
+}
+
+// SequentialForecast estimates, for each region and group with sequential
+// grants in the period (FCC radio service HA, so vanity grants are left
+// out), the next count callsigns to be issued
+func SequentialForecast(ctx context.Context, db *sql.DB, f Filter, count int) ([]Forecast, error) {
+	f = f.WithDefaults(SequentialDays)
+	if count <= 0 {
+		count = 5
+	}
+	if count > MaxForecast {
+		count = MaxForecast
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT DISTINCT callsign
+		FROM callsigns
+		WHERE radio_service_code = 'HA'
+		  AND licensed_since BETWEEN ? AND ?
+	`, f.Since, f.Until)
+	if err != nil {
+		return nil, fmt.Errorf("sequential grant query failed: %w", err)
+	}
+	defer rows.Close()
+
+	type key struct {
+		region int
+		group  string
+	}
+	seqs := map[key]*Forecast{}
+	for rows.Next() {
+		var call string
+		if err := rows.Scan(&call); err != nil {
+			return nil, err
+		}
+		// 1x1 calls are lent out for events, not issued in sequence
+		us, err := callsign.ParseUS(call)
+		if err != nil || us.Group == callsign.GroupSpecialEvent {
+			continue
+		}
+		k := key{us.Region, us.Group}
+		fc := seqs[k]
+		if fc == nil {
+			fc = &Forecast{Region: us.Region, RegionName: us.RegionName, Group: us.Group}
+			seqs[k] = fc
+		}
+		fc.Issued++
+		if sequenceLess(fc.LastIssued, call) {
+			fc.LastIssued = call
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	days := 1.0
+	if since, err := time.Parse("2006-01-02", f.Since); err == nil {
+		if until, err := time.Parse("2006-01-02", f.Until); err == nil {
+			days = until.Sub(since).Hours()/24 + 1
+		}
+	}
+
+	forecasts := make([]Forecast, 0, len(seqs))
+	for _, fc := range seqs {
+		fc.PerDay = math.Round(float64(fc.Issued)/days*100) / 100
+		if fc.Next, err = nextSequential(ctx, db, fc.LastIssued, count); err != nil {
+			return nil, err
+		}
+		forecasts = append(forecasts, *fc)
+	}
+	sort.Slice(forecasts, func(i, j int) bool {
+		if forecasts[i].Region != forecasts[j].Region {
+			return forecasts[i].Region < forecasts[j].Region
+		}
+		return forecasts[i].Group < forecasts[j].Group
+	})
+	if len(forecasts) > f.Limit {
+		forecasts = forecasts[:f.Limit]
+	}
+	return forecasts, nil
+}
+
+// sequenceLess reports whether call a comes before b in the sequence of
+// their group: shorter formats first, then in order of prefix and suffix.
+// "" comes before every call.
+func sequenceLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// nextSequential returns the count calls that follow last in its region and
+// group, skipping calls the FCC doesn't issue and calls already in the
+// database
+func nextSequential(ctx context.Context, db *sql.DB, last string, count int) ([]string, error) {
+	us, err := callsign.ParseUS(last)
+	if err != nil {
+		return nil, err
+	}
+	next := []string{}
+	call := last
+	// Bound the search, in case a region's sequence is exhausted
+	for tries := 0; len(next) < count && tries < 100000; tries++ {
+		if call = successor(call, sequenceFirstLetters[us.Group], us.Region > 10); call == "" {
+			break
+		}
+		c, err := callsign.ParseUS(call)
+		if err != nil || c.Region != us.Region || c.Group != us.Group {
+			continue
+		}
+		var exists bool
+		if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM callsigns WHERE callsign = ?)`, call).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			next = append(next, call)
+		}
+	}
+	return next, nil
+}
+
+// successor returns the call after call in the same format: the suffix
+// counts up from AAA to ZZZ, then the prefix's second letter (KA, KB, ...
+// KZ, skipping the H, L, and P of regions 11-13) and then its first letter
+// through firstLetters (K, N, W). Calls of regions 11-13 (regional) keep
+// their second letter. It returns "" at the end of the sequence.
+func successor(call, firstLetters string, regional bool) string {
+	digit := strings.IndexAny(call, "0123456789")
+	if digit < 0 {
+		return ""
+	}
+	b := []byte(call)
+	// Suffix, right to left
+	for i := len(b) - 1; i > digit; i-- {
+		if b[i] < 'Z' {
+			b[i]++
+			return string(b)
+		}
+		b[i] = 'A'
+	}
+	// Second prefix letter
+	if digit == 2 && !regional {
+		for b[1] < 'Z' {
+			b[1]++
+			if !strings.ContainsRune("HLP", rune(b[1])) {
+				return string(b)
+			}
+		}
+		b[1] = 'A'
+	}
+	// First prefix letter
+	if i := strings.IndexByte(firstLetters, b[0]); i >= 0 && i+1 < len(firstLetters) {
+		b[0] = firstLetters[i+1]
+		return string(b)
+	}
+	return ""
+}
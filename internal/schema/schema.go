@@ -0,0 +1,747 @@
+// Package schema owns the SQLite schema shared by the importers and the API,
+// including the migrations applied to databases created by older versions.
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/fuzzy"
+)
+
+// Version is the schema version written to PRAGMA user_version. Bump it
+// whenever the DDL or migrations below change.
+const Version = 30
+
+// callsignsDDL creates the callsigns table. A callsign can hold one record
+// per data source, e.g. a US grant and an imported foreign licence for the
+// same string. data_source is empty for records of unknown origin.
+const callsignsDDL = `
+CREATE TABLE IF NOT EXISTS callsigns (
+	callsign TEXT NOT NULL,
+	unique_system_identifier TEXT,
+	license_status TEXT,
+	radio_service_code TEXT,
+	grant_date TEXT,
+	expired_date TEXT,
+	cancellation_date TEXT,
+	effective_date TEXT,
+	last_action_date TEXT,
+	grant_date_iso TEXT,
+	expired_date_iso TEXT,
+	cancellation_date_iso TEXT,
+	effective_date_iso TEXT,
+	last_action_date_iso TEXT,
+	operator_class TEXT,
+	group_code TEXT,
+	region_code TEXT,
+	first_name TEXT,
+	mi TEXT,
+	last_name TEXT,
+	suffix TEXT,
+	entity_name TEXT,
+	entity_type TEXT,
+	street_address TEXT,
+	city TEXT,
+	state TEXT,
+	zip_code TEXT,
+	latitude REAL,
+	longitude REAL,
+	grid_square TEXT,
+	country TEXT,
+	data_source TEXT NOT NULL DEFAULT '',
+	import_batch INTEGER,
+	licensed_since TEXT,
+	frn TEXT,
+	name_soundex TEXT,
+	name_metaphone TEXT,
+	last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (callsign, data_source)
+);
+`
+
+// licensesDDL creates the licenses table, every ULS license the importer
+// has loaded, keyed on its unique system identifier (USI). service is the
+// data source of the table the license is published to (FCC for callsigns,
+// or a non-amateur service). A callsign can be on several licenses, since
+// the FCC reissues callsigns once a license expires or a vanity change
+// releases them; callsigns and the service tables hold each callsign's
+// current license only.
+const licensesDDL = `
+CREATE TABLE IF NOT EXISTS licenses (
+	unique_system_identifier TEXT PRIMARY KEY,
+	service TEXT NOT NULL,
+	callsign TEXT NOT NULL,
+	license_status TEXT,
+	radio_service_code TEXT,
+	grant_date TEXT,
+	expired_date TEXT,
+	cancellation_date TEXT,
+	effective_date TEXT,
+	last_action_date TEXT,
+	operator_class TEXT,
+	group_code TEXT,
+	region_code TEXT,
+	first_name TEXT,
+	mi TEXT,
+	last_name TEXT,
+	suffix TEXT,
+	entity_name TEXT,
+	entity_type TEXT,
+	street_address TEXT,
+	city TEXT,
+	state TEXT,
+	zip_code TEXT,
+	latitude REAL,
+	longitude REAL,
+	grid_square TEXT,
+	frn TEXT,
+	import_batch INTEGER,
+	last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// LicenseServices maps the data sources of licenses.service to the tables
+// their current licenses are published to
+var LicenseServices = map[string]string{
+	"FCC":  "callsigns",
+	"GMRS": "gmrs_licenses",
+	"COML": "commercial_licenses",
+}
+
+// ddl creates every table and index. Statements must be idempotent.
+const ddl = callsignsDDL + `
+
+CREATE INDEX IF NOT EXISTS idx_callsign ON callsigns(callsign);
+CREATE INDEX IF NOT EXISTS idx_status ON callsigns(license_status);
+CREATE INDEX IF NOT EXISTS idx_data_source ON callsigns(data_source, import_batch);
+CREATE INDEX IF NOT EXISTS idx_licensed_since ON callsigns(licensed_since);
+CREATE INDEX IF NOT EXISTS idx_expired_date_iso ON callsigns(expired_date_iso);
+CREATE INDEX IF NOT EXISTS idx_cancellation_date_iso ON callsigns(cancellation_date_iso);
+CREATE INDEX IF NOT EXISTS idx_frn ON callsigns(frn);
+CREATE INDEX IF NOT EXISTS idx_usi ON callsigns(unique_system_identifier);
+CREATE INDEX IF NOT EXISTS idx_location ON callsigns(latitude, longitude);
+CREATE INDEX IF NOT EXISTS idx_zip ON callsigns(zip_code COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS idx_street ON callsigns(street_address COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS idx_name_soundex ON callsigns(name_soundex);
+CREATE INDEX IF NOT EXISTS idx_name_metaphone ON callsigns(name_metaphone);
+
+-- Phonetic keys are computed in Go when a batch finishes (see
+-- batch.FillPhoneticKeys); a name change clears them so they're recomputed
+CREATE TRIGGER IF NOT EXISTS trg_phonetic_reset AFTER UPDATE OF last_name, entity_name ON callsigns
+WHEN OLD.last_name IS NOT NEW.last_name OR OLD.entity_name IS NOT NEW.entity_name
+BEGIN
+	UPDATE callsigns SET name_soundex = NULL, name_metaphone = NULL
+	WHERE callsign = NEW.callsign AND data_source = NEW.data_source;
+END;
+
+CREATE TABLE IF NOT EXISTS import_batches (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	data_source TEXT NOT NULL,
+	detail TEXT,
+	started_at TIMESTAMP NOT NULL,
+	finished_at TIMESTAMP,
+	status TEXT NOT NULL,
+	records INTEGER,
+	added INTEGER,
+	pruned INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS special_conditions (
+	callsign TEXT NOT NULL,
+	unique_system_identifier TEXT,
+	condition_type TEXT,
+	condition_id TEXT NOT NULL,
+	sequence_number INTEGER NOT NULL,
+	condition_text TEXT,
+	status_code TEXT,
+	status_date TEXT,
+	PRIMARY KEY (callsign, condition_id, sequence_number)
+);
+
+CREATE TABLE IF NOT EXISTS comments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	callsign TEXT NOT NULL,
+	unique_system_identifier TEXT,
+	comment_date TEXT,
+	description TEXT,
+	status_code TEXT,
+	status_date TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_callsign ON comments(callsign);
+
+CREATE TABLE IF NOT EXISTS callsign_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	callsign TEXT NOT NULL,
+	data_source TEXT NOT NULL DEFAULT '',
+	unique_system_identifier TEXT,
+	field TEXT NOT NULL,
+	old_value TEXT,
+	new_value TEXT,
+	import_batch INTEGER,
+	changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_history_callsign ON callsign_history(callsign, field);
+CREATE INDEX IF NOT EXISTS idx_history_changed ON callsign_history(field, changed_at);
+
+CREATE TABLE IF NOT EXISTS special_events (
+	callsign TEXT NOT NULL,
+	start_date TEXT NOT NULL,
+	end_date TEXT,
+	event_name TEXT,
+	trustee TEXT,
+	coordinator TEXT,
+	city TEXT,
+	state TEXT,
+	last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (callsign, start_date)
+);
+
+CREATE TABLE IF NOT EXISTS gmrs_licenses (
+	callsign TEXT PRIMARY KEY,
+	unique_system_identifier TEXT,
+	license_status TEXT,
+	radio_service_code TEXT,
+	grant_date TEXT,
+	expired_date TEXT,
+	cancellation_date TEXT,
+	effective_date TEXT,
+	last_action_date TEXT,
+	grant_date_iso TEXT,
+	expired_date_iso TEXT,
+	cancellation_date_iso TEXT,
+	effective_date_iso TEXT,
+	last_action_date_iso TEXT,
+	frn TEXT,
+	entity_name TEXT,
+	entity_type TEXT,
+	first_name TEXT,
+	mi TEXT,
+	last_name TEXT,
+	suffix TEXT,
+	street_address TEXT,
+	city TEXT,
+	state TEXT,
+	zip_code TEXT,
+	import_batch INTEGER,
+	licensed_since TEXT,
+	last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_gmrs_frn ON gmrs_licenses(frn);
+CREATE INDEX IF NOT EXISTS idx_gmrs_usi ON gmrs_licenses(unique_system_identifier);
+
+CREATE TABLE IF NOT EXISTS commercial_licenses (
+	callsign TEXT PRIMARY KEY,
+	unique_system_identifier TEXT,
+	license_status TEXT,
+	radio_service_code TEXT,
+	grant_date TEXT,
+	expired_date TEXT,
+	cancellation_date TEXT,
+	effective_date TEXT,
+	last_action_date TEXT,
+	grant_date_iso TEXT,
+	expired_date_iso TEXT,
+	cancellation_date_iso TEXT,
+	effective_date_iso TEXT,
+	last_action_date_iso TEXT,
+	frn TEXT,
+	entity_name TEXT,
+	entity_type TEXT,
+	first_name TEXT,
+	mi TEXT,
+	last_name TEXT,
+	suffix TEXT,
+	street_address TEXT,
+	city TEXT,
+	state TEXT,
+	zip_code TEXT,
+	import_batch INTEGER,
+	licensed_since TEXT,
+	last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_commercial_frn ON commercial_licenses(frn);
+CREATE INDEX IF NOT EXISTS idx_commercial_usi ON commercial_licenses(unique_system_identifier);
+
+` + licensesDDL + `
+CREATE INDEX IF NOT EXISTS idx_licenses_callsign ON licenses(service, callsign);
+CREATE INDEX IF NOT EXISTS idx_licenses_batch ON licenses(import_batch);
+
+CREATE TABLE IF NOT EXISTS repeaters (
+	callsign TEXT NOT NULL,
+	trustee TEXT NOT NULL,
+	frequency REAL NOT NULL,
+	input_frequency REAL,
+	tone TEXT,
+	mode TEXT,
+	access TEXT,
+	status TEXT,
+	city TEXT,
+	county TEXT,
+	state TEXT,
+	country TEXT,
+	latitude REAL,
+	longitude REAL,
+	last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (callsign, frequency)
+);
+
+CREATE INDEX IF NOT EXISTS idx_repeaters_trustee ON repeaters(trustee);
+
+CREATE TABLE IF NOT EXISTS eqsl_ag (
+	callsign TEXT PRIMARY KEY,
+	last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS memberships (
+	organization TEXT NOT NULL,
+	callsign TEXT NOT NULL,
+	number TEXT NOT NULL,
+	name TEXT,
+	since TEXT,
+	last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (organization, callsign)
+);
+
+CREATE INDEX IF NOT EXISTS idx_memberships_callsign ON memberships(callsign);
+
+CREATE TABLE IF NOT EXISTS program_references (
+	program TEXT NOT NULL,
+	callsign TEXT NOT NULL,
+	reference TEXT NOT NULL,
+	name TEXT,
+	activations INTEGER NOT NULL DEFAULT 0,
+	last_activity TEXT,
+	last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (program, callsign, reference)
+);
+
+CREATE INDEX IF NOT EXISTS idx_program_references_callsign ON program_references(callsign);
+
+CREATE TABLE IF NOT EXISTS exam_sessions (
+	source TEXT NOT NULL,
+	session_date TEXT NOT NULL,
+	start_time TEXT NOT NULL DEFAULT '',
+	location TEXT NOT NULL DEFAULT '',
+	team TEXT,
+	address TEXT,
+	city TEXT,
+	state TEXT,
+	zip_code TEXT,
+	contact TEXT,
+	phone TEXT,
+	email TEXT,
+	walk_ins TEXT,
+	latitude REAL,
+	longitude REAL,
+	last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (source, session_date, start_time, location)
+);
+
+CREATE INDEX IF NOT EXISTS idx_exam_sessions_date ON exam_sessions(session_date);
+
+CREATE TABLE IF NOT EXISTS callsign_trigrams (
+	trigram TEXT NOT NULL,
+	callsign TEXT NOT NULL,
+	PRIMARY KEY (trigram, callsign)
+) WITHOUT ROWID;
+
+CREATE TABLE IF NOT EXISTS shards (
+	id INTEGER PRIMARY KEY,
+	file TEXT NOT NULL,
+	chars TEXT NOT NULL,
+	built_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS overrides (
+	callsign TEXT PRIMARY KEY,
+	preferred_name TEXT,
+	qsl_manager TEXT,
+	grid_square TEXT,
+	last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS clubs (
+	callsign TEXT PRIMARY KEY,
+	name TEXT,
+	website TEXT,
+	meeting TEXT,
+	repeater TEXT,
+	email TEXT,
+	notes TEXT,
+	last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// HistoryFields are the callsigns columns whose changes are recorded in
+// callsign_history. Only changes from a non-empty value are kept, so the
+// initial load of a record doesn't add a history row per callsign.
+var HistoryFields = []string{"operator_class", "license_status"}
+
+// historyTriggers returns the triggers that record HistoryFields changes.
+// Every importer writes through UPDATE or upsert, so triggers see them all.
+// A record switching to another ULS license (a reissued callsign) starts a
+// new history rather than recording the previous holder's values as changes.
+func historyTriggers() string {
+	var b strings.Builder
+	for _, f := range HistoryFields {
+		fmt.Fprintf(&b, `
+CREATE TRIGGER IF NOT EXISTS trg_history_%[1]s AFTER UPDATE OF %[1]s ON callsigns
+WHEN COALESCE(OLD.%[1]s, '') != '' AND COALESCE(OLD.%[1]s, '') != COALESCE(NEW.%[1]s, '')
+	AND (OLD.unique_system_identifier IS NULL OR OLD.unique_system_identifier IS NEW.unique_system_identifier)
+BEGIN
+	INSERT INTO callsign_history (callsign, data_source, unique_system_identifier, field, old_value, new_value, import_batch)
+	VALUES (NEW.callsign, NEW.data_source, NEW.unique_system_identifier, '%[1]s', OLD.%[1]s, NEW.%[1]s, NEW.import_batch);
+END;
+`, f)
+	}
+	return b.String()
+}
+
+// dropHistoryTriggers drops the historyTriggers, for Ensure to recreate
+func dropHistoryTriggers() string {
+	var b strings.Builder
+	for _, f := range HistoryFields {
+		fmt.Fprintf(&b, "DROP TRIGGER IF EXISTS trg_history_%s;\n", f)
+	}
+	return b.String()
+}
+
+// trigramSelect selects the (trigram, callsign) rows of the fuzzy.Trigrams
+// padding ("^^CALL$") for the callsign expression call, reading from the
+// tables in from (e.g. "callsigns c, ") if it's not a trigger's NEW row.
+// json_each stands in for a series, since triggers can't use recursive CTEs.
+func trigramSelect(call, from string) string {
+	positions := make([]string, fuzzy.MaxCallsignLength+1)
+	for i := range positions {
+		positions[i] = strconv.Itoa(i + 1)
+	}
+	return fmt.Sprintf(`SELECT substr('^^' || UPPER(%[1]s) || '$', p.value, 3), %[1]s
+	FROM %[3]sjson_each('[%[2]s]') p
+	WHERE p.value <= length(%[1]s) + 1`, call, strings.Join(positions, ","), from)
+}
+
+// trigramTriggers keep callsign_trigrams in step with callsigns. Callsigns
+// are only inserted or deleted (upserts update other columns), and a
+// callsign keeps its trigrams while any data source still has a record.
+func trigramTriggers() string {
+	return `
+CREATE TRIGGER IF NOT EXISTS trg_trigrams_insert AFTER INSERT ON callsigns
+BEGIN
+	INSERT OR IGNORE INTO callsign_trigrams (trigram, callsign)
+	` + trigramSelect("NEW.callsign", "") + `;
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_trigrams_delete AFTER DELETE ON callsigns
+WHEN NOT EXISTS (SELECT 1 FROM callsigns WHERE callsign = OLD.callsign)
+BEGIN
+	DELETE FROM callsign_trigrams WHERE callsign = OLD.callsign;
+END;
+`
+}
+
+// column is a column added to an existing table after its initial release.
+// backfill, if set, runs once right after the column is added.
+type column struct {
+	table    string
+	name     string
+	decl     string
+	backfill string
+}
+
+// addedColumns are applied with ALTER TABLE to databases created before the
+// column existed. New databases get them from ddl directly.
+var addedColumns = slices.Concat([]column{
+	{"callsigns", "country", "TEXT", ""},
+	// Records imported before source tracking are attributed by service code;
+	// anything unrecognized is left without a source so no re-import prunes it
+	{"callsigns", "data_source", "TEXT", `UPDATE callsigns SET data_source = CASE radio_service_code
+		WHEN 'HA' THEN 'FCC' WHEN 'HV' THEN 'FCC' WHEN 'UK' THEN 'OFCOM' WHEN 'NZ' THEN 'RSM' WHEN 'JP' THEN 'MIC' END`},
+	{"callsigns", "import_batch", "INTEGER", ""},
+	{"callsigns", "licensed_since", "TEXT", "UPDATE callsigns SET licensed_since = " + SourceISODate("grant_date")},
+	{"callsigns", "frn", "TEXT", ""},
+	{"callsigns", "name_soundex", "TEXT", ""},
+	{"callsigns", "name_metaphone", "TEXT", ""},
+	// The ULS EN entity type the name and address came from
+	{"callsigns", "entity_type", "TEXT", ""},
+	{"gmrs_licenses", "entity_type", "TEXT", ""},
+	{"commercial_licenses", "entity_type", "TEXT", ""},
+	// The ULS license a record describes, so a reissued callsign doesn't
+	// merge with its previous license
+	{"callsigns", "unique_system_identifier", "TEXT", ""},
+	{"gmrs_licenses", "unique_system_identifier", "TEXT", ""},
+	{"commercial_licenses", "unique_system_identifier", "TEXT", ""},
+	// The triggers of older databases don't fill it; Ensure recreates them
+	{"callsign_history", "unique_system_identifier", "TEXT", dropHistoryTriggers()},
+	// How many of a batch's records were new rather than updated
+	{"import_batches", "added", "INTEGER", ""},
+},
+	dateColumns("callsigns", SourceISODate),
+	// The service tables hold FCC licenses only
+	dateColumns("gmrs_licenses", fccISODate),
+	dateColumns("commercial_licenses", fccISODate),
+)
+
+// DateColumns are the raw date columns of callsigns and the service tables,
+// stored as each source publishes them. Each has an "_iso" twin holding the
+// date as YYYY-MM-DD (or NULL), filled when an import batch finishes, which
+// sorts and compares correctly. effective_date and last_action_date come
+// from the ULS only.
+var DateColumns = []string{"grant_date", "expired_date", "cancellation_date", "effective_date", "last_action_date"}
+
+// dateColumns returns table's DateColumns that may be missing, each followed
+// by its _iso twin, backfilled with the conversion iso returns
+func dateColumns(table string, iso func(column string) string) []column {
+	var cols []column
+	for _, c := range DateColumns {
+		cols = append(cols,
+			column{table, c, "TEXT", ""},
+			column{table, c + "_iso", "TEXT", fmt.Sprintf("UPDATE %s SET %s_iso = %s", table, c, iso(c))})
+	}
+	return cols
+}
+
+func fccISODate(column string) string {
+	return ISODate(column, true)
+}
+
+// ISODate returns an SQL expression converting column to YYYY-MM-DD, or NULL
+// if it isn't a recognized date. ISO dates pass through; with fcc set the
+// FCC's MM/DD/YYYY is converted too. Other sources' slashed dates may be
+// day-first, so they aren't guessed at.
+func ISODate(column string, fcc bool) string {
+	us := ""
+	if fcc {
+		us = fmt.Sprintf(`
+		WHEN %[1]s GLOB '[0-9][0-9]/[0-9][0-9]/[0-9][0-9][0-9][0-9]'
+			THEN substr(%[1]s, 7, 4) || '-' || substr(%[1]s, 1, 2) || '-' || substr(%[1]s, 4, 2)`, column)
+	}
+	return fmt.Sprintf(`CASE%[2]s
+		WHEN %[1]s GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]*'
+			THEN substr(%[1]s, 1, 10)
+		END`, column, us)
+}
+
+// SourceISODate is ISODate for a callsigns column, using each record's
+// data_source to decide whether slashed dates are the FCC's
+func SourceISODate(column string) string {
+	return "CASE WHEN data_source = 'FCC' THEN " + ISODate(column, true) +
+		" ELSE " + ISODate(column, false) + " END"
+}
+
+// CountryExpr returns the SQL expression for a callsigns row's country.
+// Databases without the country column fall back to the radio service code.
+func CountryExpr(hasCountry bool) string {
+	fallback := "CASE radio_service_code WHEN 'UK' THEN 'United Kingdom' WHEN 'NZ' THEN 'New Zealand' WHEN 'JP' THEN 'Japan' ELSE 'United States' END"
+	if hasCountry {
+		return "COALESCE(NULLIF(country, ''), " + fallback + ")"
+	}
+	return fallback
+}
+
+// Ensure creates any missing tables, applies migrations, and records the
+// schema version. db must be writable.
+func Ensure(ctx context.Context, db *sql.DB) error {
+	log.Println("Creating/verifying database schema...")
+
+	// Add columns before running the DDL so indexes on new columns can be created
+	for _, c := range addedColumns {
+		exists, err := HasTable(ctx, db, c.table)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		has, err := HasColumn(ctx, db, c.table, c.name)
+		if err != nil {
+			return err
+		}
+		if has {
+			continue
+		}
+		log.Printf("Migrating: adding %s.%s", c.table, c.name)
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.name, c.decl)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", c.table, c.name, err)
+		}
+		if c.backfill != "" {
+			if _, err := db.ExecContext(ctx, c.backfill); err != nil {
+				return fmt.Errorf("failed to backfill %s.%s: %w", c.table, c.name, err)
+			}
+		}
+	}
+
+	if err := migrateCallsignsKey(ctx, db); err != nil {
+		return err
+	}
+
+	hadTrigrams, err := HasTable(ctx, db, "callsign_trigrams")
+	if err != nil {
+		return err
+	}
+	hadLicenses, err := HasTable(ctx, db, "licenses")
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, ddl+historyTriggers()+trigramTriggers()); err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	if !hadTrigrams {
+		log.Println("Migrating: indexing callsign trigrams")
+		if _, err := db.ExecContext(ctx, `INSERT OR IGNORE INTO callsign_trigrams (trigram, callsign)
+			`+trigramSelect("c.callsign", "(SELECT DISTINCT callsign FROM callsigns) c, ")); err != nil {
+			return fmt.Errorf("failed to index callsign trigrams: %w", err)
+		}
+	}
+
+	if !hadLicenses {
+		if err := backfillLicenses(ctx, db); err != nil {
+			return err
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", Version)); err != nil {
+		return fmt.Errorf("failed to set schema version: %w", err)
+	}
+
+	log.Println("Database schema ready")
+	return nil
+}
+
+// migrateCallsignsKey rebuilds a callsigns table keyed on callsign alone
+// (schema version 5 and earlier) with the (callsign, data_source) key.
+// SQLite can't alter a primary key, so the table is copied.
+func migrateCallsignsKey(ctx context.Context, db *sql.DB) error {
+	exists, err := HasTable(ctx, db, "callsigns")
+	if err != nil || !exists {
+		return err
+	}
+	var keyColumns int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info('callsigns') WHERE pk > 0").Scan(&keyColumns); err != nil {
+		return fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	if keyColumns != 1 {
+		return nil
+	}
+
+	log.Println("Migrating: keying callsigns on (callsign, data_source); this may take a while")
+
+	rows, err := db.QueryContext(ctx, "SELECT name FROM pragma_table_info('callsigns')")
+	if err != nil {
+		return fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	var columns, values []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		columns = append(columns, name)
+		if name == "data_source" {
+			values = append(values, "COALESCE(data_source, '')")
+		} else {
+			values = append(values, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmts := []string{
+		"ALTER TABLE callsigns RENAME TO callsigns_old",
+		callsignsDDL,
+		fmt.Sprintf("INSERT INTO callsigns (%s) SELECT %s FROM callsigns_old",
+			strings.Join(columns, ", "), strings.Join(values, ", ")),
+		"DROP TABLE callsigns_old",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to migrate callsigns key: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// backfillLicenses fills a new licenses table from the records of the
+// tables licenses are published to that know their license. Records loaded
+// before USIs were stored get theirs, and a license, from their next HD row.
+func backfillLicenses(ctx context.Context, db *sql.DB) error {
+	for source, table := range LicenseServices {
+		var columns []string
+		rows, err := db.QueryContext(ctx, `
+			SELECT t.name FROM pragma_table_info(?) t
+			JOIN pragma_table_info('licenses') l ON l.name = t.name
+			WHERE t.name != 'last_updated'
+		`, table)
+		if err != nil {
+			return fmt.Errorf("failed to inspect schema: %w", err)
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			columns = append(columns, name)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		where := "unique_system_identifier IS NOT NULL AND unique_system_identifier != ''"
+		if table == "callsigns" {
+			where += " AND data_source = 'FCC'"
+		}
+		list := strings.Join(columns, ", ")
+		res, err := db.ExecContext(ctx, fmt.Sprintf(
+			"INSERT OR IGNORE INTO licenses (service, %[1]s) SELECT ?, %[1]s FROM %[2]s WHERE %[3]s",
+			list, table, where), source)
+		if err != nil {
+			return fmt.Errorf("failed to backfill licenses from %s: %w", table, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			log.Printf("Migrating: recorded %d %s licenses", n, source)
+		}
+	}
+	return nil
+}
+
+// HasTable reports whether a table exists
+func HasTable(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	return n > 0, nil
+}
+
+// HasColumn reports whether table has the named column
+func HasColumn(ctx context.Context, db *sql.DB, table, name string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, name).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,306 @@
+// Package shard splits the callsign tables of a database across several
+// SQLite files by the first character of the callsign. The main database
+// keeps everything else and a shards table listing the files; connections
+// opened with Attach see the shards through temporary views named after the
+// tables, so queries written against a single file work unchanged. Only
+// reads are sharded: the shards are copies rebuilt from the main database,
+// which importers keep writing to.
+package shard
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+	"github.com/chriskacerguis/hamqrzdb/internal/sqlite"
+)
+
+// MaxShards is the most shards a database can be split into: SQLite
+// attaches at most 10 databases to a connection by default
+const MaxShards = 10
+
+// chars are the callsign first characters, in the order they are divided
+// between shards. Anything else goes to the last shard.
+const chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// copied are the tables whose rows move to the shards. callsign_trigrams
+// is filled by the callsigns insert trigger in each shard.
+var copied = []string{"callsigns", "callsign_history"}
+
+// viewed are the tables served from the shards
+var viewed = []string{"callsigns", "callsign_history", "callsign_trigrams"}
+
+// Shard is one file of a sharded database
+type Shard struct {
+	ID int
+	// File is the shard's file name, relative to the main database
+	File string
+	// Chars are the callsign first characters it holds; the last shard
+	// also holds any callsign not starting with a letter or digit
+	Chars string
+}
+
+// Plan divides the callsign first characters between n shards, as evenly
+// as they go
+func Plan(n int) []string {
+	groups := make([]string, n)
+	for i := range groups {
+		groups[i] = chars[i*len(chars)/n : (i+1)*len(chars)/n]
+	}
+	return groups
+}
+
+// Path returns the file of shard id of the database at dbPath:
+// hamqrzdb.sqlite has shards hamqrzdb.shard0.sqlite, hamqrzdb.shard1.sqlite, ...
+func Path(dbPath string, id int) string {
+	ext := filepath.Ext(dbPath)
+	return fmt.Sprintf("%s.shard%d%s", strings.TrimSuffix(dbPath, ext), id, ext)
+}
+
+// Layout returns the shards of db, or nil if it isn't sharded
+func Layout(ctx context.Context, db *sql.DB) ([]Shard, error) {
+	exists, err := schema.HasTable(ctx, db, "shards")
+	if err != nil || !exists {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, "SELECT id, file, chars FROM shards ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shard layout: %w", err)
+	}
+	defer rows.Close()
+
+	var shards []Shard
+	for rows.Next() {
+		var s Shard
+		if err := rows.Scan(&s.ID, &s.File, &s.Chars); err != nil {
+			return nil, fmt.Errorf("failed to read shard layout: %w", err)
+		}
+		shards = append(shards, s)
+	}
+	return shards, rows.Err()
+}
+
+// Build copies the callsign tables of the database at dbPath (opened
+// writable as db) into n shard files and records the layout. Each shard is
+// written to a temporary file and renamed into place, so connections that
+// already have the old shards attached keep reading them until they
+// reconnect. Writes are not sharded: the main database keeps its own copy
+// of the rows and importers keep updating it, then publish the changes with
+// Refresh. n of 1 or less removes the layout and the shard files.
+func Build(ctx context.Context, db *sql.DB, dbPath string, n int) ([]Shard, error) {
+	if n > MaxShards {
+		return nil, fmt.Errorf("at most %d shards are supported", MaxShards)
+	}
+	if err := schema.Ensure(ctx, db); err != nil {
+		return nil, err
+	}
+	old, err := Layout(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var shards []Shard
+	if n > 1 {
+		plan := Plan(n)
+		for i, group := range plan {
+			where := "substr(callsign, 1, 1) IN (" + quoteChars(group) + ")"
+			if i == n-1 {
+				// The last shard also takes callsigns starting with anything else
+				where = "substr(callsign, 1, 1) NOT IN (" + quoteChars(chars[:len(chars)-len(group)]) + ")"
+			}
+			path := Path(dbPath, i)
+			if err := buildShard(ctx, db, path, where); err != nil {
+				return nil, fmt.Errorf("failed to build shard %d: %w", i, err)
+			}
+			shards = append(shards, Shard{ID: i, File: filepath.Base(path), Chars: group})
+			log.Printf("Built shard %d (%s) for callsigns starting with %s", i, filepath.Base(path), group)
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record shard layout: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM shards"); err != nil {
+		return nil, fmt.Errorf("failed to record shard layout: %w", err)
+	}
+	for _, s := range shards {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO shards (id, file, chars) VALUES (?, ?, ?)", s.ID, s.File, s.Chars); err != nil {
+			return nil, fmt.Errorf("failed to record shard layout: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to record shard layout: %w", err)
+	}
+
+	// Shards the new layout no longer uses
+	for _, s := range old {
+		if s.ID >= len(shards) {
+			_ = os.Remove(filepath.Join(filepath.Dir(dbPath), s.File))
+		}
+	}
+	return shards, nil
+}
+
+// Refresh rebuilds the shards of the database at dbPath (opened writable as
+// db) in their current layout, so they carry the changes an import made to
+// the main database. Unsharded databases are left alone. Importers call it
+// when they finish, since the API reads callsigns only from the shards.
+func Refresh(ctx context.Context, db *sql.DB, dbPath string) error {
+	layout, err := Layout(ctx, db)
+	if err != nil || len(layout) == 0 {
+		return err
+	}
+	log.Printf("Rebuilding %d shards", len(layout))
+	_, err = Build(ctx, db, dbPath, len(layout))
+	return err
+}
+
+// buildShard writes the rows matching where to a new shard file at path
+func buildShard(ctx context.Context, db *sql.DB, path, where string) error {
+	tmp := path + ".tmp"
+	for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+		_ = os.Remove(tmp + suffix)
+	}
+
+	// The shard gets the full schema, so the trigram trigger fills its index
+	sdb, err := sql.Open("sqlite3", tmp)
+	if err != nil {
+		return err
+	}
+	err = schema.Ensure(ctx, sdb)
+	sdb.Close()
+	if err != nil {
+		return err
+	}
+
+	// ATTACH is per connection, so hold one for the copy
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS build", tmp); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE build")
+
+	for _, table := range copied {
+		cols, err := columns(ctx, conn, table)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `
+			INSERT INTO build.`+table+` (`+cols+`)
+			SELECT `+cols+` FROM main.`+table+`
+			WHERE `+where); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", table, err)
+		}
+	}
+	if _, err := conn.ExecContext(ctx, "DETACH DATABASE build"); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// columns returns the column list of a main database table. Migrated
+// databases can have their columns in a different order than new ones.
+func columns(ctx context.Context, conn *sql.Conn, table string) (string, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT name FROM pragma_table_info(?, 'main')", table)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var cols []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return "", err
+		}
+		cols = append(cols, name)
+	}
+	return strings.Join(cols, ", "), rows.Err()
+}
+
+// quoteChars returns the characters of s as an SQL list of strings
+func quoteChars(s string) string {
+	quoted := make([]string, len(s))
+	for i := range s {
+		quoted[i] = "'" + s[i:i+1] + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// Attach returns a connect hook for sqlite.NewDriver that attaches the
+// shards of the database at dbPath read-only and creates temporary views
+// named after the sharded tables, which take precedence over the main
+// database's own copies. Connections to unsharded databases are unchanged.
+// Shards of an immutable database are attached as immutable too.
+func Attach(dbPath string, immutable bool) sqlite.ConnectHook {
+	dir := filepath.Dir(dbPath)
+	query := "mode=ro"
+	if immutable {
+		query += "&immutable=1"
+	}
+	return func(c sqlite.Conn) error {
+		files, err := shardFiles(c)
+		if err != nil || len(files) == 0 {
+			return err
+		}
+
+		for i, file := range files {
+			abs, err := filepath.Abs(filepath.Join(dir, file))
+			if err != nil {
+				return err
+			}
+			uri := (&url.URL{Scheme: "file", Path: abs, RawQuery: query}).String()
+			if _, err := c.ExecContext(context.Background(), fmt.Sprintf("ATTACH DATABASE ? AS shard%d", i), []driver.NamedValue{{Ordinal: 1, Value: uri}}); err != nil {
+				return fmt.Errorf("failed to attach shard %s: %w", file, err)
+			}
+		}
+
+		for _, table := range viewed {
+			selects := make([]string, len(files))
+			for i := range files {
+				selects[i] = fmt.Sprintf("SELECT * FROM shard%d.%s", i, table)
+			}
+			view := "CREATE TEMP VIEW " + table + " AS " + strings.Join(selects, " UNION ALL ")
+			if _, err := c.ExecContext(context.Background(), view, nil); err != nil {
+				return fmt.Errorf("failed to create %s view: %w", table, err)
+			}
+		}
+		return nil
+	}
+}
+
+// shardFiles reads the shard file names from a new connection
+func shardFiles(c sqlite.Conn) ([]string, error) {
+	rows, err := c.QueryContext(context.Background(), `SELECT file FROM shards ORDER BY id`, nil)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read shard layout: %w", err)
+	}
+	defer rows.Close()
+
+	var files []string
+	dest := make([]driver.Value, 1)
+	for rows.Next(dest) == nil {
+		switch v := dest[0].(type) {
+		case string:
+			files = append(files, v)
+		case []byte:
+			files = append(files, string(v))
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,24 @@
+//go:build !purego && cgo
+
+package sqlite
+
+import (
+	"database/sql/driver"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// PureGo reports whether the binary was built with the pure Go driver
+const PureGo = false
+
+// NewDriver returns a SQLite driver that runs hook, if set, on each new
+// connection. go-sqlite3 registers "sqlite3" itself.
+func NewDriver(hook ConnectHook) driver.Driver {
+	d := &sqlite3.SQLiteDriver{}
+	if hook != nil {
+		d.ConnectHook = func(c *sqlite3.SQLiteConn) error {
+			return hook(c)
+		}
+	}
+	return d
+}
@@ -0,0 +1,49 @@
+package sqlite
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// pureDSN translates a go-sqlite3 data source name to modernc.org/sqlite's
+// form. go-sqlite3 sets pragmas from its own underscore parameters, which
+// modernc takes as _pragma=name(value) instead; URI parameters SQLite
+// itself reads (mode, cache, immutable, vfs) pass through. Like go-sqlite3,
+// connections wait 5 seconds for a busy database unless told otherwise.
+func pureDSN(dsn string) string {
+	path, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return dsn
+	}
+
+	out := url.Values{}
+	busy := "5000"
+	pragma := func(name, value string) {
+		out.Add("_pragma", fmt.Sprintf("%s(%s)", name, value))
+	}
+	for key, values := range params {
+		value := values[len(values)-1]
+		switch key {
+		case "_journal_mode", "_journal":
+			pragma("journal_mode", value)
+		case "_synchronous", "_sync":
+			pragma("synchronous", value)
+		case "_busy_timeout", "_timeout":
+			busy = value
+		case "_foreign_keys", "_fk":
+			pragma("foreign_keys", value)
+		case "_txlock":
+			out.Set("_txlock", value)
+		case "mode", "cache", "immutable", "vfs":
+			out.Set(key, value)
+		}
+	}
+	pragma("busy_timeout", busy)
+
+	if !strings.HasPrefix(path, "file:") {
+		path = "file:" + strings.NewReplacer("%", "%25", "#", "%23", "?", "%3f").Replace(path)
+	}
+	return path + "?" + out.Encode()
+}
@@ -0,0 +1,51 @@
+//go:build purego || !cgo
+
+package sqlite
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	msqlite "modernc.org/sqlite"
+)
+
+// PureGo reports whether the binary was built with the pure Go driver
+const PureGo = true
+
+func init() {
+	sql.Register("sqlite3", NewDriver(nil))
+}
+
+// NewDriver returns a SQLite driver that runs hook, if set, on each new
+// connection
+func NewDriver(hook ConnectHook) driver.Driver {
+	return &pureDriver{hook: hook}
+}
+
+// pureDriver opens modernc.org/sqlite connections from go-sqlite3 data
+// source names
+type pureDriver struct {
+	d    msqlite.Driver
+	hook ConnectHook
+}
+
+func (p *pureDriver) Open(name string) (driver.Conn, error) {
+	c, err := p.d.Open(pureDSN(name))
+	if err != nil {
+		return nil, err
+	}
+	if p.hook == nil {
+		return c, nil
+	}
+	conn, ok := c.(Conn)
+	if !ok {
+		c.Close()
+		return nil, fmt.Errorf("sqlite: unexpected connection type %T", c)
+	}
+	if err := p.hook(conn); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,28 @@
+// Package sqlite registers the SQLite driver the binaries are built with.
+// By default that's github.com/mattn/go-sqlite3, which needs cgo and is the
+// fastest. Building with -tags purego uses modernc.org/sqlite instead, a
+// translation of SQLite to Go that cross-compiles with CGO_ENABLED=0 (e.g.
+// for a Raspberry Pi) at the cost of slower queries and imports. Builds
+// without cgo use it too, since go-sqlite3 would only fail at run time.
+//
+// Either way the driver is registered as "sqlite3" and accepts go-sqlite3
+// data source names, so importing this package for its side effect is all
+// a binary needs to do.
+package sqlite
+
+import (
+	"database/sql/driver"
+)
+
+// Conn is a SQLite connection, as passed to a ConnectHook
+type Conn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+}
+
+// ConnectHook prepares each new connection of a driver from NewDriver, e.g.
+// setting pragmas or attaching databases
+type ConnectHook func(Conn) error
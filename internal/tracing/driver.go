@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/sqlite"
+)
+
+// SQLiteDriver is the database/sql driver name of SQLite with a client span
+// per query and statement executed within a traced request or job
+const SQLiteDriver = "sqlite3-traced"
+
+func init() {
+	sql.Register(SQLiteDriver, tracedDriver{sqlite.NewDriver(nil)})
+}
+
+// WrapDriver returns d with query spans when tracing is enabled, for
+// registering SQLite drivers with their own connect hooks
+func WrapDriver(d driver.Driver) driver.Driver {
+	if Enabled() {
+		return tracedDriver{d}
+	}
+	return d
+}
+
+// Driver returns the SQLite driver name to open databases with: the traced
+// driver when tracing is enabled, plain sqlite3 otherwise
+func Driver() string {
+	if Enabled() {
+		return SQLiteDriver
+	}
+	return "sqlite3"
+}
+
+type tracedDriver struct {
+	driver.Driver
+}
+
+func (d tracedDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{c.(sqlite.Conn)}, nil
+}
+
+// tracedConn wraps a SQLite connection, recording its queries and statements
+type tracedConn struct {
+	sqlite.Conn
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, span := startQuery(ctx, query)
+	defer span.End()
+	rows, err := c.Conn.QueryContext(ctx, query, args)
+	span.RecordError(err)
+	return rows, err
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ctx, span := startQuery(ctx, query)
+	defer span.End()
+	res, err := c.Conn.ExecContext(ctx, query, args)
+	span.RecordError(err)
+	if err == nil {
+		if n, err := res.RowsAffected(); err == nil {
+			span.SetAttributes(Int("db.rows_affected", n))
+		}
+	}
+	return res, err
+}
+
+// startQuery begins a client span named after the query's operation
+func startQuery(ctx context.Context, query string) (context.Context, *Span) {
+	query = strings.TrimSpace(query)
+	op := "QUERY"
+	if f := strings.Fields(query); len(f) > 0 {
+		op = strings.ToUpper(f[0])
+	}
+	return StartKind(ctx, op, KindClient,
+		String("db.system", "sqlite"),
+		String("db.operation.name", op),
+		String("db.query.text", query),
+	)
+}
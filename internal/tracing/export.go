@@ -0,0 +1,237 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// queueSize bounds the spans waiting for export; later spans are dropped
+	queueSize = 4096
+	// maxBatch is the most spans sent in one export request
+	maxBatch = 512
+	// exportInterval is how often queued spans are sent
+	exportInterval = 5 * time.Second
+)
+
+// exporter batches finished spans and posts them to the OTLP endpoint
+type exporter struct {
+	cfg    config
+	client *http.Client
+	queue  chan otlpSpan
+	done   chan struct{}
+	once   sync.Once
+	// flushed is closed once the final batch has been sent
+	flushed chan struct{}
+}
+
+func newExporter(cfg config) *exporter {
+	e := &exporter{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		queue:   make(chan otlpSpan, queueSize),
+		done:    make(chan struct{}),
+		flushed: make(chan struct{}),
+	}
+	go e.run()
+	log.Printf("Exporting traces to %s as %s", cfg.endpoint, cfg.service)
+	return e
+}
+
+// enqueue queues a finished span, dropping it if the exporter is behind
+func (e *exporter) enqueue(s otlpSpan) {
+	select {
+	case e.queue <- s:
+	default:
+	}
+}
+
+// shutdown sends the spans still queued, waiting until ctx is done at most
+func (e *exporter) shutdown(ctx context.Context) {
+	e.once.Do(func() { close(e.done) })
+	select {
+	case <-e.flushed:
+	case <-ctx.Done():
+	}
+}
+
+func (e *exporter) run() {
+	defer close(e.flushed)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	var pending []otlpSpan
+	for {
+		select {
+		case s := <-e.queue:
+			pending = append(pending, s)
+			if len(pending) < maxBatch {
+				continue
+			}
+		case <-ticker.C:
+		case <-e.done:
+			for {
+				select {
+				case s := <-e.queue:
+					pending = append(pending, s)
+					continue
+				default:
+				}
+				break
+			}
+			for len(pending) > 0 {
+				n := min(len(pending), maxBatch)
+				e.export(pending[:n])
+				pending = pending[n:]
+			}
+			return
+		}
+		if len(pending) > 0 {
+			e.export(pending)
+			pending = nil
+		}
+	}
+}
+
+// export posts one batch of spans. Failures are logged and the batch is
+// dropped; tracing must never hold up the service.
+func (e *exporter) export(spans []otlpSpan) {
+	body, err := json.Marshal(e.payload(spans))
+	if err != nil {
+		log.Printf("Trace export failed: %v", err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, e.cfg.endpoint, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Trace export failed: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.cfg.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		log.Printf("Trace export failed: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		log.Printf("Trace export failed: collector returned %s", resp.Status)
+	}
+}
+
+// OTLP/JSON request body types (opentelemetry-proto ExportTraceServiceRequest)
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID      string     `json:"traceId"`
+		SpanID       string     `json:"spanId"`
+		ParentSpanID string     `json:"parentSpanId,omitempty"`
+		Name         string     `json:"name"`
+		Kind         int        `json:"kind"`
+		Start        string     `json:"startTimeUnixNano"`
+		End          string     `json:"endTimeUnixNano"`
+		Attributes   []otlpAttr `json:"attributes,omitempty"`
+		Status       otlpStatus `json:"status"`
+	}
+	otlpStatus struct {
+		// Code is 0 unset, 1 ok, or 2 error
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttr struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	}
+)
+
+// payload wraps spans in the resource and scope of this process
+func (e *exporter) payload(spans []otlpSpan) otlpRequest {
+	host, _ := os.Hostname()
+	resource := otlpResource{Attributes: otlpAttrs([]Attr{
+		String("service.name", e.cfg.service),
+		String("host.name", host),
+		Int("process.pid", int64(os.Getpid())),
+	})}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   resource,
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/chriskacerguis/hamqrzdb"}, Spans: spans}},
+	}}}
+}
+
+// finish converts an ended span to its OTLP form
+func (s *Span) finish(end time.Time) otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := otlpSpan{
+		TraceID:    hex.EncodeToString(s.traceID[:]),
+		SpanID:     hex.EncodeToString(s.spanID[:]),
+		Name:       s.name,
+		Kind:       s.kind,
+		Start:      strconv.FormatInt(s.start.UnixNano(), 10),
+		End:        strconv.FormatInt(end.UnixNano(), 10),
+		Attributes: otlpAttrs(s.attrs),
+	}
+	if s.parentID != [8]byte{} {
+		out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	if s.errMsg != "" {
+		out.Status = otlpStatus{Code: 2, Message: s.errMsg}
+	}
+	return out
+}
+
+// otlpAttrs encodes attributes as OTLP AnyValues
+func otlpAttrs(attrs []Attr) []otlpAttr {
+	out := make([]otlpAttr, 0, len(attrs))
+	for _, a := range attrs {
+		var v map[string]interface{}
+		switch x := a.Value.(type) {
+		case string:
+			v = map[string]interface{}{"stringValue": x}
+		case int64:
+			// 64-bit integers are strings in OTLP/JSON
+			v = map[string]interface{}{"intValue": strconv.FormatInt(x, 10)}
+		case float64:
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				continue
+			}
+			v = map[string]interface{}{"doubleValue": x}
+		case bool:
+			v = map[string]interface{}{"boolValue": x}
+		default:
+			v = map[string]interface{}{"stringValue": fmt.Sprint(x)}
+		}
+		out = append(out, otlpAttr{Key: a.Key, Value: v})
+	}
+	return out
+}
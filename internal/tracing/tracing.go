@@ -0,0 +1,396 @@
+// Package tracing records OpenTelemetry spans for API requests, database
+// queries, and imports, and exports them to an OTLP/HTTP collector using the
+// JSON encoding. It is configured with the standard OTEL_* environment
+// variables and does nothing unless an OTLP endpoint is set.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Span kinds, as numbered by OTLP
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// Attr is a span attribute. Values are strings, int64s, float64s, or bools.
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// String, Int, Float, and Bool build attributes of each value type
+func String(key, value string) Attr        { return Attr{key, value} }
+func Int(key string, value int64) Attr     { return Attr{key, value} }
+func Float(key string, value float64) Attr { return Attr{key, value} }
+func Bool(key string, value bool) Attr     { return Attr{key, value} }
+
+// Span is one timed operation in a trace. A nil Span is valid and records
+// nothing, so callers never need to check whether tracing is enabled.
+type Span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	sampled  bool
+
+	name  string
+	kind  int
+	start time.Time
+
+	mu     sync.Mutex
+	attrs  []Attr
+	errMsg string
+	ended  bool
+}
+
+type spanKey struct{}
+
+// tracer is the process-wide exporter; nil when tracing is disabled
+var tracer *exporter
+
+// Enabled reports whether spans are being exported
+func Enabled() bool {
+	return tracer != nil
+}
+
+// Init configures tracing from the environment for the named service
+// (OTEL_SERVICE_NAME overrides it) and returns a function that flushes
+// pending spans. Without OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT it does nothing.
+func Init(service string) (shutdown func(context.Context), err error) {
+	noop := func(context.Context) {}
+	cfg, err := loadConfig(os.Getenv, service)
+	if err != nil || cfg.endpoint == "" {
+		return noop, err
+	}
+	tracer = newExporter(cfg)
+	return tracer.shutdown, nil
+}
+
+// StartProcess initializes tracing for a command-line run of service and
+// starts its root span, called name, joined to the trace in TRACEPARENT when another
+// process started this one. The returned function records the run's error,
+// ends the span, and flushes it; call it before exiting, including on failure.
+func StartProcess(ctx context.Context, service, name string, attrs ...Attr) (context.Context, func(error), error) {
+	shutdown, err := Init(service)
+	if err != nil {
+		return ctx, func(error) {}, err
+	}
+	ctx, span := Start(FromEnvironment(ctx), name, attrs...)
+	return ctx, func(err error) {
+		span.RecordError(err)
+		span.End()
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown(flushCtx)
+	}, nil
+}
+
+// Start begins an internal span as a child of the span in ctx, if any
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal, attrs...)
+}
+
+// StartKind begins a span of the given kind as a child of the span in ctx.
+// A span without a parent starts a new trace, unless it is a client span:
+// database queries and outgoing requests are only traced as part of a
+// request or job, so background polling doesn't fill the collector.
+func StartKind(ctx context.Context, name string, kind int, attrs ...Attr) (context.Context, *Span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+	parent := FromContext(ctx)
+	if parent == nil && kind == KindClient {
+		return ctx, nil
+	}
+
+	s := &Span{name: name, kind: kind, start: time.Now(), attrs: attrs}
+	if parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+		s.sampled = parent.sampled
+	} else {
+		_, _ = rand.Read(s.traceID[:])
+		s.sampled = tracer.sample(s.traceID)
+	}
+	_, _ = rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Run calls fn within an internal span named name, recording its error
+func Run(ctx context.Context, name string, fn func(context.Context) error, attrs ...Attr) error {
+	ctx, span := Start(ctx, name, attrs...)
+	defer span.End()
+	err := fn(ctx)
+	span.RecordError(err)
+	return err
+}
+
+// FromContext returns the span in ctx, or nil
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// RecordError marks the span as failed with err; a nil err is ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.errMsg = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export. Only the first call counts.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	ended := s.ended
+	s.ended = true
+	s.mu.Unlock()
+	if !ended && s.sampled && tracer != nil {
+		tracer.enqueue(s.finish(time.Now()))
+	}
+}
+
+// TraceID returns the span's trace ID in hex, or "" for a nil span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// Traceparent returns the W3C traceparent header value for the span in ctx,
+// or "" when there is none
+func Traceparent(ctx context.Context) string {
+	s := FromContext(ctx)
+	if s == nil {
+		return ""
+	}
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.spanID[:]) + "-" + flags
+}
+
+// WithTraceparent returns ctx carrying a remote parent parsed from a W3C
+// traceparent value, so spans started from it join the caller's trace.
+// Invalid values are ignored.
+func WithTraceparent(ctx context.Context, traceparent string) context.Context {
+	if tracer == nil || traceparent == "" {
+		return ctx
+	}
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ctx
+	}
+	var remote Span
+	if _, err := hex.Decode(remote.traceID[:], []byte(parts[1])); err != nil || remote.traceID == [16]byte{} {
+		return ctx
+	}
+	if _, err := hex.Decode(remote.spanID[:], []byte(parts[2])); err != nil || remote.spanID == [8]byte{} {
+		return ctx
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return ctx
+	}
+	remote.sampled = flags&1 == 1
+	remote.ended = true
+	return context.WithValue(ctx, spanKey{}, &remote)
+}
+
+// FromEnvironment returns ctx joined to the trace in the TRACEPARENT
+// environment variable, set by a parent process that ran this one
+func FromEnvironment(ctx context.Context) context.Context {
+	return WithTraceparent(ctx, os.Getenv("TRACEPARENT"))
+}
+
+// HTTPMiddleware wraps next in a server span per request, joined to the
+// caller's trace when a traceparent header is sent. The response carries
+// the trace ID in a Trace-Id header for matching client reports to traces.
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tracer == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := WithTraceparent(r.Context(), r.Header.Get("traceparent"))
+		ctx, span := StartKind(ctx, r.Method+" "+routeName(r.URL.Path), KindServer,
+			String("http.request.method", r.Method),
+			String("url.path", r.URL.Path),
+			String("user_agent.original", r.UserAgent()),
+		)
+		defer span.End()
+		w.Header().Set("Trace-Id", span.TraceID())
+
+		rec := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(Int("http.response.status_code", int64(rec.status)))
+		if rec.status >= 500 {
+			span.RecordError(fmt.Errorf("HTTP %d", rec.status))
+		}
+	})
+}
+
+// routeName reduces a path to a low-cardinality span name: the callsign
+// and app segments of lookups are replaced with placeholders
+func routeName(path string) string {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) >= 2 && parts[0] == "v2" {
+		switch parts[1] {
+		case "new", "upgrades", "cancelled", "nearby", "search":
+			return path
+		case "fuzzy", "callsign":
+			return "/v2/" + parts[1] + "/{callsign}"
+		}
+		return "/v2/{unknown}"
+	}
+	if len(parts) < 2 || parts[0] != "v1" {
+		return path
+	}
+	switch parts[1] {
+	case "new", "upgrades", "cancelled", "nearby", "search", "usage":
+		return path
+	case "fuzzy":
+		return "/v1/fuzzy/{callsign}"
+	}
+	name := "/v1/{callsign}"
+	if len(parts) > 2 {
+		name += "/" + parts[2]
+	}
+	if len(parts) > 3 {
+		name += "/{app}"
+	}
+	return name
+}
+
+// statusWriter captures the status code written by a handler
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Flush lets streamed responses (CSV) through the wrapper
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// config is the exporter configuration read from the environment
+type config struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	// ratio is the fraction of new traces sampled
+	ratio float64
+}
+
+// loadConfig reads the OTEL_* variables supported by the exporter
+func loadConfig(getenv func(string) string, service string) (config, error) {
+	cfg := config{service: service, ratio: 1, headers: map[string]string{}}
+	if strings.EqualFold(getenv("OTEL_SDK_DISABLED"), "true") || getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return cfg, nil
+	}
+
+	if v := getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); v != "" {
+		cfg.endpoint = v
+	} else if v := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); v != "" {
+		cfg.endpoint = strings.TrimSuffix(v, "/") + "/v1/traces"
+	} else {
+		return cfg, nil
+	}
+
+	protocol := getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	if protocol != "" && protocol != "http/json" {
+		return config{}, fmt.Errorf("unsupported OTLP protocol %q (only http/json is supported)", protocol)
+	}
+
+	if v := getenv("OTEL_SERVICE_NAME"); v != "" {
+		cfg.service = v
+	}
+
+	for _, h := range []string{getenv("OTEL_EXPORTER_OTLP_HEADERS"), getenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS")} {
+		for _, pair := range strings.Split(h, ",") {
+			k, v, ok := strings.Cut(pair, "=")
+			if !ok || strings.TrimSpace(k) == "" {
+				continue
+			}
+			// Values are URL-encoded, so spaces are written as %20
+			if u, err := url.QueryUnescape(strings.TrimSpace(v)); err == nil {
+				v = u
+			}
+			cfg.headers[strings.TrimSpace(k)] = v
+		}
+	}
+
+	switch sampler := getenv("OTEL_TRACES_SAMPLER"); sampler {
+	case "", "always_on", "parentbased_always_on":
+	case "always_off", "parentbased_always_off":
+		cfg.ratio = 0
+	case "traceidratio", "parentbased_traceidratio":
+		if v := getenv("OTEL_TRACES_SAMPLER_ARG"); v != "" {
+			ratio, err := strconv.ParseFloat(v, 64)
+			if err != nil || ratio < 0 || ratio > 1 {
+				return config{}, fmt.Errorf("invalid OTEL_TRACES_SAMPLER_ARG %q (expected 0 to 1)", v)
+			}
+			cfg.ratio = ratio
+		}
+	default:
+		return config{}, fmt.Errorf("unsupported OTEL_TRACES_SAMPLER %q", sampler)
+	}
+	return cfg, nil
+}
+
+// sample decides whether a new trace is recorded, from the low 8 bytes of
+// its ID as the trace ID ratio sampler does
+func (e *exporter) sample(traceID [16]byte) bool {
+	if e.cfg.ratio >= 1 {
+		return true
+	}
+	bound := uint64(e.cfg.ratio * (1 << 63))
+	return binary.BigEndian.Uint64(traceID[8:])>>1 < bound
+}
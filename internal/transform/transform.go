@@ -0,0 +1,211 @@
+// Package transform applies operator-written rules to JSON responses: add
+// fields, redact, or rename them, optionally only for some apps or records.
+// They are read from a YAML file, so one-off response formats don't
+// need code changes, and they can only edit the response they're given.
+package transform
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RequestPrefix starts the paths of the request values rules can test and
+// use in templates, e.g. request.app; they aren't part of the response
+const RequestPrefix = "request."
+
+// Rules is a rules file
+type Rules struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule edits the response when its conditions hold: fields are renamed,
+// then deleted, then set. Paths are dotted JSON object keys, e.g.
+// hamdb.callsign.addr1.
+type Rule struct {
+	// When holds if every path has one of its values; Unless if any does
+	When   map[string]Match `yaml:"when"`
+	Unless map[string]Match `yaml:"unless"`
+	// Rename moves a field to a new path
+	Rename map[string]string `yaml:"rename"`
+	Delete []string          `yaml:"delete"`
+	// Set sets fields to templates, where {path} is replaced by the value
+	// at path
+	Set map[string]string `yaml:"set"`
+}
+
+// Match is one value or a list of values a field may equal. A missing
+// field equals "".
+type Match []string
+
+func (m *Match) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*m = Match{node.Value}
+		return nil
+	case yaml.SequenceNode:
+		var values []string
+		if err := node.Decode(&values); err != nil {
+			return err
+		}
+		*m = values
+		return nil
+	default:
+		return fmt.Errorf("line %d: a condition must be a value or a list of values", node.Line)
+	}
+}
+
+// Load reads and validates a rules file
+func Load(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+	var r Rules
+	dec := yaml.NewDecoder(strings.NewReader(string(data)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&r); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, rule := range r.Rules {
+		if len(rule.Rename)+len(rule.Delete)+len(rule.Set) == 0 {
+			return nil, fmt.Errorf("%s: rule %d has no rename, delete, or set", path, i+1)
+		}
+		var paths []string
+		for from, to := range rule.Rename {
+			paths = append(paths, from, to)
+		}
+		paths = append(paths, rule.Delete...)
+		for p := range rule.Set {
+			paths = append(paths, p)
+		}
+		for _, p := range paths {
+			if p == "" || strings.HasPrefix(p, RequestPrefix) || strings.Contains(p, "..") {
+				return nil, fmt.Errorf("%s: rule %d: invalid path %q", path, i+1, p)
+			}
+		}
+	}
+	return &r, nil
+}
+
+// Apply edits doc, a decoded JSON object, by each rule whose conditions
+// hold. request holds the request's values by name (app, callsign, ...),
+// read as request.<name>.
+func (r *Rules) Apply(doc map[string]interface{}, request map[string]string) {
+	lookup := func(path string) string {
+		if name, ok := strings.CutPrefix(path, RequestPrefix); ok {
+			return request[name]
+		}
+		v, ok := get(doc, path)
+		if !ok || v == nil {
+			return ""
+		}
+		if s, ok := v.(string); ok {
+			return s
+		}
+		return fmt.Sprint(v)
+	}
+
+	for _, rule := range r.Rules {
+		if !rule.matches(lookup) {
+			continue
+		}
+		for from, to := range rule.Rename {
+			if v, ok := get(doc, from); ok {
+				remove(doc, from)
+				set(doc, to, v)
+			}
+		}
+		for _, p := range rule.Delete {
+			remove(doc, p)
+		}
+		// Templates read the response before any of the rule's sets
+		values := map[string]string{}
+		for p, tmpl := range rule.Set {
+			values[p] = templateField.ReplaceAllStringFunc(tmpl, func(m string) string {
+				return lookup(m[1 : len(m)-1])
+			})
+		}
+		for p, v := range values {
+			set(doc, p, v)
+		}
+	}
+}
+
+// templateField matches {path} in a Set template
+var templateField = regexp.MustCompile(`\{[A-Za-z0-9_.]+\}`)
+
+// matches reports whether the rule's conditions hold
+func (rule Rule) matches(lookup func(string) string) bool {
+	for p, values := range rule.When {
+		if !contains(values, lookup(p)) {
+			return false
+		}
+	}
+	for p, values := range rule.Unless {
+		if contains(values, lookup(p)) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains compares case-insensitively, since callsigns and app names
+// arrive in either case
+func contains(values []string, v string) bool {
+	for _, want := range values {
+		if strings.EqualFold(want, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns the value at a dotted path
+func get(doc map[string]interface{}, path string) (interface{}, bool) {
+	keys := strings.Split(path, ".")
+	var cur interface{} = doc
+	for _, k := range keys {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[k]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// set sets the value at a dotted path, creating objects along the way
+// (replacing any other value there)
+func set(doc map[string]interface{}, path string, v interface{}) {
+	keys := strings.Split(path, ".")
+	m := doc
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := m[k].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			m[k] = next
+		}
+		m = next
+	}
+	m[keys[len(keys)-1]] = v
+}
+
+// remove deletes the value at a dotted path, if any
+func remove(doc map[string]interface{}, path string) {
+	keys := strings.Split(path, ".")
+	m := doc
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := m[k].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m = next
+	}
+	delete(m, keys[len(keys)-1])
+}
@@ -0,0 +1,175 @@
+package winlink
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// pop3 is a connection to a POP3 mailbox (RFC 1939): just the commands
+// needed to read and remove messages
+type pop3 struct {
+	conn net.Conn
+	text *textproto.Conn
+}
+
+// dialPOP3 connects and logs in to the mailbox. Port 995 uses implicit TLS;
+// other ports upgrade with STLS when the server offers it, which it must
+// before the password is sent to anything but localhost.
+func dialPOP3(ctx context.Context, cfg Config) (*pop3, error) {
+	addr := net.JoinHostPort(cfg.POP3Host, strconv.Itoa(cfg.POP3Port))
+	tlsConfig := &tls.Config{ServerName: cfg.POP3Host}
+	var conn net.Conn
+	var err error
+	if cfg.POP3Port == 995 {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	p := &pop3{conn: conn, text: textproto.NewConn(conn)}
+	if _, err := p.response(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("POP3 greeting from %s failed: %w", addr, err)
+	}
+
+	secure := cfg.POP3Port == 995
+	if !secure {
+		if capa, err := p.multiline("CAPA"); err == nil && hasCapability(capa, "STLS") {
+			if _, err := p.cmd("STLS"); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("STLS with %s failed: %w", addr, err)
+			}
+			tlsConn := tls.Client(conn, tlsConfig)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("STLS with %s failed: %w", addr, err)
+			}
+			p.conn, p.text = tlsConn, textproto.NewConn(tlsConn)
+			secure = true
+		}
+	}
+	if !secure && !isLocalhost(cfg.POP3Host) {
+		p.Close()
+		return nil, fmt.Errorf("%s offers no TLS; refusing to send the password unencrypted", addr)
+	}
+
+	if _, err := p.cmd("USER %s", cfg.POP3Username); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("POP3 login failed: %w", err)
+	}
+	if _, err := p.cmd("PASS %s", cfg.POP3Password); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("POP3 login failed: %w", err)
+	}
+	return p, nil
+}
+
+// isLocalhost reports whether host is this machine, such as a local
+// Winlink client's POP3 server
+func isLocalhost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// hasCapability reports whether a CAPA response lists name
+func hasCapability(capa []string, name string) bool {
+	for _, line := range capa {
+		if f := strings.Fields(line); len(f) > 0 && strings.EqualFold(f[0], name) {
+			return true
+		}
+	}
+	return false
+}
+
+// response reads a status line, returning the text after +OK
+func (p *pop3) response() (string, error) {
+	line, err := p.text.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if rest, ok := strings.CutPrefix(line, "+OK"); ok {
+		return strings.TrimSpace(rest), nil
+	}
+	return "", errors.New(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+}
+
+// cmd sends a command and reads its status line
+func (p *pop3) cmd(format string, args ...interface{}) (string, error) {
+	if err := p.text.PrintfLine(format, args...); err != nil {
+		return "", err
+	}
+	return p.response()
+}
+
+// multiline sends a command whose response is a dot-terminated list of
+// lines
+func (p *pop3) multiline(format string, args ...interface{}) ([]string, error) {
+	if _, err := p.cmd(format, args...); err != nil {
+		return nil, err
+	}
+	return p.text.ReadDotLines()
+}
+
+// List returns the numbers of the messages in the mailbox
+func (p *pop3) List() ([]int, error) {
+	lines, err := p.multiline("LIST")
+	if err != nil {
+		return nil, fmt.Errorf("POP3 LIST failed: %w", err)
+	}
+	var ids []int
+	for _, line := range lines {
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		id, err := strconv.Atoi(f[0])
+		if err != nil {
+			return nil, fmt.Errorf("POP3 LIST returned %q", line)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Retrieve returns a message
+func (p *pop3) Retrieve(id int) ([]byte, error) {
+	if _, err := p.cmd("RETR %d", id); err != nil {
+		return nil, fmt.Errorf("POP3 RETR %d failed: %w", id, err)
+	}
+	return p.text.ReadDotBytes()
+}
+
+// Delete marks a message for removal when the session ends with Quit
+func (p *pop3) Delete(id int) error {
+	if _, err := p.cmd("DELE %d", id); err != nil {
+		return fmt.Errorf("POP3 DELE %d failed: %w", id, err)
+	}
+	return nil
+}
+
+// Quit ends the session, removing deleted messages, and closes the
+// connection
+func (p *pop3) Quit() error {
+	_, err := p.cmd("QUIT")
+	p.conn.Close()
+	return err
+}
+
+// Close closes the connection without removing deleted messages
+func (p *pop3) Close() error {
+	return p.conn.Close()
+}
@@ -0,0 +1,372 @@
+// Package winlink answers callsign lookups by email, so stations off the
+// grid can look callsigns up over HF: a Winlink user sends callsigns to a
+// mailbox the responder polls over POP3, and gets their licence records back
+// as a short plain text reply over SMTP.
+package winlink
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/callsign"
+	"github.com/chriskacerguis/hamqrzdb/internal/notify"
+)
+
+// MaxLookups bounds the callsigns answered per message, keeping replies
+// short enough for a slow HF link
+const MaxLookups = 10
+
+// Config is the mailbox requests are read from and the SMTP server replies
+// are sent with, read from the environment by LoadConfig
+type Config struct {
+	POP3Host     string
+	POP3Port     int
+	POP3Username string
+	POP3Password string
+	// SMTP sends replies; its To is set per reply
+	SMTP notify.EmailConfig
+}
+
+// LoadConfig reads POP3_HOST, POP3_PORT (default 995), POP3_USERNAME, and
+// POP3_PASSWORD for the mailbox, and SMTP_HOST, SMTP_PORT (default 587),
+// SMTP_USERNAME, SMTP_PASSWORD, and WINLINK_FROM (default SMTP_USERNAME)
+// for replies.
+func LoadConfig(getenv func(string) string) (Config, error) {
+	cfg := Config{
+		POP3Host:     getenv("POP3_HOST"),
+		POP3Port:     995,
+		POP3Username: getenv("POP3_USERNAME"),
+		POP3Password: getenv("POP3_PASSWORD"),
+		SMTP: notify.EmailConfig{
+			Host:     getenv("SMTP_HOST"),
+			Port:     587,
+			Username: getenv("SMTP_USERNAME"),
+			Password: getenv("SMTP_PASSWORD"),
+			From:     getenv("WINLINK_FROM"),
+		},
+	}
+	if cfg.POP3Host == "" || cfg.POP3Username == "" {
+		return cfg, errors.New("POP3_HOST and POP3_USERNAME are required")
+	}
+	if cfg.SMTP.Host == "" {
+		return cfg, errors.New("SMTP_HOST is required to send replies")
+	}
+	for _, p := range []struct {
+		name string
+		port *int
+	}{{"POP3_PORT", &cfg.POP3Port}, {"SMTP_PORT", &cfg.SMTP.Port}} {
+		if v := getenv(p.name); v != "" {
+			port, err := strconv.Atoi(v)
+			if err != nil || port <= 0 || port > 65535 {
+				return cfg, fmt.Errorf("invalid %s %q", p.name, v)
+			}
+			*p.port = port
+		}
+	}
+	if cfg.SMTP.From == "" {
+		cfg.SMTP.From = cfg.SMTP.Username
+	}
+	if _, err := mail.ParseAddress(cfg.SMTP.From); err != nil {
+		return cfg, fmt.Errorf("invalid WINLINK_FROM %q (it defaults to SMTP_USERNAME)", cfg.SMTP.From)
+	}
+	return cfg, nil
+}
+
+// Record is the licence of a requested callsign
+type Record struct {
+	Call    string
+	Name    string
+	Class   string
+	Status  string
+	Expires string
+	Address string
+	Grid    string
+	// Location is the licence's coordinates, e.g. "41.7147, -72.7272"
+	Location string
+}
+
+// text formats the record in a few short lines
+func (r Record) text() string {
+	lines := []string{strings.TrimSpace(r.Call + "  " + r.Name)}
+	var licence []string
+	for _, s := range []string{r.Class, r.Status} {
+		if s != "" {
+			licence = append(licence, s)
+		}
+	}
+	if r.Expires != "" {
+		licence = append(licence, "expires "+r.Expires)
+	}
+	if len(licence) > 0 {
+		lines = append(lines, "  "+strings.Join(licence, ", "))
+	}
+	if r.Address != "" {
+		lines = append(lines, "  "+r.Address)
+	}
+	switch {
+	case r.Grid != "" && r.Location != "":
+		lines = append(lines, "  Grid "+r.Grid+" ("+r.Location+")")
+	case r.Grid != "":
+		lines = append(lines, "  Grid "+r.Grid)
+	case r.Location != "":
+		lines = append(lines, "  "+r.Location)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Responder answers the lookup requests in a mailbox
+type Responder struct {
+	Config Config
+	// Lookup returns call's record, or nil if the database has none
+	Lookup func(ctx context.Context, call string) (*Record, error)
+}
+
+// Stats counts the messages a poll handled
+type Stats struct {
+	Replied int
+	Ignored int
+	Failed  int
+}
+
+// pollTimeout bounds one pass over the mailbox
+const pollTimeout = 10 * time.Minute
+
+// Poll answers each message in the mailbox and deletes it. Messages that
+// can't be answered, such as bounces and auto-replies, are deleted without
+// a reply so two responders can't loop; a reply that fails to send leaves
+// its message for the next poll.
+func (r *Responder) Poll(ctx context.Context) (Stats, error) {
+	var stats Stats
+	ctx, cancel := context.WithTimeout(ctx, pollTimeout)
+	defer cancel()
+
+	box, err := dialPOP3(ctx, r.Config)
+	if err != nil {
+		return stats, err
+	}
+	defer box.Close()
+	ids, err := box.List()
+	if err != nil {
+		return stats, err
+	}
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			break
+		}
+		raw, err := box.Retrieve(id)
+		if err != nil {
+			return stats, err
+		}
+		to, subject, body, err := r.answer(ctx, raw)
+		switch {
+		case err != nil:
+			log.Printf("Failed to answer message %d: %v", id, err)
+			stats.Failed++
+			continue
+		case to == "":
+			stats.Ignored++
+		default:
+			smtp := r.Config.SMTP
+			smtp.To = []string{to}
+			if err := notify.SendEmail(ctx, smtp, subject, body); err != nil {
+				log.Printf("Failed to reply to %s: %v", to, err)
+				stats.Failed++
+				continue
+			}
+			log.Printf("Replied to %s: %s", to, strings.TrimPrefix(subject, replyPrefix))
+			stats.Replied++
+		}
+		if err := box.Delete(id); err != nil {
+			return stats, err
+		}
+	}
+	return stats, box.Quit()
+}
+
+// replyPrefix starts every reply's subject. Winlink only delivers internet
+// mail from senders on the user's whitelist, unless the subject starts with
+// //WL2K.
+const replyPrefix = "//WL2K hamqrzdb "
+
+// answer returns the reply to a raw message, or an empty address for
+// messages that get none
+func (r *Responder) answer(ctx context.Context, raw []byte) (to, subject, body string, err error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		// Unparseable, so there's no one to reply to
+		return "", "", "", nil
+	}
+	to = replyAddress(msg.Header, r.Config.SMTP.From)
+	if to == "" {
+		return "", "", "", nil
+	}
+	text, err := textBody(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		// Still answer from the subject
+		text = ""
+	}
+	dec := new(mime.WordDecoder)
+	subj, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subj = msg.Header.Get("Subject")
+	}
+	calls := requestedCalls(subj, text)
+
+	if len(calls) == 0 {
+		return to, replyPrefix + "help", usage, nil
+	}
+	var b strings.Builder
+	for i, call := range calls {
+		rec, err := r.Lookup(ctx, call)
+		if err != nil {
+			return "", "", "", err
+		}
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		if rec == nil {
+			b.WriteString(call + "  not found")
+		} else {
+			b.WriteString(rec.text())
+		}
+	}
+	b.WriteString("\n")
+	return to, replyPrefix + strings.Join(calls, " "), b.String(), nil
+}
+
+// usage is the reply to a message without callsigns
+var usage = fmt.Sprintf(`No callsigns found in your message.
+
+Send callsigns in the subject or body, separated by spaces or lines, up to
+%d per message, e.g. subject: W1AW K1ABC
+`, MaxLookups)
+
+// replyAddress returns where to reply to a message, or "" for messages that
+// mustn't be answered: automatic ones, bounces, and the responder's own
+func replyAddress(h mail.Header, self string) string {
+	if v := strings.ToLower(h.Get("Auto-Submitted")); v != "" && v != "no" {
+		return ""
+	}
+	switch strings.ToLower(h.Get("Precedence")) {
+	case "bulk", "junk", "list":
+		return ""
+	}
+	if h.Get("X-Autoreply") != "" || h.Get("X-Autorespond") != "" {
+		return ""
+	}
+
+	from := h.Get("Reply-To")
+	if from == "" {
+		from = h.Get("From")
+	}
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return ""
+	}
+	local, _, _ := strings.Cut(strings.ToLower(addr.Address), "@")
+	if local == "mailer-daemon" || local == "postmaster" || local == "noreply" || local == "no-reply" {
+		return ""
+	}
+	if own, err := mail.ParseAddress(self); err == nil && strings.EqualFold(own.Address, addr.Address) {
+		return ""
+	}
+	return addr.Address
+}
+
+// maxBody bounds the text read from a message
+const maxBody = 64 << 10
+
+// textBody returns a message's plain text: the body itself, or the first
+// text/plain part of a multipart message, decoded
+func textBody(contentType, encoding string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				return "", err
+			}
+			ct := part.Header.Get("Content-Type")
+			if ct == "" {
+				ct = "text/plain"
+			}
+			// The multipart reader decodes quoted-printable parts itself
+			text, err := textBody(ct, part.Header.Get("Content-Transfer-Encoding"), part)
+			if err == nil && text != "" {
+				return text, nil
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	b, err := io.ReadAll(io.LimitReader(body, maxBody))
+	return string(b), err
+}
+
+// requestedCalls returns the distinct callsigns in a subject and body, up
+// to MaxLookups. Quoted lines and everything after a signature or forwarded
+// message separator are skipped, so a reply to a reply doesn't repeat the
+// earlier lookups.
+func requestedCalls(subject, body string) []string {
+	lines := []string{subject}
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "--") {
+			break
+		}
+		if strings.HasPrefix(line, ">") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	var calls []string
+	seen := map[string]bool{}
+	for _, line := range lines {
+		words := strings.FieldsFunc(strings.ToUpper(line), func(c rune) bool {
+			return !(c == '/' || unicode.IsLetter(c) || unicode.IsDigit(c))
+		})
+		for _, w := range words {
+			// The //WL2K subject prefix reads as a callsign
+			if w == "WL2K" {
+				continue
+			}
+			base := callsign.Base(w)
+			if base == "" || seen[base] {
+				continue
+			}
+			seen[base] = true
+			calls = append(calls, base)
+			if len(calls) == MaxLookups {
+				return calls
+			}
+		}
+	}
+	return calls
+}
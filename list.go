@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Limits shared by the list endpoints
+const (
+	// maxListMatches caps the matches a list request reads; totals above it
+	// are reported as maxListMatches
+	maxListMatches = 10000
+	// maxPageSize caps ?limit=, the number of items per page
+	maxPageSize = 1000
+)
+
+// listParams are a list request's page size, position, and sort order
+type listParams struct {
+	limit  int
+	offset int
+	// sort is the ?sort= value: a JSON field name, prefixed with - to sort
+	// descending; empty keeps the endpoint's default order
+	sort string
+}
+
+// parseListParams reads ?limit=, ?cursor=, and ?sort= for items of type T.
+// Cursors are opaque to clients and only valid with the sort they came from.
+func parseListParams[T any](r *http.Request, defaultLimit int) (listParams, error) {
+	q := r.URL.Query()
+	var p listParams
+
+	limit, err := positiveParam(q.Get("limit"), defaultLimit)
+	if err != nil || limit > maxPageSize {
+		return p, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+	}
+	p.limit = limit
+
+	p.sort = strings.TrimSpace(q.Get("sort"))
+	if p.sort != "" {
+		if _, ok := sortColumn[T](strings.TrimPrefix(p.sort, "-")); !ok {
+			return p, fmt.Errorf("sort must be one of %s (prefix - for descending)", strings.Join(sortFields[T](), ", "))
+		}
+	}
+
+	if c := q.Get("cursor"); c != "" {
+		offset, sortKey, ok := decodeCursor(c)
+		if !ok || sortKey != p.sort {
+			return p, fmt.Errorf("invalid cursor; cursors only work with the sort they were returned for")
+		}
+		p.offset = offset
+	}
+	return p, nil
+}
+
+// encodeCursor returns the cursor for the page starting at offset
+func encodeCursor(offset int, sortKey string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("1:" + strconv.Itoa(offset) + ":" + sortKey))
+}
+
+// decodeCursor reverses encodeCursor
+func decodeCursor(c string) (offset int, sortKey string, ok bool) {
+	b, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return 0, "", false
+	}
+	parts := strings.SplitN(string(b), ":", 3)
+	if len(parts) != 3 || parts[0] != "1" {
+		return 0, "", false
+	}
+	offset, err = strconv.Atoi(parts[1])
+	if err != nil || offset < 0 {
+		return 0, "", false
+	}
+	return offset, parts[2], true
+}
+
+// sortColumn finds the scalar field of T with JSON name name
+func sortColumn[T any](name string) (csvColumn, bool) {
+	for _, c := range csvColumns(reflect.TypeOf((*T)(nil)).Elem()) {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return csvColumn{}, false
+}
+
+// sortFields lists the fields items of type T can be sorted by
+func sortFields[T any]() []string {
+	var names []string
+	for _, c := range csvColumns(reflect.TypeOf((*T)(nil)).Elem()) {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// page sorts all matches by p.sort (ties keep the endpoint's order) and
+// returns the requested page and the cursor of the next one, if any
+func page[T any](items []T, p listParams) ([]T, string) {
+	if p.sort != "" {
+		c, _ := sortColumn[T](strings.TrimPrefix(p.sort, "-"))
+		desc := strings.HasPrefix(p.sort, "-")
+		sort.SliceStable(items, func(i, j int) bool {
+			a := reflect.ValueOf(items[i]).FieldByIndex(c.index)
+			b := reflect.ValueOf(items[j]).FieldByIndex(c.index)
+			if desc {
+				return lessValue(b, a)
+			}
+			return lessValue(a, b)
+		})
+	}
+
+	if p.offset >= len(items) {
+		return []T{}, ""
+	}
+	end := min(p.offset+p.limit, len(items))
+	next := ""
+	if end < len(items) {
+		next = encodeCursor(end, p.sort)
+	}
+	return items[p.offset:end], next
+}
+
+// lessValue orders two scalar field values: numbers numerically, strings
+// case-insensitively, and nil pointers last
+func lessValue(a, b reflect.Value) bool {
+	if a.Kind() == reflect.Pointer {
+		if a.IsNil() || b.IsNil() {
+			return !a.IsNil() && b.IsNil()
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	}
+	return strings.ToLower(csvValue(a)) < strings.ToLower(csvValue(b))
+}
+
+// writeList writes a page of a list endpoint's matches: CSV if requested
+// (see wantsCSV), otherwise the common JSON envelope of items, the page's
+// count, the total number of matches, and next_cursor (null on the last
+// page), plus the endpoint's own fields in extra
+func writeList[T any](w http.ResponseWriter, r *http.Request, name string, matches []T, p listParams, extra map[string]interface{}) {
+	items, next := page(matches, p)
+	if wantsCSV(r) {
+		writeCSV(w, name, items)
+		return
+	}
+
+	body := map[string]interface{}{
+		"items":       items,
+		"count":       len(items),
+		"total":       len(matches),
+		"next_cursor": nil,
+	}
+	if next != "" {
+		body["next_cursor"] = next
+	}
+	for k, v := range extra {
+		body[k] = v
+	}
+	writeJSON(w, r, http.StatusOK, body)
+}
+
+// listWriter passes a list endpoint's matches to the response as they are
+// read, in the endpoint's own order. A CSV request without ?sort= streams:
+// the page's rows are written as they arrive, and add reports when the page
+// is full so the query can stop early. Anything else collects the matches
+// for writeList.
+type listWriter[T any] struct {
+	w    http.ResponseWriter
+	r    *http.Request
+	name string
+	p    listParams
+	// stream is set when the request streams CSV; rows start on the first add
+	stream  bool
+	csv     *csvStream[T]
+	skipped int
+	matches []T
+}
+
+// newListWriter returns a listWriter for items of list endpoint name
+func newListWriter[T any](w http.ResponseWriter, r *http.Request, name string, p listParams) *listWriter[T] {
+	return &listWriter[T]{w: w, r: r, name: name, p: p, stream: wantsCSV(r) && p.sort == "", matches: []T{}}
+}
+
+// add passes on the next match, reporting whether the response needs no
+// more of them
+func (l *listWriter[T]) add(item T) bool {
+	if !l.stream {
+		l.matches = append(l.matches, item)
+		return false
+	}
+	if l.skipped < l.p.offset {
+		l.skipped++
+		return false
+	}
+	if l.csv == nil {
+		l.csv = newCSVStream[T](l.w, l.name)
+	}
+	if err := l.csv.write(item); err != nil {
+		// The client went away
+		return true
+	}
+	return l.csv.rows >= l.p.limit
+}
+
+// started reports whether the response has begun, after which an error
+// can no longer be reported to the client
+func (l *listWriter[T]) started() bool {
+	return l.csv != nil
+}
+
+// finish completes the response; extra is added to a JSON envelope
+func (l *listWriter[T]) finish(extra map[string]interface{}) {
+	if !l.stream {
+		writeList(l.w, l.r, l.name, l.matches, l.p, extra)
+		return
+	}
+	if l.csv == nil {
+		l.csv = newCSVStream[T](l.w, l.name)
+	}
+	l.csv.flush()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listenAddrs returns the addresses to serve on: LISTEN, a comma-separated
+// list of TCP addresses (":8080", "127.0.0.1:8080", "[::1]:8080"), TCP
+// addresses limited to one IP version (tcp4:..., tcp6:...), and unix:/path
+// sockets, or the TCP port PORT when LISTEN is unset
+func listenAddrs(getenv func(string) string) []string {
+	var addrs []string
+	for _, a := range strings.Split(getenv("LISTEN"), ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	if len(addrs) > 0 {
+		return addrs
+	}
+	port := getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	return []string{":" + port}
+}
+
+// listen opens a listener for one LISTEN address. A host-less address such
+// as ":8080" or "[::]:8080" accepts IPv4 and IPv6 where the system allows
+// it; tcp6: listens for IPv6 only and tcp4: for IPv4 only. A unix socket
+// left behind by a previous run is replaced, but not one another process
+// is serving on. mode, if non-zero, is applied to the socket file so a
+// reverse proxy running as another user can connect.
+func listen(addr string, mode os.FileMode) (net.Listener, error) {
+	for _, network := range []string{"tcp4", "tcp6"} {
+		if a, ok := strings.CutPrefix(addr, network+":"); ok {
+			return listenTCP(network, a)
+		}
+	}
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return listenTCP("tcp", addr)
+	}
+	if path == "" {
+		return nil, errors.New("unix socket path is empty")
+	}
+
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("failed to set socket mode: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// listenTCP opens a TCP listener, explaining the usual mistake with IPv6
+// addresses
+func listenTCP(network, addr string) (net.Listener, error) {
+	l, err := net.Listen(network, addr)
+	if err != nil && strings.Count(addr, ":") > 1 && !strings.HasPrefix(addr, "[") {
+		err = fmt.Errorf("%w (put IPv6 addresses in brackets, e.g. [::1]:8080)", err)
+	}
+	return l, err
+}
+
+// parseSocketMode parses LISTEN_SOCKET_MODE, an octal permission like 0660
+func parseSocketMode(v string) (os.FileMode, error) {
+	if v == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(v, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid LISTEN_SOCKET_MODE %q (expected octal permissions like 0660)", v)
+	}
+	return os.FileMode(mode), nil
+}
@@ -1,18 +1,32 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/chriskacerguis/hamqrzdb/internal/backup"
+	"github.com/chriskacerguis/hamqrzdb/internal/batch"
+	"github.com/chriskacerguis/hamqrzdb/internal/callsign"
+	"github.com/chriskacerguis/hamqrzdb/internal/maintenance"
+	"github.com/chriskacerguis/hamqrzdb/internal/notify"
+	"github.com/chriskacerguis/hamqrzdb/internal/paths"
+	_ "github.com/chriskacerguis/hamqrzdb/internal/sqlite"
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
 )
 
 // HamDBResponse represents the HamDB API response format
@@ -21,9 +35,19 @@ type HamDBResponse struct {
 }
 
 type HamDBData struct {
-	Version  string            `json:"version"`
-	Callsign CallsignData      `json:"callsign"`
-	Messages map[string]string `json:"messages"`
+	Version            string                     `json:"version"`
+	Callsign           CallsignData               `json:"callsign"`
+	SpecialConditions  []SpecialCondition         `json:"special_conditions,omitempty"`
+	Source             *RecordSource              `json:"source,omitempty"`
+	Records            []SourceRecord             `json:"records,omitempty"`
+	SpecialEvent       *SpecialEvent              `json:"special_event,omitempty"`
+	CommercialLicenses []CommercialLicense        `json:"commercial_licenses,omitempty"`
+	EQSL               *bool                      `json:"eqsl,omitempty"`
+	Programs           []ProgramBadge             `json:"programs,omitempty"`
+	Club               *ClubInfo                  `json:"club,omitempty"`
+	Provenance         map[string]FieldProvenance `json:"provenance,omitempty"`
+	ClassHistory       []ClassChange              `json:"class_history,omitempty"`
+	Messages           map[string]string          `json:"messages"`
 }
 
 type CallsignData struct {
@@ -43,11 +67,26 @@ type CallsignData struct {
 	State   string `json:"state"`
 	Zip     string `json:"zip"`
 	Country string `json:"country"`
+	// LicensedSince is the earliest grant date seen (YYYY-MM-DD); not part of HamDB
+	LicensedSince string `json:"licensed_since,omitempty"`
+	// PreferredName and QSLManager come from operator overrides; not part of HamDB
+	PreferredName string `json:"preferred_name,omitempty"`
+	QSLManager    string `json:"qsl_manager,omitempty"`
+	// EffectiveDate and LastActionDate are the ULS's (YYYY-MM-DD), returned
+	// by /v2 only
+	EffectiveDate  string `json:"-"`
+	LastActionDate string `json:"-"`
 }
 
 var (
 	db   *sql.DB
 	dbMu sync.RWMutex
+
+	// verifyMode selects the startup integrity check: "", "quick", or "full"
+	verifyMode string
+	// rejectedModTime remembers a database file that failed verification so
+	// the connector doesn't re-check it until the file changes
+	rejectedModTime time.Time
 )
 
 func setDB(d *sql.DB) {
@@ -63,26 +102,190 @@ func getDB() *sql.DB {
 }
 
 func main() {
+	install, uninstall := parseServiceFlags(os.Args[1:])
+
+	// Cancelled on SIGINT/SIGTERM to stop background work and drain the server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch {
+	case install:
+		if err := installService(); err != nil {
+			log.Fatalf("Failed to install service: %v", err)
+		}
+	case uninstall:
+		if err := uninstallService(); err != nil {
+			log.Fatalf("Failed to uninstall service: %v", err)
+		}
+	default:
+		if ok, err := runService(ctx, serve); ok {
+			if err != nil {
+				log.Fatalf("Service failed: %v", err)
+			}
+			return
+		}
+		serve(ctx)
+	}
+}
+
+// configuredDBPath returns DB_PATH, or the platform's default database path
+func configuredDBPath() string {
+	if p := os.Getenv("DB_PATH"); p != "" {
+		return p
+	}
+	return paths.DefaultDB("/data/hamqrzdb.sqlite")
+}
+
+// serve runs the API until ctx is cancelled
+func serve(ctx context.Context) {
 	// Get configuration from environment
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "/data/hamqrzdb.sqlite"
+	dbPath := configuredDBPath()
+
+	addrs := listenAddrs(os.Getenv)
+	socketMode, err := parseSocketMode(os.Getenv("LISTEN_SOCKET_MODE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// An optional CONFIG_FILE overrides the environment, and is read again
+	// on SIGHUP along with the settings that can change without a restart
+	configFile = os.Getenv("CONFIG_FILE")
+	if err := readConfigFile(configFile); err != nil {
+		log.Fatal(err)
+	}
+	s, err := loadSettings(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	active.Store(s)
+
+	if err := loadReadyMaxAge(os.Getenv); err != nil {
+		log.Fatal(err)
+	}
+
+	switch verifyMode = os.Getenv("VERIFY_ON_START"); verifyMode {
+	case "", "off":
+		verifyMode = ""
+	case "quick", "full":
+	default:
+		log.Fatalf("Invalid VERIFY_ON_START %q (expected off, quick, or full)", verifyMode)
+	}
+
+	// Optionally export OpenTelemetry traces (OTEL_EXPORTER_OTLP_ENDPOINT)
+	shutdownTracing, err := tracing.Init("hamqrzdb-api")
+	if err != nil {
+		log.Fatalf("Invalid tracing configuration: %v", err)
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownTracing(flushCtx)
+	}()
+
+	// Optionally back up to S3 after imports and restore a missing database
+	backupConfig, err = backup.LoadConfig(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// and run as a coordinator or worker, exchanging snapshots through it
+	cluster, err = loadClusterConfig(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Optionally email summaries of watched callsigns and failed imports
+	emailConfig, err = notify.LoadEmailConfig(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	summaries, err := loadSummaryConfig(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// and post import results to Discord or Slack
+	webhooks, err = notify.LoadWebhooks(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Optionally download a prebuilt database when none exists
+	bootstrap, err := loadBootstrapConfig(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// A missing database is restored from backup, or else bootstrapped
+	if dir := filepath.Dir(dbPath); dir != "." && dir != "" {
+		_ = os.MkdirAll(dir, 0o755)
+	}
+	if cluster.Role == roleStandalone {
+		restoreMissingDatabase(ctx, dbPath)
+	} else {
+		switch _, err := pullSnapshot(ctx, dbPath); {
+		case errors.Is(err, backup.ErrNoBackup):
+			log.Printf("No snapshot published in s3://%s yet", backupConfig.Bucket)
+		case err != nil:
+			log.Printf("Failed to pull the latest snapshot: %v", err)
+		}
+	}
+	bootstrapMissingDatabase(ctx, dbPath, bootstrap)
+
+	// Serve a database on a read-only volume without locking or a WAL
+	immutable, err = loadImmutable(os.Getenv, dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mmapSize, err := loadMmapSize(os.Getenv, immutable)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if immutable {
+		log.Printf("Serving %s as immutable (read-only volume)", dbPath)
+	}
+	registerAPIDriver(dbPath, mmapSize)
+
+	// Optionally share the lookup cache and rate limits with other replicas
+	if err := loadSharedCache(os.Getenv); err != nil {
+		log.Fatal(err)
+	}
+	if sharedCache != nil {
+		if err := sharedCache.Ping(ctx); err != nil {
+			log.Printf("Redis at %s not reachable yet: %v", sharedCache.Addr(), err)
+		} else {
+			log.Printf("Sharing the lookup cache and rate limits through Redis at %s", sharedCache.Addr())
+		}
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Optionally persist per-request usage for the /v1/usage summary
+	if usagePath := os.Getenv("USAGE_DB_PATH"); usagePath != "" {
+		if err := openUsageDB(ctx, usagePath); err != nil {
+			log.Printf("Usage persistence disabled: %v", err)
+		} else {
+			log.Printf("Persisting API usage to %s", usagePath)
+		}
+	}
+
+	// Optionally count NOT_FOUND callsigns for /admin/notfound-top
+	if notFoundPath := os.Getenv("NOT_FOUND_DB_PATH"); notFoundPath != "" {
+		if err := openNotFoundCounter(ctx, notFoundPath); err != nil {
+			log.Printf("NOT_FOUND counting disabled: %v", err)
+		} else {
+			log.Printf("Counting NOT_FOUND callsigns in %s", notFoundPath)
+		}
 	}
 
 	// Ensure database exists (create schema if missing) and open read-only connection
-	var err error
 	conn, err := ensureDatabase(dbPath)
 	if err != nil {
 		// Don't exit; start without DB and allow it to be created/populated later
 		log.Printf("Database not ready: %v", err)
 		setDB(nil)
+	} else if !verifyDatabase(ctx, conn, dbPath) {
+		_ = conn.Close()
+		setDB(nil)
 	} else {
 		setDB(conn)
+		noteServedFile(dbPath)
 	}
 	defer func() {
 		if d := getDB(); d != nil {
@@ -95,26 +298,265 @@ func main() {
 		d.SetMaxOpenConns(25)
 		d.SetMaxIdleConns(5)
 		d.SetConnMaxLifetime(5 * time.Minute)
-		if err := d.Ping(); err != nil {
+		if err := d.PingContext(ctx); err != nil {
+			if !immutable && readOnlyVolume(dbPath) {
+				err = fmt.Errorf("%w (%s is on a read-only volume; unset DB_IMMUTABLE or set it to true)", err, dbPath)
+			}
 			log.Printf("Failed to connect to database: %v", err)
 		} else {
 			log.Printf("Connected to database: %s", dbPath)
+			if info := servingBundle(ctx); info != nil {
+				log.Printf("Serving an offline bundle of %d callsigns (%s) built %s", info.Callsigns, info.Filter, info.BuiltAt)
+			}
 		}
 	}
 
 	// Start background connector to attach when DB becomes available
-	startDBConnector(dbPath)
+	startDBConnector(ctx, dbPath)
+
+	// Reopen when the database file is replaced (DB_WATCH_INTERVAL=0 to
+	// only check on SIGHUP)
+	watchInterval := 5 * time.Second
+	if v := os.Getenv("DB_WATCH_INTERVAL"); v != "" {
+		watchInterval, err = time.ParseDuration(v)
+		if err != nil || watchInterval < 0 {
+			log.Fatalf("Invalid DB_WATCH_INTERVAL %q", v)
+		}
+	}
+	startDBWatcher(ctx, dbPath, watchInterval)
 
 	// Setup HTTP handlers
-	http.HandleFunc("/v1/", corsMiddleware(handleCallsignLookup))
+	http.HandleFunc("/v1/", apiHandler(handleCallsignLookup))
+	http.HandleFunc("/v1/usage", corsMiddleware(requireAdmin(handleUsage)))
+	http.HandleFunc("/v1/new", apiHandler(handleNewLicensees))
+	http.HandleFunc("/v1/upgrades", apiHandler(handleUpgrades))
+	http.HandleFunc("/v1/cancelled", apiHandler(handleCancelled))
+	http.HandleFunc("/v1/sequential-forecast", apiHandler(handleSequentialForecast))
+	http.HandleFunc("/v1/nearby", apiHandler(handleNearby))
+	http.HandleFunc("/v1/exams", apiHandler(handleExams))
+	http.HandleFunc("/v1/search", apiHandler(handleSearch))
+	http.HandleFunc("/v1/fuzzy/", apiHandler(handleFuzzy))
+	http.HandleFunc("/v1/prefix/", apiHandler(handlePrefix))
+	http.HandleFunc("/v1/clubs/", apiHandler(handleClub))
+	http.HandleFunc("/v1/validate/us/", apiHandler(handleValidateUS))
+	http.HandleFunc("/v1/translations", apiHandler(handleTranslations))
+	// QRZ.com and HamQTH compatible XML lookups for loggers
+	http.HandleFunc("/xml/", apiHandler(handleQRZXML))
+	http.HandleFunc("/xml.php", apiHandler(handleHamQTHXML))
+
+	// /v2 always uses real status codes and the full error taxonomy
+	http.HandleFunc("/v2/", apiHandler(handleV2NotFound))
+	http.HandleFunc("/v2/callsign/", apiHandler(handleV2Callsign))
+	http.HandleFunc("/v2/new", apiHandler(handleNewLicensees))
+	http.HandleFunc("/v2/upgrades", apiHandler(handleUpgrades))
+	http.HandleFunc("/v2/cancelled", apiHandler(handleCancelled))
+	http.HandleFunc("/v2/sequential-forecast", apiHandler(handleSequentialForecast))
+	http.HandleFunc("/v2/nearby", apiHandler(handleNearby))
+	http.HandleFunc("/v2/exams", apiHandler(handleExams))
+	http.HandleFunc("/v2/search", apiHandler(handleSearch))
+	http.HandleFunc("/v2/fuzzy/", apiHandler(handleFuzzy))
+	http.HandleFunc("/v2/prefix/", apiHandler(handlePrefix))
+	http.HandleFunc("/v2/clubs/", apiHandler(handleClub))
+	http.HandleFunc("/v2/validate/us/", apiHandler(handleValidateUS))
+	http.HandleFunc("/v2/translations", apiHandler(handleTranslations))
 	http.HandleFunc("/health", corsMiddleware(handleHealth))
+	http.HandleFunc("/livez", corsMiddleware(handleLivez))
+	http.HandleFunc("/startupz", corsMiddleware(handleStartupz))
+	http.HandleFunc("/readyz", corsMiddleware(handleReadyz))
 	http.HandleFunc("/", corsMiddleware(handleIndex))
 
-	// Start server
-	log.Printf("Starting server on port %s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	// Admin endpoints (require ADMIN_TOKEN)
+	http.HandleFunc("/admin/status", requireAdmin(handleAdminStatus(dbPath)))
+	http.HandleFunc("/admin/notfound-top", requireAdmin(handleNotFoundTop))
+	dailyUpdate := leaderOnly(func(ctx context.Context) error {
+		if err := runImporter(ctx, dbPath, "--daily"); err != nil {
+			return err
+		}
+		return uploadBackup(ctx)
+	})
+	http.HandleFunc("/admin/update/daily", requireAdmin(handleAdminJob(ctx, "update-daily", dailyUpdate)))
+	http.HandleFunc("/admin/update/full", requireAdmin(handleAdminJob(ctx, "update-full", leaderOnly(func(ctx context.Context) error {
+		if err := runImporter(ctx, dbPath, "--full"); err != nil {
+			return err
+		}
+		return uploadBackup(ctx)
+	}))))
+	http.HandleFunc("/admin/vacuum", requireAdmin(handleAdminJob(ctx, "vacuum", func(ctx context.Context) error {
+		return maintainDatabase(ctx, dbPath, maintenance.Options{FullVacuum: true})
+	})))
+	http.HandleFunc("/admin/snapshot", requireReplication(handleAdminSnapshot(dbPath)))
+	defer removeSnapshot()
+	http.HandleFunc("/admin/backup", requireAdmin(handleAdminJob(ctx, "backup", func(ctx context.Context) error {
+		if !backupConfig.Enabled() {
+			return errors.New("backups aren't configured (BACKUP_S3_URL)")
+		}
+		return uploadBackup(ctx)
+	})))
+	http.HandleFunc("/admin/overrides", requireAdmin(handleAdminOverrides(dbPath)))
+	http.HandleFunc("/admin/clubs", requireAdmin(handleAdminClubs(dbPath)))
+	http.HandleFunc("/admin/update/eqsl", requireAdmin(handleAdminJob(ctx, "update-eqsl", leaderOnly(func(ctx context.Context) error {
+		return refreshEQSL(ctx, dbPath)
+	}))))
+
+	// SIGHUP reloads the config, SIGUSR1 runs a daily update
+	handleSignals(ctx, dailyUpdate)
+
+	// Optionally follow a primary, replacing the database with its snapshots
+	follow, err := loadFollowConfig(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if follow.Primary != "" && immutable {
+		log.Fatal("FOLLOW_URL can't be used with an immutable database; the follower must be able to replace it")
+	}
+	if follow.Primary != "" && cluster.Role != roleStandalone {
+		log.Fatalf("FOLLOW_URL can't be used with ROLE=%s; workers pull snapshots from BACKUP_S3_URL", cluster.Role)
+	}
+	if follow.Primary != "" {
+		log.Printf("Following %s every %s", follow.Primary, follow.Interval)
+		startFollower(ctx, dbPath, follow)
+	}
+
+	// In a cluster, one coordinator imports and the other instances pull
+	// what it publishes
+	if cluster.Role != roleStandalone && immutable {
+		log.Fatalf("ROLE=%s can't be used with an immutable database; snapshots must be able to replace it", cluster.Role)
+	}
+	if cluster.Role == roleCoordinator {
+		startLeaderElection(ctx)
+	}
+	if cluster.Role != roleStandalone {
+		log.Printf("Running as a %s, pulling snapshots from s3://%s every %s when not importing",
+			cluster.Role, backupConfig.Bucket, cluster.PollInterval)
+		startSnapshotPuller(ctx, dbPath, cluster.PollInterval)
+	}
+	if cluster.UpdateInterval > 0 {
+		log.Printf("Scheduled daily updates every %s", cluster.UpdateInterval)
+		startUpdateSchedule(ctx, cluster.UpdateInterval, dailyUpdate)
+	}
+
+	// Optionally run maintenance on a schedule (e.g. MAINTAIN_INTERVAL=24h)
+	if v := os.Getenv("MAINTAIN_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err == nil && interval <= 0 {
+			// time.NewTicker panics on a non-positive interval
+			err = errors.New("must be positive")
+		}
+		if err != nil {
+			log.Fatalf("Invalid MAINTAIN_INTERVAL %q: %v", v, err)
+		}
+		log.Printf("Scheduled maintenance every %s", interval)
+		startMaintenanceSchedule(ctx, dbPath, interval)
+	}
+
+	// Optionally refresh the eQSL AG member list (e.g. EQSL_REFRESH_INTERVAL=24h)
+	if v := os.Getenv("EQSL_REFRESH_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err == nil && interval <= 0 {
+			// time.NewTicker panics on a non-positive interval
+			err = errors.New("must be positive")
+		}
+		if err != nil {
+			log.Fatalf("Invalid EQSL_REFRESH_INTERVAL %q: %v", v, err)
+		}
+		log.Printf("Scheduled eQSL AG list refresh every %s", interval)
+		startJobSchedule(ctx, "update-eqsl", interval, leaderOnly(func(ctx context.Context) error {
+			return refreshEQSL(ctx, dbPath)
+		}))
+	}
+
+	// Optionally back up on a schedule too, e.g. BACKUP_INTERVAL=1h to
+	// capture override uploads between imports
+	if v := os.Getenv("BACKUP_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err == nil && interval <= 0 {
+			// time.NewTicker panics on a non-positive interval
+			err = errors.New("must be positive")
+		}
+		if err != nil {
+			log.Fatalf("Invalid BACKUP_INTERVAL %q: %v", v, err)
+		}
+		if !backupConfig.Enabled() {
+			log.Fatal("BACKUP_INTERVAL requires BACKUP_S3_URL")
+		}
+		log.Printf("Scheduled backups every %s", interval)
+		startJobSchedule(ctx, "backup", interval, uploadBackup)
+	}
+
+	if emailConfig.Enabled() {
+		log.Printf("Emailing summaries to %s every %s", strings.Join(emailConfig.To, ", "), summaries.Interval)
+		startEmailSummaries(ctx, summaries)
+	}
+	if len(webhooks) > 0 {
+		log.Printf("Posting import results to %d webhooks", len(webhooks))
+		startWebhookNotifier(ctx, dbPath)
+	}
+
+	// Optionally answer TXT queries for callsigns (DNS_LISTEN and DNS_ZONE)
+	dnsConfig, err := loadDNSConfig(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if dnsConfig.Listen != "" {
+		if err := startDNS(ctx, dnsConfig); err != nil {
+			log.Fatalf("Failed to start the DNS responder on %s: %v", dnsConfig.Listen, err)
+		}
+		log.Printf("Answering DNS TXT queries for *.%s on %s", dnsConfig.Zone, dnsConfig.Listen)
+	}
+
+	// Optionally serve the telnet lookup console (TELNET_LISTEN)
+	if addr := os.Getenv("TELNET_LISTEN"); addr != "" {
+		if err := startTelnet(ctx, addr); err != nil {
+			log.Fatalf("Failed to start the telnet console on %s: %v", addr, err)
+		}
+		log.Printf("Serving the telnet console on %s", addr)
+	}
+
+	// Open every listener up front so a bad address fails before serving
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		l, err := listen(addr, socketMode)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", addr, err)
+		}
+		listeners = append(listeners, l)
 	}
+
+	// Requests don't inherit ctx: a shutdown signal must let in-flight
+	// lookups finish, not cancel them
+	srv := &http.Server{
+		Handler: tracing.HTTPMiddleware(requestIDMiddleware(accessLogMiddleware(http.DefaultServeMux))),
+	}
+
+	// Drain in-flight requests once a shutdown signal arrives
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		log.Println("Shutting down server...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Server shutdown error: %v", err)
+		}
+	}()
+
+	// Start server; Shutdown closes every listener, removing unix sockets
+	errc := make(chan error, len(listeners))
+	for i, l := range listeners {
+		log.Printf("Starting server on %s", addrs[i])
+		go func(l net.Listener) {
+			errc <- srv.Serve(l)
+		}(l)
+	}
+	for range listeners {
+		if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}
+	// Serve returns as soon as Shutdown closes the listeners; wait for
+	// the requests still running
+	<-drained
 }
 
 // ensureDatabase verifies the database file exists at path. If it doesn't,
@@ -132,7 +574,7 @@ func ensureDatabase(dbPath string) (*sql.DB, error) {
 	}
 
 	// Open read-only connection for serving
-	ro, err := sql.Open("sqlite3", dbPath+"?cache=shared&mode=ro")
+	ro, err := sql.Open(apiDriver, servingDSN(dbPath))
 	if err != nil {
 		// Provide a clearer hint if the failure is due to read-only mount on first start
 		return nil, fmt.Errorf("failed to open database (read-only). If this is first start, ensure the DB file is writable or pre-created at %s: %w", dbPath, err)
@@ -146,14 +588,19 @@ func ensureDatabase(dbPath string) (*sql.DB, error) {
 // startDBConnector periodically attempts to connect to the database in read-only
 // mode. This allows the API to start before the DB exists and attach later once
 // the database file is created/populated by a separate process.
-func startDBConnector(dbPath string) {
+func startDBConnector(ctx context.Context, dbPath string) {
 	go func() {
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
-		for range ticker.C {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
 			if getDB() != nil {
 				// Optionally verify connection remains healthy
-				if err := getDB().Ping(); err != nil {
+				if err := getDB().PingContext(ctx); err != nil {
 					log.Printf("Database connection lost: %v", err)
 					d := getDB()
 					if d != nil {
@@ -164,26 +611,80 @@ func startDBConnector(dbPath string) {
 				continue
 			}
 			// Attempt to connect
-			conn, err := sql.Open("sqlite3", dbPath+"?cache=shared&mode=ro")
+			conn, err := sql.Open(apiDriver, servingDSN(dbPath))
 			if err != nil {
 				continue
 			}
-			if err := conn.Ping(); err != nil {
+			if err := conn.PingContext(ctx); err != nil {
 				_ = conn.Close()
 				continue
 			}
+			if !verifyDatabase(ctx, conn, dbPath) {
+				_ = conn.Close()
+				continue
+			}
+			// Recycle connections so rebuilt shards are picked up
+			conn.SetConnMaxLifetime(5 * time.Minute)
 			setDB(conn)
+			noteServedFile(dbPath)
 			log.Printf("Database connected: %s", dbPath)
 		}
 	}()
 }
 
-// corsMiddleware adds CORS headers to all responses
+// verifyDatabase runs the VERIFY_ON_START check against a freshly opened
+// connection and reports whether it is safe to serve from. A database that
+// fails is not re-checked until its modification time changes.
+func verifyDatabase(ctx context.Context, conn *sql.DB, dbPath string) bool {
+	if verifyMode == "" {
+		return true
+	}
+
+	fi, err := os.Stat(dbPath)
+	if err == nil && fi.ModTime().Equal(rejectedModTime) {
+		return false
+	}
+
+	log.Printf("Verifying database (%s check)...", verifyMode)
+	report, err := maintenance.Verify(ctx, conn, maintenance.VerifyOptions{Quick: verifyMode == "quick"})
+	if err != nil {
+		log.Printf("Database verification could not run: %v", err)
+		return false
+	}
+	for _, w := range report.Warnings {
+		log.Printf("Database warning: %s", w)
+	}
+	if !report.OK() {
+		for _, p := range report.Problems {
+			log.Printf("Database problem: %s", p)
+		}
+		log.Printf("Refusing to serve %s until it is repaired or replaced", dbPath)
+		if fi != nil {
+			rejectedModTime = fi.ModTime()
+		}
+		return false
+	}
+
+	log.Printf("Database verification passed")
+	return true
+}
+
+// corsMiddleware adds CORS headers to all responses. Only origins in
+// CORS_ORIGINS are echoed back; the default allows any origin.
 func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		cors := cfg().cors
+		origin := cors.allowOrigin(r.Header.Get("Origin"))
+		if origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", cors.Methods)
+			w.Header().Set("Access-Control-Allow-Headers", cors.Headers)
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+		}
+		// The response depends on the Origin header unless every origin is allowed
+		if origin != "*" {
+			w.Header().Add("Vary", "Origin")
+		}
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -197,79 +698,290 @@ func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 // handleCallsignLookup handles /v1/{callsign}/json/{app} or /v1/{callsign}/json requests
 func handleCallsignLookup(w http.ResponseWriter, r *http.Request) {
 	// Parse URL path: /v1/{callsign}/json/{app} or /v1/{callsign}/json
-	path := strings.TrimPrefix(r.URL.Path, "/v1/")
-	parts := strings.Split(path, "/")
+	parts := splitV1Path(r.URL.EscapedPath())
+
+	// Other per-callsign resources: /v1/{callsign}/{resource}
+	if len(parts) >= 2 {
+		switch parts[1] {
+		case "comments":
+			handleComments(w, r, baseCall(parts[0]))
+			return
+		case "repeaters":
+			handleRepeaters(w, r, baseCall(parts[0]))
+			return
+		case "memberships":
+			handleMemberships(w, r, baseCall(parts[0]))
+			return
+		case "references":
+			handleReferences(w, r, baseCall(parts[0]))
+			return
+		case "text":
+			handleCallsignText(w, r, baseCall(parts[0]))
+			return
+		case "custom":
+			app := ""
+			if len(parts) > 2 {
+				app = parts[2]
+			}
+			handleCallsignCustom(w, r, baseCall(parts[0]), app)
+			return
+		case "qsl.pdf":
+			handleQSLLabel(w, r, baseCall(parts[0]))
+			return
+		case "vcf":
+			handleCallsignVCard(w, r, baseCall(parts[0]))
+			return
+		case "qr.png":
+			handleCallsignQR(w, r, baseCall(parts[0]))
+			return
+		}
+	}
 
 	// Need at least callsign and "json"
 	if len(parts) < 2 || parts[1] != "json" {
-		writeNotFound(w, "INVALID_URL")
+		writeInvalidURL(w, r)
 		return
 	}
 
-	callsign := strings.ToUpper(parts[0])
+	call := baseCall(parts[0])
 
-	// Look up callsign in database
-	data, found := lookupCallsign(callsign)
-	if !found {
-		writeNotFound(w, callsign)
+	out, err := parseOutputOptions(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
 		return
 	}
 
+	// Bound the lookup; the request context is also cancelled if the client disconnects
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	// Look up callsign in database. ?source= picks one data source's record;
+	// ?all=1 also returns every source's record for the callsign.
+	source := strings.ToUpper(r.URL.Query().Get("source"))
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+
+	var records []SourceRecord
+	if all {
+		records = lookupRecords(ctx, call, source)
+	} else if rec, ok := lookupCallsign(ctx, call, source); ok {
+		records = []SourceRecord{rec}
+	}
+	if len(records) == 0 {
+		// 1x1 special event calls aren't licenses; answer from the event data
+		if event := lookupSpecialEvent(ctx, call); event != nil && source == "" {
+			writeLookupJSON(w, r, out.render(HamDBData{
+				Version:      "1",
+				Callsign:     eventCallsignData(call, event),
+				SpecialEvent: event,
+				Messages:     lookupMessages(ctx, r, "OK"),
+			}))
+			return
+		}
+		writeNotFound(w, r, call)
+		return
+	}
+	data := records[0]
+	override := lookupOverride(ctx, data.Call)
+	override.apply(&data.CallsignData)
+
 	// Return successful response
-	response := HamDBResponse{
-		HamDB: HamDBData{
-			Version:  "1",
-			Callsign: data,
-			Messages: map[string]string{"status": "OK"},
-		},
+	response := HamDBData{
+		Version:  "1",
+		Callsign: data.CallsignData,
+		Source:   lookupSource(ctx, data.Call, data.DataSource),
+		Messages: lookupMessages(ctx, r, "OK"),
+	}
+	// Special conditions come from the FCC and don't apply to other sources
+	if data.DataSource == batch.FCC || data.DataSource == "" {
+		response.SpecialConditions = lookupSpecialConditions(ctx, data.Call)
+	}
+	if data.DataSource == batch.FCC {
+		response.CommercialLicenses = lookupCommercialLicenses(ctx, data.Call)
+	}
+	response.EQSL = lookupEQSL(ctx, data.Call)
+	response.Programs = lookupProgramBadges(ctx, data.Call)
+	response.Club = lookupClub(ctx, data.Call)
+	if verbose, _ := strconv.ParseBool(r.URL.Query().Get("verbose")); verbose {
+		response.Provenance = fieldProvenance(data, response.Source, override)
+		response.ClassHistory = lookupClassHistory(ctx, data)
+	}
+	if all {
+		response.Records = records
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	writeLookupJSON(w, r, out.render(response))
+}
+
+// splitV1Path splits an escaped /v1/ request path into unescaped segments, so
+// a portable call sent as W1AW%2F7 stays a single segment
+func splitV1Path(escaped string) []string {
+	parts := strings.Split(strings.TrimPrefix(escaped, "/v1/"), "/")
+	for i, part := range parts {
+		if p, err := url.PathUnescape(part); err == nil {
+			parts[i] = p
+		}
+	}
+	return parts
 }
 
-// lookupCallsign queries the database for a callsign (case-insensitive)
-func lookupCallsign(callsign string) (CallsignData, bool) {
-	if getDB() == nil {
+// baseCall resolves a requested callsign to the licensed base call, so
+// W1AW/7 and EA8/KJ5DJC/P look up W1AW and KJ5DJC. Input that doesn't parse
+// as a callsign is looked up as-is.
+func baseCall(s string) string {
+	if base := callsign.Base(s); base != "" {
+		return base
+	}
+	return strings.ToUpper(strings.TrimSpace(s))
+}
+
+// SourceRecord is one data source's record for a callsign
+type SourceRecord struct {
+	CallsignData
+	DataSource string `json:"data_source"`
+}
+
+// lookupCallsign returns the preferred record for a callsign
+// (case-insensitive), optionally restricted to one data source
+func lookupCallsign(ctx context.Context, callsign, source string) (SourceRecord, bool) {
+	records := lookupRecords(ctx, callsign, source)
+	if len(records) == 0 {
+		return SourceRecord{}, false
+	}
+	return records[0], true
+}
+
+// lookupRecords returns every record for a callsign, one per data source.
+// Active licenses sort first, then by data source, so the first record is
+// the one a single-record lookup returns.
+func lookupRecords(ctx context.Context, callsign, source string) []SourceRecord {
+	d := getDB()
+	if d == nil {
 		// DB not ready yet
-		return CallsignData{}, false
+		return nil
 	}
+
+	records, err := cachedQueryRecords(ctx, d, callsign, source)
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("Lookup for %s (request %s) cancelled: %v", callsign, requestIDFrom(ctx), err)
+		} else {
+			log.Printf("Database error looking up %s (request %s): %v", callsign, requestIDFrom(ctx), err)
+		}
+		return nil
+	}
+
+	if len(records) == 0 {
+		log.Printf("No rows found for callsign: %s", callsign)
+		return nil
+	}
+
+	log.Printf("Successfully found callsign: %s (status: %s, class: %s, records: %d)",
+		records[0].Call, records[0].Status, records[0].Class, len(records))
+	return records
+}
+
+// queryRecords reads every record for a callsign in lookupRecords order
+func queryRecords(ctx context.Context, d *sql.DB, callsign, source string) ([]SourceRecord, error) {
 	query := `
-		SELECT 
-			callsign, license_status, expired_date, operator_class,
-			grid_square, latitude, longitude,
-			first_name, mi, last_name, suffix,
-			street_address, city, state, zip_code, 'United States' as country
+		SELECT ` + recordColumns(ctx, d) + `
 		FROM callsigns
-		WHERE UPPER(callsign) = UPPER(?)
-		LIMIT 1
+		WHERE UPPER(callsign) = UPPER(?1) AND (?2 = '' OR ` + sourceExpr(ctx, d) + ` = ?2)
 	`
+	// GMRS licenses live in their own table; they have no class or location
+	if hasColumn(ctx, d, "gmrs_licenses", "callsign") {
+		redaction := cfg().redaction
+		country, name := "'United States'", redaction.Names.Column
+		redactedGMRSColumns := name("first_name", country) + ", " + name("mi", country) + ", " +
+			name("last_name", country) + ", " + name("suffix", country) + ", " +
+			redaction.Addresses.Column("street_address", country)
+		query += `
+		UNION ALL
+		SELECT
+			callsign, COALESCE(license_status, ''), expired_date, '',
+			NULL, NULL, NULL,
+			` + redactedGMRSColumns + `, city, state, zip_code, 'United States',
+			'` + batch.GMRS + `', COALESCE(licensed_since, ''), ` + ulsDateColumns(ctx, d, "gmrs_licenses") + `
+		FROM gmrs_licenses
+		WHERE UPPER(callsign) = UPPER(?1) AND (?2 = '' OR ?2 = '` + batch.GMRS + `')
+		`
+	}
+	query = `SELECT * FROM (` + query + `) ORDER BY status = 'A' DESC, source = '', source`
 
-	var data CallsignData
+	rows, err := d.QueryContext(ctx, query, callsign, source)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRecords(rows)
+}
+
+// sourceExpr returns the SQL expression for a callsigns row's data source,
+// which is empty on databases that predate source tracking
+func sourceExpr(ctx context.Context, d *sql.DB) string {
+	if hasColumn(ctx, d, "callsigns", "data_source") {
+		return "COALESCE(data_source, '')"
+	}
+	return "''"
+}
+
+// recordColumns returns the callsigns select list read by scanRecords
+func recordColumns(ctx context.Context, d *sql.DB) string {
+	licensedExpr := "''"
+	if hasColumn(ctx, d, "callsigns", "licensed_since") {
+		licensedExpr = "COALESCE(licensed_since, '')"
+	}
+	country := countryExpr(ctx, d)
+	redaction := cfg().redaction
+	address, name := redaction.Addresses.Column, redaction.Names.Column
+	return `
+			callsign, COALESCE(license_status, '') AS status, expired_date, COALESCE(operator_class, ''),
+			grid_square, ` + address("latitude", country) + `, ` + address("longitude", country) + `,
+			` + name("first_name", country) + `, ` + name("mi", country) + `, ` + name("last_name", country) + `, ` + name("suffix", country) + `,
+			` + address("street_address", country) + `, city, state, zip_code, ` + country + ` as country,
+			` + sourceExpr(ctx, d) + ` as source, ` + licensedExpr + `, ` + ulsDateColumns(ctx, d, "callsigns")
+}
+
+// ulsDateColumns returns the select list of a table's ISO effective and last
+// action dates, which are empty on databases that predate them
+func ulsDateColumns(ctx context.Context, d *sql.DB, table string) string {
+	if !hasColumn(ctx, d, table, "last_action_date_iso") {
+		return "'', ''"
+	}
+	return "COALESCE(effective_date_iso, ''), COALESCE(last_action_date_iso, '')"
+}
+
+// scanRecords reads rows selected with recordColumns
+func scanRecords(rows *sql.Rows) ([]SourceRecord, error) {
+	var records []SourceRecord
+	for rows.Next() {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+// scanRecord reads the current row of rows selected with recordColumns
+func scanRecord(rows *sql.Rows) (SourceRecord, error) {
+	var rec SourceRecord
+	data := &rec.CallsignData
 	var lat, lon sql.NullFloat64
 	var gridSquare, expiredDate, mi, suffix, streetAddress, city, state, zipCode sql.NullString
 	var firstName, lastName sql.NullString
 
-	err := getDB().QueryRow(query, callsign).Scan(
+	err := rows.Scan(
 		&data.Call, &data.Status, &expiredDate, &data.Class,
 		&gridSquare, &lat, &lon,
 		&firstName, &mi, &lastName, &suffix,
 		&streetAddress, &city, &state, &zipCode, &data.Country,
+		&rec.DataSource, &data.LicensedSince, &data.EffectiveDate, &data.LastActionDate,
 	)
-
-	if err == sql.ErrNoRows {
-		log.Printf("No rows found for callsign: %s", callsign)
-		return CallsignData{}, false
-	}
-
 	if err != nil {
-		log.Printf("Database error looking up %s: %v", callsign, err)
-		return CallsignData{}, false
+		return rec, err
 	}
 
-	log.Printf("Successfully found callsign: %s (status: %s, class: %s)", data.Call, data.Status, data.Class)
-
 	// Convert nullable fields to strings
 	if firstName.Valid {
 		data.FName = firstName.String
@@ -307,10 +1019,23 @@ func lookupCallsign(callsign string) (CallsignData, bool) {
 	if zipCode.Valid {
 		data.Zip = zipCode.String
 	}
+	return rec, nil
+}
+
+// writeNotFound writes a NOT_FOUND response. In strict mode that's a 404
+// with a structured error body instead of the HamDB NOT_FOUND record; the
+// flat shape always uses the error body.
+func writeNotFound(w http.ResponseWriter, r *http.Request, callsign string) {
+	markNotFound(w)
+	if strict := isStrict(r); strict || requestFormat(r) == formatFlat {
+		status := http.StatusOK
+		if strict {
+			status = http.StatusNotFound
+		}
+		writeError(w, r, status, codeNotFound, "callsign "+callsign+" not found")
+		return
+	}
 
-	return data, true
-} // writeNotFound writes a NOT_FOUND response
-func writeNotFound(w http.ResponseWriter, callsign string) {
 	response := HamDBResponse{
 		HamDB: HamDBData{
 			Version: "1",
@@ -332,20 +1057,21 @@ func writeNotFound(w http.ResponseWriter, callsign string) {
 				Zip:     "NOT_FOUND",
 				Country: "NOT_FOUND",
 			},
-			Messages: map[string]string{"status": "NOT_FOUND"},
+			Messages: lookupMessages(r.Context(), r, "NOT_FOUND"),
 		},
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, r, http.StatusOK, response)
 }
 
 // handleHealth handles /health requests
 func handleHealth(w http.ResponseWriter, r *http.Request) {
 	// Test database connection
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
 	d := getDB()
-	if d == nil || d.Ping() != nil {
+	if d == nil || d.PingContext(ctx) != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusServiceUnavailable)
 		json.NewEncoder(w).Encode(map[string]string{
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Membership is a callsign's member number in a club or award program
+type Membership struct {
+	Organization string `json:"organization"`
+	Number       string `json:"number"`
+	Name         string `json:"name,omitempty"`
+	Since        string `json:"since,omitempty"`
+}
+
+// handleMemberships handles /v1/{callsign}/memberships requests: the club
+// and award program numbers (SKCC, FISTS, POTA, ...) imported for a callsign
+func handleMemberships(w http.ResponseWriter, r *http.Request, callsign string) {
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	memberships := []Membership{}
+	status := "OK"
+
+	if d := getDB(); d != nil {
+		rows, err := d.QueryContext(ctx, `
+			SELECT organization, number, COALESCE(name, ''), COALESCE(since, '')
+			FROM memberships
+			WHERE callsign = ?
+			ORDER BY organization
+		`, callsign)
+		if err != nil {
+			// Databases without a roster import have no memberships table
+			if !strings.Contains(err.Error(), "no such table") {
+				log.Printf("Database error looking up memberships for %s: %v", callsign, err)
+			}
+		} else {
+			defer rows.Close()
+			for rows.Next() {
+				var m Membership
+				if err := rows.Scan(&m.Organization, &m.Number, &m.Name, &m.Since); err != nil {
+					log.Printf("Error scanning membership for %s: %v", callsign, err)
+					break
+				}
+				memberships = append(memberships, m)
+			}
+		}
+	}
+
+	if len(memberships) == 0 {
+		status = "NOT_FOUND"
+		markNotFound(w)
+	}
+
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"callsign":    callsign,
+		"memberships": memberships,
+		"messages":    map[string]string{"status": status},
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/geo"
+)
+
+// Nearby is an active licensee returned by /v1/nearby
+type Nearby struct {
+	Call     string  `json:"call"`
+	Class    string  `json:"class"`
+	FName    string  `json:"fname"`
+	Name     string  `json:"name"`
+	City     string  `json:"city"`
+	State    string  `json:"state"`
+	Grid     string  `json:"grid"`
+	Distance float64 `json:"distance"`
+	Bearing  int     `json:"bearing"`
+}
+
+// Limits for /v1/nearby
+const (
+	maxNearbyRadius = 500
+	kmPerMile       = 1.609344
+)
+
+// handleNearby handles /v1/nearby requests: active licensees within ?radius=
+// (default 50) of the centre of ?mygrid=, nearest first. Distances are
+// computed from the caller's grid square only, so clients never send their
+// coordinates. ?units=mi switches the radius and distances to miles.
+func handleNearby(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	grid := strings.TrimSpace(q.Get("mygrid"))
+	if !validGridPrefix(strings.ToUpper(grid)) {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter, "mygrid must be a Maidenhead locator such as EM10ci", "mygrid")
+		return
+	}
+	myLat, myLon, err := geo.GridCenter(grid)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+
+	units := strings.ToLower(q.Get("units"))
+	scale := 1.0
+	switch units {
+	case "", "km":
+		units = "km"
+	case "mi":
+		scale = kmPerMile
+	default:
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter, "units must be km or mi", "units")
+		return
+	}
+
+	radius, err := positiveParam(q.Get("radius"), 50)
+	if err != nil || float64(radius)*scale > maxNearbyRadius {
+		writeError(w, r, http.StatusBadRequest, codeInvalidParameter,
+			"radius must be a positive integer of at most "+strconv.Itoa(maxNearbyRadius)+" km")
+		return
+	}
+	list, err := parseListParams[Nearby](r, 100)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+	radiusKm := float64(radius) * scale
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	d := getDB()
+	if d == nil {
+		writeError(w, r, http.StatusServiceUnavailable, codeDBUnavailable, "database not connected")
+		return
+	}
+
+	// The bounding box uses the latitude/longitude index (the unary + keeps
+	// SQLite from picking the far less selective status index); exact
+	// distances are computed below
+	minLat, maxLat, minLon, maxLon := geo.BoundingBox(myLat, myLon, radiusKm)
+	country, redaction := countryExpr(ctx, d), cfg().redaction
+	if redaction.Addresses.Enabled() {
+		// Redacted records are measured from their subsquare's centre, so
+		// whether one is returned must not depend on where in the subsquare
+		// its real coordinates are. Widening the box by a subsquare (2.5'
+		// of latitude by 5' of longitude) takes in every record whose
+		// subsquare centre is in range.
+		minLat, maxLat = math.Max(minLat-1.0/24, -90), math.Min(maxLat+1.0/24, 90)
+		if minLon, maxLon = minLon-1.0/12, maxLon+1.0/12; minLon < -180 || maxLon > 180 {
+			minLon, maxLon = -180, 180
+		}
+	}
+	rows, err := d.QueryContext(ctx, `
+		SELECT callsign, COALESCE(operator_class, ''),
+			COALESCE(`+redaction.Names.Column("first_name", country)+`, ''),
+			COALESCE(`+redaction.Names.Column("last_name", country)+`, ''),
+			COALESCE(city, ''), COALESCE(state, ''), COALESCE(grid_square, ''),
+			`+redaction.Addresses.Column("latitude", country)+`, `+redaction.Addresses.Column("longitude", country)+`
+		FROM callsigns
+		WHERE latitude BETWEEN ? AND ?
+		  AND longitude BETWEEN ? AND ?
+		  AND +license_status = 'A'
+	`, minLat, maxLat, minLon, maxLon)
+	if err != nil {
+		log.Printf("Nearby query failed: %v", err)
+		writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "nearby query failed")
+		return
+	}
+	defer rows.Close()
+
+	nearby := []Nearby{}
+	for rows.Next() {
+		var n Nearby
+		var lat, lon sql.NullFloat64
+		if err := rows.Scan(&n.Call, &n.Class, &n.FName, &n.Name, &n.City, &n.State, &n.Grid, &lat, &lon); err != nil {
+			log.Printf("Nearby scan failed: %v", err)
+			continue
+		}
+		// Redacted coordinates would locate the address; measure from the
+		// centre of the licensee's subsquare instead. A coarser grid could
+		// put that centre outside the widened box.
+		if !lat.Valid || !lon.Valid {
+			if len(n.Grid) < 6 {
+				continue
+			}
+			var err error
+			if lat.Float64, lon.Float64, err = geo.GridCenter(n.Grid); err != nil {
+				continue
+			}
+		}
+		km := geo.Distance(myLat, myLon, lat.Float64, lon.Float64)
+		if km > radiusKm {
+			continue
+		}
+		n.Distance = math.Round(km/scale*10) / 10
+		n.Bearing = int(math.Round(geo.Bearing(myLat, myLon, lat.Float64, lon.Float64))) % 360
+		nearby = append(nearby, n)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Nearby query failed: %v", err)
+		writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "nearby query failed")
+		return
+	}
+
+	// Nearest first; ?sort= reorders the page after this
+	sort.SliceStable(nearby, func(i, j int) bool {
+		if nearby[i].Distance != nearby[j].Distance {
+			return nearby[i].Distance < nearby[j].Distance
+		}
+		return nearby[i].Call < nearby[j].Call
+	})
+
+	writeList(w, r, "nearby", nearby, list, map[string]interface{}{
+		"mygrid": grid,
+		"radius": radius,
+		"units":  units,
+	})
+}
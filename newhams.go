@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewLicensee is a recently licensed operator returned by /v1/new
+type NewLicensee struct {
+	Call          string `json:"call"`
+	Class         string `json:"class"`
+	FName         string `json:"fname"`
+	Name          string `json:"name"`
+	City          string `json:"city"`
+	State         string `json:"state"`
+	Grid          string `json:"grid"`
+	Country       string `json:"country"`
+	LicensedSince string `json:"licensed_since"`
+	DataSource    string `json:"data_source"`
+}
+
+// handleNewLicensees handles /v1/new requests: active licensees first licensed
+// within the last ?days= (default 30), optionally near ?grid= (a grid square
+// prefix such as EM10) or in ?state=
+func handleNewLicensees(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	days, err := positiveParam(q.Get("days"), 30)
+	if err != nil {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter, "days must be a positive integer", "days")
+		return
+	}
+	list, err := parseListParams[NewLicensee](r, 100)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+	grid := strings.ToUpper(strings.TrimSpace(q.Get("grid")))
+	if grid != "" && !validGridPrefix(grid) {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter, "grid must be a Maidenhead locator prefix such as EM10", "grid")
+		return
+	}
+	state := strings.ToUpper(strings.TrimSpace(q.Get("state")))
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	d := getDB()
+	if d == nil {
+		writeError(w, r, http.StatusServiceUnavailable, codeDBUnavailable, "database not connected")
+		return
+	}
+	if !hasColumn(ctx, d, "callsigns", "licensed_since") {
+		writeError(w, r, http.StatusServiceUnavailable, codeUnsupportedDatabase,
+			"database predates licensed_since; run an importer to migrate it")
+		return
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -days).Format("2006-01-02")
+	country, redaction := countryExpr(ctx, d), cfg().redaction
+	rows, err := d.QueryContext(ctx, `
+		SELECT callsign, COALESCE(operator_class, ''),
+			COALESCE(`+redaction.Names.Column("first_name", country)+`, ''),
+			COALESCE(`+redaction.Names.Column("last_name", country)+`, ''),
+			COALESCE(city, ''), COALESCE(state, ''), COALESCE(grid_square, ''),
+			`+country+`, licensed_since, COALESCE(data_source, '')
+		FROM callsigns
+		WHERE licensed_since >= ?
+		  AND license_status = 'A'
+		  AND (? = '' OR UPPER(grid_square) LIKE ? || '%')
+		  AND (? = '' OR UPPER(state) = ?)
+		ORDER BY licensed_since DESC, callsign
+		LIMIT ?
+	`, since, grid, grid, state, state, maxListMatches)
+	if err != nil {
+		log.Printf("New licensee query failed: %v", err)
+		writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "new licensee query failed")
+		return
+	}
+	defer rows.Close()
+
+	out := newListWriter[NewLicensee](w, r, "new", list)
+	for rows.Next() {
+		var n NewLicensee
+		if err := rows.Scan(&n.Call, &n.Class, &n.FName, &n.Name, &n.City, &n.State, &n.Grid,
+			&n.Country, &n.LicensedSince, &n.DataSource); err != nil {
+			log.Printf("New licensee scan failed: %v", err)
+			continue
+		}
+		if out.add(n) {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("New licensee query failed: %v", err)
+		if !out.started() {
+			writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "new licensee query failed")
+		}
+		return
+	}
+
+	out.finish(map[string]interface{}{"since": since})
+}
+
+// positiveParam parses an optional positive integer query parameter
+func positiveParam(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, strconv.ErrSyntax
+	}
+	return n, nil
+}
+
+// validGridPrefix reports whether s is a 2, 4, or 6 character Maidenhead
+// locator prefix (field, square, subsquare)
+func validGridPrefix(s string) bool {
+	if len(s) != 2 && len(s) != 4 && len(s) != 6 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch i {
+		case 0, 1:
+			if c < 'A' || c > 'R' {
+				return false
+			}
+		case 2, 3:
+			if c < '0' || c > '9' {
+				return false
+			}
+		case 4, 5:
+			if c < 'A' || c > 'X' {
+				return false
+			}
+		}
+	}
+	return true
+}
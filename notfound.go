@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/callsign"
+)
+
+// notFoundSink receives the callsign of every NOT_FOUND lookup. It must not
+// block the request.
+type notFoundSink interface {
+	notFound(call string)
+}
+
+// notFoundSinks are told about NOT_FOUND lookups by the access log
+var notFoundSinks []notFoundSink
+
+// recordNotFound passes a NOT_FOUND callsign to every sink
+func recordNotFound(call string) {
+	for _, s := range notFoundSinks {
+		s.notFound(call)
+	}
+}
+
+// notFoundMaxPending caps the distinct callsigns counted between flushes, so
+// a scan of random callsigns can't grow memory without bound
+const notFoundMaxPending = 10000
+
+// notFoundRetentionDays is how long daily counts are kept
+const notFoundRetentionDays = 400
+
+// notFoundCounter counts NOT_FOUND callsigns per day in the
+// not_found_callsigns table of a writable database. Nothing about the client
+// is stored.
+type notFoundCounter struct {
+	db *sql.DB
+
+	mu      sync.Mutex
+	pending map[string]int
+	dropped int
+}
+
+// notFoundDB is the counter's database, read by /admin/notfound-top; nil
+// when NOT_FOUND_DB_PATH is unset
+var notFoundDB *sql.DB
+
+// openNotFoundCounter opens (creating if needed) the database NOT_FOUND
+// counts are kept in, which may be the usage database, and registers the
+// counter as a sink
+func openNotFoundCounter(ctx context.Context, path string) error {
+	conn, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return fmt.Errorf("failed to open not found database: %w", err)
+	}
+
+	schema := `
+	CREATE TABLE IF NOT EXISTS not_found_callsigns (
+		day TEXT NOT NULL,
+		callsign TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		count INTEGER NOT NULL,
+		PRIMARY KEY (day, callsign)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_not_found_prefix ON not_found_callsigns(day, prefix);
+	`
+	if _, err := conn.ExecContext(ctx, schema); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to create not found schema: %w", err)
+	}
+
+	c := &notFoundCounter{db: conn, pending: make(map[string]int)}
+	notFoundDB = conn
+	notFoundSinks = append(notFoundSinks, c)
+	go c.run(ctx)
+	return nil
+}
+
+func (c *notFoundCounter) notFound(call string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pending[call]; !ok && len(c.pending) >= notFoundMaxPending {
+		c.dropped++
+		return
+	}
+	c.pending[call]++
+}
+
+// run flushes the counts every 30 seconds, and once more on shutdown
+func (c *notFoundCounter) run(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.flush()
+			return
+		case <-ticker.C:
+			c.flush()
+		}
+	}
+}
+
+// flush adds the pending counts to today's rows and drops expired days. It
+// uses a background context so counts taken during shutdown aren't lost.
+func (c *notFoundCounter) flush() {
+	c.mu.Lock()
+	pending, dropped := c.pending, c.dropped
+	c.pending, c.dropped = make(map[string]int), 0
+	c.mu.Unlock()
+	if dropped > 0 {
+		log.Printf("Not counted: %d NOT_FOUND lookups over the limit of %d callsigns per flush", dropped, notFoundMaxPending)
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.write(ctx, time.Now().UTC(), pending); err != nil {
+		log.Printf("Failed to persist %d NOT_FOUND counts: %v", len(pending), err)
+	}
+}
+
+func (c *notFoundCounter) write(ctx context.Context, now time.Time, counts map[string]int) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO not_found_callsigns (day, callsign, prefix, count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(day, callsign) DO UPDATE SET count = count + excluded.count
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	day := now.Format("2006-01-02")
+	for call, n := range counts {
+		if _, err := stmt.ExecContext(ctx, day, call, callsign.Prefix(call), n); err != nil {
+			return err
+		}
+	}
+
+	cutoff := now.AddDate(0, 0, -notFoundRetentionDays).Format("2006-01-02")
+	if _, err := tx.ExecContext(ctx, `DELETE FROM not_found_callsigns WHERE day < ?`, cutoff); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// NotFoundCount is a row of /admin/notfound-top: a callsign, or with
+// by=prefix every callsign under a prefix
+type NotFoundCount struct {
+	Callsign  string `json:"callsign,omitempty"`
+	Prefix    string `json:"prefix"`
+	Count     int    `json:"count"`
+	Callsigns int    `json:"unique_callsigns,omitempty"`
+	LastSeen  string `json:"last_seen"`
+}
+
+// handleNotFoundTop handles /admin/notfound-top: the callsigns, or with
+// by=prefix the prefixes, most often looked up without a result in the last
+// days (default 30)
+func handleNotFoundTop(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if notFoundDB == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "unavailable",
+			"error":  "NOT_FOUND counting is disabled (set NOT_FOUND_DB_PATH)",
+		})
+		return
+	}
+
+	q := r.URL.Query()
+	days, limit := 30, 50
+	for _, p := range []struct {
+		name string
+		dst  *int
+		max  int
+	}{{"days", &days, notFoundRetentionDays}, {"limit", &limit, 1000}} {
+		if v := q.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > p.max {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("%s must be between 1 and %d", p.name, p.max)})
+				return
+			}
+			*p.dst = n
+		}
+	}
+
+	var query string
+	switch by := q.Get("by"); by {
+	case "", "callsign":
+		query = `
+			SELECT callsign, prefix, SUM(count), 0, MAX(day)
+			FROM not_found_callsigns
+			WHERE day >= ?
+			GROUP BY callsign
+			ORDER BY SUM(count) DESC, callsign
+			LIMIT ?`
+	case "prefix":
+		query = `
+			SELECT '', prefix, SUM(count), COUNT(DISTINCT callsign), MAX(day)
+			FROM not_found_callsigns
+			WHERE day >= ?
+			GROUP BY prefix
+			ORDER BY SUM(count) DESC, prefix
+			LIMIT ?`
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "by must be callsign or prefix"})
+		return
+	}
+	since := time.Now().UTC().AddDate(0, 0, -days+1).Format("2006-01-02")
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	rows, err := notFoundDB.QueryContext(ctx, query, since, limit)
+	if err != nil {
+		log.Printf("NOT_FOUND query failed: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "not found query failed"})
+		return
+	}
+	defer rows.Close()
+
+	top := []NotFoundCount{}
+	for rows.Next() {
+		var c NotFoundCount
+		if err := rows.Scan(&c.Callsign, &c.Prefix, &c.Count, &c.Callsigns, &c.LastSeen); err != nil {
+			log.Printf("NOT_FOUND scan failed: %v", err)
+			continue
+		}
+		top = append(top, c)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"since": since,
+		"top":   top,
+	})
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/batch"
+	"github.com/chriskacerguis/hamqrzdb/internal/notify"
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
+)
+
+// emailConfig is the SMTP server summaries are sent through (SMTP_HOST);
+// email summaries are off when it isn't enabled
+var emailConfig notify.EmailConfig
+
+// SummaryConfig configures the email summaries (NOTIFY_CALLSIGNS,
+// NOTIFY_EXPIRY_DAYS, NOTIFY_INTERVAL)
+type SummaryConfig struct {
+	// Callsigns are watched for changes to their records and upcoming
+	// expirations
+	Callsigns  []string
+	ExpiryDays int
+	Interval   time.Duration
+}
+
+// loadSummaryConfig reads the email summary settings from the environment
+func loadSummaryConfig(getenv func(string) string) (SummaryConfig, error) {
+	cfg := SummaryConfig{ExpiryDays: 60, Interval: 24 * time.Hour}
+	for _, call := range strings.Split(getenv("NOTIFY_CALLSIGNS"), ",") {
+		if call = baseCall(call); call != "" {
+			cfg.Callsigns = append(cfg.Callsigns, call)
+		}
+	}
+	if v := getenv("NOTIFY_EXPIRY_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days <= 0 {
+			return cfg, fmt.Errorf("invalid NOTIFY_EXPIRY_DAYS %q", v)
+		}
+		cfg.ExpiryDays = days
+	}
+	if v := getenv("NOTIFY_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid NOTIFY_INTERVAL %q", v)
+		}
+		cfg.Interval = d
+	}
+	return cfg, nil
+}
+
+// isIngestJob reports whether an admin job imports data, so its failures are
+// reported
+func isIngestJob(name string) bool {
+	return strings.HasPrefix(name, "update-")
+}
+
+// watchedFields are the record fields whose changes summaries report, by
+// HamDB name
+var watchedFields = []string{"status", "class", "expires", "fname", "mi", "name", "suffix",
+	"addr1", "addr2", "state", "zip", "grid"}
+
+// emailSummary collects what the next summary reports
+type emailSummary struct {
+	cfg SummaryConfig
+
+	mu sync.Mutex
+	// failures are the ingest jobs that failed since the last summary
+	failures []AdminJob
+	// seen holds each watched callsign's fields as of the last summary; nil
+	// until the first snapshot is taken
+	seen map[string]map[string]string
+}
+
+// recordJob keeps a failed ingest job for the next summary
+func (s *emailSummary) recordJob(job AdminJob) {
+	if job.Error == "" || !isIngestJob(job.Name) {
+		return
+	}
+	s.mu.Lock()
+	s.failures = append(s.failures, job)
+	s.mu.Unlock()
+}
+
+// snapshot returns the watched fields of each watched callsign's record; a
+// callsign without one has no entry
+func (s *emailSummary) snapshot(ctx context.Context) map[string]map[string]string {
+	records := map[string]map[string]string{}
+	for _, call := range s.cfg.Callsigns {
+		if rec, ok := lookupCallsign(ctx, call, ""); ok {
+			records[call] = rec.values()
+		}
+	}
+	return records
+}
+
+// build returns the subject and body of the summary due now, and whether
+// there is anything to report. Changes are relative to the previous call,
+// so the first one after startup only takes a snapshot.
+func (s *emailSummary) build(ctx context.Context, now time.Time) (subject, body string, ok bool) {
+	current := s.snapshot(ctx)
+
+	s.mu.Lock()
+	previous := s.seen
+	s.seen = current
+	failures := s.failures
+	s.failures = nil
+	s.mu.Unlock()
+
+	var changes []string
+	if previous != nil {
+		for _, call := range s.cfg.Callsigns {
+			before, hadBefore := previous[call]
+			after, hasNow := current[call]
+			switch {
+			case hadBefore && !hasNow:
+				changes = append(changes, call+": record removed")
+			case !hadBefore && hasNow:
+				changes = append(changes, call+": record added")
+			case hadBefore && hasNow:
+				for _, field := range watchedFields {
+					if before[field] != after[field] {
+						changes = append(changes, fmt.Sprintf("%s: %s changed from %q to %q", call, field, before[field], after[field]))
+					}
+				}
+			}
+		}
+	}
+
+	var expiring []string
+	today := now.UTC().Format("2006-01-02")
+	until := now.UTC().AddDate(0, 0, s.cfg.ExpiryDays).Format("2006-01-02")
+	for _, call := range s.cfg.Callsigns {
+		rec, found := lookupCallsign(ctx, call, "")
+		if !found || rec.Status != "A" {
+			continue
+		}
+		if expires := isoDate(rec.Expires, rec.DataSource == batch.FCC || rec.DataSource == ""); expires >= today && expires <= until {
+			expiring = append(expiring, fmt.Sprintf("%s expires %s", call, expires))
+		}
+	}
+
+	if len(changes) == 0 && len(expiring) == 0 && len(failures) == 0 {
+		return "", "", false
+	}
+
+	var b strings.Builder
+	section := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		b.WriteString(title + "\n\n")
+		for _, line := range lines {
+			b.WriteString("  " + line + "\n")
+		}
+		b.WriteString("\n")
+	}
+	section("Changes to watched callsigns", changes)
+	section(fmt.Sprintf("Licenses expiring in the next %d days", s.cfg.ExpiryDays), expiring)
+	var failed []string
+	for _, job := range failures {
+		failed = append(failed, fmt.Sprintf("%s started %s failed: %s", job.Name, job.StartedAt, job.Error))
+	}
+	section("Failed imports", failed)
+
+	var counts []string
+	for _, c := range []struct {
+		n    int
+		noun string
+	}{{len(changes), "change"}, {len(expiring), "expiring license"}, {len(failures), "failed import"}} {
+		switch {
+		case c.n == 1:
+			counts = append(counts, "1 "+c.noun)
+		case c.n > 1:
+			counts = append(counts, fmt.Sprintf("%d %ss", c.n, c.noun))
+		}
+	}
+	return "hamqrzdb summary: " + strings.Join(counts, ", "), b.String(), true
+}
+
+// startEmailSummaries records failed ingest jobs and emails a summary every
+// interval when there is something to report
+func startEmailSummaries(ctx context.Context, cfg SummaryConfig) {
+	s := &emailSummary{cfg: cfg}
+	onJobFinished(s.recordJob)
+
+	go func() {
+		// Watched records are compared against their state at startup
+		if getDB() != nil {
+			s.build(ctx, time.Now())
+		}
+
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			subject, body, ok := s.build(ctx, time.Now())
+			if !ok {
+				continue
+			}
+			if err := notify.SendEmail(ctx, emailConfig, subject, body); err != nil {
+				log.Printf("Failed to send email summary: %v", err)
+			} else {
+				log.Printf("Sent email summary to %s", strings.Join(emailConfig.To, ", "))
+			}
+		}
+	}()
+}
+
+// webhooks are the chat webhooks import results are posted to
+// (NOTIFY_WEBHOOK_URL)
+var webhooks []notify.Webhook
+
+// startWebhookNotifier posts a summary of every finished ingest job to the
+// webhooks
+func startWebhookNotifier(ctx context.Context, dbPath string) {
+	onJobFinished(func(job AdminJob) {
+		if !isIngestJob(job.Name) {
+			return
+		}
+		text := ingestSummary(ctx, dbPath, job)
+		for _, h := range webhooks {
+			if err := h.Post(ctx, text); err != nil {
+				log.Printf("Failed to post %s result: %v", job.Name, err)
+			}
+		}
+	})
+}
+
+// ingestSummary describes a finished ingest job: its outcome and duration,
+// and the records each import batch it ran added, updated, and deleted
+func ingestSummary(ctx context.Context, dbPath string, job AdminJob) string {
+	started, _ := time.Parse(time.RFC3339, job.StartedAt)
+	finished, _ := time.Parse(time.RFC3339, job.FinishedAt)
+
+	var b strings.Builder
+	outcome := "complete"
+	if job.Error != "" {
+		outcome = "failed"
+	}
+	fmt.Fprintf(&b, "hamqrzdb %s %s in %s", job.Name, outcome, finished.Sub(started))
+
+	// A full load replaces the database file, which the serving connection
+	// may not have switched to yet, so read the file as it is now
+	d, err := sql.Open(tracing.Driver(), dbPath+"?mode=ro")
+	if err == nil {
+		defer d.Close()
+		rows, err := d.QueryContext(ctx, `
+			SELECT data_source, status, COALESCE(records, 0), COALESCE(added, 0), COALESCE(pruned, 0)
+			FROM import_batches
+			WHERE started_at BETWEEN ? AND ?
+			ORDER BY id
+		`, started.UTC().Format("2006-01-02 15:04:05"), finished.UTC().Format("2006-01-02 15:04:05"))
+		if err != nil {
+			log.Printf("Failed to read import batches for %s: %v", job.Name, err)
+		} else {
+			defer rows.Close()
+			for rows.Next() {
+				var source, status string
+				var written, added, deleted int
+				if err := rows.Scan(&source, &status, &written, &added, &deleted); err != nil {
+					log.Printf("Failed to read import batches for %s: %v", job.Name, err)
+					break
+				}
+				fmt.Fprintf(&b, "\n%s: %d added, %d updated, %d deleted", source, added, written-added, deleted)
+				if status != "complete" {
+					b.WriteString(" (" + status + ")")
+				}
+			}
+		}
+	}
+
+	if job.Error != "" {
+		b.WriteString("\nError: " + job.Error)
+	}
+	return b.String()
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/geo"
+)
+
+// Override holds operator-supplied corrections merged over a callsign's
+// official record at lookup time
+type Override struct {
+	Callsign      string `json:"callsign"`
+	PreferredName string `json:"preferred_name"`
+	QSLManager    string `json:"qsl_manager"`
+	Grid          string `json:"grid"`
+}
+
+// maxOverridesBody caps the size of a POST /admin/overrides upload
+const maxOverridesBody = 32 << 20
+
+// overrideColumns maps CSV header names (lower case) to Override fields
+var overrideColumns = map[string]string{
+	"callsign": "callsign", "call": "callsign",
+	"preferred_name": "preferred_name", "preferred name": "preferred_name", "nickname": "preferred_name",
+	"qsl_manager": "qsl_manager", "qsl manager": "qsl_manager", "qsl_via": "qsl_manager", "qsl via": "qsl_manager",
+	"grid": "grid", "grid_square": "grid", "gridsquare": "grid", "locator": "grid",
+}
+
+// handleAdminOverrides handles POST /admin/overrides: a CSV or JSON upload of
+// per-callsign overrides, upserted in one transaction. A row with no
+// override values removes the callsign's override, and ?replace=1 replaces
+// all stored overrides with the upload. Nothing is stored if any row is
+// invalid.
+func handleAdminOverrides(dbPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeAdminJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+
+		overrides, err := readOverrides(http.MaxBytesReader(w, r.Body, maxOverridesBody), r.Header.Get("Content-Type"))
+		if err != nil {
+			writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if errs := validateOverrides(overrides); len(errs) > 0 {
+			writeAdminJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error":  "invalid overrides",
+				"errors": errs,
+			})
+			return
+		}
+		replace, _ := strconv.ParseBool(r.URL.Query().Get("replace"))
+
+		stored, removed, err := storeOverrides(r.Context(), dbPath, overrides, replace)
+		if err != nil {
+			log.Printf("Failed to store overrides: %v", err)
+			writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to store overrides"})
+			return
+		}
+		log.Printf("Stored %d overrides, removed %d", stored, removed)
+		writeAdminJSON(w, http.StatusOK, map[string]int{"stored": stored, "removed": removed})
+	}
+}
+
+// writeAdminJSON writes an admin API response
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// readOverrides parses an overrides upload (see readUpload)
+func readOverrides(r io.Reader, contentType string) ([]Override, error) {
+	return readUpload(r, contentType, "overrides", overrideColumns, func(field func(string) string) Override {
+		return Override{
+			Callsign:      field("callsign"),
+			PreferredName: field("preferred_name"),
+			QSLManager:    field("qsl_manager"),
+			Grid:          field("grid"),
+		}
+	})
+}
+
+// readUpload parses an admin upload as JSON (an array, or an object holding
+// the array under key) when the content type or first character says so,
+// and as CSV otherwise. CSV headers are matched through columns (lower case
+// header names to field names), and row builds an item from a row's fields.
+func readUpload[T any](r io.Reader, contentType, key string, columns map[string]string, row func(field func(string) string) T) ([]T, error) {
+	br := bufio.NewReader(r)
+	start, _ := br.Peek(64)
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(start, []byte("\ufeff")), " \t\r\n")
+	isJSON := strings.Contains(contentType, "json") || (len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '['))
+
+	if isJSON {
+		var items []T
+		dec := json.NewDecoder(br)
+		if len(trimmed) > 0 && trimmed[0] == '{' {
+			var wrapper map[string]json.RawMessage
+			if err := dec.Decode(&wrapper); err != nil {
+				return nil, fmt.Errorf("failed to read JSON: %w", err)
+			}
+			if raw, ok := wrapper[key]; ok {
+				if err := json.Unmarshal(raw, &items); err != nil {
+					return nil, fmt.Errorf("failed to read JSON: %w", err)
+				}
+			}
+		} else if err := dec.Decode(&items); err != nil {
+			return nil, fmt.Errorf("failed to read JSON: %w", err)
+		}
+		return items, nil
+	}
+
+	if bom, _ := br.Peek(3); string(bom) == "\ufeff" {
+		br.Discard(3)
+	}
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	index := map[string]int{}
+	for i, h := range header {
+		if field, ok := columns[strings.ToLower(strings.TrimSpace(h))]; ok {
+			index[field] = i
+		}
+	}
+	if _, ok := index["callsign"]; !ok {
+		return nil, fmt.Errorf("no callsign column in CSV header")
+	}
+
+	var items []T
+	for {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		items = append(items, row(func(name string) string {
+			if i, ok := index[name]; ok && i < len(values) {
+				return values[i]
+			}
+			return ""
+		}))
+	}
+	return items, nil
+}
+
+// validateOverrides normalizes overrides in place and returns a message for
+// each invalid one
+func validateOverrides(overrides []Override) []string {
+	var errs []string
+	if len(overrides) == 0 {
+		return []string{"no overrides in upload"}
+	}
+	for i := range overrides {
+		o := &overrides[i]
+		o.Callsign = baseCall(o.Callsign)
+		o.PreferredName = strings.TrimSpace(o.PreferredName)
+		o.QSLManager = strings.ToUpper(strings.TrimSpace(o.QSLManager))
+		o.Grid = normalizeGrid(o.Grid)
+
+		if o.Callsign == "" {
+			errs = append(errs, fmt.Sprintf("row %d: callsign is required", i+1))
+			continue
+		}
+		if o.Grid != "" {
+			if _, _, err := geo.GridCenter(o.Grid); err != nil {
+				errs = append(errs, fmt.Sprintf("row %d (%s): %v", i+1, o.Callsign, err))
+			}
+		}
+	}
+	return errs
+}
+
+// normalizeGrid formats a Maidenhead locator as EM10ci
+func normalizeGrid(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 {
+		return strings.ToUpper(s)
+	}
+	return strings.ToUpper(s[:2]) + strings.ToLower(s[2:])
+}
+
+// storeOverrides writes overrides through a short-lived writable connection,
+// returning how many were stored and removed
+func storeOverrides(ctx context.Context, dbPath string, overrides []Override, replace bool) (stored, removed int, err error) {
+	rw, err := openWritableDB(ctx, dbPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rw.Close()
+
+	tx, err := rw.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		res, err := tx.ExecContext(ctx, "DELETE FROM overrides")
+		if err != nil {
+			return 0, 0, err
+		}
+		n, _ := res.RowsAffected()
+		removed = int(n)
+	}
+
+	for _, o := range overrides {
+		if o.PreferredName == "" && o.QSLManager == "" && o.Grid == "" {
+			res, err := tx.ExecContext(ctx, "DELETE FROM overrides WHERE callsign = ?", o.Callsign)
+			if err != nil {
+				return 0, 0, err
+			}
+			n, _ := res.RowsAffected()
+			removed += int(n)
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO overrides (callsign, preferred_name, qsl_manager, grid_square, last_updated)
+			VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(callsign) DO UPDATE SET
+				preferred_name = excluded.preferred_name,
+				qsl_manager = excluded.qsl_manager,
+				grid_square = excluded.grid_square,
+				last_updated = CURRENT_TIMESTAMP
+		`, o.Callsign, o.PreferredName, o.QSLManager, o.Grid)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to store override for %s: %w", o.Callsign, err)
+		}
+		stored++
+	}
+
+	return stored, removed, tx.Commit()
+}
+
+// storedOverride is an Override as read back for a lookup
+type storedOverride struct {
+	Override
+	UpdatedAt string
+}
+
+// lookupOverride returns a callsign's stored override, or nil if it has none
+func lookupOverride(ctx context.Context, callsign string) *storedOverride {
+	d := getDB()
+	if d == nil {
+		return nil
+	}
+
+	o := storedOverride{Override: Override{Callsign: callsign}}
+	err := d.QueryRowContext(ctx, `
+		SELECT COALESCE(preferred_name, ''), COALESCE(qsl_manager, ''), COALESCE(grid_square, ''),
+			COALESCE(last_updated, '')
+		FROM overrides
+		WHERE callsign = ?
+	`, callsign).Scan(&o.PreferredName, &o.QSLManager, &o.Grid, &o.UpdatedAt)
+	if err != nil {
+		// Databases that never received overrides have no overrides table
+		if err != sql.ErrNoRows && !strings.Contains(err.Error(), "no such table") {
+			log.Printf("Database error looking up override for %s: %v", callsign, err)
+		}
+		return nil
+	}
+	return &o
+}
+
+// apply merges the override into a callsign's record. A corrected grid also
+// moves lat/lon to the centre of the grid square. A nil override does nothing.
+func (o *storedOverride) apply(data *CallsignData) {
+	if o == nil {
+		return
+	}
+	data.PreferredName = o.PreferredName
+	data.QSLManager = o.QSLManager
+	if o.appliesGrid() {
+		lat, lon, _ := geo.GridCenter(o.Grid)
+		data.Grid = o.Grid
+		data.Lat = fmt.Sprintf("%.7f", lat)
+		data.Lon = fmt.Sprintf("%.7f", lon)
+	}
+}
+
+// appliesGrid reports whether the override replaces the record's location
+func (o *storedOverride) appliesGrid() bool {
+	if o == nil || o.Grid == "" {
+		return false
+	}
+	_, _, err := geo.GridCenter(o.Grid)
+	return err == nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/callsign"
+	"github.com/chriskacerguis/hamqrzdb/internal/prefix"
+)
+
+// PrefixInfo is the response of /v1/prefix/{prefix}
+type PrefixInfo struct {
+	// Prefix is the longest known prefix of the request, e.g. KH6 for KH6ABC
+	Prefix        string `json:"prefix"`
+	Country       string `json:"country"`
+	Continent     string `json:"continent,omitempty"`
+	ITUSeries     string `json:"itu_series,omitempty"`
+	ITUAllocation string `json:"itu_allocation,omitempty"`
+}
+
+// prefixKey returns what to match in the prefix tables for raw: the portable
+// prefix of a callsign if it has one, else its base call, or for anything
+// else (such as a bare prefix like KH6) the letters and digits given
+func prefixKey(raw string) string {
+	if c, err := callsign.Parse(raw); err == nil {
+		if c.Prefix != "" {
+			return c.Prefix
+		}
+		return c.Base
+	}
+	key := callsign.Normalize(raw)
+	if key == "" || len(key) > 10 || strings.Trim(key, "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789") != "" {
+		return ""
+	}
+	return key
+}
+
+// handlePrefix handles /v1/prefix/{prefix}: the country, continent, and ITU
+// allocation of a prefix or callsign from the embedded tables, whether or
+// not the database has a license record for it
+func handlePrefix(w http.ResponseWriter, r *http.Request) {
+	base, escaped, _ := strings.Cut(r.URL.EscapedPath(), "/prefix/")
+	raw, _ := url.PathUnescape(escaped)
+	key := prefixKey(raw)
+	if key == "" {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter,
+			"a prefix or callsign is required, e.g. "+base+"/prefix/KH6", raw)
+		return
+	}
+
+	info, ok := prefix.Lookup(key)
+	if !ok {
+		writeErrorDetail(w, r, http.StatusNotFound, codeNotFound, "prefix is not allocated", key)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, PrefixInfo{
+		Prefix:        info.Prefix,
+		Country:       info.Country,
+		Continent:     info.Continent,
+		ITUSeries:     info.ITUSeries,
+		ITUAllocation: info.ITUAllocation,
+	})
+}
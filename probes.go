@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Orchestrator probes. /health stays as it was; /livez, /startupz, and
+// /readyz split it so a pod isn't restarted while it loads its first
+// database, and isn't sent traffic until it can answer lookups.
+
+var (
+	// loaded is set once a database with records has been served, which
+	// ends startup for good
+	loaded atomic.Bool
+	// readyMaxAge is how old the last import may be for /readyz to pass
+	// (READY_MAX_AGE); 0 doesn't check
+	readyMaxAge time.Duration
+)
+
+// loadReadyMaxAge reads READY_MAX_AGE
+func loadReadyMaxAge(getenv func(string) string) error {
+	v := getenv("READY_MAX_AGE")
+	if v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid READY_MAX_AGE %q", v)
+	}
+	readyMaxAge = d
+	return nil
+}
+
+// writeProbe writes a probe response: 200 when ok, else 503
+func writeProbe(w http.ResponseWriter, ok bool, body map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+// handleLivez handles /livez: the process is up and serving HTTP. It never
+// looks at the database, so a missing or loading one doesn't get the pod
+// restarted.
+func handleLivez(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, true, map[string]interface{}{"status": "alive"})
+}
+
+// handleStartupz handles /startupz: 503 until the first database with
+// records is attached (restored, bootstrapped, or imported), then 200 for
+// the rest of the process's life
+func handleStartupz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	if !loaded.Load() {
+		if _, count, ok := databaseFreshness(ctx); ok && count > 0 {
+			loaded.Store(true)
+		}
+	}
+	if loaded.Load() {
+		writeProbe(w, true, map[string]interface{}{"status": "started"})
+		return
+	}
+
+	body := map[string]interface{}{"status": "starting", "detail": "waiting for a database"}
+	if job := currentJob(); job != nil && job.Running {
+		body["detail"] = "loading"
+		body["job"] = job
+	}
+	writeProbe(w, false, body)
+}
+
+// handleReadyz handles /readyz: a database with records is attached and
+// answers, and its last import is within READY_MAX_AGE when that is set
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	d := getDB()
+	if d == nil || d.PingContext(ctx) != nil {
+		writeProbe(w, false, map[string]interface{}{"status": "not ready", "error": "database not connected"})
+		return
+	}
+	date, count, ok := databaseFreshness(ctx)
+	if !ok {
+		writeProbe(w, false, map[string]interface{}{"status": "not ready", "error": "database not readable"})
+		return
+	}
+	body := map[string]interface{}{"db_date": date, "record_count": count}
+	if count == 0 {
+		body["status"], body["error"] = "not ready", "database is empty"
+		writeProbe(w, false, body)
+		return
+	}
+	loaded.Store(true)
+	if readyMaxAge > 0 {
+		// db_date is a day, so the age counts from its start
+		last, err := time.Parse("2006-01-02", date)
+		if err != nil || time.Since(last) > readyMaxAge {
+			body["status"], body["error"] = "not ready", "database is older than READY_MAX_AGE"
+			writeProbe(w, false, body)
+			return
+		}
+	}
+	body["status"] = "ready"
+	writeProbe(w, true, body)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// programActiveDays is how recent a callsign's last activity in a program
+// must be for its badge to say it is active
+const programActiveDays = 365
+
+// ProgramBadge summarizes a callsign's activity in an awards program (POTA,
+// SOTA, IOTA, ...), e.g. for an "active POTA activator" badge
+type ProgramBadge struct {
+	Program string `json:"program"`
+	// References is how many distinct parks, summits, or islands the
+	// callsign has activated
+	References   int    `json:"references"`
+	Activations  int    `json:"activations"`
+	LastActivity string `json:"last_activity,omitempty"`
+	// Active reports whether the last activity was in the past year
+	Active bool `json:"active"`
+}
+
+// ProgramReference is a callsign's activity at one program reference
+type ProgramReference struct {
+	Program      string `json:"program"`
+	Reference    string `json:"reference"`
+	Name         string `json:"name,omitempty"`
+	Activations  int    `json:"activations"`
+	LastActivity string `json:"last_activity,omitempty"`
+}
+
+// lookupProgramBadges returns a badge per program a callsign has references
+// in, or nil if there are none or no program has been imported
+func lookupProgramBadges(ctx context.Context, callsign string) []ProgramBadge {
+	d := getDB()
+	if d == nil || !hasColumn(ctx, d, "program_references", "program") {
+		return nil
+	}
+
+	rows, err := d.QueryContext(ctx, `
+		SELECT program, COUNT(*), SUM(activations), COALESCE(MAX(last_activity), '')
+		FROM program_references
+		WHERE callsign = ?
+		GROUP BY program
+		ORDER BY program
+	`, callsign)
+	if err != nil {
+		log.Printf("Database error looking up program badges for %s: %v", callsign, err)
+		return nil
+	}
+	defer rows.Close()
+
+	since := time.Now().UTC().AddDate(0, 0, -programActiveDays).Format("2006-01-02")
+	var badges []ProgramBadge
+	for rows.Next() {
+		var b ProgramBadge
+		if err := rows.Scan(&b.Program, &b.References, &b.Activations, &b.LastActivity); err != nil {
+			log.Printf("Error scanning program badge for %s: %v", callsign, err)
+			return nil
+		}
+		b.Active = b.LastActivity >= since
+		badges = append(badges, b)
+	}
+	return badges
+}
+
+// handleReferences handles /v1/{callsign}/references requests: the POTA
+// parks, SOTA summits, IOTA islands, ... imported for a callsign
+func handleReferences(w http.ResponseWriter, r *http.Request, callsign string) {
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	references := []ProgramReference{}
+	status := "OK"
+
+	if d := getDB(); d != nil && hasColumn(ctx, d, "program_references", "program") {
+		query := `
+			SELECT program, reference, COALESCE(name, ''), activations, COALESCE(last_activity, '')
+			FROM program_references
+			WHERE callsign = ?`
+		args := []interface{}{callsign}
+		if program := r.URL.Query().Get("program"); program != "" {
+			query += ` AND program = UPPER(?)`
+			args = append(args, program)
+		}
+		rows, err := d.QueryContext(ctx, query+` ORDER BY program, last_activity DESC, reference`, args...)
+		if err != nil {
+			log.Printf("Database error looking up references for %s: %v", callsign, err)
+		} else {
+			defer rows.Close()
+			for rows.Next() {
+				var ref ProgramReference
+				if err := rows.Scan(&ref.Program, &ref.Reference, &ref.Name, &ref.Activations, &ref.LastActivity); err != nil {
+					log.Printf("Error scanning reference for %s: %v", callsign, err)
+					break
+				}
+				references = append(references, ref)
+			}
+		}
+	}
+
+	if len(references) == 0 {
+		status = "NOT_FOUND"
+		markNotFound(w)
+	}
+
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"callsign":   callsign,
+		"references": references,
+		"messages":   map[string]string{"status": status},
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/batch"
+)
+
+// RecordSource describes where a record came from and which import wrote it
+type RecordSource struct {
+	DataSource string `json:"data_source"`
+	Batch      int64  `json:"batch,omitempty"`
+	ImportedAt string `json:"imported_at,omitempty"`
+}
+
+// lookupSource returns the provenance of a callsign's record from
+// dataSource, or nil for databases imported before source tracking
+func lookupSource(ctx context.Context, callsign, dataSource string) *RecordSource {
+	d := getDB()
+	if d == nil || !hasColumn(ctx, d, "callsigns", "data_source") {
+		return nil
+	}
+
+	// GMRS licenses are kept in gmrs_licenses, which holds nothing else
+	from := `callsigns c`
+	sourceExpr := `COALESCE(c.data_source, '')`
+	if dataSource == batch.GMRS {
+		from = `gmrs_licenses c`
+		sourceExpr = `'` + batch.GMRS + `'`
+	}
+
+	var source, importedAt sql.NullString
+	var batchID sql.NullInt64
+	err := d.QueryRowContext(ctx, `
+		SELECT `+sourceExpr+`, c.import_batch, COALESCE(b.finished_at, b.started_at)
+		FROM `+from+`
+		LEFT JOIN import_batches b ON b.id = c.import_batch
+		WHERE c.callsign = ? AND `+sourceExpr+` = ?
+	`, callsign, dataSource).Scan(&source, &batchID, &importedAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Database error looking up source for %s: %v", callsign, err)
+		}
+		return nil
+	}
+	if !source.Valid || source.String == "" {
+		return nil
+	}
+
+	return &RecordSource{
+		DataSource: source.String,
+		Batch:      batchID.Int64,
+		ImportedAt: importedAt.String,
+	}
+}
+
+// FieldProvenance describes where a group of callsign fields came from
+type FieldProvenance struct {
+	// Source is the record's data source, "override", or "redacted"
+	Source string `json:"source"`
+	// Method says how the fields were derived when not copied from the source
+	Method    string `json:"method,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// fieldProvenance returns the provenance of each field group of a looked up
+// record (?verbose=1): license (call, class, status, expires,
+// licensed_since), name, address, location (grid, lat, lon), and override
+// (preferred_name, qsl_manager). Groups without any data are left out.
+func fieldProvenance(rec SourceRecord, source *RecordSource, override *storedOverride) map[string]FieldProvenance {
+	official := FieldProvenance{Source: rec.DataSource}
+	if source != nil {
+		official.UpdatedAt = source.ImportedAt
+	}
+	if official.Source == "" {
+		official.Source = "unknown"
+	}
+	redacted := FieldProvenance{Source: "redacted"}
+	redaction := cfg().redaction
+
+	groups := map[string]FieldProvenance{"license": official}
+
+	switch {
+	case redaction.Names.Covers(rec.Country):
+		groups["name"] = redacted
+	case rec.FName != "" || rec.Name != "":
+		groups["name"] = official
+	}
+
+	switch {
+	case redaction.Addresses.Covers(rec.Country):
+		groups["address"] = redacted
+	case rec.Addr1 != "" || rec.Addr2 != "" || rec.Zip != "":
+		groups["address"] = official
+	}
+
+	switch {
+	case override.appliesGrid():
+		groups["location"] = FieldProvenance{Source: "override", Method: "grid_center", UpdatedAt: override.UpdatedAt}
+	case rec.Grid == "" && rec.Lat == "":
+		// no location
+	case redaction.Addresses.Covers(rec.Country):
+		// Coordinates are withheld; the grid square is still the source's
+		groups["location"] = FieldProvenance{Source: rec.DataSource, Method: "grid_only", UpdatedAt: official.UpdatedAt}
+	case rec.DataSource == batch.Ofcom:
+		// Ofcom publishes postcodes only; coordinates come from Code-Point Open
+		groups["location"] = FieldProvenance{Source: rec.DataSource, Method: "postcode", UpdatedAt: official.UpdatedAt}
+	default:
+		groups["location"] = official
+	}
+
+	if override != nil && (override.PreferredName != "" || override.QSLManager != "") {
+		groups["override"] = FieldProvenance{Source: "override", UpdatedAt: override.UpdatedAt}
+	}
+	return groups
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ProxyConfig says which peers are reverse proxies whose client address
+// headers are believed (TRUSTED_PROXIES, CLIENT_IP_HEADER). Without it the
+// client IP is the connection's, which behind nginx or Caddy is the proxy.
+type ProxyConfig struct {
+	trusted []netip.Prefix
+	// unix trusts requests over unix sockets, where only a local proxy
+	// can connect
+	unix bool
+	// header carries the client address; X-Forwarded-For is read as a
+	// chain of proxies, any other header as a single address
+	header string
+}
+
+// loadProxyConfig reads TRUSTED_PROXIES, a comma-separated list of
+// addresses and CIDR ranges plus the shorthands loopback, private, and
+// unix, and CLIENT_IP_HEADER (default X-Forwarded-For)
+func loadProxyConfig(getenv func(string) string) (ProxyConfig, error) {
+	c := ProxyConfig{header: http.CanonicalHeaderKey(strings.TrimSpace(getenv("CLIENT_IP_HEADER")))}
+	if c.header == "" {
+		c.header = "X-Forwarded-For"
+	}
+	for _, v := range strings.Split(getenv("TRUSTED_PROXIES"), ",") {
+		switch v = strings.TrimSpace(v); strings.ToLower(v) {
+		case "":
+		case "unix":
+			c.unix = true
+		case "loopback":
+			c.trusted = append(c.trusted, netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128"))
+		case "private":
+			for _, p := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"} {
+				c.trusted = append(c.trusted, netip.MustParsePrefix(p))
+			}
+		default:
+			p, err := netip.ParsePrefix(v)
+			if err != nil {
+				addr, aerr := netip.ParseAddr(v)
+				if aerr != nil {
+					return c, fmt.Errorf("invalid TRUSTED_PROXIES entry %q (expected an address, CIDR range, loopback, private, or unix)", v)
+				}
+				p = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			c.trusted = append(c.trusted, p.Masked())
+		}
+	}
+	return c, nil
+}
+
+// trusts reports whether addr is a trusted proxy
+func (c ProxyConfig) trusts(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range c.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client that made the request. When
+// the connection comes from a trusted proxy, that is the address in the
+// client IP header: the last one in X-Forwarded-For that isn't itself a
+// trusted proxy, since a client can put anything at the start of it.
+func (c ProxyConfig) clientIP(r *http.Request) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	if len(c.trusted) == 0 && !c.unix {
+		return peer
+	}
+
+	// Unix socket peers have no address ("@" or "")
+	addr, err := netip.ParseAddr(peer)
+	if err != nil {
+		if !c.unix || (peer != "" && peer != "@") {
+			return peer
+		}
+	} else if !c.trusts(addr) {
+		return peer
+	}
+
+	values := r.Header.Values(c.header)
+	if len(values) == 0 {
+		return peer
+	}
+	if c.header != "X-Forwarded-For" {
+		if a, ok := parseForwardedAddr(values[len(values)-1]); ok {
+			return a.String()
+		}
+		return peer
+	}
+
+	// Several X-Forwarded-For headers form one list
+	hops := strings.Split(strings.Join(values, ","), ",")
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		a, ok := parseForwardedAddr(hops[i])
+		if !ok {
+			// Can't tell who sent an unreadable entry, so stop at the
+			// last address known to be real
+			break
+		}
+		client = a.String()
+		if !c.trusts(a) {
+			break
+		}
+	}
+	return client
+}
+
+// parseForwardedAddr parses one address from a forwarding header, which
+// may carry a port ("203.0.113.7:4711", "[2001:db8::1]:4711")
+func parseForwardedAddr(v string) (netip.Addr, bool) {
+	v = strings.TrimSpace(v)
+	if ap, err := netip.ParseAddrPort(v); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	a, err := netip.ParseAddr(strings.Trim(v, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return a.Unmap(), true
+}
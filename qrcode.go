@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/qr"
+)
+
+// handleCallsignQR handles /v1/{callsign}/qr.png: a QR code of the
+// callsign's lookup URL, or with ?content=mecard its contact card, for
+// badges and QSL cards. ?scale= sets the pixels per module (default 8).
+func handleCallsignQR(w http.ResponseWriter, r *http.Request, call string) {
+	query := r.URL.Query()
+	content := strings.ToLower(query.Get("content"))
+	if content != "" && content != "url" && content != "mecard" {
+		writeError(w, r, http.StatusBadRequest, codeInvalidParameter,
+			fmt.Sprintf("unknown content %q (expected url or mecard)", content))
+		return
+	}
+	scale := 8
+	if v := query.Get("scale"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 32 {
+			writeError(w, r, http.StatusBadRequest, codeInvalidParameter, "scale must be 1 to 32")
+			return
+		}
+		scale = n
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	rec, ok := lookupCallsign(ctx, call, strings.ToUpper(query.Get("source")))
+	if !ok {
+		markNotFound(w)
+		writeError(w, r, http.StatusNotFound, codeNotFound, fmt.Sprintf("callsign %s not found", call))
+		return
+	}
+
+	text := publicBaseURL(r) + "/v1/" + url.PathEscape(rec.Call) + "/json"
+	if content == "mecard" {
+		lookupOverride(ctx, rec.Call).apply(&rec.CallsignData)
+		text = meCard(rec.CallsignData)
+	}
+	code, err := qr.Encode([]byte(text))
+	if err != nil {
+		writeError(w, r, http.StatusUnprocessableEntity, codeInvalidParameter, "the record is too long for a QR code")
+		return
+	}
+
+	var buf bytes.Buffer
+	png.Encode(&buf, code.Image(scale))
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(buf.Bytes())
+}
+
+// publicBaseURL is the URL clients reach the API at, for links that leave
+// the request: PUBLIC_URL, or else the request's own host
+func publicBaseURL(r *http.Request) string {
+	if u := cfg().publicURL; u != "" {
+		return u
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/pdf"
+)
+
+// qslTemplate lays out one page of /v1/{callsign}/qsl.pdf: text lines
+// stacked from the top (or centred, or from the bottom), each a Go template
+// like the custom formats'. Lines that come out blank are left out, so an
+// address without a second line doesn't leave a gap.
+type qslTemplate struct {
+	Width  qslLength `yaml:"width"`
+	Height qslLength `yaml:"height"`
+	Margin qslLength `yaml:"margin"`
+	// Border draws a rule around the page, e.g. as a cutting guide
+	Border bool `yaml:"border"`
+	// VAlign is top (the default), middle, or bottom
+	VAlign string    `yaml:"valign"`
+	Lines  []qslLine `yaml:"lines"`
+}
+
+type qslLine struct {
+	Text string `yaml:"text"`
+	// Size is the font size in points (default 10); text too wide for the
+	// page is set smaller
+	Size float64 `yaml:"size"`
+	Bold bool    `yaml:"bold"`
+	// Align is left (the default), center, or right
+	Align string `yaml:"align"`
+	// Space is extra space above the line
+	Space qslLength `yaml:"space"`
+
+	tmpl *template.Template
+}
+
+// qslLength is a length in points, read as a number of points or with an
+// in, mm, or pt suffix
+type qslLength float64
+
+func (l *qslLength) UnmarshalYAML(node *yaml.Node) error {
+	s := strings.TrimSpace(node.Value)
+	unit := 1.0
+	for suffix, u := range map[string]float64{"in": pdf.Inch, "mm": pdf.MM, "pt": 1} {
+		if v, ok := strings.CutSuffix(s, suffix); ok {
+			s, unit = strings.TrimSpace(v), u
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return fmt.Errorf("line %d: invalid length %q", node.Line, node.Value)
+	}
+	*l = qslLength(v * unit)
+	return nil
+}
+
+// qslRecord is what QSL template lines are executed with: a custom format's
+// record plus the request's query parameters, e.g. .Params.date for a QSO
+// date to print
+type qslRecord struct {
+	customRecord
+	Params map[string]string
+}
+
+// defaultQSLTemplate is used without ?template=
+const defaultQSLTemplate = "label"
+
+// builtinQSLTemplates are always available; QSL_TEMPLATES can replace them
+var builtinQSLTemplates = mustParseQSLTemplates(`
+templates:
+  # A 2-5/8" x 1" address label (Avery 5160's size)
+  label:
+    width: 2.625in
+    height: 1in
+    margin: 0.1in
+    valign: middle
+    lines:
+      - text: "{{.Call}}{{with .QSLManager}} via {{.}}{{end}}"
+        size: 10
+        bold: true
+      - &name
+        text: "{{with .PreferredName}}{{.}}{{else}}{{.FName}}{{with .MI}} {{.}}{{end}}{{end}} {{.Name}}{{with .Suffix}} {{.}}{{end}}"
+        size: 9
+      - &addr1
+        text: "{{.Addr1}}"
+        size: 9
+      - &city
+        text: "{{.Addr2}}{{if and .Addr2 .State}}, {{end}}{{.State}} {{.Zip}}"
+        size: 9
+      - &country
+        text: '{{if ne .Country "United States"}}{{upper .Country}}{{end}}'
+        size: 9
+  # The address side of a 5-1/2" x 3-1/2" QSL card
+  card:
+    width: 5.5in
+    height: 3.5in
+    margin: 0.3in
+    border: true
+    lines:
+      - text: "To Radio"
+        size: 10
+      - text: "{{.Call}}{{with .QSLManager}} via {{.}}{{end}}"
+        size: 28
+        bold: true
+      - {<<: *name, size: 14, space: 0.15in}
+      - {<<: *addr1, size: 14}
+      - {<<: *city, size: 14}
+      - {<<: *country, size: 14}
+      - text: "{{with .Params.date}}Confirming our QSO on {{.}}{{with $.Params.time}} at {{.}}{{end}}{{with $.Params.band}} on {{.}}{{end}}{{with $.Params.mode}} {{.}}{{end}}{{end}}"
+        size: 10
+        space: 0.25in
+`)
+
+// loadQSLTemplates reads a QSL_TEMPLATES file: named templates under
+// "templates", checked by executing each line on an empty record
+func loadQSLTemplates(path string) (map[string]*qslTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := parseQSLTemplates(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return templates, nil
+}
+
+func mustParseQSLTemplates(data string) map[string]*qslTemplate {
+	templates, err := parseQSLTemplates([]byte(data))
+	if err != nil {
+		panic(err)
+	}
+	return templates
+}
+
+func parseQSLTemplates(data []byte) (map[string]*qslTemplate, error) {
+	var file struct {
+		Templates map[string]*qslTemplate `yaml:"templates"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil {
+		return nil, err
+	}
+	if len(file.Templates) == 0 {
+		return nil, fmt.Errorf("no templates")
+	}
+
+	empty := qslRecord{customRecord: customRecord{Fields: map[string]string{}}, Params: map[string]string{}}
+	templates := map[string]*qslTemplate{}
+	for name, t := range file.Templates {
+		switch {
+		case t == nil || t.Width <= 0 || t.Height <= 0:
+			return nil, fmt.Errorf("template %s needs a width and height", name)
+		case len(t.Lines) == 0:
+			return nil, fmt.Errorf("template %s has no lines", name)
+		case t.VAlign != "" && t.VAlign != "top" && t.VAlign != "middle" && t.VAlign != "bottom":
+			return nil, fmt.Errorf("template %s: valign must be top, middle, or bottom", name)
+		}
+		for i := range t.Lines {
+			line := &t.Lines[i]
+			if line.Align != "" && line.Align != "left" && line.Align != "center" && line.Align != "right" {
+				return nil, fmt.Errorf("template %s line %d: align must be left, center, or right", name, i+1)
+			}
+			if line.Size == 0 {
+				line.Size = 10
+			}
+			if line.Size < 0 {
+				return nil, fmt.Errorf("template %s line %d: invalid size", name, i+1)
+			}
+			var err error
+			if line.tmpl, err = template.New(name).Funcs(customFuncs).Parse(line.Text); err != nil {
+				return nil, fmt.Errorf("template %s line %d: %w", name, i+1, err)
+			}
+			if err := line.tmpl.Execute(&bytes.Buffer{}, empty); err != nil {
+				return nil, fmt.Errorf("template %s line %d: %w", name, i+1, err)
+			}
+		}
+		templates[strings.ToLower(name)] = t
+	}
+	return templates, nil
+}
+
+// qslTemplateNames lists the templates a request can pick, for errors
+func qslTemplateNames() string {
+	seen := map[string]bool{}
+	var names []string
+	for _, templates := range []map[string]*qslTemplate{cfg().qslTemplates, builtinQSLTemplates} {
+		for name := range templates {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// handleQSLLabel handles /v1/{callsign}/qsl.pdf: a printable address label
+// or QSL card back from the record's name and address, laid out by
+// ?template= (default label). Other query parameters reach the template as
+// .Params, so a logging program can print the QSO's details.
+func handleQSLLabel(w http.ResponseWriter, r *http.Request, call string) {
+	query := r.URL.Query()
+	name := strings.ToLower(query.Get("template"))
+	if name == "" {
+		name = defaultQSLTemplate
+	}
+	t, ok := cfg().qslTemplates[name]
+	if !ok {
+		if t, ok = builtinQSLTemplates[name]; !ok {
+			writeError(w, r, http.StatusBadRequest, codeInvalidParameter,
+				fmt.Sprintf("unknown template %q; templates: %s", name, qslTemplateNames()))
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	rec, ok := lookupCallsign(ctx, call, strings.ToUpper(query.Get("source")))
+	if !ok {
+		markNotFound(w)
+		writeError(w, r, http.StatusNotFound, codeNotFound, fmt.Sprintf("callsign %s not found", call))
+		return
+	}
+	lookupOverride(ctx, rec.Call).apply(&rec.CallsignData)
+
+	data := qslRecord{
+		customRecord: customRecord{SourceRecord: rec, Fields: map[string]string{}, Now: time.Now()},
+		Params:       map[string]string{},
+	}
+	for k, v := range rec.values() {
+		if v != "" {
+			data.Fields[k] = v
+		}
+	}
+	for k := range query {
+		data.Params[k] = query.Get(k)
+	}
+
+	page, err := t.render(data)
+	if err != nil {
+		log.Printf("QSL template %q failed: %v", name, err)
+		writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "the QSL template failed")
+		return
+	}
+	var buf bytes.Buffer
+	pdf.Write(&buf, []*pdf.Page{page})
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s-%s.pdf"`, strings.ReplaceAll(rec.Call, "/", "-"), name))
+	w.Write(buf.Bytes())
+}
+
+// render lays out the template's lines for a record
+func (t *qslTemplate) render(data qslRecord) (*pdf.Page, error) {
+	type placed struct {
+		line *qslLine
+		text string
+	}
+	var lines []placed
+	var height float64
+	for i := range t.Lines {
+		line := &t.Lines[i]
+		var b strings.Builder
+		if err := line.tmpl.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		text := strings.Join(strings.Fields(b.String()), " ")
+		if text == "" {
+			continue
+		}
+		lines = append(lines, placed{line, text})
+		height += float64(line.Space) + 1.2*line.Size
+	}
+
+	width, margin := float64(t.Width), float64(t.Margin)
+	page := pdf.NewPage(width, float64(t.Height))
+	if t.Border {
+		page.Rect(margin/2, margin/2, width-margin, float64(t.Height)-margin, 0.5)
+	}
+	top := float64(t.Height) - margin
+	switch t.VAlign {
+	case "middle":
+		top -= (float64(t.Height) - 2*margin - height) / 2
+	case "bottom":
+		top = margin + height
+	}
+
+	avail := width - 2*margin
+	for _, l := range lines {
+		font := pdf.Helvetica
+		if l.line.Bold {
+			font = pdf.HelveticaBold
+		}
+		size := l.line.Size
+		if w := pdf.Width(font, size, l.text); w > avail {
+			size *= avail / w
+		}
+		top -= float64(l.line.Space) + 1.2*l.line.Size
+		// The baseline sits above the line's descent
+		baseline := top + 0.25*l.line.Size
+		x := margin
+		switch l.line.Align {
+		case "center":
+			x += (avail - pdf.Width(font, size, l.text)) / 2
+		case "right":
+			x += avail - pdf.Width(font, size, l.text)
+		}
+		page.Text(x, baseline, font, size, l.text)
+	}
+	return page, nil
+}
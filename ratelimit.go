@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket per client: each holds up to burst
+// requests and refills at rate per second
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	clients   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// loadRateLimiter reads RATE_LIMIT (requests per minute per client IP) and
+// RATE_LIMIT_BURST (default: one minute's worth); nil when unset
+func loadRateLimiter(getenv func(string) string) (*rateLimiter, error) {
+	v := getenv("RATE_LIMIT")
+	if v == "" {
+		return nil, nil
+	}
+	perMinute, err := strconv.Atoi(v)
+	if err != nil || perMinute <= 0 {
+		return nil, fmt.Errorf("invalid RATE_LIMIT %q (expected requests per minute)", v)
+	}
+	burst := perMinute
+	if v := getenv("RATE_LIMIT_BURST"); v != "" {
+		burst, err = strconv.Atoi(v)
+		if err != nil || burst <= 0 {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_BURST %q", v)
+		}
+	}
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		clients: make(map[string]*bucket),
+	}, nil
+}
+
+// sharedBucketScript is allow's token bucket run in Redis, so replicas
+// sharing it share each client's bucket. It returns whether a token was
+// taken and the tokens left (as a string; Lua numbers become integers).
+const sharedBucketScript = `
+local rate, burst, now = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(b[1]) or burst
+local last = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate)
+local taken = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	taken = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', ARGV[3])
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {taken, tostring(tokens)}
+`
+
+// allow takes a token from key's bucket, or reports how long until one is
+// available. With REDIS_URL set the bucket is shared by every replica,
+// falling back to this replica's own when Redis can't be reached.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	if sharedCacheUp() {
+		ok, wait, err := l.allowShared(key, now)
+		if err == nil {
+			return ok, wait
+		}
+		sharedCacheFailed("rate limit", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget clients whose buckets have refilled; they'd start full anyway
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) > full {
+		for k, b := range l.clients {
+			if now.Sub(b.last) > full {
+				delete(l.clients, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.clients[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.clients[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// allowShared is allow with the bucket kept in Redis
+func (l *rateLimiter) allowShared(key string, now time.Time) (bool, time.Duration, error) {
+	reply, err := sharedCache.Eval(context.Background(), sharedBucketScript,
+		[]string{sharedPrefix + "ratelimit:" + key},
+		strconv.FormatFloat(l.rate, 'f', -1, 64),
+		strconv.FormatFloat(l.burst, 'f', -1, 64),
+		strconv.FormatFloat(float64(now.UnixMilli())/1000, 'f', 3, 64))
+	if err != nil {
+		return false, 0, err
+	}
+	items, _ := reply.([]any)
+	if len(items) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+	taken, _ := items[0].(int64)
+	left, _ := items[1].([]byte)
+	tokens, err := strconv.ParseFloat(string(left), 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+	if taken == 1 {
+		return true, 0, nil
+	}
+	return false, time.Duration((1 - tokens) / l.rate * float64(time.Second)), nil
+}
+
+// rateLimitMiddleware rejects requests over the client's limit with 429
+func rateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limiter := cfg().limiter
+		if limiter == nil || r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+		ok, wait := limiter.allow(clientIP(r), time.Now())
+		if !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeErrorDetail(w, r, http.StatusTooManyRequests, codeRateLimited, "too many requests",
+				fmt.Sprintf("retry after %ds", seconds))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// apiHandler wraps a public API handler with CORS and rate limiting
+func apiHandler(next http.HandlerFunc) http.HandlerFunc {
+	return corsMiddleware(rateLimitMiddleware(next))
+}
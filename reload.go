@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// servedMu guards servedFile, the identity of the database file the
+	// serving connection was opened on
+	servedMu   sync.Mutex
+	servedFile os.FileInfo
+
+	// dbRecheck asks the watcher to check the database file now
+	dbRecheck = make(chan struct{}, 1)
+)
+
+// noteServedFile records the file at dbPath as the one being served
+func noteServedFile(dbPath string) {
+	fi, err := os.Stat(dbPath)
+	if err != nil {
+		return
+	}
+	servedMu.Lock()
+	servedFile = fi
+	servedMu.Unlock()
+}
+
+// startDBWatcher reopens the serving connection whenever the file at dbPath
+// is replaced by a different one (a rename or a symlink swap), so a new
+// snapshot can be dropped in without a restart. Writes to the file itself,
+// such as imports, don't count: SQLite sees those on its own. With a zero
+// interval the file is only checked on request (requestDBRecheck).
+func startDBWatcher(ctx context.Context, dbPath string, interval time.Duration) {
+	go func() {
+		var tick <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		// A replacement that failed to open isn't retried until it changes
+		var rejected os.FileInfo
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick:
+			case <-dbRecheck:
+				// An explicit check retries a file that failed to open
+				rejected = nil
+			}
+
+			servedMu.Lock()
+			served := servedFile
+			servedMu.Unlock()
+			if served == nil || getDB() == nil {
+				continue
+			}
+			fi, err := os.Stat(dbPath)
+			if err != nil || os.SameFile(served, fi) || sameVersion(rejected, fi) {
+				continue
+			}
+
+			log.Printf("Database file %s was replaced, reopening", dbPath)
+			if err := reopenDB(ctx, dbPath); err != nil {
+				// Keep serving the old file
+				log.Printf("Failed to reopen database: %v", err)
+				rejected = fi
+			}
+		}
+	}()
+}
+
+// requestDBRecheck has the watcher check the database file without waiting
+// for the next interval
+func requestDBRecheck() {
+	select {
+	case dbRecheck <- struct{}{}:
+	default:
+	}
+}
+
+// sameVersion reports whether a and b are the same file, unmodified
+func sameVersion(a, b os.FileInfo) bool {
+	return a != nil && os.SameFile(a, b) && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// reopenDB replaces the serving connection with one to the new file at
+// dbPath and drops anything cached about the old one. Queries already
+// running finish against the old file.
+func reopenDB(ctx context.Context, dbPath string) error {
+	conn, err := sql.Open(apiDriver, servingDSN(dbPath))
+	if err != nil {
+		return err
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return err
+	}
+	if !verifyDatabase(ctx, conn, dbPath) {
+		conn.Close()
+		return errors.New("database failed verification")
+	}
+	conn.SetMaxOpenConns(25)
+	conn.SetMaxIdleConns(5)
+	conn.SetConnMaxLifetime(5 * time.Minute)
+
+	noteServedFile(dbPath)
+	old := getDB()
+	setDB(conn)
+	invalidateCaches()
+	if old != nil {
+		// Close waits for in-flight queries
+		go old.Close()
+	}
+	return nil
+}
+
+// invalidateCaches forgets what was cached about the previous database
+func invalidateCaches() {
+	columnCache.Range(func(key, _ any) bool {
+		columnCache.Delete(key)
+		return true
+	})
+	snapshotMu.Lock()
+	snapshotETag = ""
+	snapshotMu.Unlock()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Repeater is a repeater directory entry
+type Repeater struct {
+	Callsign       string   `json:"callsign"`
+	Trustee        string   `json:"trustee"`
+	Frequency      float64  `json:"frequency"`
+	InputFrequency *float64 `json:"input_frequency,omitempty"`
+	Tone           string   `json:"tone,omitempty"`
+	Mode           string   `json:"mode,omitempty"`
+	Access         string   `json:"access,omitempty"`
+	Status         string   `json:"status,omitempty"`
+	City           string   `json:"city,omitempty"`
+	County         string   `json:"county,omitempty"`
+	State          string   `json:"state,omitempty"`
+	Country        string   `json:"country,omitempty"`
+	Lat            *float64 `json:"lat,omitempty"`
+	Lon            *float64 `json:"lon,omitempty"`
+}
+
+// handleRepeaters handles /v1/{callsign}/repeaters requests: the repeaters a
+// callsign is trustee of, including those using its own call
+func handleRepeaters(w http.ResponseWriter, r *http.Request, callsign string) {
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	repeaters := []Repeater{}
+	status := "OK"
+
+	if d := getDB(); d != nil {
+		rows, err := d.QueryContext(ctx, `
+			SELECT callsign, trustee, frequency, input_frequency, COALESCE(tone, ''), COALESCE(mode, ''),
+				COALESCE(access, ''), COALESCE(status, ''), COALESCE(city, ''), COALESCE(county, ''),
+				COALESCE(state, ''), COALESCE(country, ''), latitude, longitude
+			FROM repeaters
+			WHERE trustee = ?1 OR callsign = ?1
+			ORDER BY frequency, callsign
+		`, callsign)
+		if err != nil {
+			// Databases without a repeater import have no repeaters table
+			if !strings.Contains(err.Error(), "no such table") {
+				log.Printf("Database error looking up repeaters for %s: %v", callsign, err)
+			}
+		} else {
+			defer rows.Close()
+			for rows.Next() {
+				var rp Repeater
+				var input, lat, lon sql.NullFloat64
+				if err := rows.Scan(&rp.Callsign, &rp.Trustee, &rp.Frequency, &input, &rp.Tone, &rp.Mode,
+					&rp.Access, &rp.Status, &rp.City, &rp.County, &rp.State, &rp.Country, &lat, &lon); err != nil {
+					log.Printf("Error scanning repeater for %s: %v", callsign, err)
+					break
+				}
+				if input.Valid {
+					rp.InputFrequency = &input.Float64
+				}
+				if lat.Valid {
+					rp.Lat = &lat.Float64
+				}
+				if lon.Valid {
+					rp.Lon = &lon.Float64
+				}
+				repeaters = append(repeaters, rp)
+			}
+		}
+	}
+
+	if len(repeaters) == 0 {
+		status = "NOT_FOUND"
+		markNotFound(w)
+	}
+
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"callsign":  callsign,
+		"repeaters": repeaters,
+		"messages":  map[string]string{"status": status},
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/report"
+)
+
+// parseReportFilter reads ?since=, ?until= (YYYY-MM-DD), ?state=, and
+// ?grid= for the report endpoints. Every match is read (up to
+// maxListMatches); ?limit= sets the page size.
+func parseReportFilter(r *http.Request) (report.Filter, error) {
+	q := r.URL.Query()
+	f := report.Filter{
+		Since: q.Get("since"),
+		Until: q.Get("until"),
+		State: q.Get("state"),
+		Grid:  q.Get("grid"),
+		Limit: maxListMatches,
+	}
+	return f, f.Validate()
+}
+
+// handleReport adapts a report query to an HTTP handler. The response is a
+// page of rows with the filter period.
+func handleReport[T any](key string, days int, query func(context.Context, report.Filter) ([]T, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseReportFilter(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+			return
+		}
+		list, err := parseListParams[T](r, 100)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+			return
+		}
+
+		f = f.WithDefaults(days)
+
+		ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+		defer cancel()
+
+		rows, err := query(ctx, f)
+		switch {
+		case errors.Is(err, errNoDB):
+			writeError(w, r, http.StatusServiceUnavailable, codeDBUnavailable, "database not connected")
+			return
+		case errors.Is(err, report.ErrNoHistory):
+			writeError(w, r, http.StatusServiceUnavailable, codeUnsupportedDatabase, err.Error())
+			return
+		case err != nil:
+			log.Printf("Report %s failed: %v", key, err)
+			writeError(w, r, http.StatusInternalServerError, codeQueryFailed, key+" query failed")
+			return
+		}
+
+		writeList(w, r, key, rows, list, map[string]interface{}{
+			"since": f.Since,
+			"until": f.Until,
+		})
+	}
+}
+
+// errNoDB is returned by report queries before the database is attached
+var errNoDB = errors.New("database not connected")
+
+// handleUpgrades handles /v1/upgrades: operators whose FCC class went up
+var handleUpgrades = handleReport("upgrades", report.UpgradeDays, func(ctx context.Context, f report.Filter) ([]report.Upgrade, error) {
+	d := getDB()
+	if d == nil {
+		return nil, errNoDB
+	}
+	return report.Upgrades(ctx, d, cfg().redaction, f)
+})
+
+// handleCancelled handles /v1/cancelled: licenses newly cancelled or expired
+var handleCancelled = handleReport("cancelled", report.CancellationDays, func(ctx context.Context, f report.Filter) ([]report.Cancellation, error) {
+	d := getDB()
+	if d == nil {
+		return nil, errNoDB
+	}
+	return report.Cancellations(ctx, d, cfg().redaction, f)
+})
+
+// handleSequentialForecast handles /v1/sequential-forecast: the next
+// callsigns the FCC's sequential system is expected to issue per region and
+// group, from the grants of the last days (default 30). ?count= sets how
+// many calls each lists, and ?region= and ?group= narrow the report.
+func handleSequentialForecast(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	days, err := positiveParam(q.Get("days"), report.SequentialDays)
+	if err != nil {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter, "days must be a positive integer", "days")
+		return
+	}
+	count, err := positiveParam(q.Get("count"), 5)
+	if err != nil || count > report.MaxForecast {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter,
+			"count must be between 1 and "+strconv.Itoa(report.MaxForecast), "count")
+		return
+	}
+	region, err := positiveParam(q.Get("region"), 0)
+	if err != nil || region > 13 {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter, "region must be between 1 and 13", "region")
+		return
+	}
+	group := strings.ToUpper(q.Get("group"))
+	if len(group) > 1 || !strings.Contains("ABCD", group) {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter, "group must be A, B, C, or D", "group")
+		return
+	}
+	list, err := parseListParams[report.Forecast](r, 100)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	d := getDB()
+	if d == nil {
+		writeError(w, r, http.StatusServiceUnavailable, codeDBUnavailable, "database not connected")
+		return
+	}
+	if !hasColumn(ctx, d, "callsigns", "licensed_since") {
+		writeError(w, r, http.StatusServiceUnavailable, codeUnsupportedDatabase,
+			"database predates licensed_since; run an importer to migrate it")
+		return
+	}
+
+	f := report.Filter{Limit: report.MaxLimit}.WithDefaults(days)
+	forecasts, err := report.SequentialForecast(ctx, d, f, count)
+	if err != nil {
+		log.Printf("Sequential forecast failed: %v", err)
+		writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "sequential forecast query failed")
+		return
+	}
+	matches := []report.Forecast{}
+	for _, fc := range forecasts {
+		if (region == 0 || fc.Region == region) && (group == "" || fc.Group == group) {
+			matches = append(matches, fc)
+		}
+	}
+
+	writeList(w, r, "forecasts", matches, list, map[string]interface{}{
+		"since": f.Since,
+		"until": f.Until,
+	})
+}
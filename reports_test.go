@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/schema"
+)
+
+// openReportDB serves a database with one upgrade and one cancellation
+// recorded today
+func openReportDB(t *testing.T) {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	d, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "reports.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		setDB(nil)
+		d.Close()
+	})
+	if err := schema.Ensure(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO callsigns (callsign, license_status, radio_service_code, operator_class, first_name, last_name,
+			city, state, grid_square, country, data_source)
+			VALUES ('W5JD', 'A', 'HA', 'G', 'JANE', 'DOE', 'AUSTIN', 'TX', 'EM10', 'United States', 'FCC'),
+			('W5JP', 'C', 'HA', 'T', 'JOHN', 'PUBLIC', 'DALLAS', 'TX', 'EM12', 'United States', 'FCC')`,
+		`INSERT INTO callsign_history (callsign, data_source, field, old_value, new_value, changed_at)
+			VALUES ('W5JD', 'FCC', 'operator_class', 'T', 'G', CURRENT_TIMESTAMP),
+			('W5JP', 'FCC', 'license_status', 'A', 'C', CURRENT_TIMESTAMP)`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setDB(d)
+}
+
+// useSettings makes the settings read from env active for the test
+func useSettings(t *testing.T, env map[string]string) {
+	t.Helper()
+	s, err := loadSettings(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := active.Swap(s)
+	t.Cleanup(func() { active.Store(prev) })
+}
+
+func TestReportsRedactNames(t *testing.T) {
+	openReportDB(t)
+	reports := []struct {
+		path    string
+		handler http.HandlerFunc
+		call    string
+		names   []string
+	}{
+		{"/v1/upgrades", handleUpgrades, "W5JD", []string{"JANE", "DOE"}},
+		{"/v2/upgrades", handleUpgrades, "W5JD", []string{"JANE", "DOE"}},
+		{"/v1/cancelled", handleCancelled, "W5JP", []string{"JOHN", "PUBLIC"}},
+		{"/v2/cancelled", handleCancelled, "W5JP", []string{"JOHN", "PUBLIC"}},
+	}
+	for _, tt := range []struct {
+		name   string
+		env    map[string]string
+		hidden bool
+	}{
+		{"unredacted", nil, false},
+		{"all", map[string]string{"REDACT_NAMES": "true"}, true},
+		{"country", map[string]string{"REDACT_NAMES": "United States"}, true},
+		{"other country", map[string]string{"REDACT_NAMES": "Japan"}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			useSettings(t, tt.env)
+			for _, rep := range reports {
+				w := httptest.NewRecorder()
+				rep.handler(w, httptest.NewRequest(http.MethodGet, rep.path, nil))
+				body := w.Body.String()
+				if w.Code != http.StatusOK || !strings.Contains(body, rep.call) {
+					t.Fatalf("%s: status %d, want %s in %s", rep.path, w.Code, rep.call, body)
+				}
+				for _, name := range rep.names {
+					if strings.Contains(body, name) == tt.hidden {
+						t.Errorf("%s: name %s shown = %v, want %v: %s", rep.path, name, !tt.hidden, !tt.hidden, body)
+					}
+				}
+			}
+		})
+	}
+}
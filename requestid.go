@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
+)
+
+// requestIDHeaders are the headers an upstream proxy or service may pass a
+// request's ID in, in order of preference. The ID is always returned as
+// X-Request-ID.
+var requestIDHeaders = []string{"X-Request-ID", "X-Correlation-ID"}
+
+// maxRequestIDLength bounds an accepted upstream ID
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// requestIDMiddleware gives every request an ID: the upstream one if it
+// sent a usable one, else a new random one. The ID is returned in the
+// X-Request-ID header, logged with the request, and put in error bodies
+// and trace spans, so a bad lookup can be followed across services.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := ""
+		for _, h := range requestIDHeaders {
+			if v := r.Header.Get(h); validRequestID(v) {
+				id = v
+				break
+			}
+		}
+		if id == "" {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := r.Context()
+		tracing.FromContext(ctx).SetAttributes(tracing.String("http.request.id", id))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, requestIDKey{}, id)))
+	})
+}
+
+// requestIDFrom returns the ID of the request ctx belongs to, or ""
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID reports whether an upstream ID is safe to echo and log:
+// non-empty, bounded, and printable ASCII without spaces or quotes
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if c := id[i]; c <= ' ' || c > '~' || c == '"' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit ID in hex
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
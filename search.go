@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/phonetic"
+)
+
+// addressAbbreviations maps street suffixes and directions to the USPS
+// abbreviations, so "123 North Main Street" matches "123 N MAIN ST"
+var addressAbbreviations = map[string]string{
+	"NORTH": "N", "SOUTH": "S", "EAST": "E", "WEST": "W",
+	"NORTHEAST": "NE", "NORTHWEST": "NW", "SOUTHEAST": "SE", "SOUTHWEST": "SW",
+	"STREET": "ST", "AVENUE": "AVE", "AV": "AVE", "ROAD": "RD", "DRIVE": "DR",
+	"LANE": "LN", "COURT": "CT", "CIRCLE": "CIR", "BOULEVARD": "BLVD",
+	"PLACE": "PL", "TERRACE": "TER", "PARKWAY": "PKWY", "HIGHWAY": "HWY",
+	"TRAIL": "TRL", "SQUARE": "SQ",
+	"APARTMENT": "APT", "SUITE": "STE", "BUILDING": "BLDG",
+}
+
+// normalizeAddress reduces a street address to upper-case words with
+// punctuation removed and common words abbreviated. "P.O. Box" and
+// "Post Office Box" both become "PO BOX".
+func normalizeAddress(s string) string {
+	words := strings.FieldsFunc(strings.ToUpper(s), func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	out := make([]string, 0, len(words))
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		// P O BOX, P.O. BOX, and POST OFFICE BOX all become PO BOX
+		if (w == "P" || w == "POST") && i+1 < len(words) && (words[i+1] == "O" || words[i+1] == "OFFICE") {
+			out = append(out, "PO")
+			i++
+			continue
+		}
+		if abbr, ok := addressAbbreviations[w]; ok {
+			w = abbr
+		}
+		out = append(out, w)
+	}
+	return strings.Join(out, " ")
+}
+
+// addressMatches reports whether a stored address matches a normalized query:
+// the same address, or the same address with a unit (APT 4) after it
+func addressMatches(stored, query string) bool {
+	stored = normalizeAddress(stored)
+	return stored == query || strings.HasPrefix(stored, query+" ")
+}
+
+// likePrefix returns a LIKE pattern matching values starting with s, with
+// LIKE wildcards in s escaped (use ESCAPE '\')
+func likePrefix(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s) + "%"
+}
+
+// handleSearch handles /v1/search requests: reverse lookups of the records
+// matching an exact ?frn=, a ?zip= (5-digit ZIPs also match ZIP+4), a
+// normalized street ?address=, a last or entity name that
+// ?name_sounds_like= (by Metaphone or Soundex), and/or callsigns starting
+// with ?callsign_prefix= (for autocomplete). Only active licenses are
+// returned unless ?include_inactive=1 is set.
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	frn := strings.TrimSpace(q.Get("frn"))
+	zip := strings.ReplaceAll(strings.TrimSpace(q.Get("zip")), "-", "")
+	address := normalizeAddress(q.Get("address"))
+	soundsLike := strings.TrimSpace(q.Get("name_sounds_like"))
+	callPrefix := strings.ToUpper(strings.TrimSpace(q.Get("callsign_prefix")))
+	if frn == "" && zip == "" && address == "" && soundsLike == "" && callPrefix == "" {
+		writeError(w, r, http.StatusBadRequest, codeInvalidParameter, "one of frn, zip, address, name_sounds_like, or callsign_prefix is required")
+		return
+	}
+	soundex, metaphone := phonetic.Soundex(soundsLike), phonetic.Metaphone(soundsLike)
+	if soundsLike != "" && soundex == "" {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter, "name_sounds_like must contain letters", "name_sounds_like")
+		return
+	}
+	if frn != "" && !allDigits(frn) {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter, "frn must be numeric", "frn")
+		return
+	}
+	if zip != "" && (!allDigits(zip) || len(zip) < 5) {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter, "zip must be a 5 or 9 digit ZIP code", "zip")
+		return
+	}
+	if callPrefix != "" && (len(callPrefix) < 2 || !validCallPrefix(callPrefix)) {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter,
+			"callsign_prefix must be at least 2 letters, digits, or slashes", "callsign_prefix")
+		return
+	}
+	if address != "" && cfg().redaction.Addresses.All() {
+		writeError(w, r, http.StatusForbidden, codeRedacted, "address search is disabled on this server")
+		return
+	}
+	if soundsLike != "" && cfg().redaction.Names.All() {
+		writeError(w, r, http.StatusForbidden, codeRedacted, "name search is disabled on this server")
+		return
+	}
+	list, err := parseListParams[SourceRecord](r, 100)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+	inactive, _ := strconv.ParseBool(q.Get("include_inactive"))
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	d := getDB()
+	if d == nil {
+		writeError(w, r, http.StatusServiceUnavailable, codeDBUnavailable, "database not connected")
+		return
+	}
+	if frn != "" && !hasColumn(ctx, d, "callsigns", "frn") {
+		writeError(w, r, http.StatusServiceUnavailable, codeUnsupportedDatabase,
+			"database predates FRNs; run an importer to migrate it")
+		return
+	}
+
+	if soundsLike != "" && !hasColumn(ctx, d, "callsigns", "name_metaphone") {
+		writeError(w, r, http.StatusServiceUnavailable, codeUnsupportedDatabase,
+			"database predates phonetic name keys; run an importer to migrate it")
+		return
+	}
+
+	var where []string
+	var args []interface{}
+	order := "status = 'A' DESC, callsign, source"
+	if frn != "" {
+		// FRNs are 10 digits but often written without leading zeros
+		where = append(where, "frn = ?")
+		args = append(args, strings.Repeat("0", max(0, 10-len(frn)))+frn)
+	}
+	if zip != "" {
+		where = append(where, `zip_code LIKE ? ESCAPE '\'`)
+		args = append(args, likePrefix(zip))
+	}
+	if address != "" {
+		// Narrow by the first word (usually the house number) in SQL and
+		// compare the normalized address below
+		first, _, _ := strings.Cut(address, " ")
+		if first == "PO" {
+			// Stored as PO, P.O., P O, or POST OFFICE
+			first = "P"
+		}
+		where = append(where, `street_address LIKE ? ESCAPE '\'`)
+		args = append(args, likePrefix(first))
+	}
+	if soundsLike != "" {
+		// Metaphone matches rank above Soundex-only ones
+		where = append(where, "(name_metaphone = ? OR name_soundex = ?)")
+		args = append(args, metaphone, soundex)
+		order = "(name_metaphone = ?) DESC, " + order
+		// Records with redacted names never match, so the search can't reveal them
+		if c := cfg().redaction.Names.Column("1", countryExpr(ctx, d)); c != "1" {
+			where = append(where, c+" IS NOT NULL")
+		}
+	}
+	if callPrefix != "" {
+		// A range rather than LIKE, which can't use the case-sensitive
+		// callsign index. Callsigns are ASCII, so DEL sorts after them all.
+		where = append(where, "callsign >= ? AND callsign < ?")
+		args = append(args, callPrefix, callPrefix+"\x7f")
+		if frn == "" && zip == "" && address == "" && soundsLike == "" {
+			// Index order, so a short prefix stops at the first page
+			order = "callsign, source"
+		}
+	}
+	if !inactive {
+		// Unary + keeps SQLite on the more selective frn/zip/address/name/callsign indexes
+		where = append(where, "+license_status = 'A'")
+	}
+
+	if soundsLike != "" {
+		args = append(args, metaphone)
+	}
+	args = append(args, maxListMatches)
+
+	rows, err := d.QueryContext(ctx, `
+		SELECT `+recordColumns(ctx, d)+`
+		FROM callsigns
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY `+order+`
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		log.Printf("Search query failed: %v", err)
+		writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "search query failed")
+		return
+	}
+	defer rows.Close()
+
+	out := newListWriter[SourceRecord](w, r, "search", list)
+	for rows.Next() {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			log.Printf("Search scan failed: %v", err)
+			continue
+		}
+		if address != "" && !addressMatches(rec.Addr1, address) {
+			continue
+		}
+		if out.add(rec) {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Search query failed: %v", err)
+		if !out.started() {
+			writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "search query failed")
+		}
+		return
+	}
+
+	out.finish(nil)
+}
+
+// validCallPrefix reports whether s only has the characters of a callsign
+func validCallPrefix(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '/') {
+			return false
+		}
+	}
+	return true
+}
+
+// allDigits reports whether s is non-empty and only ASCII digits
+func allDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// serviceName is the name the API is registered under as a Windows service
+const serviceName = "hamqrzdb"
+
+// parseServiceFlags parses the API's command line. The server itself is
+// configured through the environment; the only flags manage the Windows
+// service.
+func parseServiceFlags(args []string) (install, uninstall bool) {
+	fs := flag.NewFlagSet("hamqrzdb-api", flag.ExitOnError)
+	fs.BoolVar(&install, "install-service", false, "Register the API as a Windows service that starts with the system, then exit")
+	fs.BoolVar(&uninstall, "uninstall-service", false, "Remove the Windows service, then exit")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hamqrzdb-api [flags]")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "The server is configured through environment variables (see the README).")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	return install, uninstall
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+var errNotWindows = errors.New("services can only be installed on Windows; use systemd or Docker here")
+
+func installService() error   { return errNotWindows }
+func uninstallService() error { return errNotWindows }
+
+// runService reports that the API isn't running as a Windows service
+func runService(ctx context.Context, serve func(context.Context)) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,167 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceEnvPrefixes match the names of the variables the API is configured
+// with. Their values at install time are stored with the service, which
+// otherwise starts with only the system environment, so a setting missing
+// here is silently dropped from the service: add new settings' names too.
+var serviceEnvPrefixes = []string{
+	"ADMIN_", "AWS_", "BACKUP_", "BOOTSTRAP_", "CACHE_", "CLIENT_IP_", "CONFIG_", "CORS_", "DB_",
+	"DNS_", "EQSL_", "FOLLOW_", "FORMAT_", "FRESHNESS_", "IMPORT_", "LISTEN", "MAINTAIN_",
+	"NOT_FOUND_", "NOTIFY_", "OTEL_", "PORT", "PUBLIC_", "QSL_", "QUERY_", "RATE_", "READY_",
+	"REDACT_", "REDIS_", "REPLICATION_", "RESPONSE_", "ROLE", "SMTP_", "SNAPSHOT_", "STRICT_",
+	"TELNET_", "TRUSTED_", "UPDATE_", "USAGE_", "VERIFY_",
+}
+
+// installService registers this binary as an automatically started service.
+// DB_PATH is always stored: the service runs as LocalSystem, whose %APPDATA%
+// isn't the installing user's.
+func installService() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dbPath, err := filepath.Abs(configuredDBPath())
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager (run as Administrator): %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "HamQRZDB callsign API",
+		Description: "Serves amateur radio callsign lookups from " + dbPath,
+		StartType:   mgr.StartAutomatic,
+	})
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	env := []string{"DB_PATH=" + dbPath}
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if name != "DB_PATH" && serviceEnvVar(name) {
+			env = append(env, kv)
+		}
+	}
+	sort.Strings(env)
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+serviceName, registry.SET_VALUE)
+	if err != nil {
+		s.Delete()
+		return err
+	}
+	defer key.Close()
+	if err := key.SetStringsValue("Environment", env); err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to store the service environment: %w", err)
+	}
+
+	log.Printf("Installed service %s serving %s; start it with: sc start %s", serviceName, dbPath, serviceName)
+	return nil
+}
+
+func serviceEnvVar(name string) bool {
+	for _, p := range serviceEnvPrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// uninstallService removes the service registration
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager (run as Administrator): %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	log.Printf("Removed service %s", serviceName)
+	return nil
+}
+
+// runService runs serve under the service manager when it started the
+// process, and reports whether it did. The log goes to hamqrzdb-api.log
+// beside the database, since a service has no console.
+func runService(ctx context.Context, serve func(context.Context)) (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false, err
+	}
+
+	logPath := filepath.Join(filepath.Dir(configuredDBPath()), "hamqrzdb-api.log")
+	if err := os.MkdirAll(filepath.Dir(logPath), 0o755); err == nil {
+		if f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err == nil {
+			defer f.Close()
+			log.SetOutput(f)
+		}
+	}
+
+	return true, svc.Run(serviceName, &apiService{ctx: ctx, serve: serve})
+}
+
+// apiService adapts serve to the service manager's start and stop requests
+type apiService struct {
+	ctx   context.Context
+	serve func(context.Context)
+}
+
+func (s *apiService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		s.serve(ctx)
+		close(done)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				// serve drains in-flight requests before returning
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+				<-done
+				return false, 0
+			}
+		case <-done:
+			return false, 0
+		}
+	}
+}
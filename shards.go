@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/shard"
+	"github.com/chriskacerguis/hamqrzdb/internal/sqlite"
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
+)
+
+// apiDriver is the driver the API opens its read-only connections with. It
+// attaches the shards of a sharded database to every connection.
+const apiDriver = "sqlite3-api"
+
+// registerAPIDriver registers apiDriver for the database at dbPath, memory
+// mapping up to mmapSize bytes of it. Call it once tracing is configured, so
+// queries are traced when enabled.
+func registerAPIDriver(dbPath string, mmapSize int64) {
+	attach := shard.Attach(dbPath, immutable)
+	hook := func(c sqlite.Conn) error {
+		if mmapSize > 0 {
+			if _, err := c.ExecContext(context.Background(), fmt.Sprintf("PRAGMA mmap_size = %d", mmapSize), nil); err != nil {
+				return err
+			}
+		}
+		return attach(c)
+	}
+	sql.Register(apiDriver, tracing.WrapDriver(sqlite.NewDriver(hook)))
+}
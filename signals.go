@@ -0,0 +1,39 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleSignals serves the classic daemon signals until ctx is done: SIGHUP
+// reloads the config and rechecks the database file, and SIGUSR1 starts
+// dailyUpdate as an admin job
+func handleSignals(ctx context.Context, dailyUpdate func(context.Context) error) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGUSR1)
+	go func() {
+		defer signal.Stop(sigs)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-sigs:
+				switch sig {
+				case syscall.SIGHUP:
+					log.Println("SIGHUP: reloading config and rechecking the database file")
+					reloadConfig()
+					requestDBRecheck()
+				case syscall.SIGUSR1:
+					if _, started := startJob(ctx, "update-daily", dailyUpdate); !started {
+						log.Println("SIGUSR1: skipping the daily update, another job is running")
+					}
+				}
+			}
+		}
+	}()
+}
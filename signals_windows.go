@@ -0,0 +1,7 @@
+package main
+
+import "context"
+
+// handleSignals does nothing on Windows, which has no SIGHUP or SIGUSR1;
+// restart the service to reload, and use /admin/update/daily
+func handleSignals(ctx context.Context, dailyUpdate func(context.Context) error) {}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/tracing"
+)
+
+var (
+	// snapshotMu serializes snapshot creation; one cached copy is kept
+	snapshotMu   sync.Mutex
+	snapshotPath string
+	snapshotETag string
+)
+
+// requireReplication allows requests bearing REPLICATION_TOKEN or ADMIN_TOKEN
+func requireReplication(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := cfg()
+		got := []byte(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		for _, token := range []string{s.replicationToken, s.adminToken} {
+			if token != "" && subtle.ConstantTimeCompare(got, []byte(token)) == 1 {
+				next(w, r)
+				return
+			}
+		}
+		if s.replicationToken == "" && s.adminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+	}
+}
+
+// databaseETag identifies the current contents of the database at dbPath by
+// the size and modification time of the file and its WAL, which every
+// import, override upload, and maintenance run changes
+func databaseETag(dbPath string) (string, error) {
+	fi, err := os.Stat(dbPath)
+	if err != nil {
+		return "", err
+	}
+	tag := fmt.Sprintf("%x-%x", fi.ModTime().UnixNano(), fi.Size())
+	if wal, err := os.Stat(dbPath + "-wal"); err == nil {
+		tag += fmt.Sprintf("-%x-%x", wal.ModTime().UnixNano(), wal.Size())
+	}
+	return `"` + tag + `"`, nil
+}
+
+// handleAdminSnapshot handles GET /admin/snapshot: a consistent copy of the
+// database for followers. The copy is rebuilt only when the database has
+// changed, and If-None-Match with the current ETag returns 304.
+func handleAdminSnapshot(dbPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeAdminJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+			return
+		}
+		d := getDB()
+		if d == nil {
+			writeAdminJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "database not connected"})
+			return
+		}
+
+		path, etag, err := currentSnapshot(r.Context(), d, dbPath)
+		if err != nil {
+			log.Printf("Snapshot failed: %v", err)
+			writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "snapshot failed"})
+			return
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			log.Printf("Snapshot failed: %v", err)
+			writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "snapshot failed"})
+			return
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			log.Printf("Snapshot failed: %v", err)
+			writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "snapshot failed"})
+			return
+		}
+
+		// ServeContent handles If-None-Match and Range, so an interrupted
+		// download can resume
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/vnd.sqlite3")
+		http.ServeContent(w, r, "hamqrzdb.sqlite", fi.ModTime(), f)
+	}
+}
+
+// currentSnapshot returns the cached snapshot file, rebuilding it if the
+// database changed since it was taken
+func currentSnapshot(ctx context.Context, d *sql.DB, dbPath string) (path, etag string, err error) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+
+	etag, err = databaseETag(dbPath)
+	if err != nil {
+		return "", "", err
+	}
+	if etag == snapshotETag && snapshotPath != "" {
+		if _, err := os.Stat(snapshotPath); err == nil {
+			return snapshotPath, etag, nil
+		}
+	}
+
+	ctx, span := tracing.Start(ctx, "build snapshot")
+	defer span.End()
+	start := time.Now()
+
+	tmp, err := os.CreateTemp("", "hamqrzdb-snapshot-*.sqlite")
+	if err != nil {
+		return "", "", err
+	}
+	path = tmp.Name()
+	tmp.Close()
+	os.Remove(path) // VACUUM INTO needs a new file
+
+	// VACUUM INTO reads a consistent view and writes a compacted copy of the
+	// main database only, without the temporary shard views
+	if _, err := d.ExecContext(ctx, "VACUUM main INTO ?", path); err != nil {
+		span.RecordError(err)
+		return "", "", fmt.Errorf("failed to copy database: %w", err)
+	}
+	if err := prepareSnapshot(ctx, path); err != nil {
+		os.Remove(path)
+		span.RecordError(err)
+		return "", "", err
+	}
+
+	if snapshotPath != "" {
+		os.Remove(snapshotPath)
+	}
+	snapshotPath, snapshotETag = path, etag
+	log.Printf("Built snapshot %s in %s", filepath.Base(path), time.Since(start).Round(time.Millisecond))
+	return path, etag, nil
+}
+
+// prepareSnapshot makes a copy self-contained for a follower: shard files
+// aren't included (the main database keeps every record), so the layout is
+// dropped, and the rollback journal is used since followers never write.
+func prepareSnapshot(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	for _, stmt := range []string{"DELETE FROM shards", "PRAGMA journal_mode = DELETE"} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil && !strings.Contains(err.Error(), "no such table") {
+			return fmt.Errorf("failed to prepare snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// removeSnapshot deletes the cached snapshot file on shutdown
+func removeSnapshot() {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	if snapshotPath != "" {
+		os.Remove(snapshotPath)
+		snapshotPath, snapshotETag = "", ""
+	}
+}
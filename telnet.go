@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// The telnet console: a line-based interface like a DX cluster's, for shack
+// scripts and terminal programs. LOOKUP prints a callsign's record as
+// "key: value" lines.
+
+// telnetMaxClients bounds the open console sessions
+const telnetMaxClients = 64
+
+// telnetIdle is how long a session may sit without a command
+const telnetIdle = 10 * time.Minute
+
+// telnetMaxLine bounds a command line; a client sending longer lines is
+// disconnected rather than buffered without limit
+const telnetMaxLine = 1024
+
+// telnetPrompt ends every response, so scripts know when to send the next
+// command
+const telnetPrompt = "hamqrzdb> "
+
+// telnetHelp lists the console commands
+const telnetHelp = "Commands:\r\n" +
+	"  LOOKUP <call> [<call> ...]   Show callsign records (L for short)\r\n" +
+	"  HELP                         Show this list\r\n" +
+	"  BYE                          Disconnect (also QUIT or EXIT)\r\n"
+
+// startTelnet serves the console on addr (TELNET_LISTEN). The listener is
+// opened before returning so a bad address fails at startup.
+func startTelnet(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	context.AfterFunc(ctx, func() { l.Close() })
+
+	sessions := make(chan struct{}, telnetMaxClients)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Telnet console stopped: %v", err)
+				}
+				return
+			}
+			select {
+			case sessions <- struct{}{}:
+			default:
+				fmt.Fprint(conn, "Too many sessions; try again later\r\n")
+				conn.Close()
+				continue
+			}
+			go func() {
+				defer func() { <-sessions }()
+				serveTelnet(ctx, conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// serveTelnet runs one console session
+func serveTelnet(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	ip, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	w := bufio.NewWriter(conn)
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, 0, 256), telnetMaxLine)
+	fmt.Fprint(w, "hamqrzdb callsign console. Type HELP for commands.\r\n"+telnetPrompt)
+	for {
+		if err := w.Flush(); err != nil {
+			return
+		}
+		conn.SetDeadline(time.Now().Add(telnetIdle))
+		if !sc.Scan() {
+			if errors.Is(sc.Err(), bufio.ErrTooLong) {
+				fmt.Fprint(w, "\r\nLine too long\r\n")
+				w.Flush()
+			}
+			return
+		}
+		fields := strings.Fields(stripTelnetCommands(sc.Text()))
+		if len(fields) == 0 {
+			fmt.Fprint(w, telnetPrompt)
+			continue
+		}
+
+		switch cmd := strings.ToUpper(fields[0]); cmd {
+		case "BYE", "QUIT", "EXIT":
+			fmt.Fprint(w, "73\r\n")
+			w.Flush()
+			return
+		case "HELP", "?":
+			fmt.Fprint(w, telnetHelp)
+		case "LOOKUP", "L":
+			if len(fields) == 1 {
+				fmt.Fprint(w, "Usage: LOOKUP <call> [<call> ...]\r\n")
+				break
+			}
+			for _, call := range fields[1:] {
+				if limiter := cfg().limiter; limiter != nil {
+					if ok, wait := limiter.allow(ip, time.Now()); !ok {
+						fmt.Fprintf(w, "Too many lookups; retry after %ds\r\n", int(wait.Seconds())+1)
+						break
+					}
+				}
+				telnetLookup(ctx, w, baseCall(call))
+			}
+		default:
+			fmt.Fprintf(w, "Unknown command %s; type HELP for commands\r\n", cmd)
+		}
+		fmt.Fprint(w, telnetPrompt)
+	}
+}
+
+// telnetLookup writes a callsign's record followed by a blank line
+func telnetLookup(ctx context.Context, w io.Writer, call string) {
+	ctx, cancel := context.WithTimeout(ctx, cfg().queryTimeout)
+	defer cancel()
+	rec, ok := callbookRecord(ctx, call)
+	if !ok {
+		fmt.Fprintf(w, "%s: not found\r\n\r\n", call)
+		return
+	}
+	for _, line := range textFields(rec.CallsignData, outputOptions{}, ": ") {
+		fmt.Fprint(w, line+"\r\n")
+	}
+	fmt.Fprint(w, "\r\n")
+}
+
+// stripTelnetCommands removes the telnet protocol's option negotiation
+// (RFC 854) that clients interleave with typed text
+func stripTelnetCommands(s string) string {
+	const iac, sb, se = 0xff, 0xfa, 0xf0
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != iac {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 >= len(s) {
+			break
+		}
+		switch c := s[i+1]; {
+		case c == iac:
+			// An escaped 0xff
+			b.WriteByte(iac)
+			i++
+		case c == sb:
+			// Subnegotiation runs to IAC SE
+			end := strings.Index(s[i:], string([]byte{iac, se}))
+			if end < 0 {
+				return b.String()
+			}
+			i += end + 1
+		case c >= 0xfb && c <= 0xfe:
+			// WILL, WONT, DO, and DONT take an option byte
+			i += 2
+		default:
+			i++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// textReplacer keeps each value on its key's line
+var textReplacer = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// handleCallsignText handles /v1/{callsign}/text/{app}: the callsign's record
+// as plain "key:value" lines, with the HamDB field names and empty fields
+// left out, for clients on slow links such as packet radio BBS gateways. A
+// record is a few hundred bytes; ?fields= trims it further.
+func handleCallsignText(w http.ResponseWriter, r *http.Request, call string) {
+	out, err := parseOutputOptions(r)
+	if err != nil {
+		writeText(w, http.StatusBadRequest, "error:"+err.Error()+"\n")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	rec, ok := lookupCallsign(ctx, call, strings.ToUpper(r.URL.Query().Get("source")))
+	if !ok {
+		markNotFound(w)
+		writeText(w, http.StatusNotFound, "call:"+call+"\nerror:not found\n")
+		return
+	}
+	lookupOverride(ctx, rec.Call).apply(&rec.CallsignData)
+
+	var b strings.Builder
+	for _, line := range textFields(rec.CallsignData, out, ":") {
+		b.WriteString(line + "\n")
+	}
+	writeText(w, http.StatusOK, b.String())
+}
+
+// textFields returns the record's non-empty fields that out selects as
+// "key" sep "value" strings, in outputFields order
+func textFields(c CallsignData, out outputOptions, sep string) []string {
+	values := c.values()
+	var fields []string
+	for _, f := range outputFields {
+		v, ok := values[f.legacy]
+		if !ok || v == "" || !out.wants(f.legacy) {
+			continue
+		}
+		fields = append(fields, f.legacy+sep+textReplacer.Replace(v))
+	}
+	return fields
+}
+
+// writeText writes a plain text body
+func writeText(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// writeLookupJSON writes a callsign lookup's response, edited by the
+// RESPONSE_TRANSFORM rules when there are any
+func writeLookupJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	rules := cfg().transform
+	if rules == nil {
+		writeJSON(w, r, http.StatusOK, v)
+		return
+	}
+
+	var doc map[string]interface{}
+	body, err := json.Marshal(v)
+	if err == nil {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		// Numbers stay as they were written
+		dec.UseNumber()
+		err = dec.Decode(&doc)
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "failed to encode response")
+		return
+	}
+
+	app, call := parseLookupPath(r.URL.EscapedPath())
+	request := map[string]string{"app": app, "callsign": call, "path": r.URL.Path}
+	for name, values := range r.URL.Query() {
+		if _, ok := request[name]; !ok && len(values) > 0 {
+			request[name] = values[0]
+		}
+	}
+	rules.Apply(doc, request)
+	writeJSON(w, r, http.StatusOK, doc)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/i18n"
+)
+
+// Translations is the response of /v1/translations
+type Translations struct {
+	// Lang is the language chosen for the request
+	Lang      string            `json:"lang"`
+	Languages []string          `json:"languages"`
+	Messages  map[string]string `json:"messages"`
+}
+
+// requestLanguage returns the language to describe things in: ?lang= if
+// it's supported, else the best match for Accept-Language, else English.
+// The response is marked as varying by Accept-Language and says which
+// language it's in.
+func requestLanguage(w http.ResponseWriter, r *http.Request) string {
+	lang := i18n.Match(r.URL.Query().Get("lang"), r.Header.Get("Accept-Language"))
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", lang)
+	return lang
+}
+
+// handleTranslations handles /v1/translations: every readable message in
+// the request's language, keyed by id (status.A, class.E, ui.lookup, ...),
+// for the lookup page and clients that show codes to people
+func handleTranslations(w http.ResponseWriter, r *http.Request) {
+	lang := requestLanguage(w, r)
+	writeJSON(w, r, http.StatusOK, Translations{
+		Lang:      lang,
+		Languages: i18n.Languages,
+		Messages:  i18n.Messages(lang),
+	})
+}
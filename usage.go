@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// usageEvent is a single API request captured by the access log middleware
+type usageEvent struct {
+	Time      time.Time
+	App       string
+	Callsign  string
+	Path      string
+	Status    int
+	Found     bool
+	LatencyMS int64
+	ClientIP  string
+}
+
+// AppUsage summarizes requests made by a single app name
+type AppUsage struct {
+	App          string  `json:"app"`
+	Requests     int     `json:"requests"`
+	NotFound     int     `json:"not_found"`
+	Callsigns    int     `json:"unique_callsigns"`
+	AvgLatencyMS float64 `json:"avg_latency_ms"`
+	LastSeen     string  `json:"last_seen"`
+}
+
+var (
+	// usageDB is an optional writable database for api_usage rows. The main
+	// database is opened read-only, so usage is persisted separately.
+	usageDB *sql.DB
+	usageCh chan usageEvent
+)
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status   int
+	notFound bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Flush lets streamed responses (CSV) through the wrapper
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// markNotFound flags a response as a NOT_FOUND lookup. HamDB-compatible
+// NOT_FOUND responses use status 200, so the status code alone can't tell.
+func markNotFound(w http.ResponseWriter) {
+	if rec, ok := w.(*statusRecorder); ok {
+		rec.notFound = true
+	}
+}
+
+// accessLogMiddleware logs every request with the app name, callsign queried,
+// status, latency, and client IP, and queues it for usage persistence.
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		app, callsign := parseLookupPath(r.URL.EscapedPath())
+		if callsign == "" && (strings.HasPrefix(r.URL.Path, "/xml/") || r.URL.Path == "/xml.php") {
+			// Callbook lookups name the logger in agent= (QRZ) or prg= (HamQTH)
+			q := callbookQuery(r)
+			app, callsign = q["agent"]+q["prg"], strings.ToUpper(q["callsign"])
+		}
+		ev := usageEvent{
+			Time:      start.UTC(),
+			App:       app,
+			Callsign:  callsign,
+			Path:      r.URL.Path,
+			Status:    rec.status,
+			Found:     !rec.notFound && rec.status == http.StatusOK,
+			LatencyMS: time.Since(start).Milliseconds(),
+			ClientIP:  clientIP(r),
+		}
+
+		log.Printf("%s %s status=%d latency=%dms app=%q callsign=%q ip=%s request_id=%s",
+			r.Method, r.URL.Path, ev.Status, ev.LatencyMS, ev.App, ev.Callsign, ev.ClientIP, requestIDFrom(r.Context()))
+
+		if rec.notFound && ev.Callsign != "" {
+			recordNotFound(ev.Callsign)
+		}
+
+		// Only lookups are interesting for per-app analytics
+		if usageCh != nil && ev.Callsign != "" {
+			select {
+			case usageCh <- ev:
+			default:
+				// Drop rather than block the request when the writer falls behind
+			}
+		}
+	})
+}
+
+// parseLookupPath extracts the app name and callsign from /v1/{callsign}/json/{app}
+// (or /text/{app} or /custom/{app}), or just the callsign from /v2/callsign/{callsign}
+func parseLookupPath(path string) (app, callsign string) {
+	if rest, ok := strings.CutPrefix(path, "/v2/callsign/"); ok {
+		call, _ := url.PathUnescape(rest)
+		return "", strings.ToUpper(call)
+	}
+	if !strings.HasPrefix(path, "/v1/") {
+		return "", ""
+	}
+	parts := splitV1Path(path)
+	if len(parts) < 2 || (parts[1] != "json" && parts[1] != "text" && parts[1] != "custom") {
+		return "", ""
+	}
+	callsign = strings.ToUpper(parts[0])
+	if len(parts) > 2 {
+		app = parts[2]
+	}
+	return app, callsign
+}
+
+// clientIP returns the address of the client that made the request, as
+// reported by a trusted reverse proxy if it came through one
+func clientIP(r *http.Request) string {
+	return cfg().proxies.clientIP(r)
+}
+
+// openUsageDB opens (creating if needed) the database used to persist api_usage
+// rows and starts the background writer.
+func openUsageDB(ctx context.Context, path string) error {
+	conn, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return fmt.Errorf("failed to open usage database: %w", err)
+	}
+
+	schema := `
+	CREATE TABLE IF NOT EXISTS api_usage (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		ts TIMESTAMP NOT NULL,
+		app TEXT,
+		callsign TEXT,
+		path TEXT,
+		status INTEGER,
+		found INTEGER,
+		latency_ms INTEGER,
+		client_ip TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_api_usage_ts ON api_usage(ts);
+	CREATE INDEX IF NOT EXISTS idx_api_usage_app ON api_usage(app);
+	`
+	if _, err := conn.ExecContext(ctx, schema); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to create usage schema: %w", err)
+	}
+
+	usageDB = conn
+	usageCh = make(chan usageEvent, 1000)
+	go usageWriter(ctx)
+	return nil
+}
+
+// usageWriter drains usageCh and writes events in small batches
+func usageWriter(ctx context.Context) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	var batch []usageEvent
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := insertUsage(batch); err != nil {
+			log.Printf("Failed to persist %d usage events: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			flush()
+			return
+		case ev := <-usageCh:
+			batch = append(batch, ev)
+			if len(batch) >= 100 {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// insertUsage writes a batch of usage events in a single transaction. It uses
+// a background context so a batch in flight during shutdown is not lost.
+func insertUsage(batch []usageEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := usageDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO api_usage (ts, app, callsign, path, status, found, latency_ms, client_ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, ev := range batch {
+		if _, err := stmt.ExecContext(ctx, ev.Time, ev.App, ev.Callsign, ev.Path, ev.Status, ev.Found, ev.LatencyMS, ev.ClientIP); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// handleUsage handles /v1/usage requests, summarizing which apps hit the API most
+func handleUsage(w http.ResponseWriter, r *http.Request) {
+	if usageDB == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "unavailable",
+			"error":  "usage persistence is disabled (set USAGE_DB_PATH)",
+		})
+		return
+	}
+
+	days := 7
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "days must be a positive integer"})
+			return
+		}
+		days = n
+	}
+	since := time.Now().UTC().AddDate(0, 0, -days)
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	rows, err := usageDB.QueryContext(ctx, `
+		SELECT
+			COALESCE(app, ''),
+			COUNT(*),
+			SUM(CASE WHEN found THEN 0 ELSE 1 END),
+			COUNT(DISTINCT callsign),
+			AVG(latency_ms),
+			MAX(ts)
+		FROM api_usage
+		WHERE ts >= ?
+		GROUP BY app
+		ORDER BY COUNT(*) DESC
+	`, since)
+	if err != nil {
+		log.Printf("Usage query failed: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "usage query failed"})
+		return
+	}
+	defer rows.Close()
+
+	apps := []AppUsage{}
+	for rows.Next() {
+		var u AppUsage
+		var lastSeen sql.NullString
+		if err := rows.Scan(&u.App, &u.Requests, &u.NotFound, &u.Callsigns, &u.AvgLatencyMS, &lastSeen); err != nil {
+			log.Printf("Usage scan failed: %v", err)
+			continue
+		}
+		u.LastSeen = lastSeen.String
+		apps = append(apps, u)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"since": since.Format(time.RFC3339),
+		"apps":  apps,
+	})
+}
+
+// requireAdmin protects admin endpoints with the ADMIN_TOKEN bearer token.
+// When no token is configured the endpoints are disabled entirely.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := cfg().adminToken
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/batch"
+	"github.com/chriskacerguis/hamqrzdb/internal/callsign"
+	"github.com/chriskacerguis/hamqrzdb/internal/i18n"
+)
+
+// gmrsCall matches GMRS callsigns (WRAB123, KAE1234), which don't follow
+// the amateur callsign pattern
+var gmrsCall = regexp.MustCompile(`^[A-Z]{3,4}[0-9]{3,4}$`)
+
+// licenseStatuses names the FCC's license status codes, which the other
+// importers map their statuses to (plus R for revoked UK licenses)
+var licenseStatuses = map[string]string{
+	"A": "active",
+	"C": "cancelled",
+	"E": "expired",
+	"L": "pending_legal_status",
+	"P": "parent_cancelled",
+	"T": "terminated",
+	"X": "termination_pending",
+	"R": "revoked",
+}
+
+// fccClasses names the FCC's amateur operator class codes
+var fccClasses = map[string]string{
+	"N": "novice",
+	"T": "technician",
+	"P": "technician_plus",
+	"G": "general",
+	"A": "advanced",
+	"E": "amateur_extra",
+}
+
+// V2Callsign is a callsign record in the /v2 schema: flat, snake_case,
+// typed values (numbers, booleans), ISO 8601 dates, and no empty strings
+type V2Callsign struct {
+	Callsign string `json:"callsign"`
+	// Phonetic and Morse spell the callsign, with ?include=phonetic,morse
+	Phonetic   string `json:"phonetic,omitempty"`
+	Morse      string `json:"morse,omitempty"`
+	DataSource string `json:"data_source,omitempty"`
+	// Status is a readable license status such as active or expired;
+	// StatusCode is the source's own code
+	Status     string `json:"status,omitempty"`
+	StatusCode string `json:"status_code,omitempty"`
+	// StatusDescription is the status for people, in the request's language
+	StatusDescription string `json:"status_description,omitempty"`
+	Active            bool   `json:"active"`
+	// Class is a readable operator class for FCC records and the source's
+	// own class elsewhere; ClassCode is the source's code
+	Class     string `json:"class,omitempty"`
+	ClassCode string `json:"class_code,omitempty"`
+	// ClassDescription is an FCC class for people, in the request's language
+	ClassDescription string `json:"class_description,omitempty"`
+	Expires          string `json:"expires,omitempty"`
+	LicensedSince    string `json:"licensed_since,omitempty"`
+	// Effective and LastAction are the ULS's effective and last action
+	// dates; LastAction is when the FCC last changed the license
+	Effective  string `json:"effective,omitempty"`
+	LastAction string `json:"last_action,omitempty"`
+	// GracePeriodEnds is the last day an expired FCC amateur license can
+	// still be renewed
+	GracePeriodEnds string   `json:"grace_period_ends,omitempty"`
+	FirstName       string   `json:"first_name,omitempty"`
+	MiddleInitial   string   `json:"middle_initial,omitempty"`
+	LastName        string   `json:"last_name,omitempty"`
+	Suffix          string   `json:"suffix,omitempty"`
+	PreferredName   string   `json:"preferred_name,omitempty"`
+	Address         string   `json:"address,omitempty"`
+	City            string   `json:"city,omitempty"`
+	State           string   `json:"state,omitempty"`
+	Zip             string   `json:"zip,omitempty"`
+	Country         string   `json:"country,omitempty"`
+	Grid            string   `json:"grid,omitempty"`
+	Latitude        *float64 `json:"latitude,omitempty"`
+	Longitude       *float64 `json:"longitude,omitempty"`
+	QSLManager      string   `json:"qsl_manager,omitempty"`
+	EQSL            *bool    `json:"eqsl,omitempty"`
+
+	SpecialConditions  []SpecialCondition  `json:"special_conditions,omitempty"`
+	SpecialEvent       *SpecialEvent       `json:"special_event,omitempty"`
+	CommercialLicenses []CommercialLicense `json:"commercial_licenses,omitempty"`
+	Programs           []ProgramBadge      `json:"programs,omitempty"`
+	Club               *ClubInfo           `json:"club,omitempty"`
+	Source             *V2Source           `json:"source,omitempty"`
+}
+
+// V2Source is where a /v2 record came from
+type V2Source struct {
+	DataSource string `json:"data_source"`
+	Batch      int64  `json:"batch,omitempty"`
+	// ImportedAt is RFC 3339 in UTC
+	ImportedAt string `json:"imported_at,omitempty"`
+}
+
+// handleV2Callsign handles /v2/callsign/{callsign}: the record for a callsign
+// in the /v2 schema. ?source= picks one data source's record.
+func handleV2Callsign(w http.ResponseWriter, r *http.Request) {
+	raw, _ := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/v2/callsign/"))
+	call := callsign.Base(raw)
+	if call == "" {
+		if upper := strings.ToUpper(strings.TrimSpace(raw)); gmrsCall.MatchString(upper) {
+			call = upper
+		}
+	}
+	if call == "" {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidCallsign, "not a valid callsign", raw)
+		return
+	}
+	spelling, err := parseV2Include(r.URL.Query().Get("include"))
+	if err != nil {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error(), "include")
+		return
+	}
+	lang := requestLanguage(w, r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	d := getDB()
+	if d == nil {
+		writeError(w, r, http.StatusServiceUnavailable, codeDBUnavailable, "database not connected")
+		return
+	}
+
+	source := strings.ToUpper(r.URL.Query().Get("source"))
+	records, err := cachedQueryRecords(ctx, d, call, source)
+	if err != nil {
+		log.Printf("Database error looking up %s (request %s): %v", call, requestIDFrom(ctx), err)
+		writeError(w, r, http.StatusInternalServerError, codeQueryFailed, "lookup failed")
+		return
+	}
+	if len(records) == 0 {
+		// 1x1 special event calls aren't licenses; answer from the event data
+		if event := lookupSpecialEvent(ctx, call); event != nil && source == "" {
+			rec := v2Record(SourceRecord{CallsignData: eventCallsignData(call, event)})
+			rec.SpecialEvent = event
+			spelling.apply(&rec)
+			rec.describe(lang)
+			writeLookupJSON(w, r, rec)
+			return
+		}
+		markNotFound(w)
+		writeErrorDetail(w, r, http.StatusNotFound, codeNotFound, "callsign "+call+" not found", call)
+		return
+	}
+
+	data := records[0]
+	lookupOverride(ctx, data.Call).apply(&data.CallsignData)
+	rec := v2Record(data)
+	if src := lookupSource(ctx, data.Call, data.DataSource); src != nil {
+		rec.Source = &V2Source{DataSource: src.DataSource, Batch: src.Batch, ImportedAt: rfc3339(src.ImportedAt)}
+	}
+	// Special conditions come from the FCC and don't apply to other sources
+	if data.DataSource == batch.FCC || data.DataSource == "" {
+		rec.SpecialConditions = lookupSpecialConditions(ctx, data.Call)
+	}
+	if data.DataSource == batch.FCC {
+		rec.CommercialLicenses = lookupCommercialLicenses(ctx, data.Call)
+	}
+	rec.EQSL = lookupEQSL(ctx, data.Call)
+	rec.Programs = lookupProgramBadges(ctx, data.Call)
+	rec.Club = lookupClub(ctx, data.Call)
+	spelling.apply(&rec)
+	rec.describe(lang)
+	writeLookupJSON(w, r, rec)
+}
+
+// v2Spelling is which spellings of the callsign a /v2 lookup asked for
+type v2Spelling struct {
+	phonetic bool
+	morse    bool
+}
+
+// parseV2Include reads ?include=, a comma-separated list of phonetic and
+// morse
+func parseV2Include(v string) (v2Spelling, error) {
+	var s v2Spelling
+	if v == "" {
+		return s, nil
+	}
+	for _, name := range strings.Split(v, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "phonetic":
+			s.phonetic = true
+		case "morse":
+			s.morse = true
+		case "":
+		default:
+			return s, fmt.Errorf("unknown include %q (expected phonetic or morse)", name)
+		}
+	}
+	return s, nil
+}
+
+// apply adds the requested spellings of the record's callsign
+func (s v2Spelling) apply(rec *V2Callsign) {
+	if s.phonetic {
+		rec.Phonetic = callsign.Phonetic(rec.Callsign)
+	}
+	if s.morse {
+		rec.Morse = callsign.Morse(rec.Callsign)
+	}
+}
+
+// describe adds the readable status and class in a language. Only FCC
+// classes, which v2Record names, are described.
+func (v *V2Callsign) describe(lang string) {
+	v.StatusDescription = i18n.Status(lang, v.StatusCode)
+	if v.Class != v.ClassCode {
+		v.ClassDescription = i18n.Class(lang, v.ClassCode)
+	}
+}
+
+// v2Record converts a record's HamDB strings to the /v2 schema
+func v2Record(rec SourceRecord) V2Callsign {
+	c := rec.CallsignData
+	// GMRS licenses come from the ULS too
+	fcc := rec.DataSource == batch.FCC || rec.DataSource == batch.GMRS || rec.DataSource == ""
+	v := V2Callsign{
+		Callsign:      c.Call,
+		DataSource:    rec.DataSource,
+		StatusCode:    c.Status,
+		Active:        c.Status == "A",
+		ClassCode:     c.Class,
+		Expires:       isoDate(c.Expires, fcc),
+		LicensedSince: isoDate(c.LicensedSince, false),
+		FirstName:     c.FName,
+		MiddleInitial: c.MI,
+		LastName:      c.Name,
+		Suffix:        c.Suffix,
+		PreferredName: c.PreferredName,
+		Address:       c.Addr1,
+		City:          c.Addr2,
+		State:         c.State,
+		Zip:           c.Zip,
+		Country:       c.Country,
+		Grid:          c.Grid,
+		Latitude:      parseCoordinate(c.Lat),
+		Longitude:     parseCoordinate(c.Lon),
+		QSLManager:    c.QSLManager,
+	}
+	v.Effective = isoDate(c.EffectiveDate, false)
+	v.LastAction = isoDate(c.LastActionDate, false)
+	if rec.DataSource == batch.FCC && (c.Status == "A" || c.Status == "E") {
+		v.GracePeriodEnds = gracePeriodEnd(v.Expires, time.Now())
+	}
+	v.Status = licenseStatuses[c.Status]
+	v.Class = c.Class
+	if name, ok := fccClasses[c.Class]; ok && fcc {
+		v.Class = name
+	}
+	return v
+}
+
+// amateurGracePeriod is how long after expiry the FCC accepts an amateur
+// license renewal (47 CFR 97.21)
+const amateurGracePeriod = 2
+
+// gracePeriodEnd returns the last day of the renewal grace period of a
+// license that expired (YYYY-MM-DD) before now, or "" if it hasn't expired
+func gracePeriodEnd(expires string, now time.Time) string {
+	t, err := time.Parse("2006-01-02", expires)
+	if err != nil || !t.Before(now) {
+		return ""
+	}
+	return t.AddDate(amateurGracePeriod, 0, 0).Format("2006-01-02")
+}
+
+// isoDate returns a date as YYYY-MM-DD, or "" if it isn't a recognized
+// date. With fcc set the FCC's MM/DD/YYYY is converted; other sources'
+// slashed dates may be day-first, so they aren't guessed at.
+func isoDate(s string, fcc bool) string {
+	if len(s) >= 10 {
+		if _, err := time.Parse("2006-01-02", s[:10]); err == nil {
+			return s[:10]
+		}
+	}
+	if fcc {
+		if t, err := time.Parse("01/02/2006", s); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+	return ""
+}
+
+// rfc3339 converts an SQLite timestamp ("2006-01-02 15:04:05", UTC) to
+// RFC 3339, passing through anything else
+func rfc3339(s string) string {
+	if t, err := time.Parse("2006-01-02 15:04:05", s); err == nil {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return s
+}
+
+// parseCoordinate returns a latitude or longitude string as a number, or nil
+// if it is empty or redacted
+func parseCoordinate(s string) *float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
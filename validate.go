@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/chriskacerguis/hamqrzdb/internal/callsign"
+)
+
+// usGroupClasses names the operator classes each FCC call sign group is
+// issued to
+var usGroupClasses = map[string]string{
+	"A": "Amateur Extra",
+	"B": "Advanced",
+	"C": "General, Technician Plus",
+	"D": "Technician, Novice",
+
+	callsign.GroupSpecialEvent: "Special event stations of any class",
+}
+
+// USValidation is the response of /v1/validate/us/{callsign}
+type USValidation struct {
+	Callsign string `json:"callsign"`
+	Valid    bool   `json:"valid"`
+	// Reason says why an invalid callsign can't be issued
+	Reason       string `json:"reason,omitempty"`
+	Format       string `json:"format,omitempty"`
+	Group        string `json:"group,omitempty"`
+	GroupClasses string `json:"group_classes,omitempty"`
+	Region       int    `json:"region,omitempty"`
+	RegionName   string `json:"region_name,omitempty"`
+}
+
+// handleValidateUS handles /v1/validate/us/{callsign}: whether a string is a
+// callsign the FCC can issue, and the group and region it would belong to.
+// It doesn't consult the database, so it also answers for unissued calls.
+func handleValidateUS(w http.ResponseWriter, r *http.Request) {
+	prefix, escaped, _ := strings.Cut(r.URL.EscapedPath(), "/validate/us/")
+	raw, _ := url.PathUnescape(escaped)
+	call := callsign.Normalize(raw)
+	if call == "" || len(call) > 16 {
+		writeErrorDetail(w, r, http.StatusBadRequest, codeInvalidCallsign,
+			"a callsign is required, e.g. "+prefix+"/validate/us/W1AW", raw)
+		return
+	}
+
+	us, err := callsign.ParseUS(call)
+	if err != nil {
+		writeJSON(w, r, http.StatusOK, USValidation{
+			Callsign: call,
+			Reason:   strings.TrimPrefix(err.Error(), callsign.ErrNotUS.Error()+": "),
+		})
+		return
+	}
+	writeJSON(w, r, http.StatusOK, USValidation{
+		Callsign:     us.Call,
+		Valid:        true,
+		Format:       us.Format,
+		Group:        us.Group,
+		GroupClasses: usGroupClasses[us.Group],
+		Region:       us.Region,
+		RegionName:   us.RegionName,
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// handleCallsignVCard handles /v1/{callsign}/vcf: the callsign's record as a
+// vCard, so a phone can add the operator as a contact straight from a
+// lookup, or with ?format=mecard as a MeCard string to encode in a QR code
+func handleCallsignVCard(w http.ResponseWriter, r *http.Request, call string) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format != "" && format != "vcard" && format != "mecard" {
+		writeError(w, r, http.StatusBadRequest, codeInvalidParameter,
+			fmt.Sprintf("unknown format %q (expected vcard or mecard)", format))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().queryTimeout)
+	defer cancel()
+
+	rec, ok := lookupCallsign(ctx, call, strings.ToUpper(r.URL.Query().Get("source")))
+	if !ok {
+		markNotFound(w)
+		writeError(w, r, http.StatusNotFound, codeNotFound, fmt.Sprintf("callsign %s not found", call))
+		return
+	}
+	lookupOverride(ctx, rec.Call).apply(&rec.CallsignData)
+
+	if format == "mecard" {
+		writeText(w, http.StatusOK, meCard(rec.CallsignData)+"\n")
+		return
+	}
+	w.Header().Set("Content-Type", "text/vcard; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s.vcf"`, strings.ReplaceAll(rec.Call, "/", "-")))
+	w.Write([]byte(vCard(rec.CallsignData)))
+}
+
+// contactName returns the name a contact is filed under: the preferred
+// name if the operator set one, else the first name, then the last name
+func contactName(c CallsignData) (given, family string) {
+	given = c.FName
+	if c.PreferredName != "" {
+		given = c.PreferredName
+	}
+	return given, c.Name
+}
+
+// contactNote describes the licence for a contact's notes
+func contactNote(c CallsignData) string {
+	return joinNonEmpty(", ", "Amateur radio "+c.Call, labelled("class", c.Class),
+		labelled("grid", c.Grid), labelled("QSL via", c.QSLManager))
+}
+
+// labelled returns "label value", or "" without a value
+func labelled(label, v string) string {
+	if v == "" {
+		return ""
+	}
+	return label + " " + v
+}
+
+// joinNonEmpty joins the non-empty parts with sep
+func joinNonEmpty(sep string, parts ...string) string {
+	var out []string
+	for _, p := range parts {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, sep)
+}
+
+// vCardEscaper escapes vCard text values (RFC 6350 section 3.4)
+var vCardEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// vCard renders a contact as a vCard 3.0, the version phones' contact apps
+// all import. The callsign is the nickname, so the contact can be found by
+// it.
+func vCard(c CallsignData) string {
+	given, family := contactName(c)
+	e := vCardEscaper.Replace
+
+	lines := []string{
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		"N:" + strings.Join([]string{e(family), e(given), e(c.MI), "", e(c.Suffix)}, ";"),
+		"FN:" + e(joinNonEmpty(" ", given, c.Name, c.Suffix, "("+c.Call+")")),
+		"NICKNAME:" + e(c.Call),
+	}
+	if c.Addr1+c.Addr2+c.State+c.Zip != "" {
+		lines = append(lines, "ADR;TYPE=HOME:"+strings.Join([]string{
+			"", "", e(c.Addr1), e(c.Addr2), e(c.State), e(c.Zip), e(c.Country),
+		}, ";"))
+	}
+	if c.Lat != "" && c.Lon != "" {
+		lines = append(lines, "GEO:"+c.Lat+";"+c.Lon)
+	}
+	lines = append(lines, "NOTE:"+e(contactNote(c)), "END:VCARD")
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(foldVCardLine(line))
+	}
+	return b.String()
+}
+
+// foldVCardLine ends a content line with CRLF, folding it into 75-octet
+// lines without splitting a UTF-8 character
+func foldVCardLine(line string) string {
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		n := len(string(r))
+		if width+n > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += n
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// meCardEscaper escapes MeCard values, where \ ; , and : are reserved
+var meCardEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, ":", `\:`, "\r\n", " ", "\n", " ", "\r", " ")
+
+// meCard renders a contact as a MeCard (MECARD:N:...;;), the compact format
+// phone cameras add as a contact when it's scanned from a QR code
+func meCard(c CallsignData) string {
+	given, family := contactName(c)
+	e := meCardEscaper.Replace
+
+	fields := []string{"N:" + e(family) + "," + e(given), "NICKNAME:" + e(c.Call)}
+	// ADR is one value: PO box, extended address, street, city, state,
+	// postal code, and country
+	if c.Addr1+c.Addr2+c.State+c.Zip != "" {
+		fields = append(fields, "ADR:"+strings.Join([]string{
+			"", "", e(c.Addr1), e(c.Addr2), e(c.State), e(c.Zip), e(c.Country),
+		}, ","))
+	}
+	fields = append(fields, "NOTE:"+e(contactNote(c)))
+	return "MECARD:" + strings.Join(fields, ";") + ";;"
+}